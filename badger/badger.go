@@ -0,0 +1,1458 @@
+// badger/badger.go
+
+// Package badger implements a datarepository.DataRepository on an embedded Badger key-value store,
+// on disk or in memory. Importing it registers the "badger" repository type with
+// datarepository.CreateDataRepository.
+package badger
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	datarepository "github.com/itsatony/go-datarepository"
+	nuts "github.com/vaudience/go-nuts"
+)
+
+const (
+	BadgerKeySeparator = "/"
+	// DefaultBadgerGCInterval is the default interval of the value log garbage collection
+	DefaultBadgerGCInterval = 5 * time.Minute
+	// BadgerGCDiscardRatio is the share of a value log file that must be garbage for the
+	// collection to rewrite it
+	BadgerGCDiscardRatio = 0.5
+	// BadgerMaxTxnRetries is the number of times a transaction is retried when it conflicts with
+	// a concurrent one
+	BadgerMaxTxnRetries = 10
+
+	// Lock and version keys live next to the entity prefixes, which must start with a letter
+	badgerLockSegment    = "_lock"
+	badgerVersionSegment = "_version"
+
+	// badgerExpiryStep is the precision, in milliseconds, of the deadline an entry's user metadata
+	// stores below its expiration in whole seconds
+	badgerExpiryStep = 4
+)
+
+type BadgerConfig struct {
+	// Dir is the directory of the database files, which is created if it doesn't exist
+	Dir string
+	// InMemory keeps all data in memory instead of Dir, which must be empty then
+	InMemory bool
+	// KeyPrefix is the first segment of all keys. Defaults to DefaultKeyPrefix.
+	KeyPrefix string
+	// GCInterval is the interval at which the value log is garbage collected.
+	// Defaults to DefaultBadgerGCInterval.
+	GCInterval time.Duration
+	// Codec serializes entity values. Defaults to JSONCodec.
+	Codec datarepository.Codec
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator datarepository.IDGenerator
+	// NotFoundOnEmpty makes List return ErrNotFound instead of an empty result when nothing matches
+	NotFoundOnEmpty bool
+	// Logger receives diagnostic messages, including Badger's own, e.g. about entries skipped by List.
+	// Defaults to a no-op logger.
+	Logger datarepository.Logger
+}
+
+func (c BadgerConfig) GetConnectionString() string {
+	if c.InMemory {
+		return "badger://memory"
+	}
+	return c.Dir
+}
+
+// Validate checks the config without opening the database.
+// Returns ErrInvalidInput naming the offending field.
+func (c BadgerConfig) Validate() error {
+	if c.Dir == "" && !c.InMemory {
+		return datarepository.InvalidConfig("BadgerConfig", "Dir is empty and InMemory is not set")
+	}
+	if c.Dir != "" && c.InMemory {
+		return datarepository.InvalidConfig("BadgerConfig", "Dir must be empty when InMemory is set")
+	}
+	if strings.Contains(c.KeyPrefix, BadgerKeySeparator) {
+		return datarepository.InvalidConfig("BadgerConfig", "KeyPrefix %q contains %q", c.KeyPrefix, BadgerKeySeparator)
+	}
+	return nil
+}
+
+// BadgerIdentifier identifies the entity stored at prefix/EntityPrefix/ID
+type BadgerIdentifier struct {
+	EntityPrefix string
+	ID           string
+}
+
+func (bi BadgerIdentifier) String() string {
+	return bi.EntityPrefix + datarepository.DefaultKeySeparator + bi.ID
+}
+
+// Parts returns the entity prefix and the id
+func (bi BadgerIdentifier) Parts() (string, string) {
+	return bi.EntityPrefix, bi.ID
+}
+
+// BadgerRepository stores entities as codec-serialized values under prefix/entityPrefix/id in an
+// embedded Badger database. Every operation is a Badger transaction, which is retried when it
+// conflicts with a concurrent one. Expirations use Badger's entry TTL, which has a granularity
+// of one second. Pub/sub is delivered in-process, as the database belongs to a single process.
+type BadgerRepository struct {
+	datarepository.BaseRepository
+	db              *badger.DB
+	pubsub          *datarepository.MemoryRepository
+	gc              *nuts.GoInterval
+	prefix          string
+	codec           datarepository.Codec
+	idGen           datarepository.IDGenerator
+	notFoundOnEmpty bool
+	logger          datarepository.Logger
+
+	// Set on the repository passed to a WithTransaction function: the enclosing transaction
+	// and the messages to publish once it commits
+	txn     *badger.Txn
+	pending []pendingMessage
+}
+
+// pendingMessage is a message published within a transaction, sent once the transaction commits
+type pendingMessage struct {
+	channel string
+	message interface{}
+}
+
+var _ datarepository.DataRepository = (*BadgerRepository)(nil)
+
+func init() {
+	datarepository.RegisterDataRepository("badger", NewBadgerRepository)
+}
+
+func NewBadgerRepository(config datarepository.Config) (datarepository.DataRepository, error) {
+	cfg, ok := config.(BadgerConfig)
+	if !ok {
+		return nil, fmt.Errorf("%w: Badger repository needs a BadgerConfig, got %T", datarepository.ErrInvalidInput, config)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = datarepository.DefaultKeyPrefix
+	}
+	if cfg.GCInterval <= 0 {
+		cfg.GCInterval = DefaultBadgerGCInterval
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = datarepository.UUIDv4Generator{}
+	}
+	if cfg.Codec == nil {
+		cfg.Codec = datarepository.JSONCodec{}
+	}
+	logger := datarepository.ResolveLogger(cfg.Logger, nil)
+
+	db, err := badger.Open(badger.DefaultOptions(cfg.Dir).
+		WithInMemory(cfg.InMemory).
+		WithLogger(badgerLogger{logger}))
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	pubsub, err := datarepository.NewMemoryRepository(datarepository.MemoryConfig{Codec: cfg.Codec})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	repo := &BadgerRepository{
+		db:              db,
+		pubsub:          pubsub.(*datarepository.MemoryRepository),
+		prefix:          cfg.KeyPrefix,
+		codec:           cfg.Codec,
+		idGen:           cfg.IDGenerator,
+		notFoundOnEmpty: cfg.NotFoundOnEmpty,
+		logger:          logger,
+	}
+
+	// An in-memory database has no value log to collect
+	if !cfg.InMemory {
+		repo.gc = nuts.Interval(func() bool {
+			repo.collectGarbage()
+			return true
+		}, cfg.GCInterval, false)
+	}
+
+	return repo, nil
+}
+
+// badgerLogger passes Badger's log messages to a Logger, with its info messages as debug messages
+type badgerLogger struct {
+	datarepository.Logger
+}
+
+func (l badgerLogger) Warningf(format string, args ...interface{}) {
+	l.Warnf(format, args...)
+}
+
+func (l badgerLogger) Infof(format string, args ...interface{}) {
+	l.Debugf(format, args...)
+}
+
+// collectGarbage rewrites value log files until none has enough garbage left
+func (r *BadgerRepository) collectGarbage() {
+	for {
+		err := r.db.RunValueLogGC(BadgerGCDiscardRatio)
+		if err == nil {
+			continue
+		}
+		if !errors.Is(err, badger.ErrNoRewrite) && !errors.Is(err, badger.ErrRejected) {
+			r.logger.Errorf("failed to collect value log garbage: %v", err)
+		}
+		return
+	}
+}
+
+// entityKey returns the key of the entity with the given identifier
+func (r *BadgerRepository) entityKey(identifier datarepository.EntityIdentifier) ([]byte, error) {
+	entityPrefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return nil, err
+	}
+	return []byte(r.prefix + BadgerKeySeparator + entityPrefix + BadgerKeySeparator + id), nil
+}
+
+// keyToIdentifier converts an entity key back into its identifier
+func (r *BadgerRepository) keyToIdentifier(key []byte) (BadgerIdentifier, bool) {
+	rest, found := strings.CutPrefix(string(key), r.prefix+BadgerKeySeparator)
+	if !found {
+		return BadgerIdentifier{}, false
+	}
+	entityPrefix, id, found := strings.Cut(rest, BadgerKeySeparator)
+	if !found || id == "" || !datarepository.IsValidEntityPrefix(entityPrefix) {
+		return BadgerIdentifier{}, false
+	}
+	return BadgerIdentifier{EntityPrefix: entityPrefix, ID: id}, true
+}
+
+// segmentKey returns the key of the given segment (lock or version) for an entity key
+func (r *BadgerRepository) segmentKey(segment string, key []byte) []byte {
+	return []byte(r.prefix + BadgerKeySeparator + segment + strings.TrimPrefix(string(key), r.prefix))
+}
+
+// encode serializes an entity value with the configured codec.
+// Returns ErrInvalidInput if value is nil.
+func (r *BadgerRepository) encode(value interface{}) ([]byte, error) {
+	if err := datarepository.CheckValue(value); err != nil {
+		return nil, err
+	}
+	return r.encodeField(value)
+}
+
+// encodeField serializes value with the configured codec. Unlike encode, it accepts nil, which
+// UpdateField stores as null.
+func (r *BadgerRepository) encodeField(value interface{}) ([]byte, error) {
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+	}
+	return data, nil
+}
+
+// badgerExpiresAt converts a duration into a deadline in Unix milliseconds
+func badgerExpiresAt(d time.Duration) uint64 {
+	return uint64(time.Now().Add(d).UnixMilli())
+}
+
+// badgerExpiry returns the deadline of an item in Unix milliseconds, or 0 if it has none. Badger
+// expires entries in whole seconds after the deadline; the user metadata holds how many steps of
+// badgerExpiryStep the deadline lies before that.
+func badgerExpiry(item *badger.Item) uint64 {
+	if item.ExpiresAt() == 0 {
+		return 0
+	}
+	return item.ExpiresAt()*1000 - uint64(item.UserMeta())*badgerExpiryStep
+}
+
+// badgerTTL returns the remaining time to live of an item, or NoExpiration if it has none. It
+// counts down to the deadline that was set, not to the second Badger removes the item in.
+func badgerTTL(item *badger.Item) time.Duration {
+	expiresAt := badgerExpiry(item)
+	if expiresAt == 0 {
+		return datarepository.NoExpiration
+	}
+	ttl := time.Until(time.UnixMilli(int64(expiresAt)))
+	if ttl <= 0 {
+		// Past the deadline, but not yet removed by Badger
+		return time.Millisecond
+	}
+	return ttl
+}
+
+// update runs fn in a read-write transaction and commits it, retrying on conflicts. Within
+// WithTransaction, fn runs in the enclosing transaction instead.
+func (r *BadgerRepository) update(ctx context.Context, fn func(txn *badger.Txn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.txn != nil {
+		return fn(r.txn)
+	}
+	for attempt := 0; attempt < BadgerMaxTxnRetries; attempt++ {
+		txn := r.db.NewTransaction(true)
+		if err := fn(txn); err != nil {
+			txn.Discard()
+			return err
+		}
+		err := txn.Commit()
+		if errors.Is(err, badger.ErrConflict) {
+			continue
+		}
+		if err != nil {
+			return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		return nil
+	}
+	return fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+// view runs fn in a read-only transaction, or in the enclosing transaction within WithTransaction
+func (r *BadgerRepository) view(ctx context.Context, fn func(txn *badger.Txn) error) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	if r.txn != nil {
+		return fn(r.txn)
+	}
+	txn := r.db.NewTransaction(false)
+	defer txn.Discard()
+	return fn(txn)
+}
+
+// badgerGet returns the live item of the key, or ErrNotFound
+func badgerGet(txn *badger.Txn, key []byte) (*badger.Item, error) {
+	item, err := txn.Get(key)
+	if errors.Is(err, badger.ErrKeyNotFound) {
+		return nil, datarepository.ErrNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return item, nil
+}
+
+// badgerValue returns a copy of the value of an item, valid beyond its transaction
+func badgerValue(item *badger.Item) ([]byte, error) {
+	value, err := item.ValueCopy(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return value, nil
+}
+
+// badgerSet writes the value of the key, expiring at expiresAt (in Unix milliseconds) unless it
+// is 0. Badger removes the entry in the following second, see badgerExpiry.
+func badgerSet(txn *badger.Txn, key, value []byte, expiresAt uint64) error {
+	entry := badger.NewEntry(key, value)
+	if expiresAt > 0 {
+		entry.ExpiresAt = expiresAt/1000 + 1
+		entry.UserMeta = byte((entry.ExpiresAt*1000 - expiresAt + badgerExpiryStep - 1) / badgerExpiryStep)
+	}
+	if err := txn.SetEntry(entry); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// badgerDelete deletes the key
+func badgerDelete(txn *badger.Txn, key []byte) error {
+	if err := txn.Delete(key); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// readVersion returns the version of an entity, which is 0 if it was never updated with
+// UpdateWithVersion. The version key expires together with its entity.
+func (r *BadgerRepository) readVersion(txn *badger.Txn, key []byte) (int64, error) {
+	item, err := badgerGet(txn, r.segmentKey(badgerVersionSegment, key))
+	if datarepository.IsNotFoundError(err) {
+		return 0, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	value, err := badgerValue(item)
+	if err != nil {
+		return 0, err
+	}
+	version, err := strconv.ParseInt(string(value), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid version %q", datarepository.ErrOperationFailed, value)
+	}
+	return version, nil
+}
+
+// write stores the value of an entity expiring at expiresAt. A new entity starts without the
+// version a previous one with the same key may have left; an existing one keeps its version,
+// whose key gets the new expiration.
+func (r *BadgerRepository) write(txn *badger.Txn, key, value []byte, expiresAt uint64, exists bool) error {
+	if err := badgerSet(txn, key, value, expiresAt); err != nil {
+		return err
+	}
+	versionKey := r.segmentKey(badgerVersionSegment, key)
+	if !exists {
+		return badgerDelete(txn, versionKey)
+	}
+	version, err := r.readVersion(txn, key)
+	if err != nil || version == 0 {
+		return err
+	}
+	return badgerSet(txn, versionKey, []byte(strconv.FormatInt(version, 10)), expiresAt)
+}
+
+// remove deletes an entity and its version
+func (r *BadgerRepository) remove(txn *badger.Txn, key []byte) error {
+	if err := badgerDelete(txn, key); err != nil {
+		return err
+	}
+	return badgerDelete(txn, r.segmentKey(badgerVersionSegment, key))
+}
+
+// modify applies fn to the current value of an existing entity and stores the result. The
+// entity keeps its expiration. Returns the value fn was applied to.
+func (r *BadgerRepository) modify(ctx context.Context, identifier datarepository.EntityIdentifier, fn func(current []byte) ([]byte, error)) ([]byte, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return nil, err
+	}
+	var previous []byte
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil {
+			return err
+		}
+		current, err := badgerValue(item)
+		if err != nil {
+			return err
+		}
+		updated, err := fn(current)
+		if err != nil {
+			return err
+		}
+		previous = current
+		return badgerSet(txn, key, updated, badgerExpiry(item))
+	})
+	return previous, err
+}
+
+// create writes a new entity with an optional expiration unless it exists. Returns false if it does.
+func (r *BadgerRepository) create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return false, err
+	}
+	var expiresAt uint64
+	if ttl > 0 {
+		expiresAt = badgerExpiresAt(ttl)
+	}
+
+	created := false
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		_, err := badgerGet(txn, key)
+		if err == nil {
+			created = false
+			return nil
+		}
+		if !datarepository.IsNotFoundError(err) {
+			return err
+		}
+		created = true
+		return r.write(txn, key, data, expiresAt, false)
+	})
+	return created, err
+}
+
+func (r *BadgerRepository) Create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	created, err := r.create(ctx, identifier, value, 0)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return datarepository.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *BadgerRepository) CreateIfAbsent(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", datarepository.ErrInvalidInput)
+	}
+	return r.create(ctx, identifier, value, ttl)
+}
+
+func (r *BadgerRepository) CreateWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return datarepository.CreateWithTTL(ctx, r, identifier, value, ttl)
+}
+
+func (r *BadgerRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (datarepository.EntityIdentifier, error) {
+	if !datarepository.IsValidEntityPrefix(entityPrefix) {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidIdentifier, datarepository.ErrInvalidEntityPrefix)
+	}
+	return datarepository.CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) datarepository.EntityIdentifier {
+		return BadgerIdentifier{EntityPrefix: entityPrefix, ID: id}
+	})
+}
+
+// read returns the value and remaining time to live of an entity
+func (r *BadgerRepository) read(ctx context.Context, identifier datarepository.EntityIdentifier) ([]byte, time.Duration, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return nil, 0, err
+	}
+	var data []byte
+	var ttl time.Duration
+	err = r.view(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil {
+			return err
+		}
+		ttl = badgerTTL(item)
+		data, err = badgerValue(item)
+		return err
+	})
+	return data, ttl, err
+}
+
+func (r *BadgerRepository) Read(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	data, _, err := r.read(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *BadgerRepository) Exists(ctx context.Context, identifier datarepository.EntityIdentifier) (bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	exists := false
+	err = r.view(ctx, func(txn *badger.Txn) error {
+		_, err := badgerGet(txn, key)
+		exists = err == nil
+		if datarepository.IsNotFoundError(err) {
+			return nil
+		}
+		return err
+	})
+	return exists, err
+}
+
+func (r *BadgerRepository) ExistsMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) (map[datarepository.EntityIdentifier]bool, error) {
+	return datarepository.ExistsMany(ctx, r, identifiers)
+}
+
+func (r *BadgerRepository) ReadWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) (time.Duration, error) {
+	data, ttl, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.codec.Unmarshal(data, value); err != nil {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+// upsert writes an entity, creating it if it doesn't exist. An existing entity keeps its
+// version and, unless ttl is positive, its expiration.
+func (r *BadgerRepository) upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil && !datarepository.IsNotFoundError(err) {
+			return err
+		}
+		var expiresAt uint64
+		if ttl > 0 {
+			expiresAt = badgerExpiresAt(ttl)
+		} else if item != nil {
+			expiresAt = badgerExpiry(item)
+		}
+		return r.write(txn, key, data, expiresAt, item != nil)
+	})
+}
+
+func (r *BadgerRepository) Upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	return r.upsert(ctx, identifier, value, 0)
+}
+
+func (r *BadgerRepository) UpsertWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	return r.upsert(ctx, identifier, value, ttl)
+}
+
+func (r *BadgerRepository) UpsertManyWithTTL(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		if err := r.upsert(ctx, identifier, value, ttl); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *BadgerRepository) Update(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	_, err = r.modify(ctx, identifier, func([]byte) ([]byte, error) {
+		return data, nil
+	})
+	return err
+}
+
+// errValueMismatch aborts the modification made by CompareAndSwap
+var errValueMismatch = errors.New("value does not match")
+
+func (r *BadgerRepository) CompareAndSwap(ctx context.Context, identifier datarepository.EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	data, err := r.encode(newValue)
+	if err != nil {
+		return false, err
+	}
+	_, err = r.modify(ctx, identifier, func(current []byte) ([]byte, error) {
+		equal, err := datarepository.EqualEncoded(r.codec, current, expected)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			return nil, errValueMismatch
+		}
+		return data, nil
+	})
+	if errors.Is(err, errValueMismatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *BadgerRepository) UpdateWithVersion(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return 0, err
+	}
+
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil {
+			return err
+		}
+		version, err := r.readVersion(txn, key)
+		if err != nil {
+			return err
+		}
+		if version != expectedVersion {
+			return datarepository.ErrVersionConflict
+		}
+		if err := badgerSet(txn, key, data, badgerExpiry(item)); err != nil {
+			return err
+		}
+		newVersion := []byte(strconv.FormatInt(expectedVersion+1, 10))
+		return badgerSet(txn, r.segmentKey(badgerVersionSegment, key), newVersion, badgerExpiry(item))
+	})
+	if err != nil {
+		return 0, err
+	}
+	return expectedVersion + 1, nil
+}
+
+func (r *BadgerRepository) GetVersion(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = r.view(ctx, func(txn *badger.Txn) error {
+		if _, err := badgerGet(txn, key); err != nil {
+			return err
+		}
+		version, err = r.readVersion(txn, key)
+		return err
+	})
+	return version, err
+}
+
+// toGeneric decodes a stored value into its generic representation (maps, slices and scalars)
+func (r *BadgerRepository) toGeneric(data []byte) (interface{}, error) {
+	var generic interface{}
+	if err := r.codec.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return generic, nil
+}
+
+func (r *BadgerRepository) UpdateField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	encoded, err := r.encodeField(value)
+	if err != nil {
+		return err
+	}
+	fieldValue, err := r.toGeneric(encoded)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.modify(ctx, identifier, func(current []byte) ([]byte, error) {
+		doc, err := r.toGeneric(current)
+		if err != nil {
+			return nil, err
+		}
+		if err := datarepository.SetFieldPath(doc, parts, fieldValue); err != nil {
+			return nil, err
+		}
+		return r.encode(doc)
+	})
+	return err
+}
+
+func (r *BadgerRepository) ReadField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	current, _, err := r.read(ctx, identifier)
+	if err != nil {
+		return err
+	}
+
+	doc, err := r.toGeneric(current)
+	if err != nil {
+		return err
+	}
+	field, err := datarepository.GetFieldPath(doc, parts)
+	if err != nil {
+		return err
+	}
+	data, err := r.codec.Marshal(field)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+// take deletes an entity and returns its value
+func (r *BadgerRepository) take(ctx context.Context, identifier datarepository.EntityIdentifier) ([]byte, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return nil, err
+	}
+	var data []byte
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil {
+			return err
+		}
+		if data, err = badgerValue(item); err != nil {
+			return err
+		}
+		return r.remove(txn, key)
+	})
+	return data, err
+}
+
+func (r *BadgerRepository) Delete(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	_, err := r.take(ctx, identifier)
+	return err
+}
+
+func (r *BadgerRepository) GetAndDelete(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	data, err := r.take(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *BadgerRepository) GetAndSet(ctx context.Context, identifier datarepository.EntityIdentifier, newValue, oldValue interface{}) error {
+	data, err := r.encode(newValue)
+	if err != nil {
+		return err
+	}
+	previous, err := r.modify(ctx, identifier, func([]byte) ([]byte, error) {
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(previous, oldValue)
+}
+
+func (r *BadgerRepository) CreateMany(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}) error {
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		if err := r.Create(ctx, identifier, value); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *BadgerRepository) ReadMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		data, _, err := r.read(ctx, identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		if err := fn(identifier, data); err != nil {
+			return err
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *BadgerRepository) ReadManyOrdered(ctx context.Context, identifiers []datarepository.EntityIdentifier, dest interface{}) error {
+	return datarepository.ReadManyOrdered(ctx, r, r.codec, identifiers, dest)
+}
+
+func (r *BadgerRepository) DeleteMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.Delete(ctx, identifier); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern collects the matching entities with Iterate and removes them with DeleteMany
+func (r *BadgerRepository) DeletePattern(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	return datarepository.DeletePattern(ctx, r, pattern)
+}
+
+// patternRange returns the key prefix covering all entities whose identifier (entityPrefix:id)
+// may match the glob pattern, together with the regular expression the identifiers must match
+func (r *BadgerRepository) patternRange(pattern string) ([]byte, *regexp.Regexp, error) {
+	regex, err := regexp.Compile(datarepository.GlobToRegex(pattern))
+	if err != nil {
+		return nil, nil, fmt.Errorf("%w: invalid pattern", datarepository.ErrInvalidInput)
+	}
+	literal := datarepository.GlobLiteralPrefix(pattern)
+	keyPrefix := r.prefix + BadgerKeySeparator
+	if entityPrefix, id, found := strings.Cut(literal, datarepository.DefaultKeySeparator); found {
+		keyPrefix += entityPrefix + BadgerKeySeparator + id
+	} else {
+		keyPrefix += literal
+	}
+	return []byte(keyPrefix), regex, nil
+}
+
+// scan calls fn for every entity matching the glob pattern, in key order, with Badger's prefix
+// iterator. The value is nil unless withValues is set.
+func (r *BadgerRepository) scan(ctx context.Context, pattern string, withValues bool, fn func(identifier BadgerIdentifier, value []byte) error) error {
+	keyPrefix, regex, err := r.patternRange(pattern)
+	if err != nil {
+		return err
+	}
+	return r.view(ctx, func(txn *badger.Txn) error {
+		opts := badger.DefaultIteratorOptions
+		opts.Prefix = keyPrefix
+		opts.PrefetchValues = withValues
+		it := txn.NewIterator(opts)
+		defer it.Close()
+
+		for it.Seek(keyPrefix); it.ValidForPrefix(keyPrefix); it.Next() {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			item := it.Item()
+			identifier, ok := r.keyToIdentifier(item.Key())
+			if !ok || !regex.MatchString(identifier.String()) {
+				continue
+			}
+			var value []byte
+			if withValues {
+				if value, err = badgerValue(item); err != nil {
+					return err
+				}
+			}
+			if err := fn(identifier, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// matchingIdentifiers returns the sorted identifiers of all entities matching the glob pattern
+func (r *BadgerRepository) matchingIdentifiers(ctx context.Context, pattern string) ([]BadgerIdentifier, error) {
+	var identifiers []BadgerIdentifier
+	err := r.scan(ctx, pattern, false, func(identifier BadgerIdentifier, _ []byte) error {
+		identifiers = append(identifiers, identifier)
+		return nil
+	})
+	return identifiers, err
+}
+
+// fetchEntities retrieves and decodes the values of the given entities.
+// Entities that were removed in the meantime are left out; values that can't be decoded are
+// reported as skipped.
+func (r *BadgerRepository) fetchEntities(ctx context.Context, identifiers []BadgerIdentifier) (datarepository.ListResult, error) {
+	result := datarepository.ListResult{
+		Identifiers: make([]datarepository.EntityIdentifier, 0, len(identifiers)),
+		Entities:    make([]interface{}, 0, len(identifiers)),
+	}
+	for _, identifier := range identifiers {
+		data, _, err := r.read(ctx, identifier)
+		if datarepository.IsNotFoundError(err) {
+			continue
+		}
+		if err != nil {
+			return datarepository.ListResult{}, err
+		}
+		var entity interface{}
+		if err := r.codec.Unmarshal(data, &entity); err != nil {
+			r.logger.Warnf("skipping entity %q that could not be decoded: %v", identifier.String(), err)
+			result.Skipped = append(result.Skipped, datarepository.SkippedKey{Key: identifier.String(), Err: err})
+			continue
+		}
+		result.Identifiers = append(result.Identifiers, identifier)
+		result.Entities = append(result.Entities, entity)
+	}
+	return result, nil
+}
+
+func (r *BadgerRepository) List(ctx context.Context, pattern string) ([]datarepository.EntityIdentifier, []interface{}, error) {
+	result, err := r.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(r.notFoundOnEmpty)
+}
+
+func (r *BadgerRepository) ListDetailed(ctx context.Context, pattern string) (datarepository.ListResult, error) {
+	identifiers, err := r.matchingIdentifiers(ctx, pattern)
+	if err != nil {
+		return datarepository.ListResult{}, err
+	}
+	result, err := r.fetchEntities(ctx, identifiers)
+	if err != nil {
+		return datarepository.ListResult{}, err
+	}
+	if len(result.Identifiers) == 0 && len(result.Skipped) == 0 && r.notFoundOnEmpty {
+		return datarepository.ListResult{}, datarepository.ErrNotFound
+	}
+	return result, nil
+}
+
+func (r *BadgerRepository) Count(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	var count int64
+	err := r.scan(ctx, pattern.String(), false, func(BadgerIdentifier, []byte) error {
+		count++
+		return nil
+	})
+	return count, err
+}
+
+// Iterate reads the matching entities in key order within one read-only transaction, so fn
+// sees a consistent snapshot
+func (r *BadgerRepository) Iterate(ctx context.Context, pattern datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	return r.scan(ctx, pattern.String(), true, func(identifier BadgerIdentifier, value []byte) error {
+		return fn(identifier, value)
+	})
+}
+
+func (r *BadgerRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]datarepository.EntityIdentifier, []interface{}, uint64, error) {
+	if pageSize <= 0 {
+		return nil, nil, 0, fmt.Errorf("%w: page size must be positive", datarepository.ErrInvalidInput)
+	}
+	identifiers, err := r.matchingIdentifiers(ctx, pattern)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// The cursor is an offset into the sorted list of matching entities
+	if cursor >= uint64(len(identifiers)) {
+		return []datarepository.EntityIdentifier{}, []interface{}{}, 0, nil
+	}
+	end := cursor + uint64(pageSize)
+	nextCursor := end
+	if end >= uint64(len(identifiers)) {
+		end = uint64(len(identifiers))
+		nextCursor = 0
+	}
+	result, err := r.fetchEntities(ctx, identifiers[cursor:end])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return result.Identifiers, result.Entities, nextCursor, nil
+}
+
+func (r *BadgerRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]datarepository.EntityIdentifier, string, error) {
+	return datarepository.ListPage(ctx, r, pattern, cursor, pageSize)
+}
+
+func (r *BadgerRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	err := r.scan(ctx, "*", false, func(identifier BadgerIdentifier, _ []byte) error {
+		seen[identifier.EntityPrefix] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (r *BadgerRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *BadgerRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]datarepository.EntityIdentifier, error) {
+	return nil, fmt.Errorf("%w: the Badger repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *BadgerRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (datarepository.SearchResult, error) {
+	return datarepository.SearchResult{}, fmt.Errorf("%w: the Badger repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *BadgerRepository) SearchResults(ctx context.Context, query string, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return datarepository.SearchResponse{}, fmt.Errorf("%w: the Badger repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *BadgerRepository) SearchQuery(ctx context.Context, query *datarepository.Query, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return datarepository.SearchResponse{}, fmt.Errorf("%w: the Badger repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *BadgerRepository) AcquireLock(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (bool, error) {
+	_, acquired, err := r.AcquireLockWithToken(ctx, identifier, ttl)
+	return acquired, err
+}
+
+// AcquireLockWithToken stores the token under the lock key with the given TTL unless the lock is held
+func (r *BadgerRepository) AcquireLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return "", false, err
+	}
+	lockKey := r.segmentKey(badgerLockSegment, key)
+	token := datarepository.NewLockToken()
+
+	acquired := false
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		_, err := badgerGet(txn, lockKey)
+		if err == nil {
+			acquired = false
+			return nil
+		}
+		if !datarepository.IsNotFoundError(err) {
+			return err
+		}
+		acquired = true
+		return badgerSet(txn, lockKey, []byte(token), badgerExpiresAt(ttl))
+	})
+	if err != nil || !acquired {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+// releaseLock deletes the lock if owned by token, or regardless of its owner if token is empty
+func (r *BadgerRepository) releaseLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	lockKey := r.segmentKey(badgerLockSegment, key)
+	return r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, lockKey)
+		if err != nil {
+			return err
+		}
+		if token != "" {
+			owner, err := badgerValue(item)
+			if err != nil {
+				return err
+			}
+			if string(owner) != token {
+				return datarepository.ErrLockNotOwned
+			}
+		}
+		return badgerDelete(txn, lockKey)
+	})
+}
+
+func (r *BadgerRepository) ReleaseLock(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return r.releaseLock(ctx, identifier, "")
+}
+
+func (r *BadgerRepository) ReleaseLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	if token == "" {
+		return datarepository.ErrLockNotOwned
+	}
+	return r.releaseLock(ctx, identifier, token)
+}
+
+func (r *BadgerRepository) RenewLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	lockKey := r.segmentKey(badgerLockSegment, key)
+	renewed := false
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, lockKey)
+		if datarepository.IsNotFoundError(err) {
+			renewed = false
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		owner, err := badgerValue(item)
+		if err != nil {
+			return err
+		}
+		renewed = string(owner) == token
+		if !renewed {
+			return nil
+		}
+		return badgerSet(txn, lockKey, owner, badgerExpiresAt(ttl))
+	})
+	return renewed, err
+}
+
+func (r *BadgerRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	if r.txn != nil {
+		r.pending = append(r.pending, pendingMessage{channel: channel, message: message})
+		return nil
+	}
+	return r.pubsub.Publish(ctx, channel, message)
+}
+
+func (r *BadgerRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	if r.txn != nil {
+		return nil, datarepository.ErrInTransaction
+	}
+	return r.pubsub.Subscribe(ctx, channel)
+}
+
+func (r *BadgerRepository) SubscribeMessages(ctx context.Context, channel string) (datarepository.Subscription, error) {
+	if r.txn != nil {
+		return nil, datarepository.ErrInTransaction
+	}
+	return r.pubsub.SubscribeMessages(ctx, channel)
+}
+
+func (r *BadgerRepository) PSubscribe(ctx context.Context, pattern string) (datarepository.Subscription, error) {
+	if r.txn != nil {
+		return nil, datarepository.ErrInTransaction
+	}
+	return r.pubsub.PSubscribe(ctx, pattern)
+}
+
+func (r *BadgerRepository) Ping(ctx context.Context) error {
+	if r.db.IsClosed() {
+		return fmt.Errorf("%w: database is closed", datarepository.ErrOperationFailed)
+	}
+	return ctx.Err()
+}
+
+func (r *BadgerRepository) Close() error {
+	if r.txn != nil {
+		return datarepository.ErrInTransaction
+	}
+	if r.gc != nil {
+		r.gc.Stop()
+	}
+	r.pubsub.Close()
+	if err := r.db.Close(); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// setExpiresAt rewrites an entity (and its version) with the expiration returned by expiresAt,
+// called with the current one (0 if none), if ok is true
+func (r *BadgerRepository) setExpiresAt(ctx context.Context, identifier datarepository.EntityIdentifier, expiresAt func(current uint64) (uint64, bool)) (bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	applied := false
+	err = r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil {
+			return err
+		}
+		next, ok := expiresAt(badgerExpiry(item))
+		applied = ok
+		if !ok {
+			return nil
+		}
+		value, err := badgerValue(item)
+		if err != nil {
+			return err
+		}
+		return r.write(txn, key, value, next, true)
+	})
+	return applied, err
+}
+
+func (r *BadgerRepository) SetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration) error {
+	_, err := r.setExpiresAt(ctx, identifier, func(uint64) (uint64, bool) {
+		return badgerExpiresAt(expiration), true
+	})
+	return err
+}
+
+func (r *BadgerRepository) SetExpirationMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, expiration time.Duration) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.SetExpiration(ctx, identifier, expiration); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *BadgerRepository) SetExpirationCond(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration, cond datarepository.ExpirationCondition) (bool, error) {
+	switch cond {
+	case datarepository.ExpireNX, datarepository.ExpireXX, datarepository.ExpireGT, datarepository.ExpireLT:
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", datarepository.ErrInvalidInput, cond)
+	}
+	next := badgerExpiresAt(expiration)
+	applied, err := r.setExpiresAt(ctx, identifier, func(current uint64) (uint64, bool) {
+		switch cond {
+		case datarepository.ExpireNX:
+			return next, current == 0
+		case datarepository.ExpireXX:
+			return next, current != 0
+		case datarepository.ExpireGT:
+			// No expiration counts as infinite, which can't be exceeded
+			return next, current != 0 && next > current
+		default:
+			return next, current == 0 || next < current
+		}
+	})
+	if datarepository.IsNotFoundError(err) {
+		return false, nil
+	}
+	return applied, err
+}
+
+func (r *BadgerRepository) GetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier) (time.Duration, error) {
+	_, ttl, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	if ttl == datarepository.NoExpiration {
+		return 0, datarepository.ErrNotFound
+	}
+	return ttl, nil
+}
+
+func (r *BadgerRepository) Persist(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	_, err := r.setExpiresAt(ctx, identifier, func(uint64) (uint64, bool) {
+		return 0, true
+	})
+	return err
+}
+
+// Touch only checks that the entity exists
+func (r *BadgerRepository) Touch(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return datarepository.TouchExisting(ctx, r, identifier)
+}
+
+// increment applies fn to the counter stored for identifier, or to nil if there is none, and
+// stores the value it returns unless it also returns false. A new counter expires after ttl if
+// positive, an existing one keeps its expiration, or gets one after ttl if it has none.
+func (r *BadgerRepository) increment(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration, fn func(current []byte) (interface{}, bool, error)) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	return r.update(ctx, func(txn *badger.Txn) error {
+		item, err := badgerGet(txn, key)
+		if err != nil && !datarepository.IsNotFoundError(err) {
+			return err
+		}
+		var current []byte
+		var expiresAt uint64
+		if item != nil {
+			if current, err = badgerValue(item); err != nil {
+				return err
+			}
+			expiresAt = badgerExpiry(item)
+		}
+		value, store, err := fn(current)
+		if err != nil || !store {
+			return err
+		}
+		data, err := r.encode(value)
+		if err != nil {
+			return err
+		}
+		if expiresAt == 0 && ttl > 0 {
+			expiresAt = badgerExpiresAt(ttl)
+		}
+		return r.write(txn, key, data, expiresAt, item != nil)
+	})
+}
+
+func (r *BadgerRepository) AtomicIncrement(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return r.IncrementBy(ctx, identifier, 1)
+}
+
+func (r *BadgerRepository) IncrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	value, _, err := r.IncrementWithLimit(ctx, identifier, delta, math.MaxInt64)
+	return value, err
+}
+
+func (r *BadgerRepository) DecrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	return r.IncrementBy(ctx, identifier, -delta)
+}
+
+// intCounter decodes the current value of an integer counter, which is 0 if there is none
+func (r *BadgerRepository) intCounter(current []byte) (int64, error) {
+	var value int64
+	if current != nil {
+		if err := r.codec.Unmarshal(current, &value); err != nil {
+			return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+		}
+	}
+	return value, nil
+}
+
+func (r *BadgerRepository) IncrementWithLimit(ctx context.Context, identifier datarepository.EntityIdentifier, delta, max int64) (int64, bool, error) {
+	var value int64
+	var applied bool
+	err := r.increment(ctx, identifier, 0, func(current []byte) (interface{}, bool, error) {
+		counter, err := r.intCounter(current)
+		if err != nil {
+			return nil, false, err
+		}
+		value, applied = counter, counter+delta <= max
+		if applied {
+			value += delta
+		}
+		return value, applied, nil
+	})
+	if err != nil {
+		return 0, false, err
+	}
+	return value, applied, nil
+}
+
+func (r *BadgerRepository) IncrementWithExpiry(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	var value int64
+	err := r.increment(ctx, identifier, ttl, func(current []byte) (interface{}, bool, error) {
+		counter, err := r.intCounter(current)
+		value = counter + delta
+		return value, true, err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (r *BadgerRepository) IncrementFloat(ctx context.Context, identifier datarepository.EntityIdentifier, delta float64) (float64, error) {
+	var value float64
+	err := r.increment(ctx, identifier, 0, func(current []byte) (interface{}, bool, error) {
+		var counter float64
+		if current != nil {
+			if err := r.codec.Unmarshal(current, &counter); err != nil {
+				return nil, false, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+			}
+		}
+		value = counter + delta
+		return value, true, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value, nil
+}
+
+func (r *BadgerRepository) GetCounter(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	data, _, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	return r.intCounter(data)
+}
+
+func (r *BadgerRepository) SetCounter(ctx context.Context, identifier datarepository.EntityIdentifier, value int64) error {
+	return r.Upsert(ctx, identifier, value)
+}
+
+// WithTransaction runs fn within a Badger transaction, which is retried if it conflicts with a
+// concurrent one. Within a transaction, fn becomes part of the enclosing one, as Badger has no
+// nested transactions: its writes are only discarded if the outermost function fails.
+func (r *BadgerRepository) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	if r.txn != nil {
+		return fn(r)
+	}
+	var txRepo *BadgerRepository
+	err := r.update(ctx, func(txn *badger.Txn) error {
+		txRepo = &BadgerRepository{
+			BaseRepository:  r.BaseRepository,
+			db:              r.db,
+			pubsub:          r.pubsub,
+			prefix:          r.prefix,
+			codec:           r.codec,
+			idGen:           r.idGen,
+			notFoundOnEmpty: r.notFoundOnEmpty,
+			logger:          r.logger,
+			txn:             txn,
+		}
+		return fn(txRepo)
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range txRepo.pending {
+		if err := r.Publish(ctx, pending.channel, pending.message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
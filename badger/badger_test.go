@@ -0,0 +1,103 @@
+// badger/badger_test.go
+
+package badger
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/itsatony/go-datarepository/datarepositorytest"
+)
+
+// newTestBadgerRepository returns a BadgerRepository that is closed when the test ends. An empty
+// config uses an in-memory database.
+func newTestBadgerRepository(t *testing.T, config BadgerConfig) *BadgerRepository {
+	t.Helper()
+	if config.Dir == "" {
+		config.InMemory = true
+	}
+	repo, err := NewBadgerRepository(config)
+	if err != nil {
+		t.Fatalf("NewBadgerRepository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo.(*BadgerRepository)
+}
+
+func TestBadgerConformance(t *testing.T) {
+	datarepositorytest.Conformance(t, newTestBadgerRepository(t, BadgerConfig{}))
+}
+
+func TestBadgerExpirationKeepsRequestedDeadline(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestBadgerRepository(t, BadgerConfig{})
+	id := datarepository.SimpleIdentifier("user:1")
+	if err := repo.CreateWithTTL(ctx, id, map[string]string{"name": "ann"}, 1500*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	// Badger expires entries in whole seconds, which must not extend the reported TTL
+	first, err := repo.GetExpiration(ctx, id)
+	if err != nil || first <= time.Second || first > 1500*time.Millisecond {
+		t.Fatalf("GetExpiration: got %v, %v, want up to 1.5s", first, err)
+	}
+	// Updates keep the deadline
+	if err := repo.Update(ctx, id, map[string]string{"name": "bob"}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if ttl, err := repo.GetExpiration(ctx, id); err != nil || ttl <= 0 || ttl > first {
+		t.Errorf("GetExpiration after Update: got %v, %v, want up to %v", ttl, err, first)
+	}
+}
+
+func TestBadgerPersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	first := newTestBadgerRepository(t, BadgerConfig{Dir: dir})
+	if err := first.Create(ctx, datarepository.SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := first.CreateWithTTL(ctx, datarepository.SimpleIdentifier("user:2"), map[string]string{"name": "bob"}, time.Hour); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if _, err := first.IncrementBy(ctx, datarepository.SimpleIdentifier("hits:1"), 5); err != nil {
+		t.Fatalf("IncrementBy: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	second := newTestBadgerRepository(t, BadgerConfig{Dir: dir})
+	var value map[string]string
+	if err := second.Read(ctx, datarepository.SimpleIdentifier("user:1"), &value); err != nil || value["name"] != "ann" {
+		t.Errorf("Read after reopening: got %v, %v", value, err)
+	}
+	if ttl, err := second.GetExpiration(ctx, datarepository.SimpleIdentifier("user:2")); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetExpiration after reopening: got %v, %v, want about an hour", ttl, err)
+	}
+	if n, err := second.GetCounter(ctx, datarepository.SimpleIdentifier("hits:1")); err != nil || n != 5 {
+		t.Errorf("GetCounter after reopening: got %d, %v, want 5", n, err)
+	}
+	if ids, _, err := second.List(ctx, "user:*"); err != nil || len(ids) != 2 {
+		t.Errorf("List after reopening: got %v, %v, want 2 entities", ids, err)
+	}
+}
+
+func TestCreateDataRepositoryRejectsInvalidBadgerConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		config BadgerConfig
+		want   string
+	}{
+		{BadgerConfig{}, "BadgerConfig: Dir is empty and InMemory is not set"},
+		{BadgerConfig{Dir: "data", InMemory: true}, "BadgerConfig: Dir must be empty when InMemory is set"},
+		{BadgerConfig{InMemory: true, KeyPrefix: "app" + BadgerKeySeparator}, "BadgerConfig: KeyPrefix"},
+	} {
+		_, err := datarepository.CreateDataRepository("badger", tc.config)
+		if !errors.Is(err, datarepository.ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: got %v, want ErrInvalidInput containing %q", tc.config, err, tc.want)
+		}
+	}
+}
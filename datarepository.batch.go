@@ -0,0 +1,146 @@
+// datarepository.batch.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Batch operations (CreateMany, ReadMany, DeleteMany, UpsertManyWithTTL, SetExpirationMany) give different
+// atomicity guarantees per backend:
+//   - Redis sends all commands in a single pipeline. The pipeline is not atomic; other
+//     clients may observe a partially applied batch, and failed items do not roll back
+//     the successful ones.
+//   - Memory applies the whole batch under a single lock acquisition, so other callers
+//     observe either none or all of the successfully applied items.
+// In both cases, failures are reported per item in a *BatchError.
+
+// BatchItemError records the failure of a single item in a batch operation
+type BatchItemError struct {
+	Identifier EntityIdentifier
+	Err        error
+}
+
+func (e BatchItemError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Identifier, e.Err)
+}
+
+func (e BatchItemError) Unwrap() error {
+	return e.Err
+}
+
+// BatchError is returned by batch operations when one or more items failed.
+// Items not listed in Errors were applied successfully.
+type BatchError struct {
+	Errors []BatchItemError
+}
+
+func (e *BatchError) Error() string {
+	msgs := make([]string, 0, len(e.Errors))
+	for _, itemErr := range e.Errors {
+		msgs = append(msgs, itemErr.Error())
+	}
+	return fmt.Sprintf("%d batch item(s) failed: %s", len(e.Errors), strings.Join(msgs, "; "))
+}
+
+// Unwrap returns the individual item errors so errors.Is and errors.As match any of them
+func (e *BatchError) Unwrap() []error {
+	errs := make([]error, 0, len(e.Errors))
+	for _, itemErr := range e.Errors {
+		errs = append(errs, itemErr)
+	}
+	return errs
+}
+
+// Failed returns the identifiers of all failed items
+func (e *BatchError) Failed() []EntityIdentifier {
+	ids := make([]EntityIdentifier, 0, len(e.Errors))
+	for _, itemErr := range e.Errors {
+		ids = append(ids, itemErr.Identifier)
+	}
+	return ids
+}
+
+// Add records a failed item
+func (e *BatchError) Add(identifier EntityIdentifier, err error) {
+	e.Errors = append(e.Errors, BatchItemError{Identifier: identifier, Err: err})
+}
+
+// ErrOrNil returns e if any item failed, nil otherwise
+func (e *BatchError) ErrOrNil() error {
+	if len(e.Errors) == 0 {
+		return nil
+	}
+	return e
+}
+
+// ExistsMany checks the given identifiers one by one with repo.Exists, for backends without a
+// bulk existence check. Identifiers whose check failed are left out of the result and reported in
+// a *BatchError.
+func ExistsMany(ctx context.Context, repo DataRepository, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	batchErr := &BatchError{}
+	result := make(map[EntityIdentifier]bool, len(identifiers))
+	for _, identifier := range identifiers {
+		exists, err := repo.Exists(ctx, identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		result[identifier] = exists
+	}
+	return result, batchErr.ErrOrNil()
+}
+
+// ReadManyOrdered reads the given identifiers via repo.ReadMany and decodes the values with codec into
+// dest, which must be a pointer to a slice. The slice is resized to len(identifiers) and
+// element i holds the value of identifiers[i]. Missing entities leave the zero value of the
+// element type in place, so use a slice of pointers to get nil placeholders.
+func ReadManyOrdered(ctx context.Context, repo DataRepository, codec Codec, identifiers []EntityIdentifier, dest interface{}) error {
+	destValue := reflect.ValueOf(dest)
+	if destValue.Kind() != reflect.Ptr || destValue.IsNil() || destValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: dest must be a non-nil pointer to a slice", ErrInvalidInput)
+	}
+	sliceValue := destValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	result := reflect.MakeSlice(sliceValue.Type(), len(identifiers), len(identifiers))
+
+	// The same identifier may be requested more than once
+	positions := make(map[string][]int, len(identifiers))
+	for i, identifier := range identifiers {
+		key := identifier.String()
+		positions[key] = append(positions[key], i)
+	}
+
+	err := repo.ReadMany(ctx, identifiers, func(identifier EntityIdentifier, raw []byte) error {
+		for _, i := range positions[identifier.String()] {
+			elem := reflect.New(elemType)
+			if err := codec.Unmarshal(raw, elem.Interface()); err != nil {
+				return fmt.Errorf("%w: failed to decode %v: %v", ErrOperationFailed, identifier, err)
+			}
+			result.Index(i).Set(elem.Elem())
+		}
+		return nil
+	})
+
+	var batchErr *BatchError
+	if errors.As(err, &batchErr) {
+		// Missing entities keep their placeholder; only report other failures
+		remaining := &BatchError{}
+		for _, itemErr := range batchErr.Errors {
+			if !IsNotFoundError(itemErr.Err) {
+				remaining.Errors = append(remaining.Errors, itemErr)
+			}
+		}
+		err = remaining.ErrOrNil()
+	}
+	if err != nil {
+		return err
+	}
+
+	sliceValue.Set(result)
+	return nil
+}
@@ -0,0 +1,489 @@
+// datarepository.caching.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultCacheTTL is the default time entities stay in the cache of a CachingRepository
+const DefaultCacheTTL = 1 * time.Minute
+
+// CachingConfig configures a CachingRepository
+type CachingConfig struct {
+	// TTL is how long a value read from the primary repository stays in the cache. Values of
+	// entities that expire sooner in the primary repository leave the cache when they expire.
+	// Defaults to DefaultCacheTTL.
+	TTL time.Duration
+}
+
+// CacheStats counts the reads of a CachingRepository served by the cache and by the primary repository
+type CacheStats struct {
+	Hits   int64
+	Misses int64
+}
+
+// cacheCounters holds the statistics shared by a CachingRepository and its transactions
+type cacheCounters struct {
+	hits   int64
+	misses int64
+}
+
+// cacheTouched collects the identifiers written within a transaction
+type cacheTouched struct {
+	mu          sync.Mutex
+	identifiers []EntityIdentifier
+	patterns    []EntityIdentifier // passed to DeletePattern
+}
+
+// CachingRepository fronts a primary repository with a cache, e.g. a MemoryRepository in front
+// of a RedisRepository. Read checks the cache first and, on a miss, reads from the primary
+// repository and stores the value in the cache for the configured TTL. Writes go to the primary
+// repository and then remove the entity from the cache, so the next Read fetches the new value.
+// All other operations are passed to the primary repository.
+//
+// The cache is best effort: if it fails, Read falls back to the primary repository and the
+// failure is not reported. Other processes writing to the primary repository, or a Read that
+// races with a write, may leave a stale value in the cache for up to the TTL.
+type CachingRepository struct {
+	primary DataRepository
+	cache   DataRepository
+	config  CachingConfig
+	stats   *cacheCounters
+	// touched collects the identifiers written within a transaction, set on the repository
+	// passed to a WithTransaction function
+	touched *cacheTouched
+}
+
+var _ DataRepository = (*CachingRepository)(nil)
+
+// NewCachingRepository wraps primary so that reads are served from cache where possible
+func NewCachingRepository(primary, cache DataRepository, config CachingConfig) *CachingRepository {
+	if config.TTL <= 0 {
+		config.TTL = DefaultCacheTTL
+	}
+	return &CachingRepository{primary: primary, cache: cache, config: config, stats: &cacheCounters{}}
+}
+
+// Unwrap returns the primary repository
+func (r *CachingRepository) Unwrap() DataRepository {
+	return r.primary
+}
+
+// Cache returns the repository used as cache
+func (r *CachingRepository) Cache() DataRepository {
+	return r.cache
+}
+
+// Stats returns the number of cache hits and misses of Read so far
+func (r *CachingRepository) Stats() CacheStats {
+	return CacheStats{
+		Hits:   atomic.LoadInt64(&r.stats.hits),
+		Misses: atomic.LoadInt64(&r.stats.misses),
+	}
+}
+
+// invalidate removes the entities from the cache. Within a transaction, they are only recorded
+// and removed once the transaction is over. Removal continues if ctx is canceled, as the
+// primary repository may already have been written.
+func (r *CachingRepository) invalidate(ctx context.Context, identifiers ...EntityIdentifier) {
+	if len(identifiers) == 0 {
+		return
+	}
+	if r.touched != nil {
+		r.touched.mu.Lock()
+		r.touched.identifiers = append(r.touched.identifiers, identifiers...)
+		r.touched.mu.Unlock()
+		return
+	}
+	// Entities that are not cached are reported as ErrNotFound, which is expected
+	_ = r.cache.DeleteMany(context.WithoutCancel(ctx), identifiers)
+}
+
+// invalidatePattern removes the entities matching pattern from the cache, or records the
+// pattern within a transaction like invalidate
+func (r *CachingRepository) invalidatePattern(ctx context.Context, pattern EntityIdentifier) {
+	if r.touched != nil {
+		r.touched.mu.Lock()
+		r.touched.patterns = append(r.touched.patterns, pattern)
+		r.touched.mu.Unlock()
+		return
+	}
+	_, _ = r.cache.DeletePattern(context.WithoutCancel(ctx), pattern)
+}
+
+// invalidateItems removes the entities of a batch from the cache
+func (r *CachingRepository) invalidateItems(ctx context.Context, items map[EntityIdentifier]interface{}) {
+	identifiers := make([]EntityIdentifier, 0, len(items))
+	for identifier := range items {
+		identifiers = append(identifiers, identifier)
+	}
+	r.invalidate(ctx, identifiers...)
+}
+
+func (r *CachingRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	err := r.primary.Create(ctx, identifier, value)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	identifier, err := r.primary.CreateWithGeneratedID(ctx, entityPrefix, value)
+	if err == nil {
+		r.invalidate(ctx, identifier)
+	}
+	return identifier, err
+}
+
+func (r *CachingRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	created, err := r.primary.CreateIfAbsent(ctx, identifier, value, ttl)
+	r.invalidate(ctx, identifier)
+	return created, err
+}
+
+func (r *CachingRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	err := r.primary.CreateWithTTL(ctx, identifier, value, ttl)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+// Read returns the cached value if there is one. Otherwise, it reads the entity from the
+// primary repository and caches it for the configured TTL, or until the entity expires.
+// Within a transaction, entities are always read from the primary repository.
+func (r *CachingRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if r.touched != nil {
+		return r.primary.Read(ctx, identifier, value)
+	}
+	if err := r.cache.Read(ctx, identifier, value); err == nil {
+		atomic.AddInt64(&r.stats.hits, 1)
+		return nil
+	}
+	atomic.AddInt64(&r.stats.misses, 1)
+
+	remaining, err := r.primary.ReadWithTTL(ctx, identifier, value)
+	if err != nil {
+		return err
+	}
+	ttl := r.config.TTL
+	if remaining != NoExpiration && remaining < ttl {
+		ttl = remaining
+	}
+	if ttl > 0 {
+		_ = r.cache.UpsertWithTTL(context.WithoutCancel(ctx), identifier, value, ttl)
+	}
+	return nil
+}
+
+func (r *CachingRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	return r.primary.ReadWithTTL(ctx, identifier, value)
+}
+
+func (r *CachingRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	return r.primary.Exists(ctx, identifier)
+}
+
+func (r *CachingRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	return r.primary.ExistsMany(ctx, identifiers)
+}
+
+func (r *CachingRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	err := r.primary.Upsert(ctx, identifier, value)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	err := r.primary.UpsertWithTTL(ctx, identifier, value, ttl)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	err := r.primary.UpsertManyWithTTL(ctx, items, ttl)
+	r.invalidateItems(ctx, items)
+	return err
+}
+
+func (r *CachingRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	err := r.primary.Update(ctx, identifier, value)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	err := r.primary.UpdateField(ctx, identifier, path, value)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	swapped, err := r.primary.CompareAndSwap(ctx, identifier, expected, newValue)
+	r.invalidate(ctx, identifier)
+	return swapped, err
+}
+
+func (r *CachingRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	version, err := r.primary.UpdateWithVersion(ctx, identifier, value, expectedVersion)
+	r.invalidate(ctx, identifier)
+	return version, err
+}
+
+func (r *CachingRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return r.primary.GetVersion(ctx, identifier)
+}
+
+func (r *CachingRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return r.primary.ReadField(ctx, identifier, path, value)
+}
+
+func (r *CachingRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	err := r.primary.Delete(ctx, identifier)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	err := r.primary.GetAndDelete(ctx, identifier, value)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	err := r.primary.GetAndSet(ctx, identifier, newValue, oldValue)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	err := r.primary.CreateMany(ctx, items)
+	r.invalidateItems(ctx, items)
+	return err
+}
+
+func (r *CachingRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return r.primary.ReadMany(ctx, identifiers, fn)
+}
+
+func (r *CachingRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return r.primary.ReadManyOrdered(ctx, identifiers, dest)
+}
+
+func (r *CachingRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	err := r.primary.DeleteMany(ctx, identifiers)
+	r.invalidate(ctx, identifiers...)
+	return err
+}
+
+func (r *CachingRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	deleted, err := r.primary.DeletePattern(ctx, pattern)
+	r.invalidatePattern(ctx, pattern)
+	return deleted, err
+}
+
+func (r *CachingRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	return r.primary.List(ctx, pattern)
+}
+
+func (r *CachingRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	return r.primary.ListDetailed(ctx, pattern)
+}
+
+func (r *CachingRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	return r.primary.ListPaged(ctx, pattern, cursor, pageSize)
+}
+
+func (r *CachingRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	return r.primary.ListPage(ctx, pattern, cursor, pageSize)
+}
+
+func (r *CachingRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	return r.primary.Count(ctx, pattern)
+}
+
+func (r *CachingRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return r.primary.Iterate(ctx, pattern, fn)
+}
+
+func (r *CachingRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	return r.primary.EntityPrefixes(ctx)
+}
+
+func (r *CachingRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *CachingRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	return r.primary.Search(ctx, query, offset, limit, sortBy, sortDir)
+}
+
+func (r *CachingRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	return r.primary.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+}
+
+func (r *CachingRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	return r.primary.SearchResults(ctx, query, opts)
+}
+
+func (r *CachingRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	return r.primary.SearchQuery(ctx, query, opts)
+}
+
+func (r *CachingRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	return r.primary.AcquireLock(ctx, identifier, ttl)
+}
+
+func (r *CachingRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	return r.primary.AcquireLockWithToken(ctx, identifier, ttl)
+}
+
+func (r *CachingRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	return r.primary.ReleaseLock(ctx, identifier)
+}
+
+func (r *CachingRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	return r.primary.ReleaseLockWithToken(ctx, identifier, token)
+}
+
+func (r *CachingRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	return r.primary.RenewLock(ctx, identifier, token, ttl)
+}
+
+func (r *CachingRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	return r.primary.Publish(ctx, channel, message)
+}
+
+func (r *CachingRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	return r.primary.Subscribe(ctx, channel)
+}
+
+func (r *CachingRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	return r.primary.SubscribeMessages(ctx, channel)
+}
+
+func (r *CachingRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	return r.primary.PSubscribe(ctx, pattern)
+}
+
+func (r *CachingRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	err := r.primary.SetExpiration(ctx, identifier, expiration)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	err := r.primary.SetExpirationMany(ctx, identifiers, expiration)
+	r.invalidate(ctx, identifiers...)
+	return err
+}
+
+func (r *CachingRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	applied, err := r.primary.SetExpirationCond(ctx, identifier, expiration, cond)
+	if applied {
+		r.invalidate(ctx, identifier)
+	}
+	return applied, err
+}
+
+func (r *CachingRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	return r.primary.GetExpiration(ctx, identifier)
+}
+
+func (r *CachingRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	err := r.primary.Persist(ctx, identifier)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	return r.primary.Touch(ctx, identifier)
+}
+
+func (r *CachingRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	value, err := r.primary.AtomicIncrement(ctx, identifier)
+	r.invalidate(ctx, identifier)
+	return value, err
+}
+
+func (r *CachingRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	value, err := r.primary.IncrementBy(ctx, identifier, delta)
+	r.invalidate(ctx, identifier)
+	return value, err
+}
+
+func (r *CachingRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	value, err := r.primary.DecrementBy(ctx, identifier, delta)
+	r.invalidate(ctx, identifier)
+	return value, err
+}
+
+func (r *CachingRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	value, allowed, err := r.primary.IncrementWithLimit(ctx, identifier, delta, max)
+	r.invalidate(ctx, identifier)
+	return value, allowed, err
+}
+
+func (r *CachingRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	value, err := r.primary.IncrementWithExpiry(ctx, identifier, delta, ttl)
+	r.invalidate(ctx, identifier)
+	return value, err
+}
+
+func (r *CachingRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	value, err := r.primary.IncrementFloat(ctx, identifier, delta)
+	r.invalidate(ctx, identifier)
+	return value, err
+}
+
+func (r *CachingRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return r.primary.GetCounter(ctx, identifier)
+}
+
+func (r *CachingRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	err := r.primary.SetCounter(ctx, identifier, value)
+	r.invalidate(ctx, identifier)
+	return err
+}
+
+func (r *CachingRepository) Ping(ctx context.Context) error {
+	return r.primary.Ping(ctx)
+}
+
+// Close closes both the primary repository and the cache
+func (r *CachingRepository) Close() error {
+	if r.touched != nil {
+		return r.primary.Close()
+	}
+	return errors.Join(r.primary.Close(), r.cache.Close())
+}
+
+// WithTransaction passes fn a transaction that reads from the primary repository's transaction,
+// bypassing the cache. The entities written within the transaction are removed from the cache
+// once the transaction is over, whether it was committed or not.
+func (r *CachingRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	touched := r.touched
+	if touched == nil {
+		touched = &cacheTouched{}
+	}
+	err := r.primary.WithTransaction(ctx, func(tx DataRepository) error {
+		return fn(&CachingRepository{primary: tx, cache: r.cache, config: r.config, stats: r.stats, touched: touched})
+	})
+	if r.touched == nil {
+		r.invalidate(ctx, touched.identifiers...)
+		for _, pattern := range touched.patterns {
+			r.invalidatePattern(ctx, pattern)
+		}
+	}
+	return err
+}
+
+func (r *CachingRepository) RegisterPlugin(plugin RepositoryPlugin) error {
+	return r.primary.RegisterPlugin(plugin)
+}
+
+func (r *CachingRepository) GetPlugin(name string) (RepositoryPlugin, bool) {
+	return r.primary.GetPlugin(name)
+}
@@ -0,0 +1,101 @@
+// datarepository.caching_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func newTestCachingRepository(t *testing.T, config CachingConfig) *CachingRepository {
+	t.Helper()
+	primary, _ := newTestRedisRepository(t, RedisConfig{})
+	return NewCachingRepository(primary, newTestMemoryRepository(t, MemoryConfig{}), config)
+}
+
+func TestCachingRepositoryHitsAndMisses(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestCachingRepository(t, CachingConfig{})
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, codecTestUser{Name: "ann", Age: 30}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var user codecTestUser
+	if err := repo.Read(ctx, id, &user); err != nil || user.Name != "ann" {
+		t.Fatalf("first Read: got %+v, %v", user, err)
+	}
+	if stats := repo.Stats(); stats != (CacheStats{Misses: 1}) {
+		t.Errorf("Stats after the first Read: got %+v, want 1 miss", stats)
+	}
+
+	// A change made behind the cache's back shows the second Read is served by the cache
+	if err := repo.Unwrap().Update(ctx, id, codecTestUser{Name: "bob", Age: 30}); err != nil {
+		t.Fatalf("Update of the primary repository: %v", err)
+	}
+	if err := repo.Read(ctx, id, &user); err != nil || user.Name != "ann" {
+		t.Errorf("second Read: got %+v, %v, want the cached value", user, err)
+	}
+	if stats := repo.Stats(); stats != (CacheStats{Hits: 1, Misses: 1}) {
+		t.Errorf("Stats after the second Read: got %+v, want 1 hit and 1 miss", stats)
+	}
+
+	// Entities missing from both repositories are misses and are not cached
+	if err := repo.Read(ctx, SimpleIdentifier("user:missing"), &user); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read of a missing entity: got %v, want ErrNotFound", err)
+	}
+	if exists, _ := repo.Cache().Exists(ctx, SimpleIdentifier("user:missing")); exists {
+		t.Error("the missing entity was cached")
+	}
+}
+
+func TestCachingRepositoryWritesInvalidate(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestCachingRepository(t, CachingConfig{})
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, codecTestUser{Name: "ann", Age: 30}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var user codecTestUser
+	if err := repo.Read(ctx, id, &user); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+
+	if err := repo.Update(ctx, id, codecTestUser{Name: "ann", Age: 31}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if exists, _ := repo.Cache().Exists(ctx, id); exists {
+		t.Error("Update left the entity in the cache")
+	}
+	if err := repo.Read(ctx, id, &user); err != nil || user.Age != 31 {
+		t.Errorf("Read after Update: got %+v, %v, want age 31", user, err)
+	}
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Read(ctx, id, &user); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read after Delete: got %v, want ErrNotFound", err)
+	}
+	if stats := repo.Stats(); stats.Hits != 0 || stats.Misses != 3 {
+		t.Errorf("Stats: got %+v, want 3 misses and no hits", stats)
+	}
+}
+
+func TestCachingRepositoryKeepsPrimaryExpiration(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestCachingRepository(t, CachingConfig{TTL: time.Hour})
+	id := SimpleIdentifier("session:1")
+	if err := repo.CreateWithTTL(ctx, id, codecTestUser{Name: "ann"}, time.Minute); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	var user codecTestUser
+	if err := repo.Read(ctx, id, &user); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if remaining, err := repo.Cache().GetExpiration(ctx, id); err != nil || remaining > time.Minute {
+		t.Errorf("GetExpiration of the cached entity: got %v, %v, want at most 1m", remaining, err)
+	}
+}
@@ -0,0 +1,72 @@
+// datarepository.close.go
+
+package datarepository
+
+import (
+	"fmt"
+	"sync"
+)
+
+// errRepositoryClosed is returned by the operations of a repository after Close was called
+var errRepositoryClosed = fmt.Errorf("%w: repository closed", ErrOperationFailed)
+
+// closeGuard counts the operations and goroutines in flight so that Close can wait for them to
+// finish, and rejects operations started after Close
+type closeGuard struct {
+	mu      sync.Mutex
+	closed  bool
+	active  sync.WaitGroup
+	closing chan struct{} // closed when Close is called, to stop the goroutines
+}
+
+func newCloseGuard() *closeGuard {
+	return &closeGuard{closing: make(chan struct{})}
+}
+
+// enter registers an operation, which must call leave once it is done.
+// Returns errRepositoryClosed if Close was called.
+func (g *closeGuard) enter() error {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	if g.closed {
+		return errRepositoryClosed
+	}
+	// Added under the lock so that close never waits while the counter may still grow
+	g.active.Add(1)
+	return nil
+}
+
+func (g *closeGuard) leave() {
+	g.active.Done()
+}
+
+// goTracked runs fn in a goroutine that close waits for. fn must return once done is closed.
+// Must be called by an operation between enter and leave, so that close is still waiting.
+func (g *closeGuard) goTracked(fn func()) {
+	g.active.Add(1)
+	go func() {
+		defer g.leave()
+		fn()
+	}()
+}
+
+// done returns a channel that is closed when Close is called
+func (g *closeGuard) done() <-chan struct{} {
+	return g.closing
+}
+
+// close rejects new operations, stops the tracked goroutines and waits for the operations and
+// goroutines in flight. Returns false if the repository was already closed.
+func (g *closeGuard) close() bool {
+	g.mu.Lock()
+	if g.closed {
+		g.mu.Unlock()
+		return false
+	}
+	g.closed = true
+	close(g.closing)
+	g.mu.Unlock()
+
+	g.active.Wait()
+	return true
+}
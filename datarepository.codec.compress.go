@@ -0,0 +1,170 @@
+// datarepository.codec.compress.go
+
+package datarepository
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+
+	"github.com/klauspost/compress/zstd"
+)
+
+// DefaultCompressionThreshold is the default size in bytes from which CompressingCodec compresses values
+const DefaultCompressionThreshold = 1024
+
+// Compression is a compression algorithm of CompressingCodec. Its value is the marker byte
+// written in front of each stored value.
+type Compression byte
+
+const (
+	// CompressionNone marks values stored uncompressed because they are below the threshold
+	CompressionNone Compression = 0
+	// CompressionGzip compresses values with gzip
+	CompressionGzip Compression = 1
+	// CompressionZstd compresses values with Zstandard, which is faster and usually smaller than gzip
+	CompressionZstd Compression = 2
+)
+
+// String returns the name of the algorithm
+func (c Compression) String() string {
+	switch c {
+	case CompressionNone:
+		return "none"
+	case CompressionGzip:
+		return "gzip"
+	case CompressionZstd:
+		return "zstd"
+	}
+	return fmt.Sprintf("Compression(%d)", byte(c))
+}
+
+// CompressionConfig configures a CompressingCodec
+type CompressionConfig struct {
+	// Algorithm compresses values of at least Threshold bytes. Defaults to CompressionZstd.
+	Algorithm Compression
+	// Threshold is the size of the inner codec's output from which values are compressed.
+	// Smaller values are stored uncompressed. 0 defaults to DefaultCompressionThreshold;
+	// a negative threshold compresses all values.
+	Threshold int
+}
+
+// CompressingCodec compresses the output of another codec if it reaches a size threshold.
+// Each value is stored as a JSON string holding the base64 encoding of a marker byte, which
+// names the compression algorithm or CompressionNone, followed by the data, which keeps it
+// valid for the RedisJSON and MongoDB backends. Unmarshal reads values of every algorithm, so
+// the algorithm and threshold can be changed while old values remain readable.
+// As stored values are opaque, searching by field does not work on them.
+//
+// To combine compression with encryption, compress first, i.e. use the CompressingCodec as
+// the inner codec of an EncryptingCodec; encrypted data does not compress.
+type CompressingCodec struct {
+	inner     Codec
+	algorithm Compression
+	threshold int
+	encoder   *zstd.Encoder
+	decoder   *zstd.Decoder
+}
+
+var _ Codec = (*CompressingCodec)(nil)
+
+// NewCompressingCodec returns a codec that compresses large outputs of inner.
+// inner defaults to JSONCodec.
+// Returns ErrInvalidInput if the algorithm is unknown.
+func NewCompressingCodec(inner Codec, cfg CompressionConfig) (*CompressingCodec, error) {
+	if inner == nil {
+		inner = JSONCodec{}
+	}
+	if cfg.Algorithm == CompressionNone {
+		cfg.Algorithm = CompressionZstd
+	}
+	if cfg.Algorithm != CompressionGzip && cfg.Algorithm != CompressionZstd {
+		return nil, fmt.Errorf("%w: unknown compression algorithm %v", ErrInvalidInput, cfg.Algorithm)
+	}
+	if cfg.Threshold == 0 {
+		cfg.Threshold = DefaultCompressionThreshold
+	}
+	encoder, err := zstd.NewWriter(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	decoder, err := zstd.NewReader(nil)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return &CompressingCodec{
+		inner:     inner,
+		algorithm: cfg.Algorithm,
+		threshold: cfg.Threshold,
+		encoder:   encoder,
+		decoder:   decoder,
+	}, nil
+}
+
+// Marshal encodes v with the inner codec and compresses the result if it reaches the threshold
+func (c *CompressingCodec) Marshal(v interface{}) ([]byte, error) {
+	data, err := c.inner.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	marked := []byte{byte(CompressionNone)}
+	if len(data) >= c.threshold {
+		marked[0] = byte(c.algorithm)
+		switch c.algorithm {
+		case CompressionGzip:
+			var buf bytes.Buffer
+			buf.WriteByte(marked[0])
+			w := gzip.NewWriter(&buf)
+			if _, err := w.Write(data); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			if err := w.Close(); err != nil {
+				return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			marked = buf.Bytes()
+		case CompressionZstd:
+			marked = c.encoder.EncodeAll(data, marked)
+		}
+	} else {
+		marked = append(marked, data...)
+	}
+	return json.Marshal(base64.StdEncoding.EncodeToString(marked))
+}
+
+// Unmarshal decompresses data according to its marker and decodes the result into v with the
+// inner codec
+func (c *CompressingCodec) Unmarshal(data []byte, v interface{}) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("%w: value is not a compressed value", ErrOperationFailed)
+	}
+	marked, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if len(marked) == 0 {
+		return fmt.Errorf("%w: value has no compression marker", ErrOperationFailed)
+	}
+	payload := marked[1:]
+	switch Compression(marked[0]) {
+	case CompressionNone:
+	case CompressionGzip:
+		r, err := gzip.NewReader(bytes.NewReader(payload))
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+		if payload, err = io.ReadAll(r); err != nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+	case CompressionZstd:
+		if payload, err = c.decoder.DecodeAll(payload, nil); err != nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+	default:
+		return fmt.Errorf("%w: unknown compression marker %d", ErrOperationFailed, marked[0])
+	}
+	return c.inner.Unmarshal(payload, v)
+}
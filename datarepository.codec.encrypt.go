@@ -0,0 +1,136 @@
+// datarepository.codec.encrypt.go
+
+package datarepository
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+)
+
+// encryptionFormatV1 is the version byte of the header written by EncryptingCodec
+const encryptionFormatV1 byte = 1
+
+// encryptionHeaderSize is the size of the header: the format version and the key ID
+const encryptionHeaderSize = 1 + 4
+
+// EncryptionKey is an AES key used by EncryptingCodec
+type EncryptionKey struct {
+	// ID identifies the key in the header of encrypted values, so they can be decrypted after
+	// a key rotation. IDs must be unique among the keys of a codec.
+	ID uint32
+	// Key is the AES key, 16, 24 or 32 bytes long for AES-128, AES-192 or AES-256
+	Key []byte
+}
+
+// EncryptingCodec encrypts the output of another codec with AES-GCM, so values are encrypted
+// at rest. Each value is stored as a JSON string holding the base64 encoding of a header (the
+// format version and the key ID), a random nonce and the ciphertext, which keeps it valid for
+// the RedisJSON and MongoDB backends. The header is authenticated along with the ciphertext.
+//
+// Values are encrypted with the first key; the other keys are only used to decrypt values
+// written before a key rotation. Values that cannot be decrypted fail with ErrDecryption.
+// As stored values are opaque, searching by field does not work on encrypted values.
+type EncryptingCodec struct {
+	inner   Codec
+	current EncryptionKey
+	ciphers map[uint32]cipher.AEAD
+}
+
+var _ Codec = (*EncryptingCodec)(nil)
+
+// NewEncryptingCodec returns a codec that encrypts the output of inner with the first key and
+// decrypts values written with any of the keys. inner defaults to JSONCodec.
+// Returns ErrInvalidInput if no key is given, a key has an invalid length or IDs are not unique.
+func NewEncryptingCodec(inner Codec, keys ...EncryptionKey) (*EncryptingCodec, error) {
+	if len(keys) == 0 {
+		return nil, fmt.Errorf("%w: at least one encryption key is required", ErrInvalidInput)
+	}
+	if inner == nil {
+		inner = JSONCodec{}
+	}
+	c := &EncryptingCodec{
+		inner:   inner,
+		current: keys[0],
+		ciphers: make(map[uint32]cipher.AEAD, len(keys)),
+	}
+	for _, key := range keys {
+		if _, exists := c.ciphers[key.ID]; exists {
+			return nil, fmt.Errorf("%w: duplicate encryption key ID %d", ErrInvalidInput, key.ID)
+		}
+		block, err := aes.NewCipher(key.Key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: encryption key %d: %v", ErrInvalidInput, key.ID, err)
+		}
+		aead, err := cipher.NewGCM(block)
+		if err != nil {
+			return nil, fmt.Errorf("%w: encryption key %d: %v", ErrInvalidInput, key.ID, err)
+		}
+		c.ciphers[key.ID] = aead
+	}
+	return c, nil
+}
+
+// KeyID returns the ID of the key new values are encrypted with
+func (c *EncryptingCodec) KeyID() uint32 {
+	return c.current.ID
+}
+
+// Marshal encodes v with the inner codec and encrypts the result with the current key
+func (c *EncryptingCodec) Marshal(v interface{}) ([]byte, error) {
+	plaintext, err := c.inner.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	aead := c.ciphers[c.current.ID]
+
+	header := make([]byte, encryptionHeaderSize, encryptionHeaderSize+aead.NonceSize()+len(plaintext)+aead.Overhead())
+	header[0] = encryptionFormatV1
+	binary.BigEndian.PutUint32(header[1:], c.current.ID)
+	nonce := header[encryptionHeaderSize : encryptionHeaderSize+aead.NonceSize()]
+	if _, err := rand.Read(nonce); err != nil {
+		return nil, fmt.Errorf("%w: generating nonce: %v", ErrOperationFailed, err)
+	}
+	sealed := aead.Seal(header[:encryptionHeaderSize+aead.NonceSize()], nonce, plaintext, header[:encryptionHeaderSize])
+	return json.Marshal(base64.StdEncoding.EncodeToString(sealed))
+}
+
+// Unmarshal decrypts data with the key named in its header and decodes the result into v
+// with the inner codec.
+// Returns ErrDecryption if data is not an encrypted value, its key is unknown or it fails
+// authentication, e.g. because it was encrypted with a different key under the same ID.
+func (c *EncryptingCodec) Unmarshal(data []byte, v interface{}) error {
+	var encoded string
+	if err := json.Unmarshal(data, &encoded); err != nil {
+		return fmt.Errorf("%w: value is not an encrypted value", ErrDecryption)
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+	if len(sealed) < encryptionHeaderSize {
+		return fmt.Errorf("%w: value is too short", ErrDecryption)
+	}
+	if sealed[0] != encryptionFormatV1 {
+		return fmt.Errorf("%w: unknown format version %d", ErrDecryption, sealed[0])
+	}
+	keyID := binary.BigEndian.Uint32(sealed[1:encryptionHeaderSize])
+	aead, ok := c.ciphers[keyID]
+	if !ok {
+		return fmt.Errorf("%w: unknown encryption key %d", ErrDecryption, keyID)
+	}
+	if len(sealed) < encryptionHeaderSize+aead.NonceSize()+aead.Overhead() {
+		return fmt.Errorf("%w: value is too short", ErrDecryption)
+	}
+	nonce := sealed[encryptionHeaderSize : encryptionHeaderSize+aead.NonceSize()]
+	ciphertext := sealed[encryptionHeaderSize+aead.NonceSize():]
+	plaintext, err := aead.Open(nil, nonce, ciphertext, sealed[:encryptionHeaderSize])
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrDecryption, err)
+	}
+	return c.inner.Unmarshal(plaintext, v)
+}
@@ -0,0 +1,91 @@
+// datarepository.codec.go
+
+package datarepository
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+)
+
+// Codec serializes entity values for storage.
+// Codecs used with the RedisJSON storage of RedisRepository must produce valid JSON.
+type Codec interface {
+	// Marshal encodes v
+	Marshal(v interface{}) ([]byte, error)
+	// Unmarshal decodes data into v, which must be a pointer
+	Unmarshal(data []byte, v interface{}) error
+}
+
+// JSONCodec is the default Codec, based on encoding/json.
+// []byte fields are stored as base64 strings within the JSON document and decoded back
+// into []byte when read into a typed value, so entities can carry small binary payloads
+// while remaining valid RedisJSON documents. When read into an interface{} (e.g. the
+// values returned by List), such fields remain base64 strings.
+type JSONCodec struct{}
+
+var _ Codec = JSONCodec{}
+
+// Marshal encodes v as JSON
+func (c JSONCodec) Marshal(v interface{}) ([]byte, error) {
+	return json.Marshal(v)
+}
+
+// Unmarshal decodes JSON data into v
+func (c JSONCodec) Unmarshal(data []byte, v interface{}) error {
+	return json.Unmarshal(data, v)
+}
+
+// Null is an explicit null entity value. Writes of whole entity values reject nil with
+// ErrInvalidInput; write Null instead to store null deliberately. Reading it back leaves a typed
+// target unchanged and sets an *interface{} to nil.
+var Null = json.RawMessage("null")
+
+// errNilValue is returned by writes of a nil entity value
+var errNilValue = fmt.Errorf("%w: value must not be nil, use Null to store null", ErrInvalidInput)
+
+// CheckValue returns errNilValue if value is nil or a nil pointer, map, slice or interface,
+// which codecs would store as null
+func CheckValue(value interface{}) error {
+	if value == nil {
+		return errNilValue
+	}
+	switch v := reflect.ValueOf(value); v.Kind() {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if v.IsNil() {
+			return errNilValue
+		}
+	}
+	return nil
+}
+
+// EqualEncoded reports whether stored, serialized with codec, holds the same value as expected.
+// Both are compared in their generic form (maps, slices and scalars), so e.g. a struct equals a
+// stored map with the same fields.
+func EqualEncoded(codec Codec, stored []byte, expected interface{}) (bool, error) {
+	encoded, err := codec.Marshal(expected)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	var want, got interface{}
+	if err := codec.Unmarshal(encoded, &want); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := codec.Unmarshal(stored, &got); err != nil {
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return reflect.DeepEqual(got, want), nil
+}
+
+// EncodePayload converts a pub/sub message to bytes. Strings and byte slices are used as is,
+// other values are serialized with codec.
+func EncodePayload(codec Codec, message interface{}) ([]byte, error) {
+	switch m := message.(type) {
+	case []byte:
+		return m, nil
+	case string:
+		return []byte(m), nil
+	default:
+		return codec.Marshal(message)
+	}
+}
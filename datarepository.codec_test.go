@@ -0,0 +1,285 @@
+// datarepository.codec_test.go
+
+package datarepository
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"sync/atomic"
+	"testing"
+)
+
+// markedCodec is a JSONCodec that prefixes its output with a marker and counts its calls, so
+// tests can tell its output apart from that of JSONCodec
+type markedCodec struct {
+	marshals   atomic.Int64
+	unmarshals atomic.Int64
+}
+
+var codecMarker = []byte("marked|")
+
+func (c *markedCodec) Marshal(v interface{}) ([]byte, error) {
+	c.marshals.Add(1)
+	data, err := JSONCodec{}.Marshal(v)
+	if err != nil {
+		return nil, err
+	}
+	return append(append([]byte{}, codecMarker...), data...), nil
+}
+
+func (c *markedCodec) Unmarshal(data []byte, v interface{}) error {
+	c.unmarshals.Add(1)
+	if !bytes.HasPrefix(data, codecMarker) {
+		return fmt.Errorf("missing marker in %q", data)
+	}
+	return JSONCodec{}.Unmarshal(data[len(codecMarker):], v)
+}
+
+type codecTestUser struct {
+	Name string `json:"name"`
+	Age  int    `json:"age"`
+}
+
+func TestCustomCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	codec := &markedCodec{}
+	memory := newTestMemoryRepository(t, MemoryConfig{Codec: codec})
+	redisRepo, server := newTestRedisRepository(t, RedisConfig{Codec: codec})
+
+	for name, repo := range map[string]DataRepository{"memory": memory, "redis": redisRepo} {
+		t.Run(name, func(t *testing.T) {
+			before := codec.marshals.Load()
+			id := SimpleIdentifier("user:1")
+			if err := repo.Create(ctx, id, codecTestUser{Name: "ann", Age: 30}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			var user codecTestUser
+			if err := repo.Read(ctx, id, &user); err != nil || user != (codecTestUser{Name: "ann", Age: 30}) {
+				t.Fatalf("Read after Create: got %+v, %v", user, err)
+			}
+			if err := repo.Update(ctx, id, codecTestUser{Name: "ann", Age: 31}); err != nil {
+				t.Fatalf("Update: %v", err)
+			}
+			if err := repo.Read(ctx, id, &user); err != nil || user.Age != 31 {
+				t.Fatalf("Read after Update: got %+v, %v", user, err)
+			}
+			if err := repo.Upsert(ctx, SimpleIdentifier("user:2"), codecTestUser{Name: "bob", Age: 40}); err != nil {
+				t.Fatalf("Upsert: %v", err)
+			}
+
+			ids, values, err := repo.List(ctx, testListPattern(repo, "user:*"))
+			if err != nil || len(values) != 2 {
+				t.Fatalf("List: got %v, %v, want 2 values", ids, err)
+			}
+			for i, value := range values {
+				m, ok := value.(map[string]interface{})
+				if !ok || m["name"] == nil {
+					t.Errorf("List value of %s: got %#v, want a decoded document", ids[i], value)
+				}
+			}
+			if codec.marshals.Load() == before {
+				t.Error("the custom codec was not used")
+			}
+		})
+	}
+
+	raw, err := server.Get("app:user:1")
+	if err != nil {
+		t.Fatalf("miniredis Get: %v", err)
+	}
+	if !bytes.HasPrefix([]byte(raw), codecMarker) {
+		t.Errorf("stored Redis value: got %q, want the output of the custom codec", raw)
+	}
+}
+
+func TestBinaryFieldRoundTrip(t *testing.T) {
+	type document struct {
+		Name      string `json:"name"`
+		Thumbnail []byte `json:"thumbnail"`
+	}
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		binary := []byte{0x00, 0xff, 0x10, '"', '\\', 0x7f}
+		if err := repo.Create(ctx, SimpleIdentifier("doc:1"), document{Name: "a", Thumbnail: binary}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		var got document
+		if err := repo.Read(ctx, SimpleIdentifier("doc:1"), &got); err != nil || !bytes.Equal(got.Thumbnail, binary) {
+			t.Fatalf("Read: got %v, %v, want %v", got.Thumbnail, err, binary)
+		}
+
+		// Generic values carry the field as base64
+		_, values, err := repo.List(ctx, testListPattern(repo, "doc:*"))
+		if err != nil || len(values) != 1 {
+			t.Fatalf("List: got %v, %v", values, err)
+		}
+		if encoded := values[0].(map[string]interface{})["thumbnail"]; encoded != "AP8QIlx/" {
+			t.Errorf("List: got thumbnail %v, want base64 %q", encoded, "AP8QIlx/")
+		}
+	})
+}
+
+func testEncryptionKey(id uint32, fill byte) EncryptionKey {
+	return EncryptionKey{ID: id, Key: bytes.Repeat([]byte{fill}, 32)}
+}
+
+func TestEncryptingCodecRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	codec, err := NewEncryptingCodec(nil, testEncryptionKey(1, 0xaa))
+	if err != nil {
+		t.Fatalf("NewEncryptingCodec: %v", err)
+	}
+	repo, server := newTestRedisRepository(t, RedisConfig{Codec: codec})
+
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, codecTestUser{Name: "ann", Age: 30}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var user codecTestUser
+	if err := repo.Read(ctx, id, &user); err != nil || user != (codecTestUser{Name: "ann", Age: 30}) {
+		t.Fatalf("Read: got %+v, %v", user, err)
+	}
+	raw, err := server.Get("app:user:1")
+	if err != nil {
+		t.Fatalf("miniredis Get: %v", err)
+	}
+	if bytes.Contains([]byte(raw), []byte("ann")) {
+		t.Errorf("stored Redis value %q contains the plaintext", raw)
+	}
+
+	// After a rotation, old values remain readable and new ones use the new key
+	rotated, err := NewEncryptingCodec(nil, testEncryptionKey(2, 0xbb), testEncryptionKey(1, 0xaa))
+	if err != nil {
+		t.Fatalf("NewEncryptingCodec: %v", err)
+	}
+	if err := rotated.Unmarshal([]byte(raw), &user); err != nil || user.Name != "ann" {
+		t.Errorf("Unmarshal with the rotated codec: got %+v, %v", user, err)
+	}
+	data, err := rotated.Marshal(user)
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	if err := codec.Unmarshal(data, &user); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Unmarshal of a value with an unknown key ID: got %v, want ErrDecryption", err)
+	}
+}
+
+func TestEncryptingCodecWrongKey(t *testing.T) {
+	ctx := context.Background()
+	repo, server := newTestRedisRepository(t, RedisConfig{})
+	codec, _ := NewEncryptingCodec(nil, testEncryptionKey(1, 0xaa))
+	wrong, _ := NewEncryptingCodec(nil, testEncryptionKey(1, 0xcc))
+
+	data, err := codec.Marshal(codecTestUser{Name: "ann", Age: 30})
+	if err != nil {
+		t.Fatalf("Marshal: %v", err)
+	}
+	var user codecTestUser
+	if err := wrong.Unmarshal(data, &user); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Unmarshal with a different key under the same ID: got %v, want ErrDecryption", err)
+	}
+
+	// A plaintext value written without the codec is not mistaken for an encrypted one
+	if err := repo.Create(ctx, SimpleIdentifier("user:1"), codecTestUser{Name: "bob"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	encrypted := newTestRedisRepositoryOn(t, server, RedisConfig{Codec: codec})
+	if err := encrypted.Read(ctx, SimpleIdentifier("user:1"), &user); !errors.Is(err, ErrDecryption) {
+		t.Errorf("Read of a plaintext value: got %v, want ErrDecryption", err)
+	}
+
+	if _, err := NewEncryptingCodec(nil, EncryptionKey{ID: 1, Key: []byte("short")}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("NewEncryptingCodec with an invalid key: got %v, want ErrInvalidInput", err)
+	}
+}
+
+// storedCompression returns the compression marker of a value stored by CompressingCodec
+func storedCompression(t *testing.T, raw string) Compression {
+	t.Helper()
+	var encoded string
+	if err := json.Unmarshal([]byte(raw), &encoded); err != nil {
+		t.Fatalf("stored value %q is not a JSON string: %v", raw, err)
+	}
+	marked, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(marked) == 0 {
+		t.Fatalf("stored value %q is not a compressed value: %v", raw, err)
+	}
+	return Compression(marked[0])
+}
+
+func TestCompressingCodecThreshold(t *testing.T) {
+	ctx := context.Background()
+	large := codecTestUser{Name: strings.Repeat("abcdefgh", 512), Age: 30}
+	small := codecTestUser{Name: "ann", Age: 30}
+
+	for _, algorithm := range []Compression{CompressionGzip, CompressionZstd} {
+		t.Run(algorithm.String(), func(t *testing.T) {
+			codec, err := NewCompressingCodec(nil, CompressionConfig{Algorithm: algorithm})
+			if err != nil {
+				t.Fatalf("NewCompressingCodec: %v", err)
+			}
+			repo, server := newTestRedisRepository(t, RedisConfig{Codec: codec})
+			if err := repo.Create(ctx, SimpleIdentifier("user:large"), large); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err := repo.Create(ctx, SimpleIdentifier("user:small"), small); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+
+			raw, _ := server.Get("app:user:large")
+			if got := storedCompression(t, raw); got != algorithm {
+				t.Errorf("large value: got marker %v, want %v", got, algorithm)
+			}
+			if len(raw) >= len(large.Name) {
+				t.Errorf("large value: stored %d bytes, want less than %d", len(raw), len(large.Name))
+			}
+			raw, _ = server.Get("app:user:small")
+			if got := storedCompression(t, raw); got != CompressionNone {
+				t.Errorf("small value: got marker %v, want %v", got, CompressionNone)
+			}
+
+			var user codecTestUser
+			if err := repo.Read(ctx, SimpleIdentifier("user:large"), &user); err != nil || user != large {
+				t.Errorf("Read of the large value: got %d-byte name, %v", len(user.Name), err)
+			}
+			if err := repo.Read(ctx, SimpleIdentifier("user:small"), &user); err != nil || user != small {
+				t.Errorf("Read of the small value: got %+v, %v", user, err)
+			}
+		})
+	}
+}
+
+func TestCompressingCodecComposesWithEncryption(t *testing.T) {
+	ctx := context.Background()
+	compressing, err := NewCompressingCodec(&markedCodec{}, CompressionConfig{Threshold: -1})
+	if err != nil {
+		t.Fatalf("NewCompressingCodec: %v", err)
+	}
+	codec, err := NewEncryptingCodec(compressing, testEncryptionKey(1, 0xaa))
+	if err != nil {
+		t.Fatalf("NewEncryptingCodec: %v", err)
+	}
+	repo := newTestMemoryRepository(t, MemoryConfig{Codec: codec})
+	want := codecTestUser{Name: strings.Repeat("ann", 100), Age: 30}
+	if err := repo.Create(ctx, SimpleIdentifier("user:1"), want); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var user codecTestUser
+	if err := repo.Read(ctx, SimpleIdentifier("user:1"), &user); err != nil || user != want {
+		t.Errorf("Read: got %+v, %v", user, err)
+	}
+
+	// Values not written by a CompressingCodec have no marker and are rejected
+	data, _ := JSONCodec{}.Marshal(want)
+	if err := compressing.Unmarshal(data, &user); err == nil {
+		t.Error("Unmarshal of an unmarked value: got no error")
+	}
+	if _, err := NewCompressingCodec(nil, CompressionConfig{Algorithm: Compression(9)}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("NewCompressingCodec with an unknown algorithm: got %v, want ErrInvalidInput", err)
+	}
+}
@@ -0,0 +1,36 @@
+// datarepository.conformance_test.go
+
+package datarepository_test
+
+import (
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/itsatony/go-datarepository/datarepositorytest"
+)
+
+func TestConformance(t *testing.T) {
+	t.Run("memory", func(t *testing.T) {
+		repo, err := datarepository.NewMemoryRepository(datarepository.MemoryConfig{})
+		if err != nil {
+			t.Fatalf("NewMemoryRepository: %v", err)
+		}
+		defer repo.Close()
+		datarepositorytest.Conformance(t, repo)
+	})
+	t.Run("redis", func(t *testing.T) {
+		server := miniredis.RunT(t)
+		repo, err := datarepository.NewRedisRepository(datarepository.RedisConfig{
+			Addrs:        []string{server.Addr()},
+			KeyPrefix:    "app",
+			KeySeparator: ":",
+			StorageMode:  datarepository.RedisStorageString,
+		})
+		if err != nil {
+			t.Fatalf("NewRedisRepository: %v", err)
+		}
+		defer repo.Close()
+		datarepositorytest.Conformance(t, repo)
+	})
+}
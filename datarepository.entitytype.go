@@ -0,0 +1,52 @@
+// datarepository.entitytype.go
+
+package datarepository
+
+import "fmt"
+
+// EntityType creates the identifiers of one entity prefix, so the prefix is spelled and validated
+// in one place instead of in every RedisIdentifier literal:
+//
+//	var users = datarepository.MustEntityType("user")
+//	err := repo.Read(ctx, users.ID(userID), &user)
+//
+// The identifiers are RedisIdentifiers, which every backend accepts as entityPrefix:id.
+type EntityType struct {
+	prefix string
+}
+
+// NewEntityType returns the EntityType of prefix.
+// Returns ErrInvalidEntityPrefix if prefix isn't a valid entity prefix.
+func NewEntityType(prefix string) (EntityType, error) {
+	if !entityPrefixRegex.MatchString(prefix) {
+		return EntityType{}, fmt.Errorf("%w: %q", ErrInvalidEntityPrefix, prefix)
+	}
+	return EntityType{prefix: prefix}, nil
+}
+
+// MustEntityType is like NewEntityType but panics if prefix is invalid. It simplifies
+// initializing package-level variables.
+func MustEntityType(prefix string) EntityType {
+	t, err := NewEntityType(prefix)
+	if err != nil {
+		panic(err)
+	}
+	return t
+}
+
+// Prefix returns the entity prefix
+func (t EntityType) Prefix() string {
+	return t.prefix
+}
+
+// ID returns the identifier of the entity with the given id
+func (t EntityType) ID(id string) EntityIdentifier {
+	return RedisIdentifier{EntityPrefix: t.prefix, ID: id}
+}
+
+// Pattern returns the identifier pattern matching the entities of this type whose id matches
+// the glob, e.g. "*" for all of them, for Count, Iterate or SubscribeKeyspaceEvents.
+// Pattern(glob).String() is the pattern to pass to List.
+func (t EntityType) Pattern(glob string) EntityIdentifier {
+	return RedisIdentifier{EntityPrefix: t.prefix, ID: glob}
+}
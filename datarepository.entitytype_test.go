@@ -0,0 +1,52 @@
+// datarepository.entitytype_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestEntityType(t *testing.T) {
+	users, err := NewEntityType("user")
+	if err != nil {
+		t.Fatalf("NewEntityType: %v", err)
+	}
+	for _, prefix := range []string{"", "1user", "user:admin", "us er"} {
+		if _, err := NewEntityType(prefix); !errors.Is(err, ErrInvalidEntityPrefix) {
+			t.Errorf("NewEntityType(%q): got %v, want ErrInvalidEntityPrefix", prefix, err)
+		}
+	}
+
+	redisRepo, _ := newTestRedisRepository(t, RedisConfig{})
+	key, err := redisRepo.identifierToKey(users.ID("42"), false)
+	if err != nil || key != "app:user:42" {
+		t.Fatalf("identifierToKey: got %q, %v, want app:user:42", key, err)
+	}
+	if identifier, err := redisRepo.keyToIdentifier(key); err != nil || identifier != users.ID("42") {
+		t.Errorf("keyToIdentifier(%q): got %#v, %v, want %#v", key, identifier, err, users.ID("42"))
+	}
+	if pattern, err := redisRepo.identifierToKey(users.Pattern("*"), true); err != nil || pattern != "app:user:*" {
+		t.Errorf("identifierToKey of a pattern: got %q, %v, want app:user:*", pattern, err)
+	}
+
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		for _, id := range []string{"1", "2"} {
+			if err := repo.Create(ctx, users.ID(id), map[string]string{"id": id}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		var value map[string]string
+		if err := repo.Read(ctx, SimpleIdentifier("user:1"), &value); err != nil || value["id"] != "1" {
+			t.Errorf("Read by the equivalent SimpleIdentifier: got %v, %v", value, err)
+		}
+		if n, err := repo.Count(ctx, users.Pattern("*")); err != nil || n != 2 {
+			t.Errorf("Count: got %d, %v, want 2", n, err)
+		}
+		if ids, _, err := repo.List(ctx, testListPattern(repo, users.Pattern("*").String())); err != nil || len(ids) != 2 {
+			t.Errorf("List: got %v, %v, want 2 entities", ids, err)
+		}
+	})
+}
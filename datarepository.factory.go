@@ -19,14 +19,21 @@ func RegisterDataRepository(name string, factory NewDataRepository) {
 	repositoryFactories[name] = factory
 }
 
-// CreateDataRepository creates a new repository instance based on the provided name and config
+// CreateDataRepository creates a new repository instance based on the provided name and config.
+// Configs implementing ConfigValidator are validated first.
+// Returns ErrInvalidInput if the name is unknown or the config is invalid.
 func CreateDataRepository(name string, config Config) (DataRepository, error) {
 	factoryMutex.RLock()
 	factory, ok := repositoryFactories[name]
 	factoryMutex.RUnlock()
 
 	if !ok {
-		return nil, fmt.Errorf("unknown repository type: %s", name)
+		return nil, fmt.Errorf("%w: unknown repository type: %s", ErrInvalidInput, name)
+	}
+	if validator, ok := config.(ConfigValidator); ok {
+		if err := validator.Validate(); err != nil {
+			return nil, err
+		}
 	}
 
 	repo, err := factory(config)
@@ -0,0 +1,119 @@
+// datarepository.fieldindex.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+)
+
+// FieldExtractor returns the value a document is indexed under, or "" to leave it out of the
+// index. It receives the document in its generic representation (maps, slices and scalars as
+// produced by decoding with the codec into interface{}), e.g. map[string]interface{} for a
+// struct, and must not modify it.
+type FieldExtractor func(value interface{}) string
+
+// FieldIndexer is implemented by repositories that maintain secondary indexes, which look up
+// entities by a value derived from their documents, e.g. a user's email address. Check for it
+// with a type assertion, or use FieldIndexerOf, which also looks through wrapping repositories.
+type FieldIndexer interface {
+	// CreateFieldIndex defines the index named field, replacing an existing one of that name.
+	// Returns ErrInvalidInput if field is empty or extractor is nil.
+	CreateFieldIndex(field string, extractor FieldExtractor) error
+	// FindByIndex returns the sorted identifiers of the entities indexed under value.
+	// Returns ErrInvalidInput if no index named field was created.
+	FindByIndex(ctx context.Context, field, value string) ([]EntityIdentifier, error)
+}
+
+// FieldIndexerOf returns the FieldIndexer of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo doesn't maintain secondary indexes.
+func FieldIndexerOf(repo DataRepository) (FieldIndexer, bool) {
+	for {
+		switch r := repo.(type) {
+		case FieldIndexer:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := FieldIndexerOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedFieldIndexer{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// validateFieldIndex checks the arguments of CreateFieldIndex
+func validateFieldIndex(field string, extractor FieldExtractor) error {
+	if field == "" {
+		return fmt.Errorf("%w: index field must not be empty", ErrInvalidInput)
+	}
+	if extractor == nil {
+		return fmt.Errorf("%w: index extractor must not be nil", ErrInvalidInput)
+	}
+	return nil
+}
+
+// errUnknownFieldIndex is returned by FindByIndex for fields without an index
+func errUnknownFieldIndex(field string) error {
+	return fmt.Errorf("%w: no index on field %q", ErrInvalidInput, field)
+}
+
+// fieldIndexRegistry holds the extractors of the secondary indexes of a repository. It is shared
+// by the repository and its namespace views.
+type fieldIndexRegistry struct {
+	mu         sync.RWMutex
+	extractors map[string]FieldExtractor
+}
+
+func newFieldIndexRegistry() *fieldIndexRegistry {
+	return &fieldIndexRegistry{extractors: make(map[string]FieldExtractor)}
+}
+
+func (f *fieldIndexRegistry) define(field string, extractor FieldExtractor) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.extractors[field] = extractor
+}
+
+// active reports whether any index is defined, i.e. whether writes need to maintain indexes
+func (f *fieldIndexRegistry) active() bool {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	return len(f.extractors) > 0
+}
+
+func (f *fieldIndexRegistry) extractor(field string) (FieldExtractor, bool) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	extractor, ok := f.extractors[field]
+	return extractor, ok
+}
+
+// values returns the non-empty values doc is indexed under, by field
+func (f *fieldIndexRegistry) values(doc interface{}) map[string]string {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	values := make(map[string]string, len(f.extractors))
+	for field, extractor := range f.extractors {
+		if value := extractor(doc); value != "" {
+			values[field] = value
+		}
+	}
+	return values
+}
+
+// sortedKeys returns the keys of a set in ascending order
+func sortedKeys(set map[string]struct{}) []string {
+	keys := make([]string, 0, len(set))
+	for key := range set {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
@@ -0,0 +1,113 @@
+// datarepository.fieldindex_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+// emailExtractor indexes documents by their "email" field
+func emailExtractor(value interface{}) string {
+	doc, _ := value.(map[string]interface{})
+	email, _ := doc["email"].(string)
+	return email
+}
+
+// findByIndex returns the identifiers indexed under value as strings
+func findByIndex(t *testing.T, indexer FieldIndexer, field, value string) []string {
+	t.Helper()
+	identifiers, err := indexer.FindByIndex(context.Background(), field, value)
+	if err != nil {
+		t.Fatalf("FindByIndex(%q, %q): %v", field, value, err)
+	}
+	found := make([]string, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		found = append(found, identifier.String())
+	}
+	return found
+}
+
+func TestFieldIndexFollowsWrites(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		indexer, ok := FieldIndexerOf(repo)
+		if !ok {
+			t.Fatal("FieldIndexerOf: the repository maintains no indexes")
+		}
+		if err := indexer.CreateFieldIndex("email", emailExtractor); err != nil {
+			t.Fatalf("CreateFieldIndex: %v", err)
+		}
+		ann, bob := SimpleIdentifier("user:ann"), SimpleIdentifier("user:bob")
+		if err := repo.Create(ctx, ann, map[string]string{"email": "ann@example.com"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.Create(ctx, bob, map[string]string{"email": "shared@example.com"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if got := findByIndex(t, indexer, "email", "ann@example.com"); !reflect.DeepEqual(got, []string{"user:ann"}) {
+			t.Errorf("after Create: got %v, want [user:ann]", got)
+		}
+
+		// Changing the indexed field moves the entity to its new value
+		if err := repo.Update(ctx, ann, map[string]string{"email": "shared@example.com"}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if got := findByIndex(t, indexer, "email", "ann@example.com"); len(got) != 0 {
+			t.Errorf("old value after Update: got %v, want no entities", got)
+		}
+		if got := findByIndex(t, indexer, "email", "shared@example.com"); !reflect.DeepEqual(got, []string{"user:ann", "user:bob"}) {
+			t.Errorf("new value after Update: got %v, want [user:ann user:bob]", got)
+		}
+
+		if err := repo.Upsert(ctx, bob, map[string]string{"email": "bob@example.com"}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+		if got := findByIndex(t, indexer, "email", "bob@example.com"); !reflect.DeepEqual(got, []string{"user:bob"}) {
+			t.Errorf("after Upsert: got %v, want [user:bob]", got)
+		}
+
+		// Documents the extractor returns "" for are left out of the index
+		if err := repo.Upsert(ctx, bob, map[string]string{"name": "bob"}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+		if got := findByIndex(t, indexer, "email", "bob@example.com"); len(got) != 0 {
+			t.Errorf("after removing the field: got %v, want no entities", got)
+		}
+
+		if err := repo.Delete(ctx, ann); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if got := findByIndex(t, indexer, "email", "shared@example.com"); len(got) != 0 {
+			t.Errorf("after Delete: got %v, want no entities", got)
+		}
+
+		if _, err := indexer.FindByIndex(ctx, "phone", "123"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("FindByIndex without an index: got %v, want ErrInvalidInput", err)
+		}
+		if err := indexer.CreateFieldIndex("", emailExtractor); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("CreateFieldIndex without a field: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestMemoryFieldIndexCoversExistingEntities(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	if err := repo.Create(ctx, SimpleIdentifier("user:ann"), map[string]string{"email": "ann@example.com"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	// Redis only indexes documents written after the index was created, memory indexes all
+	indexer, ok := FieldIndexerOf(NewHookedRepository(repo))
+	if !ok {
+		t.Fatal("FieldIndexerOf: the wrapped repository maintains no indexes")
+	}
+	if err := indexer.CreateFieldIndex("email", emailExtractor); err != nil {
+		t.Fatalf("CreateFieldIndex: %v", err)
+	}
+	if got := findByIndex(t, indexer, "email", "ann@example.com"); !reflect.DeepEqual(got, []string{"user:ann"}) {
+		t.Errorf("entity created before the index: got %v, want [user:ann]", got)
+	}
+}
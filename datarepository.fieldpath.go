@@ -0,0 +1,91 @@
+// datarepository.fieldpath.go
+
+package datarepository
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// SplitFieldPath splits a dotted field path like "address.city" or "items.0.name" into its parts.
+// A leading "$." or "." (RedisJSON path syntax) is accepted and ignored.
+func SplitFieldPath(path string) ([]string, error) {
+	trimmed := strings.TrimPrefix(strings.TrimPrefix(path, "$"), ".")
+	if trimmed == "" {
+		return nil, fmt.Errorf("%w: empty field path", ErrInvalidInput)
+	}
+	parts := strings.Split(trimmed, ".")
+	for _, part := range parts {
+		if part == "" {
+			return nil, fmt.Errorf("%w: invalid field path %q", ErrInvalidInput, path)
+		}
+	}
+	return parts, nil
+}
+
+// redisJSONPath converts a dotted field path to a RedisJSON path
+func redisJSONPath(path string) (string, error) {
+	parts, err := SplitFieldPath(path)
+	if err != nil {
+		return "", err
+	}
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, part := range parts {
+		if index, err := strconv.Atoi(part); err == nil {
+			sb.WriteString("[" + strconv.Itoa(index) + "]")
+		} else {
+			sb.WriteString("." + part)
+		}
+	}
+	return sb.String(), nil
+}
+
+// GetFieldPath walks a generic document (maps, slices and scalars as produced by decoding
+// into interface{}) and returns the value at parts
+func GetFieldPath(doc interface{}, parts []string) (interface{}, error) {
+	current := doc
+	for i, part := range parts {
+		switch node := current.(type) {
+		case map[string]interface{}:
+			value, ok := node[part]
+			if !ok {
+				return nil, fmt.Errorf("%w: field path %q does not exist", ErrInvalidInput, strings.Join(parts[:i+1], "."))
+			}
+			current = value
+		case []interface{}:
+			index, err := strconv.Atoi(part)
+			if err != nil || index < 0 || index >= len(node) {
+				return nil, fmt.Errorf("%w: invalid array index %q", ErrInvalidInput, part)
+			}
+			current = node[index]
+		default:
+			return nil, fmt.Errorf("%w: field path %q does not exist", ErrInvalidInput, strings.Join(parts[:i+1], "."))
+		}
+	}
+	return current, nil
+}
+
+// SetFieldPath sets the value at parts within a generic document. All but the last part
+// must exist; the last part may add a new field to an existing object.
+func SetFieldPath(doc interface{}, parts []string, value interface{}) error {
+	parent, err := GetFieldPath(doc, parts[:len(parts)-1])
+	if err != nil {
+		return err
+	}
+	last := parts[len(parts)-1]
+	switch node := parent.(type) {
+	case map[string]interface{}:
+		node[last] = value
+	case []interface{}:
+		index, err := strconv.Atoi(last)
+		if err != nil || index < 0 || index >= len(node) {
+			return fmt.Errorf("%w: invalid array index %q", ErrInvalidInput, last)
+		}
+		node[index] = value
+	default:
+		return fmt.Errorf("%w: field path %q does not point into an object or array", ErrInvalidInput, strings.Join(parts, "."))
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// datarepository.fieldpath_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestRedisJSONPath(t *testing.T) {
+	for path, want := range map[string]string{
+		"name":         "$.name",
+		"address.city": "$.address.city",
+		"items.0.name": "$.items[0].name",
+		"a.b.c.d":      "$.a.b.c.d",
+		"matrix.1.2":   "$.matrix[1][2]",
+	} {
+		if got, err := redisJSONPath(path); err != nil || got != want {
+			t.Errorf("redisJSONPath(%q): got %q, %v, want %q", path, got, err, want)
+		}
+	}
+	for _, path := range []string{"", ".", "a..b", "a."} {
+		if _, err := redisJSONPath(path); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("redisJSONPath(%q): got %v, want ErrInvalidInput", path, err)
+		}
+	}
+}
+
+func TestUpdateNestedField(t *testing.T) {
+	type address struct {
+		City string `json:"city"`
+		Zip  string `json:"zip"`
+	}
+	type user struct {
+		Name    string   `json:"name"`
+		Address address  `json:"address"`
+		Tags    []string `json:"tags"`
+	}
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("user:1")
+		if err := repo.Create(ctx, id, user{Name: "ann", Address: address{City: "Berlin", Zip: "10115"}, Tags: []string{"a", "b"}}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if err := repo.UpdateField(ctx, id, "address.city", "Hamburg"); err != nil {
+			t.Fatalf("UpdateField: %v", err)
+		}
+		if err := repo.UpdateField(ctx, id, "tags.1", "c"); err != nil {
+			t.Fatalf("UpdateField of an array element: %v", err)
+		}
+		var got user
+		if err := repo.Read(ctx, id, &got); err != nil {
+			t.Fatalf("Read: %v", err)
+		}
+		want := user{Name: "ann", Address: address{City: "Hamburg", Zip: "10115"}, Tags: []string{"a", "c"}}
+		if got.Name != want.Name || got.Address != want.Address || len(got.Tags) != 2 || got.Tags[1] != "c" {
+			t.Errorf("Read: got %+v, want %+v", got, want)
+		}
+
+		var city string
+		if err := repo.ReadField(ctx, id, "address.city", &city); err != nil || city != "Hamburg" {
+			t.Errorf("ReadField: got %q, %v, want Hamburg", city, err)
+		}
+		var addr address
+		if err := repo.ReadField(ctx, id, "address", &addr); err != nil || addr != want.Address {
+			t.Errorf("ReadField of an object: got %+v, %v, want %+v", addr, err, want.Address)
+		}
+
+		if err := repo.UpdateField(ctx, id, "missing.city", "x"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("UpdateField below a missing parent: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.UpdateField(ctx, id, "a..b", "x"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("UpdateField with an invalid path: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.ReadField(ctx, id, "address.street", &city); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ReadField of a missing field: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.UpdateField(ctx, SimpleIdentifier("user:2"), "name", "x"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateField of a missing entity: got %v, want ErrNotFound", err)
+		}
+	})
+}
@@ -0,0 +1,103 @@
+// datarepository.geo.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"math"
+)
+
+// GeoHit is a member found by GeoRadius with its distance from the center, in the unit of the query
+type GeoHit struct {
+	Member   string
+	Distance float64
+}
+
+// GeoStore is implemented by repositories that store sets of named coordinates under an
+// identifier, e.g. places, and query them by distance. A geo set is an entity like any other:
+// Exists, Delete and SetExpiration apply to it. Check for it with a type assertion, or use
+// GeoStoreOf, which also looks through wrapping repositories.
+type GeoStore interface {
+	// GeoAdd adds member at the coordinates to the geo set, which is created if it doesn't exist,
+	// or moves member if it is already in it. Returns ErrInvalidInput for coordinates Redis
+	// can't index, i.e. a latitude beyond ±85.05112878 degrees, or if the entity holds
+	// something other than a geo set.
+	GeoAdd(ctx context.Context, identifier EntityIdentifier, member string, lon, lat float64) error
+	// GeoRadius returns the members within radius of the coordinates, nearest first, with their
+	// distance. unit is one of "m", "km", "mi" and "ft" and applies to radius and the
+	// distances. A missing geo set is empty.
+	GeoRadius(ctx context.Context, identifier EntityIdentifier, lon, lat float64, radius float64, unit string) ([]GeoHit, error)
+}
+
+// GeoStoreOf returns the GeoStore of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo doesn't store geo sets.
+func GeoStoreOf(repo DataRepository) (GeoStore, bool) {
+	for {
+		switch r := repo.(type) {
+		case GeoStore:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := GeoStoreOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedGeoStore{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// errNotAGeoSet is returned by geo operations on an entity that holds something else
+var errNotAGeoSet = fmt.Errorf("%w: value is not a geo set", ErrInvalidInput)
+
+const (
+	// geoMaxLatitude is the highest latitude Redis can index, that of the Web Mercator projection
+	geoMaxLatitude = 85.05112878
+	// geoEarthRadius is the earth radius in meters that Redis uses for distances
+	geoEarthRadius = 6372797.560856
+)
+
+// geoUnits are the units of GeoRadius in meters, as defined by Redis
+var geoUnits = map[string]float64{
+	"m":  1,
+	"km": 1000,
+	"mi": 1609.34,
+	"ft": 0.3048,
+}
+
+// checkGeoPosition returns ErrInvalidInput for coordinates Redis rejects
+func checkGeoPosition(lon, lat float64) error {
+	if math.IsNaN(lon) || math.IsNaN(lat) || lon < -180 || lon > 180 || lat < -geoMaxLatitude || lat > geoMaxLatitude {
+		return fmt.Errorf("%w: invalid coordinates %f,%f", ErrInvalidInput, lon, lat)
+	}
+	return nil
+}
+
+// checkGeoQuery validates the arguments of GeoRadius and returns the unit in meters
+func checkGeoQuery(lon, lat, radius float64, unit string) (float64, error) {
+	if err := checkGeoPosition(lon, lat); err != nil {
+		return 0, err
+	}
+	meters, ok := geoUnits[unit]
+	if !ok {
+		return 0, fmt.Errorf("%w: unknown unit %q, use m, km, mi or ft", ErrInvalidInput, unit)
+	}
+	if math.IsNaN(radius) || radius < 0 {
+		return 0, fmt.Errorf("%w: radius must not be negative", ErrInvalidInput)
+	}
+	return meters, nil
+}
+
+// geoDistance returns the great-circle distance in meters between two coordinates with the
+// haversine formula, like Redis
+func geoDistance(lon1, lat1, lon2, lat2 float64) float64 {
+	toRadians := math.Pi / 180
+	lat1, lat2 = lat1*toRadians, lat2*toRadians
+	u := math.Sin((lat2 - lat1) / 2)
+	v := math.Sin((lon2 - lon1) * toRadians / 2)
+	return 2 * geoEarthRadius * math.Asin(math.Sqrt(u*u+math.Cos(lat1)*math.Cos(lat2)*v*v))
+}
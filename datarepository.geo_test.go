@@ -0,0 +1,61 @@
+// datarepository.geo_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"math"
+	"testing"
+)
+
+func TestGeoStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		geos, ok := GeoStoreOf(repo)
+		if !ok {
+			t.Fatal("GeoStoreOf: the repository stores no geo sets")
+		}
+		places := SimpleIdentifier("places:1")
+		for _, place := range []struct {
+			member   string
+			lon, lat float64
+		}{
+			{"brandenburg-gate", 13.377704, 52.516275},
+			{"alexanderplatz", 13.413215, 52.521918},
+			{"hamburg", 9.993682, 53.551086},
+		} {
+			if err := geos.GeoAdd(ctx, places, place.member, place.lon, place.lat); err != nil {
+				t.Fatalf("GeoAdd(%s): %v", place.member, err)
+			}
+		}
+
+		// Around Berlin's Museum Island, between the gate (about 1.7 km) and Alexanderplatz
+		// (about 0.8 km), with Hamburg 250 km away
+		hits, err := geos.GeoRadius(ctx, places, 13.401046, 52.519144, 5, "km")
+		if err != nil {
+			t.Fatalf("GeoRadius: %v", err)
+		}
+		if len(hits) != 2 || hits[0].Member != "alexanderplatz" || hits[1].Member != "brandenburg-gate" {
+			t.Fatalf("GeoRadius: got %+v, want alexanderplatz and brandenburg-gate, nearest first", hits)
+		}
+		for i, want := range []float64{0.84, 1.61} {
+			if math.Abs(hits[i].Distance-want) > 0.05 {
+				t.Errorf("GeoRadius: got a distance of %v km to %s, want about %v", hits[i].Distance, hits[i].Member, want)
+			}
+		}
+		if hits, err := geos.GeoRadius(ctx, places, 13.401046, 52.519144, 500, "m"); err != nil || len(hits) != 0 {
+			t.Errorf("GeoRadius of 500 m: got %+v, %v, want none", hits, err)
+		}
+
+		if hits, err := geos.GeoRadius(ctx, SimpleIdentifier("places:missing"), 0, 0, 1, "km"); err != nil || len(hits) != 0 {
+			t.Errorf("GeoRadius of a missing geo set: got %+v, %v, want none", hits, err)
+		}
+		if err := geos.GeoAdd(ctx, places, "north-pole", 0, 90); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("GeoAdd beyond the indexable latitudes: got %v, want ErrInvalidInput", err)
+		}
+		if _, err := geos.GeoRadius(ctx, places, 0, 0, 1, "parsec"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("GeoRadius with an unknown unit: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
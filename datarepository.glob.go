@@ -0,0 +1,185 @@
+// datarepository.glob.go
+
+package datarepository
+
+import (
+	"regexp"
+	"strings"
+)
+
+// globMetaChars are the characters with a special meaning in glob patterns
+const globMetaChars = `*?[]\`
+
+// globClassMetaChars are the characters that are escaped within a class of a regular expression
+const globClassMetaChars = `\]^-[`
+
+// EscapeGlob escapes the glob metacharacters in s with a backslash, so it matches only itself
+// when used in the pattern of List, ListPaged, Count, Iterate or PSubscribe. Use it for ids
+// that may contain "*" or "?", e.g. List(ctx, EscapeGlob(id.String())) to list exactly one
+// entity, or List(ctx, "user:"+EscapeGlob(userID)+":*") to list the entities below it.
+func EscapeGlob(s string) string {
+	if !strings.ContainsAny(s, globMetaChars) {
+		return s
+	}
+	var b strings.Builder
+	for _, c := range s {
+		if strings.ContainsRune(globMetaChars, c) {
+			b.WriteByte('\\')
+		}
+		b.WriteRune(c)
+	}
+	return b.String()
+}
+
+// GlobTokenKind is the kind of a GlobToken
+type GlobTokenKind int
+
+const (
+	// GlobLiteral matches its Char
+	GlobLiteral GlobTokenKind = iota
+	// GlobAny ("*") matches any sequence of characters
+	GlobAny
+	// GlobOne ("?") matches any single character
+	GlobOne
+	// GlobClass ("[...]") matches a single character of its Ranges, or not of them if Negated
+	GlobClass
+)
+
+// GlobRange is a range of characters of a class; single characters have Lo == Hi
+type GlobRange struct {
+	Lo, Hi rune
+}
+
+// GlobToken is a part of a glob pattern
+type GlobToken struct {
+	Kind    GlobTokenKind
+	Char    rune
+	Negated bool
+	Ranges  []GlobRange
+}
+
+// ParseGlob splits a glob pattern into tokens following the rules of Redis' KEYS and SCAN:
+// "*" matches any sequence of characters, "?" any single character, "[abc]" and "[a-z]" one of
+// the listed characters and "[^abc]" any other character. A backslash escapes the following
+// character, also within a class. Like in Redis, a class that is not closed extends to the end of
+// the pattern, "[]" matches nothing and the bounds of a reversed range like "[z-a]" are swapped.
+func ParseGlob(glob string) []GlobToken {
+	runes := []rune(glob)
+	tokens := make([]GlobToken, 0, len(runes))
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; {
+		case c == '*':
+			tokens = append(tokens, GlobToken{Kind: GlobAny})
+		case c == '?':
+			tokens = append(tokens, GlobToken{Kind: GlobOne})
+		case c == '[':
+			token := GlobToken{Kind: GlobClass}
+			i++
+			if i < len(runes) && runes[i] == '^' {
+				token.Negated = true
+				i++
+			}
+			for ; i < len(runes) && runes[i] != ']'; i++ {
+				lo, hi := runes[i], runes[i]
+				switch {
+				case lo == '\\' && i+1 < len(runes):
+					i++
+					lo, hi = runes[i], runes[i]
+				case i+2 < len(runes) && runes[i+1] == '-':
+					hi = runes[i+2]
+					i += 2
+					if lo > hi {
+						lo, hi = hi, lo
+					}
+				}
+				token.Ranges = append(token.Ranges, GlobRange{Lo: lo, Hi: hi})
+			}
+			tokens = append(tokens, token)
+		case c == '\\' && i+1 < len(runes):
+			i++
+			tokens = append(tokens, GlobToken{Kind: GlobLiteral, Char: runes[i]})
+		default:
+			tokens = append(tokens, GlobToken{Kind: GlobLiteral, Char: c})
+		}
+	}
+	return tokens
+}
+
+// GlobToRegex converts a glob pattern into an anchored regular expression that matches the
+// same strings as the pattern does in Redis. All characters of the pattern other than its
+// wildcards and classes, including regular expression metacharacters like "." or "(", match
+// only themselves.
+func GlobToRegex(glob string) string {
+	var b strings.Builder
+	b.WriteString("^")
+	for _, token := range ParseGlob(glob) {
+		switch token.Kind {
+		case GlobAny:
+			b.WriteString(".*")
+		case GlobOne:
+			b.WriteString(".")
+		case GlobClass:
+			writeRegexClass(&b, token)
+		default:
+			b.WriteString(regexp.QuoteMeta(string(token.Char)))
+		}
+	}
+	b.WriteString("$")
+	return b.String()
+}
+
+// writeRegexClass writes a class token as a class of a regular expression
+func writeRegexClass(b *strings.Builder, token GlobToken) {
+	if len(token.Ranges) == 0 {
+		if token.Negated {
+			b.WriteString(".")
+		} else {
+			b.WriteString(`[^\x00-\x{10FFFF}]`)
+		}
+		return
+	}
+	b.WriteString("[")
+	if token.Negated {
+		b.WriteString("^")
+	}
+	for _, r := range token.Ranges {
+		writeRegexClassChar(b, r.Lo)
+		if r.Hi != r.Lo {
+			b.WriteString("-")
+			writeRegexClassChar(b, r.Hi)
+		}
+	}
+	b.WriteString("]")
+}
+
+func writeRegexClassChar(b *strings.Builder, c rune) {
+	if strings.ContainsRune(globClassMetaChars, c) {
+		b.WriteByte('\\')
+	}
+	b.WriteRune(c)
+}
+
+// globLiterals returns the characters of a glob pattern that match only themselves, i.e. the
+// pattern without its wildcards and classes and with its escaped characters unescaped
+func globLiterals(glob string) string {
+	var b strings.Builder
+	for _, token := range ParseGlob(glob) {
+		if token.Kind == GlobLiteral {
+			b.WriteRune(token.Char)
+		}
+	}
+	return b.String()
+}
+
+// GlobLiteralPrefix returns the part of a glob pattern before its first wildcard or class,
+// unescaped
+func GlobLiteralPrefix(glob string) string {
+	var b strings.Builder
+	for _, token := range ParseGlob(glob) {
+		if token.Kind != GlobLiteral {
+			break
+		}
+		b.WriteRune(token.Char)
+	}
+	return b.String()
+}
@@ -0,0 +1,97 @@
+// datarepository.glob_test.go
+
+package datarepository
+
+import (
+	"context"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+var globTestKeys = []string{"a", "a.b", "axb", "a(b)", "a+", "aa+", "a[1]", "a1", "a2", "a\\b", "a*", "a^b", "a$", "a|b", "ab{2}"}
+
+func TestGlobMatchesLikeRedis(t *testing.T) {
+	for _, tc := range []struct {
+		pattern string
+		want    []string
+	}{
+		{"a.b", []string{"a.b"}},
+		{"a?b", []string{"a.b", "axb", "a\\b", "a^b", "a|b"}},
+		{"a(b)", []string{"a(b)"}},
+		{"a(*", []string{"a(b)"}},
+		{"a+", []string{"a+"}},
+		{"*+", []string{"a+", "aa+"}},
+		{"a[12]", []string{"a1", "a2"}},
+		{"a[0-9]", []string{"a1", "a2"}},
+		{"a[^0-9]", []string{"a*", "a$", "a+"}},
+		{"a\\[1\\]", []string{"a[1]"}},
+		{"a[[]*", []string{"a[1]"}},
+		{"a\\*", []string{"a*"}},
+		{"a\\\\b", []string{"a\\b"}},
+		{"a^b", []string{"a^b"}},
+		{"a$", []string{"a$"}},
+		{"a|b", []string{"a|b"}},
+		{"ab{2}", []string{"ab{2}"}},
+		{"ab{*", []string{"ab{2}"}},
+		{"a[]", nil},
+		{"*", globTestKeys},
+	} {
+		regex, err := compileGlob(tc.pattern)
+		if err != nil {
+			t.Errorf("compileGlob(%q): %v", tc.pattern, err)
+			continue
+		}
+		var got []string
+		for _, key := range globTestKeys {
+			if regex.MatchString(key) {
+				got = append(got, key)
+			}
+		}
+		want := append([]string(nil), tc.want...)
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: got %q, want %q", tc.pattern, got, want)
+		}
+	}
+}
+
+func TestGlobMatchesTheSameOnMemoryAndRedis(t *testing.T) {
+	ctx := context.Background()
+	memory := newTestMemoryRepository(t, MemoryConfig{})
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	for _, key := range globTestKeys {
+		if err := memory.Create(ctx, SimpleIdentifier(key), map[string]interface{}{}); err != nil {
+			t.Fatalf("Create %q: %v", key, err)
+		}
+		if err := server.Set(key, "{}"); err != nil {
+			t.Fatalf("miniredis Set %q: %v", key, err)
+		}
+	}
+	for _, pattern := range []string{"a.b", "a?b", "a(*", "*+", "a[12]", "a[^0-9]", "a\\*", "a^b", "a|b", "ab{*"} {
+		ids, _, err := memory.List(ctx, pattern)
+		if err != nil {
+			t.Errorf("List %q: %v", pattern, err)
+			continue
+		}
+		got := make([]string, 0, len(ids))
+		for _, id := range ids {
+			got = append(got, id.String())
+		}
+		want, err := client.Keys(ctx, pattern).Result()
+		if err != nil {
+			t.Fatalf("miniredis KEYS %q: %v", pattern, err)
+		}
+		sort.Strings(got)
+		sort.Strings(want)
+		if !reflect.DeepEqual(got, want) {
+			t.Errorf("%q: memory List got %q, Redis KEYS got %q", pattern, got, want)
+		}
+	}
+}
@@ -5,9 +5,15 @@ package datarepository
 import (
 	"context"
 	"errors"
+	"fmt"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// NoExpiration is returned as the TTL of an entity that exists but has no expiration set
+const NoExpiration time.Duration = -1
+
 var (
 	// ErrNotFound is returned when an entity is not found in the repository
 	ErrNotFound = errors.New("entity not found")
@@ -24,59 +30,282 @@ var (
 	// ErrOperationFailed is returned when a repository operation fails for a reason other than those above
 	ErrOperationFailed = errors.New("operation failed")
 
+	// ErrLockNotOwned is returned when releasing a lock with a token that does not match its owner
+	ErrLockNotOwned = errors.New("lock is held by another owner")
+
+	// ErrVersionConflict is returned by UpdateWithVersion when the entity's version differs from the expected one
+	ErrVersionConflict = errors.New("version conflict")
+
 	// ErrNotSupported is returned when an operation is not supported by the repository
 	ErrNotSupported = errors.New("operation not supported")
+
+	// ErrDecryption is returned when a stored value cannot be decrypted by EncryptingCodec
+	ErrDecryption = errors.New("decryption failed")
+
+	// ErrInTransaction is returned by operations that are not available within WithTransaction
+	ErrInTransaction = fmt.Errorf("%w: not available within a transaction", ErrNotSupported)
 )
 
-// DataRepository defines a generic interface for data storage operations
+// DataRepository defines a generic interface for data storage operations.
+//
+// The methods that write a whole entity value, i.e. the Create, Upsert and Update variants,
+// CompareAndSwap and GetAndSet, return ErrInvalidInput for a nil value, including nil pointers,
+// maps and slices, since null doesn't read back as a value. Write Null to store null deliberately.
+// UpdateField accepts nil and sets the field to null.
 type DataRepository interface {
 	// Create adds a new entity to the repository.
 	// Returns ErrAlreadyExists if the entity already exists.
+	// Returns ErrInvalidInput if value is nil.
 	// Returns ErrInvalidIdentifier if the identifier is invalid.
 	Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error
 
+	// CreateIfAbsent adds a new entity with the given expiration in one atomic operation and
+	// reports whether it was created. Unlike Create, an existing entity is not an error; it is
+	// left unchanged and false is returned. A ttl of 0 means no expiration.
+	// Returns ErrInvalidInput if ttl is negative.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error)
+
+	// CreateWithTTL adds a new entity that expires after ttl. The value and its expiration are
+	// written in one atomic operation, so the entity is never stored without its TTL.
+	// Returns ErrAlreadyExists if the entity already exists.
+	// Returns ErrInvalidInput if ttl is not positive.
+	CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error
+
+	// CreateWithGeneratedID generates an id using the configured IDGenerator, creates the entity
+	// and returns its identifier. Retries with a fresh id if the generated one already exists.
+	CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error)
+
 	// Read retrieves an entity from the repository.
 	// Returns ErrNotFound if the entity does not exist.
 	// Returns ErrInvalidIdentifier if the identifier is invalid.
 	Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error
 
+	// Exists reports whether an entity exists without reading its value.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	Exists(ctx context.Context, identifier EntityIdentifier) (bool, error)
+
+	// ExistsMany reports for each given entity whether it exists, in one round trip where the
+	// backend allows. The result has an entry for every identifier that could be checked; invalid
+	// identifiers are reported in a *BatchError, which is returned together with the result.
+	ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error)
+
+	// ReadWithTTL retrieves an entity together with its remaining time to live in one operation.
+	// The returned duration is NoExpiration if the entity has no expiration set.
+	// Returns ErrNotFound if the entity does not exist.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error)
+
 	// Upsert adds a new entity to the repository or updates an existing one.
+	// Returns ErrInvalidInput if value is nil.
 	// Returns ErrInvalidIdentifier if the identifier is invalid
 	Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error
 
+	// UpsertWithTTL adds or updates an entity and sets its expiration to ttl in one atomic
+	// operation, replacing any previous expiration.
+	// Returns ErrInvalidInput if ttl is not positive.
+	UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error
+
+	// UpsertManyWithTTL adds or updates all given entities and sets the same expiration on each of them.
+	// Every value is written together with its expiration, so no entity is ever stored without its TTL.
+	// Returns a *BatchError identifying the entities that failed; all others are applied.
+	// Returns ErrInvalidInput if ttl is not positive.
+	UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error
+
 	// Update modifies an existing entity in the repository.
 	// Returns ErrNotFound if the entity does not exist.
+	// Returns ErrInvalidInput if value is nil.
 	// Returns ErrInvalidIdentifier if the identifier is invalid.
 	Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error
 
+	// CompareAndSwap replaces the value of an entity with newValue if its current value equals
+	// expected, comparing both as serialized by the codec. The expiration is kept.
+	// Returns false if the current value differs.
+	// Returns ErrNotFound if the entity does not exist.
+	CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error)
+
+	// UpdateWithVersion replaces the value of an existing entity if its version equals
+	// expectedVersion and returns the new version, which is one higher. Entities that were never
+	// written by UpdateWithVersion have version 0; other writes don't change the version.
+	// Deleting an entity, or letting it expire, resets its version. The expiration is kept.
+	// Returns ErrVersionConflict if the current version differs.
+	// Returns ErrNotFound if the entity does not exist.
+	UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error)
+
+	// GetVersion returns the version of an entity as maintained by UpdateWithVersion.
+	// Returns ErrNotFound if the entity does not exist.
+	GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error)
+
+	// UpdateField replaces a single field of an existing entity, addressed by a dotted path
+	// such as "address.city" or "items.0.name", without rewriting the whole entity.
+	// Returns ErrNotFound if the entity does not exist.
+	// Returns ErrInvalidInput if the path is invalid or its parent does not exist.
+	UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error
+
+	// ReadField retrieves a single field of an entity, addressed by a dotted path.
+	// Returns ErrNotFound if the entity does not exist.
+	// Returns ErrInvalidInput if the path is invalid or does not exist.
+	ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error
+
 	// Delete removes an entity from the repository.
 	// Returns ErrNotFound if the entity does not exist.
 	// Returns ErrInvalidIdentifier if the identifier is invalid.
 	Delete(ctx context.Context, identifier EntityIdentifier) error
 
-	// List returns entities matching the given pattern.
+	// GetAndDelete retrieves an entity and removes it in one atomic operation, so that concurrent
+	// callers never both receive the same value. Like Delete, it resets the entity's version.
+	// Returns ErrNotFound if the entity does not exist.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error
+
+	// GetAndSet replaces the value of an existing entity with newValue and decodes the previous
+	// value into oldValue in one atomic operation. The expiration and version are kept.
+	// Returns ErrNotFound if the entity does not exist; nothing is written in that case.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error
+
+	// CreateMany adds all given entities that don't exist yet.
+	// Returns a *BatchError identifying the entities that failed (e.g. ErrAlreadyExists); all others are applied.
+	CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error
+
+	// ReadMany retrieves the given entities and calls fn with the raw serialized value of each one found.
+	// Missing entities are reported as ErrNotFound in a *BatchError after all found entities were passed to fn.
+	// If fn returns an error, ReadMany stops and returns that error.
+	ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error
+
+	// ReadManyOrdered decodes the given entities into dest, which must be a pointer to a slice.
+	// Element i of the resulting slice holds the value of identifiers[i]. Missing entities are
+	// represented by the zero value of the element type, e.g. nil for a slice of pointers.
+	// Returns ErrInvalidInput if dest is not a pointer to a slice.
+	ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error
+
+	// DeleteMany removes the given entities.
+	// Returns a *BatchError identifying the entities that failed (e.g. ErrNotFound); all others are removed.
+	DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error
+
+	// DeletePattern removes the entities matching the glob pattern, e.g. "user:tenant1:*", and
+	// returns how many were removed. Entities written concurrently may or may not be removed.
+	// Returns ErrInvalidInput unless the pattern starts with a literal entity prefix, so that a
+	// pattern like "*" can't remove the entities of all types at once.
+	DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error)
+
+	// List returns the identifiers and values of entities matching the given pattern.
+	// The values slice is index-aligned with the identifiers slice.
+	// Returns ErrNotFound instead of empty slices if nothing matches and the repository
+	// is configured with NotFoundOnEmpty.
 	// Returns ErrInvalidIdentifier if the pattern is invalid.
 	List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error)
 
+	// ListDetailed works like List but also reports the keys that matched the pattern but were
+	// skipped, e.g. because they are not valid identifiers or their values could not be read or
+	// decoded, so that partial results can be told apart from complete ones.
+	// Returns ErrNotFound if nothing matches, not even a skipped key, and the repository is
+	// configured with NotFoundOnEmpty.
+	// Returns ErrInvalidIdentifier if the pattern is invalid.
+	ListDetailed(ctx context.Context, pattern string) (ListResult, error)
+
+	// Count returns the number of entities matching the given pattern without fetching them.
+	// Returns ErrInvalidIdentifier if the pattern is invalid.
+	Count(ctx context.Context, pattern EntityIdentifier) (int64, error)
+
+	// Iterate calls fn with the identifier and raw serialized value of each entity matching the
+	// given pattern. Entities are streamed in batches instead of being loaded at once, so memory
+	// use stays bounded for large datasets. Entities created or removed during the iteration may
+	// or may not be passed to fn. If fn returns an error, Iterate stops and returns that error.
+	// Returns ErrInvalidIdentifier if the pattern is invalid.
+	Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error
+
+	// ListPaged returns one page of entities matching the given pattern, starting at cursor.
+	// Pass a cursor of 0 to start; a returned cursor of 0 means the iteration is complete.
+	// Pages may contain fewer or more entries than pageSize.
+	// Returns ErrInvalidInput if pageSize is not positive.
+	ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error)
+
+	// ListPage returns one page of identifiers matching the given pattern, starting at cursor,
+	// together with an opaque cursor for the next page. Pass an empty cursor to start; an empty
+	// next cursor means the iteration is complete. Pages may contain fewer or more entries than
+	// pageSize, and an entity may appear on more than one page if the backend's scan returns it
+	// more than once, as Redis SCAN does.
+	// Returns ErrInvalidInput if pageSize is not positive or the cursor is invalid.
+	ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error)
+
+	// EntityPrefixes returns the sorted, distinct entity prefixes of all stored entities
+	// whose identifier consists of an entity prefix and an id, e.g. to browse the keyspace.
+	// Redis walks all keys with SCAN, so the cost grows with the keyspace and the result is
+	// approximate while keys are written or deleted concurrently.
+	EntityPrefixes(ctx context.Context) ([]string, error)
+
+	// ListPrefixes is EntityPrefixes under the name admin tooling looks for.
+	ListPrefixes(ctx context.Context) ([]string, error)
+
 	// Search finds entities based on the given query.
+	// Returns ErrNotFound instead of an empty slice if nothing matches and the repository
+	// is configured with NotFoundOnEmpty.
 	// Returns ErrInvalidInput if the search parameters are invalid.
 	Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error)
 
+	// SearchDetailed works like Search but also reports the total number of matches and
+	// the raw keys of results that were skipped because they could not be converted to
+	// identifiers, which indicates drift between the search index and the data.
+	SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error)
+
+	// SearchResults works like SearchDetailed but also returns the decoded value of each
+	// match, which saves a Read per result.
+	// Returns ErrInvalidInput if the search options are invalid.
+	SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error)
+
+	// SearchQuery works like SearchResults but takes a structured Query instead of a
+	// backend-specific query string, so the same query matches the same entities on every
+	// backend that supports search.
+	// Returns ErrInvalidInput if the query or the search options are invalid.
+	SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error)
+
 	// AcquireLock attempts to acquire a lock for the given identifier.
 	// Returns ErrInvalidIdentifier if the identifier is invalid.
 	AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error)
 
-	// ReleaseLock releases a previously acquired lock.
+	// AcquireLockWithToken attempts to acquire a lock for the given identifier and returns
+	// the unique owner token required to release it via ReleaseLockWithToken.
+	// The token is empty if the lock was not acquired.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error)
+
+	// ReleaseLock releases a previously acquired lock regardless of its owner.
+	// Prefer ReleaseLockWithToken, which can't release a lock held by someone else.
 	// Returns ErrNotFound if the lock does not exist.
 	// Returns ErrInvalidIdentifier if the identifier is invalid.
 	ReleaseLock(ctx context.Context, identifier EntityIdentifier) error
 
+	// ReleaseLockWithToken releases a lock only if it is held with the given owner token.
+	// Returns ErrNotFound if the lock does not exist.
+	// Returns ErrLockNotOwned if the lock is held with a different token.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error
+
+	// RenewLock extends the expiration of a lock to ttl, but only if it is still held with the given owner token.
+	// Returns false if the lock expired or is held by someone else.
+	// Returns ErrInvalidIdentifier if the identifier is invalid.
+	RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error)
+
 	// Publish sends a message to the specified channel.
+	// Strings and byte slices are sent as is, other values are serialized with the repository's codec.
+	// Returns ErrInvalidInput if the message can't be serialized.
 	Publish(ctx context.Context, channel string, message interface{}) error
 
 	// Subscribe returns a channel that receives messages from the specified channel.
+	// Messages are delivered as strings holding the published payload.
 	Subscribe(ctx context.Context, channel string) (chan interface{}, error)
 
+	// SubscribeMessages works like Subscribe but returns a Subscription delivering structured messages
+	// carrying the channel name and the payload bytes, identically for all backends.
+	// The subscription ends when it is closed or when ctx is done.
+	SubscribeMessages(ctx context.Context, channel string) (Subscription, error)
+
+	// PSubscribe returns a Subscription that receives messages from all channels matching the glob pattern
+	// (e.g. "events:user:*"). Each Message carries the name of the channel it was published to.
+	// The subscription ends when it is closed or when ctx is done.
+	PSubscribe(ctx context.Context, pattern string) (Subscription, error)
+
 	// Ping checks the connection to the repository.
 	// Returns ErrOperationFailed if the connection fails.
 	Ping(ctx context.Context) error
@@ -87,17 +316,279 @@ type DataRepository interface {
 	// SetExpiration sets the expiration time for the given identifier.
 	SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error
 
+	// SetExpirationCond sets the expiration time for the given identifier if the condition holds.
+	// Returns false if the condition was not met or the entity does not exist.
+	// Returns ErrInvalidInput if the condition is unknown.
+	SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error)
+
+	// SetExpirationMany sets the same expiration time on all given entities.
+	// Returns a *BatchError identifying the entities that failed (e.g. ErrNotFound); all others are applied.
+	SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error
+
 	// GetExpiration returns the expiration time for the given identifier.
 	GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error)
 
-	// AtomicIncrement increments the value of the given identifier atomically.
+	// Persist removes the expiration of the given entity, so that it is kept until it is deleted.
+	// A sliding expiration ends as well. Returns ErrNotFound if the entity doesn't exist.
+	Persist(ctx context.Context, identifier EntityIdentifier) error
+
+	// Touch marks the given entity as accessed without reading its value: it restarts a sliding
+	// expiration and counts as a use for backends that evict the least recently used entities.
+	// Returns ErrNotFound if the entity doesn't exist.
+	Touch(ctx context.Context, identifier EntityIdentifier) error
+
+	// AtomicIncrement increments the counter of the given identifier by one, see IncrementBy.
 	AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error)
 
+	// IncrementBy adds delta, which may be negative, to the counter of the given identifier
+	// atomically and returns the new value. A missing counter starts at 0.
+	// Counters are plain integers, distinct from entities, and should not share identifiers with them.
+	// Returns ErrInvalidInput if the identifier holds a value that is not a counter.
+	IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error)
+
+	// DecrementBy subtracts delta from the counter of the given identifier atomically and returns
+	// the new value, see IncrementBy.
+	DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error)
+
+	// IncrementWithLimit adds delta to the counter of the given identifier atomically unless the
+	// result would exceed max, in which case the counter is left unchanged. Returns the resulting
+	// value and whether delta was added. A missing counter starts at 0.
+	// Returns ErrInvalidInput if the identifier holds a value that is not a counter.
+	IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error)
+
+	// IncrementWithExpiry adds delta to the counter of the given identifier and, if the counter
+	// has no expiration yet because it was just created, makes it expire after ttl, all atomically.
+	// Later increments keep the expiration, which suits fixed-window rate limiters.
+	// Returns the new value. A missing counter starts at 0.
+	// Returns ErrInvalidInput if ttl is not positive or the identifier holds a value that is not a counter.
+	IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error)
+
+	// IncrementFloat adds delta to the floating-point counter of the given identifier atomically
+	// and returns the new value. A missing counter starts at 0, an integer counter becomes a
+	// floating-point counter. Sums are subject to floating-point rounding.
+	// Returns ErrInvalidInput if the identifier holds a value that is not a counter.
+	IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error)
+
+	// GetCounter returns the value of a counter.
+	// Returns ErrNotFound if the counter does not exist.
+	// Returns ErrInvalidInput if the identifier holds a value that is not a counter.
+	GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error)
+
+	// SetCounter sets a counter to value, creating it if it does not exist, and replaces any
+	// entity stored under the identifier. An existing counter keeps its expiration.
+	SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error
+
+	// WithTransaction runs fn with a repository whose writes are applied atomically if fn returns
+	// nil and discarded if it returns an error, which WithTransaction then returns.
+	// fn must only use tx, not the repository itself, and may be retried on concurrent modifications.
+	// Messages published via tx are sent once the transaction commits; subscribing and closing
+	// are not available within a transaction.
+	// Returns ErrNotSupported if the repository does not support transactions.
+	WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error
+
 	// Plugin system
 	RegisterPlugin(plugin RepositoryPlugin) error
 	GetPlugin(name string) (RepositoryPlugin, bool)
 }
 
+// Operation names a DataRepository operation
+type Operation string
+
+const (
+	OpCreate                Operation = "Create"
+	OpCreateWithGeneratedID Operation = "CreateWithGeneratedID"
+	OpCreateIfAbsent        Operation = "CreateIfAbsent"
+	OpCreateWithTTL         Operation = "CreateWithTTL"
+	OpRead                  Operation = "Read"
+	OpReadWithTTL           Operation = "ReadWithTTL"
+	OpExists                Operation = "Exists"
+	OpExistsMany            Operation = "ExistsMany"
+	OpUpsert                Operation = "Upsert"
+	OpUpsertWithTTL         Operation = "UpsertWithTTL"
+	OpUpsertManyWithTTL     Operation = "UpsertManyWithTTL"
+	OpUpdate                Operation = "Update"
+	OpUpdateField           Operation = "UpdateField"
+	OpCompareAndSwap        Operation = "CompareAndSwap"
+	OpUpdateWithVersion     Operation = "UpdateWithVersion"
+	OpGetVersion            Operation = "GetVersion"
+	OpReadField             Operation = "ReadField"
+	OpDelete                Operation = "Delete"
+	OpGetAndDelete          Operation = "GetAndDelete"
+	OpGetAndSet             Operation = "GetAndSet"
+	OpCreateMany            Operation = "CreateMany"
+	OpReadMany              Operation = "ReadMany"
+	OpReadManyOrdered       Operation = "ReadManyOrdered"
+	OpDeleteMany            Operation = "DeleteMany"
+	OpDeletePattern         Operation = "DeletePattern"
+	OpList                  Operation = "List"
+	OpListPaged             Operation = "ListPaged"
+	OpListPage              Operation = "ListPage"
+	OpListDetailed          Operation = "ListDetailed"
+	OpCount                 Operation = "Count"
+	OpIterate               Operation = "Iterate"
+	OpEntityPrefixes        Operation = "EntityPrefixes"
+	OpSearch                Operation = "Search"
+	OpSearchDetailed        Operation = "SearchDetailed"
+	OpSearchResults         Operation = "SearchResults"
+	OpSearchQuery           Operation = "SearchQuery"
+	OpAcquireLock           Operation = "AcquireLock"
+	OpAcquireLockWithToken  Operation = "AcquireLockWithToken"
+	OpReleaseLock           Operation = "ReleaseLock"
+	OpReleaseLockWithToken  Operation = "ReleaseLockWithToken"
+	OpRenewLock             Operation = "RenewLock"
+	OpPublish               Operation = "Publish"
+	OpSubscribe             Operation = "Subscribe"
+	OpSubscribeMessages     Operation = "SubscribeMessages"
+	OpPSubscribe            Operation = "PSubscribe"
+	OpSetExpiration         Operation = "SetExpiration"
+	OpSetExpirationCond     Operation = "SetExpirationCond"
+	OpSetExpirationMany     Operation = "SetExpirationMany"
+	OpGetExpiration         Operation = "GetExpiration"
+	OpPersist               Operation = "Persist"
+	OpTouch                 Operation = "Touch"
+	OpAtomicIncrement       Operation = "AtomicIncrement"
+	OpIncrementBy           Operation = "IncrementBy"
+	OpDecrementBy           Operation = "DecrementBy"
+	OpIncrementWithLimit    Operation = "IncrementWithLimit"
+	OpIncrementWithExpiry   Operation = "IncrementWithExpiry"
+	OpIncrementFloat        Operation = "IncrementFloat"
+	OpGetCounter            Operation = "GetCounter"
+	OpSetCounter            Operation = "SetCounter"
+	OpWithTransaction       Operation = "WithTransaction"
+
+	// Operations of the optional interfaces, e.g. ListStore, checked by RestrictedRepository
+	// when they are obtained through it with ListStoreOf and the like
+	OpListPush                Operation = "ListPush"
+	OpListRange               Operation = "ListRange"
+	OpListPop                 Operation = "ListPop"
+	OpListLen                 Operation = "ListLen"
+	OpSetAdd                  Operation = "SetAdd"
+	OpSetMembers              Operation = "SetMembers"
+	OpSetIsMember             Operation = "SetIsMember"
+	OpSetRemove               Operation = "SetRemove"
+	OpHashSet                 Operation = "HashSet"
+	OpHashGet                 Operation = "HashGet"
+	OpHashGetAll              Operation = "HashGetAll"
+	OpHashDelete              Operation = "HashDelete"
+	OpZAdd                    Operation = "ZAdd"
+	OpZRange                  Operation = "ZRange"
+	OpZRank                   Operation = "ZRank"
+	OpZIncrBy                 Operation = "ZIncrBy"
+	OpGeoAdd                  Operation = "GeoAdd"
+	OpGeoRadius               Operation = "GeoRadius"
+	OpCreateFieldIndex        Operation = "CreateFieldIndex"
+	OpFindByIndex             Operation = "FindByIndex"
+	OpSetIdleExpiration       Operation = "SetIdleExpiration"
+	OpGetIdleExpiration       Operation = "GetIdleExpiration"
+	OpSubscribeKeyspaceEvents Operation = "SubscribeKeyspaceEvents"
+	OpWatch                   Operation = "Watch"
+)
+
+// ExpirationCondition restricts when SetExpirationCond applies a new expiration.
+// Entities without an expiration are treated as having an infinite TTL, matching Redis semantics.
+type ExpirationCondition string
+
+const (
+	// ExpireNX sets the expiration only if the entity has no expiration yet
+	ExpireNX ExpirationCondition = "NX"
+	// ExpireXX sets the expiration only if the entity already has an expiration
+	ExpireXX ExpirationCondition = "XX"
+	// ExpireGT sets the expiration only if it is greater than the current one
+	ExpireGT ExpirationCondition = "GT"
+	// ExpireLT sets the expiration only if it is less than the current one
+	ExpireLT ExpirationCondition = "LT"
+)
+
+// Message is a pub/sub message together with the channel it was published to
+type Message struct {
+	// Channel is the channel name as passed to Publish, without any repository prefix
+	Channel string
+	// Payload is the published message. Strings and byte slices are passed as is,
+	// other values are serialized with the repository's codec.
+	Payload []byte
+}
+
+// Subscription is a handle to a single SubscribeMessages or PSubscribe subscription
+type Subscription interface {
+	// Messages returns the channel delivering the subscription's messages.
+	// The channel is closed when the subscription ends.
+	Messages() <-chan Message
+
+	// Close ends the subscription and releases its resources.
+	// Closing an already closed subscription is a no-op.
+	Close() error
+}
+
+// SearchResult is the result of SearchDetailed
+type SearchResult struct {
+	// Identifiers of the matching entities on the requested page
+	Identifiers []EntityIdentifier
+	// Total number of matching entities, regardless of offset and limit
+	Total int64
+	// Skipped holds the raw keys of results that were dropped because they could not be
+	// converted to identifiers
+	Skipped []string
+}
+
+// SearchOptions selects the page and order of SearchResults, like the offset, limit, sortBy
+// and sortDir parameters of Search
+type SearchOptions struct {
+	Offset  int
+	Limit   int
+	SortBy  string
+	SortDir string
+}
+
+// SearchResponse is the result of SearchResults
+type SearchResponse struct {
+	// Total number of matching entities, regardless of offset and limit
+	Total int64
+	// Hits are the matching entities on the requested page
+	Hits []Hit
+	// Skipped holds the raw keys of results that were dropped because they could not be
+	// converted to identifiers or their values could not be decoded
+	Skipped []string
+}
+
+// Hit is a single match of SearchResults
+type Hit struct {
+	Identifier EntityIdentifier
+	Value      interface{}
+}
+
+// SearchResult returns the response as SearchDetailed does
+func (sr SearchResponse) SearchResult() SearchResult {
+	identifiers := make([]EntityIdentifier, 0, len(sr.Hits))
+	for _, hit := range sr.Hits {
+		identifiers = append(identifiers, hit.Identifier)
+	}
+	return SearchResult{Identifiers: identifiers, Total: sr.Total, Skipped: sr.Skipped}
+}
+
+// ListResult is the result of ListDetailed
+type ListResult struct {
+	// Identifiers of the listed entities
+	Identifiers []EntityIdentifier
+	// Entities holds the values of the listed entities, index-aligned with Identifiers
+	Entities []interface{}
+	// Skipped holds the keys that matched the pattern but were left out, with the reason
+	Skipped []SkippedKey
+}
+
+// SkippedKey is a key that was left out of a ListResult
+type SkippedKey struct {
+	Key string
+	Err error
+}
+
+// List returns the entities of a ListDetailed result as List does
+func (lr ListResult) List(notFoundOnEmpty bool) ([]EntityIdentifier, []interface{}, error) {
+	if len(lr.Identifiers) == 0 && notFoundOnEmpty {
+		return nil, nil, ErrNotFound
+	}
+	return lr.Identifiers, lr.Entities, nil
+}
+
 // EntityIdentifier represents a unique identifier for an entity
 type EntityIdentifier interface {
 	// String returns a string representation of the identifier
@@ -111,16 +602,226 @@ func (si SimpleIdentifier) String() string {
 	return string(si)
 }
 
-func emptyLogger(logLevel string, logContent string) {}
+// PrefixedIdentifier is implemented by identifiers that hold their entity prefix and id
+// separately, like RedisIdentifier and the identifiers of the backend packages
+type PrefixedIdentifier interface {
+	EntityIdentifier
+	// Parts returns the entity prefix and the id
+	Parts() (entityPrefix, id string)
+}
+
+// IsValidEntityPrefix reports whether entityPrefix may be used as the entity prefix of an
+// identifier
+func IsValidEntityPrefix(entityPrefix string) bool {
+	return entityPrefixRegex.MatchString(entityPrefix)
+}
+
+// SplitEntityIdentifier returns the entity prefix and id of an identifier for backends that store
+// entities by prefix and id. Identifiers other than PrefixedIdentifiers are split at the first
+// DefaultKeySeparator.
+func SplitEntityIdentifier(identifier EntityIdentifier) (string, string, error) {
+	var entityPrefix, id string
+	if ident, ok := identifier.(PrefixedIdentifier); ok {
+		entityPrefix, id = ident.Parts()
+	} else {
+		var found bool
+		entityPrefix, id, found = strings.Cut(identifier.String(), DefaultKeySeparator)
+		if !found {
+			return "", "", fmt.Errorf("%w: identifier must consist of an entity prefix and an id", ErrInvalidIdentifier)
+		}
+	}
+	if !entityPrefixRegex.MatchString(entityPrefix) {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidIdentifier, ErrInvalidEntityPrefix)
+	}
+	if id == "" {
+		return "", "", fmt.Errorf("%w: %v", ErrInvalidIdentifier, ErrEmptyKeyPart)
+	}
+	return entityPrefix, id, nil
+}
+
+// EntityPrefixOf returns the entity prefix of an identifier without validating it, or "" if the
+// identifier has none. Use it where the full identifier would be too specific, e.g. as a metric
+// label or trace attribute.
+func EntityPrefixOf(identifier EntityIdentifier) string {
+	switch ident := identifier.(type) {
+	case nil:
+		return ""
+	case PrefixedIdentifier:
+		entityPrefix, _ := ident.Parts()
+		return entityPrefix
+	default:
+		entityPrefix, _, found := strings.Cut(identifier.String(), DefaultKeySeparator)
+		if !found {
+			return ""
+		}
+		return entityPrefix
+	}
+}
+
+// CreateWithTTL implements DataRepository.CreateWithTTL on top of the repository's CreateIfAbsent
+func CreateWithTTL(ctx context.Context, repo DataRepository, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	created, err := repo.CreateIfAbsent(ctx, identifier, value, ttl)
+	if err == nil && !created {
+		return ErrAlreadyExists
+	}
+	return err
+}
+
+// TouchExisting implements DataRepository.Touch on top of the repository's Exists, for backends that neither
+// evict entities nor restart expirations on access
+func TouchExisting(ctx context.Context, repo DataRepository, identifier EntityIdentifier) error {
+	exists, err := repo.Exists(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return nil
+}
+
+// checkDeletePattern rejects DeletePattern patterns that don't start with a literal entity prefix
+func checkDeletePattern(pattern EntityIdentifier) error {
+	if pattern == nil || !entityPrefixRegex.MatchString(EntityPrefixOf(pattern)) {
+		return fmt.Errorf("%w: pattern must start with an entity prefix, e.g. user:*", ErrInvalidInput)
+	}
+	return nil
+}
+
+// DeletePattern implements DataRepository.DeletePattern on top of the repository's Iterate and DeleteMany.
+// Entities deleted by others in the meantime are not counted.
+func DeletePattern(ctx context.Context, repo DataRepository, pattern EntityIdentifier) (int64, error) {
+	if err := checkDeletePattern(pattern); err != nil {
+		return 0, err
+	}
+	var identifiers []EntityIdentifier
+	err := repo.Iterate(ctx, pattern, func(identifier EntityIdentifier, _ []byte) error {
+		identifiers = append(identifiers, identifier)
+		return nil
+	})
+	if err != nil || len(identifiers) == 0 {
+		return 0, err
+	}
+
+	deleted := int64(len(identifiers))
+	err = repo.DeleteMany(ctx, identifiers)
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		if err != nil {
+			return 0, err
+		}
+		return deleted, nil
+	}
+	failed := &BatchError{}
+	for _, itemErr := range batchErr.Errors {
+		deleted--
+		if !errors.Is(itemErr.Err, ErrNotFound) {
+			failed.Add(itemErr.Identifier, itemErr.Err)
+		}
+	}
+	return deleted, failed.ErrOrNil()
+}
+
+// parsePageCursor parses a ListPage cursor, which is empty on the first page
+func parsePageCursor(cursor string) (uint64, error) {
+	if cursor == "" {
+		return 0, nil
+	}
+	position, err := strconv.ParseUint(cursor, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid cursor %q", ErrInvalidInput, cursor)
+	}
+	return position, nil
+}
+
+// formatPageCursor formats the cursor of the next ListPage page, which is empty at the end
+func formatPageCursor(position uint64) string {
+	if position == 0 {
+		return ""
+	}
+	return strconv.FormatUint(position, 10)
+}
+
+// ListPage implements DataRepository.ListPage on top of the repository's ListPaged
+func ListPage(ctx context.Context, repo DataRepository, pattern, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	position, err := parsePageCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+	identifiers, _, next, err := repo.ListPaged(ctx, pattern, position, int64(pageSize))
+	if err != nil {
+		return nil, "", err
+	}
+	return identifiers, formatPageCursor(next), nil
+}
 
 type LogAdapter func(logLevel string, logContent string)
 
+// Logger receives the diagnostic messages of a repository, e.g. about entries that List or
+// Search skipped. Implementations must be safe for concurrent use.
+type Logger interface {
+	Debugf(format string, args ...interface{})
+	Warnf(format string, args ...interface{})
+	Errorf(format string, args ...interface{})
+}
+
+// noopLogger discards all messages
+type noopLogger struct{}
+
+func (noopLogger) Debugf(format string, args ...interface{}) {}
+func (noopLogger) Warnf(format string, args ...interface{})  {}
+func (noopLogger) Errorf(format string, args ...interface{}) {}
+
+// logAdapterLogger passes the messages of a Logger to a LogAdapter
+type logAdapterLogger LogAdapter
+
+func (l logAdapterLogger) Debugf(format string, args ...interface{}) {
+	l("DEBUG", fmt.Sprintf(format, args...))
+}
+
+func (l logAdapterLogger) Warnf(format string, args ...interface{}) {
+	l("WARN", fmt.Sprintf(format, args...))
+}
+
+func (l logAdapterLogger) Errorf(format string, args ...interface{}) {
+	l("ERROR", fmt.Sprintf(format, args...))
+}
+
+// ResolveLogger returns the logger configured for a repository: logger if set, else adapter if
+// set, else a no-op logger
+func ResolveLogger(logger Logger, adapter LogAdapter) Logger {
+	switch {
+	case logger != nil:
+		return logger
+	case adapter != nil:
+		return logAdapterLogger(adapter)
+	default:
+		return noopLogger{}
+	}
+}
+
 // Config defines the configuration for a DataRepository
 type Config interface {
 	// GetConnectionString returns the connection string for the DataRepository
 	GetConnectionString() string
 }
 
+// ConfigValidator is implemented by configs that can check themselves before a repository is
+// created. All configs of this package implement it; CreateDataRepository calls Validate before
+// the repository's factory.
+type ConfigValidator interface {
+	// Validate returns ErrInvalidInput describing the first invalid field, or nil
+	Validate() error
+}
+
+// InvalidConfig returns an ErrInvalidInput naming the config type and the problem with it
+func InvalidConfig(config string, format string, args ...interface{}) error {
+	return fmt.Errorf("%w: %s: %s", ErrInvalidInput, config, fmt.Sprintf(format, args...))
+}
+
 // NewDataRepository creates a new DataRepository instance based on the provided config
 type NewDataRepository func(config Config) (DataRepository, error)
 
@@ -132,6 +833,9 @@ func init() {
 	// Register in-memory repository
 	RegisterDataRepository("memory", NewMemoryRepository)
 
+	// Register null repository
+	RegisterDataRepository("null", NewNullRepository)
+
 	// Add any additional repository registrations here
 }
 
@@ -155,11 +859,32 @@ func IsInvalidInputError(err error) bool {
 	return errors.Is(err, ErrInvalidInput)
 }
 
+// IsLockNotOwnedError checks if the given error is an ErrLockNotOwned error
+func IsLockNotOwnedError(err error) bool {
+	return errors.Is(err, ErrLockNotOwned)
+}
+
+// IsVersionConflictError checks if the given error is an ErrVersionConflict error
+func IsVersionConflictError(err error) bool {
+	return errors.Is(err, ErrVersionConflict)
+}
+
 // IsOperationFailedError checks if the given error is an ErrOperationFailed error
 func IsOperationFailedError(err error) bool {
 	return errors.Is(err, ErrOperationFailed)
 }
 
+// pendingMessage is a message published within a transaction, sent once the transaction commits
+type pendingMessage struct {
+	channel string
+	message interface{}
+}
+
+// NewLockToken returns a unique lock owner token
+func NewLockToken() string {
+	return UUIDv4Generator{}.Generate("")
+}
+
 // RepositoryPlugin defines the interface for database-specific plugins
 type RepositoryPlugin interface {
 	Name() string
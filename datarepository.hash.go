@@ -0,0 +1,51 @@
+// datarepository.hash.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+// HashStore is implemented by repositories that store hashes under an identifier, whose fields
+// can be written and read independently rather than as a whole document. Field values are
+// encoded with the repository's codec. A hash is an entity like any other: Exists, Delete and
+// SetExpiration apply to it, and deleting its last field deletes it. Check for it with a type
+// assertion, or use HashStoreOf, which also looks through wrapping repositories.
+type HashStore interface {
+	// HashSet sets the field of the hash, which is created if it doesn't exist. Returns
+	// ErrInvalidInput if value is nil or the entity holds something other than a hash.
+	HashSet(ctx context.Context, identifier EntityIdentifier, field string, value interface{}) error
+	// HashGet decodes the value of the field into out.
+	// Returns ErrNotFound if the hash or the field doesn't exist.
+	HashGet(ctx context.Context, identifier EntityIdentifier, field string, out interface{}) error
+	// HashGetAll returns all fields of the hash with their values in their generic form
+	// (maps, slices and scalars). A missing hash is empty.
+	HashGetAll(ctx context.Context, identifier EntityIdentifier) (map[string]interface{}, error)
+	// HashDelete deletes the field of the hash. Deleting a missing field is not an error.
+	HashDelete(ctx context.Context, identifier EntityIdentifier, field string) error
+}
+
+// HashStoreOf returns the HashStore of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo doesn't store hashes.
+func HashStoreOf(repo DataRepository) (HashStore, bool) {
+	for {
+		switch r := repo.(type) {
+		case HashStore:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := HashStoreOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedHashStore{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// errNotAHash is returned by hash operations on an entity that holds something else
+var errNotAHash = fmt.Errorf("%w: value is not a hash", ErrInvalidInput)
@@ -0,0 +1,83 @@
+// datarepository.hash_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func TestHashStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		hashes, ok := HashStoreOf(repo)
+		if !ok {
+			t.Fatal("HashStoreOf: the repository stores no hashes")
+		}
+		id := SimpleIdentifier("profile:1")
+		if err := hashes.HashSet(ctx, id, "name", "ann"); err != nil {
+			t.Fatalf("HashSet: %v", err)
+		}
+		if err := hashes.HashSet(ctx, id, "address", map[string]string{"city": "Berlin"}); err != nil {
+			t.Fatalf("HashSet: %v", err)
+		}
+
+		var name string
+		if err := hashes.HashGet(ctx, id, "name", &name); err != nil || name != "ann" {
+			t.Errorf("HashGet(name): got %q, %v, want \"ann\"", name, err)
+		}
+		var address struct{ City string }
+		if err := hashes.HashGet(ctx, id, "address", &address); err != nil || address.City != "Berlin" {
+			t.Errorf("HashGet(address): got %+v, %v, want Berlin", address, err)
+		}
+
+		// Updating one field leaves the other alone
+		if err := hashes.HashSet(ctx, id, "name", "bob"); err != nil {
+			t.Fatalf("HashSet: %v", err)
+		}
+		all, err := hashes.HashGetAll(ctx, id)
+		if err != nil {
+			t.Fatalf("HashGetAll: %v", err)
+		}
+		want := map[string]interface{}{"name": "bob", "address": map[string]interface{}{"city": "Berlin"}}
+		if !reflect.DeepEqual(all, want) {
+			t.Errorf("HashGetAll: got %v, want %v", all, want)
+		}
+
+		if err := hashes.HashGet(ctx, id, "email", &name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("HashGet of a missing field: got %v, want ErrNotFound", err)
+		}
+		if err := hashes.HashGet(ctx, SimpleIdentifier("profile:missing"), "name", &name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("HashGet of a missing hash: got %v, want ErrNotFound", err)
+		}
+
+		if err := hashes.HashDelete(ctx, id, "email"); err != nil {
+			t.Errorf("HashDelete of a missing field: %v", err)
+		}
+		if err := hashes.HashDelete(ctx, id, "name"); err != nil {
+			t.Fatalf("HashDelete: %v", err)
+		}
+		if err := hashes.HashGet(ctx, id, "name", &name); !errors.Is(err, ErrNotFound) {
+			t.Errorf("HashGet of a deleted field: got %v, want ErrNotFound", err)
+		}
+		// Deleting the last field deletes the hash
+		if err := hashes.HashDelete(ctx, id, "address"); err != nil {
+			t.Fatalf("HashDelete: %v", err)
+		}
+		if exists, err := repo.Exists(ctx, id); err != nil || exists {
+			t.Errorf("Exists of the emptied hash: got %v, %v, want false", exists, err)
+		}
+
+		if err := hashes.HashSet(ctx, id, "name", nil); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("HashSet of nil: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := hashes.HashSet(ctx, SimpleIdentifier("user:1"), "name", "bob"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("HashSet on a document: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
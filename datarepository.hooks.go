@@ -0,0 +1,525 @@
+// datarepository.hooks.go
+
+package datarepository
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// OperationHook is called by a HookedRepository after each operation with the operation's name,
+// the identifier it was called with (nil for operations on patterns, batches or channels),
+// its duration and the error it returned. Hooks must be safe for concurrent use.
+type OperationHook func(op Operation, identifier EntityIdentifier, duration time.Duration, err error)
+
+// HookedRepository wraps a DataRepository and calls its hooks after every operation, e.g. to
+// record metrics or traces. The hooks run after the wrapped operation has returned, so they never
+// run while the wrapped repository holds a lock. Ping, Close and the plugin methods are passed
+// through without calling the hooks.
+type HookedRepository struct {
+	inner DataRepository
+	hooks []OperationHook
+	// deferred collects the operations of a transaction, set on the repository passed to a
+	// WithTransaction function
+	deferred *hookEvents
+}
+
+// hookEvent is an observed operation whose hooks are called later
+type hookEvent struct {
+	op         Operation
+	identifier EntityIdentifier
+	duration   time.Duration
+	err        error
+}
+
+// hookEvents collects the operations observed within a transaction
+type hookEvents struct {
+	mu     sync.Mutex
+	events []hookEvent
+}
+
+var _ DataRepository = (*HookedRepository)(nil)
+
+// NewHookedRepository wraps inner so that the given hooks are called, in order, after each operation
+func NewHookedRepository(inner DataRepository, hooks ...OperationHook) *HookedRepository {
+	return &HookedRepository{inner: inner, hooks: hooks}
+}
+
+// Unwrap returns the wrapped repository
+func (r *HookedRepository) Unwrap() DataRepository {
+	return r.inner
+}
+
+// observe calls the hooks for an operation that started at start. Within a transaction, the
+// operation is recorded instead, so its hooks run once the transaction is over.
+func (r *HookedRepository) observe(op Operation, identifier EntityIdentifier, start time.Time, err error) {
+	event := hookEvent{op: op, identifier: identifier, duration: time.Since(start), err: err}
+	if r.deferred != nil {
+		r.deferred.mu.Lock()
+		r.deferred.events = append(r.deferred.events, event)
+		r.deferred.mu.Unlock()
+		return
+	}
+	r.call(event)
+}
+
+func (r *HookedRepository) call(event hookEvent) {
+	for _, hook := range r.hooks {
+		hook(event.op, event.identifier, event.duration, event.err)
+	}
+}
+
+func (r *HookedRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	start := time.Now()
+	err := r.inner.Create(ctx, identifier, value)
+	r.observe(OpCreate, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	start := time.Now()
+	identifier, err := r.inner.CreateWithGeneratedID(ctx, entityPrefix, value)
+	r.observe(OpCreateWithGeneratedID, identifier, start, err)
+	return identifier, err
+}
+
+func (r *HookedRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	start := time.Now()
+	created, err := r.inner.CreateIfAbsent(ctx, identifier, value, ttl)
+	r.observe(OpCreateIfAbsent, identifier, start, err)
+	return created, err
+}
+
+func (r *HookedRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := r.inner.CreateWithTTL(ctx, identifier, value, ttl)
+	r.observe(OpCreateWithTTL, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	start := time.Now()
+	err := r.inner.Read(ctx, identifier, value)
+	r.observe(OpRead, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := r.inner.ReadWithTTL(ctx, identifier, value)
+	r.observe(OpReadWithTTL, identifier, start, err)
+	return ttl, err
+}
+
+func (r *HookedRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	start := time.Now()
+	ok, err := r.inner.Exists(ctx, identifier)
+	r.observe(OpExists, identifier, start, err)
+	return ok, err
+}
+
+func (r *HookedRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	start := time.Now()
+	result, err := r.inner.ExistsMany(ctx, identifiers)
+	r.observe(OpExistsMany, nil, start, err)
+	return result, err
+}
+
+func (r *HookedRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	start := time.Now()
+	err := r.inner.Upsert(ctx, identifier, value)
+	r.observe(OpUpsert, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := r.inner.UpsertWithTTL(ctx, identifier, value, ttl)
+	r.observe(OpUpsertWithTTL, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	start := time.Now()
+	err := r.inner.UpsertManyWithTTL(ctx, items, ttl)
+	r.observe(OpUpsertManyWithTTL, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	start := time.Now()
+	err := r.inner.Update(ctx, identifier, value)
+	r.observe(OpUpdate, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	start := time.Now()
+	err := r.inner.UpdateField(ctx, identifier, path, value)
+	r.observe(OpUpdateField, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	start := time.Now()
+	ok, err := r.inner.CompareAndSwap(ctx, identifier, expected, newValue)
+	r.observe(OpCompareAndSwap, identifier, start, err)
+	return ok, err
+}
+
+func (r *HookedRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	start := time.Now()
+	newVersion, err := r.inner.UpdateWithVersion(ctx, identifier, value, expectedVersion)
+	r.observe(OpUpdateWithVersion, identifier, start, err)
+	return newVersion, err
+}
+
+func (r *HookedRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	start := time.Now()
+	version, err := r.inner.GetVersion(ctx, identifier)
+	r.observe(OpGetVersion, identifier, start, err)
+	return version, err
+}
+
+func (r *HookedRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	start := time.Now()
+	err := r.inner.ReadField(ctx, identifier, path, value)
+	r.observe(OpReadField, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	start := time.Now()
+	err := r.inner.Delete(ctx, identifier)
+	r.observe(OpDelete, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	start := time.Now()
+	err := r.inner.GetAndDelete(ctx, identifier, value)
+	r.observe(OpGetAndDelete, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	start := time.Now()
+	err := r.inner.GetAndSet(ctx, identifier, newValue, oldValue)
+	r.observe(OpGetAndSet, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	start := time.Now()
+	err := r.inner.CreateMany(ctx, items)
+	r.observe(OpCreateMany, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	start := time.Now()
+	err := r.inner.ReadMany(ctx, identifiers, fn)
+	r.observe(OpReadMany, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	start := time.Now()
+	err := r.inner.ReadManyOrdered(ctx, identifiers, dest)
+	r.observe(OpReadManyOrdered, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	start := time.Now()
+	err := r.inner.DeleteMany(ctx, identifiers)
+	r.observe(OpDeleteMany, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	start := time.Now()
+	deleted, err := r.inner.DeletePattern(ctx, pattern)
+	r.observe(OpDeletePattern, pattern, start, err)
+	return deleted, err
+}
+
+func (r *HookedRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	start := time.Now()
+	identifiers, entities, err := r.inner.List(ctx, pattern)
+	r.observe(OpList, nil, start, err)
+	return identifiers, entities, err
+}
+
+func (r *HookedRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	start := time.Now()
+	result, err := r.inner.ListDetailed(ctx, pattern)
+	r.observe(OpListDetailed, nil, start, err)
+	return result, err
+}
+
+func (r *HookedRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	start := time.Now()
+	identifiers, entities, nextCursor, err := r.inner.ListPaged(ctx, pattern, cursor, pageSize)
+	r.observe(OpListPaged, nil, start, err)
+	return identifiers, entities, nextCursor, err
+}
+
+func (r *HookedRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	start := time.Now()
+	identifiers, nextCursor, err := r.inner.ListPage(ctx, pattern, cursor, pageSize)
+	r.observe(OpListPage, nil, start, err)
+	return identifiers, nextCursor, err
+}
+
+func (r *HookedRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	start := time.Now()
+	count, err := r.inner.Count(ctx, pattern)
+	r.observe(OpCount, pattern, start, err)
+	return count, err
+}
+
+func (r *HookedRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	start := time.Now()
+	err := r.inner.Iterate(ctx, pattern, fn)
+	r.observe(OpIterate, pattern, start, err)
+	return err
+}
+
+func (r *HookedRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	start := time.Now()
+	prefixes, err := r.inner.EntityPrefixes(ctx)
+	r.observe(OpEntityPrefixes, nil, start, err)
+	return prefixes, err
+}
+
+func (r *HookedRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *HookedRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	start := time.Now()
+	identifiers, err := r.inner.Search(ctx, query, offset, limit, sortBy, sortDir)
+	r.observe(OpSearch, nil, start, err)
+	return identifiers, err
+}
+
+func (r *HookedRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	start := time.Now()
+	result, err := r.inner.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+	r.observe(OpSearchDetailed, nil, start, err)
+	return result, err
+}
+
+func (r *HookedRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	start := time.Now()
+	response, err := r.inner.SearchResults(ctx, query, opts)
+	r.observe(OpSearchResults, nil, start, err)
+	return response, err
+}
+
+func (r *HookedRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	start := time.Now()
+	response, err := r.inner.SearchQuery(ctx, query, opts)
+	r.observe(OpSearchQuery, nil, start, err)
+	return response, err
+}
+
+func (r *HookedRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := r.inner.AcquireLock(ctx, identifier, ttl)
+	r.observe(OpAcquireLock, identifier, start, err)
+	return ok, err
+}
+
+func (r *HookedRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	start := time.Now()
+	token, ok, err := r.inner.AcquireLockWithToken(ctx, identifier, ttl)
+	r.observe(OpAcquireLockWithToken, identifier, start, err)
+	return token, ok, err
+}
+
+func (r *HookedRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	start := time.Now()
+	err := r.inner.ReleaseLock(ctx, identifier)
+	r.observe(OpReleaseLock, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	start := time.Now()
+	err := r.inner.ReleaseLockWithToken(ctx, identifier, token)
+	r.observe(OpReleaseLockWithToken, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	start := time.Now()
+	ok, err := r.inner.RenewLock(ctx, identifier, token, ttl)
+	r.observe(OpRenewLock, identifier, start, err)
+	return ok, err
+}
+
+func (r *HookedRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	start := time.Now()
+	err := r.inner.Publish(ctx, channel, message)
+	r.observe(OpPublish, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	start := time.Now()
+	ch, err := r.inner.Subscribe(ctx, channel)
+	r.observe(OpSubscribe, nil, start, err)
+	return ch, err
+}
+
+func (r *HookedRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	start := time.Now()
+	sub, err := r.inner.SubscribeMessages(ctx, channel)
+	r.observe(OpSubscribeMessages, nil, start, err)
+	return sub, err
+}
+
+func (r *HookedRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	start := time.Now()
+	sub, err := r.inner.PSubscribe(ctx, pattern)
+	r.observe(OpPSubscribe, nil, start, err)
+	return sub, err
+}
+
+func (r *HookedRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	start := time.Now()
+	err := r.inner.SetExpiration(ctx, identifier, expiration)
+	r.observe(OpSetExpiration, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	start := time.Now()
+	ok, err := r.inner.SetExpirationCond(ctx, identifier, expiration, cond)
+	r.observe(OpSetExpirationCond, identifier, start, err)
+	return ok, err
+}
+
+func (r *HookedRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	start := time.Now()
+	err := r.inner.SetExpirationMany(ctx, identifiers, expiration)
+	r.observe(OpSetExpirationMany, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	start := time.Now()
+	ttl, err := r.inner.GetExpiration(ctx, identifier)
+	r.observe(OpGetExpiration, identifier, start, err)
+	return ttl, err
+}
+
+func (r *HookedRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	start := time.Now()
+	err := r.inner.Persist(ctx, identifier)
+	r.observe(OpPersist, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	start := time.Now()
+	err := r.inner.Touch(ctx, identifier)
+	r.observe(OpTouch, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	start := time.Now()
+	value, err := r.inner.AtomicIncrement(ctx, identifier)
+	r.observe(OpAtomicIncrement, identifier, start, err)
+	return value, err
+}
+
+func (r *HookedRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	start := time.Now()
+	value, err := r.inner.IncrementBy(ctx, identifier, delta)
+	r.observe(OpIncrementBy, identifier, start, err)
+	return value, err
+}
+
+func (r *HookedRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	start := time.Now()
+	value, err := r.inner.DecrementBy(ctx, identifier, delta)
+	r.observe(OpDecrementBy, identifier, start, err)
+	return value, err
+}
+
+func (r *HookedRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	start := time.Now()
+	value, ok, err := r.inner.IncrementWithLimit(ctx, identifier, delta, max)
+	r.observe(OpIncrementWithLimit, identifier, start, err)
+	return value, ok, err
+}
+
+func (r *HookedRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	start := time.Now()
+	value, err := r.inner.IncrementWithExpiry(ctx, identifier, delta, ttl)
+	r.observe(OpIncrementWithExpiry, identifier, start, err)
+	return value, err
+}
+
+func (r *HookedRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	start := time.Now()
+	value, err := r.inner.IncrementFloat(ctx, identifier, delta)
+	r.observe(OpIncrementFloat, identifier, start, err)
+	return value, err
+}
+
+func (r *HookedRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	start := time.Now()
+	value, err := r.inner.GetCounter(ctx, identifier)
+	r.observe(OpGetCounter, identifier, start, err)
+	return value, err
+}
+
+func (r *HookedRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	start := time.Now()
+	err := r.inner.SetCounter(ctx, identifier, value)
+	r.observe(OpSetCounter, identifier, start, err)
+	return err
+}
+
+func (r *HookedRepository) Ping(ctx context.Context) error {
+	return r.inner.Ping(ctx)
+}
+
+func (r *HookedRepository) Close() error {
+	return r.inner.Close()
+}
+
+// WithTransaction passes fn a transaction that observes each operation with the same hooks.
+// As some repositories hold a lock while fn runs, the hooks of these operations are only called
+// once the transaction is over, followed by those of the transaction as a whole.
+func (r *HookedRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	deferred := r.deferred
+	if deferred == nil {
+		deferred = &hookEvents{}
+	}
+	start := time.Now()
+	err := r.inner.WithTransaction(ctx, func(tx DataRepository) error {
+		return fn(&HookedRepository{inner: tx, hooks: r.hooks, deferred: deferred})
+	})
+	if r.deferred == nil {
+		for _, event := range deferred.events {
+			r.call(event)
+		}
+	}
+	r.observe(OpWithTransaction, nil, start, err)
+	return err
+}
+
+func (r *HookedRepository) RegisterPlugin(plugin RepositoryPlugin) error {
+	return r.inner.RegisterPlugin(plugin)
+}
+
+func (r *HookedRepository) GetPlugin(name string) (RepositoryPlugin, bool) {
+	return r.inner.GetPlugin(name)
+}
@@ -0,0 +1,52 @@
+// datarepository.hooks_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestHookedRepositoryCallsHooks(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, inner DataRepository) {
+		ctx := context.Background()
+		var calls []string
+		var errs []error
+		repo := NewHookedRepository(inner, func(op Operation, identifier EntityIdentifier, duration time.Duration, err error) {
+			// Hooks run after the operation has returned, so the repository may be used again here
+			if _, existsErr := inner.Exists(ctx, SimpleIdentifier("user:1")); existsErr != nil {
+				t.Errorf("Exists within a hook: %v", existsErr)
+			}
+			calls = append(calls, fmt.Sprintf("%s %v", op, identifier))
+			errs = append(errs, err)
+		})
+
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		var value map[string]string
+		if err := repo.Read(ctx, SimpleIdentifier("user:2"), &value); !errors.Is(err, ErrNotFound) {
+			t.Fatalf("Read of a missing entity: got %v, want ErrNotFound", err)
+		}
+		if _, _, err := repo.List(ctx, testListPattern(inner, "user:*")); err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		err := repo.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.Upsert(ctx, SimpleIdentifier("user:3"), map[string]string{"name": "bob"})
+		})
+		if err != nil {
+			t.Fatalf("WithTransaction: %v", err)
+		}
+
+		want := "[Create user:1 Read user:2 List <nil> Upsert user:3 WithTransaction <nil>]"
+		if fmt.Sprint(calls) != want {
+			t.Errorf("hook calls: got %v, want %s", calls, want)
+		}
+		if len(errs) != 5 || errs[0] != nil || !errors.Is(errs[1], ErrNotFound) || errs[2] != nil {
+			t.Errorf("hook errors: got %v, want ErrNotFound for Read only", errs)
+		}
+	})
+}
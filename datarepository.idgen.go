@@ -0,0 +1,244 @@
+// datarepository.idgen.go
+
+package datarepository
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	// MaxGeneratedIDAttempts is the number of times CreateWithGeneratedID retries on an id collision
+	MaxGeneratedIDAttempts = 3
+
+	snowflakeNodeBits     = 10
+	snowflakeSequenceBits = 12
+	snowflakeMaxNodeID    = (1 << snowflakeNodeBits) - 1
+	snowflakeMaxSequence  = (1 << snowflakeSequenceBits) - 1
+)
+
+// crockfordAlphabet is the Crockford base32 alphabet ULIDs are encoded with
+const crockfordAlphabet = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// snowflakeEpoch is the custom epoch (2024-01-01T00:00:00Z) used by SnowflakeGenerator, in milliseconds
+var snowflakeEpoch = time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC).UnixMilli()
+
+// IDGenerator generates ids for entities created via CreateWithGeneratedID
+type IDGenerator interface {
+	// Generate returns a new id for an entity with the given entity prefix.
+	// The entity prefix is informational; the built-in generators ignore it.
+	Generate(entityPrefix string) string
+}
+
+// ContextIDGenerator is an IDGenerator that draws ids from an external source, which needs a
+// context and may fail. CreateWithGeneratedID uses GenerateContext if the generator has it.
+type ContextIDGenerator interface {
+	IDGenerator
+	// GenerateContext returns a new id for an entity with the given entity prefix
+	GenerateContext(ctx context.Context, entityPrefix string) (string, error)
+}
+
+// UUIDv4Generator generates random (version 4) UUIDs
+type UUIDv4Generator struct{}
+
+// Generate returns a new random UUID
+func (g UUIDv4Generator) Generate(entityPrefix string) string {
+	var b [16]byte
+	mustReadRandom(b[:])
+	b[6] = (b[6] & 0x0f) | 0x40 // version 4
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return formatUUID(b)
+}
+
+// UUIDv7Generator generates time-ordered (version 7) UUIDs
+type UUIDv7Generator struct{}
+
+// Generate returns a new time-ordered UUID
+func (g UUIDv7Generator) Generate(entityPrefix string) string {
+	var b [16]byte
+	mustReadRandom(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	b[6] = (b[6] & 0x0f) | 0x70 // version 7
+	b[8] = (b[8] & 0x3f) | 0x80 // RFC 4122 variant
+	return formatUUID(b)
+}
+
+// ULIDGenerator generates ULIDs: 26 characters of Crockford base32 encoding a millisecond
+// timestamp and 80 random bits, which sort lexicographically by creation time
+type ULIDGenerator struct{}
+
+// Generate returns a new ULID
+func (g ULIDGenerator) Generate(entityPrefix string) string {
+	var b [16]byte
+	mustReadRandom(b[6:])
+	ms := uint64(time.Now().UnixMilli())
+	b[0] = byte(ms >> 40)
+	b[1] = byte(ms >> 32)
+	b[2] = byte(ms >> 24)
+	b[3] = byte(ms >> 16)
+	b[4] = byte(ms >> 8)
+	b[5] = byte(ms)
+	return formatULID(b)
+}
+
+// SnowflakeGenerator generates 64-bit, roughly time-ordered ids composed of a
+// millisecond timestamp, a node id and a per-millisecond sequence number
+type SnowflakeGenerator struct {
+	mu       sync.Mutex
+	nodeID   int64
+	lastMs   int64
+	sequence int64
+}
+
+// NewSnowflakeGenerator creates a SnowflakeGenerator for the given node id (0-1023)
+func NewSnowflakeGenerator(nodeID int64) (*SnowflakeGenerator, error) {
+	if nodeID < 0 || nodeID > snowflakeMaxNodeID {
+		return nil, fmt.Errorf("%w: snowflake node id must be between 0 and %d", ErrInvalidInput, snowflakeMaxNodeID)
+	}
+	return &SnowflakeGenerator{nodeID: nodeID}, nil
+}
+
+// Generate returns the next snowflake id as a decimal string
+func (g *SnowflakeGenerator) Generate(entityPrefix string) string {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	now := time.Now().UnixMilli() - snowflakeEpoch
+	if now < g.lastMs {
+		// Clock moved backwards; keep issuing ids from the last known millisecond
+		now = g.lastMs
+	}
+	if now == g.lastMs {
+		g.sequence = (g.sequence + 1) & snowflakeMaxSequence
+		if g.sequence == 0 {
+			// Sequence exhausted for this millisecond, wait for the next one
+			for now <= g.lastMs {
+				time.Sleep(100 * time.Microsecond)
+				now = time.Now().UnixMilli() - snowflakeEpoch
+			}
+		}
+	} else {
+		g.sequence = 0
+	}
+	g.lastMs = now
+
+	id := (now << (snowflakeNodeBits + snowflakeSequenceBits)) | (g.nodeID << snowflakeSequenceBits) | g.sequence
+	return strconv.FormatInt(id, 10)
+}
+
+// RedisSequenceGenerator generates sequential ids per entity prefix with Redis' INCR, so the
+// first entity of a prefix gets the id "1", the next one "2" and so on, across all processes
+// sharing the Redis server
+type RedisSequenceGenerator struct {
+	client    redis.UniversalClient
+	keyPrefix string
+}
+
+// NewRedisSequenceGenerator creates a RedisSequenceGenerator that keeps the sequence of each
+// entity prefix in the key keyPrefix:entityPrefix. Use a key prefix other than the one of a
+// Redis repository, so that its lists don't include the sequences.
+func NewRedisSequenceGenerator(client redis.UniversalClient, keyPrefix string) (*RedisSequenceGenerator, error) {
+	if client == nil {
+		return nil, fmt.Errorf("%w: redis sequence generator needs a client", ErrInvalidInput)
+	}
+	if keyPrefix == "" {
+		return nil, fmt.Errorf("%w: redis sequence generator needs a key prefix", ErrInvalidInput)
+	}
+	return &RedisSequenceGenerator{client: client, keyPrefix: keyPrefix}, nil
+}
+
+// Generate returns the next id of the entity prefix, or "" if Redis can't be reached, which
+// fails the create. CreateWithGeneratedID calls GenerateContext instead, which reports the error.
+func (g *RedisSequenceGenerator) Generate(entityPrefix string) string {
+	id, _ := g.GenerateContext(context.Background(), entityPrefix)
+	return id
+}
+
+// GenerateContext increments the sequence of the entity prefix and returns its new value
+func (g *RedisSequenceGenerator) GenerateContext(ctx context.Context, entityPrefix string) (string, error) {
+	next, err := g.client.Incr(ctx, g.keyPrefix+DefaultKeySeparator+entityPrefix).Result()
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return strconv.FormatInt(next, 10), nil
+}
+
+func mustReadRandom(b []byte) {
+	if _, err := rand.Read(b); err != nil {
+		panic(fmt.Sprintf("datarepository: failed to read random bytes: %v", err))
+	}
+}
+
+func formatUUID(b [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], b[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], b[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], b[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], b[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], b[10:])
+	return string(buf[:])
+}
+
+// formatULID encodes 16 bytes as 26 characters of Crockford base32, 5 bits each, starting with
+// the 3 most significant bits
+func formatULID(b [16]byte) string {
+	hi, lo := binary.BigEndian.Uint64(b[:8]), binary.BigEndian.Uint64(b[8:])
+	var buf [26]byte
+	for i := len(buf) - 1; i >= 0; i-- {
+		buf[i] = crockfordAlphabet[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(buf[:])
+}
+
+// generateID returns a new id from the generator, with GenerateContext if it has it
+func generateID(ctx context.Context, generator IDGenerator, entityPrefix string) (string, error) {
+	if contextGenerator, ok := generator.(ContextIDGenerator); ok {
+		return contextGenerator.GenerateContext(ctx, entityPrefix)
+	}
+	return generator.Generate(entityPrefix), nil
+}
+
+// CreateWithGeneratedID generates an id, builds the identifier and creates the entity,
+// retrying with a fresh id when the generated one already exists
+func CreateWithGeneratedID(ctx context.Context, repo DataRepository, generator IDGenerator, entityPrefix string, value interface{}, newIdentifier func(entityPrefix, id string) EntityIdentifier) (EntityIdentifier, error) {
+	if generator == nil {
+		generator = UUIDv4Generator{}
+	}
+	var err error
+	for attempt := 0; attempt < MaxGeneratedIDAttempts; attempt++ {
+		var id string
+		id, err = generateID(ctx, generator, entityPrefix)
+		if err != nil {
+			return nil, err
+		}
+		identifier := newIdentifier(entityPrefix, id)
+		err = repo.Create(ctx, identifier, value)
+		if err == nil {
+			return identifier, nil
+		}
+		if !IsAlreadyExistsError(err) {
+			return nil, err
+		}
+	}
+	return nil, fmt.Errorf("%w: could not generate a unique id after %d attempts: %v", ErrOperationFailed, MaxGeneratedIDAttempts, err)
+}
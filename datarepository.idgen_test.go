@@ -0,0 +1,104 @@
+// datarepository.idgen_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	"github.com/redis/go-redis/v9"
+)
+
+// fixedIDGenerator returns its ids in order
+type fixedIDGenerator struct {
+	ids []string
+}
+
+func (g *fixedIDGenerator) Generate(entityPrefix string) string {
+	id := g.ids[0]
+	g.ids = g.ids[1:]
+	return id
+}
+
+func TestCreateWithGeneratedID(t *testing.T) {
+	sequenceServer := miniredis.RunT(t)
+	sequenceClient := redis.NewClient(&redis.Options{Addr: sequenceServer.Addr()})
+	defer sequenceClient.Close()
+	sequence, err := NewRedisSequenceGenerator(sequenceClient, "seq")
+	if err != nil {
+		t.Fatalf("NewRedisSequenceGenerator: %v", err)
+	}
+	snowflake, err := NewSnowflakeGenerator(1)
+	if err != nil {
+		t.Fatalf("NewSnowflakeGenerator: %v", err)
+	}
+
+	for name, generator := range map[string]IDGenerator{
+		"uuidv4":    UUIDv4Generator{},
+		"uuidv7":    UUIDv7Generator{},
+		"ulid":      ULIDGenerator{},
+		"snowflake": snowflake,
+		"sequence":  sequence,
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			redisRepo, _ := newTestRedisRepository(t, RedisConfig{IDGenerator: generator})
+			memory := newTestMemoryRepository(t, MemoryConfig{IDGenerator: generator})
+			for backend, repo := range map[string]DataRepository{"memory": memory, "redis": redisRepo} {
+				first, err := repo.CreateWithGeneratedID(ctx, "user", map[string]string{"name": "ann"})
+				if err != nil {
+					t.Fatalf("%s: CreateWithGeneratedID: %v", backend, err)
+				}
+				second, err := repo.CreateWithGeneratedID(ctx, "user", map[string]string{"name": "bob"})
+				if err != nil {
+					t.Fatalf("%s: CreateWithGeneratedID: %v", backend, err)
+				}
+				if first.String() == second.String() {
+					t.Errorf("%s: both entities got the id %v", backend, first)
+				}
+				for identifier, want := range map[EntityIdentifier]string{first: "ann", second: "bob"} {
+					var value map[string]string
+					if err := repo.Read(ctx, identifier, &value); err != nil || value["name"] != want {
+						t.Errorf("%s: Read %v: got %v, %v, want %s", backend, identifier, value, err, want)
+					}
+				}
+			}
+		})
+	}
+}
+
+func TestCreateWithGeneratedIDRetriesOnCollision(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		generator := &fixedIDGenerator{ids: []string{"1", "2"}}
+		identifier, err := CreateWithGeneratedID(ctx, repo, generator, "user", map[string]string{"name": "bob"}, func(entityPrefix, id string) EntityIdentifier {
+			return SimpleIdentifier(entityPrefix + DefaultKeySeparator + id)
+		})
+		if err != nil || identifier.String() != "user:2" {
+			t.Fatalf("CreateWithGeneratedID: got %v, %v, want user:2", identifier, err)
+		}
+		var value map[string]string
+		if err := repo.Read(ctx, SimpleIdentifier("user:1"), &value); err != nil || value["name"] != "ann" {
+			t.Errorf("Read of the existing entity: got %v, %v, want it unchanged", value, err)
+		}
+	})
+}
+
+func TestCreateWithGeneratedIDRejectsInvalidEntityPrefix(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		for _, entityPrefix := range []string{"", "user:admin", "user*"} {
+			if _, err := repo.CreateWithGeneratedID(ctx, entityPrefix, "ann"); !errors.Is(err, ErrInvalidIdentifier) {
+				t.Errorf("CreateWithGeneratedID(%q): got %v, want ErrInvalidIdentifier", entityPrefix, err)
+			}
+		}
+		if count, err := repo.Count(ctx, SimpleIdentifier("*:*")); err != nil || count != 0 {
+			t.Errorf("Count: got %d, %v, want no entities", count, err)
+		}
+	})
+}
@@ -0,0 +1,55 @@
+// datarepository.idle.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// IdleExpirer is implemented by repositories that support sliding expiration, which lets an
+// entity expire after a period of inactivity rather than a fixed lifetime, e.g. a session.
+// Check for it with a type assertion, or use IdleExpirerOf, which also looks through wrapping
+// repositories.
+type IdleExpirer interface {
+	// SetIdleExpiration makes the entity expire once it hasn't been accessed for idle. Read,
+	// ReadWithTTL, ReadField, Update and UpdateField restart its expiration. A fixed expiration
+	// set later, e.g. by SetExpiration or UpsertWithTTL, ends the sliding expiration.
+	// Returns ErrNotFound if the entity doesn't exist and ErrInvalidInput if idle isn't positive.
+	SetIdleExpiration(ctx context.Context, identifier EntityIdentifier, idle time.Duration) error
+	// GetIdleExpiration returns the idle timeout of the entity, or 0 if its expiration doesn't
+	// slide. Returns ErrNotFound if the entity doesn't exist.
+	GetIdleExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error)
+}
+
+// IdleExpirerOf returns the IdleExpirer of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo doesn't support sliding expiration.
+// Reads served by a CachingRepository don't reach the wrapped repository and so don't restart
+// the expiration.
+func IdleExpirerOf(repo DataRepository) (IdleExpirer, bool) {
+	for {
+		switch r := repo.(type) {
+		case IdleExpirer:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := IdleExpirerOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedIdleExpirer{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// validateIdleExpiration checks the idle timeout passed to SetIdleExpiration
+func validateIdleExpiration(idle time.Duration) error {
+	if idle <= 0 {
+		return fmt.Errorf("%w: idle timeout must be positive", ErrInvalidInput)
+	}
+	return nil
+}
@@ -0,0 +1,85 @@
+// datarepository.keyevents.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+// EventType is the kind of change reported by SubscribeKeyspaceEvents
+type EventType string
+
+const (
+	// EventSet reports that an entity was created or its value was changed
+	EventSet EventType = "set"
+	// EventDel reports that an entity was deleted
+	EventDel EventType = "del"
+	// EventExpired reports that an expired entity was removed
+	EventExpired EventType = "expired"
+	// EventEvicted reports that an entity was evicted to free memory
+	EventEvicted EventType = "evicted"
+)
+
+// KeyEventBufferSize is the capacity of the channels returned by SubscribeKeyspaceEvents
+const KeyEventBufferSize = 100
+
+// KeyEvent is a change of an entity reported by SubscribeKeyspaceEvents
+type KeyEvent struct {
+	Type       EventType
+	Identifier EntityIdentifier
+}
+
+// KeyspaceNotifier is implemented by repositories that report changes of their entities, which
+// lets code react to writes made elsewhere without publishing events itself, e.g. to invalidate
+// caches. Check for it with a type assertion, or use KeyspaceNotifierOf, which also looks
+// through wrapping repositories.
+type KeyspaceNotifier interface {
+	// SubscribeKeyspaceEvents returns a channel that receives the changes of the entities
+	// matching the glob pattern, limited to the given event types or all if none are given.
+	// The channel is closed when ctx is done or the repository is closed. Events are delivered
+	// at most once; they are dropped while the channel is full.
+	// Returns ErrInvalidInput for an unknown event type.
+	SubscribeKeyspaceEvents(ctx context.Context, pattern EntityIdentifier, events ...EventType) (chan KeyEvent, error)
+}
+
+// KeyspaceNotifierOf returns the KeyspaceNotifier of repo, unwrapping repositories that wrap
+// others like HookedRepository or RetryRepository. Returns false if repo doesn't report changes.
+func KeyspaceNotifierOf(repo DataRepository) (KeyspaceNotifier, bool) {
+	for {
+		switch r := repo.(type) {
+		case KeyspaceNotifier:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := KeyspaceNotifierOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedKeyspaceNotifier{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// keyEventFilter reports whether an event type was requested
+type keyEventFilter map[EventType]bool
+
+// newKeyEventFilter returns the filter for the event types passed to SubscribeKeyspaceEvents
+func newKeyEventFilter(events []EventType) (keyEventFilter, error) {
+	filter := keyEventFilter{}
+	if len(events) == 0 {
+		events = []EventType{EventSet, EventDel, EventExpired, EventEvicted}
+	}
+	for _, event := range events {
+		switch event {
+		case EventSet, EventDel, EventExpired, EventEvicted:
+			filter[event] = true
+		default:
+			return nil, fmt.Errorf("%w: unknown event type %q", ErrInvalidInput, event)
+		}
+	}
+	return filter, nil
+}
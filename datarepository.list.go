@@ -0,0 +1,106 @@
+// datarepository.list.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+)
+
+// ListStore is implemented by repositories that store ordered lists under an identifier, e.g.
+// event logs, in addition to single values. Values are encoded with the repository's codec.
+// A list is an entity like any other: Exists, Delete and SetExpiration apply to it, and popping
+// its last value deletes it. Check for it with a type assertion, or use ListStoreOf, which also
+// looks through wrapping repositories.
+type ListStore interface {
+	// ListPush appends the values to the end of the list, which is created if it doesn't exist,
+	// and returns its new length. Returns ErrInvalidInput if a value is nil or the entity holds
+	// something other than a list.
+	ListPush(ctx context.Context, identifier EntityIdentifier, values ...interface{}) (int64, error)
+	// ListRange decodes the values from index start to stop, both included, into out, which must
+	// be a pointer to a slice. Negative indexes count from the end, -1 being the last value,
+	// and indexes beyond the end are clamped like Redis LRANGE does. A missing list is empty.
+	ListRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, out interface{}) error
+	// ListPop removes the first value of the list and decodes it into out.
+	// Returns ErrNotFound if the list doesn't exist.
+	ListPop(ctx context.Context, identifier EntityIdentifier, out interface{}) error
+	// ListLen returns the length of the list, which is 0 if it doesn't exist
+	ListLen(ctx context.Context, identifier EntityIdentifier) (int64, error)
+}
+
+// ListStoreOf returns the ListStore of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo doesn't store lists.
+func ListStoreOf(repo DataRepository) (ListStore, bool) {
+	for {
+		switch r := repo.(type) {
+		case ListStore:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := ListStoreOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedListStore{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// errNotAList is returned by list operations on an entity that holds something else
+var errNotAList = fmt.Errorf("%w: value is not a list", ErrInvalidInput)
+
+// listRangeBounds converts the start and stop indexes of ListRange, which may be negative, into
+// the bounds of a Go slice of length n. Returns false if the range is empty.
+func listRangeBounds(start, stop, n int64) (int64, int64, bool) {
+	if start < 0 {
+		start += n
+	}
+	if stop < 0 {
+		stop += n
+	}
+	if start < 0 {
+		start = 0
+	}
+	if stop >= n {
+		stop = n - 1
+	}
+	if start > stop {
+		return 0, 0, false
+	}
+	return start, stop + 1, true
+}
+
+// checkOut returns ErrInvalidInput unless out is a non-nil pointer. It is called before values
+// are removed, so that they aren't lost if they can't be decoded into out.
+func checkOut(out interface{}) error {
+	value := reflect.ValueOf(out)
+	if value.Kind() != reflect.Ptr || value.IsNil() {
+		return fmt.Errorf("%w: out must be a non-nil pointer", ErrInvalidInput)
+	}
+	return nil
+}
+
+// decodeSlice decodes the encoded values with codec into out, which must be a pointer to a
+// slice, replacing its elements
+func decodeSlice(codec Codec, encoded [][]byte, out interface{}) error {
+	outValue := reflect.ValueOf(out)
+	if outValue.Kind() != reflect.Ptr || outValue.IsNil() || outValue.Elem().Kind() != reflect.Slice {
+		return fmt.Errorf("%w: out must be a non-nil pointer to a slice", ErrInvalidInput)
+	}
+	sliceValue := outValue.Elem()
+	elemType := sliceValue.Type().Elem()
+	result := reflect.MakeSlice(sliceValue.Type(), len(encoded), len(encoded))
+	for i, data := range encoded {
+		elem := reflect.New(elemType)
+		if err := codec.Unmarshal(data, elem.Interface()); err != nil {
+			return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		result.Index(i).Set(elem.Elem())
+	}
+	sliceValue.Set(result)
+	return nil
+}
@@ -0,0 +1,92 @@
+// datarepository.list_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+type listTestEvent struct {
+	Kind string `json:"kind"`
+	Seq  int    `json:"seq"`
+}
+
+func TestListStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		lists, ok := ListStoreOf(repo)
+		if !ok {
+			t.Fatal("ListStoreOf: the repository stores no lists")
+		}
+		id := SimpleIdentifier("log:1")
+		if n, err := lists.ListPush(ctx, id, listTestEvent{"created", 1}, listTestEvent{"updated", 2}); err != nil || n != 2 {
+			t.Fatalf("ListPush: got %d, %v, want 2", n, err)
+		}
+		if n, err := lists.ListPush(ctx, id, listTestEvent{"deleted", 3}); err != nil || n != 3 {
+			t.Fatalf("ListPush: got %d, %v, want 3", n, err)
+		}
+		if n, err := lists.ListLen(ctx, id); err != nil || n != 3 {
+			t.Errorf("ListLen: got %d, %v, want 3", n, err)
+		}
+
+		for _, tc := range []struct {
+			start, stop int64
+			want        []int
+		}{
+			{0, -1, []int{1, 2, 3}},
+			{1, 1, []int{2}},
+			{-2, -1, []int{2, 3}},
+			{0, 100, []int{1, 2, 3}},
+			{2, 1, []int{}},
+		} {
+			var events []listTestEvent
+			if err := lists.ListRange(ctx, id, tc.start, tc.stop, &events); err != nil {
+				t.Errorf("ListRange(%d, %d): %v", tc.start, tc.stop, err)
+				continue
+			}
+			got := []int{}
+			for _, event := range events {
+				got = append(got, event.Seq)
+			}
+			if !reflect.DeepEqual(got, tc.want) {
+				t.Errorf("ListRange(%d, %d): got %v, want %v", tc.start, tc.stop, got, tc.want)
+			}
+		}
+
+		var first listTestEvent
+		if err := lists.ListPop(ctx, id, &first); err != nil || first != (listTestEvent{"created", 1}) {
+			t.Errorf("ListPop: got %+v, %v, want the first event", first, err)
+		}
+		if n, err := lists.ListLen(ctx, id); err != nil || n != 2 {
+			t.Errorf("ListLen after ListPop: got %d, %v, want 2", n, err)
+		}
+
+		// Popping the last value deletes the list
+		var event listTestEvent
+		_ = lists.ListPop(ctx, id, &event)
+		_ = lists.ListPop(ctx, id, &event)
+		if exists, err := repo.Exists(ctx, id); err != nil || exists {
+			t.Errorf("Exists of the emptied list: got %v, %v, want false", exists, err)
+		}
+		if err := lists.ListPop(ctx, id, &event); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ListPop of a missing list: got %v, want ErrNotFound", err)
+		}
+		var events []listTestEvent
+		if err := lists.ListRange(ctx, id, 0, -1, &events); err != nil || len(events) != 0 {
+			t.Errorf("ListRange of a missing list: got %v, %v, want none", events, err)
+		}
+
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := lists.ListPush(ctx, SimpleIdentifier("user:1"), "x"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ListPush to a document: got %v, want ErrInvalidInput", err)
+		}
+		if _, err := lists.ListPush(ctx, id, nil); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ListPush of nil: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
@@ -0,0 +1,169 @@
+// datarepository.memory.fieldindex.go
+
+package datarepository
+
+import (
+	"context"
+	"strings"
+)
+
+// memoryFieldIndex maps the values extracted from the stored documents to their keys and back
+type memoryFieldIndex struct {
+	extract FieldExtractor
+	keys    map[string]map[string]struct{} // indexed value -> keys
+	values  map[string]string              // key -> indexed value
+}
+
+func newMemoryFieldIndex(extract FieldExtractor) *memoryFieldIndex {
+	return &memoryFieldIndex{
+		extract: extract,
+		keys:    make(map[string]map[string]struct{}),
+		values:  make(map[string]string),
+	}
+}
+
+// set indexes the key under value, replacing its previous entry. An empty value removes the entry.
+func (idx *memoryFieldIndex) set(key, value string) {
+	if previous, exists := idx.values[key]; exists {
+		if previous == value {
+			return
+		}
+		delete(idx.keys[previous], key)
+		if len(idx.keys[previous]) == 0 {
+			delete(idx.keys, previous)
+		}
+		delete(idx.values, key)
+	}
+	if value == "" {
+		return
+	}
+	if idx.keys[value] == nil {
+		idx.keys[value] = make(map[string]struct{})
+	}
+	idx.keys[value][key] = struct{}{}
+	idx.values[key] = value
+}
+
+func (idx *memoryFieldIndex) clone() *memoryFieldIndex {
+	cloned := &memoryFieldIndex{
+		extract: idx.extract,
+		keys:    make(map[string]map[string]struct{}, len(idx.keys)),
+		values:  make(map[string]string, len(idx.values)),
+	}
+	for key, value := range idx.values {
+		cloned.set(key, value)
+	}
+	return cloned
+}
+
+var _ FieldIndexer = (*MemoryRepository)(nil)
+
+// CreateFieldIndex defines the index named field and indexes the documents already stored.
+// The extractor is called with the repository locked and must not use the repository.
+func (r *MemoryRepository) CreateFieldIndex(field string, extractor FieldExtractor) error {
+	if err := validateFieldIndex(field, extractor); err != nil {
+		return err
+	}
+	if r.txKeys != nil {
+		return ErrInTransaction
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	idx := newMemoryFieldIndex(extractor)
+	for key, value := range r.data {
+		idx.set(key, extractor(value))
+	}
+	if r.fieldIndexes == nil {
+		r.fieldIndexes = make(map[string]*memoryFieldIndex)
+	}
+	r.fieldIndexes[field] = idx
+	return nil
+}
+
+// FindByIndex returns the identifiers of the unexpired entities indexed under value
+func (r *MemoryRepository) FindByIndex(ctx context.Context, field, value string) ([]EntityIdentifier, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	idx, exists := r.fieldIndexes[field]
+	if !exists {
+		return nil, errUnknownFieldIndex(field)
+	}
+	identifiers := make([]EntityIdentifier, 0, len(idx.keys[value]))
+	for _, key := range sortedKeys(idx.keys[value]) {
+		if !r.isExpired(key) {
+			identifiers = append(identifiers, MemoryIdentifier(key))
+		}
+	}
+	return identifiers, nil
+}
+
+// reindexKey updates the index entries of the key after it was written or deleted.
+// Must be called with r.mu held.
+func (r *MemoryRepository) reindexKey(key string) {
+	if len(r.fieldIndexes) == 0 {
+		return
+	}
+	value, exists := r.data[key]
+	for _, idx := range r.fieldIndexes {
+		if exists {
+			idx.set(key, idx.extract(value))
+		} else {
+			idx.set(key, "")
+		}
+	}
+}
+
+// rebuildFieldIndexes indexes all stored documents anew after they were replaced.
+// Must be called with r.mu held.
+func (r *MemoryRepository) rebuildFieldIndexes() {
+	for field, idx := range r.fieldIndexes {
+		rebuilt := newMemoryFieldIndex(idx.extract)
+		for key, value := range r.data {
+			rebuilt.set(key, idx.extract(value))
+		}
+		r.fieldIndexes[field] = rebuilt
+	}
+}
+
+// cloneFieldIndexes copies the indexes for a transaction, which replaces them on commit
+func (r *MemoryRepository) cloneFieldIndexes() map[string]*memoryFieldIndex {
+	if r.fieldIndexes == nil {
+		return nil
+	}
+	cloned := make(map[string]*memoryFieldIndex, len(r.fieldIndexes))
+	for field, idx := range r.fieldIndexes {
+		cloned[field] = idx.clone()
+	}
+	return cloned
+}
+
+var _ FieldIndexer = (*memoryNamespace)(nil)
+
+// CreateFieldIndex defines the index on the repository, so it covers the documents of all
+// namespaces
+func (m *memoryNamespace) CreateFieldIndex(field string, extractor FieldExtractor) error {
+	return m.inner.CreateFieldIndex(field, extractor)
+}
+
+// FindByIndex returns the entities of the view's namespace indexed under value
+func (m *memoryNamespace) FindByIndex(ctx context.Context, field, value string) ([]EntityIdentifier, error) {
+	identifiers, err := m.inner.FindByIndex(ctx, field, value)
+	if err != nil {
+		return nil, err
+	}
+	scoped := make([]EntityIdentifier, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		if strings.HasPrefix(identifier.String(), m.prefix) {
+			scoped = append(scoped, m.unscope(identifier))
+		}
+	}
+	return scoped, nil
+}
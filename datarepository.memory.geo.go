@@ -0,0 +1,114 @@
+// datarepository.memory.geo.go
+
+package datarepository
+
+import (
+	"context"
+	"maps"
+	"sort"
+)
+
+// geoPosition is the position of a member of a geo set
+type geoPosition struct {
+	Longitude float64 `json:"lon"`
+	Latitude  float64 `json:"lat"`
+}
+
+// memoryGeoSet is the value of a geo set entity, the positions by member
+type memoryGeoSet map[string]geoPosition
+
+var _ GeoStore = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) GeoAdd(ctx context.Context, identifier EntityIdentifier, member string, lon, lat float64) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if err := checkGeoPosition(lon, lat); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	set, err := r.geoSetOf(key)
+	if err != nil {
+		return err
+	}
+	if set == nil {
+		set = memoryGeoSet{}
+	} else if r.txKeys != nil {
+		// Within a transaction the set is shared with the repository until the commit
+		set = maps.Clone(set)
+	}
+	set[member] = geoPosition{Longitude: lon, Latitude: lat}
+	r.data[key] = set
+	r.addKey(key)
+	return nil
+}
+
+// GeoRadius scans all members of the geo set and returns those within radius
+func (r *MemoryRepository) GeoRadius(ctx context.Context, identifier EntityIdentifier, lon, lat float64, radius float64, unit string) ([]GeoHit, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	meters, err := checkGeoQuery(lon, lat, radius, unit)
+	if err != nil {
+		return nil, err
+	}
+
+	key := identifier.String()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set, err := r.geoSetOf(key)
+	if err != nil {
+		return nil, err
+	}
+	if set != nil {
+		r.touchKey(key)
+	}
+	hits := []GeoHit{}
+	for member, position := range set {
+		distance := geoDistance(lon, lat, position.Longitude, position.Latitude) / meters
+		if distance <= radius {
+			hits = append(hits, GeoHit{Member: member, Distance: distance})
+		}
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Distance != hits[j].Distance {
+			return hits[i].Distance < hits[j].Distance
+		}
+		return hits[i].Member < hits[j].Member
+	})
+	return hits, nil
+}
+
+// geoSetOf returns the geo set stored under key, or nil if there is none or it expired.
+// Returns errNotAGeoSet if key holds another value. Requires at least r.mu's read lock.
+func (r *MemoryRepository) geoSetOf(key string) (memoryGeoSet, error) {
+	value, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return nil, nil
+	}
+	set, ok := value.(memoryGeoSet)
+	if !ok {
+		return nil, errNotAGeoSet
+	}
+	return set, nil
+}
+
+var _ GeoStore = (*memoryNamespace)(nil)
+
+func (m *memoryNamespace) GeoAdd(ctx context.Context, identifier EntityIdentifier, member string, lon, lat float64) error {
+	return m.inner.GeoAdd(ctx, m.scope(identifier), member, lon, lat)
+}
+
+func (m *memoryNamespace) GeoRadius(ctx context.Context, identifier EntityIdentifier, lon, lat float64, radius float64, unit string) ([]GeoHit, error) {
+	return m.inner.GeoRadius(ctx, m.scope(identifier), lon, lat, radius, unit)
+}
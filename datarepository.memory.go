@@ -5,17 +5,58 @@ package datarepository
 import (
 	"context"
 	"fmt"
+	"maps"
+	"math"
+	"reflect"
 	"regexp"
 	"sort"
 	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	nuts "github.com/vaudience/go-nuts"
 )
 
+const (
+	DefaultSweepBatchSize      = 1000
+	DefaultEagerSweepThreshold = 10000
+	DefaultCleanupInterval     = 1 * time.Minute
+)
+
 type MemoryConfig struct {
-	// Add any configuration options if needed
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator IDGenerator
+	// Codec serializes values returned as raw bytes, e.g. by ReadMany, and converts written
+	// values into the generic form in which they are stored. Defaults to JSONCodec.
+	Codec Codec
+	// SweepBatchSize is the maximum number of expired keys removed per write-lock acquisition
+	// while sweeping. Defaults to DefaultSweepBatchSize.
+	SweepBatchSize int
+	// EagerSweepThreshold triggers an out-of-band sweep once this many expirations have been
+	// added since the last sweep. Defaults to DefaultEagerSweepThreshold.
+	EagerSweepThreshold int
+	// CleanupInterval is the interval at which expired keys are swept in the background until
+	// Close is called. Defaults to DefaultCleanupInterval. A negative value disables the
+	// background sweep; expired keys are then only reclaimed by eager sweeps, but never returned.
+	CleanupInterval time.Duration
+	// OnSweep, if set, is called after each sweep with the number of reclaimed keys
+	OnSweep func(reclaimed int)
+	// NotFoundOnEmpty makes List, Search and SearchDetailed return ErrNotFound instead of an
+	// empty result when nothing matches
+	NotFoundOnEmpty bool
+	// MaxEntries limits the number of keys. Once it is exceeded, the least recently used keys
+	// are evicted. Zero means unbounded.
+	MaxEntries int
+	// OnEvict, if set, is called with each evicted key. It runs while the repository is locked
+	// and must not call the repository.
+	OnEvict func(key string)
+	// PersistPath, if set, is a snapshot file that is loaded by NewMemoryRepository (if it exists)
+	// and written by Close
+	PersistPath string
+	// Logger receives diagnostic messages, e.g. about entries skipped by List or Search.
+	// Defaults to a no-op logger.
+	Logger Logger
 	logger LogAdapter
 }
 
@@ -23,307 +64,2032 @@ func (c MemoryConfig) GetConnectionString() string {
 	return "memory://"
 }
 
+// Validate checks the config for values that have no meaning.
+// Returns ErrInvalidInput naming the offending field.
+func (c MemoryConfig) Validate() error {
+	if c.MaxEntries < 0 {
+		return InvalidConfig("MemoryConfig", "MaxEntries %d is negative", c.MaxEntries)
+	}
+	return nil
+}
+
 type MemoryIdentifier string
 
 func (mi MemoryIdentifier) String() string {
 	return string(mi)
 }
 
+// KeyFor returns the key the entity is stored under, which is the identifier's string form.
+// It never fails; the error matches RedisRepository.KeyFor.
+func (r *MemoryRepository) KeyFor(identifier EntityIdentifier) (string, error) {
+	return identifier.String(), nil
+}
+
+// memoryLock is a lock held in a MemoryRepository
+type memoryLock struct {
+	token  string
+	expiry time.Time
+}
+
+// memoryPatternSubscription is a SubscribeMessages or PSubscribe subscriber of a MemoryRepository
+type memoryPatternSubscription struct {
+	repo    *MemoryRepository
+	pattern *regexp.Regexp
+	ch      chan Message
+	done    chan struct{}
+	once    sync.Once
+}
+
+func (s *memoryPatternSubscription) Messages() <-chan Message {
+	return s.ch
+}
+
+// Close removes the subscriber from the repository and closes its channel
+func (s *memoryPatternSubscription) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.repo.mu.Lock()
+		defer s.repo.mu.Unlock()
+		for i, sub := range s.repo.psubs {
+			if sub == s {
+				// The channel is only closed here if MemoryRepository.Close hasn't done so already
+				s.repo.psubs = append(s.repo.psubs[:i], s.repo.psubs[i+1:]...)
+				close(s.ch)
+				break
+			}
+		}
+	})
+	return nil
+}
+
 type MemoryRepository struct {
 	BaseRepository
-	mu       sync.RWMutex
-	data     map[string]interface{}
-	locks    map[string]time.Time
-	channels map[string][]chan interface{}
-	expiries map[string]time.Time
-	logger   LogAdapter
+	mu              sync.RWMutex
+	data            map[string]interface{}
+	locks           map[string]memoryLock
+	channels        map[string][]chan interface{}
+	psubs           []*memoryPatternSubscription
+	keyEventSubs    []*memoryKeyEventSubscriber
+	keyWatchers     []*memoryKeyWatcher
+	expiries        map[string]time.Time
+	versions        map[string]int64         // versions maintained by UpdateWithVersion; absent means 0
+	idleTimeouts    map[string]time.Duration // set by SetIdleExpiration; reads restart the expiration
+	fieldIndexes    map[string]*memoryFieldIndex
+	idGen           IDGenerator
+	notFoundOnEmpty bool
+	codec           Codec
+	persistPath     string
+	logger          Logger
+	guard           *closeGuard // shared with the copies passed to WithTransaction functions
+
+	lru       *memoryLRU
+	onEvict   func(key string)
+	evictions uint64
+
+	// Set on the copy passed to a WithTransaction function: the keys written within the
+	// transaction and the messages to publish once it commits
+	txKeys  map[string]struct{}
+	pending []pendingMessage
+
+	cleanup             *nuts.GoInterval // nil if the background sweep is disabled
+	sweepBatchSize      int
+	eagerSweepThreshold int
+	onSweep             func(reclaimed int)
+	sweeping            int32
+	expiriesAtLastSweep int
 }
 
+var _ DataRepository = (*MemoryRepository)(nil)
+
 func NewMemoryRepository(config Config) (DataRepository, error) {
 	cfg, ok := config.(MemoryConfig)
 	if !ok {
-		return nil, fmt.Errorf("invalid config type for Memory repository")
+		return nil, fmt.Errorf("%w: Memory repository needs a MemoryConfig, got %T", ErrInvalidInput, config)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = UUIDv4Generator{}
+	}
+	if cfg.Codec == nil {
+		cfg.Codec = JSONCodec{}
 	}
-	if cfg.logger == nil {
-		cfg.logger = emptyLogger
+	if cfg.SweepBatchSize <= 0 {
+		cfg.SweepBatchSize = DefaultSweepBatchSize
+	}
+	if cfg.EagerSweepThreshold <= 0 {
+		cfg.EagerSweepThreshold = DefaultEagerSweepThreshold
+	}
+	if cfg.CleanupInterval == 0 {
+		cfg.CleanupInterval = DefaultCleanupInterval
 	}
 
 	repo := &MemoryRepository{
-		data:     make(map[string]interface{}),
-		locks:    make(map[string]time.Time),
-		channels: make(map[string][]chan interface{}),
-		logger:   cfg.logger,
+		data:                make(map[string]interface{}),
+		locks:               make(map[string]memoryLock),
+		channels:            make(map[string][]chan interface{}),
+		versions:            make(map[string]int64),
+		idGen:               cfg.IDGenerator,
+		codec:               cfg.Codec,
+		logger:              ResolveLogger(cfg.Logger, cfg.logger),
+		notFoundOnEmpty:     cfg.NotFoundOnEmpty,
+		sweepBatchSize:      cfg.SweepBatchSize,
+		eagerSweepThreshold: cfg.EagerSweepThreshold,
+		onSweep:             cfg.OnSweep,
+		persistPath:         cfg.PersistPath,
+		onEvict:             cfg.OnEvict,
+		guard:               newCloseGuard(),
+	}
+	if cfg.MaxEntries > 0 {
+		repo.lru = newMemoryLRU(cfg.MaxEntries)
+	}
+	if cfg.PersistPath != "" {
+		if err := repo.loadSnapshot(cfg.PersistPath); err != nil {
+			return nil, err
+		}
 	}
 
-	nuts.Interval(func() bool {
-		repo.cleanupExpired()
-		return true
-	}, 1*time.Minute, false)
+	if cfg.CleanupInterval > 0 {
+		repo.cleanup = nuts.Interval(func() bool {
+			repo.cleanupExpired()
+			return true
+		}, cfg.CleanupInterval, false)
+	}
 
 	return repo, nil
 }
 
 func (r *MemoryRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	value, err := r.toStored(value)
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
 	if _, exists := r.data[key]; exists {
 		return ErrAlreadyExists
 	}
 	r.data[key] = value
+	r.addKey(key)
 	return nil
 }
 
-func (r *MemoryRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	key := identifier.String()
-	expiry, exists := r.expiries[key]
-	if exists && time.Now().After(expiry) {
-		delete(r.data, key)
-		delete(r.expiries, key)
-		return ErrNotFound
+func (r *MemoryRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return false, err
 	}
-	data, exists := r.data[key]
-	if exists {
-		// Assuming value is a pointer to the correct type
-		*(value.(*interface{})) = data
-		return nil
+	defer r.leave()
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", ErrInvalidInput)
+	}
+	value, err := r.toStored(value)
+	if err != nil {
+		return false, err
 	}
-	return ErrNotFound
-}
 
-func (r *MemoryRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	key := identifier.String()
-	if _, exists := r.data[key]; !exists {
-		return ErrNotFound
+	if _, exists := r.data[key]; exists && !r.isExpired(key) {
+		return false, nil
 	}
+	// An expired entity that wasn't cleaned up yet doesn't pass its version or idle timeout on
+	delete(r.versions, key)
+	delete(r.idleTimeouts, key)
 	r.data[key] = value
-	return nil
+	if ttl > 0 {
+		if r.expiries == nil {
+			r.expiries = make(map[string]time.Time)
+		}
+		r.expiries[key] = time.Now().Add(ttl)
+		r.sweepIfGrown()
+	} else {
+		delete(r.expiries, key)
+	}
+	r.addKey(key)
+	return true, nil
 }
 
-func (r *MemoryRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *MemoryRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return CreateWithTTL(ctx, r, identifier, value, ttl)
+}
 
-	key := identifier.String()
-	r.data[key] = value
-	return nil
+func (r *MemoryRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	if !entityPrefixRegex.MatchString(entityPrefix) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, ErrInvalidEntityPrefix)
+	}
+	return CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) EntityIdentifier {
+		return MemoryIdentifier(entityPrefix + DefaultKeySeparator + id)
+	})
 }
 
-func (r *MemoryRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *MemoryRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
 
 	key := identifier.String()
-	if _, exists := r.data[key]; !exists {
+	r.mu.RLock()
+	if r.isExpired(key) {
+		r.mu.RUnlock()
+		// Deleting needs the write lock, which is only taken for keys that have expired
+		r.removeIfExpired(key)
 		return ErrNotFound
 	}
-	delete(r.data, key)
-	return nil
-}
-
-func (r *MemoryRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
-
-	regex, err := regexp.Compile(strings.ReplaceAll(pattern, "*", ".*"))
-	if err != nil {
-		return nil, nil, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	data, exists := r.data[key]
+	_, idle := r.idleTimeouts[key]
+	if exists {
+		r.touchKey(key)
 	}
+	r.mu.RUnlock()
 
-	var results []interface{}
-	var ids []EntityIdentifier
-	for key := range r.data {
-		if regex.MatchString(key) {
-			ids = append(ids, MemoryIdentifier(key))
-			entity := r.data[key]
-			results = append(results, entity)
-		}
+	if !exists {
+		return ErrNotFound
+	}
+	if idle {
+		r.renewIdle(key)
 	}
-	return ids, results, nil
+	return r.assignValue(data, value)
 }
 
-func (r *MemoryRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+func (r *MemoryRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
 
-	if offset < 0 || limit < 0 {
-		return nil, fmt.Errorf("%w: invalid offset or limit", ErrInvalidInput)
+	r.mu.RLock()
+	key := identifier.String()
+	data, exists := r.data[key]
+	idle, hasIdle := r.idleTimeouts[key]
+	ttl := NoExpiration
+	expired := false
+	if expiry, hasExpiry := r.expiries[key]; hasExpiry {
+		ttl = time.Until(expiry)
+		// Expired but not yet swept
+		expired = ttl <= 0
 	}
-	// This is a simple implementation. In a real-world scenario, you'd want to implement
-	// a more sophisticated search algorithm.
-	var result []EntityIdentifier
-	for key, value := range r.data {
-		if strings.Contains(fmt.Sprintf("%v", value), query) {
-			result = append(result, MemoryIdentifier(key))
-		}
+	if exists && !expired {
+		r.touchKey(key)
 	}
+	r.mu.RUnlock()
 
-	// Sort results
-	sort.Slice(result, func(i, j int) bool {
-		if sortDir == "DESC" {
-			i, j = j, i
-		}
-		return result[i].String() < result[j].String()
-	})
-
-	// Apply offset and limit
-	if offset >= len(result) {
-		return []EntityIdentifier{}, nil
+	if !exists || expired {
+		return 0, ErrNotFound
+	}
+	if hasIdle {
+		r.renewIdle(key)
+		ttl = idle
 	}
-	end := offset + limit
-	if end > len(result) {
-		end = len(result)
+	if err := r.assignValue(data, value); err != nil {
+		return 0, err
 	}
-	return result[offset:end], nil
+	return ttl, nil
 }
 
-func (r *MemoryRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *MemoryRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return false, err
+	}
+	defer r.leave()
 
 	key := identifier.String()
-	if lockTime, exists := r.locks[key]; exists && time.Now().Before(lockTime) {
+	r.mu.RLock()
+	_, exists := r.data[key]
+	expiry, hasExpiry := r.expiries[key]
+	r.mu.RUnlock()
+
+	if !exists {
+		return false, nil
+	}
+	if hasExpiry && time.Now().After(expiry) {
+		r.removeIfExpired(key)
 		return false, nil
 	}
-	r.locks[key] = time.Now().Add(ttl)
 	return true, nil
 }
 
-func (r *MemoryRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
-	r.mu.Lock()
-	defer r.mu.Unlock()
-
-	key := identifier.String()
-	if _, exists := r.locks[key]; !exists {
-		return ErrNotFound
+// ExistsMany checks all identifiers in a single pass under the read lock. Expired entities are
+// reported as absent and left for the janitor or the next access to remove.
+func (r *MemoryRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
 	}
-	delete(r.locks, key)
-	return nil
-}
+	defer r.leave()
+	result := make(map[EntityIdentifier]bool, len(identifiers))
 
-func (r *MemoryRepository) Publish(ctx context.Context, channel string, message interface{}) error {
 	r.mu.RLock()
 	defer r.mu.RUnlock()
 
-	if channels, exists := r.channels[channel]; exists {
-		for _, ch := range channels {
-			select {
-			case ch <- message:
-			default:
-				// Channel is full, skip this subscriber
-			}
+	now := time.Now()
+	for _, identifier := range identifiers {
+		key := identifier.String()
+		_, exists := r.data[key]
+		if expiry, hasExpiry := r.expiries[key]; hasExpiry && now.After(expiry) {
+			exists = false
 		}
+		result[identifier] = exists
 	}
-	return nil
+	return result, nil
 }
 
-func (r *MemoryRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+// removeIfExpired deletes the key if it is (still) expired
+func (r *MemoryRepository) removeIfExpired(key string) {
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	ch := make(chan interface{}, 100) // Buffer size of 100
-	r.channels[channel] = append(r.channels[channel], ch)
-
-	go func() {
-		<-ctx.Done()
-		r.mu.Lock()
-		defer r.mu.Unlock()
-		for i, subCh := range r.channels[channel] {
-			if subCh == ch {
-				r.channels[channel] = append(r.channels[channel][:i], r.channels[channel][i+1:]...)
-				close(ch)
-				break
-			}
-		}
-	}()
+	if expiry, hasExpiry := r.expiries[key]; hasExpiry && time.Now().After(expiry) {
+		r.removeExpiredKey(key)
+	}
+}
 
-	return ch, nil
+// compileGlob compiles a glob pattern into a regular expression that matches whole keys like
+// Redis does, see GlobToRegex
+func compileGlob(pattern string) (*regexp.Regexp, error) {
+	return regexp.Compile(GlobToRegex(pattern))
 }
 
-func (r *MemoryRepository) Ping(ctx context.Context) error {
-	return nil // Always successful for in-memory repository
+// assignValue stores data in value, which must be a non-nil pointer.
+// *interface{} receives the stored value as is, as does a pointer to the stored value's type.
+// Any other pointer receives the stored value converted through the codec.
+func (r *MemoryRepository) assignValue(data interface{}, value interface{}) error {
+	if target, ok := value.(*interface{}); ok && target != nil {
+		*target = copyGeneric(data)
+		return nil
+	}
+	target := reflect.ValueOf(value)
+	if target.Kind() != reflect.Ptr || target.IsNil() {
+		return fmt.Errorf("%w: value must be a non-nil pointer", ErrInvalidInput)
+	}
+	if data != nil && reflect.TypeOf(data).AssignableTo(target.Elem().Type()) {
+		target.Elem().Set(reflect.ValueOf(copyGeneric(data)))
+		return nil
+	}
+	encoded, err := r.codec.Marshal(data)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if err := r.codec.Unmarshal(encoded, value); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return nil
 }
 
-func (r *MemoryRepository) Close() error {
+func (r *MemoryRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	value, err := r.toStored(value)
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
-	for _, channels := range r.channels {
-		for _, ch := range channels {
-			close(ch)
-		}
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
 	}
-	r.channels = make(map[string][]chan interface{})
+	if _, exists := r.data[key]; !exists {
+		return ErrNotFound
+	}
+	r.data[key] = value
+	r.renewIdleLocked(key)
+	r.addKey(key)
 	return nil
 }
 
-func (r *MemoryRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+func (r *MemoryRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	parts, err := SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	fieldValue, err := r.toGeneric(value)
+	if err != nil {
+		return err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	key := identifier.String()
-	if _, exists := r.data[key]; !exists {
+	data, exists := r.data[key]
+	if !exists || r.isExpired(key) {
 		return ErrNotFound
 	}
-
-	if r.expiries == nil {
-		r.expiries = make(map[string]time.Time)
+	// Work on a generic copy of the document so the stored value is never partially modified
+	doc, err := r.toGeneric(data)
+	if err != nil {
+		return err
 	}
-	r.expiries[key] = time.Now().Add(expiration)
+	if err := SetFieldPath(doc, parts, fieldValue); err != nil {
+		return err
+	}
+	r.data[key] = doc
+	r.renewIdleLocked(key)
+	r.addKey(key)
 	return nil
 }
 
-func (r *MemoryRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
-	r.mu.RLock()
-	defer r.mu.RUnlock()
+func (r *MemoryRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return false, err
+	}
+	defer r.leave()
+	want, err := r.toGeneric(expected)
+	if err != nil {
+		return false, err
+	}
+	newValue, err = r.toStored(newValue)
+	if err != nil {
+		return false, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
 
 	key := identifier.String()
-	if expiry, exists := r.expiries[key]; exists {
-		return time.Until(expiry), nil
+	data, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return false, ErrNotFound
+	}
+	current, err := r.toGeneric(data)
+	if err != nil {
+		return false, err
 	}
-	return 0, ErrNotFound
+	if !reflect.DeepEqual(current, want) {
+		return false, nil
+	}
+	r.data[key] = newValue
+	r.addKey(key)
+	return true, nil
 }
 
-func (r *MemoryRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+func (r *MemoryRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+	value, err := r.toStored(value)
+	if err != nil {
+		return 0, err
+	}
+
 	r.mu.Lock()
 	defer r.mu.Unlock()
 
 	key := identifier.String()
-	value, exists := r.data[key]
-	if !exists {
-		r.data[key] = int64(1)
-		return 1, nil
+	if _, exists := r.data[key]; !exists || r.isExpired(key) {
+		return 0, ErrNotFound
+	}
+	if r.versions[key] != expectedVersion {
+		return 0, ErrVersionConflict
+	}
+	r.data[key] = value
+	r.versions[key] = expectedVersion + 1
+	r.addKey(key)
+	return expectedVersion + 1, nil
+}
+
+func (r *MemoryRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
 	}
+	defer r.leave()
 
-	switch v := value.(type) {
-	case int64:
-		v++
-		r.data[key] = v
-		return v, nil
-	default:
-		return 0, ErrInvalidInput
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists || r.isExpired(key) {
+		return 0, ErrNotFound
 	}
+	return r.versions[key], nil
 }
 
-// Add a method to clean up expired keys
-func (r *MemoryRepository) cleanupExpired() {
-	r.mu.Lock()
-	defer r.mu.Unlock()
+func (r *MemoryRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	parts, err := SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
 
-	now := time.Now()
-	for key, expiry := range r.expiries {
-		if now.After(expiry) {
-			delete(r.data, key)
-			delete(r.expiries, key)
-		}
+	r.mu.RLock()
+	key := identifier.String()
+	data, exists := r.data[key]
+	expired := r.isExpired(key)
+	_, idle := r.idleTimeouts[key]
+	if exists && !expired {
+		r.touchKey(key)
+	}
+	r.mu.RUnlock()
+	if !exists || expired {
+		return ErrNotFound
+	}
+	if idle {
+		r.renewIdle(key)
+	}
+
+	doc, err := r.toGeneric(data)
+	if err != nil {
+		return err
+	}
+	field, err := GetFieldPath(doc, parts)
+	if err != nil {
+		return err
+	}
+	return r.assignValue(field, value)
+}
+
+// toGeneric converts a value into its generic representation (maps, slices and scalars)
+// by round-tripping it through the codec
+func (r *MemoryRepository) toGeneric(value interface{}) (interface{}, error) {
+	encoded, err := r.codec.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	var generic interface{}
+	if err := r.codec.Unmarshal(encoded, &generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return generic, nil
+}
+
+// toStored converts an entity value for storage like toGeneric.
+// Returns ErrInvalidInput if value is nil.
+func (r *MemoryRepository) toStored(value interface{}) (interface{}, error) {
+	if err := CheckValue(value); err != nil {
+		return nil, err
+	}
+	return r.toGeneric(value)
+}
+
+// toGenericMany converts the values of a batch, recording the items that fail in batchErr
+func (r *MemoryRepository) toGenericMany(items map[EntityIdentifier]interface{}, batchErr *BatchError) map[EntityIdentifier]interface{} {
+	values := make(map[EntityIdentifier]interface{}, len(items))
+	for identifier, value := range items {
+		generic, err := r.toStored(value)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		values[identifier] = generic
+	}
+	return values
+}
+
+// copyGeneric returns a deep copy of a generic value, so callers can't modify stored values.
+// Lists are returned as []interface{}, hashes as map[string]interface{}, sets as a sorted
+// []interface{} of their encoded members, sorted sets as a []interface{} of member/score maps and
+// geo sets as a map of members to lon/lat maps.
+func copyGeneric(value interface{}) interface{} {
+	switch v := value.(type) {
+	case memoryList:
+		return copyGeneric([]interface{}(v))
+	case memoryHash:
+		return copyGeneric(map[string]interface{}(v))
+	case memorySortedSet:
+		members := make([]interface{}, len(v))
+		for i, scored := range v {
+			members[i] = map[string]interface{}{"member": scored.Member, "score": scored.Score}
+		}
+		return members
+	case memoryGeoSet:
+		members := make(map[string]interface{}, len(v))
+		for member, position := range v {
+			members[member] = map[string]interface{}{"lon": position.Longitude, "lat": position.Latitude}
+		}
+		return members
+	case memorySet:
+		members := make([]interface{}, 0, len(v))
+		for _, member := range v.sorted() {
+			members = append(members, member)
+		}
+		return members
+	case map[string]interface{}:
+		copied := make(map[string]interface{}, len(v))
+		for key, element := range v {
+			copied[key] = copyGeneric(element)
+		}
+		return copied
+	case []interface{}:
+		copied := make([]interface{}, len(v))
+		for i, element := range v {
+			copied[i] = copyGeneric(element)
+		}
+		return copied
+	}
+	return value
+}
+
+// isExpired reports whether the key has an expiration in the past. Must be called with r.mu held.
+func (r *MemoryRepository) isExpired(key string) bool {
+	expiry, hasExpiry := r.expiries[key]
+	return hasExpiry && time.Now().After(expiry)
+}
+
+func (r *MemoryRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	value, err := r.toStored(value)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	r.data[key] = value
+	r.addKey(key)
+	return nil
+}
+
+func (r *MemoryRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	value, err := r.toStored(value)
+	if err != nil {
+		return err
+	}
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.expiries == nil {
+		r.expiries = make(map[string]time.Time)
+	}
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	r.data[key] = value
+	r.expiries[key] = time.Now().Add(ttl)
+	delete(r.idleTimeouts, key)
+	r.addKey(key)
+	r.sweepIfGrown()
+	return nil
+}
+
+func (r *MemoryRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	batchErr := &BatchError{}
+	values := r.toGenericMany(items, batchErr)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.expiries == nil {
+		r.expiries = make(map[string]time.Time)
+	}
+	expiry := time.Now().Add(ttl)
+	for identifier, value := range values {
+		key := identifier.String()
+		if r.isExpired(key) {
+			r.removeExpiredKey(key)
+		}
+		r.data[key] = value
+		r.expiries[key] = expiry
+		delete(r.idleTimeouts, key)
+		r.addKey(key)
+	}
+	r.sweepIfGrown()
+	return batchErr.ErrOrNil()
+}
+
+func (r *MemoryRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	if _, exists := r.data[key]; !exists {
+		return ErrNotFound
+	}
+	delete(r.data, key)
+	r.removeKey(key)
+	return nil
+}
+
+func (r *MemoryRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	data, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return ErrNotFound
+	}
+	if err := r.assignValue(data, value); err != nil {
+		return err
+	}
+	delete(r.data, key)
+	delete(r.expiries, key)
+	r.removeKey(key)
+	return nil
+}
+
+func (r *MemoryRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	newValue, err := r.toStored(newValue)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	data, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return ErrNotFound
+	}
+	if err := r.assignValue(data, oldValue); err != nil {
+		return err
+	}
+	r.data[key] = newValue
+	r.addKey(key)
+	return nil
+}
+
+func (r *MemoryRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	batchErr := &BatchError{}
+	values := r.toGenericMany(items, batchErr)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for identifier, value := range values {
+		key := identifier.String()
+		if r.isExpired(key) {
+			r.removeExpiredKey(key)
+		}
+		if _, exists := r.data[key]; exists {
+			batchErr.Add(identifier, ErrAlreadyExists)
+			continue
+		}
+		r.data[key] = value
+		r.addKey(key)
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *MemoryRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	batchErr := &BatchError{}
+	found := make([]EntityIdentifier, 0, len(identifiers))
+	raws := make([][]byte, 0, len(identifiers))
+
+	r.mu.RLock()
+	now := time.Now()
+	for _, identifier := range identifiers {
+		key := identifier.String()
+		data, exists := r.data[key]
+		if expiry, hasExpiry := r.expiries[key]; !exists || (hasExpiry && now.After(expiry)) {
+			batchErr.Add(identifier, ErrNotFound)
+			continue
+		}
+		raw, err := r.codec.Marshal(data)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+			continue
+		}
+		r.touchKey(key)
+		found = append(found, identifier)
+		raws = append(raws, raw)
+	}
+	r.mu.RUnlock()
+
+	// Callbacks run without holding the lock so fn may use the repository
+	for i, identifier := range found {
+		if err := fn(identifier, raws[i]); err != nil {
+			return err
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *MemoryRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return ReadManyOrdered(ctx, r, r.codec, identifiers, dest)
+}
+
+func (r *MemoryRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	batchErr := &BatchError{}
+	for _, identifier := range identifiers {
+		key := identifier.String()
+		if _, exists := r.data[key]; !exists {
+			batchErr.Add(identifier, ErrNotFound)
+			continue
+		}
+		delete(r.data, key)
+		r.removeKey(key)
+		delete(r.expiries, key)
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern removes the matching entities in one pass under the lock
+func (r *MemoryRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := checkDeletePattern(pattern); err != nil {
+		return 0, err
+	}
+	return r.deleteMatching(ctx, pattern.String())
+}
+
+// deleteMatching removes the entities whose key matches the glob pattern and returns how many
+// were removed. Matching entities that already expired are removed as expired and not counted.
+func (r *MemoryRepository) deleteMatching(ctx context.Context, pattern string) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	regex, err := compileGlob(pattern)
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var deleted int64
+	for key := range r.data {
+		if !regex.MatchString(key) {
+			continue
+		}
+		if r.isExpired(key) {
+			r.removeExpiredKey(key)
+			continue
+		}
+		delete(r.data, key)
+		delete(r.expiries, key)
+		r.removeKey(key)
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (r *MemoryRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	result, err := r.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(r.notFoundOnEmpty)
+}
+
+// ListDetailed never skips keys, as every key of the memory repository is a valid identifier
+// holding a decoded value
+func (r *MemoryRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	if err := r.enter(ctx); err != nil {
+		return ListResult{}, err
+	}
+	defer r.leave()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	regex, err := compileGlob(pattern)
+	if err != nil {
+		return ListResult{}, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+
+	var result ListResult
+	for key := range r.data {
+		if regex.MatchString(key) && !r.isExpired(key) {
+			result.Identifiers = append(result.Identifiers, MemoryIdentifier(key))
+			result.Entities = append(result.Entities, copyGeneric(r.data[key]))
+		}
+	}
+	if len(result.Identifiers) == 0 && r.notFoundOnEmpty {
+		return ListResult{}, ErrNotFound
+	}
+	return result, nil
+}
+
+func (r *MemoryRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	regex, err := compileGlob(pattern.String())
+	if err != nil {
+		return 0, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	now := time.Now()
+	var count int64
+	for key := range r.data {
+		if expiry, hasExpiry := r.expiries[key]; hasExpiry && now.After(expiry) {
+			continue
+		}
+		if regex.MatchString(key) {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// Iterate collects the matching keys under the read lock and then reads one entity at a time,
+// so fn runs without holding the lock and may use the repository
+func (r *MemoryRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	regex, err := compileGlob(pattern.String())
+	if err != nil {
+		return fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+
+	r.mu.RLock()
+	keys := make([]string, 0, len(r.data))
+	for key := range r.data {
+		if regex.MatchString(key) {
+			keys = append(keys, key)
+		}
+	}
+	r.mu.RUnlock()
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		var raw []byte
+		r.mu.RLock()
+		data, exists := r.data[key]
+		if exists && !r.isExpired(key) {
+			raw, err = r.codec.Marshal(data)
+		}
+		r.mu.RUnlock()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+		if raw == nil {
+			// The entity was removed or expired after its key was collected
+			continue
+		}
+		if err := fn(MemoryIdentifier(key), raw); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, nil, 0, err
+	}
+	defer r.leave()
+	if pageSize <= 0 {
+		return nil, nil, 0, fmt.Errorf("%w: page size must be positive", ErrInvalidInput)
+	}
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	regex, err := compileGlob(pattern)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+
+	// The cursor is an offset into the sorted list of matching keys
+	var keys []string
+	for key := range r.data {
+		if regex.MatchString(key) && !r.isExpired(key) {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	if cursor >= uint64(len(keys)) {
+		return []EntityIdentifier{}, []interface{}{}, 0, nil
+	}
+	end := cursor + uint64(pageSize)
+	nextCursor := end
+	if end >= uint64(len(keys)) {
+		end = uint64(len(keys))
+		nextCursor = 0
+	}
+
+	ids := make([]EntityIdentifier, 0, end-cursor)
+	results := make([]interface{}, 0, end-cursor)
+	for _, key := range keys[cursor:end] {
+		ids = append(ids, MemoryIdentifier(key))
+		results = append(results, copyGeneric(r.data[key]))
+	}
+	return ids, results, nextCursor, nil
+}
+
+// ListPage pages through ListPaged, whose cursor is an offset into the sorted matching keys
+func (r *MemoryRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	return ListPage(ctx, r, pattern, cursor, pageSize)
+}
+
+func (r *MemoryRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	seen := make(map[string]struct{})
+	for key := range r.data {
+		if r.isExpired(key) {
+			continue
+		}
+		parts := strings.SplitN(key, DefaultKeySeparator, 2)
+		if len(parts) == 2 && parts[0] != "" {
+			seen[parts[0]] = struct{}{}
+		}
+	}
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (r *MemoryRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *MemoryRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	result, err := r.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+	if err != nil {
+		return nil, err
+	}
+	return result.Identifiers, nil
+}
+
+func (r *MemoryRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	response, err := r.SearchResults(ctx, query, SearchOptions{Offset: offset, Limit: limit, SortBy: sortBy, SortDir: sortDir})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return response.SearchResult(), nil
+}
+
+// SearchResults finds entities whose serialized value contains query, like the SQLite
+// repository does
+func (r *MemoryRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	return r.search(ctx, opts, func(encoded []byte) bool {
+		return strings.Contains(string(encoded), query)
+	})
+}
+
+// SearchQuery evaluates the query against the generic representation of every value
+func (r *MemoryRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	if err := query.Validate(); err != nil {
+		return SearchResponse{}, err
+	}
+	return r.search(ctx, opts, func(encoded []byte) bool {
+		var doc interface{}
+		return r.codec.Unmarshal(encoded, &doc) == nil && query.matches(doc)
+	})
+}
+
+// search returns the page of live entities whose values match. Each value is serialized with
+// the codec once. Results are sorted by the field path SortBy, or by identifier if it is empty.
+func (r *MemoryRepository) search(ctx context.Context, opts SearchOptions, match func(encoded []byte) bool) (SearchResponse, error) {
+	if err := r.enter(ctx); err != nil {
+		return SearchResponse{}, err
+	}
+	defer r.leave()
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return SearchResponse{}, fmt.Errorf("%w: invalid offset or limit", ErrInvalidInput)
+	}
+	var sortPath []string
+	if opts.SortBy != "" {
+		var err error
+		if sortPath, err = SplitFieldPath(opts.SortBy); err != nil {
+			return SearchResponse{}, err
+		}
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	type candidate struct {
+		hit       Hit
+		sortValue interface{}
+	}
+	var response SearchResponse
+	var candidates []candidate
+	for key, value := range r.data {
+		if r.isExpired(key) {
+			continue
+		}
+		encoded, err := r.codec.Marshal(value)
+		if err != nil {
+			r.logger.Warnf("skipping entity %q in search that could not be encoded: %v", key, err)
+			response.Skipped = append(response.Skipped, key)
+			continue
+		}
+		if !match(encoded) {
+			continue
+		}
+		c := candidate{hit: Hit{Identifier: MemoryIdentifier(key), Value: copyGeneric(value)}}
+		if sortPath != nil {
+			// Entities without the field keep a nil sort value and sort first
+			var doc interface{}
+			if r.codec.Unmarshal(encoded, &doc) == nil {
+				c.sortValue, _ = GetFieldPath(doc, sortPath)
+			}
+		}
+		candidates = append(candidates, c)
+	}
+
+	// Sort results
+	sort.Slice(candidates, func(i, j int) bool {
+		if opts.SortDir == "DESC" {
+			i, j = j, i
+		}
+		if sortPath != nil {
+			if order := compareGenericValues(candidates[i].sortValue, candidates[j].sortValue); order != 0 {
+				return order < 0
+			}
+		}
+		return candidates[i].hit.Identifier.String() < candidates[j].hit.Identifier.String()
+	})
+	hits := make([]Hit, 0, len(candidates))
+	for _, c := range candidates {
+		hits = append(hits, c.hit)
+	}
+
+	if len(hits) == 0 && r.notFoundOnEmpty {
+		return SearchResponse{}, ErrNotFound
+	}
+
+	// Apply offset and limit
+	response.Total = int64(len(hits))
+	if opts.Offset >= len(hits) {
+		response.Hits = []Hit{}
+		return response, nil
+	}
+	end := opts.Offset + opts.Limit
+	if end > len(hits) {
+		end = len(hits)
+	}
+	response.Hits = hits[opts.Offset:end]
+	return response, nil
+}
+
+// compareGenericValues orders numbers numerically, strings lexically and false before true.
+// Missing values sort first, values of different types are ordered by type.
+func compareGenericValues(a, b interface{}) int {
+	if af, ok := queryNumber(a); ok {
+		if bf, ok := queryNumber(b); ok {
+			switch {
+			case af < bf:
+				return -1
+			case af > bf:
+				return 1
+			}
+			return 0
+		}
+	}
+	if as, ok := a.(string); ok {
+		if bs, ok := b.(string); ok {
+			return strings.Compare(as, bs)
+		}
+	}
+	if ab, ok := a.(bool); ok {
+		if bb, ok := b.(bool); ok && ab != bb {
+			if ab {
+				return 1
+			}
+			return -1
+		}
+	}
+	return genericTypeRank(a) - genericTypeRank(b)
+}
+
+func genericTypeRank(value interface{}) int {
+	if value == nil {
+		return 0
+	}
+	if _, ok := queryNumber(value); ok {
+		return 1
+	}
+	switch value.(type) {
+	case string:
+		return 2
+	case bool:
+		return 3
+	}
+	return 4
+}
+
+func (r *MemoryRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	_, acquired, err := r.AcquireLockWithToken(ctx, identifier, ttl)
+	return acquired, err
+}
+
+func (r *MemoryRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return "", false, err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if lock, exists := r.locks[key]; exists && time.Now().Before(lock.expiry) {
+		return "", false, nil
+	}
+	token := NewLockToken()
+	r.locks[key] = memoryLock{token: token, expiry: time.Now().Add(ttl)}
+	return token, true, nil
+}
+
+func (r *MemoryRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if _, exists := r.locks[key]; !exists {
+		return ErrNotFound
+	}
+	delete(r.locks, key)
+	return nil
+}
+
+func (r *MemoryRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	lock, exists := r.locks[key]
+	if !exists || time.Now().After(lock.expiry) {
+		return ErrNotFound
+	}
+	if lock.token != token {
+		return ErrLockNotOwned
+	}
+	delete(r.locks, key)
+	return nil
+}
+
+func (r *MemoryRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return false, err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	lock, exists := r.locks[key]
+	if !exists || lock.token != token || time.Now().After(lock.expiry) {
+		return false, nil
+	}
+	lock.expiry = time.Now().Add(ttl)
+	r.locks[key] = lock
+	return true, nil
+}
+
+func (r *MemoryRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if r.txKeys != nil {
+		r.pending = append(r.pending, pendingMessage{channel: channel, message: message})
+		return nil
+	}
+	// Serialize like the Redis backend does, so subscribers receive the same bytes on both
+	payload, err := EncodePayload(r.codec, message)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if channels, exists := r.channels[channel]; exists {
+		for _, ch := range channels {
+			select {
+			case ch <- string(payload):
+			default:
+				// Channel is full, skip this subscriber
+			}
+		}
+	}
+
+	for _, sub := range r.psubs {
+		if !sub.pattern.MatchString(channel) {
+			continue
+		}
+		select {
+		case sub.ch <- Message{Channel: channel, Payload: payload}:
+		default:
+			// Channel is full, skip this subscriber
+		}
+	}
+	return nil
+}
+
+func (r *MemoryRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	if r.txKeys != nil {
+		return nil, ErrInTransaction
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ch := make(chan interface{}, 100) // Buffer size of 100
+	r.channels[channel] = append(r.channels[channel], ch)
+
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+		case <-r.guard.done():
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, subCh := range r.channels[channel] {
+			if subCh == ch {
+				r.channels[channel] = append(r.channels[channel][:i], r.channels[channel][i+1:]...)
+				close(ch)
+				break
+			}
+		}
+	})
+
+	return ch, nil
+}
+
+func (r *MemoryRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	if r.txKeys != nil {
+		return nil, ErrInTransaction
+	}
+	return r.subscribeMatching(ctx, regexp.MustCompile("^"+regexp.QuoteMeta(channel)+"$")), nil
+}
+
+func (r *MemoryRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	if r.txKeys != nil {
+		return nil, ErrInTransaction
+	}
+	regex, err := compileGlob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+	return r.subscribeMatching(ctx, regex), nil
+}
+
+// subscribeMatching registers a Message subscriber for all channels matching regex,
+// which is removed and closed when the subscription is closed or ctx is done
+func (r *MemoryRepository) subscribeMatching(ctx context.Context, regex *regexp.Regexp) *memoryPatternSubscription {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub := &memoryPatternSubscription{
+		repo:    r,
+		pattern: regex,
+		ch:      make(chan Message, 100), // Buffer size of 100
+		done:    make(chan struct{}),
+	}
+	r.psubs = append(r.psubs, sub)
+
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-r.guard.done():
+			sub.Close()
+		case <-sub.done:
+		}
+	})
+
+	return sub
+}
+
+// Ping always succeeds unless ctx is done or the repository was closed
+func (r *MemoryRepository) Ping(ctx context.Context) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	r.leave()
+	return nil
+}
+
+// enter checks ctx and registers an operation, which must call leave once it is done.
+// Returns ErrOperationFailed if the repository was closed.
+func (r *MemoryRepository) enter(ctx context.Context) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+	return r.guard.enter()
+}
+
+func (r *MemoryRepository) leave() {
+	r.guard.leave()
+}
+
+// Close waits for the operations in flight, which must not call Close themselves, ends all
+// subscriptions and writes the snapshot if PersistPath is set. Operations started after Close
+// return ErrOperationFailed. Closing a closed repository is a no-op.
+func (r *MemoryRepository) Close() error {
+	if r.txKeys != nil {
+		return ErrInTransaction
+	}
+	if !r.guard.close() {
+		return nil
+	}
+	// Stopped before locking, as a running sweep needs the lock to finish
+	if r.cleanup != nil {
+		r.cleanup.Stop()
+	}
+	var err error
+	if r.persistPath != "" {
+		err = r.saveSnapshot(r.persistPath)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, channels := range r.channels {
+		for _, ch := range channels {
+			close(ch)
+		}
+	}
+	r.channels = make(map[string][]chan interface{})
+	for _, sub := range r.psubs {
+		close(sub.ch)
+	}
+	r.psubs = nil
+	for _, sub := range r.keyEventSubs {
+		close(sub.ch)
+	}
+	r.keyEventSubs = nil
+	for _, watcher := range r.keyWatchers {
+		close(watcher.ch)
+	}
+	r.keyWatchers = nil
+	return err
+}
+
+func (r *MemoryRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists {
+		return ErrNotFound
+	}
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+		return ErrNotFound
+	}
+
+	if r.expiries == nil {
+		r.expiries = make(map[string]time.Time)
+	}
+	r.expiries[key] = time.Now().Add(expiration)
+	delete(r.idleTimeouts, key)
+	r.sweepIfGrown()
+	return nil
+}
+
+// SetExpirationMany applies all expirations under a single lock acquisition
+func (r *MemoryRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.expiries == nil {
+		r.expiries = make(map[string]time.Time)
+	}
+	expiresAt := time.Now().Add(expiration)
+	batchErr := &BatchError{}
+	for _, identifier := range identifiers {
+		key := identifier.String()
+		if _, exists := r.data[key]; !exists || r.isExpired(key) {
+			batchErr.Add(identifier, ErrNotFound)
+			continue
+		}
+		r.expiries[key] = expiresAt
+		delete(r.idleTimeouts, key)
+	}
+	r.sweepIfGrown()
+	return batchErr.ErrOrNil()
+}
+
+func (r *MemoryRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return false, err
+	}
+	defer r.leave()
+	switch cond {
+	case ExpireNX, ExpireXX, ExpireGT, ExpireLT:
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", ErrInvalidInput, cond)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists {
+		return false, nil
+	}
+	now := time.Now()
+	current, hasExpiry := r.expiries[key]
+	if hasExpiry && now.After(current) {
+		// Expired but not yet swept
+		return false, nil
+	}
+	newExpiry := now.Add(expiration)
+
+	switch cond {
+	case ExpireNX:
+		if hasExpiry {
+			return false, nil
+		}
+	case ExpireXX:
+		if !hasExpiry {
+			return false, nil
+		}
+	case ExpireGT:
+		// No expiration counts as infinite, which can't be exceeded
+		if !hasExpiry || !newExpiry.After(current) {
+			return false, nil
+		}
+	case ExpireLT:
+		if hasExpiry && !newExpiry.Before(current) {
+			return false, nil
+		}
+	}
+
+	if r.expiries == nil {
+		r.expiries = make(map[string]time.Time)
+	}
+	r.expiries[key] = newExpiry
+	delete(r.idleTimeouts, key)
+	r.sweepIfGrown()
+	return true, nil
+}
+
+func (r *MemoryRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	if r.isExpired(key) {
+		r.mu.RUnlock()
+		r.removeIfExpired(key)
+		return 0, ErrNotFound
+	}
+	expiry, exists := r.expiries[key]
+	r.mu.RUnlock()
+
+	if !exists {
+		return 0, ErrNotFound
+	}
+	return time.Until(expiry), nil
+}
+
+func (r *MemoryRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists {
+		return ErrNotFound
+	}
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+		return ErrNotFound
+	}
+	delete(r.expiries, key)
+	delete(r.idleTimeouts, key)
+	return nil
+}
+
+func (r *MemoryRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists {
+		return ErrNotFound
+	}
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+		return ErrNotFound
+	}
+	r.touchKey(key)
+	r.renewIdleLocked(key)
+	return nil
+}
+
+func (r *MemoryRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return r.IncrementBy(ctx, identifier, 1)
+}
+
+func (r *MemoryRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	value, _, err := r.IncrementWithLimit(ctx, identifier, delta, math.MaxInt64)
+	return value, err
+}
+
+func (r *MemoryRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return r.IncrementBy(ctx, identifier, -delta)
+}
+
+func (r *MemoryRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, false, err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		// An expired counter starts over
+		r.removeExpiredKey(key)
+	}
+	var counter int64
+	if value, exists := r.data[key]; exists {
+		v, ok := memoryCounter(value)
+		if !ok {
+			return 0, false, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+		}
+		counter = v
+	}
+	if counter+delta > max {
+		return counter, false, nil
+	}
+	counter += delta
+	r.data[key] = counter
+	r.addKey(key)
+	return counter, true, nil
+}
+
+func (r *MemoryRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		// An expired counter starts over
+		r.removeExpiredKey(key)
+	}
+	var counter int64
+	if value, exists := r.data[key]; exists {
+		v, ok := memoryCounter(value)
+		if !ok {
+			return 0, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+		}
+		counter = v
+	}
+	counter += delta
+	r.data[key] = counter
+	if _, hasExpiry := r.expiries[key]; !hasExpiry {
+		if r.expiries == nil {
+			r.expiries = make(map[string]time.Time)
+		}
+		r.expiries[key] = time.Now().Add(ttl)
+		r.sweepIfGrown()
+	}
+	r.addKey(key)
+	return counter, nil
+}
+
+// IncrementFloat accepts float64 and int64 values and stores the result as float64
+func (r *MemoryRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		// An expired counter starts over
+		r.removeExpiredKey(key)
+	}
+	var counter float64
+	if value, exists := r.data[key]; exists {
+		switch v := value.(type) {
+		case float64:
+			counter = v
+		case int64:
+			counter = float64(v)
+		default:
+			return 0, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+		}
+	}
+	counter += delta
+	r.data[key] = counter
+	r.addKey(key)
+	return counter, nil
+}
+
+func (r *MemoryRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := identifier.String()
+	value, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return 0, ErrNotFound
+	}
+	counter, ok := memoryCounter(value)
+	if !ok {
+		return 0, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+	}
+	r.touchKey(key)
+	return counter, nil
+}
+
+// memoryCounter returns the value of a counter. Besides the int64 stored by the counter
+// operations, whole numbers written with Create or Upsert count, which are stored as float64.
+func memoryCounter(value interface{}) (int64, bool) {
+	switch v := value.(type) {
+	case int64:
+		return v, true
+	case float64:
+		if v == math.Trunc(v) && math.Abs(v) < 1<<63 {
+			return int64(v), true
+		}
+	}
+	return 0, false
+}
+
+func (r *MemoryRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	r.data[key] = value
+	r.addKey(key)
+	return nil
+}
+
+// WithTransaction runs fn against a copy of the repository's entities, locks and expirations
+// while holding the write lock, and replaces them with the copy if fn succeeds. Copying makes
+// each transaction O(n) in the number of keys.
+func (r *MemoryRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	var tx *MemoryRepository
+	err := func() error {
+		r.mu.Lock()
+		defer r.mu.Unlock()
+
+		tx = &MemoryRepository{
+			BaseRepository:  r.BaseRepository,
+			data:            maps.Clone(r.data),
+			locks:           maps.Clone(r.locks),
+			channels:        make(map[string][]chan interface{}),
+			expiries:        maps.Clone(r.expiries),
+			versions:        maps.Clone(r.versions),
+			idleTimeouts:    maps.Clone(r.idleTimeouts),
+			fieldIndexes:    r.cloneFieldIndexes(),
+			idGen:           r.idGen,
+			notFoundOnEmpty: r.notFoundOnEmpty,
+			codec:           r.codec,
+			logger:          r.logger,
+			guard:           r.guard,
+			sweepBatchSize:  r.sweepBatchSize,
+			// The copy never sweeps; expired keys are hidden and swept after the commit
+			eagerSweepThreshold: math.MaxInt,
+			txKeys:              make(map[string]struct{}),
+		}
+		if err := fn(tx); err != nil {
+			return err
+		}
+
+		r.data = tx.data
+		r.locks = tx.locks
+		r.expiries = tx.expiries
+		r.versions = tx.versions
+		r.idleTimeouts = tx.idleTimeouts
+		r.fieldIndexes = tx.fieldIndexes
+		for key := range tx.txKeys {
+			if _, exists := r.data[key]; exists {
+				r.addKey(key)
+			} else {
+				r.removeKey(key)
+			}
+		}
+		return nil
+	}()
+	if err != nil {
+		return err
+	}
+
+	for _, pending := range tx.pending {
+		if err := r.Publish(ctx, pending.channel, pending.message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// sweepIfGrown starts an eager sweep once eagerSweepThreshold expirations have been added since
+// the last sweep. The sweep is tracked by the close guard, so Close waits for it.
+// Must be called with r.mu held by an operation between enter and leave.
+func (r *MemoryRepository) sweepIfGrown() {
+	if len(r.expiries)-r.expiriesAtLastSweep >= r.eagerSweepThreshold {
+		r.guard.goTracked(func() { r.cleanupExpired() })
+	}
+}
+
+// cleanupExpired removes expired keys and returns how many were reclaimed.
+// Expired keys are collected under the read lock and then deleted in batches of
+// sweepBatchSize, releasing the write lock between batches so that large sweeps
+// don't pause all other operations. Only one sweep runs at a time.
+func (r *MemoryRepository) cleanupExpired() int {
+	if !atomic.CompareAndSwapInt32(&r.sweeping, 0, 1) {
+		return 0
+	}
+	defer atomic.StoreInt32(&r.sweeping, 0)
+
+	r.mu.RLock()
+	now := time.Now()
+	var expired []string
+	for key, expiry := range r.expiries {
+		if now.After(expiry) {
+			expired = append(expired, key)
+		}
+	}
+	r.mu.RUnlock()
+
+	reclaimed := 0
+	for start := 0; start < len(expired); start += r.sweepBatchSize {
+		end := start + r.sweepBatchSize
+		if end > len(expired) {
+			end = len(expired)
+		}
+		r.mu.Lock()
+		now = time.Now()
+		for _, key := range expired[start:end] {
+			// The expiry may have been changed since it was collected
+			if expiry, exists := r.expiries[key]; exists && now.After(expiry) {
+				r.removeExpiredKey(key)
+				reclaimed++
+			}
+		}
+		r.mu.Unlock()
+	}
+
+	r.mu.Lock()
+	r.expiriesAtLastSweep = len(r.expiries)
+	r.mu.Unlock()
+
+	if r.onSweep != nil {
+		r.onSweep(reclaimed)
 	}
+	return reclaimed
 }
 
 func (r *MemoryRepository) initBaseRepository() {
@@ -0,0 +1,164 @@
+// datarepository.memory.hash.go
+
+package datarepository
+
+import (
+	"context"
+	"maps"
+)
+
+// memoryHash is the value of a hash entity. Its field values are stored in their generic form
+// like the values of other entities.
+type memoryHash map[string]interface{}
+
+var _ HashStore = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) HashSet(ctx context.Context, identifier EntityIdentifier, field string, value interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	value, err := r.toStored(value)
+	if err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	hash, err := r.hashOf(key)
+	if err != nil {
+		return err
+	}
+	hash = r.writableHash(hash)
+	hash[field] = value
+	r.data[key] = hash
+	r.addKey(key)
+	return nil
+}
+
+func (r *MemoryRepository) HashGet(ctx context.Context, identifier EntityIdentifier, field string, out interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	hash, err := r.hashOf(key)
+	if err != nil {
+		r.mu.RUnlock()
+		return err
+	}
+	value, exists := hash[field]
+	if hash != nil {
+		r.touchKey(key)
+	}
+	r.mu.RUnlock()
+
+	if !exists {
+		return ErrNotFound
+	}
+	return r.assignValue(value, out)
+}
+
+func (r *MemoryRepository) HashGetAll(ctx context.Context, identifier EntityIdentifier) (map[string]interface{}, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	hash, err := r.hashOf(key)
+	if err != nil {
+		return nil, err
+	}
+	if hash != nil {
+		r.touchKey(key)
+	}
+	return copyGeneric(map[string]interface{}(hash)).(map[string]interface{}), nil
+}
+
+func (r *MemoryRepository) HashDelete(ctx context.Context, identifier EntityIdentifier, field string) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	hash, err := r.hashOf(key)
+	if err != nil {
+		return err
+	}
+	if _, exists := hash[field]; !exists {
+		return nil
+	}
+	if len(hash) == 1 {
+		// Like Redis, the hash is deleted once it is empty
+		delete(r.data, key)
+		delete(r.expiries, key)
+		r.removeKey(key)
+		return nil
+	}
+	hash = r.writableHash(hash)
+	delete(hash, field)
+	r.data[key] = hash
+	r.addKey(key)
+	return nil
+}
+
+// writableHash returns a hash that can be modified in place like writableSet does for sets
+func (r *MemoryRepository) writableHash(hash memoryHash) memoryHash {
+	if hash == nil {
+		return memoryHash{}
+	}
+	if r.txKeys != nil {
+		return maps.Clone(hash)
+	}
+	return hash
+}
+
+// hashOf returns the hash stored under key, or nil if there is none or it expired.
+// Returns errNotAHash if key holds another value. Requires at least r.mu's read lock.
+func (r *MemoryRepository) hashOf(key string) (memoryHash, error) {
+	value, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return nil, nil
+	}
+	hash, ok := value.(memoryHash)
+	if !ok {
+		return nil, errNotAHash
+	}
+	return hash, nil
+}
+
+var _ HashStore = (*memoryNamespace)(nil)
+
+func (m *memoryNamespace) HashSet(ctx context.Context, identifier EntityIdentifier, field string, value interface{}) error {
+	return m.inner.HashSet(ctx, m.scope(identifier), field, value)
+}
+
+func (m *memoryNamespace) HashGet(ctx context.Context, identifier EntityIdentifier, field string, out interface{}) error {
+	return m.inner.HashGet(ctx, m.scope(identifier), field, out)
+}
+
+func (m *memoryNamespace) HashGetAll(ctx context.Context, identifier EntityIdentifier) (map[string]interface{}, error) {
+	return m.inner.HashGetAll(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) HashDelete(ctx context.Context, identifier EntityIdentifier, field string) error {
+	return m.inner.HashDelete(ctx, m.scope(identifier), field)
+}
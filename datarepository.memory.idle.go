@@ -0,0 +1,83 @@
+// datarepository.memory.idle.go
+
+package datarepository
+
+import (
+	"context"
+	"time"
+)
+
+var _ IdleExpirer = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) SetIdleExpiration(ctx context.Context, identifier EntityIdentifier, idle time.Duration) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if err := validateIdleExpiration(idle); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists || r.isExpired(key) {
+		return ErrNotFound
+	}
+	if r.expiries == nil {
+		r.expiries = make(map[string]time.Time)
+	}
+	if r.idleTimeouts == nil {
+		r.idleTimeouts = make(map[string]time.Duration)
+	}
+	r.expiries[key] = time.Now().Add(idle)
+	r.idleTimeouts[key] = idle
+	r.sweepIfGrown()
+	return nil
+}
+
+func (r *MemoryRepository) GetIdleExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	key := identifier.String()
+	if _, exists := r.data[key]; !exists || r.isExpired(key) {
+		return 0, ErrNotFound
+	}
+	return r.idleTimeouts[key], nil
+}
+
+// renewIdle restarts the expiration of a key with an idle timeout after it was read, unless it
+// expired or was changed in the meantime
+func (r *MemoryRepository) renewIdle(key string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if _, exists := r.data[key]; exists && !r.isExpired(key) {
+		r.renewIdleLocked(key)
+	}
+}
+
+// renewIdleLocked restarts the expiration of the key if it has an idle timeout.
+// Must be called with r.mu held.
+func (r *MemoryRepository) renewIdleLocked(key string) {
+	if idle, exists := r.idleTimeouts[key]; exists {
+		r.expiries[key] = time.Now().Add(idle)
+	}
+}
+
+var _ IdleExpirer = (*memoryNamespace)(nil)
+
+func (m *memoryNamespace) SetIdleExpiration(ctx context.Context, identifier EntityIdentifier, idle time.Duration) error {
+	return m.inner.SetIdleExpiration(ctx, m.scope(identifier), idle)
+}
+
+func (m *memoryNamespace) GetIdleExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	return m.inner.GetIdleExpiration(ctx, m.scope(identifier))
+}
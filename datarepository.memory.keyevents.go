@@ -0,0 +1,184 @@
+// datarepository.memory.keyevents.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+)
+
+// memoryKeyEventSubscriber is a SubscribeKeyspaceEvents subscriber of a MemoryRepository
+type memoryKeyEventSubscriber struct {
+	pattern      *regexp.Regexp
+	filter       keyEventFilter
+	toIdentifier func(key string) EntityIdentifier
+	ch           chan KeyEvent
+}
+
+// memoryKeyWatcher is a Watch subscriber of a MemoryRepository
+type memoryKeyWatcher struct {
+	key string
+	ch  chan []byte
+}
+
+var _ KeyspaceNotifier = (*MemoryRepository)(nil)
+
+// SubscribeKeyspaceEvents reports the writes and deletions made through the repository once they
+// are applied, those within WithTransaction once it commits. Expired entities are reported when
+// they are removed, by the background sweep or by an access after they expired.
+func (r *MemoryRepository) SubscribeKeyspaceEvents(ctx context.Context, pattern EntityIdentifier, events ...EventType) (chan KeyEvent, error) {
+	return r.subscribeKeyEvents(ctx, pattern.String(), events, func(key string) EntityIdentifier {
+		return MemoryIdentifier(key)
+	})
+}
+
+// subscribeKeyEvents registers a subscriber for the keys matching the glob pattern, which is
+// removed and whose channel is closed when ctx is done or the repository is closed
+func (r *MemoryRepository) subscribeKeyEvents(ctx context.Context, pattern string, events []EventType, toIdentifier func(key string) EntityIdentifier) (chan KeyEvent, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	if r.txKeys != nil {
+		return nil, ErrInTransaction
+	}
+	filter, err := newKeyEventFilter(events)
+	if err != nil {
+		return nil, err
+	}
+	regex, err := compileGlob(pattern)
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid pattern", ErrInvalidInput)
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sub := &memoryKeyEventSubscriber{
+		pattern:      regex,
+		filter:       filter,
+		toIdentifier: toIdentifier,
+		ch:           make(chan KeyEvent, KeyEventBufferSize),
+	}
+	r.keyEventSubs = append(r.keyEventSubs, sub)
+
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+		case <-r.guard.done():
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, subscriber := range r.keyEventSubs {
+			if subscriber == sub {
+				r.keyEventSubs = append(r.keyEventSubs[:i], r.keyEventSubs[i+1:]...)
+				close(sub.ch)
+				break
+			}
+		}
+	})
+
+	return sub.ch, nil
+}
+
+// notifyKeyEvent sends the event to the matching subscribers, skipping those whose channel is
+// full. Events of a transaction are sent when its keys are recorded on commit.
+// Must be called with r.mu held.
+func (r *MemoryRepository) notifyKeyEvent(key string, event EventType) {
+	if r.txKeys != nil {
+		return
+	}
+	for _, sub := range r.keyEventSubs {
+		if !sub.filter[event] || !sub.pattern.MatchString(key) {
+			continue
+		}
+		select {
+		case sub.ch <- KeyEvent{Type: event, Identifier: sub.toIdentifier(key)}:
+		default:
+			// Channel is full, skip this subscriber
+		}
+	}
+	r.notifyKeyWatchers(key, event)
+}
+
+var _ KeyspaceNotifier = (*memoryNamespace)(nil)
+
+// SubscribeKeyspaceEvents reports the changes of the view's entities matching pattern
+func (m *memoryNamespace) SubscribeKeyspaceEvents(ctx context.Context, pattern EntityIdentifier, events ...EventType) (chan KeyEvent, error) {
+	return m.inner.subscribeKeyEvents(ctx, m.scopePattern(pattern.String()), events, func(key string) EntityIdentifier {
+		return m.unscope(MemoryIdentifier(key))
+	})
+}
+
+var _ KeyWatcher = (*MemoryRepository)(nil)
+
+// Watch reports the value of the entity after each write or deletion made through the
+// repository, like SubscribeKeyspaceEvents. Each value is encoded when it is written.
+func (r *MemoryRepository) Watch(ctx context.Context, identifier EntityIdentifier) (chan []byte, error) {
+	return r.watchKey(ctx, identifier.String())
+}
+
+// watchKey registers a watcher for the key, which is removed and whose channel is closed when
+// ctx is done or the repository is closed
+func (r *MemoryRepository) watchKey(ctx context.Context, key string) (chan []byte, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+	if r.txKeys != nil {
+		return nil, ErrInTransaction
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	watcher := &memoryKeyWatcher{key: key, ch: make(chan []byte, KeyEventBufferSize)}
+	r.keyWatchers = append(r.keyWatchers, watcher)
+
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+		case <-r.guard.done():
+		}
+		r.mu.Lock()
+		defer r.mu.Unlock()
+		for i, w := range r.keyWatchers {
+			if w == watcher {
+				r.keyWatchers = append(r.keyWatchers[:i], r.keyWatchers[i+1:]...)
+				close(watcher.ch)
+				break
+			}
+		}
+	})
+
+	return watcher.ch, nil
+}
+
+// notifyKeyWatchers sends the value of the key to its watchers after an event, or nil if the
+// key was removed. Must be called with r.mu held.
+func (r *MemoryRepository) notifyKeyWatchers(key string, event EventType) {
+	var value []byte
+	encoded := false
+	for _, watcher := range r.keyWatchers {
+		if watcher.key != key {
+			continue
+		}
+		if !encoded && event == EventSet {
+			data, err := r.codec.Marshal(r.data[key])
+			if err != nil {
+				r.logger.Errorf("failed to encode %q for its watchers: %v", key, err)
+				return
+			}
+			value, encoded = data, true
+		}
+		sendLatest(watcher.ch, value)
+	}
+}
+
+var _ KeyWatcher = (*memoryNamespace)(nil)
+
+// Watch reports the value of one of the view's entities after each change
+func (m *memoryNamespace) Watch(ctx context.Context, identifier EntityIdentifier) (chan []byte, error) {
+	return m.inner.watchKey(ctx, m.scope(identifier).String())
+}
@@ -0,0 +1,159 @@
+// datarepository.memory.keyevents_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+// receiveKeyEvent returns the next event of ch, failing the test if none arrives in time
+func receiveKeyEvent(t *testing.T, ch chan KeyEvent) KeyEvent {
+	t.Helper()
+	select {
+	case event, ok := <-ch:
+		if !ok {
+			t.Fatal("event channel closed before an event arrived")
+		}
+		return event
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for an event")
+	}
+	return KeyEvent{}
+}
+
+func TestMemoryKeyspaceEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	events, err := repo.SubscribeKeyspaceEvents(ctx, SimpleIdentifier("user:*"))
+	if err != nil {
+		t.Fatalf("SubscribeKeyspaceEvents: %v", err)
+	}
+	deletions, err := repo.SubscribeKeyspaceEvents(ctx, SimpleIdentifier("*"), EventDel)
+	if err != nil {
+		t.Fatalf("SubscribeKeyspaceEvents: %v", err)
+	}
+
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, SimpleIdentifier("order:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventSet || event.Identifier.String() != "user:1" {
+		t.Errorf("after Create: got %+v, want a set event of user:1", event)
+	}
+	if err := repo.Update(ctx, id, map[string]int{"a": 2}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventSet {
+		t.Errorf("after Update: got %+v, want a set event", event)
+	}
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventDel {
+		t.Errorf("after Delete: got %+v, want a del event", event)
+	}
+	if event := receiveKeyEvent(t, deletions); event.Type != EventDel || event.Identifier.String() != "user:1" {
+		t.Errorf("filtered by type: got %+v, want the del event of user:1", event)
+	}
+
+	if err := repo.CreateWithTTL(ctx, id, map[string]int{"a": 3}, 10*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	receiveKeyEvent(t, events)
+	time.Sleep(20 * time.Millisecond)
+	if exists, _ := repo.Exists(ctx, id); exists {
+		t.Fatal("the entity did not expire")
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventExpired || event.Identifier.String() != "user:1" {
+		t.Errorf("after expiration: got %+v, want an expired event of user:1", event)
+	}
+
+	if _, err := repo.SubscribeKeyspaceEvents(ctx, SimpleIdentifier("*"), EventType("rename")); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("SubscribeKeyspaceEvents with an unknown event type: got %v, want ErrInvalidInput", err)
+	}
+	cancel()
+	for range events {
+	}
+}
+
+// receiveWatched returns the next value of a Watch channel, failing the test if none arrives in time
+func receiveWatched(t *testing.T, ch chan []byte) []byte {
+	t.Helper()
+	select {
+	case value, ok := <-ch:
+		if !ok {
+			t.Fatal("watch channel closed before a value arrived")
+		}
+		return value
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a value")
+	}
+	return nil
+}
+
+func TestMemoryWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	values, err := repo.Watch(ctx, id)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	if err := repo.Update(ctx, SimpleIdentifier("user:2"), map[string]int{"a": 9}); !errors.Is(err, ErrNotFound) {
+		t.Fatalf("Update of another entity: got %v, want ErrNotFound", err)
+	}
+	for _, a := range []int{2, 3} {
+		if err := repo.Update(ctx, id, map[string]int{"a": a}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		if value, want := receiveWatched(t, values), fmt.Sprintf(`{"a":%d}`, a); string(value) != want {
+			t.Errorf("after Update: got %s, want %s", value, want)
+		}
+	}
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if value := receiveWatched(t, values); value != nil {
+		t.Errorf("after Delete: got %s, want nil", value)
+	}
+
+	cancel()
+	for range values {
+	}
+}
+
+func TestMemoryDeleteOfExpiredEntityReportsExpiration(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := newTestMemoryRepository(t, MemoryConfig{CleanupInterval: -1})
+	events, err := repo.SubscribeKeyspaceEvents(ctx, SimpleIdentifier("user:*"))
+	if err != nil {
+		t.Fatalf("SubscribeKeyspaceEvents: %v", err)
+	}
+	id := SimpleIdentifier("user:1")
+	if err := repo.CreateWithTTL(ctx, id, map[string]int{"a": 1}, 10*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	receiveKeyEvent(t, events)
+	time.Sleep(20 * time.Millisecond)
+
+	if err := repo.Delete(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Delete of an expired entity: got %v, want ErrNotFound", err)
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventExpired {
+		t.Errorf("after Delete of an expired entity: got %+v, want an expired event", event)
+	}
+}
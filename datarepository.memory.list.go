@@ -0,0 +1,165 @@
+// datarepository.memory.list.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+// memoryList is the value of a list entity. Its elements are stored in their generic form like
+// the values of other entities.
+type memoryList []interface{}
+
+// errNoValues is returned by ListPush without values, which Redis rejects as well
+var errNoValues = fmt.Errorf("%w: at least one value is required", ErrInvalidInput)
+
+var _ ListStore = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) ListPush(ctx context.Context, identifier EntityIdentifier, values ...interface{}) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+	if len(values) == 0 {
+		return 0, errNoValues
+	}
+	generic := make([]interface{}, len(values))
+	for i, value := range values {
+		stored, err := r.toStored(value)
+		if err != nil {
+			return 0, err
+		}
+		generic[i] = stored
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	list, err := r.listOf(key)
+	if err != nil {
+		return 0, err
+	}
+	list = append(list, generic...)
+	r.data[key] = list
+	r.addKey(key)
+	return int64(len(list)), nil
+}
+
+func (r *MemoryRepository) ListRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, out interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	list, err := r.listOf(key)
+	if err != nil {
+		r.mu.RUnlock()
+		return err
+	}
+	var encoded [][]byte
+	if from, to, ok := listRangeBounds(start, stop, int64(len(list))); ok {
+		encoded = make([][]byte, 0, to-from)
+		for _, value := range list[from:to] {
+			data, err := r.codec.Marshal(value)
+			if err != nil {
+				r.mu.RUnlock()
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			encoded = append(encoded, data)
+		}
+	}
+	if list != nil {
+		r.touchKey(key)
+	}
+	r.mu.RUnlock()
+
+	return decodeSlice(r.codec, encoded, out)
+}
+
+func (r *MemoryRepository) ListPop(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if err := checkOut(out); err != nil {
+		return err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	list, err := r.listOf(key)
+	if err != nil {
+		return err
+	}
+	if len(list) == 0 {
+		return ErrNotFound
+	}
+	first := list[0]
+	if len(list) == 1 {
+		// Like Redis, the list is deleted once it is empty
+		delete(r.data, key)
+		delete(r.expiries, key)
+		r.removeKey(key)
+	} else {
+		r.data[key] = list[1:]
+		r.addKey(key)
+	}
+	return r.assignValue(first, out)
+}
+
+func (r *MemoryRepository) ListLen(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	list, err := r.listOf(identifier.String())
+	return int64(len(list)), err
+}
+
+// listOf returns the list stored under key, or nil if there is none or it expired.
+// Returns errNotAList if key holds another value. Requires at least r.mu's read lock.
+func (r *MemoryRepository) listOf(key string) (memoryList, error) {
+	value, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return nil, nil
+	}
+	list, ok := value.(memoryList)
+	if !ok {
+		return nil, errNotAList
+	}
+	return list, nil
+}
+
+var _ ListStore = (*memoryNamespace)(nil)
+
+func (m *memoryNamespace) ListPush(ctx context.Context, identifier EntityIdentifier, values ...interface{}) (int64, error) {
+	return m.inner.ListPush(ctx, m.scope(identifier), values...)
+}
+
+func (m *memoryNamespace) ListRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, out interface{}) error {
+	return m.inner.ListRange(ctx, m.scope(identifier), start, stop, out)
+}
+
+func (m *memoryNamespace) ListPop(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	return m.inner.ListPop(ctx, m.scope(identifier), out)
+}
+
+func (m *memoryNamespace) ListLen(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return m.inner.ListLen(ctx, m.scope(identifier))
+}
@@ -0,0 +1,150 @@
+// datarepository.memory.lru.go
+
+package datarepository
+
+import (
+	"container/list"
+	"sync"
+	"sync/atomic"
+)
+
+// memoryLRU tracks the recency of the keys of a MemoryRepository with MaxEntries set.
+// It has its own mutex so reads can record accesses while holding only the repository's read lock.
+type memoryLRU struct {
+	mu         sync.Mutex
+	maxEntries int
+	order      *list.List // most recently used key at the front
+	elements   map[string]*list.Element
+}
+
+func newMemoryLRU(maxEntries int) *memoryLRU {
+	return &memoryLRU{
+		maxEntries: maxEntries,
+		order:      list.New(),
+		elements:   make(map[string]*list.Element),
+	}
+}
+
+// touch marks an existing key as most recently used
+func (l *memoryLRU) touch(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, exists := l.elements[key]; exists {
+		l.order.MoveToFront(element)
+	}
+}
+
+// add marks the key as most recently used, adding it if necessary, and returns the least
+// recently used keys that exceed maxEntries
+func (l *memoryLRU) add(key string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, exists := l.elements[key]; exists {
+		l.order.MoveToFront(element)
+		return nil
+	}
+	l.elements[key] = l.order.PushFront(key)
+
+	var evicted []string
+	for l.order.Len() > l.maxEntries {
+		oldest := l.order.Back()
+		l.order.Remove(oldest)
+		delete(l.elements, oldest.Value.(string))
+		evicted = append(evicted, oldest.Value.(string))
+	}
+	return evicted
+}
+
+// remove stops tracking the key
+func (l *memoryLRU) remove(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if element, exists := l.elements[key]; exists {
+		l.order.Remove(element)
+		delete(l.elements, key)
+	}
+}
+
+// reset stops tracking all keys
+func (l *memoryLRU) reset() {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.order.Init()
+	l.elements = make(map[string]*list.Element)
+}
+
+// touchKey records a read of the key. Requires at least r.mu's read lock.
+func (r *MemoryRepository) touchKey(key string) {
+	if r.lru != nil {
+		r.lru.touch(key)
+	}
+}
+
+// addKey records a write of the key, updating its index entries and notifying keyspace event
+// subscribers, and evicts the least recently used keys if the repository holds more than
+// MaxEntries. Within a transaction, the key is only recorded until the commit.
+// Must be called with r.mu held.
+func (r *MemoryRepository) addKey(key string) {
+	r.reindexKey(key)
+	if r.txKeys != nil {
+		r.txKeys[key] = struct{}{}
+		return
+	}
+	r.notifyKeyEvent(key, EventSet)
+	r.trackKey(key)
+}
+
+// trackKey marks the key as most recently used and evicts the least recently used keys if the
+// repository holds more than MaxEntries.
+// Must be called with r.mu held.
+func (r *MemoryRepository) trackKey(key string) {
+	if r.lru == nil {
+		return
+	}
+	for _, evicted := range r.lru.add(key) {
+		delete(r.data, evicted)
+		delete(r.expiries, evicted)
+		delete(r.versions, evicted)
+		delete(r.idleTimeouts, evicted)
+		r.reindexKey(evicted)
+		atomic.AddUint64(&r.evictions, 1)
+		r.notifyKeyEvent(evicted, EventEvicted)
+		if r.onEvict != nil {
+			r.onEvict(evicted)
+		}
+	}
+}
+
+// removeKey records the deletion of the key and drops its expiration, version, idle timeout and
+// index entries
+func (r *MemoryRepository) removeKey(key string) {
+	r.dropKey(key)
+	r.notifyKeyEvent(key, EventDel)
+}
+
+// removeExpiredKey deletes an expired key like removeKey but reports it as expired.
+// Must be called with r.mu held.
+func (r *MemoryRepository) removeExpiredKey(key string) {
+	delete(r.data, key)
+	delete(r.expiries, key)
+	r.dropKey(key)
+	r.notifyKeyEvent(key, EventExpired)
+}
+
+// dropKey drops the expiration, version, idle timeout and index entries of a deleted key
+func (r *MemoryRepository) dropKey(key string) {
+	delete(r.expiries, key)
+	delete(r.versions, key)
+	delete(r.idleTimeouts, key)
+	r.reindexKey(key)
+	if r.txKeys != nil {
+		r.txKeys[key] = struct{}{}
+	} else if r.lru != nil {
+		r.lru.remove(key)
+	}
+}
+
+// Evictions returns the number of keys evicted so far because the repository exceeded MaxEntries
+func (r *MemoryRepository) Evictions() uint64 {
+	return atomic.LoadUint64(&r.evictions)
+}
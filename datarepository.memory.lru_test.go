@@ -0,0 +1,104 @@
+// datarepository.memory.lru_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestMemoryMaxEntriesEvictsLeastRecentlyUsed(t *testing.T) {
+	ctx := context.Background()
+	var evicted []string
+	repo := newTestMemoryRepository(t, MemoryConfig{
+		MaxEntries: 3,
+		OnEvict:    func(key string) { evicted = append(evicted, key) },
+	})
+
+	for i := 1; i <= 3; i++ {
+		if err := repo.Create(ctx, MemoryIdentifier(fmt.Sprintf("user:%d", i)), i); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+	// Reading user:1 makes user:2 the least recently used key
+	var value int
+	if err := repo.Read(ctx, MemoryIdentifier("user:1"), &value); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	for i := 4; i <= 5; i++ {
+		if err := repo.Create(ctx, MemoryIdentifier(fmt.Sprintf("user:%d", i)), i); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+
+	for _, key := range []string{"user:2", "user:3"} {
+		if err := repo.Read(ctx, MemoryIdentifier(key), &value); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Read %s: got %v, want ErrNotFound", key, err)
+		}
+	}
+	for _, key := range []string{"user:1", "user:4", "user:5"} {
+		if err := repo.Read(ctx, MemoryIdentifier(key), &value); err != nil {
+			t.Errorf("Read %s: %v", key, err)
+		}
+	}
+	if got := repo.Evictions(); got != 2 {
+		t.Errorf("Evictions: got %d, want 2", got)
+	}
+	if fmt.Sprint(evicted) != "[user:2 user:3]" {
+		t.Errorf("OnEvict: got %v, want [user:2 user:3]", evicted)
+	}
+}
+
+func TestMemoryUnboundedWithoutMaxEntries(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	for i := 0; i < 100; i++ {
+		if err := repo.Create(ctx, MemoryIdentifier(fmt.Sprintf("user:%d", i)), i); err != nil {
+			t.Fatalf("Create %d: %v", i, err)
+		}
+	}
+	if n, err := repo.Count(ctx, MemoryIdentifier("user:*")); err != nil || n != 100 {
+		t.Errorf("Count: got %d, %v, want 100, nil", n, err)
+	}
+	if got := repo.Evictions(); got != 0 {
+		t.Errorf("Evictions: got %d, want 0", got)
+	}
+}
+
+func TestMemoryDeleteDropsExpiration(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	events, err := repo.SubscribeKeyspaceEvents(ctx, MemoryIdentifier("user:*"), EventExpired)
+	if err != nil {
+		t.Fatalf("SubscribeKeyspaceEvents: %v", err)
+	}
+	id := MemoryIdentifier("user:1")
+
+	if err := repo.CreateWithTTL(ctx, id, 1, 50*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Create(ctx, id, 2); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if _, err := repo.GetExpiration(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExpiration after re-create: got %v, want ErrNotFound (no expiration)", err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	repo.cleanupExpired()
+	var value int
+	if err := repo.Read(ctx, id, &value); err != nil || value != 2 {
+		t.Errorf("Read after the old TTL: got %d, %v, want 2, nil", value, err)
+	}
+	select {
+	case event := <-events:
+		t.Errorf("got %v event for a re-created key", event.Type)
+	default:
+	}
+}
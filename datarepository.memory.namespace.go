@@ -0,0 +1,496 @@
+// datarepository.memory.namespace.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WithNamespace returns a view of the repository whose keys, patterns, locks and channels are
+// scoped to the namespace: the view stores "user:1" as "ns:user:1" in the shared maps, and only
+// sees keys within the namespace. Closing the view doesn't close the repository.
+func (r *MemoryRepository) WithNamespace(ns string) DataRepository {
+	return &memoryNamespace{inner: r, prefix: ns + DefaultKeySeparator}
+}
+
+// memoryNamespace is a namespaced view of a MemoryRepository
+type memoryNamespace struct {
+	inner  *MemoryRepository
+	prefix string // namespace followed by DefaultKeySeparator
+}
+
+var _ DataRepository = (*memoryNamespace)(nil)
+
+// WithNamespace returns a view nested within this view's namespace
+func (m *memoryNamespace) WithNamespace(ns string) DataRepository {
+	return &memoryNamespace{inner: m.inner, prefix: m.prefix + ns + DefaultKeySeparator}
+}
+
+// scope returns the identifier of the repository that an identifier of the view refers to
+func (m *memoryNamespace) scope(identifier EntityIdentifier) EntityIdentifier {
+	return MemoryIdentifier(m.prefix + identifier.String())
+}
+
+// scopePattern returns the glob pattern of the repository matching the keys of the view that
+// match pattern, with glob metacharacters in the namespace escaped
+func (m *memoryNamespace) scopePattern(pattern string) string {
+	return EscapeGlob(m.prefix) + pattern
+}
+
+// unscope returns the identifier of the view for an identifier of the repository
+func (m *memoryNamespace) unscope(identifier EntityIdentifier) EntityIdentifier {
+	return MemoryIdentifier(strings.TrimPrefix(identifier.String(), m.prefix))
+}
+
+// KeyFor returns the key the entity is stored under in the repository, including the namespace
+func (m *memoryNamespace) KeyFor(identifier EntityIdentifier) (string, error) {
+	return m.scope(identifier).String(), nil
+}
+
+func (m *memoryNamespace) scopeAll(identifiers []EntityIdentifier) []EntityIdentifier {
+	scoped := make([]EntityIdentifier, len(identifiers))
+	for i, identifier := range identifiers {
+		scoped[i] = m.scope(identifier)
+	}
+	return scoped
+}
+
+func (m *memoryNamespace) unscopeAll(identifiers []EntityIdentifier) []EntityIdentifier {
+	if identifiers == nil {
+		return nil
+	}
+	unscoped := make([]EntityIdentifier, len(identifiers))
+	for i, identifier := range identifiers {
+		unscoped[i] = m.unscope(identifier)
+	}
+	return unscoped
+}
+
+// unscopeBatchError rewrites the identifiers of a *BatchError to those of the view
+func (m *memoryNamespace) unscopeBatchError(err error) error {
+	var batchErr *BatchError
+	if !errors.As(err, &batchErr) {
+		return err
+	}
+	unscoped := &BatchError{Errors: make([]BatchItemError, len(batchErr.Errors))}
+	for i, itemErr := range batchErr.Errors {
+		itemErr.Identifier = m.unscope(itemErr.Identifier)
+		unscoped.Errors[i] = itemErr
+	}
+	return unscoped
+}
+
+func (m *memoryNamespace) scopeItems(items map[EntityIdentifier]interface{}) map[EntityIdentifier]interface{} {
+	scoped := make(map[EntityIdentifier]interface{}, len(items))
+	for identifier, value := range items {
+		scoped[m.scope(identifier)] = value
+	}
+	return scoped
+}
+
+func (m *memoryNamespace) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return m.inner.Create(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	return m.inner.CreateIfAbsent(ctx, m.scope(identifier), value, ttl)
+}
+
+func (m *memoryNamespace) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return m.inner.CreateWithTTL(ctx, m.scope(identifier), value, ttl)
+}
+
+func (m *memoryNamespace) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return m.inner.Read(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	return m.inner.ReadWithTTL(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	return m.inner.Exists(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	scoped, err := m.inner.ExistsMany(ctx, m.scopeAll(identifiers))
+	if scoped == nil {
+		return nil, m.unscopeBatchError(err)
+	}
+	result := make(map[EntityIdentifier]bool, len(scoped))
+	for identifier, exists := range scoped {
+		result[m.unscope(identifier)] = exists
+	}
+	return result, m.unscopeBatchError(err)
+}
+
+func (m *memoryNamespace) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return m.inner.Upsert(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return m.inner.UpsertWithTTL(ctx, m.scope(identifier), value, ttl)
+}
+
+func (m *memoryNamespace) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return m.inner.Update(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return m.inner.UpdateField(ctx, m.scope(identifier), path, value)
+}
+
+func (m *memoryNamespace) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	return m.inner.CompareAndSwap(ctx, m.scope(identifier), expected, newValue)
+}
+
+func (m *memoryNamespace) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	return m.inner.UpdateWithVersion(ctx, m.scope(identifier), value, expectedVersion)
+}
+
+func (m *memoryNamespace) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return m.inner.GetVersion(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return m.inner.ReadField(ctx, m.scope(identifier), path, value)
+}
+
+func (m *memoryNamespace) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	return m.inner.Delete(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return m.inner.GetAndDelete(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	return m.inner.GetAndSet(ctx, m.scope(identifier), newValue, oldValue)
+}
+
+func (m *memoryNamespace) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	return m.inner.AcquireLock(ctx, m.scope(identifier), ttl)
+}
+
+func (m *memoryNamespace) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	return m.inner.AcquireLockWithToken(ctx, m.scope(identifier), ttl)
+}
+
+func (m *memoryNamespace) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	return m.inner.ReleaseLock(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	return m.inner.ReleaseLockWithToken(ctx, m.scope(identifier), token)
+}
+
+func (m *memoryNamespace) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	return m.inner.RenewLock(ctx, m.scope(identifier), token, ttl)
+}
+
+func (m *memoryNamespace) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	return m.inner.SetExpiration(ctx, m.scope(identifier), expiration)
+}
+
+func (m *memoryNamespace) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	return m.unscopeBatchError(m.inner.SetExpirationMany(ctx, m.scopeAll(identifiers), expiration))
+}
+
+func (m *memoryNamespace) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	return m.inner.SetExpirationCond(ctx, m.scope(identifier), expiration, cond)
+}
+
+func (m *memoryNamespace) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	return m.inner.GetExpiration(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	return m.inner.Persist(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	return m.inner.Touch(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return m.inner.AtomicIncrement(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return m.inner.IncrementBy(ctx, m.scope(identifier), delta)
+}
+
+func (m *memoryNamespace) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return m.inner.DecrementBy(ctx, m.scope(identifier), delta)
+}
+
+func (m *memoryNamespace) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	return m.inner.IncrementWithLimit(ctx, m.scope(identifier), delta, max)
+}
+
+func (m *memoryNamespace) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	return m.inner.IncrementWithExpiry(ctx, m.scope(identifier), delta, ttl)
+}
+
+func (m *memoryNamespace) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	return m.inner.IncrementFloat(ctx, m.scope(identifier), delta)
+}
+
+func (m *memoryNamespace) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return m.inner.GetCounter(ctx, m.scope(identifier))
+}
+
+func (m *memoryNamespace) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	return m.inner.SetCounter(ctx, m.scope(identifier), value)
+}
+
+func (m *memoryNamespace) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	if !entityPrefixRegex.MatchString(entityPrefix) {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, ErrInvalidEntityPrefix)
+	}
+	return CreateWithGeneratedID(ctx, m, m.inner.idGen, entityPrefix, value, func(entityPrefix, id string) EntityIdentifier {
+		return MemoryIdentifier(entityPrefix + DefaultKeySeparator + id)
+	})
+}
+
+func (m *memoryNamespace) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	return m.unscopeBatchError(m.inner.UpsertManyWithTTL(ctx, m.scopeItems(items), ttl))
+}
+
+func (m *memoryNamespace) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	return m.unscopeBatchError(m.inner.CreateMany(ctx, m.scopeItems(items)))
+}
+
+func (m *memoryNamespace) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	err := m.inner.ReadMany(ctx, m.scopeAll(identifiers), func(identifier EntityIdentifier, raw []byte) error {
+		return fn(m.unscope(identifier), raw)
+	})
+	return m.unscopeBatchError(err)
+}
+
+func (m *memoryNamespace) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return ReadManyOrdered(ctx, m, m.inner.codec, identifiers, dest)
+}
+
+func (m *memoryNamespace) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	return m.unscopeBatchError(m.inner.DeleteMany(ctx, m.scopeAll(identifiers)))
+}
+
+func (m *memoryNamespace) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := checkDeletePattern(pattern); err != nil {
+		return 0, err
+	}
+	return m.inner.deleteMatching(ctx, m.scopePattern(pattern.String()))
+}
+
+func (m *memoryNamespace) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	result, err := m.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(m.inner.notFoundOnEmpty)
+}
+
+func (m *memoryNamespace) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	result, err := m.inner.ListDetailed(ctx, m.scopePattern(pattern))
+	if err != nil {
+		return ListResult{}, err
+	}
+	result.Identifiers = m.unscopeAll(result.Identifiers)
+	return result, nil
+}
+
+func (m *memoryNamespace) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	identifiers, entities, nextCursor, err := m.inner.ListPaged(ctx, m.scopePattern(pattern), cursor, pageSize)
+	return m.unscopeAll(identifiers), entities, nextCursor, err
+}
+
+func (m *memoryNamespace) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	return ListPage(ctx, m, pattern, cursor, pageSize)
+}
+
+func (m *memoryNamespace) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	return m.inner.Count(ctx, MemoryIdentifier(m.scopePattern(pattern.String())))
+}
+
+func (m *memoryNamespace) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return m.inner.Iterate(ctx, MemoryIdentifier(m.scopePattern(pattern.String())), func(identifier EntityIdentifier, raw []byte) error {
+		return fn(m.unscope(identifier), raw)
+	})
+}
+
+func (m *memoryNamespace) EntityPrefixes(ctx context.Context) ([]string, error) {
+	result, err := m.inner.ListDetailed(ctx, m.scopePattern("*"))
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return nil, err
+	}
+	seen := make(map[string]struct{})
+	for _, identifier := range m.unscopeAll(result.Identifiers) {
+		parts := strings.SplitN(identifier.String(), DefaultKeySeparator, 2)
+		if len(parts) == 2 && parts[0] != "" {
+			seen[parts[0]] = struct{}{}
+		}
+	}
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (m *memoryNamespace) ListPrefixes(ctx context.Context) ([]string, error) {
+	return m.EntityPrefixes(ctx)
+}
+
+func (m *memoryNamespace) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	result, err := m.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+	if err != nil {
+		return nil, err
+	}
+	return result.Identifiers, nil
+}
+
+func (m *memoryNamespace) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	response, err := m.SearchResults(ctx, query, SearchOptions{Offset: offset, Limit: limit, SortBy: sortBy, SortDir: sortDir})
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return response.SearchResult(), nil
+}
+
+// SearchResults searches the whole repository and keeps the matches within the namespace
+func (m *memoryNamespace) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return SearchResponse{}, fmt.Errorf("%w: invalid offset or limit", ErrInvalidInput)
+	}
+	all, err := m.inner.SearchResults(ctx, query, SearchOptions{Limit: math.MaxInt, SortBy: opts.SortBy, SortDir: opts.SortDir})
+	return m.scopeSearch(all, err, opts)
+}
+
+// SearchQuery searches the whole repository and keeps the matches within the namespace
+func (m *memoryNamespace) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return SearchResponse{}, fmt.Errorf("%w: invalid offset or limit", ErrInvalidInput)
+	}
+	all, err := m.inner.SearchQuery(ctx, query, SearchOptions{Limit: math.MaxInt, SortBy: opts.SortBy, SortDir: opts.SortDir})
+	return m.scopeSearch(all, err, opts)
+}
+
+// scopeSearch returns the requested page of the hits of a search over the whole repository
+// that lie within the namespace
+func (m *memoryNamespace) scopeSearch(all SearchResponse, err error, opts SearchOptions) (SearchResponse, error) {
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return SearchResponse{}, err
+	}
+	matches := []Hit{}
+	for _, hit := range all.Hits {
+		if strings.HasPrefix(hit.Identifier.String(), m.prefix) {
+			matches = append(matches, Hit{Identifier: m.unscope(hit.Identifier), Value: hit.Value})
+		}
+	}
+	if len(matches) == 0 && m.inner.notFoundOnEmpty {
+		return SearchResponse{}, ErrNotFound
+	}
+
+	total := int64(len(matches))
+	if opts.Offset >= len(matches) {
+		return SearchResponse{Total: total, Hits: []Hit{}}, nil
+	}
+	end := len(matches)
+	if opts.Limit < end-opts.Offset {
+		end = opts.Offset + opts.Limit
+	}
+	return SearchResponse{Total: total, Hits: matches[opts.Offset:end]}, nil
+}
+
+func (m *memoryNamespace) Publish(ctx context.Context, channel string, message interface{}) error {
+	return m.inner.Publish(ctx, m.prefix+channel, message)
+}
+
+func (m *memoryNamespace) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	return m.inner.Subscribe(ctx, m.prefix+channel)
+}
+
+func (m *memoryNamespace) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	sub, err := m.inner.SubscribeMessages(ctx, m.prefix+channel)
+	if err != nil {
+		return nil, err
+	}
+	return newNamespaceSubscription(sub, m.prefix), nil
+}
+
+func (m *memoryNamespace) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	sub, err := m.inner.PSubscribe(ctx, m.scopePattern(pattern))
+	if err != nil {
+		return nil, err
+	}
+	return newNamespaceSubscription(sub, m.prefix), nil
+}
+
+func (m *memoryNamespace) Ping(ctx context.Context) error {
+	return m.inner.Ping(ctx)
+}
+
+// Close is a no-op, as the repository is shared with other views
+func (m *memoryNamespace) Close() error {
+	return nil
+}
+
+func (m *memoryNamespace) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	return m.inner.WithTransaction(ctx, func(tx DataRepository) error {
+		return fn(&memoryNamespace{inner: tx.(*MemoryRepository), prefix: m.prefix})
+	})
+}
+
+func (m *memoryNamespace) RegisterPlugin(plugin RepositoryPlugin) error {
+	return m.inner.RegisterPlugin(plugin)
+}
+
+func (m *memoryNamespace) GetPlugin(name string) (RepositoryPlugin, bool) {
+	return m.inner.GetPlugin(name)
+}
+
+// namespaceSubscription strips the namespace from the channels of a subscription's messages
+type namespaceSubscription struct {
+	inner     Subscription
+	ch        chan Message
+	done      chan struct{}
+	closeOnce sync.Once
+}
+
+func newNamespaceSubscription(inner Subscription, prefix string) *namespaceSubscription {
+	sub := &namespaceSubscription{
+		inner: inner,
+		ch:    make(chan Message),
+		done:  make(chan struct{}),
+	}
+	go func() {
+		defer close(sub.ch)
+		for msg := range inner.Messages() {
+			msg.Channel = strings.TrimPrefix(msg.Channel, prefix)
+			select {
+			case sub.ch <- msg:
+			case <-sub.done:
+				return
+			}
+		}
+	}()
+	return sub
+}
+
+func (s *namespaceSubscription) Messages() <-chan Message {
+	return s.ch
+}
+
+func (s *namespaceSubscription) Close() error {
+	s.closeOnce.Do(func() { close(s.done) })
+	return s.inner.Close()
+}
@@ -0,0 +1,217 @@
+// datarepository.memory.set.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"sort"
+)
+
+// memorySet is the value of a set entity. Its keys are the members encoded with the codec in
+// their generic form, so that e.g. a struct and a map with the same fields are the same member.
+type memorySet map[string]struct{}
+
+// sorted returns the encoded members in ascending order
+func (s memorySet) sorted() []string {
+	members := make([]string, 0, len(s))
+	for member := range s {
+		members = append(members, member)
+	}
+	sort.Strings(members)
+	return members
+}
+
+var _ SetStore = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) SetAdd(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+	encoded, err := r.encodeMembers(members)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	set, err := r.setOf(key)
+	if err != nil {
+		return 0, err
+	}
+	set = r.writableSet(set)
+	var added int64
+	for _, member := range encoded {
+		if _, exists := set[member]; !exists {
+			set[member] = struct{}{}
+			added++
+		}
+	}
+	r.data[key] = set
+	r.addKey(key)
+	return added, nil
+}
+
+func (r *MemoryRepository) SetMembers(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	set, err := r.setOf(key)
+	if err != nil {
+		r.mu.RUnlock()
+		return err
+	}
+	members := set.sorted()
+	if set != nil {
+		r.touchKey(key)
+	}
+	r.mu.RUnlock()
+
+	encoded := make([][]byte, len(members))
+	for i, member := range members {
+		encoded[i] = []byte(member)
+	}
+	return decodeSlice(r.codec, encoded, out)
+}
+
+func (r *MemoryRepository) SetIsMember(ctx context.Context, identifier EntityIdentifier, member interface{}) (bool, error) {
+	if err := r.enter(ctx); err != nil {
+		return false, err
+	}
+	defer r.leave()
+	encoded, err := r.encodeMembers([]interface{}{member})
+	if err != nil {
+		return false, err
+	}
+
+	key := identifier.String()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set, err := r.setOf(key)
+	if err != nil {
+		return false, err
+	}
+	if set != nil {
+		r.touchKey(key)
+	}
+	_, isMember := set[encoded[0]]
+	return isMember, nil
+}
+
+func (r *MemoryRepository) SetRemove(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+	encoded, err := r.encodeMembers(members)
+	if err != nil {
+		return 0, err
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	set, err := r.setOf(key)
+	if err != nil || set == nil {
+		return 0, err
+	}
+	set = r.writableSet(set)
+	var removed int64
+	for _, member := range encoded {
+		if _, exists := set[member]; exists {
+			delete(set, member)
+			removed++
+		}
+	}
+	if len(set) == 0 {
+		// Like Redis, the set is deleted once it is empty
+		delete(r.data, key)
+		delete(r.expiries, key)
+		r.removeKey(key)
+	} else if removed > 0 {
+		r.data[key] = set
+		r.addKey(key)
+	}
+	return removed, nil
+}
+
+// writableSet returns a set that can be modified in place: a new one for nil, and a copy within
+// a transaction, whose data shares its values with the repository until it commits.
+// The caller stores the returned set under its key.
+func (r *MemoryRepository) writableSet(set memorySet) memorySet {
+	if set == nil {
+		return memorySet{}
+	}
+	if r.txKeys != nil {
+		return maps.Clone(set)
+	}
+	return set
+}
+
+// encodeMembers encodes set members with the codec in their generic form
+func (r *MemoryRepository) encodeMembers(members []interface{}) ([]string, error) {
+	if len(members) == 0 {
+		return nil, errNoMembers
+	}
+	encoded := make([]string, len(members))
+	for i, member := range members {
+		generic, err := r.toStored(member)
+		if err != nil {
+			return nil, err
+		}
+		data, err := r.codec.Marshal(generic)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		encoded[i] = string(data)
+	}
+	return encoded, nil
+}
+
+// setOf returns the set stored under key, or nil if there is none or it expired.
+// Returns errNotASet if key holds another value. Requires at least r.mu's read lock.
+func (r *MemoryRepository) setOf(key string) (memorySet, error) {
+	value, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return nil, nil
+	}
+	set, ok := value.(memorySet)
+	if !ok {
+		return nil, errNotASet
+	}
+	return set, nil
+}
+
+var _ SetStore = (*memoryNamespace)(nil)
+
+func (m *memoryNamespace) SetAdd(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	return m.inner.SetAdd(ctx, m.scope(identifier), members...)
+}
+
+func (m *memoryNamespace) SetMembers(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	return m.inner.SetMembers(ctx, m.scope(identifier), out)
+}
+
+func (m *memoryNamespace) SetIsMember(ctx context.Context, identifier EntityIdentifier, member interface{}) (bool, error) {
+	return m.inner.SetIsMember(ctx, m.scope(identifier), member)
+}
+
+func (m *memoryNamespace) SetRemove(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	return m.inner.SetRemove(ctx, m.scope(identifier), members...)
+}
@@ -0,0 +1,250 @@
+// datarepository.memory.snapshot.go
+
+package datarepository
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+)
+
+// memorySnapshot is the on-disk format written by MemoryRepository.Snapshot
+type memorySnapshot struct {
+	Entries []memorySnapshotEntry `json:"entries"`
+}
+
+// memorySnapshotEntry is a single key of a memorySnapshot. Value is encoded with the repository's codec.
+type memorySnapshotEntry struct {
+	Key       string     `json:"key"`
+	Value     []byte     `json:"value"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+	// IdleTimeout is set for entities with a sliding expiration, see SetIdleExpiration
+	IdleTimeout time.Duration `json:"idle_timeout,omitempty"`
+	// Counter marks int64 values, e.g. those of AtomicIncrement, so they are restored as int64
+	Counter bool `json:"counter,omitempty"`
+	// Type is set for data structures, e.g. "list" for the lists of ListPush, so they are
+	// restored as such rather than as documents
+	Type    string `json:"type,omitempty"`
+	Version int64  `json:"version,omitempty"`
+}
+
+// Snapshot writes all entities with their expirations, idle timeouts and versions to w. Values are encoded with the
+// configured codec; locks and subscriptions are not included.
+func (r *MemoryRepository) Snapshot(w io.Writer) error {
+	r.mu.RLock()
+	now := time.Now()
+	snapshot := memorySnapshot{Entries: make([]memorySnapshotEntry, 0, len(r.data))}
+	for key, value := range r.data {
+		entry := memorySnapshotEntry{Key: key}
+		if expiry, hasExpiry := r.expiries[key]; hasExpiry {
+			if now.After(expiry) {
+				continue
+			}
+			entry.ExpiresAt = &expiry
+		}
+		_, entry.Counter = value.(int64)
+		entry.Type = memoryStructureType(value)
+		entry.Version = r.versions[key]
+		entry.IdleTimeout = r.idleTimeouts[key]
+		encoded, err := r.codec.Marshal(value)
+		if err != nil {
+			r.mu.RUnlock()
+			return fmt.Errorf("%w: failed to encode %q: %v", ErrOperationFailed, key, err)
+		}
+		entry.Value = encoded
+		snapshot.Entries = append(snapshot.Entries, entry)
+	}
+	r.mu.RUnlock()
+
+	if err := json.NewEncoder(w).Encode(snapshot); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// Restore loads a snapshot written by Snapshot, replacing all entities of the repository.
+// Entries that have expired in the meantime are skipped. Values are restored in their generic
+// form as decoded by the codec (maps, slices and scalars), except int64 values, which stay int64.
+func (r *MemoryRepository) Restore(reader io.Reader) error {
+	var snapshot memorySnapshot
+	if err := json.NewDecoder(reader).Decode(&snapshot); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	now := time.Now()
+	data := make(map[string]interface{}, len(snapshot.Entries))
+	expiries := make(map[string]time.Time)
+	versions := make(map[string]int64)
+	idleTimeouts := make(map[string]time.Duration)
+	for _, entry := range snapshot.Entries {
+		if entry.ExpiresAt != nil {
+			if now.After(*entry.ExpiresAt) {
+				continue
+			}
+			expiries[entry.Key] = *entry.ExpiresAt
+		}
+		var value interface{}
+		if entry.Counter {
+			var counter int64
+			if err := r.codec.Unmarshal(entry.Value, &counter); err != nil {
+				return fmt.Errorf("%w: failed to decode %q: %v", ErrInvalidInput, entry.Key, err)
+			}
+			value = counter
+		} else if err := r.codec.Unmarshal(entry.Value, &value); err != nil {
+			return fmt.Errorf("%w: failed to decode %q: %v", ErrInvalidInput, entry.Key, err)
+		}
+		value, err := restoreMemoryStructure(entry.Type, value)
+		if err != nil {
+			return fmt.Errorf("%w: failed to decode %q: %v", ErrInvalidInput, entry.Key, err)
+		}
+		data[entry.Key] = value
+		if entry.Version != 0 {
+			versions[entry.Key] = entry.Version
+		}
+		if entry.IdleTimeout > 0 {
+			idleTimeouts[entry.Key] = entry.IdleTimeout
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.data = data
+	r.expiries = expiries
+	r.versions = versions
+	r.idleTimeouts = idleTimeouts
+	r.rebuildFieldIndexes()
+	if r.lru != nil {
+		r.lru.reset()
+		for key := range data {
+			r.trackKey(key)
+		}
+	}
+	r.expiriesAtLastSweep = len(r.expiries)
+	return nil
+}
+
+// memoryStructureType returns the snapshot type of a data structure value, or "" for other values
+func memoryStructureType(value interface{}) string {
+	switch value.(type) {
+	case memoryList:
+		return "list"
+	case memorySet:
+		return "set"
+	case memoryHash:
+		return "hash"
+	case memorySortedSet:
+		return "zset"
+	case memoryGeoSet:
+		return "geo"
+	}
+	return ""
+}
+
+// restoreMemoryStructure converts a value decoded from a snapshot into the data structure of
+// the given snapshot type
+func restoreMemoryStructure(structureType string, value interface{}) (interface{}, error) {
+	switch structureType {
+	case "":
+		return value, nil
+	case "list":
+		values, ok := value.([]interface{})
+		if !ok {
+			return nil, errNotAList
+		}
+		return memoryList(values), nil
+	case "set":
+		// The codec encodes a set as an object whose keys are the encoded members
+		members, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errNotASet
+		}
+		set := make(memorySet, len(members))
+		for member := range members {
+			set[member] = struct{}{}
+		}
+		return set, nil
+	case "hash":
+		fields, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errNotAHash
+		}
+		return memoryHash(fields), nil
+	case "zset":
+		members, ok := value.([]interface{})
+		if !ok {
+			return nil, errNotASortedSet
+		}
+		set := make(memorySortedSet, len(members))
+		for i, element := range members {
+			scored, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, errNotASortedSet
+			}
+			member, memberOK := scored["member"].(string)
+			score, scoreOK := scored["score"].(float64)
+			if !memberOK || !scoreOK {
+				return nil, errNotASortedSet
+			}
+			set[i] = ScoredMember{Member: member, Score: score}
+		}
+		return set, nil
+	case "geo":
+		members, ok := value.(map[string]interface{})
+		if !ok {
+			return nil, errNotAGeoSet
+		}
+		set := make(memoryGeoSet, len(members))
+		for member, element := range members {
+			position, ok := element.(map[string]interface{})
+			if !ok {
+				return nil, errNotAGeoSet
+			}
+			lon, lonOK := position["lon"].(float64)
+			lat, latOK := position["lat"].(float64)
+			if !lonOK || !latOK {
+				return nil, errNotAGeoSet
+			}
+			set[member] = geoPosition{Longitude: lon, Latitude: lat}
+		}
+		return set, nil
+	}
+	return nil, fmt.Errorf("unknown type %q", structureType)
+}
+
+// loadSnapshot restores the snapshot at path. A missing file leaves the repository empty.
+func (r *MemoryRepository) loadSnapshot(path string) error {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	defer file.Close()
+	return r.Restore(file)
+}
+
+// saveSnapshot writes a snapshot to path. It is written to a temporary file first and then
+// renamed, so a crash while saving never leaves a truncated snapshot behind.
+func (r *MemoryRepository) saveSnapshot(path string) error {
+	file, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	defer os.Remove(file.Name())
+
+	if err := r.Snapshot(file); err != nil {
+		file.Close()
+		return err
+	}
+	if err := file.Close(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if err := os.Rename(file.Name(), path); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
@@ -0,0 +1,80 @@
+// datarepository.memory.snapshot_test.go
+
+package datarepository
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestMemorySnapshotRestore(t *testing.T) {
+	ctx := context.Background()
+	source := newTestMemoryRepository(t, MemoryConfig{})
+	if err := source.Create(ctx, MemoryIdentifier("user:1"), map[string]interface{}{"name": "ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := source.CreateWithTTL(ctx, MemoryIdentifier("user:2"), map[string]interface{}{"name": "bob"}, time.Hour); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if err := source.CreateWithTTL(ctx, MemoryIdentifier("user:3"), map[string]interface{}{"name": "cy"}, 50*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if _, err := source.AtomicIncrement(ctx, MemoryIdentifier("visits:1")); err != nil {
+		t.Fatalf("AtomicIncrement: %v", err)
+	}
+	if _, err := source.ListPush(ctx, MemoryIdentifier("log:1"), "a", "b"); err != nil {
+		t.Fatalf("ListPush: %v", err)
+	}
+
+	var buf bytes.Buffer
+	if err := source.Snapshot(&buf); err != nil {
+		t.Fatalf("Snapshot: %v", err)
+	}
+	// user:3 is still in the snapshot but expires before it is restored
+	time.Sleep(100 * time.Millisecond)
+
+	target := newTestMemoryRepository(t, MemoryConfig{})
+	if err := target.Restore(&buf); err != nil {
+		t.Fatalf("Restore: %v", err)
+	}
+	var value map[string]interface{}
+	if err := target.Read(ctx, MemoryIdentifier("user:1"), &value); err != nil || value["name"] != "ann" {
+		t.Errorf("Read user:1: got %v, %v", value, err)
+	}
+	if ttl, err := target.GetExpiration(ctx, MemoryIdentifier("user:2")); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetExpiration user:2: got %v, %v, want up to an hour", ttl, err)
+	}
+	if err := target.Read(ctx, MemoryIdentifier("user:3"), &value); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read of the expired user:3: got %v, want ErrNotFound", err)
+	}
+	if count, err := target.AtomicIncrement(ctx, MemoryIdentifier("visits:1")); err != nil || count != 2 {
+		t.Errorf("AtomicIncrement of the restored counter: got %d, %v, want 2", count, err)
+	}
+	var entries []string
+	if err := target.ListRange(ctx, MemoryIdentifier("log:1"), 0, -1, &entries); err != nil || fmt.Sprint(entries) != "[a b]" {
+		t.Errorf("ListRange of the restored list: got %v, %v, want [a b]", entries, err)
+	}
+}
+
+func TestMemoryPersistPath(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "snapshot.json")
+	first := newTestMemoryRepository(t, MemoryConfig{PersistPath: path})
+	if err := first.Create(ctx, MemoryIdentifier("user:1"), "ann"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	second := newTestMemoryRepository(t, MemoryConfig{PersistPath: path})
+	var name string
+	if err := second.Read(ctx, MemoryIdentifier("user:1"), &name); err != nil || name != "ann" {
+		t.Errorf("Read after reloading: got %q, %v", name, err)
+	}
+}
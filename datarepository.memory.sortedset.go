@@ -0,0 +1,189 @@
+// datarepository.memory.sortedset.go
+
+package datarepository
+
+import (
+	"context"
+	"math"
+	"sort"
+)
+
+// memorySortedSet is the value of a sorted set entity, its members in ascending order
+type memorySortedSet []ScoredMember
+
+// lessScored reports whether a is ordered before b: by score, and by member for equal scores
+func lessScored(a, b ScoredMember) bool {
+	return a.Score < b.Score || (a.Score == b.Score && a.Member < b.Member)
+}
+
+// rank returns the index of member, or -1 if it isn't in the sorted set
+func (s memorySortedSet) rank(member string) int {
+	for i, scored := range s {
+		if scored.Member == member {
+			return i
+		}
+	}
+	return -1
+}
+
+// with returns a copy of the sorted set in which member has score. The sorted set itself is
+// left unchanged, so that it can be shared with transactions.
+func (s memorySortedSet) with(member string, score float64) memorySortedSet {
+	entry := ScoredMember{Member: member, Score: score}
+	result := make(memorySortedSet, 0, len(s)+1)
+	for _, scored := range s {
+		if scored.Member != member {
+			result = append(result, scored)
+		}
+	}
+	i := sort.Search(len(result), func(i int) bool { return !lessScored(result[i], entry) })
+	result = append(result, ScoredMember{})
+	copy(result[i+1:], result[i:])
+	result[i] = entry
+	return result
+}
+
+var _ SortedSetStore = (*MemoryRepository)(nil)
+
+func (r *MemoryRepository) ZAdd(ctx context.Context, identifier EntityIdentifier, member string, score float64) error {
+	if err := r.enter(ctx); err != nil {
+		return err
+	}
+	defer r.leave()
+	if math.IsNaN(score) {
+		return errNaNScore
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	set, err := r.sortedSetOf(key)
+	if err != nil {
+		return err
+	}
+	r.data[key] = set.with(member, score)
+	r.addKey(key)
+	return nil
+}
+
+func (r *MemoryRepository) ZRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, withScores bool) ([]ScoredMember, error) {
+	if err := r.enter(ctx); err != nil {
+		return nil, err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set, err := r.sortedSetOf(key)
+	if err != nil {
+		return nil, err
+	}
+	if set != nil {
+		r.touchKey(key)
+	}
+	from, to, ok := listRangeBounds(start, stop, int64(len(set)))
+	if !ok {
+		return []ScoredMember{}, nil
+	}
+	result := make([]ScoredMember, 0, to-from)
+	for _, scored := range set[from:to] {
+		if !withScores {
+			scored.Score = 0
+		}
+		result = append(result, scored)
+	}
+	return result, nil
+}
+
+func (r *MemoryRepository) ZRank(ctx context.Context, identifier EntityIdentifier, member string) (int64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+
+	key := identifier.String()
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	set, err := r.sortedSetOf(key)
+	if err != nil {
+		return 0, err
+	}
+	rank := set.rank(member)
+	if rank < 0 {
+		return 0, ErrNotFound
+	}
+	r.touchKey(key)
+	return int64(rank), nil
+}
+
+func (r *MemoryRepository) ZIncrBy(ctx context.Context, identifier EntityIdentifier, member string, delta float64) (float64, error) {
+	if err := r.enter(ctx); err != nil {
+		return 0, err
+	}
+	defer r.leave()
+	if math.IsNaN(delta) {
+		return 0, errNaNScore
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	key := identifier.String()
+	if r.isExpired(key) {
+		r.removeExpiredKey(key)
+	}
+	set, err := r.sortedSetOf(key)
+	if err != nil {
+		return 0, err
+	}
+	score := delta
+	if rank := set.rank(member); rank >= 0 {
+		score += set[rank].Score
+	}
+	if math.IsNaN(score) {
+		// Adding opposite infinities, which Redis rejects as well
+		return 0, errNaNScore
+	}
+	r.data[key] = set.with(member, score)
+	r.addKey(key)
+	return score, nil
+}
+
+// sortedSetOf returns the sorted set stored under key, or nil if there is none or it expired.
+// Returns errNotASortedSet if key holds another value. Requires at least r.mu's read lock.
+func (r *MemoryRepository) sortedSetOf(key string) (memorySortedSet, error) {
+	value, exists := r.data[key]
+	if !exists || r.isExpired(key) {
+		return nil, nil
+	}
+	set, ok := value.(memorySortedSet)
+	if !ok {
+		return nil, errNotASortedSet
+	}
+	return set, nil
+}
+
+var _ SortedSetStore = (*memoryNamespace)(nil)
+
+func (m *memoryNamespace) ZAdd(ctx context.Context, identifier EntityIdentifier, member string, score float64) error {
+	return m.inner.ZAdd(ctx, m.scope(identifier), member, score)
+}
+
+func (m *memoryNamespace) ZRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, withScores bool) ([]ScoredMember, error) {
+	return m.inner.ZRange(ctx, m.scope(identifier), start, stop, withScores)
+}
+
+func (m *memoryNamespace) ZRank(ctx context.Context, identifier EntityIdentifier, member string) (int64, error) {
+	return m.inner.ZRank(ctx, m.scope(identifier), member)
+}
+
+func (m *memoryNamespace) ZIncrBy(ctx context.Context, identifier EntityIdentifier, member string, delta float64) (float64, error) {
+	return m.inner.ZIncrBy(ctx, m.scope(identifier), member, delta)
+}
@@ -0,0 +1,545 @@
+// datarepository.memory_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"runtime"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestMemoryCloseStopsCleanup(t *testing.T) {
+	baseline := runtime.NumGoroutine()
+	repos := make([]DataRepository, 20)
+	for i := range repos {
+		repo, err := NewMemoryRepository(MemoryConfig{CleanupInterval: time.Millisecond})
+		if err != nil {
+			t.Fatalf("NewMemoryRepository: %v", err)
+		}
+		repos[i] = repo
+	}
+	time.Sleep(10 * time.Millisecond)
+	for _, repo := range repos {
+		if err := repo.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for runtime.NumGoroutine() > baseline {
+		if time.Now().After(deadline) {
+			t.Fatalf("goroutines: got %d after Close, want at most %d", runtime.NumGoroutine(), baseline)
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+}
+
+func TestMemoryHidesExpiredKeysWithoutSweep(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{CleanupInterval: -1, EagerSweepThreshold: 1000})
+	if err := repo.CreateWithTTL(ctx, MemoryIdentifier("user:1"), 1, 20*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if err := repo.CreateWithTTL(ctx, MemoryIdentifier("session:1"), 1, 20*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if err := repo.Create(ctx, MemoryIdentifier("user:2"), 2); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	identifiers, _, err := repo.List(ctx, "*")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	if got := identifierStrings(identifiers); len(got) != 1 || got[0] != "user:2" {
+		t.Errorf("List: got %v, want [user:2]", got)
+	}
+	paged, _, _, err := repo.ListPaged(ctx, "*", 0, 10)
+	if err != nil {
+		t.Fatalf("ListPaged: %v", err)
+	}
+	if got := identifierStrings(paged); len(got) != 1 || got[0] != "user:2" {
+		t.Errorf("ListPaged: got %v, want [user:2]", got)
+	}
+	if n, err := repo.Count(ctx, MemoryIdentifier("*")); err != nil || n != 1 {
+		t.Errorf("Count: got %d, %v, want 1, nil", n, err)
+	}
+	if prefixes, err := repo.EntityPrefixes(ctx); err != nil || len(prefixes) != 1 || prefixes[0] != "user" {
+		t.Errorf("EntityPrefixes: got %v, %v, want [user]", prefixes, err)
+	}
+	// The expired keys are still held, as nothing swept them
+	repo.mu.RLock()
+	held := len(repo.data)
+	repo.mu.RUnlock()
+	if held != 3 {
+		t.Errorf("held keys: got %d, want 3", held)
+	}
+}
+
+func TestMemoryExpirationOfUnsweptKeys(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{CleanupInterval: -1, EagerSweepThreshold: 1000})
+	for _, id := range []string{"user:1", "user:2"} {
+		if err := repo.CreateWithTTL(ctx, MemoryIdentifier(id), 1, 20*time.Millisecond); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+	}
+	time.Sleep(40 * time.Millisecond)
+
+	if ttl, err := repo.GetExpiration(ctx, MemoryIdentifier("user:1")); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExpiration of an expired key: got %v, %v, want ErrNotFound", ttl, err)
+	}
+	// Extending the expiration must not bring the entity back
+	if err := repo.SetExpiration(ctx, MemoryIdentifier("user:2"), time.Hour); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SetExpiration of an expired key: got %v, want ErrNotFound", err)
+	}
+	var value int
+	if err := repo.Read(ctx, MemoryIdentifier("user:2"), &value); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read after SetExpiration: got %d, %v, want ErrNotFound", value, err)
+	}
+	// Both calls removed the key they found expired
+	repo.mu.RLock()
+	held := len(repo.data)
+	repo.mu.RUnlock()
+	if held != 0 {
+		t.Errorf("held keys: got %d, want 0", held)
+	}
+}
+
+func TestMemoryValuesAreCopied(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	id := MemoryIdentifier("user:1")
+
+	type user struct {
+		Name string
+		Tags []string
+	}
+	original := &user{Name: "alice", Tags: []string{"a"}}
+	if err := repo.Create(ctx, id, original); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	original.Name = "mutated"
+	original.Tags[0] = "mutated"
+
+	var read user
+	if err := repo.Read(ctx, id, &read); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if read.Name != "alice" || read.Tags[0] != "a" {
+		t.Fatalf("Read after mutating the original: got %+v, want the created value", read)
+	}
+
+	var generic interface{}
+	if err := repo.Read(ctx, id, &generic); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	generic.(map[string]interface{})["Name"] = "mutated"
+
+	_, values, err := repo.List(ctx, "user:*")
+	if err != nil {
+		t.Fatalf("List: %v", err)
+	}
+	values[0].(map[string]interface{})["Name"] = "mutated"
+
+	_, paged, _, err := repo.ListPaged(ctx, "user:*", 0, 10)
+	if err != nil {
+		t.Fatalf("ListPaged: %v", err)
+	}
+	paged[0].(map[string]interface{})["Name"] = "mutated"
+	paged[0].(map[string]interface{})["Tags"].([]interface{})[0] = "mutated"
+
+	read = user{}
+	if err := repo.Read(ctx, id, &read); err != nil {
+		t.Fatalf("Read: %v", err)
+	}
+	if read.Name != "alice" || read.Tags[0] != "a" {
+		t.Errorf("Read after mutating returned values: got %+v, want the created value", read)
+	}
+}
+
+func TestMemoryEagerSweepOnTTLWrites(t *testing.T) {
+	ctx := context.Background()
+	sweeps := make(chan int, 10)
+	repo := newTestMemoryRepository(t, MemoryConfig{
+		CleanupInterval:     -1,
+		EagerSweepThreshold: 5,
+		OnSweep:             func(reclaimed int) { sweeps <- reclaimed },
+	})
+	for i := 0; i < 4; i++ {
+		if err := repo.CreateWithTTL(ctx, MemoryIdentifier(fmt.Sprintf("user:%d", i)), i, 10*time.Millisecond); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+	}
+	time.Sleep(20 * time.Millisecond)
+	// The fifth expiration reaches the threshold
+	if err := repo.UpsertWithTTL(ctx, MemoryIdentifier("user:4"), 4, time.Minute); err != nil {
+		t.Fatalf("UpsertWithTTL: %v", err)
+	}
+
+	select {
+	case reclaimed := <-sweeps:
+		if reclaimed != 4 {
+			t.Errorf("reclaimed: got %d, want 4", reclaimed)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no eager sweep after the threshold was reached")
+	}
+}
+
+func TestMemoryCloseWaitsForEagerSweep(t *testing.T) {
+	ctx := context.Background()
+	var sweeps, afterClose atomic.Int32
+	var closed atomic.Bool
+	repo, err := NewMemoryRepository(MemoryConfig{
+		CleanupInterval:     -1,
+		EagerSweepThreshold: 1,
+		OnSweep: func(int) {
+			sweeps.Add(1)
+			if closed.Load() {
+				afterClose.Add(1)
+			}
+		},
+	})
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+	ids := make([]EntityIdentifier, 100)
+	for i := range ids {
+		ids[i] = MemoryIdentifier(fmt.Sprintf("user:%d", i))
+		if err := repo.Create(ctx, ids[i], i); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	for _, id := range ids {
+		if err := repo.SetExpiration(ctx, id, time.Nanosecond); err != nil {
+			t.Fatalf("SetExpiration: %v", err)
+		}
+	}
+	if err := repo.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	closed.Store(true)
+	time.Sleep(20 * time.Millisecond)
+
+	if sweeps.Load() == 0 {
+		t.Error("no eager sweep ran")
+	}
+	if n := afterClose.Load(); n != 0 {
+		t.Errorf("OnSweep called %d times after Close returned", n)
+	}
+}
+
+// BenchmarkMemorySweepPause reports the longest a Read waits while 100000 expired keys are
+// swept, with one batch holding the lock for the whole sweep and with the default batches
+func BenchmarkMemorySweepPause(b *testing.B) {
+	for _, bench := range []struct {
+		name      string
+		batchSize int
+	}{
+		{"single-batch", math.MaxInt},
+		{"batched", DefaultSweepBatchSize},
+	} {
+		b.Run(bench.name, func(b *testing.B) {
+			ctx := context.Background()
+			var maxPause time.Duration
+			for i := 0; i < b.N; i++ {
+				b.StopTimer()
+				repo, err := NewMemoryRepository(MemoryConfig{CleanupInterval: -1, EagerSweepThreshold: math.MaxInt, SweepBatchSize: bench.batchSize})
+				if err != nil {
+					b.Fatalf("NewMemoryRepository: %v", err)
+				}
+				memory := repo.(*MemoryRepository)
+				items := make(map[EntityIdentifier]interface{}, 100000)
+				for j := 0; j < 100000; j++ {
+					items[MemoryIdentifier(fmt.Sprintf("user:%d", j))] = j
+				}
+				if err := repo.UpsertManyWithTTL(ctx, items, time.Nanosecond); err != nil {
+					b.Fatalf("UpsertManyWithTTL: %v", err)
+				}
+				if err := repo.Create(ctx, MemoryIdentifier("hot:1"), 1); err != nil {
+					b.Fatalf("Create: %v", err)
+				}
+				b.StartTimer()
+
+				done := make(chan struct{})
+				go func() {
+					memory.cleanupExpired()
+					close(done)
+				}()
+				var value int
+			reads:
+				for {
+					select {
+					case <-done:
+						break reads
+					default:
+					}
+					start := time.Now()
+					_ = repo.Read(ctx, MemoryIdentifier("hot:1"), &value)
+					if pause := time.Since(start); pause > maxPause {
+						maxPause = pause
+					}
+				}
+
+				b.StopTimer()
+				repo.Close()
+				b.StartTimer()
+			}
+			b.ReportMetric(float64(maxPause.Microseconds()), "max-pause-µs")
+		})
+	}
+}
+
+func TestMemoryReadIntoTargets(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	id := MemoryIdentifier("user:1")
+	type user struct {
+		Name string `json:"name"`
+		Age  int    `json:"age"`
+	}
+	if err := repo.Create(ctx, id, user{Name: "alice", Age: 30}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var typed user
+	if err := repo.Read(ctx, id, &typed); err != nil {
+		t.Fatalf("Read into *struct: %v", err)
+	}
+	if typed != (user{Name: "alice", Age: 30}) {
+		t.Errorf("Read into *struct: got %+v", typed)
+	}
+
+	var generic interface{}
+	if err := repo.Read(ctx, id, &generic); err != nil {
+		t.Fatalf("Read into *interface{}: %v", err)
+	}
+	fields, ok := generic.(map[string]interface{})
+	if !ok || fields["name"] != "alice" || fields["age"] != float64(30) {
+		t.Errorf("Read into *interface{}: got %#v", generic)
+	}
+
+	var nilUser *user
+	for name, target := range map[string]interface{}{
+		"non-pointer": typed,
+		"nil pointer": nilUser,
+		"nil":         nil,
+	} {
+		if err := repo.Read(ctx, id, target); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Read into %s: got %v, want ErrInvalidInput", name, err)
+		}
+	}
+
+	var wrongType []string
+	if err := repo.Read(ctx, id, &wrongType); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Read of an object into *[]string: got %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestMemoryHonorsCancelledContext(t *testing.T) {
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(context.Background(), id, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	cancelled, cancel := context.WithCancel(context.Background())
+	cancel()
+	expired, cancelExpired := context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancelExpired()
+
+	for _, tc := range []struct {
+		ctx  context.Context
+		want error
+	}{
+		{cancelled, context.Canceled},
+		{expired, context.DeadlineExceeded},
+	} {
+		ctx := tc.ctx
+		var value interface{}
+		ops := map[string]func() error{
+			"Create": func() error { return repo.Create(ctx, SimpleIdentifier("user:2"), 1) },
+			"Read":   func() error { return repo.Read(ctx, id, &value) },
+			"Update": func() error { return repo.Update(ctx, id, map[string]int{"a": 2}) },
+			"Upsert": func() error { return repo.Upsert(ctx, id, map[string]int{"a": 3}) },
+			"Delete": func() error { return repo.Delete(ctx, id) },
+			"List": func() error {
+				_, _, err := repo.List(ctx, "user:*")
+				return err
+			},
+			"Exists": func() error {
+				_, err := repo.Exists(ctx, id)
+				return err
+			},
+			"SetExpiration": func() error { return repo.SetExpiration(ctx, id, time.Minute) },
+			"Publish":       func() error { return repo.Publish(ctx, "events", "x") },
+			"Subscribe": func() error {
+				_, err := repo.Subscribe(ctx, "events")
+				return err
+			},
+		}
+		for name, op := range ops {
+			if err := op(); !errors.Is(err, tc.want) {
+				t.Errorf("%s: got %v, want %v", name, err, tc.want)
+			}
+		}
+	}
+
+	// Nothing was changed
+	var value map[string]int
+	if err := repo.Read(context.Background(), id, &value); err != nil || value["a"] != 1 {
+		t.Errorf("Read: got %v, %v, want the created value", value, err)
+	}
+	if _, err := repo.GetExpiration(context.Background(), id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExpiration: got %v, want ErrNotFound", err)
+	}
+	if exists, _ := repo.Exists(context.Background(), SimpleIdentifier("user:2")); exists {
+		t.Error("Create with a cancelled context created the entity")
+	}
+}
+
+func TestMemorySubscribeEndsWithContext(t *testing.T) {
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	ctx, cancel := context.WithCancel(context.Background())
+	ch, err := repo.Subscribe(ctx, "events")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	if err := repo.Publish(context.Background(), "events", "first"); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	if got := <-ch; got != "first" {
+		t.Errorf("message: got %v, want %q", got, "first")
+	}
+
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Error("got a message after the context was cancelled")
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("the channel was not closed after the context was cancelled")
+	}
+}
+
+func TestMemorySearchResultsTotalExceedsPage(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	for i := 1; i <= 5; i++ {
+		if err := repo.Create(ctx, MemoryIdentifier(fmt.Sprintf("user:%d", i)), map[string]interface{}{"role": "admin", "i": i}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, MemoryIdentifier("user:6"), map[string]interface{}{"role": "guest"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	response, err := repo.SearchResults(ctx, "admin", SearchOptions{Offset: 1, Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchResults: %v", err)
+	}
+	if response.Total != 5 || len(response.Hits) != 2 {
+		t.Fatalf("SearchResults: got Total %d with %d hits, want 5 with 2", response.Total, len(response.Hits))
+	}
+	for i, hit := range response.Hits {
+		want := fmt.Sprintf("user:%d", i+2)
+		if hit.Identifier.String() != want || hit.Value.(map[string]interface{})["role"] != "admin" {
+			t.Errorf("hit %d: got %s = %v, want %s with its value", i, hit.Identifier, hit.Value, want)
+		}
+	}
+}
+
+func TestMemorySearchSortsByField(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	for id, age := range map[string]int{"user:a": 40, "user:b": 7, "user:c": 25, "user:d": 100} {
+		if err := repo.Create(ctx, MemoryIdentifier(id), map[string]interface{}{"kind": "person", "age": age}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	// Without the field, the entity sorts first in ascending order
+	if err := repo.Create(ctx, MemoryIdentifier("user:e"), map[string]interface{}{"kind": "person"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	for _, tt := range []struct {
+		offset, limit int
+		sortDir       string
+		want          string
+	}{
+		{0, 10, "ASC", "[user:e user:b user:c user:a user:d]"},
+		{0, 10, "", "[user:e user:b user:c user:a user:d]"},
+		{0, 10, "DESC", "[user:d user:a user:c user:b user:e]"},
+		// Numbers sort by value, not by their text, so 100 comes after 40
+		{1, 2, "ASC", "[user:b user:c]"},
+		{1, 2, "DESC", "[user:a user:c]"},
+		{4, 10, "DESC", "[user:e]"},
+	} {
+		ids, err := repo.Search(ctx, "person", tt.offset, tt.limit, "age", tt.sortDir)
+		if err != nil {
+			t.Errorf("Search sorted by age %s from %d: %v", tt.sortDir, tt.offset, err)
+			continue
+		}
+		if got := fmt.Sprint(identifierStrings(ids)); got != tt.want {
+			t.Errorf("Search sorted by age %s from %d limit %d: got %s, want %s", tt.sortDir, tt.offset, tt.limit, got, tt.want)
+		}
+	}
+}
+
+// TestMemoryConcurrentAccessToExpiringKey is meant to be run with -race: readers race the
+// expiration of a key while writers keep recreating it
+func TestMemoryConcurrentAccessToExpiringKey(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{CleanupInterval: time.Millisecond})
+	id := MemoryIdentifier("session:1")
+	deadline := time.Now().Add(200 * time.Millisecond)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			for time.Now().Before(deadline) {
+				if err := repo.UpsertWithTTL(ctx, id, map[string]int{"n": 1}, time.Millisecond); err != nil {
+					t.Errorf("UpsertWithTTL: %v", err)
+					return
+				}
+			}
+		}()
+		go func() {
+			defer wg.Done()
+			var value map[string]int
+			for time.Now().Before(deadline) {
+				if err := repo.Read(ctx, id, &value); err != nil && !errors.Is(err, ErrNotFound) {
+					t.Errorf("Read: %v", err)
+					return
+				}
+				if _, err := repo.Exists(ctx, id); err != nil {
+					t.Errorf("Exists: %v", err)
+					return
+				}
+				if _, _, err := repo.List(ctx, "session:*"); err != nil && !errors.Is(err, ErrNotFound) {
+					t.Errorf("List: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	// Once expired, the key stays hidden until the sweeper removes it
+	time.Sleep(5 * time.Millisecond)
+	var value map[string]int
+	if err := repo.Read(ctx, id, &value); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read after expiration: got %v, want ErrNotFound", err)
+	}
+}
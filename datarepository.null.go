@@ -0,0 +1,365 @@
+// datarepository.null.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// NullConfig configures a NullRepository
+type NullConfig struct {
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator IDGenerator
+}
+
+func (c NullConfig) GetConnectionString() string {
+	return "null://"
+}
+
+// Validate always succeeds, as every NullConfig is valid
+func (c NullConfig) Validate() error {
+	return nil
+}
+
+// NullRepository is a DataRepository that stores nothing, for tests and benchmarks of code that
+// needs a repository without the overhead of a backend. Writes, deletes and expirations
+// succeed without effect, so every entity stays missing: reads and the operations that return
+// or compare a stored value return ErrNotFound, lists and searches are empty, and counters
+// start from 0 on every call. Locks are always acquired, published messages are dropped and
+// subscriptions receive nothing until they end. Only invalid arguments, such as a non-positive
+// TTL for IncrementWithExpiry or an invalid Query, are reported as errors.
+type NullRepository struct {
+	BaseRepository
+	idGen IDGenerator
+}
+
+var _ DataRepository = (*NullRepository)(nil)
+
+func NewNullRepository(config Config) (DataRepository, error) {
+	cfg, ok := config.(NullConfig)
+	if !ok && config != nil {
+		return nil, fmt.Errorf("%w: null repository needs a NullConfig, got %T", ErrInvalidInput, config)
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = UUIDv4Generator{}
+	}
+	repo := &NullRepository{idGen: cfg.IDGenerator}
+	repo.initBaseRepository()
+	return repo, nil
+}
+
+func (r *NullRepository) initBaseRepository() {
+	r.BaseRepository = BaseRepository{
+		plugins: make(map[string]RepositoryPlugin),
+	}
+}
+
+// nullSubscription is a subscription that never receives a message. Its channel is closed
+// when it is closed or its context is done.
+type nullSubscription struct {
+	ch   chan Message
+	once sync.Once
+}
+
+func newNullSubscription(ctx context.Context) *nullSubscription {
+	sub := &nullSubscription{ch: make(chan Message)}
+	go func() {
+		<-ctx.Done()
+		_ = sub.Close()
+	}()
+	return sub
+}
+
+func (s *nullSubscription) Messages() <-chan Message {
+	return s.ch
+}
+
+func (s *nullSubscription) Close() error {
+	s.once.Do(func() { close(s.ch) })
+	return nil
+}
+
+func (r *NullRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return nil
+}
+
+func (r *NullRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	return CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) EntityIdentifier {
+		return SimpleIdentifier(entityPrefix + DefaultKeySeparator + id)
+	})
+}
+
+func (r *NullRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (r *NullRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return nil
+}
+
+func (r *NullRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return ErrNotFound
+}
+
+func (r *NullRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	return 0, ErrNotFound
+}
+
+func (r *NullRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	return false, nil
+}
+
+func (r *NullRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	result := make(map[EntityIdentifier]bool, len(identifiers))
+	for _, identifier := range identifiers {
+		result[identifier] = false
+	}
+	return result, nil
+}
+
+func (r *NullRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return nil
+}
+
+func (r *NullRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return nil
+}
+
+func (r *NullRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	return nil
+}
+
+func (r *NullRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return nil
+}
+
+func (r *NullRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return nil
+}
+
+func (r *NullRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	return false, ErrNotFound
+}
+
+func (r *NullRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	return expectedVersion + 1, nil
+}
+
+func (r *NullRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return 0, ErrNotFound
+}
+
+func (r *NullRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return ErrNotFound
+}
+
+func (r *NullRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	return nil
+}
+
+func (r *NullRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return ErrNotFound
+}
+
+func (r *NullRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	return ErrNotFound
+}
+
+func (r *NullRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	return nil
+}
+
+// ReadMany reports all entities as missing
+func (r *NullRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	batchErr := &BatchError{}
+	for _, identifier := range identifiers {
+		batchErr.Add(identifier, ErrNotFound)
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *NullRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return ReadManyOrdered(ctx, r, JSONCodec{}, identifiers, dest)
+}
+
+func (r *NullRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	return nil
+}
+
+func (r *NullRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := checkDeletePattern(pattern); err != nil {
+		return 0, err
+	}
+	return 0, nil
+}
+
+func (r *NullRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	return []EntityIdentifier{}, []interface{}{}, nil
+}
+
+func (r *NullRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	return ListResult{Identifiers: []EntityIdentifier{}, Entities: []interface{}{}}, nil
+}
+
+func (r *NullRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	return []EntityIdentifier{}, []interface{}{}, 0, nil
+}
+
+func (r *NullRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	return []EntityIdentifier{}, "", nil
+}
+
+func (r *NullRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	return 0, nil
+}
+
+func (r *NullRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return nil
+}
+
+func (r *NullRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	return []string{}, nil
+}
+
+func (r *NullRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *NullRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	return []EntityIdentifier{}, nil
+}
+
+func (r *NullRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	return SearchResult{Identifiers: []EntityIdentifier{}}, nil
+}
+
+func (r *NullRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	return SearchResponse{Hits: []Hit{}}, nil
+}
+
+func (r *NullRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	if err := query.Validate(); err != nil {
+		return SearchResponse{}, err
+	}
+	return SearchResponse{Hits: []Hit{}}, nil
+}
+
+func (r *NullRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (r *NullRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	return NewLockToken(), true, nil
+}
+
+func (r *NullRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	return nil
+}
+
+func (r *NullRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	return nil
+}
+
+func (r *NullRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	return true, nil
+}
+
+func (r *NullRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	return nil
+}
+
+// Subscribe returns a channel that receives nothing and is closed when ctx is done
+func (r *NullRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	ch := make(chan interface{})
+	go func() {
+		<-ctx.Done()
+		close(ch)
+	}()
+	return ch, nil
+}
+
+func (r *NullRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	return newNullSubscription(ctx), nil
+}
+
+func (r *NullRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	return newNullSubscription(ctx), nil
+}
+
+func (r *NullRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	return nil
+}
+
+func (r *NullRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	return nil
+}
+
+func (r *NullRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	return false, nil
+}
+
+func (r *NullRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	return 0, ErrNotFound
+}
+
+func (r *NullRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	return nil
+}
+
+func (r *NullRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	return ErrNotFound
+}
+
+func (r *NullRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return 1, nil
+}
+
+func (r *NullRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return delta, nil
+}
+
+func (r *NullRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return -delta, nil
+}
+
+func (r *NullRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	if delta > max {
+		return 0, false, nil
+	}
+	return delta, true, nil
+}
+
+func (r *NullRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	return delta, nil
+}
+
+func (r *NullRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	return delta, nil
+}
+
+func (r *NullRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return 0, ErrNotFound
+}
+
+func (r *NullRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	return nil
+}
+
+func (r *NullRepository) Ping(ctx context.Context) error {
+	return nil
+}
+
+func (r *NullRepository) Close() error {
+	return nil
+}
+
+// WithTransaction runs fn with the repository itself, as there is nothing to isolate or roll back
+func (r *NullRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	return fn(r)
+}
@@ -0,0 +1,222 @@
+// datarepository.null_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+type echoPlugin struct{}
+
+func (echoPlugin) Name() string { return "echo" }
+
+func (echoPlugin) Execute(ctx context.Context, command string, args ...interface{}) (interface{}, error) {
+	return command, nil
+}
+
+func TestNullRepository(t *testing.T) {
+	repo, err := CreateDataRepository("null", NullConfig{})
+	if err != nil {
+		t.Fatalf("CreateDataRepository: %v", err)
+	}
+	defer repo.Close()
+	ctx := context.Background()
+	id := SimpleIdentifier("user:1")
+	ids := []EntityIdentifier{id, SimpleIdentifier("user:2")}
+	items := map[EntityIdentifier]interface{}{id: "a"}
+	var value interface{}
+
+	// Writes succeed without effect
+	for name, err := range map[string]error{
+		"Create":            repo.Create(ctx, id, "a"),
+		"CreateWithTTL":     repo.CreateWithTTL(ctx, id, "a", time.Minute),
+		"Upsert":            repo.Upsert(ctx, id, "a"),
+		"UpsertWithTTL":     repo.UpsertWithTTL(ctx, id, "a", time.Minute),
+		"UpsertManyWithTTL": repo.UpsertManyWithTTL(ctx, items, time.Minute),
+		"Update":            repo.Update(ctx, id, "a"),
+		"UpdateField":       repo.UpdateField(ctx, id, "name", "a"),
+		"CreateMany":        repo.CreateMany(ctx, items),
+		"Delete":            repo.Delete(ctx, id),
+		"DeleteMany":        repo.DeleteMany(ctx, ids),
+		"SetExpiration":     repo.SetExpiration(ctx, id, time.Minute),
+		"SetExpirationMany": repo.SetExpirationMany(ctx, ids, time.Minute),
+		"Persist":           repo.Persist(ctx, id),
+		"SetCounter":        repo.SetCounter(ctx, id, 5),
+		"ReleaseLock":       repo.ReleaseLock(ctx, id),
+		"Publish":           repo.Publish(ctx, "events", "hello"),
+		"Ping":              repo.Ping(ctx),
+	} {
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+	}
+	if generated, err := repo.CreateWithGeneratedID(ctx, "user", "a"); err != nil || generated == nil {
+		t.Errorf("CreateWithGeneratedID: got %v, %v", generated, err)
+	}
+	if created, err := repo.CreateIfAbsent(ctx, id, "a", time.Minute); err != nil || !created {
+		t.Errorf("CreateIfAbsent: got %v, %v, want true", created, err)
+	}
+	if version, err := repo.UpdateWithVersion(ctx, id, "a", 3); err != nil || version != 4 {
+		t.Errorf("UpdateWithVersion: got %d, %v, want 4", version, err)
+	}
+	if n, err := repo.DeletePattern(ctx, SimpleIdentifier("user:*")); err != nil || n != 0 {
+		t.Errorf("DeletePattern: got %d, %v, want 0", n, err)
+	}
+	if applied, err := repo.SetExpirationCond(ctx, id, time.Minute, ExpireNX); err != nil || applied {
+		t.Errorf("SetExpirationCond: got %v, %v, want false", applied, err)
+	}
+
+	// Reads find nothing
+	for name, err := range map[string]error{
+		"Read":         repo.Read(ctx, id, &value),
+		"ReadField":    repo.ReadField(ctx, id, "name", &value),
+		"GetAndDelete": repo.GetAndDelete(ctx, id, &value),
+		"GetAndSet":    repo.GetAndSet(ctx, id, "b", &value),
+		"Touch":        repo.Touch(ctx, id),
+		"ReadMany":     repo.ReadMany(ctx, ids, func(EntityIdentifier, []byte) error { return nil }),
+	} {
+		if !errors.Is(err, ErrNotFound) {
+			t.Errorf("%s: got %v, want ErrNotFound", name, err)
+		}
+	}
+	var ordered []*string
+	if err := repo.ReadManyOrdered(ctx, ids, &ordered); err != nil || len(ordered) != 2 || ordered[0] != nil {
+		t.Errorf("ReadManyOrdered: got %v, %v, want two nil placeholders", ordered, err)
+	}
+	if _, err := repo.ReadWithTTL(ctx, id, &value); !errors.Is(err, ErrNotFound) {
+		t.Errorf("ReadWithTTL: got %v, want ErrNotFound", err)
+	}
+	if _, err := repo.GetVersion(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetVersion: got %v, want ErrNotFound", err)
+	}
+	if _, err := repo.GetExpiration(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetExpiration: got %v, want ErrNotFound", err)
+	}
+	if _, err := repo.GetCounter(ctx, id); !errors.Is(err, ErrNotFound) {
+		t.Errorf("GetCounter: got %v, want ErrNotFound", err)
+	}
+	if swapped, err := repo.CompareAndSwap(ctx, id, "a", "b"); !errors.Is(err, ErrNotFound) || swapped {
+		t.Errorf("CompareAndSwap: got %v, %v, want ErrNotFound", swapped, err)
+	}
+	if exists, err := repo.Exists(ctx, id); err != nil || exists {
+		t.Errorf("Exists: got %v, %v, want false", exists, err)
+	}
+	if exists, err := repo.ExistsMany(ctx, ids); err != nil || len(exists) != 2 || exists[id] {
+		t.Errorf("ExistsMany: got %v, %v, want both missing", exists, err)
+	}
+
+	// Lists and searches are empty
+	if found, values, err := repo.List(ctx, "user:*"); err != nil || len(found) != 0 || len(values) != 0 {
+		t.Errorf("List: got %v, %v, %v", found, values, err)
+	}
+	if result, err := repo.ListDetailed(ctx, "user:*"); err != nil || len(result.Identifiers) != 0 {
+		t.Errorf("ListDetailed: got %+v, %v", result, err)
+	}
+	if found, _, cursor, err := repo.ListPaged(ctx, "user:*", 0, 10); err != nil || len(found) != 0 || cursor != 0 {
+		t.Errorf("ListPaged: got %v, cursor %d, %v", found, cursor, err)
+	}
+	if found, cursor, err := repo.ListPage(ctx, "user:*", "", 10); err != nil || len(found) != 0 || cursor != "" {
+		t.Errorf("ListPage: got %v, cursor %q, %v", found, cursor, err)
+	}
+	if n, err := repo.Count(ctx, SimpleIdentifier("user:*")); err != nil || n != 0 {
+		t.Errorf("Count: got %d, %v, want 0", n, err)
+	}
+	if err := repo.Iterate(ctx, SimpleIdentifier("user:*"), func(EntityIdentifier, []byte) error {
+		t.Error("Iterate called fn")
+		return nil
+	}); err != nil {
+		t.Errorf("Iterate: %v", err)
+	}
+	if prefixes, err := repo.EntityPrefixes(ctx); err != nil || len(prefixes) != 0 {
+		t.Errorf("EntityPrefixes: got %v, %v", prefixes, err)
+	}
+	if found, err := repo.Search(ctx, "*", 0, 10, "", ""); err != nil || len(found) != 0 {
+		t.Errorf("Search: got %v, %v", found, err)
+	}
+	if result, err := repo.SearchDetailed(ctx, "*", 0, 10, "", ""); err != nil || len(result.Identifiers) != 0 {
+		t.Errorf("SearchDetailed: got %+v, %v", result, err)
+	}
+	if response, err := repo.SearchResults(ctx, "*", SearchOptions{Limit: 10}); err != nil || response.Total != 0 || len(response.Hits) != 0 {
+		t.Errorf("SearchResults: got %+v, %v", response, err)
+	}
+	if response, err := repo.SearchQuery(ctx, NewQuery().Field("name").Equals("ann"), SearchOptions{Limit: 10}); err != nil || len(response.Hits) != 0 {
+		t.Errorf("SearchQuery: got %+v, %v", response, err)
+	}
+
+	// Counters start from 0 on every call
+	if n, err := repo.AtomicIncrement(ctx, id); err != nil || n != 1 {
+		t.Errorf("AtomicIncrement: got %d, %v, want 1", n, err)
+	}
+	if n, err := repo.IncrementBy(ctx, id, 5); err != nil || n != 5 {
+		t.Errorf("IncrementBy: got %d, %v, want 5", n, err)
+	}
+	if n, err := repo.DecrementBy(ctx, id, 5); err != nil || n != -5 {
+		t.Errorf("DecrementBy: got %d, %v, want -5", n, err)
+	}
+	if n, ok, err := repo.IncrementWithLimit(ctx, id, 5, 3); err != nil || ok || n != 0 {
+		t.Errorf("IncrementWithLimit over the limit: got %d, %v, %v, want 0, false", n, ok, err)
+	}
+	if n, err := repo.IncrementWithExpiry(ctx, id, 5, time.Minute); err != nil || n != 5 {
+		t.Errorf("IncrementWithExpiry: got %d, %v, want 5", n, err)
+	}
+	if _, err := repo.IncrementWithExpiry(ctx, id, 5, 0); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("IncrementWithExpiry without TTL: got %v, want ErrInvalidInput", err)
+	}
+	if n, err := repo.IncrementFloat(ctx, id, 1.5); err != nil || n != 1.5 {
+		t.Errorf("IncrementFloat: got %v, %v, want 1.5", n, err)
+	}
+
+	// Locks are always acquired
+	if acquired, err := repo.AcquireLock(ctx, id, time.Minute); err != nil || !acquired {
+		t.Errorf("AcquireLock: got %v, %v, want true", acquired, err)
+	}
+	token, acquired, err := repo.AcquireLockWithToken(ctx, id, time.Minute)
+	if err != nil || !acquired || token == "" {
+		t.Errorf("AcquireLockWithToken: got %q, %v, %v", token, acquired, err)
+	}
+	if renewed, err := repo.RenewLock(ctx, id, token, time.Minute); err != nil || !renewed {
+		t.Errorf("RenewLock: got %v, %v, want true", renewed, err)
+	}
+	if err := repo.ReleaseLockWithToken(ctx, id, token); err != nil {
+		t.Errorf("ReleaseLockWithToken: %v", err)
+	}
+
+	// Subscriptions receive nothing and end with their context
+	subCtx, cancel := context.WithCancel(ctx)
+	ch, err := repo.Subscribe(subCtx, "events")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+	sub, err := repo.SubscribeMessages(subCtx, "events")
+	if err != nil {
+		t.Fatalf("SubscribeMessages: %v", err)
+	}
+	psub, err := repo.PSubscribe(ctx, "events.*")
+	if err != nil {
+		t.Fatalf("PSubscribe: %v", err)
+	}
+	cancel()
+	if _, ok := <-ch; ok {
+		t.Error("Subscribe: received a message")
+	}
+	if _, ok := <-sub.Messages(); ok {
+		t.Error("SubscribeMessages: received a message")
+	}
+	psub.Close()
+	if _, ok := <-psub.Messages(); ok {
+		t.Error("PSubscribe: received a message")
+	}
+
+	if err := repo.WithTransaction(ctx, func(tx DataRepository) error { return tx.Create(ctx, id, "a") }); err != nil {
+		t.Errorf("WithTransaction: %v", err)
+	}
+	if err := repo.RegisterPlugin(echoPlugin{}); err != nil {
+		t.Fatalf("RegisterPlugin: %v", err)
+	}
+	if plugin, ok := repo.GetPlugin("echo"); !ok || plugin.Name() != "echo" {
+		t.Errorf("GetPlugin: got %v, %v", plugin, ok)
+	}
+}
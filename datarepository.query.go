@@ -0,0 +1,298 @@
+// datarepository.query.go
+
+package datarepository
+
+import (
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Query is a structured search query for SearchQuery. Each backend compiles it to its native
+// form, so the same query has the same meaning everywhere. Conditions are chained:
+//
+//	query := NewQuery().Field("city").Tag("Berlin", "Hamburg").And().Field("age").Range(18, 65)
+//
+// Consecutive conditions must all match, while Or starts an alternative, so a.And().b.Or().c
+// matches entities that match both a and b, or c. A query without conditions matches all
+// entities. Field names are dotted paths into the stored values, e.g. "address.city".
+// If a condition targets an array, it matches if any element matches.
+type Query struct {
+	groups [][]QueryCondition
+	field  []string
+	err    error
+}
+
+// QueryOperator is the kind of a QueryCondition
+type QueryOperator int
+
+const (
+	// QueryEquals matches a field equal to Value
+	QueryEquals QueryOperator = iota
+	// QueryRange matches a number between Min and Max, inclusively
+	QueryRange
+	// QueryTag matches a field equal to one of Tags
+	QueryTag
+)
+
+// QueryCondition is a single condition on a field of a Query
+type QueryCondition struct {
+	// Field is the path to the field, split into its parts
+	Field    []string
+	Operator QueryOperator
+	// Value is the string, float64 or bool of an Equals condition
+	Value    interface{}
+	Min, Max float64
+	Tags     []string
+}
+
+// NewQuery returns an empty query, which matches all entities
+func NewQuery() *Query {
+	return &Query{groups: [][]QueryCondition{{}}}
+}
+
+// Field selects the field the next condition applies to
+func (q *Query) Field(name string) *Query {
+	if q.field != nil {
+		q.fail(fmt.Errorf("%w: field %q has no condition", ErrInvalidInput, strings.Join(q.field, ".")))
+	}
+	parts, err := SplitFieldPath(name)
+	if err != nil {
+		q.fail(err)
+		return q
+	}
+	q.field = parts
+	return q
+}
+
+// Equals matches entities whose field equals value, which must be a string, number or bool
+func (q *Query) Equals(value interface{}) *Query {
+	switch v := value.(type) {
+	case string, bool:
+		return q.add(QueryCondition{Operator: QueryEquals, Value: v})
+	}
+	number, ok := queryNumber(value)
+	if !ok {
+		q.fail(fmt.Errorf("%w: cannot compare with value of type %T", ErrInvalidInput, value))
+		return q
+	}
+	return q.add(QueryCondition{Operator: QueryEquals, Value: number})
+}
+
+// Range matches entities whose field is a number between min and max, inclusively.
+// Use math.Inf for open ranges.
+func (q *Query) Range(min, max float64) *Query {
+	if math.IsNaN(min) || math.IsNaN(max) || min > max {
+		q.fail(fmt.Errorf("%w: invalid range [%v, %v]", ErrInvalidInput, min, max))
+		return q
+	}
+	return q.add(QueryCondition{Operator: QueryRange, Min: min, Max: max})
+}
+
+// Tag matches entities whose field is one of the given strings
+func (q *Query) Tag(values ...string) *Query {
+	if len(values) == 0 {
+		q.fail(fmt.Errorf("%w: tag condition needs at least one value", ErrInvalidInput))
+		return q
+	}
+	return q.add(QueryCondition{Operator: QueryTag, Tags: values})
+}
+
+// And requires the next condition to match as well. Consecutive conditions are combined with
+// And by default, so it only serves readability.
+func (q *Query) And() *Query {
+	return q
+}
+
+// Or starts an alternative to the conditions before it
+func (q *Query) Or() *Query {
+	q.groups = append(q.groups, nil)
+	return q
+}
+
+// add appends a condition on the selected field to the current group
+func (q *Query) add(condition QueryCondition) *Query {
+	if q.field == nil {
+		q.fail(fmt.Errorf("%w: condition without a field", ErrInvalidInput))
+		return q
+	}
+	condition.Field = q.field
+	q.field = nil
+	last := len(q.groups) - 1
+	q.groups[last] = append(q.groups[last], condition)
+	return q
+}
+
+// fail records the first error made while building the query
+func (q *Query) fail(err error) {
+	if q.err == nil {
+		q.err = err
+	}
+}
+
+// Validate returns the first error made while building the query, or ErrInvalidInput if the
+// query is nil or incomplete
+func (q *Query) Validate() error {
+	if q == nil {
+		return fmt.Errorf("%w: query must not be nil", ErrInvalidInput)
+	}
+	if q.err != nil {
+		return q.err
+	}
+	if q.field != nil {
+		return fmt.Errorf("%w: field %q has no condition", ErrInvalidInput, strings.Join(q.field, "."))
+	}
+	if len(q.groups) > 1 {
+		for _, group := range q.groups {
+			if len(group) == 0 {
+				return fmt.Errorf("%w: Or without conditions on both sides", ErrInvalidInput)
+			}
+		}
+	}
+	return nil
+}
+
+// Groups returns the alternatives of a validated query: it matches entities that match all
+// conditions of any group. Backends compile it from them.
+func (q *Query) Groups() [][]QueryCondition {
+	return q.groups
+}
+
+// matches evaluates the query against a generic value (maps, slices and scalars)
+func (q *Query) matches(doc interface{}) bool {
+	for _, group := range q.groups {
+		matched := true
+		for _, condition := range group {
+			if !condition.matches(doc) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (c QueryCondition) matches(doc interface{}) bool {
+	value, err := GetFieldPath(doc, c.Field)
+	if err != nil {
+		return false
+	}
+	if elements, isArray := value.([]interface{}); isArray {
+		for _, element := range elements {
+			if c.matchesValue(element) {
+				return true
+			}
+		}
+		return false
+	}
+	return c.matchesValue(value)
+}
+
+func (c QueryCondition) matchesValue(value interface{}) bool {
+	switch c.Operator {
+	case QueryEquals:
+		if want, isNumber := c.Value.(float64); isNumber {
+			number, ok := queryNumber(value)
+			return ok && number == want
+		}
+		return value == c.Value
+	case QueryRange:
+		number, ok := queryNumber(value)
+		return ok && number >= c.Min && number <= c.Max
+	case QueryTag:
+		s, ok := value.(string)
+		if !ok {
+			return false
+		}
+		for _, tag := range c.Tags {
+			if s == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// redisSearch compiles the query to the RediSearch query syntax. Field names refer to index
+// attributes; strings and bools compare with TAG fields, numbers with NUMERIC fields.
+func (q *Query) redisSearch() string {
+	var groups []string
+	for _, group := range q.groups {
+		conditions := make([]string, 0, len(group))
+		for _, c := range group {
+			conditions = append(conditions, c.redisSearch())
+		}
+		if len(conditions) > 0 {
+			groups = append(groups, "("+strings.Join(conditions, " ")+")")
+		}
+	}
+	if len(groups) == 0 {
+		return "*"
+	}
+	return strings.Join(groups, " | ")
+}
+
+func (c QueryCondition) redisSearch() string {
+	field := "@" + escapeRedisSearch(strings.Join(c.Field, "."))
+	switch c.Operator {
+	case QueryEquals:
+		switch v := c.Value.(type) {
+		case float64:
+			return fmt.Sprintf("%s:[%s %s]", field, formatRedisSearchNumber(v), formatRedisSearchNumber(v))
+		case bool:
+			return fmt.Sprintf("%s:{%t}", field, v)
+		default:
+			return fmt.Sprintf("%s:{%s}", field, escapeRedisSearch(v.(string)))
+		}
+	case QueryRange:
+		return fmt.Sprintf("%s:[%s %s]", field, formatRedisSearchNumber(c.Min), formatRedisSearchNumber(c.Max))
+	default:
+		tags := make([]string, 0, len(c.Tags))
+		for _, tag := range c.Tags {
+			tags = append(tags, escapeRedisSearch(tag))
+		}
+		return fmt.Sprintf("%s:{%s}", field, strings.Join(tags, " | "))
+	}
+}
+
+// escapeRedisSearch escapes all characters that have a meaning in RediSearch queries
+func escapeRedisSearch(s string) string {
+	var sb strings.Builder
+	for _, r := range s {
+		if !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_' {
+			sb.WriteByte('\\')
+		}
+		sb.WriteRune(r)
+	}
+	return sb.String()
+}
+
+func formatRedisSearchNumber(f float64) string {
+	switch {
+	case math.IsInf(f, 1):
+		return "+inf"
+	case math.IsInf(f, -1):
+		return "-inf"
+	}
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// queryNumber converts any Go number to float64
+func queryNumber(value interface{}) (float64, bool) {
+	v := reflect.ValueOf(value)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int()), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		return v.Float(), true
+	}
+	return 0, false
+}
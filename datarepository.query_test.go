@@ -0,0 +1,126 @@
+// datarepository.query_test.go
+
+package datarepository
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/alicebob/miniredis/v2"
+	miniserver "github.com/alicebob/miniredis/v2/server"
+)
+
+// queryFixture are the entities the queries of TestSearchQueryIsConsistentAcrossBackends run on
+var queryFixture = map[string]map[string]interface{}{
+	"user:1": {"city": "Berlin", "age": 25, "admin": true},
+	"user:2": {"city": "Hamburg", "age": 40, "admin": false},
+	"user:3": {"city": "Berlin", "age": 70, "admin": false},
+	"user:4": {"city": "New York", "age": 33, "admin": true, "address": map[string]interface{}{"zip": "10001"}},
+}
+
+// fakeQueryServer returns a miniredis server that pretends to have the RedisJSON and RediSearch
+// modules. Its FT.SEARCH answers each RediSearch query of results with the fixture documents of
+// its identifiers, as RediSearch would, and fails for other queries
+func fakeQueryServer(t *testing.T, results map[string][]string) *miniredis.Miniredis {
+	t.Helper()
+	s := miniredis.RunT(t)
+	if err := s.Server().Register("JSON.GET", func(c *miniserver.Peer, cmd string, args []string) {
+		c.WriteNull()
+	}); err != nil {
+		t.Fatalf("Register JSON.GET: %v", err)
+	}
+	if err := s.Server().Register("FT.SEARCH", func(c *miniserver.Peer, cmd string, args []string) {
+		ids, ok := results[args[1]]
+		if !ok {
+			c.WriteError(fmt.Sprintf("unexpected query %s", args[1]))
+			return
+		}
+		c.WriteLen(1 + 2*len(ids))
+		c.WriteInt(len(ids))
+		for _, id := range ids {
+			doc, _ := json.Marshal(queryFixture[id])
+			c.WriteBulk("app:" + id)
+			c.WriteLen(2)
+			c.WriteBulk("$")
+			c.WriteBulk(string(doc))
+		}
+	}); err != nil {
+		t.Fatalf("Register FT.SEARCH: %v", err)
+	}
+	return s
+}
+
+func TestSearchQueryIsConsistentAcrossBackends(t *testing.T) {
+	ctx := context.Background()
+	tests := []struct {
+		query       *Query
+		redisSearch string
+		want        []string
+	}{
+		{NewQuery(), "*", []string{"user:1", "user:2", "user:3", "user:4"}},
+		{NewQuery().Field("city").Equals("Berlin"), "(@city:{Berlin})", []string{"user:1", "user:3"}},
+		{NewQuery().Field("age").Range(30, 65), "(@age:[30 65])", []string{"user:2", "user:4"}},
+		{NewQuery().Field("age").Equals(40), "(@age:[40 40])", []string{"user:2"}},
+		{NewQuery().Field("admin").Equals(true), "(@admin:{true})", []string{"user:1", "user:4"}},
+		{NewQuery().Field("city").Tag("Hamburg", "New York"), `(@city:{Hamburg | New\ York})`, []string{"user:2", "user:4"}},
+		{
+			NewQuery().Field("city").Equals("Berlin").And().Field("age").Range(60, 100).Or().Field("city").Equals("Hamburg"),
+			"(@city:{Berlin} @age:[60 100]) | (@city:{Hamburg})",
+			[]string{"user:2", "user:3"},
+		},
+		{NewQuery().Field("address.zip").Equals("10001"), `(@address\.zip:{10001})`, []string{"user:4"}},
+	}
+
+	memory := newTestMemoryRepository(t, MemoryConfig{})
+	for id, value := range queryFixture {
+		if err := memory.Create(ctx, MemoryIdentifier(id), value); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	results := make(map[string][]string)
+	for _, tt := range tests {
+		results[tt.redisSearch] = tt.want
+	}
+	redisRepo := newTestRedisRepositoryOn(t, fakeQueryServer(t, results), RedisConfig{StorageMode: RedisStorageJSON})
+
+	for _, tt := range tests {
+		if got := tt.query.redisSearch(); got != tt.redisSearch {
+			t.Errorf("redisSearch: got %s, want %s", got, tt.redisSearch)
+		}
+		for name, repo := range map[string]DataRepository{"memory": memory, "redis": redisRepo} {
+			response, err := repo.SearchQuery(ctx, tt.query, SearchOptions{Limit: 10})
+			if err != nil {
+				t.Errorf("%s SearchQuery(%s): %v", name, tt.redisSearch, err)
+				continue
+			}
+			var ids []string
+			for _, hit := range response.Hits {
+				ids = append(ids, hit.Identifier.String())
+			}
+			if fmt.Sprint(ids) != fmt.Sprint(tt.want) || response.Total != int64(len(tt.want)) {
+				t.Errorf("%s SearchQuery(%s): got %v of %d, want %v", name, tt.redisSearch, ids, response.Total, tt.want)
+			}
+		}
+	}
+}
+
+func TestSearchQueryRejectsInvalidQueries(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMemoryRepository(t, MemoryConfig{})
+	for name, query := range map[string]*Query{
+		"nil":                       nil,
+		"field without a condition": NewQuery().Field("city"),
+		"condition without a field": NewQuery().Equals("Berlin"),
+		"inverted range":            NewQuery().Field("age").Range(65, 30),
+		"empty tag":                 NewQuery().Field("city").Tag(),
+		"unsupported value":         NewQuery().Field("city").Equals([]string{"Berlin"}),
+		"dangling Or":               NewQuery().Field("city").Equals("Berlin").Or(),
+	} {
+		if _, err := repo.SearchQuery(ctx, query, SearchOptions{Limit: 10}); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("SearchQuery with %s: got %v, want ErrInvalidInput", name, err)
+		}
+	}
+}
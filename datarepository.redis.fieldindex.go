@@ -0,0 +1,166 @@
+// datarepository.redis.fieldindex.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// removeStaleIndexEntryScript removes a key from an index set if the key no longer exists.
+// Returns 1 if it was removed and 0 otherwise.
+var removeStaleIndexEntryScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[2]) == 1 then
+	return 0
+end
+return redis.call("SREM", KEYS[1], KEYS[2])
+`)
+
+var _ FieldIndexer = (*RedisRepository)(nil)
+
+// CreateFieldIndex defines the index named field. The index is kept in a SET per value, stored
+// at prefix:_index:field:value, and updated in the same MULTI/EXEC transaction as each write of
+// a document. While indexes are defined, writes therefore run like WithTransaction: they need a
+// standalone or sentinel client, as the index sets are served by other cluster nodes than the
+// entities.
+//
+// Indexes are defined per repository and not stored in Redis: documents are only indexed when
+// written by a repository with the index defined, and documents stored before are not indexed
+// until they are written again. Namespace views share the indexes of their repository but keep
+// their own index sets.
+//
+// Not to be confused with CreateIndex, which creates a RediSearch index.
+func (r *RedisRepository) CreateFieldIndex(field string, extractor FieldExtractor) error {
+	if err := validateFieldIndex(field, extractor); err != nil {
+		return err
+	}
+	r.fieldIndexes.define(field, extractor)
+	return nil
+}
+
+// FindByIndex reads the index set of value and returns the entities whose documents are still
+// indexed under it. Entries of entities that expired or were deleted without maintaining the
+// index are removed from the set.
+func (r *RedisRepository) FindByIndex(ctx context.Context, field, value string) ([]EntityIdentifier, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	extractor, ok := r.fieldIndexes.extractor(field)
+	if !ok {
+		return nil, errUnknownFieldIndex(field)
+	}
+	indexKey := r.fieldIndexKey(field, value)
+	members, err := r.reader.SMembers(ctx, indexKey).Result()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	set := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		set[member] = struct{}{}
+	}
+	keys := sortedKeys(set)
+
+	cmds := make([]*redis.Cmd, len(keys))
+	if len(keys) > 0 {
+		pipe := r.reader.Pipeline()
+		for i, key := range keys {
+			cmds[i] = pipe.Do(ctx, r.docGet(key)...)
+		}
+		// Per-command errors are inspected below
+		_, _ = pipe.Exec(ctx)
+	}
+
+	identifiers := make([]EntityIdentifier, 0, len(keys))
+	for i, key := range keys {
+		data, err := cmds[i].Text()
+		if err == redis.Nil {
+			if err := removeStaleIndexEntryScript.Run(ctx, r.client, []string{indexKey, key}).Err(); err != nil {
+				r.logger.Warnf("failed to remove stale entry %q of index %q: %v", key, indexKey, err)
+			}
+			continue
+		} else if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+		var doc interface{}
+		if err := r.decode(data, &doc); err != nil {
+			return nil, err
+		}
+		// The document may have been written without maintaining the index
+		if extractor(doc) != value {
+			continue
+		}
+		identifier, err := r.keyToIdentifier(key)
+		if err != nil {
+			r.logger.Warnf("skipping key %q of index %q: %v", key, indexKey, err)
+			continue
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers, nil
+}
+
+// fieldIndexKey returns the key of the SET holding the keys indexed under value
+func (r *RedisRepository) fieldIndexKey(field, value string) string {
+	return r.keyPrefix() + KeyPartIndex + r.separator + field + r.separator + value
+}
+
+// fieldIndexValues returns the values the encoded document is indexed under, or nil if data is nil
+func (r *RedisRepository) fieldIndexValues(data *string) (map[string]string, error) {
+	if data == nil {
+		return nil, nil
+	}
+	var doc interface{}
+	if err := r.decode(*data, &doc); err != nil {
+		return nil, err
+	}
+	return r.fieldIndexes.values(doc), nil
+}
+
+// reindex queues the index updates for the document under key being replaced by data, or
+// deleted if data is nil. The key is watched and its current document is read, unless it was
+// already written within the transaction.
+func (t *redisTransaction) reindex(ctx context.Context, key string, data *string) error {
+	if !t.repo.fieldIndexes.active() {
+		return nil
+	}
+	previous, written := t.written[key]
+	if !written {
+		if err := t.watch(ctx, key); err != nil {
+			return err
+		}
+		current, err := t.do(ctx, key, t.repo.docGet(key)...).Text()
+		if err == nil {
+			previous = &current
+		} else if err != redis.Nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+	}
+	oldValues, err := t.repo.fieldIndexValues(previous)
+	if err != nil {
+		return err
+	}
+	newValues, err := t.repo.fieldIndexValues(data)
+	if err != nil {
+		return err
+	}
+
+	if t.written == nil {
+		t.written = make(map[string]*string)
+	}
+	t.written[key] = data
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		for field, value := range oldValues {
+			if newValues[field] != value {
+				pipe.SRem(ctx, t.repo.fieldIndexKey(field, value), key)
+			}
+		}
+		for field, value := range newValues {
+			if oldValues[field] != value {
+				pipe.SAdd(ctx, t.repo.fieldIndexKey(field, value), key)
+			}
+		}
+	})
+}
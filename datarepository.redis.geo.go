@@ -0,0 +1,71 @@
+// datarepository.redis.geo.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ GeoStore = (*RedisRepository)(nil)
+
+// GeoAdd runs GEOADD
+func (r *RedisRepository) GeoAdd(ctx context.Context, identifier EntityIdentifier, member string, lon, lat float64) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if err := checkGeoPosition(lon, lat); err != nil {
+		return err
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	location := &redis.GeoLocation{Name: member, Longitude: lon, Latitude: lat}
+	if err := r.client.GeoAdd(ctx, key, location).Err(); err != nil {
+		return structureError(err, errNotAGeoSet)
+	}
+	return nil
+}
+
+// GeoRadius runs GEOSEARCH FROMLONLAT BYRADIUS with WITHDIST ASC
+func (r *RedisRepository) GeoRadius(ctx context.Context, identifier EntityIdentifier, lon, lat float64, radius float64, unit string) ([]GeoHit, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	if _, err := checkGeoQuery(lon, lat, radius, unit); err != nil {
+		return nil, err
+	}
+	if err := r.requireVersion(ctx, "6.2", "GeoRadius (GEOSEARCH)"); err != nil {
+		return nil, err
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	query := &redis.GeoSearchLocationQuery{
+		GeoSearchQuery: redis.GeoSearchQuery{
+			Longitude:  lon,
+			Latitude:   lat,
+			Radius:     radius,
+			RadiusUnit: unit,
+			Sort:       "ASC",
+		},
+		WithDist: true,
+	}
+	locations, err := r.reader.GeoSearchLocation(ctx, key, query).Result()
+	if err != nil {
+		return nil, structureError(err, errNotAGeoSet)
+	}
+	hits := make([]GeoHit, len(locations))
+	for i, location := range locations {
+		hits[i] = GeoHit{Member: location.Name, Distance: location.Dist}
+	}
+	return hits, nil
+}
@@ -4,12 +4,17 @@ package datarepository
 
 import (
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"os"
 	"regexp"
+	"sort"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/redis/go-redis/v9"
@@ -19,10 +24,30 @@ const (
 	DefaultKeyPrefix     = "app"
 	DefaultKeySeparator  = ":"
 	DefaultKeyPartsCount = 3 // prefix:entityPrefix:id
+	DefaultScanCount     = 100
+	RedisJSONKeyType     = "ReJSON-RL"
 	MinKeyLength         = 5
 	MaxKeyLength         = 256
 	KeyPartLock          = "lock"
+	KeyPartVersion       = "version"
+	KeyPartIdle          = "idle"
 	KeyPartPubSubChannel = "channel"
+	// KeyPartIndex follows the prefix in the keys of the sets of field indexes. The leading
+	// underscore keeps it apart from entity prefixes, which start with a letter.
+	KeyPartIndex = "_index"
+
+	RedisModeSingle   = "single"
+	RedisModeSentinel = "sentinel"
+	RedisModeCluster  = "cluster"
+
+	// RedisStorageJSON stores entities as RedisJSON documents, see RedisConfig.StorageMode
+	RedisStorageJSON = "json"
+	// RedisStorageString stores entities as plain strings, see RedisConfig.StorageMode
+	RedisStorageString = "string"
+
+	// DefaultRedisServerCheckTimeout bounds detecting the server and the RedisJSON module when a
+	// repository is created, see RedisConfig.ServerCheckTimeout
+	DefaultRedisServerCheckTimeout = 5 * time.Second
 )
 
 var (
@@ -35,17 +60,201 @@ var (
 	ErrInvalidEntityPrefix    = errors.New("invalid entity prefix: must start with a letter and contain only letters, numbers, and underscores")
 	ErrUnsupportedIdentifier  = errors.New("unsupported identifier type")
 	ErrInvalidKeyPatternChars = errors.New("key-pattern contains invalid characters")
+	ErrReservedKeyPart        = errors.New("key ends with a part reserved for lock, version and idle keys")
 
-	validKeyRegex        = regexp.MustCompile(`^[a-zA-Z0-9_:.-]+$`)
-	validKeyPatternRegex = regexp.MustCompile(`^[a-zA-Z0-9_:.\-\?\*]+$`)
-	entityPrefixRegex    = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
+	// DefaultKeyCharset is the default RedisConfig.KeyCharset
+	DefaultKeyCharset = regexp.MustCompile(`^[a-zA-Z0-9_:.-]+$`)
+	entityPrefixRegex = regexp.MustCompile(`^[a-zA-Z][a-zA-Z0-9_-]*$`)
 )
 
+// releaseLockScript deletes a lock only if it is held with the given token.
+// Returns 1 if released, 0 if the lock does not exist and -1 if it is held with another token.
+var releaseLockScript = redis.NewScript(`
+local current = redis.call("GET", KEYS[1])
+if not current then
+	return 0
+end
+if current ~= ARGV[1] then
+	return -1
+end
+return redis.call("DEL", KEYS[1])
+`)
+
+// renewLockScript sets a new expiration on a lock only if it is held with the given token.
+// Returns 1 if renewed and 0 otherwise.
+var renewLockScript = redis.NewScript(`
+if redis.call("GET", KEYS[1]) == ARGV[1] then
+	return redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 0
+`)
+
+// updateWithVersionScript replaces a document if its version, stored in a sibling string key,
+// equals the expected one. The version key gets the document's TTL so both expire together.
+// Returns the new version, -1 if the document does not exist and -2 if the version differs.
+var updateWithVersionScript = newDocScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+local current = tonumber(redis.call("GET", KEYS[2]) or "0")
+if current ~= tonumber(ARGV[1]) then
+	return -2
+end
+set_doc(KEYS[1], ARGV[2])
+local ttl = redis.call("PTTL", KEYS[1])
+if ttl > 0 then
+	redis.call("SET", KEYS[2], current + 1, "PX", ttl)
+else
+	redis.call("SET", KEYS[2], current + 1)
+end
+return current + 1
+`)
+
+// createIfAbsentScript sets a document only if the key does not exist and gives it an expiration
+// in milliseconds unless that is 0. Returns 1 if the document was created and 0 otherwise.
+var createIfAbsentScript = newDocScript(`
+if not set_doc(KEYS[1], ARGV[1], "NX") then
+	return 0
+end
+if tonumber(ARGV[2]) > 0 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return 1
+`)
+
+// getAndDeleteScript returns a document and deletes it, or returns nil if it does not exist
+var getAndDeleteScript = newDocScript(`
+local current = get_doc(KEYS[1])
+if not current then
+	return nil
+end
+redis.call("DEL", KEYS[1])
+return current
+`)
+
+// getAndSetScript returns a document and replaces it, or returns nil if it does not exist.
+// set_doc keeps the key's TTL.
+var getAndSetScript = newDocScript(`
+local current = get_doc(KEYS[1])
+if not current then
+	return nil
+end
+set_doc(KEYS[1], ARGV[1])
+return current
+`)
+
+// incrementWithLimitScript increments a counter unless the result would exceed the limit.
+// Returns the resulting value and 1 if it was incremented or 0 if not.
+var incrementWithLimitScript = redis.NewScript(`
+local current = tonumber(redis.call("GET", KEYS[1]) or "0")
+if not current then
+	return redis.error_reply("ERR value is not an integer or out of range")
+end
+if current + tonumber(ARGV[1]) > tonumber(ARGV[2]) then
+	return {current, 0}
+end
+return {redis.call("INCRBY", KEYS[1], ARGV[1]), 1}
+`)
+
+// incrementWithExpiryScript increments a counter and sets its expiration if it has none
+var incrementWithExpiryScript = redis.NewScript(`
+local value = redis.call("INCRBY", KEYS[1], ARGV[1])
+if redis.call("PTTL", KEYS[1]) == -1 then
+	redis.call("PEXPIRE", KEYS[1], ARGV[2])
+end
+return value
+`)
+
+// getVersionScript returns the version of a document, or -1 if the document does not exist
+var getVersionScript = redis.NewScript(`
+if redis.call("EXISTS", KEYS[1]) == 0 then
+	return -1
+end
+return tonumber(redis.call("GET", KEYS[2]) or "0")
+`)
+
 type RedisConfig struct {
+	// ConnectionString is either a redis:// or rediss:// URL or the legacy ";"-delimited string
+	// "Mode;Name;MasterName;SentinelUsername;SentinelPassword;Username;Password;DB;Addrs".
+	// If empty, the explicit connection fields below are used instead.
 	ConnectionString string
 	KeyPrefix        string
 	KeySeparator     string
-	logger           LogAdapter
+
+	// Mode is one of RedisModeSingle (default), RedisModeSentinel or RedisModeCluster
+	Mode string
+	// Addrs are the server addresses (host:port); the sentinel addresses in sentinel mode
+	Addrs            []string
+	Username         string
+	Password         string
+	DB               int
+	MasterName       string
+	SentinelUsername string
+	SentinelPassword string
+	// ReadUsername and ReadPassword, if ReadUsername is set, authenticate a second client that
+	// serves the read-only operations, so that they can run as a Redis ACL user without write
+	// permissions. All other operations use Username and Password. See the README for the
+	// commands each user needs.
+	ReadUsername string
+	ReadPassword string
+
+	// TLSConfig enables TLS with the given configuration. TLS is also enabled by a rediss:// URL
+	// or by setting any of the TLS file or verification options below.
+	TLSConfig *tls.Config
+	// TLSInsecureSkipVerify disables verification of the server certificate
+	TLSInsecureSkipVerify bool
+	// TLSCAFile is the path of a PEM file with the CA certificates used to verify the server
+	TLSCAFile string
+	// TLSCertFile and TLSKeyFile are the paths of a PEM client certificate and key
+	TLSCertFile string
+	TLSKeyFile  string
+
+	// ChannelPrefix is prepended (followed by KeySeparator) to all pub/sub channel names.
+	// Defaults to KeyPrefix + KeySeparator + KeyPartPubSubChannel.
+	ChannelPrefix string
+	// ScanCount is the COUNT hint passed to SCAN when iterating keys. Defaults to DefaultScanCount.
+	ScanCount int64
+	// ScanType, if set, restricts the keys returned by List and ListPaged to the given Redis
+	// type (e.g. "ReJSON-RL" for RedisJSON documents). The filter is applied server-side.
+	ScanType string
+	// EnforcePrefix, if nil or true, makes every key start with KeyPrefix and KeySeparator.
+	// Set it to false to work on keys written by other applications: the prefix is then
+	// neither added to keys nor required of them.
+	EnforcePrefix *bool
+	// MinKeyLength and MaxKeyLength bound the length of full keys, including the prefix.
+	// They default to MinKeyLength and MaxKeyLength.
+	MinKeyLength int
+	MaxKeyLength int
+	// KeyCharset is matched against full keys, including the prefix and separators. Patterns
+	// are matched after removing their "*" and "?" wildcards. Defaults to DefaultKeyCharset,
+	// which allows letters, digits, "_", ":", "." and "-".
+	KeyCharset *regexp.Regexp
+	// Codec serializes entity values. It must produce valid JSON. Defaults to JSONCodec.
+	Codec Codec
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator IDGenerator
+	// NotFoundOnEmpty makes List, Search and SearchDetailed return ErrNotFound instead of an
+	// empty result when nothing matches
+	NotFoundOnEmpty bool
+	// IdleExpiration enables SetIdleExpiration. Reads then also fetch the entity's idle timeout
+	// in the same pipeline, and restart the expiration of entities that have one.
+	IdleExpiration bool
+	// StorageMode is RedisStorageJSON (default), which stores entity values as RedisJSON
+	// documents with JSON.SET and JSON.GET, or RedisStorageString, which stores the codec's
+	// output as plain strings with SET and GET, so the repository works on vanilla Redis or
+	// Valkey without the RedisJSON module. In string mode codecs needn't produce JSON, ReadField
+	// and UpdateField decode the whole value, and Search and CreateIndex return ErrNotSupported.
+	StorageMode string
+	// DisableJSONModule is shorthand for StorageMode RedisStorageString
+	DisableJSONModule bool
+	// ServerCheckTimeout bounds detecting the server and the RedisJSON module in
+	// NewRedisRepository. Defaults to DefaultRedisServerCheckTimeout; a negative value skips the
+	// check, and the server is then detected on first use.
+	ServerCheckTimeout time.Duration
+	// Logger receives diagnostic messages, e.g. about entries skipped by List or Search.
+	// Defaults to a no-op logger.
+	Logger Logger
+	logger LogAdapter
 }
 
 type redisServerInfo struct {
@@ -58,17 +267,174 @@ type redisServerInfo struct {
 	Password         string
 	DB               int
 	Addrs            []string
+	TLSConfig        *tls.Config
 }
 
 func (c RedisConfig) GetConnectionString() string {
 	return c.ConnectionString
 }
 
+// legacyConnectionStringFields names the fields of the legacy ";"-delimited connection string, in order
+var legacyConnectionStringFields = []string{
+	"Mode", "Name", "MasterName", "SentinelUsername", "SentinelPassword", "Username", "Password", "DB", "Addrs",
+}
+
+// resolveRedisServerInfo determines the server info from the config. An empty ConnectionString
+// selects the explicit config fields, a redis:// or rediss:// URL is parsed as such, and any other
+// value is parsed as the legacy ";"-delimited connection string.
+func resolveRedisServerInfo(config RedisConfig) (redisServerInfo, error) {
+	rsi, err := resolveRedisConnection(config)
+	if err != nil {
+		return rsi, err
+	}
+	rsi.TLSConfig, err = buildRedisTLSConfig(config, rsi.TLSConfig)
+	return rsi, err
+}
+
+func resolveRedisConnection(config RedisConfig) (redisServerInfo, error) {
+	switch {
+	case config.ConnectionString == "":
+		rsi := redisServerInfo{
+			Mode:             config.Mode,
+			MasterName:       config.MasterName,
+			SentinelUsername: config.SentinelUsername,
+			SentinelPassword: config.SentinelPassword,
+			Username:         config.Username,
+			Password:         config.Password,
+			DB:               config.DB,
+			Addrs:            config.Addrs,
+		}
+		if rsi.Mode == "" {
+			rsi.Mode = RedisModeSingle
+		}
+		return rsi, nil
+	case strings.HasPrefix(config.ConnectionString, "redis://") || strings.HasPrefix(config.ConnectionString, "rediss://"):
+		rsi, err := parseRedisServerInfoFromURL(config.ConnectionString)
+		if err != nil {
+			return rsi, InvalidConfig("RedisConfig", "ConnectionString: %v", err)
+		}
+		return rsi, nil
+	default:
+		rsi, err := parseRedisServerInfoFromConfigString(config.ConnectionString)
+		if err != nil {
+			return rsi, InvalidConfig("RedisConfig", "ConnectionString: %v", err)
+		}
+		return rsi, nil
+	}
+}
+
+// Validate checks the config without connecting, including the fields taken from the
+// connection string.
+// Returns ErrInvalidInput naming the offending field, e.g. if Addrs is empty.
+func (c RedisConfig) Validate() error {
+	rsi, err := resolveRedisConnection(c)
+	if err != nil {
+		return err
+	}
+	switch rsi.Mode {
+	case RedisModeSingle, RedisModeSentinel, RedisModeCluster:
+	default:
+		return InvalidConfig("RedisConfig", "unknown Mode %q, expected %q, %q or %q", rsi.Mode, RedisModeSingle, RedisModeSentinel, RedisModeCluster)
+	}
+	if len(rsi.Addrs) == 0 {
+		return InvalidConfig("RedisConfig", "Addrs is empty in %s mode", rsi.Mode)
+	}
+	for i, addr := range rsi.Addrs {
+		if strings.TrimSpace(addr) == "" {
+			return InvalidConfig("RedisConfig", "Addrs[%d] is empty in %s mode", i, rsi.Mode)
+		}
+	}
+	if rsi.Mode == RedisModeSentinel && rsi.MasterName == "" {
+		return InvalidConfig("RedisConfig", "MasterName is empty in sentinel mode")
+	}
+	if rsi.DB < 0 {
+		return InvalidConfig("RedisConfig", "DB %d is negative", rsi.DB)
+	}
+	if rsi.Mode == RedisModeCluster && rsi.DB != 0 {
+		return InvalidConfig("RedisConfig", "DB is %d, but only 0 is available in cluster mode", rsi.DB)
+	}
+	if c.ReadPassword != "" && c.ReadUsername == "" {
+		return InvalidConfig("RedisConfig", "ReadPassword is set without ReadUsername")
+	}
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		return InvalidConfig("RedisConfig", "TLSCertFile and TLSKeyFile must be set together")
+	}
+	switch c.StorageMode {
+	case "", RedisStorageString:
+	case RedisStorageJSON:
+		if c.DisableJSONModule {
+			return InvalidConfig("RedisConfig", "DisableJSONModule contradicts StorageMode %q", c.StorageMode)
+		}
+	default:
+		return InvalidConfig("RedisConfig", "unknown StorageMode %q, expected %q or %q", c.StorageMode, RedisStorageJSON, RedisStorageString)
+	}
+	if c.MinKeyLength > 0 && c.MaxKeyLength > 0 && c.MinKeyLength > c.MaxKeyLength {
+		return InvalidConfig("RedisConfig", "MinKeyLength %d exceeds MaxKeyLength %d", c.MinKeyLength, c.MaxKeyLength)
+	}
+	return nil
+}
+
+// buildRedisTLSConfig combines the TLS options of the config with the TLS config derived from
+// the connection string (base, set for rediss:// URLs). Returns nil if TLS is not enabled.
+func buildRedisTLSConfig(config RedisConfig, base *tls.Config) (*tls.Config, error) {
+	var tlsConfig *tls.Config
+	switch {
+	case config.TLSConfig != nil:
+		tlsConfig = config.TLSConfig.Clone()
+	case base != nil:
+		tlsConfig = base.Clone()
+	case config.TLSInsecureSkipVerify || config.TLSCAFile != "" || config.TLSCertFile != "" || config.TLSKeyFile != "":
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	default:
+		return nil, nil
+	}
+
+	if config.TLSInsecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	if config.TLSCAFile != "" {
+		pem, err := os.ReadFile(config.TLSCAFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read TLS CA file: %v", ErrInvalidInput, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("%w: no certificates found in TLS CA file %s", ErrInvalidInput, config.TLSCAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if config.TLSCertFile != "" || config.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(config.TLSCertFile, config.TLSKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to load TLS client certificate: %v", ErrInvalidInput, err)
+		}
+		tlsConfig.Certificates = append(tlsConfig.Certificates, cert)
+	}
+	return tlsConfig, nil
+}
+
+func parseRedisServerInfoFromURL(redisURL string) (redisServerInfo, error) {
+	opts, err := redis.ParseURL(redisURL)
+	if err != nil {
+		return redisServerInfo{}, fmt.Errorf("invalid Redis URL: %v", err)
+	}
+	return redisServerInfo{
+		Mode:      RedisModeSingle,
+		Username:  opts.Username,
+		Password:  opts.Password,
+		DB:        opts.DB,
+		Addrs:     []string{opts.Addr},
+		TLSConfig: opts.TLSConfig,
+	}, nil
+}
+
 func parseRedisServerInfoFromConfigString(redisConfigString string) (redisServerInfo, error) {
 	rsi := redisServerInfo{}
 	baseinfo := strings.Split(redisConfigString, ";")
-	if len(baseinfo) < 9 {
-		return rsi, fmt.Errorf("%w: invalid connection string format", ErrInvalidInput)
+	if len(baseinfo) < len(legacyConnectionStringFields) {
+		missing := legacyConnectionStringFields[len(baseinfo):]
+		return rsi, fmt.Errorf("expected %d ';'-separated fields (%s), missing %s",
+			len(legacyConnectionStringFields), strings.Join(legacyConnectionStringFields, ";"), strings.Join(missing, ", "))
 	}
 
 	rsi.Mode = baseinfo[0]
@@ -79,10 +445,11 @@ func parseRedisServerInfoFromConfigString(redisConfigString string) (redisServer
 	rsi.Username = baseinfo[5]
 	rsi.Password = baseinfo[6]
 
-	db, err := strconv.Atoi(baseinfo[7])
-	if err != nil {
-		rsi.DB = 0
-	} else {
+	if baseinfo[7] != "" {
+		db, err := strconv.Atoi(baseinfo[7])
+		if err != nil {
+			return rsi, fmt.Errorf("DB %q is not a number", baseinfo[7])
+		}
 		rsi.DB = db
 	}
 
@@ -91,6 +458,52 @@ func parseRedisServerInfoFromConfigString(redisConfigString string) (redisServer
 	return rsi, nil
 }
 
+// newRedisClient creates the client for the given server info. The client honors the deadlines
+// of the contexts passed to it, so they also bound the server check of NewRedisRepository.
+func newRedisClient(serverInfo redisServerInfo) (redis.UniversalClient, error) {
+	// Validate reports this in detail; the check keeps the indexing below safe regardless
+	if len(serverInfo.Addrs) == 0 || serverInfo.Addrs[0] == "" {
+		return nil, InvalidConfig("RedisConfig", "Addrs is empty in %s mode", serverInfo.Mode)
+	}
+	switch serverInfo.Mode {
+	case RedisModeSingle:
+		return redis.NewClient(&redis.Options{
+			Addr:                  serverInfo.Addrs[0],
+			DB:                    serverInfo.DB,
+			Username:              serverInfo.Username,
+			Password:              serverInfo.Password,
+			TLSConfig:             serverInfo.TLSConfig,
+			ContextTimeoutEnabled: true,
+		}), nil
+	case RedisModeSentinel:
+		return redis.NewFailoverClient(&redis.FailoverOptions{
+			MasterName:            serverInfo.MasterName,
+			SentinelAddrs:         serverInfo.Addrs,
+			SentinelUsername:      serverInfo.SentinelUsername,
+			SentinelPassword:      serverInfo.SentinelPassword,
+			DB:                    serverInfo.DB,
+			Username:              serverInfo.Username,
+			Password:              serverInfo.Password,
+			TLSConfig:             serverInfo.TLSConfig,
+			ContextTimeoutEnabled: true,
+		}), nil
+	case RedisModeCluster:
+		return redis.NewClusterClient(&redis.ClusterOptions{
+			Addrs:                 serverInfo.Addrs,
+			Username:              serverInfo.Username,
+			Password:              serverInfo.Password,
+			TLSConfig:             serverInfo.TLSConfig,
+			ContextTimeoutEnabled: true,
+		}), nil
+	default:
+		return nil, fmt.Errorf("%w: unsupported Redis mode", ErrInvalidInput)
+	}
+}
+
+// RedisIdentifier identifies the entity stored at prefix:EntityPrefix:ID. The ID may contain the
+// separator to form hierarchical keys, e.g. "a:b:c", but not as its last part followed by
+// KeyPartLock, KeyPartVersion or KeyPartIdle, as these keys belong to the entity's lock, version
+// and idle timeout.
 type RedisIdentifier struct {
 	EntityPrefix string
 	ID           string
@@ -100,14 +513,39 @@ func (ri RedisIdentifier) String() string {
 	return strings.Join([]string{ri.EntityPrefix, ri.ID}, DefaultKeySeparator)
 }
 
+// Parts returns the entity prefix and the id
+func (ri RedisIdentifier) Parts() (string, string) {
+	return ri.EntityPrefix, ri.ID
+}
+
 type RedisRepository struct {
 	BaseRepository
-	client    redis.UniversalClient
-	prefix    string
-	separator string
-	logger    LogAdapter
+	client          redis.UniversalClient
+	reader          redis.UniversalClient // serves the read-only operations; client unless configured
+	ownsClient      bool
+	prefix          string
+	separator       string
+	channelPrefix   string
+	scanCount       int64
+	scanType        string
+	enforcePrefix   bool
+	namespaced      bool // set on views created by WithNamespace
+	minKeyLength    int
+	maxKeyLength    int
+	keyCharset      *regexp.Regexp
+	codec           Codec
+	idGen           IDGenerator
+	notFoundOnEmpty bool
+	idleExpiration  bool
+	stringStorage   bool // set by StorageMode RedisStorageString
+	logger          Logger
+	fieldIndexes    *fieldIndexRegistry // shared with namespace views
+	serverInfo      *serverInfoCache    // shared with namespace views
+	guard           *closeGuard         // shared with namespace views
 }
 
+var _ DataRepository = (*RedisRepository)(nil)
+
 func (r *RedisRepository) initBaseRepository() {
 	r.BaseRepository = BaseRepository{
 		plugins: make(map[string]RepositoryPlugin),
@@ -126,79 +564,191 @@ func NewRedisConfig(connectionString string, prefix string, separator string, lo
 func NewRedisRepository(config Config) (DataRepository, error) {
 	redisConfig, ok := config.(RedisConfig)
 	if !ok {
-		return nil, fmt.Errorf("%w: invalid config type for Redis repository", ErrInvalidInput)
-	}
-	if redisConfig.KeyPrefix == "" {
-		redisConfig.KeyPrefix = DefaultKeyPrefix
+		return nil, fmt.Errorf("%w: Redis repository needs a RedisConfig, got %T", ErrInvalidInput, config)
 	}
-	if redisConfig.KeySeparator == "" {
-		redisConfig.KeySeparator = DefaultKeySeparator
+	if err := redisConfig.Validate(); err != nil {
+		return nil, err
 	}
-	if redisConfig.logger == nil {
-		redisConfig.logger = emptyLogger
+	redisConfig = redisConfig.withDefaults()
+
+	serverInfo, err := resolveRedisServerInfo(redisConfig)
+	if err != nil {
+		return nil, err
 	}
 
-	serverInfo, err := parseRedisServerInfoFromConfigString(redisConfig.ConnectionString)
+	client, err := newRedisClient(serverInfo)
 	if err != nil {
 		return nil, err
 	}
+	repo := newRedisRepository(client, redisConfig, true)
 
-	var client redis.UniversalClient
+	if redisConfig.ReadUsername != "" {
+		readInfo := serverInfo
+		readInfo.Username = redisConfig.ReadUsername
+		readInfo.Password = redisConfig.ReadPassword
+		reader, err := newRedisClient(readInfo)
+		if err != nil {
+			client.Close()
+			return nil, err
+		}
+		repo.reader = reader
+	}
 
-	switch serverInfo.Mode {
-	case "single":
-		client = redis.NewClient(&redis.Options{
-			Addr:     serverInfo.Addrs[0],
-			DB:       serverInfo.DB,
-			Username: serverInfo.Username,
-			Password: serverInfo.Password,
-		})
-	case "sentinel":
-		client = redis.NewFailoverClient(&redis.FailoverOptions{
-			MasterName:       serverInfo.MasterName,
-			SentinelAddrs:    serverInfo.Addrs,
-			SentinelUsername: serverInfo.SentinelUsername,
-			SentinelPassword: serverInfo.SentinelPassword,
-			DB:               serverInfo.DB,
-			Username:         serverInfo.Username,
-			Password:         serverInfo.Password,
-		})
-	case "cluster":
-		client = redis.NewClusterClient(&redis.ClusterOptions{
-			Addrs:    serverInfo.Addrs,
-			Username: serverInfo.Username,
-			Password: serverInfo.Password,
-		})
-	default:
-		return nil, fmt.Errorf("%w: unsupported Redis mode", ErrInvalidInput)
+	if redisConfig.ServerCheckTimeout > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), redisConfig.ServerCheckTimeout)
+		err := repo.checkServer(ctx)
+		cancel()
+		if err != nil {
+			repo.Close()
+			return nil, err
+		}
+	}
+	return repo, nil
+}
+
+// NewRedisRepositoryWithClient creates a repository on top of an existing client, so that
+// several repositories (e.g. with different prefixes) can share one connection pool.
+// Closing the repository does not close the shared client.
+func NewRedisRepositoryWithClient(client redis.UniversalClient, prefix string, separator string) DataRepository {
+	return NewRedisRepositoryWithClientConfig(client, RedisConfig{
+		KeyPrefix:    prefix,
+		KeySeparator: separator,
+	})
+}
+
+// NewRedisRepositoryWithClientConfig works like NewRedisRepositoryWithClient but takes the
+// remaining options from config. The connection fields of config are ignored.
+func NewRedisRepositoryWithClientConfig(client redis.UniversalClient, config RedisConfig) DataRepository {
+	repo := newRedisRepository(client, config.withDefaults(), false)
+	repo.initBaseRepository()
+	return repo
+}
+
+// NewRedisRepositoryWithReadClient works like NewRedisRepositoryWithClientConfig but serves the
+// read-only operations with reader, e.g. a client authenticated as a Redis ACL user without
+// write permissions or connected to a replica. Closing the repository closes neither client.
+func NewRedisRepositoryWithReadClient(client, reader redis.UniversalClient, config RedisConfig) DataRepository {
+	repo := newRedisRepository(client, config.withDefaults(), false)
+	repo.reader = reader
+	repo.initBaseRepository()
+	return repo
+}
+
+// WithNamespace returns a view of the repository that shares its client but whose prefix is
+// extended by ns, so that its keys, locks, counters and channels are scoped to the namespace.
+// Unlike those of the repository, List patterns of the view are relative to its prefix, e.g.
+// "user:*". Search uses the index named after the view's prefix. Closing the view doesn't close
+// the client.
+func (r *RedisRepository) WithNamespace(ns string) DataRepository {
+	view := *r
+	view.ownsClient = false
+	view.namespaced = true
+	view.prefix = ns
+	if r.enforcePrefix {
+		view.prefix = r.prefix + r.separator + ns
 	}
+	view.enforcePrefix = true
+	view.channelPrefix = r.channelPrefix + r.separator + ns
+	return &view
+}
 
-	return &RedisRepository{
-		client:    client,
-		prefix:    redisConfig.KeyPrefix,
-		separator: redisConfig.KeySeparator,
-		logger:    redisConfig.logger,
-	}, nil
+// listPattern returns the key pattern that List matches for the given pattern
+func (r *RedisRepository) listPattern(pattern string) string {
+	if r.namespaced {
+		return r.keyPrefix() + pattern
+	}
+	return pattern
 }
 
-func (r *RedisRepository) validateKey(key string, allowPattern bool) error {
-	if len(key) < MinKeyLength || len(key) > MaxKeyLength {
-		return fmt.Errorf("%w: key length must be between %d and %d characters", ErrInvalidKeyLength, MinKeyLength, MaxKeyLength)
+// withDefaults returns a copy of the config with defaults applied to unset options
+func (c RedisConfig) withDefaults() RedisConfig {
+	if c.KeyPrefix == "" {
+		c.KeyPrefix = DefaultKeyPrefix
+	}
+	if c.KeySeparator == "" {
+		c.KeySeparator = DefaultKeySeparator
+	}
+	if c.IDGenerator == nil {
+		c.IDGenerator = UUIDv4Generator{}
+	}
+	if c.ChannelPrefix == "" {
+		c.ChannelPrefix = c.KeyPrefix + c.KeySeparator + KeyPartPubSubChannel
 	}
+	if c.Codec == nil {
+		c.Codec = JSONCodec{}
+	}
+	if c.ScanCount <= 0 {
+		c.ScanCount = DefaultScanCount
+	}
+	if c.MinKeyLength <= 0 {
+		c.MinKeyLength = MinKeyLength
+	}
+	if c.MaxKeyLength <= 0 {
+		c.MaxKeyLength = MaxKeyLength
+	}
+	if c.KeyCharset == nil {
+		c.KeyCharset = DefaultKeyCharset
+	}
+	if c.ServerCheckTimeout == 0 {
+		c.ServerCheckTimeout = DefaultRedisServerCheckTimeout
+	}
+	if c.StorageMode == "" {
+		c.StorageMode = RedisStorageJSON
+		if c.DisableJSONModule {
+			c.StorageMode = RedisStorageString
+		}
+	}
+	return c
+}
+
+func newRedisRepository(client redis.UniversalClient, redisConfig RedisConfig, ownsClient bool) *RedisRepository {
+	return &RedisRepository{
+		client:          client,
+		reader:          client,
+		ownsClient:      ownsClient,
+		prefix:          redisConfig.KeyPrefix,
+		separator:       redisConfig.KeySeparator,
+		channelPrefix:   redisConfig.ChannelPrefix,
+		scanCount:       redisConfig.ScanCount,
+		scanType:        redisConfig.ScanType,
+		enforcePrefix:   redisConfig.EnforcePrefix == nil || *redisConfig.EnforcePrefix,
+		minKeyLength:    redisConfig.MinKeyLength,
+		maxKeyLength:    redisConfig.MaxKeyLength,
+		keyCharset:      redisConfig.KeyCharset,
+		codec:           redisConfig.Codec,
+		idGen:           redisConfig.IDGenerator,
+		notFoundOnEmpty: redisConfig.NotFoundOnEmpty,
+		idleExpiration:  redisConfig.IdleExpiration,
+		stringStorage:   redisConfig.StorageMode == RedisStorageString,
+		logger:          ResolveLogger(redisConfig.Logger, redisConfig.logger),
+		fieldIndexes:    newFieldIndexRegistry(),
+		serverInfo:      &serverInfoCache{},
+		guard:           newCloseGuard(),
+	}
+}
 
-	if allowPattern && !validKeyPatternRegex.MatchString(key) {
-		return fmt.Errorf("%w: key-patterns must contain only alphanumeric characters, underscores, colons, dots, and hyphens and stars", ErrInvalidKeyPatternChars)
-	} else if !allowPattern && !validKeyRegex.MatchString(key) {
-		return fmt.Errorf("%w: key must contain only alphanumeric characters, underscores, colons, dots, and hyphens", ErrInvalidKeyChars)
+func (r *RedisRepository) validateKey(key string, allowPattern bool) error {
+	if len(key) < r.minKeyLength || len(key) > r.maxKeyLength {
+		return fmt.Errorf("%w: key length must be between %d and %d characters", ErrInvalidKeyLength, r.minKeyLength, r.maxKeyLength)
 	}
 
-	if !strings.HasPrefix(key, r.prefix+r.separator) {
-		return fmt.Errorf("%w: key must start with %s%s", ErrInvalidKeyPrefix, r.prefix, r.separator)
+	if allowPattern {
+		literal := globLiterals(key)
+		if literal != "" && !r.keyCharset.MatchString(literal) {
+			return fmt.Errorf("%w: key-pattern must match %s apart from wildcards", ErrInvalidKeyPatternChars, r.keyCharset)
+		}
+	} else if !r.keyCharset.MatchString(key) {
+		return fmt.Errorf("%w: key must match %s", ErrInvalidKeyChars, r.keyCharset)
 	}
 
 	parts := strings.Split(key, r.separator)
-	if len(parts) < 2 || parts[1] == "" {
-		return fmt.Errorf("%w: key must have at least one non-empty part after the prefix", ErrInvalidKeySuffix)
+	if r.enforcePrefix {
+		if !strings.HasPrefix(key, r.prefix+r.separator) {
+			return fmt.Errorf("%w: key must start with %s%s", ErrInvalidKeyPrefix, r.prefix, r.separator)
+		}
+		if len(parts) < 2 || parts[1] == "" {
+			return fmt.Errorf("%w: key must have at least one non-empty part after the prefix", ErrInvalidKeySuffix)
+		}
 	}
 
 	for _, part := range parts {
@@ -218,9 +768,17 @@ func (r *RedisRepository) validateEntityPrefix(entityPrefix string) error {
 	return nil
 }
 
+// keyPrefix returns the prefix, followed by the separator, that all keys start with, or ""
+// if the prefix is not enforced
+func (r *RedisRepository) keyPrefix() string {
+	if !r.enforcePrefix {
+		return ""
+	}
+	return r.prefix + r.separator
+}
+
 func (r *RedisRepository) createKey(parts ...string) (string, error) {
-	allParts := append([]string{r.prefix}, parts...)
-	key := strings.Join(allParts, r.separator)
+	key := r.keyPrefix() + strings.Join(parts, r.separator)
 	if err := r.validateKey(key, false); err != nil {
 		return "", err
 	}
@@ -228,8 +786,7 @@ func (r *RedisRepository) createKey(parts ...string) (string, error) {
 }
 
 func (r *RedisRepository) createKeyPattern(parts ...string) (string, error) {
-	allParts := append([]string{r.prefix}, parts...)
-	key := strings.Join(allParts, r.separator)
+	key := r.keyPrefix() + strings.Join(parts, r.separator)
 	err := r.validateKey(key, true)
 	if err != nil {
 		return "", err
@@ -237,11 +794,12 @@ func (r *RedisRepository) createKeyPattern(parts ...string) (string, error) {
 	return key, nil
 }
 
+// parseKey returns the parts of a key after the prefix
 func (r *RedisRepository) parseKey(key string) ([]string, error) {
 	if err := r.validateKey(key, false); err != nil {
 		return nil, err
 	}
-	return strings.Split(key, r.separator)[1:], nil
+	return strings.Split(strings.TrimPrefix(key, r.keyPrefix()), r.separator), nil
 }
 
 func (r *RedisRepository) identifierToKey(identifier EntityIdentifier, allowPattern bool) (string, error) {
@@ -256,29 +814,97 @@ func (r *RedisRepository) identifierToKey(identifier EntityIdentifier, allowPatt
 		if allowPattern {
 			key, err = r.createKeyPattern(id.EntityPrefix, id.ID)
 		} else {
+			if err := r.validateHierarchicalID(id.ID); err != nil {
+				return "", err
+			}
 			key, err = r.createKey(id.EntityPrefix, id.ID)
 		}
-		// r.logger("DEBUG", fmt.Sprintf("[]identifierToKey] ============== allowPattern(%t) key(%s) (%v)\n", allowPattern, key, err))
 		return key, err
 	case SimpleIdentifier:
+		if allowPattern {
+			return r.createKeyPattern(string(id))
+		}
+		if _, rest, found := strings.Cut(string(id), r.separator); found {
+			if err := r.validateHierarchicalID(rest); err != nil {
+				return "", err
+			}
+		}
 		return r.createKey(string(id))
 	default:
 		return "", ErrUnsupportedIdentifier
 	}
 }
 
+// validateHierarchicalID rejects ids whose last part would make their key collide with the
+// lock, version or idle key of another entity, e.g. "a:version" as the version key of id "a"
+func (r *RedisRepository) validateHierarchicalID(id string) error {
+	i := strings.LastIndex(id, r.separator)
+	if i < 0 {
+		return nil
+	}
+	if last := id[i+len(r.separator):]; last == KeyPartLock || last == KeyPartVersion || last == KeyPartIdle {
+		return fmt.Errorf("%w: id %q", ErrReservedKeyPart, id)
+	}
+	return nil
+}
+
+// keyToIdentifier converts a key back into its identifier. The first part after the prefix is
+// the entity prefix and all remaining parts form the id, so ids containing the separator
+// round-trip through identifierToKey.
 func (r *RedisRepository) keyToIdentifier(key string) (EntityIdentifier, error) {
 	parts, err := r.parseKey(key)
 	if err != nil {
 		return nil, err
 	}
 	if len(parts) >= 2 {
-		return RedisIdentifier{EntityPrefix: parts[0], ID: parts[1]}, nil
+		return RedisIdentifier{EntityPrefix: parts[0], ID: strings.Join(parts[1:], r.separator)}, nil
 	}
 	return SimpleIdentifier(strings.Join(parts, r.separator)), nil
 }
 
+// encode serializes an entity value with the configured codec for storage via docSet.
+// Returns ErrInvalidInput if value is nil.
+func (r *RedisRepository) encode(value interface{}) (string, error) {
+	if err := CheckValue(value); err != nil {
+		return "", err
+	}
+	return r.encodeField(value)
+}
+
+// encodeField serializes value like encode, but accepts nil, which UpdateField stores as null
+func (r *RedisRepository) encodeField(value interface{}) (string, error) {
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return "", err
+	}
+	if !r.stringStorage && !json.Valid(data) {
+		return "", fmt.Errorf("%w: codec output is not valid JSON as required by RedisJSON", ErrInvalidInput)
+	}
+	return string(data), nil
+}
+
+// decode deserializes a docGet reply into value with the configured codec
+func (r *RedisRepository) decode(data interface{}, value interface{}) error {
+	switch d := data.(type) {
+	case string:
+		return r.codec.Unmarshal([]byte(d), value)
+	case []byte:
+		return r.codec.Unmarshal(d, value)
+	default:
+		return fmt.Errorf("%w: unexpected reply type %T", ErrOperationFailed, data)
+	}
+}
+
 func (r *RedisRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.Create(ctx, identifier, value)
+		})
+	}
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
@@ -286,192 +912,1329 @@ func (r *RedisRepository) Create(ctx context.Context, identifier EntityIdentifie
 
 	exists, err := r.client.Exists(ctx, key).Result()
 	if err != nil {
-		return err
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
 	if exists == 1 {
 		return ErrAlreadyExists
 	}
 
-	data, err := json.Marshal(value)
+	data, err := r.encode(value)
 	if err != nil {
 		return err
 	}
 
-	return r.client.Do(ctx, "JSON.SET", key, ".", string(data)).Err()
+	if err := r.client.Do(ctx, r.docSet(key, data)...).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	r.dropSiblings(ctx, key)
+	return nil
 }
 
-func (r *RedisRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
-	key, err := r.identifierToKey(identifier, false)
-	if err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+func (r *RedisRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return false, err
 	}
-
-	data, err := r.client.Do(ctx, "JSON.GET", key).Result()
-	if err != nil {
-		if err == redis.Nil {
-			return ErrNotFound
-		}
-		return err
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		var created bool
+		err := r.WithTransaction(ctx, func(tx DataRepository) (err error) {
+			created, err = tx.CreateIfAbsent(ctx, identifier, value, ttl)
+			return err
+		})
+		return created, err
+	}
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", ErrInvalidInput)
 	}
-
-	return json.Unmarshal([]byte(data.(string)), value)
-}
-
-func (r *RedisRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+		return false, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
-
-	exists, err := r.client.Exists(ctx, key).Result()
+	data, err := r.encode(value)
 	if err != nil {
-		return err
-	}
-	if exists == 0 {
-		return ErrNotFound
+		return false, fmt.Errorf("%w: %v", ErrInvalidInput, err)
 	}
 
-	data, err := json.Marshal(value)
+	created, err := r.script(createIfAbsentScript).Run(ctx, r.client, []string{key}, data, ttl.Milliseconds()).Int64()
 	if err != nil {
-		return err
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
+	if created == 1 {
+		r.dropSiblings(ctx, key)
+	}
+	return created == 1, nil
+}
 
-	return r.client.Do(ctx, "JSON.SET", key, ".", string(data)).Err()
+func (r *RedisRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return CreateWithTTL(ctx, r, identifier, value, ttl)
 }
 
-func (r *RedisRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+func (r *RedisRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	if err := r.validateEntityPrefix(entityPrefix); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) EntityIdentifier {
+		return RedisIdentifier{EntityPrefix: entityPrefix, ID: id}
+	})
+}
+
+func (r *RedisRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
 
-	data, err := json.Marshal(value)
+	data, err := r.doRenewingIdle(ctx, key, r.docGet(key)...).Result()
 	if err != nil {
-		return err
+		if err == redis.Nil {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
 
-	return r.client.Do(ctx, "JSON.SET", key, ".", string(data)).Err()
+	return r.decode(data, value)
 }
 
-func (r *RedisRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+func (r *RedisRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return false, err
+	}
+	defer r.guard.leave()
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+		return false, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
-
-	result, err := r.client.Del(ctx, key).Result()
+	count, err := r.reader.Exists(ctx, key).Result()
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
-	}
-	if result == 0 {
-		return ErrNotFound
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
-
-	return nil
+	return count == 1, nil
 }
 
-func (r *RedisRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
-	// keyPattern, err := r.identifierToKey(pattern, true)
-	// if err != nil {
-	// 	return nil, nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
-	// }
-	keyPattern := pattern
-
-	// r.logger("DEBUG", fmt.Sprintf("go-datarepository.RedisRepository.List] keyPattern: (%s)", keyPattern))
-	keys, err := r.client.Keys(ctx, keyPattern).Result()
-	if err != nil {
-		return nil, nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+// ExistsMany pipelines an EXISTS per identifier, so it works across cluster slots
+func (r *RedisRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	batchErr := &BatchError{}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		cmd        *redis.IntCmd
 	}
+	pending := make([]pendingItem, 0, len(identifiers))
 
-	identifiers := make([]EntityIdentifier, 0, len(keys))
-	entities := make([]interface{}, 0, len(keys))
-	for _, key := range keys {
-		err := r.validateKey(key, false)
-		if err != nil {
-			continue // Skip invalid keys
-		}
-		identifier, err := r.keyToIdentifier(key)
+	pipe := r.reader.Pipeline()
+	for _, identifier := range identifiers {
+		key, err := r.identifierToKey(identifier, false)
 		if err != nil {
-			continue // Skip keys that can't be converted to identifiers
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
 		}
-		// retrieve the value
-		data, err := r.client.Do(ctx, "JSON.GET", key).Result()
+		pending = append(pending, pendingItem{identifier: identifier, cmd: pipe.Exists(ctx, key)})
+	}
+
+	if len(pending) > 0 {
+		_, _ = pipe.Exec(ctx)
+	}
+	result := make(map[EntityIdentifier]bool, len(pending))
+	for _, item := range pending {
+		count, err := item.cmd.Result()
 		if err != nil {
-			// return nil, nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
-			// nuts.L.Debugf("Error getting value for key %s: %v", key, err)
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
 			continue
 		}
-		entities = append(entities, data)
-		identifiers = append(identifiers, identifier)
+		result[item.identifier] = count == 1
 	}
-
-	// r.logger("DEBUG", fmt.Sprintf("go-datarepository.RedisRepository.List] identifiers: (%v) entities: (%v)", identifiers, entities))
-	return identifiers, entities, nil
+	return result, batchErr.ErrOrNil()
 }
 
-func (r *RedisRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
-	args := []interface{}{
-		"FT.SEARCH", r.prefix, query,
-		"LIMIT", offset, limit,
-		"SORTBY", sortBy, sortDir,
+func (r *RedisRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
 	}
-	res, err := r.client.Do(ctx, args...).Result()
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
-		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
-	}
-
-	array, ok := res.([]interface{})
-	if !ok || len(array) < 1 {
-		return nil, fmt.Errorf("unexpected search result format")
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
 
-	totalResults, ok := array[0].(int64)
-	if !ok {
-		return nil, fmt.Errorf("unexpected total results format")
+	pipe := r.reader.Pipeline()
+	getCmd := pipe.Do(ctx, r.docGet(key)...)
+	ttlCmd := pipe.PTTL(ctx, key)
+	var idleCmd *redis.StringCmd
+	if r.idleExpiration {
+		idleCmd = pipe.Get(ctx, r.idleKey(key))
 	}
-
-	if totalResults == 0 {
-		return []EntityIdentifier{}, nil
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
 
-	identifiers := make([]EntityIdentifier, 0, totalResults)
-	for i := 1; i < len(array); i += 2 {
-		key, ok := array[i].(string)
-		if !ok {
-			continue // Skip invalid keys
-		}
-		if err := r.validateKey(key, false); err != nil {
-			continue // Skip invalid keys
+	data, err := getCmd.Result()
+	if err != nil {
+		if err == redis.Nil {
+			return 0, ErrNotFound
+		}
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	ttl, err := ttlCmd.Result()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	switch ttl {
+	case -2:
+		// The key expired between the two commands
+		return 0, ErrNotFound
+	case -1:
+		ttl = NoExpiration
+	}
+	idle, err := r.renewIdle(ctx, key, idleCmd)
+	if err != nil {
+		return 0, err
+	}
+	if idle > 0 {
+		ttl = idle
+	}
+
+	if err := r.decode(data, value); err != nil {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (r *RedisRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.Update(ctx, identifier, value)
+		})
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	exists, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.Do(ctx, r.docSet(key, data)...).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return r.renewIdleAfterWrite(ctx, key)
+}
+
+func (r *RedisRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.UpdateField(ctx, identifier, path, value)
+		})
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	if r.stringStorage {
+		if err := r.updatePlainField(ctx, key, path, value); err != nil {
+			return err
+		}
+		return r.renewIdleAfterWrite(ctx, key)
+	}
+	jsonPath, err := redisJSONPath(path)
+	if err != nil {
+		return err
+	}
+
+	exists, err := r.client.Exists(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if exists == 0 {
+		return ErrNotFound
+	}
+
+	data, err := r.encodeField(value)
+	if err != nil {
+		return err
+	}
+
+	err = r.client.Do(ctx, "JSON.SET", key, jsonPath, data).Err()
+	if err == redis.Nil {
+		// JSON.SET replies nil if the parent of the path does not exist
+		return fmt.Errorf("%w: field path %q does not exist", ErrInvalidInput, path)
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return r.renewIdleAfterWrite(ctx, key)
+}
+
+// CompareAndSwap reads the document under WATCH and writes it with MULTI/EXEC, retrying if the
+// key was modified in between
+func (r *RedisRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return false, err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		var swapped bool
+		err := r.WithTransaction(ctx, func(tx DataRepository) (err error) {
+			swapped, err = tx.CompareAndSwap(ctx, identifier, expected, newValue)
+			return err
+		})
+		return swapped, err
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	for attempt := 0; attempt < RedisMaxTxRetries; attempt++ {
+		swapped := false
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			cmd := redis.NewCmd(ctx, r.docGet(key)...)
+			_ = tx.Process(ctx, cmd)
+			current, err := cmd.Text()
+			if err == redis.Nil {
+				return ErrNotFound
+			} else if err != nil {
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			equal, err := EqualEncoded(r.codec, []byte(current), expected)
+			if err != nil || !equal {
+				return err
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Do(ctx, r.docSet(key, data)...)
+				return nil
+			})
+			if err != nil && !errors.Is(err, redis.TxFailedErr) {
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			swapped = err == nil
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return swapped, err
+		}
+	}
+	return false, fmt.Errorf("%w: too many concurrent modifications", ErrOperationFailed)
+}
+
+// UpdateWithVersion keeps the version in a sibling key (the entity's key followed by
+// KeyPartVersion), which takes over the entity's TTL on each versioned update. Every later change
+// of the entity's expiration is applied to the version key as well, and creating the entity
+// deletes a version key left over from an earlier one. In a Redis cluster, both keys are only
+// served by the same node if the id contains a hash tag, e.g. "{user1}".
+func (r *RedisRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		var version int64
+		err := r.WithTransaction(ctx, func(tx DataRepository) (err error) {
+			version, err = tx.UpdateWithVersion(ctx, identifier, value, expectedVersion)
+			return err
+		})
+		return version, err
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	version, err := r.script(updateWithVersionScript).Run(ctx, r.client, []string{key, r.versionKey(key)}, expectedVersion, data).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	switch version {
+	case -1:
+		return 0, ErrNotFound
+	case -2:
+		return 0, ErrVersionConflict
+	}
+	return version, nil
+}
+
+func (r *RedisRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	version, err := getVersionScript.Run(ctx, r.reader, []string{key, r.versionKey(key)}).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if version < 0 {
+		return 0, ErrNotFound
+	}
+	return version, nil
+}
+
+func (r *RedisRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	if r.stringStorage {
+		return r.readPlainField(ctx, key, path, value)
+	}
+	jsonPath, err := redisJSONPath(path)
+	if err != nil {
+		return err
+	}
+
+	data, err := r.doRenewingIdle(ctx, key, "JSON.GET", key, jsonPath).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	// JSONPath queries return an array of all matches
+	var matches []json.RawMessage
+	if err := json.Unmarshal([]byte(data), &matches); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if len(matches) == 0 {
+		return fmt.Errorf("%w: field path %q does not exist", ErrInvalidInput, path)
+	}
+	return r.codec.Unmarshal(matches[0], value)
+}
+
+func (r *RedisRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.Upsert(ctx, identifier, value)
+		})
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.Do(ctx, r.docSet(key, data)...).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *RedisRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.UpsertWithTTL(ctx, identifier, value, ttl)
+		})
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	// MULTI/EXEC makes the value and its expiration visible together
+	pipe := r.client.TxPipeline()
+	pipe.Do(ctx, r.docSet(key, data)...)
+	pipe.PExpire(ctx, key, ttl)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return r.expireSiblings(ctx, ttl, key)
+}
+
+func (r *RedisRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		// Each item is written in its own transaction, as a failed item must not hold back the others
+		batchErr := &BatchError{}
+		for identifier, value := range items {
+			if err := r.UpsertWithTTL(ctx, identifier, value, ttl); err != nil {
+				batchErr.Add(identifier, err)
+			}
+		}
+		return batchErr.ErrOrNil()
+	}
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+
+	batchErr := &BatchError{}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		key        string
+		setCmd     *redis.Cmd
+		expireCmd  *redis.BoolCmd
+	}
+	pending := make([]pendingItem, 0, len(items))
+
+	// MULTI/EXEC makes each value and its expiration visible together
+	pipe := r.client.TxPipeline()
+	for identifier, value := range items {
+		key, err := r.identifierToKey(identifier, false)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		data, err := r.encode(value)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidInput, err))
+			continue
+		}
+		pending = append(pending, pendingItem{
+			identifier: identifier,
+			key:        key,
+			setCmd:     pipe.Do(ctx, r.docSet(key, data)...),
+			expireCmd:  pipe.PExpire(ctx, key, ttl),
+		})
+	}
+
+	if len(pending) > 0 {
+		// Per-command errors are inspected below
+		_, _ = pipe.Exec(ctx)
+	}
+	written := make([]string, 0, len(pending))
+	for _, item := range pending {
+		if err := item.setCmd.Err(); err != nil {
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+		} else if err := item.expireCmd.Err(); err != nil {
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+		} else {
+			written = append(written, item.key)
+		}
+	}
+	if err := r.expireSiblings(ctx, ttl, written...); err != nil {
+		return err
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *RedisRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.Delete(ctx, identifier)
+		})
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	result, err := r.client.Del(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if result == 0 {
+		return ErrNotFound
+	}
+	r.dropSiblings(ctx, key)
+	return nil
+}
+
+func (r *RedisRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.GetAndDelete(ctx, identifier, value)
+		})
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	data, err := r.script(getAndDeleteScript).Run(ctx, r.client, []string{key}).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	r.dropSiblings(ctx, key)
+	return r.decode(data, value)
+}
+
+func (r *RedisRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		return r.WithTransaction(ctx, func(tx DataRepository) error {
+			return tx.GetAndSet(ctx, identifier, newValue, oldValue)
+		})
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	previous, err := r.script(getAndSetScript).Run(ctx, r.client, []string{key}, data).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	return r.decode(previous, oldValue)
+}
+
+func (r *RedisRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		// Each item is written in its own transaction, as a failed item must not hold back the others
+		batchErr := &BatchError{}
+		for identifier, value := range items {
+			if err := r.Create(ctx, identifier, value); err != nil {
+				batchErr.Add(identifier, err)
+			}
+		}
+		return batchErr.ErrOrNil()
+	}
+	batchErr := &BatchError{}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		key        string
+		cmd        *redis.Cmd
+	}
+	pending := make([]pendingItem, 0, len(items))
+
+	pipe := r.client.Pipeline()
+	for identifier, value := range items {
+		key, err := r.identifierToKey(identifier, false)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		data, err := r.encode(value)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidInput, err))
+			continue
+		}
+		// NX only sets the document if the key does not exist yet
+		pending = append(pending, pendingItem{identifier: identifier, key: key, cmd: pipe.Do(ctx, r.docSet(key, data, "NX")...)})
+	}
+
+	if len(pending) > 0 {
+		_, _ = pipe.Exec(ctx)
+	}
+	created := make([]string, 0, len(pending))
+	for _, item := range pending {
+		if err := item.cmd.Err(); err == redis.Nil {
+			batchErr.Add(item.identifier, ErrAlreadyExists)
+		} else if err != nil {
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+		} else {
+			created = append(created, item.key)
+		}
+	}
+	r.dropSiblings(ctx, created...)
+	return batchErr.ErrOrNil()
+}
+
+func (r *RedisRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	batchErr := &BatchError{}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		cmd        *redis.Cmd
+	}
+	pending := make([]pendingItem, 0, len(identifiers))
+
+	pipe := r.reader.Pipeline()
+	for _, identifier := range identifiers {
+		key, err := r.identifierToKey(identifier, false)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		pending = append(pending, pendingItem{identifier: identifier, cmd: pipe.Do(ctx, r.docGet(key)...)})
+	}
+
+	if len(pending) > 0 {
+		_, _ = pipe.Exec(ctx)
+	}
+	for _, item := range pending {
+		data, err := item.cmd.Text()
+		if err == redis.Nil {
+			batchErr.Add(item.identifier, ErrNotFound)
+			continue
+		} else if err != nil {
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+			continue
+		}
+		if err := fn(item.identifier, []byte(data)); err != nil {
+			return err
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *RedisRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return ReadManyOrdered(ctx, r, r.codec, identifiers, dest)
+}
+
+func (r *RedisRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.fieldIndexes.active() {
+		// Each item is deleted in its own transaction, as a failed item must not hold back the others
+		batchErr := &BatchError{}
+		for _, identifier := range identifiers {
+			if err := r.Delete(ctx, identifier); err != nil {
+				batchErr.Add(identifier, err)
+			}
+		}
+		return batchErr.ErrOrNil()
+	}
+	batchErr := &BatchError{}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		cmd        *redis.IntCmd
+	}
+	pending := make([]pendingItem, 0, len(identifiers))
+
+	pipe := r.client.Pipeline()
+	for _, identifier := range identifiers {
+		key, err := r.identifierToKey(identifier, false)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		pending = append(pending, pendingItem{identifier: identifier, cmd: pipe.Del(ctx, key)})
+		pipe.Del(ctx, r.versionKey(key))
+		if r.idleExpiration {
+			pipe.Del(ctx, r.idleKey(key))
+		}
+	}
+
+	if len(pending) > 0 {
+		_, _ = pipe.Exec(ctx)
+	}
+	for _, item := range pending {
+		deleted, err := item.cmd.Result()
+		if err != nil {
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+		} else if deleted == 0 {
+			batchErr.Add(item.identifier, ErrNotFound)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern scans the matching keys and deletes them, together with their version and idle
+// keys, in pipelines of ScanCount entities. Lock and index keys are skipped. With field indexes
+// defined, the entities are deleted one by one like DeleteMany does.
+func (r *RedisRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	if err := checkDeletePattern(pattern); err != nil {
+		return 0, err
+	}
+	if r.fieldIndexes.active() {
+		return DeletePattern(ctx, r, pattern)
+	}
+	keyPattern, err := r.identifierToKey(pattern, true)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	var deleted int64
+	batch := make([]string, 0, r.scanCount)
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		pipe := r.client.Pipeline()
+		cmds := make([]*redis.IntCmd, len(batch))
+		for i, key := range batch {
+			cmds[i] = pipe.Del(ctx, key)
+			pipe.Del(ctx, r.versionKey(key))
+			if r.idleExpiration {
+				pipe.Del(ctx, r.idleKey(key))
+			}
+		}
+		if _, err := pipe.Exec(ctx); err != nil {
+			return err
+		}
+		// Keys returned twice by SCAN, or deleted by others in the meantime, count as 0
+		for _, cmd := range cmds {
+			deleted += cmd.Val()
+		}
+		batch = batch[:0]
+		return nil
+	}
+	err = r.scanKeys(ctx, keyPattern, "", func(key string) error {
+		if _, ok := r.entityIdentifierOfKey(key); !ok {
+			return nil
+		}
+		batch = append(batch, key)
+		if int64(len(batch)) < r.scanCount {
+			return nil
+		}
+		return flush()
+	})
+	if err == nil {
+		err = flush()
+	}
+	if err != nil {
+		return deleted, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return deleted, nil
+}
+
+func (r *RedisRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, nil, err
+	}
+	defer r.guard.leave()
+	result, err := r.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(r.notFoundOnEmpty)
+}
+
+func (r *RedisRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	if err := r.guard.enter(); err != nil {
+		return ListResult{}, err
+	}
+	defer r.guard.leave()
+	keyPattern := r.listPattern(pattern)
+
+	var keys []string
+	seen := make(map[string]struct{})
+	err := r.scanKeys(ctx, keyPattern, r.scanType, func(key string) error {
+		// SCAN may return the same key more than once
+		if _, dup := seen[key]; !dup {
+			seen[key] = struct{}{}
+			keys = append(keys, key)
+		}
+		return nil
+	})
+	if err != nil {
+		return ListResult{}, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	result := r.fetchEntities(ctx, keys)
+	if len(result.Identifiers) == 0 && len(result.Skipped) == 0 && r.notFoundOnEmpty {
+		return ListResult{}, ErrNotFound
+	}
+	return result, nil
+}
+
+func (r *RedisRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	keyPattern, err := r.identifierToKey(pattern, true)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	// SCAN may return the same key more than once
+	seen := make(map[string]struct{})
+	err = r.scanKeys(ctx, keyPattern, "", func(key string) error {
+		if _, ok := r.entityIdentifierOfKey(key); ok {
+			seen[key] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return int64(len(seen)), nil
+}
+
+// Iterate fetches the values of the scanned keys in pipelined batches of ScanCount keys, so that
+// only one batch is held in memory at a time. As SCAN may return a key more than once, fn may be
+// called more than once for the same entity.
+func (r *RedisRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	keyPattern, err := r.identifierToKey(pattern, true)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	// fnErr tells errors returned by fn, which are passed on as is, apart from SCAN errors
+	var fnErr error
+	batch := make([]string, 0, r.scanCount)
+	flush := func() error {
+		fnErr = r.iterateBatch(ctx, batch, fn)
+		batch = batch[:0]
+		return fnErr
+	}
+	err = r.scanKeys(ctx, keyPattern, r.scanType, func(key string) error {
+		batch = append(batch, key)
+		if int64(len(batch)) < r.scanCount {
+			return nil
+		}
+		return flush()
+	})
+	if fnErr != nil {
+		return fnErr
+	}
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return flush()
+}
+
+// iterateBatch reads the values of keys in one pipeline and passes them to fn. Keys that are not
+// entities, e.g. lock and version keys, are skipped, as are keys removed since they were scanned.
+func (r *RedisRepository) iterateBatch(ctx context.Context, keys []string, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		key        string
+		cmd        *redis.Cmd
+	}
+	pending := make([]pendingItem, 0, len(keys))
+
+	pipe := r.reader.Pipeline()
+	for _, key := range keys {
+		if err := r.validateKey(key, false); err != nil {
+			r.logger.Warnf("skipping key %q: %v", key, err)
+			continue
+		}
+		identifier, err := r.keyToIdentifier(key)
+		if err != nil {
+			r.logger.Warnf("skipping key %q: %v", key, err)
+			continue
+		}
+		if _, ok := r.entityIdentifierOfKey(key); !ok {
+			continue
+		}
+		pending = append(pending, pendingItem{identifier: identifier, key: key, cmd: pipe.Do(ctx, r.docGet(key)...)})
+	}
+
+	if len(pending) > 0 {
+		_, _ = pipe.Exec(ctx)
+	}
+	for _, item := range pending {
+		data, err := item.cmd.Text()
+		if err == redis.Nil {
+			r.logger.Debugf("skipping key %q that was removed while iterating", item.key)
+			continue
+		} else if err != nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+		if err := fn(item.identifier, []byte(data)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *RedisRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, nil, 0, err
+	}
+	defer r.guard.leave()
+	if pageSize <= 0 {
+		return nil, nil, 0, fmt.Errorf("%w: page size must be positive", ErrInvalidInput)
+	}
+	if _, isCluster := r.reader.(*redis.ClusterClient); isCluster {
+		return nil, nil, 0, fmt.Errorf("%w: ListPaged is not supported in cluster mode", ErrNotSupported)
+	}
+
+	var scanCmd *redis.ScanCmd
+	if r.scanType != "" {
+		scanCmd = r.reader.ScanType(ctx, cursor, r.listPattern(pattern), pageSize, r.scanType)
+	} else {
+		scanCmd = r.reader.Scan(ctx, cursor, r.listPattern(pattern), pageSize)
+	}
+	keys, nextCursor, err := scanCmd.Result()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	result := r.fetchEntities(ctx, keys)
+	return result.Identifiers, result.Entities, nextCursor, nil
+}
+
+// ListPage returns the keys of one SCAN call without fetching their values; the cursor is the SCAN
+// cursor. SCAN may return a key on more than one page.
+func (r *RedisRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, "", err
+	}
+	defer r.guard.leave()
+	if pageSize <= 0 {
+		return nil, "", fmt.Errorf("%w: page size must be positive", ErrInvalidInput)
+	}
+	if _, isCluster := r.reader.(*redis.ClusterClient); isCluster {
+		return nil, "", fmt.Errorf("%w: ListPage is not supported in cluster mode", ErrNotSupported)
+	}
+	position, err := parsePageCursor(cursor)
+	if err != nil {
+		return nil, "", err
+	}
+
+	var scanCmd *redis.ScanCmd
+	if r.scanType != "" {
+		scanCmd = r.reader.ScanType(ctx, position, r.listPattern(pattern), int64(pageSize), r.scanType)
+	} else {
+		scanCmd = r.reader.Scan(ctx, position, r.listPattern(pattern), int64(pageSize))
+	}
+	keys, next, err := scanCmd.Result()
+	if err != nil {
+		return nil, "", fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	identifiers := make([]EntityIdentifier, 0, len(keys))
+	for _, key := range keys {
+		if err := r.validateKey(key, false); err != nil {
+			r.logger.Debugf("skipping key %q: %v", key, err)
+			continue
+		}
+		identifier, err := r.keyToIdentifier(key)
+		if err != nil {
+			r.logger.Debugf("skipping key %q: %v", key, err)
+			continue
+		}
+		if _, ok := r.entityIdentifierOfKey(key); !ok {
+			continue
+		}
+		identifiers = append(identifiers, identifier)
+	}
+	return identifiers, formatPageCursor(next), nil
+}
+
+// fetchEntities converts the given keys to identifiers and retrieves their values.
+// Keys that are invalid or can't be read are reported as skipped; keys that were removed in
+// the meantime are left out, as are the lock, version and idle keys of entities and index sets.
+func (r *RedisRepository) fetchEntities(ctx context.Context, keys []string) ListResult {
+	result := ListResult{
+		Identifiers: make([]EntityIdentifier, 0, len(keys)),
+		Entities:    make([]interface{}, 0, len(keys)),
+	}
+	skip := func(key string, err error) {
+		r.logger.Warnf("skipping key %q: %v", key, err)
+		result.Skipped = append(result.Skipped, SkippedKey{Key: key, Err: err})
+	}
+	for _, key := range keys {
+		err := r.validateKey(key, false)
+		if err != nil {
+			skip(key, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		identifier, err := r.keyToIdentifier(key)
+		if err != nil {
+			skip(key, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		if _, ok := r.entityIdentifierOfKey(key); !ok {
+			continue
+		}
+		// retrieve the value
+		data, err := r.reader.Do(ctx, r.docGet(key)...).Result()
+		if err == redis.Nil {
+			r.logger.Debugf("skipping key %q that was removed while listing", key)
+			continue
+		} else if err != nil {
+			skip(key, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+			continue
+		}
+		var entity interface{}
+		if err := r.decode(data, &entity); err != nil {
+			skip(key, err)
+			continue
+		}
+		result.Entities = append(result.Entities, entity)
+		result.Identifiers = append(result.Identifiers, identifier)
+	}
+	return result
+}
+
+func (r *RedisRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	seen := make(map[string]struct{})
+	err := r.scanKeys(ctx, r.keyPrefix()+"*", "", func(key string) error {
+		parts := strings.Split(strings.TrimPrefix(key, r.keyPrefix()), r.separator)
+		// entityPrefix:id after the prefix, skipping lock, version and idle keys (entityPrefix:id:lock)
+		last := parts[len(parts)-1]
+		if len(parts) < DefaultKeyPartsCount-1 || last == KeyPartLock || last == KeyPartVersion || last == KeyPartIdle {
+			return nil
+		}
+		if r.validateEntityPrefix(parts[0]) == nil {
+			seen[parts[0]] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (r *RedisRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *RedisRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	result, err := r.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+	if err != nil {
+		return nil, err
+	}
+	return result.Identifiers, nil
+}
+
+func (r *RedisRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	if err := r.guard.enter(); err != nil {
+		return SearchResult{}, err
+	}
+	defer r.guard.leave()
+	response, err := r.search(ctx, query, SearchOptions{Offset: offset, Limit: limit, SortBy: sortBy, SortDir: sortDir}, false)
+	if err != nil {
+		return SearchResult{}, err
+	}
+	return response.SearchResult(), nil
+}
+
+// SearchResults decodes the values from the documents returned by FT.SEARCH, so no further
+// round trips are needed
+func (r *RedisRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	if err := r.guard.enter(); err != nil {
+		return SearchResponse{}, err
+	}
+	defer r.guard.leave()
+	return r.search(ctx, query, opts, true)
+}
+
+// SearchQuery compiles the query to the RediSearch syntax. Its field names refer to the
+// attribute names of the index; strings and bools are compared with TAG fields and numbers
+// with NUMERIC fields.
+func (r *RedisRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	if err := r.guard.enter(); err != nil {
+		return SearchResponse{}, err
+	}
+	defer r.guard.leave()
+	if err := query.Validate(); err != nil {
+		return SearchResponse{}, err
+	}
+	return r.search(ctx, query.redisSearch(), opts, true)
+}
+
+// search runs FT.SEARCH against the repository's index. Results are only sorted if SortBy is
+// set; SortDir defaults to ASC.
+func (r *RedisRepository) search(ctx context.Context, query string, opts SearchOptions, withValues bool) (SearchResponse, error) {
+	if r.stringStorage {
+		return SearchResponse{}, errJSONStorageRequired
+	}
+	args := []interface{}{
+		"FT.SEARCH", r.prefix, query,
+		"LIMIT", opts.Offset, opts.Limit,
+	}
+	if opts.SortBy != "" {
+		sortDir := opts.SortDir
+		if sortDir == "" {
+			sortDir = "ASC"
+		}
+		args = append(args, "SORTBY", opts.SortBy, sortDir)
+	}
+	res, err := r.reader.Do(ctx, args...).Result()
+	if err != nil {
+		return SearchResponse{}, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	array, ok := res.([]interface{})
+	if !ok || len(array) < 1 {
+		return SearchResponse{}, fmt.Errorf("unexpected search result format")
+	}
+
+	totalResults, ok := array[0].(int64)
+	if !ok {
+		return SearchResponse{}, fmt.Errorf("unexpected total results format")
+	}
+
+	if totalResults == 0 && r.notFoundOnEmpty {
+		return SearchResponse{}, ErrNotFound
+	}
+
+	response := SearchResponse{
+		Total: totalResults,
+		Hits:  make([]Hit, 0, len(array)/2),
+	}
+	for i := 1; i < len(array); i += 2 {
+		key, ok := array[i].(string)
+		if !ok {
+			r.logger.Warnf("skipping search result with unexpected key %v", array[i])
+			response.Skipped = append(response.Skipped, fmt.Sprintf("%v", array[i]))
+			continue
+		}
+		if err := r.validateKey(key, false); err != nil {
+			r.logger.Warnf("skipping invalid key %q in search results: %v", key, err)
+			response.Skipped = append(response.Skipped, key)
+			continue
 		}
 		identifier, err := r.keyToIdentifier(key)
 		if err != nil {
-			continue // Skip keys that can't be converted to identifiers
+			r.logger.Warnf("skipping key %q in search results that is not an identifier: %v", key, err)
+			response.Skipped = append(response.Skipped, key)
+			continue
 		}
-		identifiers = append(identifiers, identifier)
+		hit := Hit{Identifier: identifier}
+		if withValues {
+			var fields []interface{}
+			if i+1 < len(array) {
+				fields, _ = array[i+1].([]interface{})
+			}
+			if hit.Value, err = r.searchDocumentValue(fields); err != nil {
+				r.logger.Warnf("skipping search result %q whose value could not be decoded: %v", key, err)
+				response.Skipped = append(response.Skipped, key)
+				continue
+			}
+		}
+		response.Hits = append(response.Hits, hit)
 	}
 
-	return identifiers, nil
+	return response, nil
+}
+
+// searchDocumentValue decodes the whole JSON document, which FT.SEARCH returns as the field "$"
+func (r *RedisRepository) searchDocumentValue(fields []interface{}) (interface{}, error) {
+	for j := 0; j+1 < len(fields); j += 2 {
+		if name, _ := fields[j].(string); name == "$" {
+			var value interface{}
+			if err := r.decode(fields[j+1], &value); err != nil {
+				return nil, err
+			}
+			return value, nil
+		}
+	}
+	return nil, fmt.Errorf("%w: search result carries no document", ErrOperationFailed)
 }
 
 func (r *RedisRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
-	key, err := r.identifierToKey(identifier, false)
+	_, acquired, err := r.AcquireLockWithToken(ctx, identifier, ttl)
+	return acquired, err
+}
+
+func (r *RedisRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return "", false, err
+	}
+	defer r.guard.leave()
+	lockKey, err := r.lockKey(identifier)
 	if err != nil {
-		return false, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+		return "", false, err
 	}
-	lockKey := key + r.separator + KeyPartLock
-	acquired, err := r.client.SetNX(ctx, lockKey, 1, ttl).Result()
+	token := NewLockToken()
+	acquired, err := r.client.SetNX(ctx, lockKey, token, ttl).Result()
 	if err != nil {
-		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		return "", false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
-	return acquired, nil
+	if !acquired {
+		return "", false, nil
+	}
+	return token, true, nil
 }
 
 func (r *RedisRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
-	key, err := r.identifierToKey(identifier, false)
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	lockKey, err := r.lockKey(identifier)
 	if err != nil {
-		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+		return err
 	}
-	lockKey := key + r.separator + KeyPartLock
 	result, err := r.client.Del(ctx, lockKey).Result()
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
@@ -483,50 +2246,364 @@ func (r *RedisRepository) ReleaseLock(ctx context.Context, identifier EntityIden
 	return nil
 }
 
+func (r *RedisRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	lockKey, err := r.lockKey(identifier)
+	if err != nil {
+		return err
+	}
+	result, err := releaseLockScript.Run(ctx, r.client, []string{lockKey}, token).Int64()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	switch result {
+	case 0:
+		return ErrNotFound
+	case -1:
+		return ErrLockNotOwned
+	}
+	return nil
+}
+
+func (r *RedisRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return false, err
+	}
+	defer r.guard.leave()
+	lockKey, err := r.lockKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	renewed, err := renewLockScript.Run(ctx, r.client, []string{lockKey}, token, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return renewed == 1, nil
+}
+
+// lockKey returns the key of the lock for the given identifier
+func (r *RedisRepository) lockKey(identifier EntityIdentifier) (string, error) {
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return key + r.separator + KeyPartLock, nil
+}
+
+// channelName returns the full pub/sub channel name for channel
+func (r *RedisRepository) channelName(channel string) string {
+	return r.channelPrefix + r.separator + channel
+}
+
 func (r *RedisRepository) Publish(ctx context.Context, channel string, message interface{}) error {
-	fullChannel := r.prefix + r.separator + KeyPartPubSubChannel + r.separator + channel
-	return r.client.Publish(ctx, fullChannel, message).Err()
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	fullChannel := r.channelName(channel)
+	payload, err := EncodePayload(r.codec, message)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := r.client.Publish(ctx, fullChannel, payload).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
 }
 
 func (r *RedisRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
-	fullChannel := r.prefix + r.separator + KeyPartPubSubChannel + r.separator + channel
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	fullChannel := r.channelName(channel)
 	pubsub := r.client.Subscribe(ctx, fullChannel)
 	ch := make(chan interface{})
 
-	go func() {
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+		case <-r.guard.done():
+		}
+		pubsub.Close()
+	})
+
+	r.guard.goTracked(func() {
 		defer close(ch)
 		for msg := range pubsub.Channel() {
-			ch <- msg.Payload
+			select {
+			case ch <- msg.Payload:
+			case <-r.guard.done():
+				return
+			}
 		}
-	}()
+	})
 
 	return ch, nil
 }
 
+func (r *RedisRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	pubsub := r.client.Subscribe(ctx, r.channelName(channel))
+	return r.deliverMessages(ctx, pubsub)
+}
+
+func (r *RedisRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	pubsub := r.client.PSubscribe(ctx, r.channelName(pattern))
+	return r.deliverMessages(ctx, pubsub)
+}
+
+// redisSubscription is a SubscribeMessages or PSubscribe subscription of a RedisRepository
+type redisSubscription struct {
+	pubsub *redis.PubSub
+	ch     chan Message
+	done   chan struct{}
+	once   sync.Once
+	err    error
+}
+
+func (s *redisSubscription) Messages() <-chan Message {
+	return s.ch
+}
+
+// Close closes the underlying pubsub connection, which ends message delivery
+func (s *redisSubscription) Close() error {
+	s.once.Do(func() {
+		close(s.done)
+		s.err = s.pubsub.Close()
+	})
+	return s.err
+}
+
+// deliverMessages waits for the subscription to be confirmed and then forwards its messages
+// as Message values, with the channel prefix stripped, until the subscription is closed or ctx is done
+func (r *RedisRepository) deliverMessages(ctx context.Context, pubsub *redis.PubSub) (Subscription, error) {
+	// Receiving the confirmation makes subscription errors surface here
+	if _, err := pubsub.Receive(ctx); err != nil {
+		pubsub.Close()
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	channelPrefix := r.channelName("")
+	sub := &redisSubscription{
+		pubsub: pubsub,
+		ch:     make(chan Message),
+		done:   make(chan struct{}),
+	}
+
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+			sub.Close()
+		case <-r.guard.done():
+			sub.Close()
+		case <-sub.done:
+		}
+	})
+
+	r.guard.goTracked(func() {
+		defer close(sub.ch)
+		for msg := range pubsub.Channel() {
+			message := Message{
+				Channel: strings.TrimPrefix(msg.Channel, channelPrefix),
+				Payload: []byte(msg.Payload),
+			}
+			select {
+			case sub.ch <- message:
+			case <-sub.done:
+				return
+			}
+		}
+	})
+
+	return sub, nil
+}
+
 func (r *RedisRepository) Ping(ctx context.Context) error {
-	return r.client.Ping(ctx).Err()
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if err := r.client.Ping(ctx).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// RedisClientProvider is implemented by repositories backed by Redis. Check for it with a type
+// assertion, or use RedisClientOf, which also looks through wrapping repositories.
+type RedisClientProvider interface {
+	// Unwrap returns the underlying client to run commands the repository doesn't wrap.
+	// Commands sent through it bypass key validation, the key prefix and the codec.
+	Unwrap() redis.UniversalClient
+}
+
+var _ RedisClientProvider = (*RedisRepository)(nil)
+
+// Unwrap returns the underlying client. It must not be closed if the repository owns it.
+func (r *RedisRepository) Unwrap() redis.UniversalClient {
+	return r.client
+}
+
+// RedisClientOf returns the Redis client of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo is not backed by Redis, or if it is
+// restricted by a RestrictedRepository, as commands sent through the client would bypass that.
+func RedisClientOf(repo DataRepository) (redis.UniversalClient, bool) {
+	for {
+		switch r := repo.(type) {
+		case RedisClientProvider:
+			return r.Unwrap(), true
+		case *RestrictedRepository:
+			return nil, false
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// KeyFor returns the validated Redis key the entity is stored under, i.e.
+// prefix:entityPrefix:id, e.g. to inspect it with the client returned by RedisClientOf.
+// Returns ErrInvalidIdentifier if the identifier is invalid.
+func (r *RedisRepository) KeyFor(identifier EntityIdentifier) (string, error) {
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return key, nil
 }
 
+// Close waits for the operations in flight, which must not call Close themselves, ends all
+// subscriptions and closes the client if the repository owns it. Operations started after Close
+// return ErrOperationFailed. Closing a closed repository, or a view created by WithNamespace, is
+// a no-op.
 func (r *RedisRepository) Close() error {
+	if r.namespaced || !r.guard.close() {
+		return nil
+	}
+	if !r.ownsClient {
+		// The client is shared and closed by its owner
+		return nil
+	}
+	if r.reader != r.client {
+		if err := r.reader.Close(); err != nil {
+			r.client.Close()
+			return err
+		}
+	}
 	return r.client.Close()
 }
 
 func (r *RedisRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
 		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
-	return r.client.Expire(ctx, key, expiration).Err()
+	if err := r.client.PExpire(ctx, key, expiration).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return r.expireSiblings(ctx, expiration, key)
+}
+
+// SetExpirationMany sends a PEXPIRE for each entity in a single pipeline
+func (r *RedisRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	batchErr := &BatchError{}
+	type pendingItem struct {
+		identifier EntityIdentifier
+		key        string
+		cmd        *redis.BoolCmd
+	}
+	pending := make([]pendingItem, 0, len(identifiers))
+
+	pipe := r.client.Pipeline()
+	for _, identifier := range identifiers {
+		key, err := r.identifierToKey(identifier, false)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		pending = append(pending, pendingItem{identifier: identifier, key: key, cmd: pipe.PExpire(ctx, key, expiration)})
+	}
+
+	if len(pending) > 0 {
+		_, _ = pipe.Exec(ctx)
+	}
+	applied := make([]string, 0, len(pending))
+	for _, item := range pending {
+		ok, err := item.cmd.Result()
+		if err != nil {
+			batchErr.Add(item.identifier, fmt.Errorf("%w: %v", ErrOperationFailed, err))
+		} else if !ok {
+			batchErr.Add(item.identifier, ErrNotFound)
+		} else {
+			applied = append(applied, item.key)
+		}
+	}
+	if err := r.expireSiblings(ctx, expiration, applied...); err != nil {
+		return err
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *RedisRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return false, err
+	}
+	defer r.guard.leave()
+	switch cond {
+	case ExpireNX, ExpireXX, ExpireGT, ExpireLT:
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", ErrInvalidInput, cond)
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	if err := r.requireVersion(ctx, "7.0", "SetExpirationCond"); err != nil {
+		return false, err
+	}
+	applied, err := r.client.Do(ctx, "PEXPIRE", key, expiration.Milliseconds(), string(cond)).Int64()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if applied == 1 {
+		if err := r.expireSiblings(ctx, expiration, key); err != nil {
+			return true, err
+		}
+	}
+	return applied == 1, nil
 }
 
 func (r *RedisRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
 		return time.Duration(0), fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
-	ttl, err := r.client.TTL(ctx, key).Result()
+	ttl, err := r.reader.PTTL(ctx, key).Result()
 	if err != nil {
-		return 0, err
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
 	}
 	if ttl < 0 {
 		return 0, ErrNotFound
@@ -534,10 +2611,174 @@ func (r *RedisRepository) GetExpiration(ctx context.Context, identifier EntityId
 	return ttl, nil
 }
 
+// Persist runs PERSIST on the entity's key and removes its idle timeout
+func (r *RedisRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	removed, err := r.client.Persist(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if !removed {
+		// PERSIST doesn't tell a missing key from one without expiration
+		count, err := r.client.Exists(ctx, key).Result()
+		if err != nil {
+			return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+		if count == 0 {
+			return ErrNotFound
+		}
+	}
+	return r.expireSiblings(ctx, NoExpiration, key)
+}
+
+// Touch runs TOUCH on the entity's key, which updates its access time without transferring the
+// value, and restarts its idle expiration
+func (r *RedisRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	count, err := r.client.Touch(ctx, key).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+	return r.renewIdleAfterWrite(ctx, key)
+}
+
 func (r *RedisRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return r.IncrementBy(ctx, identifier, 1)
+}
+
+// counterError converts an error of a counter command. Redis rejects counter commands on keys
+// holding a JSON document (WRONGTYPE) or a string that is not a number.
+func counterError(err error) error {
+	message := err.Error()
+	if strings.HasPrefix(message, "WRONGTYPE") || strings.Contains(message, "not an integer") || strings.Contains(message, "not a valid float") {
+		return fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+	}
+	return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+}
+
+// IncrementBy uses INCRBY, so counters are plain string keys, unlike entities, which are JSON documents
+func (r *RedisRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	value, err := r.client.IncrBy(ctx, key, delta).Result()
+	if err != nil {
+		return 0, counterError(err)
+	}
+	return value, nil
+}
+
+func (r *RedisRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return r.IncrementBy(ctx, identifier, -delta)
+}
+
+func (r *RedisRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, false, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, false, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	result, err := incrementWithLimitScript.Run(ctx, r.client, []string{key}, delta, max).Int64Slice()
+	if err != nil {
+		return 0, false, counterError(err)
+	}
+	return result[0], result[1] == 1, nil
+}
+
+func (r *RedisRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	value, err := incrementWithExpiryScript.Run(ctx, r.client, []string{key}, delta, ttl.Milliseconds()).Int64()
+	if err != nil {
+		return 0, counterError(err)
+	}
+	return value, nil
+}
+
+// IncrementFloat uses INCRBYFLOAT, which stores the result with up to 17 significant digits
+func (r *RedisRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	value, err := r.client.IncrByFloat(ctx, key, delta).Result()
+	if err != nil {
+		return 0, counterError(err)
+	}
+	return value, nil
+}
+
+func (r *RedisRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
 	key, err := r.identifierToKey(identifier, false)
 	if err != nil {
 		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
 	}
-	return r.client.Incr(ctx, key).Result()
+	data, err := r.reader.Get(ctx, key).Result()
+	if err == redis.Nil {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, counterError(err)
+	}
+	value, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (r *RedisRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	if err := r.client.Set(ctx, key, value, redis.KeepTTL).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
 }
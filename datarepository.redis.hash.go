@@ -0,0 +1,99 @@
+// datarepository.redis.hash.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ HashStore = (*RedisRepository)(nil)
+
+// HashSet runs HSET with the value encoded by the codec
+func (r *RedisRepository) HashSet(ctx context.Context, identifier EntityIdentifier, field string, value interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	encoded, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	if err := r.client.HSet(ctx, key, field, encoded).Err(); err != nil {
+		return structureError(err, errNotAHash)
+	}
+	return nil
+}
+
+// HashGet runs HGET
+func (r *RedisRepository) HashGet(ctx context.Context, identifier EntityIdentifier, field string, out interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	value, err := r.reader.HGet(ctx, key, field).Result()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return structureError(err, errNotAHash)
+	}
+	if err := r.decode(value, out); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return nil
+}
+
+// HashGetAll runs HGETALL
+func (r *RedisRepository) HashGetAll(ctx context.Context, identifier EntityIdentifier) (map[string]interface{}, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	values, err := r.reader.HGetAll(ctx, key).Result()
+	if err != nil {
+		return nil, structureError(err, errNotAHash)
+	}
+	fields := make(map[string]interface{}, len(values))
+	for field, value := range values {
+		var decoded interface{}
+		if err := r.decode(value, &decoded); err != nil {
+			return nil, fmt.Errorf("%w: field %q: %v", ErrOperationFailed, field, err)
+		}
+		fields[field] = decoded
+	}
+	return fields, nil
+}
+
+// HashDelete runs HDEL
+func (r *RedisRepository) HashDelete(ctx context.Context, identifier EntityIdentifier, field string) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	if err := r.client.HDel(ctx, key, field).Err(); err != nil {
+		return structureError(err, errNotAHash)
+	}
+	return nil
+}
@@ -0,0 +1,163 @@
+// datarepository.redis.idle.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ IdleExpirer = (*RedisRepository)(nil)
+
+// errIdleExpirationDisabled is returned by SetIdleExpiration and GetIdleExpiration unless
+// RedisConfig.IdleExpiration is set
+var errIdleExpirationDisabled = fmt.Errorf("%w: idle expiration requires RedisConfig.IdleExpiration", ErrNotSupported)
+
+// SetIdleExpiration sets the entity's TTL to idle and stores idle in a sibling key (the entity's
+// key followed by KeyPartIdle) with the same TTL. Reads fetch the sibling key in the same
+// pipeline and, if it exists, renew both TTLs, and that of the entity's version key, with PEXPIRE.
+// Returns ErrNotSupported unless RedisConfig.IdleExpiration is set.
+func (r *RedisRepository) SetIdleExpiration(ctx context.Context, identifier EntityIdentifier, idle time.Duration) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if !r.idleExpiration {
+		return errIdleExpirationDisabled
+	}
+	if err := validateIdleExpiration(idle); err != nil {
+		return err
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	applied, err := r.client.PExpire(ctx, key, idle).Result()
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if !applied {
+		return ErrNotFound
+	}
+	// The idle and version keys are written separately as they may be served by other cluster nodes
+	pipe := r.client.Pipeline()
+	pipe.Set(ctx, r.idleKey(key), idle.Milliseconds(), idle)
+	pipe.PExpire(ctx, r.versionKey(key), idle)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// GetIdleExpiration returns ErrNotSupported unless RedisConfig.IdleExpiration is set
+func (r *RedisRepository) GetIdleExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	if !r.idleExpiration {
+		return 0, errIdleExpirationDisabled
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	pipe := r.reader.Pipeline()
+	existsCmd := pipe.Exists(ctx, key)
+	idleCmd := pipe.Get(ctx, r.idleKey(key))
+	if _, err := pipe.Exec(ctx); err != nil && err != redis.Nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if existsCmd.Val() == 0 {
+		return 0, ErrNotFound
+	}
+	return idleTimeoutOf(idleCmd)
+}
+
+// idleKey returns the key holding the idle timeout of the entity stored under key
+func (r *RedisRepository) idleKey(key string) string {
+	return key + r.separator + KeyPartIdle
+}
+
+// idleTimeoutOf returns the idle timeout read by a GET of an idle key, or 0 if there is none
+func idleTimeoutOf(cmd interface{ Int64() (int64, error) }) (time.Duration, error) {
+	ms, err := cmd.Int64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return time.Duration(ms) * time.Millisecond, nil
+}
+
+// doRenewingIdle runs a read command on key. If idle expiration is enabled, the idle timeout is
+// read in the same pipeline, and the expiration of the entity is restarted if it has one.
+func (r *RedisRepository) doRenewingIdle(ctx context.Context, key string, args ...interface{}) *redis.Cmd {
+	if !r.idleExpiration {
+		return r.reader.Do(ctx, args...)
+	}
+	pipe := r.reader.Pipeline()
+	cmd := pipe.Do(ctx, args...)
+	idleCmd := pipe.Get(ctx, r.idleKey(key))
+	// Per-command errors are inspected below
+	_, _ = pipe.Exec(ctx)
+	if cmd.Err() == nil {
+		if _, err := r.renewIdle(ctx, key, idleCmd); err != nil {
+			cmd.SetErr(err)
+		}
+	}
+	return cmd
+}
+
+// renewIdle restarts the expiration of the entity and its idle and version keys if idleCmd, which
+// is nil if idle expiration is disabled, read an idle timeout. Returns the idle timeout, or 0 if
+// there is none.
+func (r *RedisRepository) renewIdle(ctx context.Context, key string, idleCmd *redis.StringCmd) (time.Duration, error) {
+	if idleCmd == nil {
+		return 0, nil
+	}
+	idle, err := idleTimeoutOf(idleCmd)
+	if err != nil || idle == 0 {
+		return 0, err
+	}
+	pipe := r.client.Pipeline()
+	pipe.PExpire(ctx, key, idle)
+	pipe.PExpire(ctx, r.idleKey(key), idle)
+	pipe.PExpire(ctx, r.versionKey(key), idle)
+	if _, err := pipe.Exec(ctx); err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return idle, nil
+}
+
+// renewIdleAfterWrite restarts the expiration of the entity under key after an update, if idle
+// expiration is enabled and the entity has an idle timeout
+func (r *RedisRepository) renewIdleAfterWrite(ctx context.Context, key string) error {
+	if !r.idleExpiration {
+		return nil
+	}
+	_, err := r.renewIdle(ctx, key, r.client.Get(ctx, r.idleKey(key)))
+	return err
+}
+
+// renewIdle queues restarting the expiration of the entity under key if it has an idle timeout
+func (t *redisTransaction) renewIdle(ctx context.Context, key string) error {
+	if !t.repo.idleExpiration {
+		return nil
+	}
+	idleKey := t.repo.idleKey(key)
+	idle, err := idleTimeoutOf(t.do(ctx, key, "GET", idleKey))
+	if err != nil || idle == 0 {
+		return err
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.PExpire(ctx, key, idle)
+		pipe.PExpire(ctx, idleKey, idle)
+		pipe.PExpire(ctx, t.repo.versionKey(key), idle)
+	})
+}
@@ -0,0 +1,156 @@
+// datarepository.redis.index.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// IndexFieldType is the type of a field of a RediSearch index
+type IndexFieldType string
+
+const (
+	// IndexFieldText is a full-text searchable string field
+	IndexFieldText IndexFieldType = "TEXT"
+	// IndexFieldNumeric is a numeric field that supports range queries
+	IndexFieldNumeric IndexFieldType = "NUMERIC"
+	// IndexFieldTag is an exact-match field, e.g. for states or categories
+	IndexFieldTag IndexFieldType = "TAG"
+)
+
+// IndexField is a field of a RediSearch index
+type IndexField struct {
+	// Path is the JSONPath of the field in the stored documents, e.g. "$.address.city"
+	Path string
+	// Name is the attribute name used in queries and as sortBy of Search.
+	// Defaults to the last segment of Path, e.g. "city".
+	Name string
+	// Type is the type of the field
+	Type IndexFieldType
+	// Sortable allows sorting search results by the field
+	Sortable bool
+}
+
+// IndexSchema describes which documents a RediSearch index covers and which of their fields it indexes
+type IndexSchema struct {
+	// EntityPrefixes restricts the index to entities with these entity prefixes.
+	// If empty, all entities of the repository are indexed.
+	EntityPrefixes []string
+	// Fields are the indexed fields; at least one is required
+	Fields []IndexField
+}
+
+// SearchIndexName returns the name of the index queried by Search and SearchDetailed, which is
+// the repository's key prefix
+func (r *RedisRepository) SearchIndexName() string {
+	return r.prefix
+}
+
+// CreateIndex creates a RediSearch index over the repository's JSON documents using FT.CREATE.
+// Name it SearchIndexName() to make it the index used by Search. Existing documents are indexed
+// in the background.
+// Returns ErrAlreadyExists if an index with that name already exists.
+// Returns ErrInvalidInput if the name or schema is invalid.
+func (r *RedisRepository) CreateIndex(ctx context.Context, name string, schema IndexSchema) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if r.stringStorage {
+		return errJSONStorageRequired
+	}
+	args, err := r.createIndexArgs(name, schema)
+	if err != nil {
+		return err
+	}
+	if err := r.client.Do(ctx, args...).Err(); err != nil {
+		if strings.Contains(strings.ToLower(err.Error()), "already exists") {
+			return ErrAlreadyExists
+		}
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// createIndexArgs builds the FT.CREATE command. The index covers the keys below the repository's
+// prefix, or below the given entity prefixes.
+func (r *RedisRepository) createIndexArgs(name string, schema IndexSchema) ([]interface{}, error) {
+	if name == "" {
+		return nil, fmt.Errorf("%w: index name must not be empty", ErrInvalidInput)
+	}
+	if len(schema.Fields) == 0 {
+		return nil, fmt.Errorf("%w: index schema needs at least one field", ErrInvalidInput)
+	}
+
+	var prefixes []interface{}
+	for _, entityPrefix := range schema.EntityPrefixes {
+		if err := r.validateEntityPrefix(entityPrefix); err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+		}
+		prefixes = append(prefixes, r.keyPrefix()+entityPrefix+r.separator)
+	}
+	if len(prefixes) == 0 && r.keyPrefix() != "" {
+		prefixes = append(prefixes, r.keyPrefix())
+	}
+
+	args := []interface{}{"FT.CREATE", name, "ON", "JSON"}
+	if len(prefixes) > 0 {
+		args = append(args, "PREFIX", len(prefixes))
+		args = append(args, prefixes...)
+	}
+	args = append(args, "SCHEMA")
+	for _, field := range schema.Fields {
+		switch field.Type {
+		case IndexFieldText, IndexFieldNumeric, IndexFieldTag:
+		default:
+			return nil, fmt.Errorf("%w: unknown index field type %q", ErrInvalidInput, field.Type)
+		}
+		if field.Path == "" {
+			return nil, fmt.Errorf("%w: index field path must not be empty", ErrInvalidInput)
+		}
+		fieldName := field.Name
+		if fieldName == "" {
+			fieldName = field.Path[strings.LastIndex(field.Path, ".")+1:]
+		}
+		args = append(args, field.Path, "AS", fieldName, string(field.Type))
+		if field.Sortable {
+			args = append(args, "SORTABLE")
+		}
+	}
+	return args, nil
+}
+
+// DropIndex removes a RediSearch index using FT.DROPINDEX. The indexed documents are kept.
+// Returns ErrNotFound if the index does not exist.
+func (r *RedisRepository) DropIndex(ctx context.Context, name string) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if err := r.client.Do(ctx, "FT.DROPINDEX", name).Err(); err != nil {
+		message := strings.ToLower(err.Error())
+		if strings.Contains(message, "unknown index name") || strings.Contains(message, "no such index") {
+			return ErrNotFound
+		}
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// ListIndexes returns the sorted names of all RediSearch indexes on the server using FT._LIST,
+// including those of other repositories
+func (r *RedisRepository) ListIndexes(ctx context.Context) ([]string, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	names, err := r.reader.Do(ctx, "FT._LIST").StringSlice()
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	sort.Strings(names)
+	return names, nil
+}
@@ -0,0 +1,123 @@
+//go:build integration
+
+// datarepository.redis.index_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"slices"
+	"testing"
+	"time"
+)
+
+// newTestRediSearchRepository returns a RedisRepository storing RedisJSON documents on the server
+// at REDIS_STACK_ADDR, which needs the RediSearch and RedisJSON modules. It uses a key prefix of
+// its own whose user and order entities are deleted when the test ends. Skips the test if REDIS_STACK_ADDR is not set.
+func newTestRediSearchRepository(t *testing.T) *RedisRepository {
+	t.Helper()
+	addr := os.Getenv("REDIS_STACK_ADDR")
+	if addr == "" {
+		t.Skip("REDIS_STACK_ADDR not set")
+	}
+	repo, err := NewRedisRepository(RedisConfig{
+		Addrs:       []string{addr},
+		KeyPrefix:   fmt.Sprintf("test%d", time.Now().UnixNano()),
+		StorageMode: RedisStorageJSON,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisRepository: %v", err)
+	}
+	redisRepo := repo.(*RedisRepository)
+	t.Cleanup(func() {
+		ctx := context.Background()
+		for _, pattern := range []string{"user:*", "order:*"} {
+			if _, err := redisRepo.DeletePattern(ctx, SimpleIdentifier(pattern)); err != nil {
+				t.Errorf("deleting the test keys: %v", err)
+			}
+		}
+		redisRepo.Close()
+	})
+	return redisRepo
+}
+
+func TestRediSearchIndexLifecycle(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRediSearchRepository(t)
+	name := repo.SearchIndexName()
+	schema := IndexSchema{
+		EntityPrefixes: []string{"user"},
+		Fields: []IndexField{
+			{Path: "$.name", Type: IndexFieldText},
+			{Path: "$.age", Type: IndexFieldNumeric, Sortable: true},
+			{Path: "$.role", Type: IndexFieldTag},
+		},
+	}
+	if err := repo.CreateIndex(ctx, name, schema); err != nil {
+		t.Fatalf("CreateIndex: %v", err)
+	}
+	t.Cleanup(func() { repo.DropIndex(context.Background(), name) })
+	if err := repo.CreateIndex(ctx, name, schema); !errors.Is(err, ErrAlreadyExists) {
+		t.Errorf("CreateIndex of an existing index: got %v, want ErrAlreadyExists", err)
+	}
+	if names, err := repo.ListIndexes(ctx); err != nil || !slices.Contains(names, name) {
+		t.Errorf("ListIndexes: got %v, %v, want it to contain %s", names, err, name)
+	}
+
+	for i, user := range []map[string]interface{}{
+		{"name": "ann", "age": 31, "role": "admin"},
+		{"name": "bob", "age": 25, "role": "user"},
+		{"name": "cy", "age": 40, "role": "user"},
+	} {
+		if err := repo.Create(ctx, SimpleIdentifier(fmt.Sprintf("user:%d", i+1)), user); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, SimpleIdentifier("order:1"), map[string]interface{}{"name": "ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	// Documents are indexed in the background
+	var ids []EntityIdentifier
+	var err error
+	for deadline := time.Now().Add(5 * time.Second); time.Now().Before(deadline); time.Sleep(50 * time.Millisecond) {
+		if ids, err = repo.Search(ctx, "@role:{user}", 0, 10, "age", "DESC"); err == nil && len(ids) == 2 {
+			break
+		}
+	}
+	if err != nil || fmt.Sprint(identifierStrings(ids)) != "[user:3 user:2]" {
+		t.Errorf("Search by tag sorted by age: got %v, %v, want [user:3 user:2]", ids, err)
+	}
+	if ids, err := repo.Search(ctx, "@name:ann", 0, 10, "", ""); err != nil || fmt.Sprint(identifierStrings(ids)) != "[user:1]" {
+		t.Errorf("Search by text outside the indexed entity prefixes: got %v, %v, want [user:1]", ids, err)
+	}
+
+	if err := repo.DropIndex(ctx, name); err != nil {
+		t.Fatalf("DropIndex: %v", err)
+	}
+	if err := repo.DropIndex(ctx, name); !errors.Is(err, ErrNotFound) {
+		t.Errorf("DropIndex of a dropped index: got %v, want ErrNotFound", err)
+	}
+	// The documents outlive the index
+	if exists, err := repo.Exists(ctx, SimpleIdentifier("user:1")); err != nil || !exists {
+		t.Errorf("Exists after DropIndex: got %v, %v, want true", exists, err)
+	}
+}
+
+func TestRediSearchIndexRejectsInvalidSchemas(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestRediSearchRepository(t)
+	for _, schema := range []IndexSchema{
+		{},
+		{Fields: []IndexField{{Path: "$.name", Type: "GEOSHAPE"}}},
+		{Fields: []IndexField{{Type: IndexFieldText}}},
+		{EntityPrefixes: []string{"1user"}, Fields: []IndexField{{Path: "$.name", Type: IndexFieldText}}},
+	} {
+		if err := repo.CreateIndex(ctx, repo.SearchIndexName(), schema); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("CreateIndex(%+v): got %v, want ErrInvalidInput", schema, err)
+		}
+	}
+}
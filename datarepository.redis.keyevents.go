@@ -0,0 +1,207 @@
+// datarepository.redis.keyevents.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// redisKeyEventTypes maps the keyspace notifications of the commands the repository uses to
+// event types. Other notifications, e.g. expire for a changed TTL, are ignored.
+var redisKeyEventTypes = map[string]EventType{
+	"json.set":    EventSet,
+	"set":         EventSet,
+	"incrby":      EventSet,
+	"incrbyfloat": EventSet,
+	"rpush":       EventSet,
+	"lpop":        EventSet,
+	"sadd":        EventSet,
+	"srem":        EventSet,
+	"hset":        EventSet,
+	"hdel":        EventSet,
+	"zadd":        EventSet,
+	"zincr":       EventSet,
+	"del":         EventDel,
+	"json.del":    EventDel,
+	"expired":     EventExpired,
+	"evicted":     EventEvicted,
+}
+
+var _ KeyspaceNotifier = (*RedisRepository)(nil)
+
+// SubscribeKeyspaceEvents subscribes to the keyspace notifications
+// (__keyspace@db__:key) of the keys matching pattern. Notifications must be enabled on the
+// server, e.g. with "CONFIG SET notify-keyspace-events KEA" or at least "K$gxed" for the
+// commands of the repository. Notifications of lock, version, idle and index keys are skipped.
+// In cluster mode each master sends the notifications of its own keys, so every master known
+// at the time of the call is subscribed; masters added later are not.
+func (r *RedisRepository) SubscribeKeyspaceEvents(ctx context.Context, pattern EntityIdentifier, events ...EventType) (chan KeyEvent, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	filter, err := newKeyEventFilter(events)
+	if err != nil {
+		return nil, err
+	}
+	keyPattern, err := r.identifierToKey(pattern, true)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	channelPrefix := fmt.Sprintf("__keyspace@%d__:", r.database())
+
+	pubsubs, err := r.subscribeKeyspace(ctx, channelPrefix+keyPattern)
+	if err != nil {
+		return nil, err
+	}
+	closeAll := func() {
+		for _, pubsub := range pubsubs {
+			pubsub.Close()
+		}
+	}
+	for _, pubsub := range pubsubs {
+		// Receiving the confirmation makes subscription errors surface here
+		if _, err := pubsub.Receive(ctx); err != nil {
+			closeAll()
+			return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+	}
+
+	ch := make(chan KeyEvent, KeyEventBufferSize)
+	r.guard.goTracked(func() {
+		select {
+		case <-ctx.Done():
+		case <-r.guard.done():
+		}
+		closeAll()
+	})
+
+	var forwarding sync.WaitGroup
+	for _, pubsub := range pubsubs {
+		forwarding.Add(1)
+		r.guard.goTracked(func() {
+			defer forwarding.Done()
+			for msg := range pubsub.Channel() {
+				event, ok := redisKeyEventTypes[msg.Payload]
+				if !ok || !filter[event] {
+					continue
+				}
+				identifier, ok := r.entityIdentifierOfKey(strings.TrimPrefix(msg.Channel, channelPrefix))
+				if !ok {
+					continue
+				}
+				select {
+				case ch <- KeyEvent{Type: event, Identifier: identifier}:
+				default:
+					// Channel is full, skip this event
+				}
+			}
+		})
+	}
+	r.guard.goTracked(func() {
+		forwarding.Wait()
+		close(ch)
+	})
+
+	return ch, nil
+}
+
+// subscribeKeyspace subscribes to the notification channel pattern on the server, or on each
+// master in cluster mode
+func (r *RedisRepository) subscribeKeyspace(ctx context.Context, channel string) ([]*redis.PubSub, error) {
+	cluster, ok := r.client.(*redis.ClusterClient)
+	if !ok {
+		return []*redis.PubSub{r.client.PSubscribe(ctx, channel)}, nil
+	}
+	var mu sync.Mutex
+	var pubsubs []*redis.PubSub
+	err := cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+		pubsub := node.PSubscribe(ctx, channel)
+		mu.Lock()
+		defer mu.Unlock()
+		pubsubs = append(pubsubs, pubsub)
+		return nil
+	})
+	if err != nil {
+		for _, pubsub := range pubsubs {
+			pubsub.Close()
+		}
+		return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return pubsubs, nil
+}
+
+// database returns the number of the database the client uses, which is always 0 in cluster mode
+func (r *RedisRepository) database() int {
+	if client, ok := r.client.(*redis.Client); ok {
+		return client.Options().DB
+	}
+	return 0
+}
+
+// entityIdentifierOfKey returns the identifier of the entity stored under key, or false if key
+// holds the lock, version or idle timeout of an entity, or an index set
+func (r *RedisRepository) entityIdentifierOfKey(key string) (EntityIdentifier, bool) {
+	identifier, err := r.keyToIdentifier(key)
+	if err != nil {
+		return nil, false
+	}
+	if id, ok := identifier.(RedisIdentifier); ok {
+		if id.EntityPrefix == KeyPartIndex || r.validateHierarchicalID(id.ID) != nil {
+			return nil, false
+		}
+	}
+	return identifier, true
+}
+
+var _ KeyWatcher = (*RedisRepository)(nil)
+
+// Watch subscribes to the keyspace notifications of the entity's key and reads its value on
+// each change, so notifications must be enabled as for SubscribeKeyspaceEvents. A value is read
+// after the change was reported, so it may already be that of a later change.
+func (r *RedisRepository) Watch(ctx context.Context, identifier EntityIdentifier) (chan []byte, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	if _, err := r.identifierToKey(identifier, false); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	var pattern EntityIdentifier
+	switch id := identifier.(type) {
+	case RedisIdentifier:
+		pattern = RedisIdentifier{EntityPrefix: id.EntityPrefix, ID: EscapeGlob(id.ID)}
+	case SimpleIdentifier:
+		pattern = SimpleIdentifier(EscapeGlob(string(id)))
+	}
+	events, err := r.SubscribeKeyspaceEvents(ctx, pattern)
+	if err != nil {
+		return nil, err
+	}
+
+	ch := make(chan []byte, KeyEventBufferSize)
+	r.guard.goTracked(func() {
+		defer close(ch)
+		for event := range events {
+			var value []byte
+			if event.Type == EventSet {
+				err := r.ReadMany(ctx, []EntityIdentifier{identifier}, func(_ EntityIdentifier, raw []byte) error {
+					value = raw
+					return nil
+				})
+				if err != nil && !errors.Is(err, ErrNotFound) {
+					// E.g. the key holds a list or the repository is closing
+					continue
+				}
+			}
+			sendLatest(ch, value)
+		}
+	})
+	return ch, nil
+}
@@ -0,0 +1,93 @@
+//go:build integration
+
+// datarepository.redis.keyevents_test.go
+
+package datarepository
+
+import (
+	"context"
+	"testing"
+	"time"
+)
+
+func TestRedisKeyspaceEvents(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	// miniredis sends no keyspace notifications, so this needs a real server
+	repo := newTestRediSearchRepository(t)
+	if err := repo.client.ConfigSet(ctx, "notify-keyspace-events", "KEA").Err(); err != nil {
+		t.Fatalf("enabling keyspace notifications: %v", err)
+	}
+	events, err := repo.SubscribeKeyspaceEvents(ctx, SimpleIdentifier("user:*"))
+	if err != nil {
+		t.Fatalf("SubscribeKeyspaceEvents: %v", err)
+	}
+
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, SimpleIdentifier("order:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventSet || event.Identifier.String() != "user:1" {
+		t.Errorf("after Create: got %+v, want a set event of user:1", event)
+	}
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if event := receiveKeyEvent(t, events); event.Type != EventDel || event.Identifier.String() != "user:1" {
+		t.Errorf("after Delete: got %+v, want a del event of user:1", event)
+	}
+
+	if err := repo.CreateWithTTL(ctx, id, map[string]int{"a": 2}, 100*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	for {
+		event := receiveKeyEvent(t, events)
+		if event.Type == EventExpired {
+			if event.Identifier.String() != "user:1" {
+				t.Errorf("after expiration: got %+v, want an expired event of user:1", event)
+			}
+			break
+		}
+	}
+}
+
+func TestRedisWatch(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	repo := newTestRediSearchRepository(t)
+	if err := repo.client.ConfigSet(ctx, "notify-keyspace-events", "KEA").Err(); err != nil {
+		t.Fatalf("enabling keyspace notifications: %v", err)
+	}
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	values, err := repo.Watch(ctx, id)
+	if err != nil {
+		t.Fatalf("Watch: %v", err)
+	}
+
+	// Each value is fetched after its notification, so wait for it before the next update
+	for _, a := range []int{2, 3} {
+		if err := repo.Update(ctx, id, map[string]int{"a": a}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		var value map[string]int
+		if err := repo.codec.Unmarshal(receiveWatched(t, values), &value); err != nil || value["a"] != a {
+			t.Errorf("after Update: got %v, %v, want a=%d", value, err, a)
+		}
+	}
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if value := receiveWatched(t, values); value != nil {
+		t.Errorf("after Delete: got %s, want nil", value)
+	}
+
+	cancel()
+	for range values {
+	}
+}
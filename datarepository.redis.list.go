@@ -0,0 +1,115 @@
+// datarepository.redis.list.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ ListStore = (*RedisRepository)(nil)
+
+// ListPush runs RPUSH with the values encoded by the codec
+func (r *RedisRepository) ListPush(ctx context.Context, identifier EntityIdentifier, values ...interface{}) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	if len(values) == 0 {
+		return 0, errNoValues
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	args := make([]interface{}, len(values))
+	for i, value := range values {
+		if args[i], err = r.encode(value); err != nil {
+			return 0, err
+		}
+	}
+
+	length, err := r.client.RPush(ctx, key, args...).Result()
+	if err != nil {
+		return 0, structureError(err, errNotAList)
+	}
+	return length, nil
+}
+
+// ListRange runs LRANGE
+func (r *RedisRepository) ListRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, out interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	values, err := r.reader.LRange(ctx, key, start, stop).Result()
+	if err != nil {
+		return structureError(err, errNotAList)
+	}
+	encoded := make([][]byte, len(values))
+	for i, value := range values {
+		encoded[i] = []byte(value)
+	}
+	return decodeSlice(r.codec, encoded, out)
+}
+
+// ListPop runs LPOP
+func (r *RedisRepository) ListPop(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if err := checkOut(out); err != nil {
+		return err
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	value, err := r.client.LPop(ctx, key).Result()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return structureError(err, errNotAList)
+	}
+	if err := r.decode(value, out); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return nil
+}
+
+// ListLen runs LLEN
+func (r *RedisRepository) ListLen(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	length, err := r.reader.LLen(ctx, key).Result()
+	if err != nil {
+		return 0, structureError(err, errNotAList)
+	}
+	return length, nil
+}
+
+// structureError converts an error of a data structure command. Redis rejects these commands
+// with WRONGTYPE on keys holding another type, which is reported as wrongType.
+func structureError(err error, wrongType error) error {
+	if strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		return wrongType
+	}
+	return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+}
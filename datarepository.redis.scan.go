@@ -0,0 +1,54 @@
+// datarepository.redis.scan.go
+
+package datarepository
+
+import (
+	"context"
+	"sync"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// scanKeys iterates all keys matching pattern using SCAN and calls fn for each key.
+// Both the pattern (MATCH) and, if not empty, the key type (TYPE) are filtered server-side.
+// In cluster mode every master node is scanned. fn is never called concurrently,
+// but may receive the same key more than once. Iteration stops at the first error
+// returned by fn or by SCAN.
+func (r *RedisRepository) scanKeys(ctx context.Context, pattern string, keyType string, fn func(key string) error) error {
+	if cluster, ok := r.reader.(*redis.ClusterClient); ok {
+		var mu sync.Mutex
+		return cluster.ForEachMaster(ctx, func(ctx context.Context, node *redis.Client) error {
+			return scanNode(ctx, node, pattern, keyType, r.scanCount, func(key string) error {
+				mu.Lock()
+				defer mu.Unlock()
+				return fn(key)
+			})
+		})
+	}
+	return scanNode(ctx, r.reader, pattern, keyType, r.scanCount, fn)
+}
+
+func scanNode(ctx context.Context, client redis.Cmdable, pattern string, keyType string, count int64, fn func(key string) error) error {
+	var cursor uint64
+	for {
+		var cmd *redis.ScanCmd
+		if keyType != "" {
+			cmd = client.ScanType(ctx, cursor, pattern, count, keyType)
+		} else {
+			cmd = client.Scan(ctx, cursor, pattern, count)
+		}
+		keys, next, err := cmd.Result()
+		if err != nil {
+			return err
+		}
+		for _, key := range keys {
+			if err := fn(key); err != nil {
+				return err
+			}
+		}
+		cursor = next
+		if cursor == 0 {
+			return nil
+		}
+	}
+}
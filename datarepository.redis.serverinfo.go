@@ -0,0 +1,160 @@
+// datarepository.redis.serverinfo.go
+
+package datarepository
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"sync"
+)
+
+const (
+	// ServerKindRedis is the ServerInfo.Kind of Redis servers
+	ServerKindRedis = "redis"
+	// ServerKindValkey is the ServerInfo.Kind of Valkey servers
+	ServerKindValkey = "valkey"
+)
+
+// ServerInfo describes the server of a RedisRepository, as reported by INFO server
+type ServerInfo struct {
+	// Kind is ServerKindRedis or ServerKindValkey, taken from server_name
+	Kind string
+	// Version is the version of the server software, e.g. "8.0.1" for Valkey 8.0.1
+	Version string
+	// RedisVersion is the Redis version the server is compatible with, which Valkey reports
+	// as redis_version. Commands are gated on it. It equals Version for Redis.
+	RedisVersion string
+	// Mode is "standalone", "cluster" or "sentinel"
+	Mode string
+}
+
+// AtLeast reports whether RedisVersion is at least version, e.g. "6.2"
+func (s ServerInfo) AtLeast(version string) bool {
+	return compareVersions(s.RedisVersion, version) >= 0
+}
+
+// parseServerInfo parses the reply of INFO server. Returns ErrOperationFailed if it lacks
+// redis_version.
+func parseServerInfo(info string) (ServerInfo, error) {
+	fields := make(map[string]string)
+	scanner := bufio.NewScanner(strings.NewReader(info))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if name, value, found := strings.Cut(line, ":"); found {
+			fields[name] = value
+		}
+	}
+	result := ServerInfo{
+		Kind:         ServerKindRedis,
+		Version:      fields["redis_version"],
+		RedisVersion: fields["redis_version"],
+		Mode:         fields["redis_mode"],
+	}
+	if result.RedisVersion == "" {
+		return ServerInfo{}, fmt.Errorf("%w: INFO server reply lacks redis_version", ErrOperationFailed)
+	}
+	if fields["server_name"] == ServerKindValkey {
+		result.Kind = ServerKindValkey
+		if version := fields["valkey_version"]; version != "" {
+			result.Version = version
+		}
+	}
+	if mode := fields["server_mode"]; mode != "" {
+		result.Mode = mode
+	}
+	return result, nil
+}
+
+// compareVersions compares two dotted versions like "7.2.4" numerically, treating missing
+// parts as 0 and ignoring suffixes like "-rc1". Returns -1, 0 or 1.
+func compareVersions(a, b string) int {
+	aParts, bParts := strings.Split(a, "."), strings.Split(b, ".")
+	for i := 0; i < len(aParts) || i < len(bParts); i++ {
+		x, y := versionPart(aParts, i), versionPart(bParts, i)
+		if x != y {
+			if x < y {
+				return -1
+			}
+			return 1
+		}
+	}
+	return 0
+}
+
+// versionPart returns the numeric value of parts[i], or 0 if it is missing
+func versionPart(parts []string, i int) int {
+	if i >= len(parts) {
+		return 0
+	}
+	digits := strings.TrimLeftFunc(parts[i], func(r rune) bool { return r < '0' || r > '9' })
+	end := strings.IndexFunc(digits, func(r rune) bool { return r < '0' || r > '9' })
+	if end >= 0 {
+		digits = digits[:end]
+	}
+	n, _ := strconv.Atoi(digits)
+	return n
+}
+
+// serverInfoCache holds the ServerInfo of a repository once it was detected. It is shared with
+// namespace views.
+type serverInfoCache struct {
+	mu   sync.Mutex
+	info *ServerInfo
+}
+
+// ServerInfo returns the kind, version and mode of the server, detected with INFO server on
+// first use. NewRedisRepository detects them when it is created, unless ServerCheckTimeout is
+// negative. In cluster mode they are those of one of the nodes, which are expected to run the
+// same version.
+func (r *RedisRepository) ServerInfo(ctx context.Context) (ServerInfo, error) {
+	r.serverInfo.mu.Lock()
+	defer r.serverInfo.mu.Unlock()
+	if r.serverInfo.info != nil {
+		return *r.serverInfo.info, nil
+	}
+	reply, err := r.client.Info(ctx, "server").Result()
+	if err != nil {
+		return ServerInfo{}, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	info, err := parseServerInfo(reply)
+	if err != nil {
+		return ServerInfo{}, err
+	}
+	r.serverInfo.info = &info
+	return info, nil
+}
+
+// requireVersion returns ErrNotSupported if the server is older than the Redis version that
+// feature requires. If the server can't be detected, the command is left to fail on its own.
+func (r *RedisRepository) requireVersion(ctx context.Context, version, feature string) error {
+	info, err := r.ServerInfo(ctx)
+	if err != nil || info.AtLeast(version) {
+		return nil
+	}
+	return fmt.Errorf("%w: %s requires Redis %s or later, but the server is %s %s", ErrNotSupported, feature, version, info.Kind, info.Version)
+}
+
+// checkServer detects the server and checks that it supports the repository's storage. A
+// server that can't be reached yet may still come up, so only a definite lack is an error.
+func (r *RedisRepository) checkServer(ctx context.Context) error {
+	if _, err := r.ServerInfo(ctx); err != nil {
+		r.logger.Warnf("could not detect the Redis server: %v", err)
+	}
+	if r.stringStorage {
+		// SET KEEPTTL keeps the TTL of updated entities
+		return r.requireVersion(ctx, "6.0", "StorageMode \"string\"")
+	}
+	if err := r.CheckJSONModule(ctx); errors.Is(err, ErrNotSupported) {
+		return err
+	} else if err != nil {
+		r.logger.Warnf("could not check for the RedisJSON module: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,131 @@
+// datarepository.redis.serverinfo_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// redisInfoServer is the reply of INFO server of Redis 7.2.4, shortened
+const redisInfoServer = "# Server\r\n" +
+	"redis_version:7.2.4\r\n" +
+	"redis_git_sha1:00000000\r\n" +
+	"redis_git_dirty:0\r\n" +
+	"redis_build_id:4f3c2e1b9a8d7c6e\r\n" +
+	"redis_mode:standalone\r\n" +
+	"os:Linux 6.5.0-14-generic x86_64\r\n" +
+	"arch_bits:64\r\n" +
+	"process_id:1\r\n" +
+	"tcp_port:6379\r\n" +
+	"uptime_in_seconds:86400\r\n" +
+	"executable:/data/redis-server\r\n" +
+	"config_file:\r\n"
+
+// valkeyInfoServer is the reply of INFO server of Valkey 8.0.1, shortened
+const valkeyInfoServer = "# Server\r\n" +
+	"redis_version:7.2.4\r\n" +
+	"server_name:valkey\r\n" +
+	"valkey_version:8.0.1\r\n" +
+	"redis_git_sha1:00000000\r\n" +
+	"redis_mode:cluster\r\n" +
+	"server_mode:cluster\r\n" +
+	"os:Linux 6.5.0-14-generic x86_64\r\n" +
+	"tcp_port:6379\r\n"
+
+func TestParseServerInfo(t *testing.T) {
+	for name, tc := range map[string]struct {
+		info string
+		want ServerInfo
+	}{
+		"redis":  {redisInfoServer, ServerInfo{Kind: ServerKindRedis, Version: "7.2.4", RedisVersion: "7.2.4", Mode: "standalone"}},
+		"valkey": {valkeyInfoServer, ServerInfo{Kind: ServerKindValkey, Version: "8.0.1", RedisVersion: "7.2.4", Mode: "cluster"}},
+	} {
+		got, err := parseServerInfo(tc.info)
+		if err != nil || got != tc.want {
+			t.Errorf("%s: got %+v, %v, want %+v", name, got, err, tc.want)
+		}
+	}
+	if _, err := parseServerInfo("# Server\r\nos:Linux\r\n"); !errors.Is(err, ErrOperationFailed) {
+		t.Errorf("without redis_version: got %v, want ErrOperationFailed", err)
+	}
+
+	for _, tc := range []struct {
+		version, min string
+		want         bool
+	}{
+		{"7.2.4", "6.2", true},
+		{"6.2", "6.2", true},
+		{"6.0.16", "6.2", false},
+		{"10.0.0", "9.9", true},
+		{"7.0.0-rc1", "7.0", true},
+	} {
+		if got := (ServerInfo{RedisVersion: tc.version}).AtLeast(tc.min); got != tc.want {
+			t.Errorf("%s AtLeast(%s): got %v, want %v", tc.version, tc.min, got, tc.want)
+		}
+	}
+}
+
+func TestRedisRequiresServerVersion(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestRedisRepository(t, RedisConfig{})
+	// Pretend to be on a server that predates GEOSEARCH
+	old, err := parseServerInfo(strings.Replace(redisInfoServer, "7.2.4", "6.0.16", 1))
+	if err != nil {
+		t.Fatalf("parseServerInfo: %v", err)
+	}
+	repo.serverInfo.info = &old
+	if info, err := repo.ServerInfo(ctx); err != nil || info != old {
+		t.Errorf("ServerInfo: got %+v, %v, want the detected one", info, err)
+	}
+	_, err = repo.GeoRadius(ctx, SimpleIdentifier("places:1"), 13.4, 52.5, 1, "km")
+	if !errors.Is(err, ErrNotSupported) || !strings.Contains(err.Error(), "requires Redis 6.2 or later, but the server is redis 6.0.16") {
+		t.Errorf("GeoRadius on Redis 6.0: got %v, want ErrNotSupported naming the versions", err)
+	}
+}
+
+func TestNewRedisRepositoryBoundsServerCheck(t *testing.T) {
+	// A server that accepts connections but never replies
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatalf("Listen: %v", err)
+	}
+	t.Cleanup(func() { listener.Close() })
+	var mu sync.Mutex
+	var conns []net.Conn
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			mu.Lock()
+			conns = append(conns, conn)
+			mu.Unlock()
+		}
+	}()
+	t.Cleanup(func() {
+		mu.Lock()
+		defer mu.Unlock()
+		for _, conn := range conns {
+			conn.Close()
+		}
+	})
+
+	for _, timeout := range []time.Duration{100 * time.Millisecond, -1} {
+		start := time.Now()
+		repo, err := NewRedisRepository(RedisConfig{Addrs: []string{listener.Addr().String()}, StorageMode: RedisStorageString, ServerCheckTimeout: timeout})
+		if err != nil {
+			t.Fatalf("NewRedisRepository with ServerCheckTimeout %v: %v", timeout, err)
+		}
+		repo.Close()
+		if elapsed := time.Since(start); elapsed > time.Second {
+			t.Errorf("NewRedisRepository with ServerCheckTimeout %v: took %v", timeout, elapsed)
+		}
+	}
+}
@@ -0,0 +1,104 @@
+// datarepository.redis.set.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+var _ SetStore = (*RedisRepository)(nil)
+
+// SetAdd runs SADD with the members encoded by the codec
+func (r *RedisRepository) SetAdd(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, args, err := r.setArgs(identifier, members)
+	if err != nil {
+		return 0, err
+	}
+
+	added, err := r.client.SAdd(ctx, key, args...).Result()
+	if err != nil {
+		return 0, structureError(err, errNotASet)
+	}
+	return added, nil
+}
+
+// SetMembers runs SMEMBERS
+func (r *RedisRepository) SetMembers(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	members, err := r.reader.SMembers(ctx, key).Result()
+	if err != nil {
+		return structureError(err, errNotASet)
+	}
+	encoded := make([][]byte, len(members))
+	for i, member := range members {
+		encoded[i] = []byte(member)
+	}
+	return decodeSlice(r.codec, encoded, out)
+}
+
+// SetIsMember runs SISMEMBER
+func (r *RedisRepository) SetIsMember(ctx context.Context, identifier EntityIdentifier, member interface{}) (bool, error) {
+	if err := r.guard.enter(); err != nil {
+		return false, err
+	}
+	defer r.guard.leave()
+	key, args, err := r.setArgs(identifier, []interface{}{member})
+	if err != nil {
+		return false, err
+	}
+
+	isMember, err := r.reader.SIsMember(ctx, key, args[0]).Result()
+	if err != nil {
+		return false, structureError(err, errNotASet)
+	}
+	return isMember, nil
+}
+
+// SetRemove runs SREM
+func (r *RedisRepository) SetRemove(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, args, err := r.setArgs(identifier, members)
+	if err != nil {
+		return 0, err
+	}
+
+	removed, err := r.client.SRem(ctx, key, args...).Result()
+	if err != nil {
+		return 0, structureError(err, errNotASet)
+	}
+	return removed, nil
+}
+
+// setArgs returns the key of identifier and the members encoded by the codec
+func (r *RedisRepository) setArgs(identifier EntityIdentifier, members []interface{}) (string, []interface{}, error) {
+	if len(members) == 0 {
+		return "", nil, errNoMembers
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	args := make([]interface{}, len(members))
+	for i, member := range members {
+		if args[i], err = r.encode(member); err != nil {
+			return "", nil, err
+		}
+	}
+	return key, args, nil
+}
@@ -0,0 +1,90 @@
+// datarepository.redis.siblings.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// versionKey returns the key holding the version of the entity stored under key
+func (r *RedisRepository) versionKey(key string) string {
+	return key + r.separator + KeyPartVersion
+}
+
+// expireSiblings gives the version keys of the entities under keys the fixed expiration the
+// entities were just given, NoExpiration removing it like PERSIST, and removes their idle
+// timeouts. A version thus neither expires before its entity nor outlives it. The keys are
+// written in one pipeline, as they may be served by other cluster nodes.
+func (r *RedisRepository) expireSiblings(ctx context.Context, expiration time.Duration, keys ...string) error {
+	if len(keys) == 0 {
+		return nil
+	}
+	pipe := r.client.Pipeline()
+	for _, key := range keys {
+		queueVersionExpiration(ctx, pipe, r.versionKey(key), expiration)
+		if r.idleExpiration {
+			pipe.Del(ctx, r.idleKey(key))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// dropSiblings deletes the version and idle keys of entities that were just deleted, or just
+// created and so must not inherit those of an entity that vanished without them, e.g. by
+// eviction. The keys are deleted in one pipeline, as they may be served by other cluster nodes.
+// The entities are already written, so a failure is logged rather than returned, which would
+// make callers retry an operation that took effect.
+func (r *RedisRepository) dropSiblings(ctx context.Context, keys ...string) {
+	if len(keys) == 0 {
+		return
+	}
+	pipe := r.client.Pipeline()
+	for _, key := range keys {
+		pipe.Del(ctx, r.versionKey(key))
+		if r.idleExpiration {
+			pipe.Del(ctx, r.idleKey(key))
+		}
+	}
+	if _, err := pipe.Exec(ctx); err != nil {
+		r.logger.Warnf("could not delete the version and idle keys of %d entities: %v", len(keys), err)
+	}
+}
+
+// queueVersionExpiration queues giving versionKey expiration, or removing its expiration if
+// expiration is NoExpiration. A missing version key is left alone.
+func queueVersionExpiration(ctx context.Context, pipe redis.Pipeliner, versionKey string, expiration time.Duration) {
+	if expiration == NoExpiration {
+		pipe.Persist(ctx, versionKey)
+	} else {
+		pipe.PExpire(ctx, versionKey, expiration)
+	}
+}
+
+// expireSiblings queues giving the version key of the entity under key the expiration the
+// transaction gives the entity, and removing its idle timeout
+func (t *redisTransaction) expireSiblings(ctx context.Context, key string, expiration time.Duration) error {
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		queueVersionExpiration(ctx, pipe, t.repo.versionKey(key), expiration)
+		if t.repo.idleExpiration {
+			pipe.Del(ctx, t.repo.idleKey(key))
+		}
+	})
+}
+
+// dropSiblings queues deleting the version and idle keys of the entity under key, which the
+// transaction deletes or creates
+func (t *redisTransaction) dropSiblings(ctx context.Context, key string) error {
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Del(ctx, t.repo.versionKey(key))
+		if t.repo.idleExpiration {
+			pipe.Del(ctx, t.repo.idleKey(key))
+		}
+	})
+}
@@ -0,0 +1,111 @@
+// datarepository.redis.sortedset.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"math"
+
+	"github.com/redis/go-redis/v9"
+)
+
+var _ SortedSetStore = (*RedisRepository)(nil)
+
+// ZAdd runs ZADD
+func (r *RedisRepository) ZAdd(ctx context.Context, identifier EntityIdentifier, member string, score float64) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	if math.IsNaN(score) {
+		return errNaNScore
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	if err := r.client.ZAdd(ctx, key, redis.Z{Score: score, Member: member}).Err(); err != nil {
+		return structureError(err, errNotASortedSet)
+	}
+	return nil
+}
+
+// ZRange runs ZRANGE, with WITHSCORES if withScores is true
+func (r *RedisRepository) ZRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, withScores bool) ([]ScoredMember, error) {
+	if err := r.guard.enter(); err != nil {
+		return nil, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	if !withScores {
+		members, err := r.reader.ZRange(ctx, key, start, stop).Result()
+		if err != nil {
+			return nil, structureError(err, errNotASortedSet)
+		}
+		result := make([]ScoredMember, len(members))
+		for i, member := range members {
+			result[i].Member = member
+		}
+		return result, nil
+	}
+	scored, err := r.reader.ZRangeWithScores(ctx, key, start, stop).Result()
+	if err != nil {
+		return nil, structureError(err, errNotASortedSet)
+	}
+	result := make([]ScoredMember, len(scored))
+	for i, z := range scored {
+		member, ok := z.Member.(string)
+		if !ok {
+			return nil, fmt.Errorf("%w: unexpected member type %T", ErrOperationFailed, z.Member)
+		}
+		result[i] = ScoredMember{Member: member, Score: z.Score}
+	}
+	return result, nil
+}
+
+// ZRank runs ZRANK
+func (r *RedisRepository) ZRank(ctx context.Context, identifier EntityIdentifier, member string) (int64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	rank, err := r.reader.ZRank(ctx, key, member).Result()
+	if err == redis.Nil {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, structureError(err, errNotASortedSet)
+	}
+	return rank, nil
+}
+
+// ZIncrBy runs ZINCRBY
+func (r *RedisRepository) ZIncrBy(ctx context.Context, identifier EntityIdentifier, member string, delta float64) (float64, error) {
+	if err := r.guard.enter(); err != nil {
+		return 0, err
+	}
+	defer r.guard.leave()
+	if math.IsNaN(delta) {
+		return 0, errNaNScore
+	}
+	key, err := r.identifierToKey(identifier, false)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+
+	score, err := r.client.ZIncrBy(ctx, key, delta, member).Result()
+	if err != nil {
+		return 0, structureError(err, errNotASortedSet)
+	}
+	return score, nil
+}
@@ -0,0 +1,172 @@
+// datarepository.redis.storage.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// errJSONModuleMissing is returned if the server lacks the RedisJSON module the repository
+// stores documents with
+var errJSONModuleMissing = fmt.Errorf("%w: RedisJSON module required but not loaded, load it or set RedisConfig.StorageMode to \"string\"", ErrNotSupported)
+
+// errJSONStorageRequired is returned by RediSearch operations, which only index the documents
+// of the RedisJSON storage
+var errJSONStorageRequired = fmt.Errorf("%w: search requires the RedisJSON storage", ErrNotSupported)
+
+// jsonModuleProbeKey is the key part that CheckJSONModule reads, which needn't exist
+const jsonModuleProbeKey = "__json_module_probe"
+
+// CheckJSONModule returns an error wrapping ErrNotSupported if the server doesn't have the
+// RedisJSON module, which the repository stores documents with in StorageMode RedisStorageJSON.
+// It reads a key with JSON.GET, so it needs no permission for MODULE LIST. NewRedisRepository
+// calls it; call it yourself for repositories on a client of your own.
+func (r *RedisRepository) CheckJSONModule(ctx context.Context) error {
+	if r.stringStorage {
+		return nil
+	}
+	err := r.reader.Do(ctx, "JSON.GET", r.keyPrefix()+jsonModuleProbeKey).Err()
+	if err == nil || err == redis.Nil || strings.HasPrefix(err.Error(), "WRONGTYPE") {
+		return nil
+	}
+	if strings.Contains(strings.ToLower(err.Error()), "unknown command") {
+		return errJSONModuleMissing
+	}
+	return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+}
+
+// docGet returns the command that reads the document at key: JSON.GET, or GET in string mode
+func (r *RedisRepository) docGet(key string) []interface{} {
+	if r.stringStorage {
+		return []interface{}{"GET", key}
+	}
+	return []interface{}{"JSON.GET", key}
+}
+
+// docSet returns the command that stores data as the document at key, followed by options
+// like "NX": JSON.SET at the root, or SET in string mode. SET is given KEEPTTL, so that both keep
+// the key's TTL.
+func (r *RedisRepository) docSet(key, data string, options ...interface{}) []interface{} {
+	var args []interface{}
+	if r.stringStorage {
+		args = []interface{}{"SET", key, data, "KEEPTTL"}
+	} else {
+		args = []interface{}{"JSON.SET", key, ".", data}
+	}
+	return append(args, options...)
+}
+
+// docScript is a Lua script that reads and writes documents with get_doc(key) and
+// set_doc(key, data, ...), with a variant for each storage of the repository
+type docScript struct {
+	json  *redis.Script
+	plain *redis.Script
+}
+
+// newDocScript defines get_doc and set_doc like docGet and docSet for the script src
+func newDocScript(src string) docScript {
+	return docScript{
+		json: redis.NewScript(`
+local function get_doc(key) return redis.call("JSON.GET", key) end
+local function set_doc(key, data, ...) return redis.call("JSON.SET", key, ".", data, ...) end
+` + src),
+		plain: redis.NewScript(`
+local function get_doc(key) return redis.call("GET", key) end
+local function set_doc(key, data, ...) return redis.call("SET", key, data, "KEEPTTL", ...) end
+` + src),
+	}
+}
+
+// script returns the variant of s for the repository's storage
+func (r *RedisRepository) script(s docScript) *redis.Script {
+	if r.stringStorage {
+		return s.plain
+	}
+	return s.json
+}
+
+// readPlainField reads the field at path from the document at key, which is stored in string
+// mode, by decoding the whole document
+func (r *RedisRepository) readPlainField(ctx context.Context, key, path string, value interface{}) error {
+	parts, err := SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	data, err := r.doRenewingIdle(ctx, key, r.docGet(key)...).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	var doc interface{}
+	if err := r.decode(data, &doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	field, err := GetFieldPath(doc, parts)
+	if err != nil {
+		return err
+	}
+	return r.convertGeneric(field, value)
+}
+
+// updatePlainField sets the field at path of the document at key, which is stored in string
+// mode, by writing back the whole document. The key is WATCHed, so concurrent writes are
+// retried rather than lost.
+func (r *RedisRepository) updatePlainField(ctx context.Context, key, path string, value interface{}) error {
+	parts, err := SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	var fieldValue interface{}
+	if err := r.convertGeneric(value, &fieldValue); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+
+	for attempt := 0; attempt < RedisMaxTxRetries; attempt++ {
+		err := r.client.Watch(ctx, func(tx *redis.Tx) error {
+			current, err := tx.Get(ctx, key).Result()
+			if err == redis.Nil {
+				return ErrNotFound
+			} else if err != nil {
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			var doc interface{}
+			if err := r.decode(current, &doc); err != nil {
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			if err := SetFieldPath(doc, parts, fieldValue); err != nil {
+				return err
+			}
+			updated, err := r.codec.Marshal(doc)
+			if err != nil {
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			_, err = tx.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+				pipe.Do(ctx, r.docSet(key, string(updated))...)
+				return nil
+			})
+			if err != nil && !errors.Is(err, redis.TxFailedErr) {
+				return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+			}
+			return err
+		}, key)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: too many concurrent modifications", ErrOperationFailed)
+}
+
+// convertGeneric converts value into out through the codec, e.g. a struct into its generic form
+func (r *RedisRepository) convertGeneric(value, out interface{}) error {
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(data, out)
+}
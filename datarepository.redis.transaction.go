@@ -0,0 +1,909 @@
+// datarepository.redis.transaction.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+// RedisMaxTxRetries is the number of times a WithTransaction function is run when keys it
+// read were modified concurrently
+const RedisMaxTxRetries = 10
+
+// WithTransaction runs fn with a repository that queues writes and executes them with MULTI/EXEC
+// once fn returns nil. Keys read or checked by fn are WATCHed, so the transaction is retried
+// (up to RedisMaxTxRetries times) if any of them changes before EXEC.
+//
+// Within the transaction, reads don't see the transaction's own queued writes, and locks are not
+// available. All keys must be served by the same node: in a Redis cluster, give them a common
+// hash tag, e.g. "{user1}:profile" and "{user1}:counter". Redis doesn't roll back commands that
+// fail during EXEC, e.g. due to a wrong value type; their error is returned.
+func (r *RedisRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	if err := r.guard.enter(); err != nil {
+		return err
+	}
+	defer r.guard.leave()
+	for attempt := 0; attempt < RedisMaxTxRetries; attempt++ {
+		err := r.runTransaction(ctx, fn)
+		if !errors.Is(err, redis.TxFailedErr) {
+			return err
+		}
+	}
+	return fmt.Errorf("%w: too many concurrent modifications", ErrOperationFailed)
+}
+
+func (r *RedisRepository) runTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	tx := &redisTransaction{repo: r}
+	defer tx.close(ctx)
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.exec(ctx)
+}
+
+// redisTransaction is the repository passed to a WithTransaction function. It holds a dedicated
+// connection to WATCH keys on and queues writes until the function returns.
+type redisTransaction struct {
+	repo   *RedisRepository
+	conn   *redis.Conn
+	queued []func(pipe redis.Pipeliner)
+	// written holds the documents queued by the transaction, nil for deleted ones, so that
+	// index updates of later writes start from them
+	written map[string]*string
+}
+
+var _ DataRepository = (*redisTransaction)(nil)
+
+// connFor returns the transaction's connection, opening it to the node serving key on first use
+func (t *redisTransaction) connFor(ctx context.Context, key string) (*redis.Conn, error) {
+	if t.conn != nil {
+		return t.conn, nil
+	}
+	switch client := t.repo.client.(type) {
+	case *redis.Client:
+		t.conn = client.Conn()
+	case *redis.ClusterClient:
+		node, err := client.MasterForKey(ctx, key)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+		}
+		t.conn = node.Conn()
+	default:
+		return nil, fmt.Errorf("%w: transactions require a standalone, sentinel or cluster client", ErrNotSupported)
+	}
+	return t.conn, nil
+}
+
+// do runs a command on the transaction's connection
+func (t *redisTransaction) do(ctx context.Context, key string, args ...interface{}) *redis.Cmd {
+	cmd := redis.NewCmd(ctx, args...)
+	conn, err := t.connFor(ctx, key)
+	if err != nil {
+		cmd.SetErr(err)
+		return cmd
+	}
+	_ = conn.Process(ctx, cmd)
+	return cmd
+}
+
+// watch makes the transaction fail if the key is modified before EXEC
+func (t *redisTransaction) watch(ctx context.Context, key string) error {
+	if err := t.do(ctx, key, "WATCH", key).Err(); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// watchKey resolves and watches the key of identifier
+func (t *redisTransaction) watchKey(ctx context.Context, identifier EntityIdentifier) (string, error) {
+	key, err := t.repo.identifierToKey(identifier, false)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return key, t.watch(ctx, key)
+}
+
+// exists reports whether a watched key exists
+func (t *redisTransaction) exists(ctx context.Context, key string) (bool, error) {
+	count, err := t.do(ctx, key, "EXISTS", key).Int64()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return count == 1, nil
+}
+
+// queue adds a write to execute on commit, routed to the node serving key
+func (t *redisTransaction) queue(ctx context.Context, key string, write func(pipe redis.Pipeliner)) error {
+	if _, err := t.connFor(ctx, key); err != nil {
+		return err
+	}
+	t.queued = append(t.queued, write)
+	return nil
+}
+
+// exec executes the queued writes. Returns redis.TxFailedErr if a watched key was modified.
+func (t *redisTransaction) exec(ctx context.Context) error {
+	if len(t.queued) == 0 {
+		return nil
+	}
+	_, err := t.conn.TxPipelined(ctx, func(pipe redis.Pipeliner) error {
+		for _, write := range t.queued {
+			write(pipe)
+		}
+		return nil
+	})
+	if err != nil && !errors.Is(err, redis.TxFailedErr) {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return err
+}
+
+// close releases the connection, clearing any WATCH left by a failed transaction
+func (t *redisTransaction) close(ctx context.Context) {
+	if t.conn == nil {
+		return
+	}
+	_ = t.conn.Process(ctx, redis.NewStatusCmd(ctx, "UNWATCH"))
+	_ = t.conn.Close()
+}
+
+// set queues replacing the document stored under key
+func (t *redisTransaction) set(ctx context.Context, key string, value interface{}) error {
+	data, err := t.repo.encode(value)
+	if err != nil {
+		return err
+	}
+	if err := t.reindex(ctx, key, &data); err != nil {
+		return err
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Do(ctx, t.repo.docSet(key, data)...)
+	})
+}
+
+func (t *redisTransaction) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAlreadyExists
+	}
+	if err := t.set(ctx, key, value); err != nil {
+		return err
+	}
+	return t.dropSiblings(ctx, key)
+}
+
+func (t *redisTransaction) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", ErrInvalidInput)
+	}
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil || exists {
+		return false, err
+	}
+	data, err := t.repo.encode(value)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := t.reindex(ctx, key, &data); err != nil {
+		return false, err
+	}
+	err = t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Do(ctx, t.repo.docSet(key, data)...)
+		if ttl > 0 {
+			pipe.PExpire(ctx, key, ttl)
+		}
+	})
+	if err != nil {
+		return false, err
+	}
+	return true, t.dropSiblings(ctx, key)
+}
+
+func (t *redisTransaction) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return CreateWithTTL(ctx, t, identifier, value, ttl)
+}
+
+func (t *redisTransaction) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	if err := t.repo.validateEntityPrefix(entityPrefix); err != nil {
+		return nil, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return CreateWithGeneratedID(ctx, t, t.repo.idGen, entityPrefix, value, func(entityPrefix, id string) EntityIdentifier {
+		return RedisIdentifier{EntityPrefix: entityPrefix, ID: id}
+	})
+}
+
+func (t *redisTransaction) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if _, err := t.watchKey(ctx, identifier); err != nil {
+		return err
+	}
+	return t.repo.Read(ctx, identifier, value)
+}
+
+func (t *redisTransaction) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	if _, err := t.watchKey(ctx, identifier); err != nil {
+		return 0, err
+	}
+	return t.repo.ReadWithTTL(ctx, identifier, value)
+}
+
+func (t *redisTransaction) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	return t.exists(ctx, key)
+}
+
+// ExistsMany watches and checks each entity like Exists
+func (t *redisTransaction) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	return ExistsMany(ctx, t, identifiers)
+}
+
+func (t *redisTransaction) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	key, err := t.repo.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return t.set(ctx, key, value)
+}
+
+func (t *redisTransaction) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	key, err := t.repo.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	data, err := t.repo.encode(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := t.reindex(ctx, key, &data); err != nil {
+		return err
+	}
+	if err := t.expireSiblings(ctx, key, ttl); err != nil {
+		return err
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Do(ctx, t.repo.docSet(key, data)...)
+		pipe.PExpire(ctx, key, ttl)
+	})
+}
+
+func (t *redisTransaction) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	batchErr := &BatchError{}
+	for identifier, value := range items {
+		key, err := t.repo.identifierToKey(identifier, false)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidIdentifier, err))
+			continue
+		}
+		data, err := t.repo.encode(value)
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", ErrInvalidInput, err))
+			continue
+		}
+		if err := t.reindex(ctx, key, &data); err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		if err := t.expireSiblings(ctx, key, ttl); err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		err = t.queue(ctx, key, func(pipe redis.Pipeliner) {
+			pipe.Do(ctx, t.repo.docSet(key, data)...)
+			pipe.PExpire(ctx, key, ttl)
+		})
+		if err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (t *redisTransaction) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	if err := t.renewIdle(ctx, key); err != nil {
+		return err
+	}
+	return t.set(ctx, key, value)
+}
+
+// UpdateField reads the document and queues writing it back with the field set, so that an
+// invalid path fails before anything is executed
+func (t *redisTransaction) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	parts, err := SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	data, err := t.do(ctx, key, t.repo.docGet(key)...).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+
+	var doc interface{}
+	if err := t.repo.decode(data, &doc); err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	encoded, err := t.repo.encodeField(value)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	var fieldValue interface{}
+	if err := t.repo.decode(encoded, &fieldValue); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	if err := SetFieldPath(doc, parts, fieldValue); err != nil {
+		return err
+	}
+	updated, err := t.repo.codec.Marshal(doc)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	data = string(updated)
+	if err := t.reindex(ctx, key, &data); err != nil {
+		return err
+	}
+	if err := t.renewIdle(ctx, key); err != nil {
+		return err
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Do(ctx, t.repo.docSet(key, data)...)
+	})
+}
+
+func (t *redisTransaction) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	current, err := t.do(ctx, key, t.repo.docGet(key)...).Text()
+	if err == redis.Nil {
+		return false, ErrNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	equal, err := EqualEncoded(t.repo.codec, []byte(current), expected)
+	if err != nil || !equal {
+		return false, err
+	}
+	return true, t.set(ctx, key, newValue)
+}
+
+func (t *redisTransaction) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	version, err := t.GetVersion(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	if version != expectedVersion {
+		return 0, ErrVersionConflict
+	}
+	data, err := t.repo.encode(value)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	key, _ := t.repo.identifierToKey(identifier, false)
+	if err := t.reindex(ctx, key, &data); err != nil {
+		return 0, err
+	}
+	// The script checks the version again, which can't fail as both keys are watched
+	err = t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		t.repo.script(updateWithVersionScript).Eval(ctx, pipe, []string{key, t.repo.versionKey(key)}, expectedVersion, data)
+	})
+	return expectedVersion + 1, err
+}
+
+func (t *redisTransaction) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	versionKey := t.repo.versionKey(key)
+	if err := t.watch(ctx, versionKey); err != nil {
+		return 0, err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	if !exists {
+		return 0, ErrNotFound
+	}
+	version, err := t.do(ctx, key, "GET", versionKey).Int64()
+	if err == redis.Nil {
+		return 0, nil
+	} else if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	return version, nil
+}
+
+func (t *redisTransaction) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if _, err := t.watchKey(ctx, identifier); err != nil {
+		return err
+	}
+	return t.repo.ReadField(ctx, identifier, path, value)
+}
+
+func (t *redisTransaction) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	if err := t.reindex(ctx, key, nil); err != nil {
+		return err
+	}
+	if err := t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Del(ctx, key)
+	}); err != nil {
+		return err
+	}
+	return t.dropSiblings(ctx, key)
+}
+
+// GetAndDelete reads the watched document and queues deleting it, so the transaction is retried
+// if the document changes before EXEC
+func (t *redisTransaction) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	current, err := t.do(ctx, key, t.repo.docGet(key)...).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if err := t.repo.decode(current, value); err != nil {
+		return err
+	}
+	if err := t.reindex(ctx, key, nil); err != nil {
+		return err
+	}
+	if err := t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Del(ctx, key)
+	}); err != nil {
+		return err
+	}
+	return t.dropSiblings(ctx, key)
+}
+
+func (t *redisTransaction) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	current, err := t.do(ctx, key, t.repo.docGet(key)...).Text()
+	if err == redis.Nil {
+		return ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	if err := t.repo.decode(current, oldValue); err != nil {
+		return err
+	}
+	return t.set(ctx, key, newValue)
+}
+
+func (t *redisTransaction) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	batchErr := &BatchError{}
+	for identifier, value := range items {
+		if err := t.Create(ctx, identifier, value); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (t *redisTransaction) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return t.repo.ReadMany(ctx, identifiers, fn)
+}
+
+func (t *redisTransaction) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return t.repo.ReadManyOrdered(ctx, identifiers, dest)
+}
+
+func (t *redisTransaction) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	batchErr := &BatchError{}
+	for _, identifier := range identifiers {
+		if err := t.Delete(ctx, identifier); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern collects the matching entities when it is called and queues deleting them
+func (t *redisTransaction) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	return DeletePattern(ctx, t, pattern)
+}
+
+func (t *redisTransaction) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	return t.repo.List(ctx, pattern)
+}
+
+func (t *redisTransaction) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	return t.repo.ListDetailed(ctx, pattern)
+}
+
+func (t *redisTransaction) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	return t.repo.ListPaged(ctx, pattern, cursor, pageSize)
+}
+
+func (t *redisTransaction) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	return t.repo.ListPage(ctx, pattern, cursor, pageSize)
+}
+
+func (t *redisTransaction) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	return t.repo.Count(ctx, pattern)
+}
+
+func (t *redisTransaction) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return t.repo.Iterate(ctx, pattern, fn)
+}
+
+func (t *redisTransaction) EntityPrefixes(ctx context.Context) ([]string, error) {
+	return t.repo.EntityPrefixes(ctx)
+}
+
+func (t *redisTransaction) ListPrefixes(ctx context.Context) ([]string, error) {
+	return t.EntityPrefixes(ctx)
+}
+
+func (t *redisTransaction) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	return t.repo.Search(ctx, query, offset, limit, sortBy, sortDir)
+}
+
+func (t *redisTransaction) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	return t.repo.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+}
+
+func (t *redisTransaction) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	return t.repo.SearchResults(ctx, query, opts)
+}
+
+func (t *redisTransaction) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	return t.repo.SearchQuery(ctx, query, opts)
+}
+
+func (t *redisTransaction) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	return false, ErrInTransaction
+}
+
+func (t *redisTransaction) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	return "", false, ErrInTransaction
+}
+
+func (t *redisTransaction) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	return ErrInTransaction
+}
+
+func (t *redisTransaction) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	return ErrInTransaction
+}
+
+func (t *redisTransaction) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	return false, ErrInTransaction
+}
+
+// Publish queues the message, so it is only sent if the transaction succeeds
+func (t *redisTransaction) Publish(ctx context.Context, channel string, message interface{}) error {
+	fullChannel := t.repo.channelName(channel)
+	payload, err := EncodePayload(t.repo.codec, message)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidInput, err)
+	}
+	return t.queue(ctx, fullChannel, func(pipe redis.Pipeliner) {
+		pipe.Publish(ctx, fullChannel, payload)
+	})
+}
+
+func (t *redisTransaction) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	return nil, ErrInTransaction
+}
+
+func (t *redisTransaction) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	return nil, ErrInTransaction
+}
+
+func (t *redisTransaction) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	return nil, ErrInTransaction
+}
+
+func (t *redisTransaction) Ping(ctx context.Context) error {
+	return t.repo.Ping(ctx)
+}
+
+func (t *redisTransaction) Close() error {
+	return ErrInTransaction
+}
+
+func (t *redisTransaction) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	key, err := t.repo.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	if err := t.expireSiblings(ctx, key, expiration); err != nil {
+		return err
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.PExpire(ctx, key, expiration)
+	})
+}
+
+func (t *redisTransaction) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	batchErr := &BatchError{}
+	for _, identifier := range identifiers {
+		if err := t.SetExpiration(ctx, identifier, expiration); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// SetExpirationCond checks the condition against the watched key's current TTL and queues the
+// expiration if it holds
+func (t *redisTransaction) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return false, err
+	}
+	ttl, err := t.do(ctx, key, "PTTL", key).Int64()
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	// PTTL replies -2 if the key doesn't exist and -1 if it has no expiration
+	hasExpiry := ttl >= 0
+	current := time.Duration(ttl) * time.Millisecond
+	switch cond {
+	case ExpireNX:
+		if hasExpiry {
+			return false, nil
+		}
+	case ExpireXX:
+		if !hasExpiry {
+			return false, nil
+		}
+	case ExpireGT:
+		// No expiration counts as infinite, which can't be exceeded
+		if !hasExpiry || expiration <= current {
+			return false, nil
+		}
+	case ExpireLT:
+		if hasExpiry && expiration >= current {
+			return false, nil
+		}
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", ErrInvalidInput, cond)
+	}
+	if ttl == -2 {
+		return false, nil
+	}
+	if err := t.expireSiblings(ctx, key, expiration); err != nil {
+		return false, err
+	}
+	return true, t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.PExpire(ctx, key, expiration)
+	})
+}
+
+func (t *redisTransaction) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if _, err := t.watchKey(ctx, identifier); err != nil {
+		return 0, err
+	}
+	return t.repo.GetExpiration(ctx, identifier)
+}
+
+func (t *redisTransaction) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	if err := t.expireSiblings(ctx, key, NoExpiration); err != nil {
+		return err
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Persist(ctx, key)
+	})
+}
+
+// Touch checks that the entity exists and queues restarting its idle expiration; the access
+// time used for eviction is updated by the read of the check
+func (t *redisTransaction) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	exists, err := t.exists(ctx, key)
+	if err != nil {
+		return err
+	}
+	if !exists {
+		return ErrNotFound
+	}
+	return t.renewIdle(ctx, key)
+}
+
+func (t *redisTransaction) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	return t.IncrementBy(ctx, identifier, 1)
+}
+
+// IncrementBy reads the watched counter and queues INCRBY, returning the value it will have
+// once the transaction succeeds
+func (t *redisTransaction) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	current, err := t.GetCounter(ctx, identifier)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, err
+	}
+	key, _ := t.repo.identifierToKey(identifier, false)
+	if err := t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.IncrBy(ctx, key, delta)
+	}); err != nil {
+		return 0, err
+	}
+	return current + delta, nil
+}
+
+func (t *redisTransaction) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	return t.IncrementBy(ctx, identifier, -delta)
+}
+
+func (t *redisTransaction) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	current, err := t.GetCounter(ctx, identifier)
+	if err != nil && !errors.Is(err, ErrNotFound) {
+		return 0, false, err
+	}
+	if current+delta > max {
+		return current, false, nil
+	}
+	value, err := t.IncrementBy(ctx, identifier, delta)
+	return value, err == nil, err
+}
+
+// IncrementWithExpiry queues INCRBY and, if the watched counter has no expiration, PEXPIRE
+func (t *redisTransaction) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", ErrInvalidInput)
+	}
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	pttl, err := t.do(ctx, key, "PTTL", key).Int64()
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", ErrOperationFailed, err)
+	}
+	value, err := t.IncrementBy(ctx, identifier, delta)
+	if err != nil {
+		return 0, err
+	}
+	// PTTL replies -2 if the key doesn't exist and -1 if it has no expiration
+	if pttl < 0 {
+		if err := t.queue(ctx, key, func(pipe redis.Pipeliner) {
+			pipe.PExpire(ctx, key, ttl)
+		}); err != nil {
+			return 0, err
+		}
+	}
+	return value, nil
+}
+
+// IncrementFloat reads the watched counter and queues INCRBYFLOAT, returning the value it will
+// have once the transaction succeeds
+func (t *redisTransaction) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	var current float64
+	data, err := t.do(ctx, key, "GET", key).Text()
+	if err != nil && err != redis.Nil {
+		return 0, counterError(err)
+	}
+	if err == nil {
+		current, err = strconv.ParseFloat(data, 64)
+		if err != nil {
+			return 0, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+		}
+	}
+	if err := t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.IncrByFloat(ctx, key, delta)
+	}); err != nil {
+		return 0, err
+	}
+	return current + delta, nil
+}
+
+func (t *redisTransaction) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	key, err := t.watchKey(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, err := t.do(ctx, key, "GET", key).Text()
+	if err == redis.Nil {
+		return 0, ErrNotFound
+	} else if err != nil {
+		return 0, counterError(err)
+	}
+	value, err := strconv.ParseInt(data, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (t *redisTransaction) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	key, err := t.repo.identifierToKey(identifier, false)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidIdentifier, err)
+	}
+	return t.queue(ctx, key, func(pipe redis.Pipeliner) {
+		pipe.Set(ctx, key, value, redis.KeepTTL)
+	})
+}
+
+// WithTransaction runs fn within the enclosing transaction, as Redis doesn't nest transactions
+func (t *redisTransaction) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	return fn(t)
+}
+
+func (t *redisTransaction) RegisterPlugin(plugin RepositoryPlugin) error {
+	return t.repo.RegisterPlugin(plugin)
+}
+
+func (t *redisTransaction) GetPlugin(name string) (RepositoryPlugin, bool) {
+	return t.repo.GetPlugin(name)
+}
@@ -0,0 +1,882 @@
+// datarepository.redis_test.go
+
+package datarepository
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+	miniserver "github.com/alicebob/miniredis/v2/server"
+	"github.com/redis/go-redis/v9"
+)
+
+func TestRedisChannelPrefixIsSharedAcrossKeyPrefixes(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	orders := newTestRedisRepositoryOn(t, server, RedisConfig{KeyPrefix: "orders", ChannelPrefix: "bus"})
+	billing := newTestRedisRepositoryOn(t, server, RedisConfig{KeyPrefix: "billing", ChannelPrefix: "bus"})
+
+	sub, err := billing.SubscribeMessages(ctx, "created")
+	if err != nil {
+		t.Fatalf("SubscribeMessages: %v", err)
+	}
+	defer sub.Close()
+	psub, err := billing.PSubscribe(ctx, "cre*")
+	if err != nil {
+		t.Fatalf("PSubscribe: %v", err)
+	}
+	defer psub.Close()
+	plain, err := billing.Subscribe(ctx, "created")
+	if err != nil {
+		t.Fatalf("Subscribe: %v", err)
+	}
+
+	// Subscribe doesn't wait for the server to confirm the subscription
+	waitForSubscribers(t, billing, "bus:created", 2)
+
+	if err := orders.Publish(ctx, "created", "order:1"); err != nil {
+		t.Fatalf("Publish: %v", err)
+	}
+	for name, s := range map[string]Subscription{"SubscribeMessages": sub, "PSubscribe": psub} {
+		if message := receiveMessage(t, s); message.Channel != "created" || string(message.Payload) != "order:1" {
+			t.Errorf("%s: got %q on %q, want %q on %q", name, message.Payload, message.Channel, "order:1", "created")
+		}
+	}
+	select {
+	case payload := <-plain:
+		if payload != "order:1" {
+			t.Errorf("Subscribe: got %v, want %q", payload, "order:1")
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("Subscribe: timed out waiting for a message")
+	}
+
+	// Data stays isolated per key prefix
+	if err := orders.Create(ctx, SimpleIdentifier("order:1"), map[string]int{"total": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var value interface{}
+	if err := billing.Read(ctx, SimpleIdentifier("order:1"), &value); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read with another key prefix: got %v, want ErrNotFound", err)
+	}
+}
+
+func TestRedisChannelPrefixDefaultsToKeyPrefix(t *testing.T) {
+	ctx := context.Background()
+	repo, server := newTestRedisRepository(t, RedisConfig{})
+	sub, err := repo.SubscribeMessages(ctx, "events")
+	if err != nil {
+		t.Fatalf("SubscribeMessages: %v", err)
+	}
+	defer sub.Close()
+
+	if got := server.PubSubChannels("*"); len(got) != 1 || got[0] != "app:channel:events" {
+		t.Errorf("channels: got %v, want [app:channel:events]", got)
+	}
+}
+
+// searchHit is a document returned by the fake FT.SEARCH of fakeSearchServer
+type searchHit struct {
+	key, doc string
+}
+
+// fakeSearchServer returns a miniredis server that pretends to have the RedisJSON and RediSearch
+// modules: JSON.GET finds nothing and FT.SEARCH always matches hits, returning the page its
+// LIMIT asks for
+func fakeSearchServer(t *testing.T, hits ...searchHit) *miniredis.Miniredis {
+	t.Helper()
+	s := miniredis.RunT(t)
+	if err := s.Server().Register("JSON.GET", func(c *miniserver.Peer, cmd string, args []string) {
+		c.WriteNull()
+	}); err != nil {
+		t.Fatalf("Register JSON.GET: %v", err)
+	}
+	if err := s.Server().Register("FT.SEARCH", func(c *miniserver.Peer, cmd string, args []string) {
+		page := hits
+		for i := 0; i+2 < len(args); i++ {
+			if strings.EqualFold(args[i], "LIMIT") {
+				offset, _ := strconv.Atoi(args[i+1])
+				limit, _ := strconv.Atoi(args[i+2])
+				page = hits[min(offset, len(hits)):min(offset+limit, len(hits))]
+			}
+		}
+		c.WriteLen(1 + 2*len(page))
+		c.WriteInt(len(hits))
+		for _, hit := range page {
+			c.WriteBulk(hit.key)
+			c.WriteLen(2)
+			c.WriteBulk("$")
+			c.WriteBulk(hit.doc)
+		}
+	}); err != nil {
+		t.Fatalf("Register FT.SEARCH: %v", err)
+	}
+	return s
+}
+
+func TestRedisSearchReportsSkippedKeys(t *testing.T) {
+	ctx := context.Background()
+	server := fakeSearchServer(t,
+		searchHit{"app:user:1", `{"name":"ann"}`},
+		searchHit{"other:user:2", `{"name":"bob"}`},
+		searchHit{"app:user:3", `not json`},
+		searchHit{"app:user:4", `{"name":"eve"}`},
+	)
+	repo := newTestRedisRepositoryOn(t, server, RedisConfig{StorageMode: RedisStorageJSON})
+
+	result, err := repo.SearchDetailed(ctx, "*", 0, 10, "", "")
+	if err != nil {
+		t.Fatalf("SearchDetailed: %v", err)
+	}
+	if got := fmt.Sprint(identifierStrings(result.Identifiers)); got != "[user:1 user:3 user:4]" {
+		t.Errorf("SearchDetailed identifiers: got %s, want [user:1 user:3 user:4]", got)
+	}
+	if fmt.Sprint(result.Skipped) != "[other:user:2]" || result.Total != 4 {
+		t.Errorf("SearchDetailed: got Skipped %v and Total %d, want [other:user:2] and 4", result.Skipped, result.Total)
+	}
+
+	// Decoding the values also skips the undecodable document
+	response, err := repo.SearchResults(ctx, "*", SearchOptions{Limit: 10})
+	if err != nil {
+		t.Fatalf("SearchResults: %v", err)
+	}
+	if len(response.Hits) != 2 || fmt.Sprint(response.Skipped) != "[other:user:2 app:user:3]" {
+		t.Errorf("SearchResults: got %d hits, Skipped %v, want 2 hits, [other:user:2 app:user:3]", len(response.Hits), response.Skipped)
+	}
+}
+
+// mixedKeyspace stores n string entities below "user" and as many hashes that match the same
+// pattern but aren't entities of the repository
+func mixedKeyspace(tb testing.TB, repo *RedisRepository, server *miniredis.Miniredis, n int) {
+	tb.Helper()
+	for i := 0; i < n; i++ {
+		if err := repo.Create(context.Background(), SimpleIdentifier(fmt.Sprintf("user:%d", i)), map[string]int{"i": i}); err != nil {
+			tb.Fatalf("Create: %v", err)
+		}
+		server.HSet(fmt.Sprintf("app:user:h%d", i), "i", "1")
+	}
+}
+
+func TestRedisScanTypeFiltersServerSide(t *testing.T) {
+	ctx := context.Background()
+	for _, tc := range []struct {
+		scanType    string
+		wantSkipped int
+		// ListPage doesn't read values, so without a type filter it returns the hashes too
+		wantPage int
+	}{
+		{"", 5, 10},
+		{"string", 0, 5},
+	} {
+		t.Run("ScanType="+tc.scanType, func(t *testing.T) {
+			repo, server := newTestRedisRepository(t, RedisConfig{ScanType: tc.scanType})
+			mixedKeyspace(t, repo, server, 5)
+
+			result, err := repo.ListDetailed(ctx, "app:user:*")
+			if err != nil {
+				t.Fatalf("ListDetailed: %v", err)
+			}
+			if len(result.Identifiers) != 5 || len(result.Skipped) != tc.wantSkipped {
+				t.Errorf("ListDetailed: got %d entities and %d skipped, want 5 and %d", len(result.Identifiers), len(result.Skipped), tc.wantSkipped)
+			}
+
+			ids, _, cursor, err := repo.ListPaged(ctx, "app:user:*", 0, 100)
+			if err != nil || cursor != 0 || len(ids) != 5 {
+				t.Errorf("ListPaged: got %v, cursor %d, %v, want 5 entities", ids, cursor, err)
+			}
+			page, next, err := repo.ListPage(ctx, "app:user:*", "", 100)
+			if err != nil || next != "" || len(page) != tc.wantPage {
+				t.Errorf("ListPage: got %v, cursor %q, %v, want %d identifiers", page, next, err, tc.wantPage)
+			}
+		})
+	}
+}
+
+func BenchmarkRedisListMixedKeyspace(b *testing.B) {
+	ctx := context.Background()
+	for _, scanType := range []string{"", "string"} {
+		b.Run("ScanType="+scanType, func(b *testing.B) {
+			server := miniredis.RunT(b)
+			repo, err := NewRedisRepository(RedisConfig{
+				Addrs:       []string{server.Addr()},
+				KeyPrefix:   "app",
+				StorageMode: RedisStorageString,
+				ScanType:    scanType,
+			})
+			if err != nil {
+				b.Fatalf("NewRedisRepository: %v", err)
+			}
+			defer repo.Close()
+			mixedKeyspace(b, repo.(*RedisRepository), server, 500)
+
+			b.ResetTimer()
+			var skipped int
+			for i := 0; i < b.N; i++ {
+				result, err := repo.ListDetailed(ctx, "app:user:*")
+				if err != nil {
+					b.Fatalf("ListDetailed: %v", err)
+				}
+				skipped += len(result.Skipped)
+			}
+			b.ReportMetric(float64(skipped)/float64(b.N), "skipped-keys/op")
+		})
+	}
+}
+
+func TestRedisConnectionConfigStyles(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("svc", "secret")
+	addr := server.Addr()
+
+	for name, config := range map[string]RedisConfig{
+		"fields": {Addrs: []string{addr}, Username: "svc", Password: "secret", DB: 2},
+		"url":    {ConnectionString: "redis://svc:secret@" + addr + "/2"},
+		"legacy": {ConnectionString: "single;name;;;;svc;secret;2;" + addr},
+	} {
+		t.Run(name, func(t *testing.T) {
+			rsi, err := resolveRedisServerInfo(config)
+			if err != nil {
+				t.Fatalf("resolveRedisServerInfo: %v", err)
+			}
+			if rsi.Mode != RedisModeSingle || rsi.Username != "svc" || rsi.Password != "secret" || rsi.DB != 2 || fmt.Sprint(rsi.Addrs) != "["+addr+"]" {
+				t.Errorf("resolveRedisServerInfo: got %+v", rsi)
+			}
+
+			config.KeyPrefix = name
+			config.StorageMode = RedisStorageString
+			repo, err := NewRedisRepository(config)
+			if err != nil {
+				t.Fatalf("NewRedisRepository: %v", err)
+			}
+			defer repo.Close()
+			if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if !server.DB(2).Exists(name + ":user:1") {
+				t.Errorf("the entity was not stored in DB 2")
+			}
+		})
+	}
+}
+
+func TestRedisReadCredentials(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	server.RequireUserAuth("writer", "write-secret")
+	server.RequireUserAuth("reader", "read-secret")
+
+	repo, err := NewRedisRepository(RedisConfig{
+		Addrs:        []string{server.Addr()},
+		Username:     "writer",
+		Password:     "write-secret",
+		ReadUsername: "reader",
+		ReadPassword: "read-secret",
+		StorageMode:  RedisStorageString,
+	})
+	if err != nil {
+		t.Fatalf("NewRedisRepository: %v", err)
+	}
+	defer repo.Close()
+	redisRepo := repo.(*RedisRepository)
+
+	for name, tc := range map[string]struct {
+		client             redis.UniversalClient
+		username, password string
+	}{
+		"client": {redisRepo.client, "writer", "write-secret"},
+		"reader": {redisRepo.reader, "reader", "read-secret"},
+	} {
+		options := tc.client.(*redis.Client).Options()
+		if options.Username != tc.username || options.Password != tc.password {
+			t.Errorf("%s: got credentials %q/%q, want %q/%q", name, options.Username, options.Password, tc.username, tc.password)
+		}
+	}
+
+	if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var value map[string]int
+	if err := repo.Read(ctx, SimpleIdentifier("user:1"), &value); err != nil || value["a"] != 1 {
+		t.Errorf("Read: got %v, %v", value, err)
+	}
+}
+
+func TestRedisLegacyConnectionStringNamesMissingField(t *testing.T) {
+	err := RedisConfig{ConnectionString: "single;name;;;;user;pw"}.Validate()
+	if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), "missing DB, Addrs") {
+		t.Errorf("Validate: got %v, want ErrInvalidInput naming DB and Addrs", err)
+	}
+	err = RedisConfig{ConnectionString: "single;name;;;;user;pw;two;localhost:6379"}.Validate()
+	if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), `DB "two"`) {
+		t.Errorf("Validate: got %v, want ErrInvalidInput naming the DB", err)
+	}
+}
+
+func TestNewRedisRepositoryRejectsEmptyAddrs(t *testing.T) {
+	for name, connectionString := range map[string]string{
+		"trailing empty addr field": "single;name;;;;user;pw;0;",
+		"empty addr in a list":      "cluster;name;;;;user;pw;0;localhost:7000,,localhost:7002",
+		"sentinel without addrs":    "sentinel;name;mymaster;;;user;pw;0;",
+	} {
+		repo, err := NewRedisRepository(RedisConfig{ConnectionString: connectionString})
+		if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), "Addrs") {
+			t.Errorf("%s: got %v, %v, want ErrInvalidInput naming Addrs", name, repo, err)
+		}
+	}
+}
+
+// clientTLSConfig returns the TLS config of a client created by newRedisClient
+func clientTLSConfig(t *testing.T, client redis.UniversalClient) *tls.Config {
+	t.Helper()
+	switch c := client.(type) {
+	case *redis.Client:
+		return c.Options().TLSConfig
+	case *redis.ClusterClient:
+		return c.Options().TLSConfig
+	default:
+		t.Fatalf("unexpected client %T", client)
+		return nil
+	}
+}
+
+func TestRedisTLSConfig(t *testing.T) {
+	for _, mode := range []string{RedisModeSingle, RedisModeSentinel, RedisModeCluster} {
+		t.Run(mode, func(t *testing.T) {
+			config := RedisConfig{
+				Mode:       mode,
+				Addrs:      []string{"localhost:6379"},
+				MasterName: "primary",
+				TLSConfig:  &tls.Config{ServerName: "redis.internal"},
+			}
+			rsi, err := resolveRedisServerInfo(config)
+			if err != nil {
+				t.Fatalf("resolveRedisServerInfo: %v", err)
+			}
+			client, err := newRedisClient(rsi)
+			if err != nil {
+				t.Fatalf("newRedisClient: %v", err)
+			}
+			defer client.Close()
+			if got := clientTLSConfig(t, client); got == nil || got.ServerName != "redis.internal" {
+				t.Errorf("TLSConfig: got %+v, want the configured one", got)
+			}
+
+			config.TLSConfig = nil
+			rsi, err = resolveRedisServerInfo(config)
+			if err != nil {
+				t.Fatalf("resolveRedisServerInfo: %v", err)
+			}
+			plain, err := newRedisClient(rsi)
+			if err != nil {
+				t.Fatalf("newRedisClient: %v", err)
+			}
+			defer plain.Close()
+			if got := clientTLSConfig(t, plain); got != nil {
+				t.Errorf("TLSConfig without TLS options: got %+v, want nil", got)
+			}
+		})
+	}
+
+	for name, config := range map[string]RedisConfig{
+		"rediss URL":            {ConnectionString: "rediss://localhost:6380/0"},
+		"TLSInsecureSkipVerify": {Addrs: []string{"localhost:6380"}, TLSInsecureSkipVerify: true},
+	} {
+		rsi, err := resolveRedisServerInfo(config)
+		if err != nil || rsi.TLSConfig == nil {
+			t.Errorf("%s: got TLS config %+v, %v, want one", name, rsi.TLSConfig, err)
+		}
+	}
+
+	caFile := filepath.Join(t.TempDir(), "ca.pem")
+	if err := os.WriteFile(caFile, []byte("not a certificate"), 0o600); err != nil {
+		t.Fatal(err)
+	}
+	for name, config := range map[string]RedisConfig{
+		"CA file without certificates": {Addrs: []string{"localhost:6380"}, TLSCAFile: caFile},
+		"missing CA file":              {Addrs: []string{"localhost:6380"}, TLSCAFile: caFile + ".missing"},
+	} {
+		if _, err := resolveRedisServerInfo(config); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("%s: got %v, want ErrInvalidInput", name, err)
+		}
+	}
+	if err := (RedisConfig{Addrs: []string{"localhost:6380"}, TLSCertFile: "cert.pem"}).Validate(); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("Validate with TLSCertFile but no TLSKeyFile: got %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestRedisSharedClientOutlivesRepositories(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+
+	users := NewRedisRepositoryWithClientConfig(client, RedisConfig{KeyPrefix: "users", StorageMode: RedisStorageString})
+	orders := NewRedisRepositoryWithClientConfig(client, RedisConfig{KeyPrefix: "orders", StorageMode: RedisStorageString})
+	// Only pings, as without a config the repository stores RedisJSON documents, which miniredis lacks
+	events := NewRedisRepositoryWithClient(client, "events", ":")
+	if err := users.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := users.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	// Closing one repository leaves the client to the others
+	if err := orders.Create(ctx, SimpleIdentifier("order:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create after closing another repository: %v", err)
+	}
+	if err := events.Ping(ctx); err != nil {
+		t.Fatalf("Ping after closing another repository: %v", err)
+	}
+	if err := orders.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := events.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+	if err := client.Ping(ctx).Err(); err != nil {
+		t.Errorf("Ping after closing the repositories: %v", err)
+	}
+	if !server.Exists("users:user:1") || !server.Exists("orders:order:1") {
+		t.Errorf("keys: got %v, want users:user:1 and orders:order:1", server.Keys())
+	}
+}
+
+// capturingLogger is a Logger that keeps the messages logged at each level
+type capturingLogger struct {
+	mu                    sync.Mutex
+	debugs, warns, errors []string
+}
+
+func (l *capturingLogger) Debugf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.debugs = append(l.debugs, fmt.Sprintf(format, args...))
+}
+
+func (l *capturingLogger) Warnf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.warns = append(l.warns, fmt.Sprintf(format, args...))
+}
+
+func (l *capturingLogger) Errorf(format string, args ...interface{}) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.errors = append(l.errors, fmt.Sprintf(format, args...))
+}
+
+func TestRedisListLogsSkippedKeys(t *testing.T) {
+	ctx := context.Background()
+	logger := &capturingLogger{}
+	repo, server := newTestRedisRepository(t, RedisConfig{Logger: logger})
+	for _, id := range []string{"user:1", "user:2"} {
+		if err := repo.Create(ctx, SimpleIdentifier(id), map[string]string{"id": id}); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+	server.Set("app:user:3", "not json")
+
+	ids, _, err := repo.List(ctx, "app:user:*")
+	if err != nil || len(ids) != 2 {
+		t.Fatalf("List: got %v, %v, want user:1 and user:2", ids, err)
+	}
+	// Miniredis also makes the server detection warn, so only the skipped keys are looked at
+	var skipped []string
+	for _, warning := range logger.warns {
+		if strings.HasPrefix(warning, "skipping") {
+			skipped = append(skipped, warning)
+		}
+	}
+	if len(skipped) != 1 || !strings.Contains(skipped[0], `"app:user:3"`) {
+		t.Errorf("warnings about skipped keys: got %q, want one about app:user:3", skipped)
+	}
+}
+
+func TestRedisListDetailedReportsBrokenKeys(t *testing.T) {
+	ctx := context.Background()
+	repo, server := newTestRedisRepository(t, RedisConfig{})
+	for _, id := range []string{"user:1", "user:2"} {
+		if err := repo.Create(ctx, SimpleIdentifier(id), map[string]string{"id": id}); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+	server.Set("app:user:3", "not json")
+	server.HSet("app:user:4", "id", "user:4")
+
+	result, err := repo.ListDetailed(ctx, "app:user:*")
+	if err != nil {
+		t.Fatalf("ListDetailed: %v", err)
+	}
+	if got := fmt.Sprint(identifierStrings(result.Identifiers)); got != "[user:1 user:2]" || len(result.Entities) != 2 {
+		t.Errorf("ListDetailed: got %s with %d entities, want [user:1 user:2]", got, len(result.Entities))
+	}
+	skipped := make(map[string]error)
+	for _, key := range result.Skipped {
+		skipped[key.Key] = key.Err
+	}
+	if len(skipped) != 2 || skipped["app:user:3"] == nil || !errors.Is(skipped["app:user:4"], ErrOperationFailed) {
+		t.Errorf("ListDetailed Skipped: got %v, want app:user:3 and app:user:4 with ErrOperationFailed", result.Skipped)
+	}
+
+	// List keeps returning the readable entities only
+	if ids, _, err := repo.List(ctx, "app:user:*"); err != nil || len(ids) != 2 {
+		t.Errorf("List: got %v, %v, want user:1 and user:2", ids, err)
+	}
+}
+
+func TestRedisKeyValidationRules(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	strict := newTestRedisRepositoryOn(t, server, RedisConfig{})
+	relaxed := newTestRedisRepositoryOn(t, server, RedisConfig{
+		KeyCharset: regexp.MustCompile(`^[a-zA-Z0-9_:./-]+$`),
+	})
+
+	path := SimpleIdentifier("doc:reports/2024/q1")
+	if err := strict.Create(ctx, path, "report"); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Create with / and the default charset: got %v, want ErrInvalidIdentifier", err)
+	}
+	if err := relaxed.Create(ctx, path, "report"); err != nil {
+		t.Errorf("Create with / and a charset allowing it: %v", err)
+	}
+	var value string
+	if err := strict.Read(ctx, path, &value); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Read with / and the default charset: got %v, want ErrInvalidIdentifier", err)
+	}
+	if err := relaxed.Read(ctx, path, &value); err != nil || value != "report" {
+		t.Errorf("Read with / and a charset allowing it: got %q, %v", value, err)
+	}
+	if err := relaxed.Create(ctx, SimpleIdentifier("doc:a b"), "x"); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Create with a space and a custom charset: got %v, want ErrInvalidIdentifier", err)
+	}
+
+	// Without the prefix, short identifiers make keys below the default minimum length
+	enforcePrefix := false
+	short := SimpleIdentifier("u:1")
+	defaultMin := newTestRedisRepositoryOn(t, server, RedisConfig{EnforcePrefix: &enforcePrefix})
+	lowMin := newTestRedisRepositoryOn(t, server, RedisConfig{EnforcePrefix: &enforcePrefix, MinKeyLength: 3})
+	if err := defaultMin.Create(ctx, short, 1); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Create of a 3-character key with the default minimum: got %v, want ErrInvalidIdentifier", err)
+	}
+	if err := lowMin.Create(ctx, short, 1); err != nil {
+		t.Errorf("Create of a 3-character key with MinKeyLength 3: %v", err)
+	}
+	if err := lowMin.Create(ctx, SimpleIdentifier("u:"), 1); err == nil {
+		t.Error("Create of a 2-character key with MinKeyLength 3: got nil, want an error")
+	}
+
+	if _, err := NewRedisRepository(RedisConfig{Addrs: []string{server.Addr()}, MinKeyLength: 10, MaxKeyLength: 5}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("NewRedisRepository with MinKeyLength above MaxKeyLength: got %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestRedisEnforcePrefix(t *testing.T) {
+	ctx := context.Background()
+	server := miniredis.RunT(t)
+	// Keys of another application, which doesn't use the "app" prefix
+	server.Set("legacy:user:1", `{"name":"ann"}`)
+	server.Set("legacy:user:2", `{"name":"bob"}`)
+
+	enforced := newTestRedisRepositoryOn(t, server, RedisConfig{})
+	if err := enforced.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "cy"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !server.Exists("app:user:1") {
+		t.Errorf("keys: got %v, want app:user:1", server.Keys())
+	}
+	// Keys without the prefix aren't entities of the repository
+	result, err := enforced.ListDetailed(ctx, "legacy:user:*")
+	if err != nil || len(result.Identifiers) != 0 || len(result.Skipped) != 2 || !errors.Is(result.Skipped[0].Err, ErrInvalidIdentifier) {
+		t.Errorf("ListDetailed of an external pattern with the prefix enforced: got %v, %v, want both keys skipped", result, err)
+	}
+
+	enforcePrefix := false
+	external := newTestRedisRepositoryOn(t, server, RedisConfig{EnforcePrefix: &enforcePrefix})
+	ids, values, err := external.List(ctx, "legacy:user:*")
+	if err != nil {
+		t.Fatalf("List of an external pattern: %v", err)
+	}
+	if got := fmt.Sprint(identifierStrings(ids)); got != "[legacy:user:1 legacy:user:2]" || len(values) != 2 {
+		t.Errorf("List of an external pattern: got %s with %d values, want [legacy:user:1 legacy:user:2]", got, len(values))
+	}
+	var value map[string]string
+	if err := external.Read(ctx, SimpleIdentifier("legacy:user:2"), &value); err != nil || value["name"] != "bob" {
+		t.Errorf("Read of an external key: got %v, %v", value, err)
+	}
+	if err := external.Upsert(ctx, SimpleIdentifier("legacy:user:3"), map[string]string{"name": "dee"}); err != nil {
+		t.Fatalf("Upsert: %v", err)
+	}
+	if !server.Exists("legacy:user:3") {
+		t.Errorf("keys: got %v, want legacy:user:3 without the prefix", server.Keys())
+	}
+}
+
+func TestRedisSearchResultsTotalExceedsPage(t *testing.T) {
+	ctx := context.Background()
+	var hits []searchHit
+	for i := 1; i <= 5; i++ {
+		hits = append(hits, searchHit{fmt.Sprintf("app:user:%d", i), fmt.Sprintf(`{"i":%d}`, i)})
+	}
+	repo := newTestRedisRepositoryOn(t, fakeSearchServer(t, hits...), RedisConfig{StorageMode: RedisStorageJSON})
+
+	response, err := repo.SearchResults(ctx, "*", SearchOptions{Offset: 2, Limit: 2})
+	if err != nil {
+		t.Fatalf("SearchResults: %v", err)
+	}
+	if response.Total != 5 || len(response.Hits) != 2 {
+		t.Fatalf("SearchResults: got Total %d with %d hits, want 5 with 2", response.Total, len(response.Hits))
+	}
+	for i, hit := range response.Hits {
+		want := fmt.Sprintf("user:%d", i+3)
+		if hit.Identifier.String() != want || hit.Value.(map[string]interface{})["i"] != float64(i+3) {
+			t.Errorf("hit %d: got %s = %v, want %s with its value", i, hit.Identifier, hit.Value, want)
+		}
+	}
+}
+
+func TestRedisClientEscapeHatch(t *testing.T) {
+	ctx := context.Background()
+	var repo DataRepository
+	repo, server := newTestRedisRepository(t, RedisConfig{})
+
+	provider, ok := repo.(RedisClientProvider)
+	if !ok {
+		t.Fatal("RedisRepository is not a RedisClientProvider")
+	}
+	if pong, err := provider.Unwrap().Ping(ctx).Result(); err != nil || pong != "PONG" {
+		t.Errorf("raw PING: got %q, %v, want PONG", pong, err)
+	}
+	// Raw commands bypass the key prefix
+	if err := provider.Unwrap().Set(ctx, "raw", "value", 0).Err(); err != nil || !server.Exists("raw") {
+		t.Errorf("raw SET: got %v, keys %v, want the unprefixed key raw", err, server.Keys())
+	}
+
+	if _, ok := RedisClientOf(NewRetryRepository(NewHookedRepository(repo), RetryConfig{})); !ok {
+		t.Error("RedisClientOf of a wrapped RedisRepository: got false, want its client")
+	}
+	if _, ok := RedisClientOf(NewReadOnlyRepository(repo)); ok {
+		t.Error("RedisClientOf of a read-only RedisRepository: got its client, want false")
+	}
+	memory := newTestMemoryRepository(t, MemoryConfig{})
+	if _, ok := DataRepository(memory).(RedisClientProvider); ok {
+		t.Error("MemoryRepository is a RedisClientProvider")
+	}
+	if _, ok := RedisClientOf(memory); ok {
+		t.Error("RedisClientOf of a MemoryRepository: got a client, want false")
+	}
+}
+
+func TestRedisHierarchicalIDsRoundTrip(t *testing.T) {
+	ctx := context.Background()
+	repo, _ := newTestRedisRepository(t, RedisConfig{})
+	for _, id := range []string{"a", "a:b", "a:b:c", "2024:01:invoice:17"} {
+		identifier := RedisIdentifier{EntityPrefix: "file", ID: id}
+		key, err := repo.identifierToKey(identifier, false)
+		if err != nil {
+			t.Fatalf("identifierToKey(%v): %v", identifier, err)
+		}
+		if got, err := repo.keyToIdentifier(key); err != nil || got != identifier {
+			t.Errorf("keyToIdentifier(%q): got %#v, %v, want %#v", key, got, err, identifier)
+		}
+	}
+
+	identifier := RedisIdentifier{EntityPrefix: "file", ID: "a:b:c"}
+	if err := repo.Create(ctx, identifier, map[string]interface{}{"size": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var value map[string]interface{}
+	if err := repo.Read(ctx, identifier, &value); err != nil {
+		t.Errorf("Read: %v", err)
+	}
+	ids, _, err := repo.List(ctx, "app:file:*")
+	if err != nil || len(ids) != 1 || ids[0] != identifier {
+		t.Errorf("List: got %v, %v, want [%v]", ids, err, identifier)
+	}
+
+	// An id ending in a reserved key part would collide with the entity's lock or version key
+	if err := repo.Create(ctx, RedisIdentifier{EntityPrefix: "file", ID: "a:lock"}, map[string]interface{}{}); !errors.Is(err, ErrInvalidIdentifier) {
+		t.Errorf("Create with a reserved last id part: got %v, want ErrInvalidIdentifier", err)
+	}
+}
+
+func TestKeyFor(t *testing.T) {
+	redisRepo, server := newTestRedisRepository(t, RedisConfig{})
+	custom := newTestRedisRepositoryOn(t, server, RedisConfig{KeyPrefix: "svc", KeySeparator: "."})
+	memory := newTestMemoryRepository(t, MemoryConfig{})
+	keyFor := func(repo DataRepository) func(EntityIdentifier) (string, error) {
+		return repo.(interface {
+			KeyFor(EntityIdentifier) (string, error)
+		}).KeyFor
+	}
+
+	for _, tc := range []struct {
+		name   string
+		keyFor func(EntityIdentifier) (string, error)
+		id     EntityIdentifier
+		want   string
+	}{
+		{"redis", redisRepo.KeyFor, RedisIdentifier{EntityPrefix: "user", ID: "1"}, "app:user:1"},
+		{"redis simple", redisRepo.KeyFor, SimpleIdentifier("user:1"), "app:user:1"},
+		{"redis custom separator", custom.KeyFor, RedisIdentifier{EntityPrefix: "user", ID: "1"}, "svc.user.1"},
+		{"redis namespace", keyFor(redisRepo.WithNamespace("tenant")), SimpleIdentifier("user:1"), "app:tenant:user:1"},
+		{"memory", memory.KeyFor, SimpleIdentifier("user:1"), "user:1"},
+		{"memory namespace", keyFor(memory.WithNamespace("tenant")), SimpleIdentifier("user:1"), "tenant:user:1"},
+	} {
+		if key, err := tc.keyFor(tc.id); err != nil || key != tc.want {
+			t.Errorf("%s: got %q, %v, want %q", tc.name, key, err, tc.want)
+		}
+	}
+
+	// The key is the one the entity is stored under
+	if err := redisRepo.Create(context.Background(), SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if !server.Exists("app:user:1") {
+		t.Error("the entity is not stored under the key returned by KeyFor")
+	}
+	for _, id := range []EntityIdentifier{SimpleIdentifier("user:*"), RedisIdentifier{EntityPrefix: "1user", ID: "1"}} {
+		if _, err := redisRepo.KeyFor(id); !errors.Is(err, ErrInvalidIdentifier) {
+			t.Errorf("KeyFor(%v): got %v, want ErrInvalidIdentifier", id, err)
+		}
+	}
+}
+
+func TestRedisJSONModuleCheck(t *testing.T) {
+	ctx := context.Background()
+	// miniredis lacks the RedisJSON module, so the default JSON storage is refused
+	server := miniredis.RunT(t)
+	repo, err := NewRedisRepository(RedisConfig{Addrs: []string{server.Addr()}, KeyPrefix: "app"})
+	if !errors.Is(err, ErrNotSupported) || !strings.Contains(err.Error(), "RedisJSON module required") {
+		t.Fatalf("NewRedisRepository in JSON mode: got %v, %v, want ErrNotSupported naming the module", repo, err)
+	}
+
+	repo, err = NewRedisRepository(RedisConfig{Addrs: []string{server.Addr()}, KeyPrefix: "app", DisableJSONModule: true})
+	if err != nil {
+		t.Fatalf("NewRedisRepository with DisableJSONModule: %v", err)
+	}
+	defer repo.Close()
+	if err := repo.(*RedisRepository).CheckJSONModule(ctx); err != nil {
+		t.Errorf("CheckJSONModule in string mode: %v", err)
+	}
+	if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	var value map[string]int
+	if err := repo.Read(ctx, SimpleIdentifier("user:1"), &value); err != nil || value["a"] != 1 {
+		t.Errorf("Read: got %v, %v", value, err)
+	}
+
+	// A repository on a client of the caller's is only checked on request
+	client := redis.NewClient(&redis.Options{Addr: server.Addr()})
+	defer client.Close()
+	shared := NewRedisRepositoryWithClientConfig(client, RedisConfig{KeyPrefix: "app"}).(*RedisRepository)
+	if err := shared.CheckJSONModule(ctx); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("CheckJSONModule without the module: got %v, want ErrNotSupported", err)
+	}
+}
+
+func TestRedisStringStorage(t *testing.T) {
+	ctx := context.Background()
+	// miniredis rejects JSON.* commands like a server without the RedisJSON module
+	repo, server := newTestRedisRepository(t, RedisConfig{StorageMode: RedisStorageString})
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, map[string]interface{}{"name": "ann", "address": map[string]string{"city": "Berlin"}}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if stored, err := server.Get("app:user:1"); err != nil || stored != `{"address":{"city":"Berlin"},"name":"ann"}` {
+		t.Errorf("stored value: got %q, %v, want the plain JSON encoding", stored, err)
+	}
+
+	if err := repo.SetExpiration(ctx, id, time.Hour); err != nil {
+		t.Fatalf("SetExpiration: %v", err)
+	}
+	if err := repo.Update(ctx, id, map[string]interface{}{"name": "bob", "address": map[string]string{"city": "Berlin"}}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	if err := repo.UpdateField(ctx, id, "address.city", "Hamburg"); err != nil {
+		t.Fatalf("UpdateField: %v", err)
+	}
+	if ttl := server.TTL("app:user:1"); ttl != time.Hour {
+		t.Errorf("TTL after Update and UpdateField: got %v, want it kept at 1h", ttl)
+	}
+	var city string
+	if err := repo.ReadField(ctx, id, "address.city", &city); err != nil || city != "Hamburg" {
+		t.Errorf("ReadField: got %q, %v, want Hamburg", city, err)
+	}
+	var user struct {
+		Name    string
+		Address struct{ City string }
+	}
+	if err := repo.Read(ctx, id, &user); err != nil || user.Name != "bob" || user.Address.City != "Hamburg" {
+		t.Errorf("Read: got %+v, %v", user, err)
+	}
+
+	ids, values, err := repo.List(ctx, "app:user:*")
+	if err != nil || len(ids) != 1 || ids[0].String() != "user:1" {
+		t.Fatalf("List: got %v, %v, want user:1", ids, err)
+	}
+	if value, ok := values[0].(map[string]interface{}); !ok || value["name"] != "bob" {
+		t.Errorf("List: got value %v, want the stored document", values[0])
+	}
+
+	if err := repo.Delete(ctx, id); err != nil {
+		t.Fatalf("Delete: %v", err)
+	}
+	if err := repo.Read(ctx, id, &user); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Read after Delete: got %v, want ErrNotFound", err)
+	}
+	if _, err := repo.Search(ctx, "*", 0, 10, "", ""); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Search in string mode: got %v, want ErrNotSupported", err)
+	}
+}
+
+func TestRedisCreateDropsLeftoverSiblingKeys(t *testing.T) {
+	ctx := context.Background()
+	repo, server := newTestRedisRepository(t, RedisConfig{IdleExpiration: true})
+	value := map[string]int{"a": 1}
+	creators := map[string]func(id EntityIdentifier) error{
+		"Create":         func(id EntityIdentifier) error { return repo.Create(ctx, id, value) },
+		"CreateWithTTL":  func(id EntityIdentifier) error { return repo.CreateWithTTL(ctx, id, value, time.Hour) },
+		"CreateIfAbsent": func(id EntityIdentifier) error { _, err := repo.CreateIfAbsent(ctx, id, value, 0); return err },
+		"CreateMany": func(id EntityIdentifier) error {
+			return repo.CreateMany(ctx, map[EntityIdentifier]interface{}{id: value})
+		},
+	}
+	for name, create := range creators {
+		id := SimpleIdentifier("user:" + name)
+		if err := repo.Create(ctx, id, value); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := repo.UpdateWithVersion(ctx, id, value, 0); err != nil {
+			t.Fatalf("UpdateWithVersion: %v", err)
+		}
+		if err := repo.SetIdleExpiration(ctx, id, time.Minute); err != nil {
+			t.Fatalf("SetIdleExpiration: %v", err)
+		}
+		// The entity vanishes without its sibling keys, as when Redis evicts it
+		server.Del("app:user:" + name)
+
+		if err := create(id); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if version, err := repo.GetVersion(ctx, id); err != nil || version != 0 {
+			t.Errorf("GetVersion after %s: got %d, %v, want 0", name, version, err)
+		}
+		if idle, err := repo.GetIdleExpiration(ctx, id); err != nil || idle != 0 {
+			t.Errorf("GetIdleExpiration after %s: got %v, %v, want none", name, idle, err)
+		}
+	}
+}
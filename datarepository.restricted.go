@@ -0,0 +1,873 @@
+// datarepository.restricted.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// MutatingOperations lists the operations that modify stored data or locks.
+// These are the operations blocked by NewReadOnlyRepository.
+var MutatingOperations = []Operation{
+	OpCreate,
+	OpCreateWithGeneratedID,
+	OpCreateIfAbsent,
+	OpCreateWithTTL,
+	OpUpsert,
+	OpUpsertWithTTL,
+	OpUpsertManyWithTTL,
+	OpUpdate,
+	OpUpdateField,
+	OpCompareAndSwap,
+	OpUpdateWithVersion,
+	OpDelete,
+	OpGetAndDelete,
+	OpGetAndSet,
+	OpCreateMany,
+	OpDeleteMany,
+	OpDeletePattern,
+	OpAcquireLock,
+	OpAcquireLockWithToken,
+	OpReleaseLock,
+	OpReleaseLockWithToken,
+	OpRenewLock,
+	OpSetExpiration,
+	OpSetExpirationCond,
+	OpSetExpirationMany,
+	OpPersist,
+	OpAtomicIncrement,
+	OpIncrementBy,
+	OpDecrementBy,
+	OpIncrementWithLimit,
+	OpIncrementWithExpiry,
+	OpIncrementFloat,
+	OpSetCounter,
+	OpListPush,
+	OpListPop,
+	OpSetAdd,
+	OpSetRemove,
+	OpHashSet,
+	OpHashDelete,
+	OpZAdd,
+	OpZIncrBy,
+	OpGeoAdd,
+	OpCreateFieldIndex,
+	OpSetIdleExpiration,
+}
+
+// AllOperations lists every operation that can be restricted by a RestrictedRepository
+var AllOperations = []Operation{
+	OpCreate,
+	OpCreateWithGeneratedID,
+	OpCreateIfAbsent,
+	OpCreateWithTTL,
+	OpRead,
+	OpReadWithTTL,
+	OpExists,
+	OpExistsMany,
+	OpUpsert,
+	OpUpsertWithTTL,
+	OpUpsertManyWithTTL,
+	OpUpdate,
+	OpUpdateField,
+	OpCompareAndSwap,
+	OpUpdateWithVersion,
+	OpGetVersion,
+	OpReadField,
+	OpDelete,
+	OpGetAndDelete,
+	OpGetAndSet,
+	OpCreateMany,
+	OpReadMany,
+	OpReadManyOrdered,
+	OpDeleteMany,
+	OpDeletePattern,
+	OpList,
+	OpListPaged,
+	OpListPage,
+	OpListDetailed,
+	OpCount,
+	OpIterate,
+	OpEntityPrefixes,
+	OpSearch,
+	OpSearchDetailed,
+	OpSearchResults,
+	OpSearchQuery,
+	OpAcquireLock,
+	OpAcquireLockWithToken,
+	OpReleaseLock,
+	OpReleaseLockWithToken,
+	OpRenewLock,
+	OpPublish,
+	OpSubscribe,
+	OpSubscribeMessages,
+	OpPSubscribe,
+	OpSetExpiration,
+	OpSetExpirationCond,
+	OpSetExpirationMany,
+	OpGetExpiration,
+	OpPersist,
+	OpTouch,
+	OpAtomicIncrement,
+	OpIncrementBy,
+	OpDecrementBy,
+	OpIncrementWithLimit,
+	OpIncrementWithExpiry,
+	OpIncrementFloat,
+	OpGetCounter,
+	OpSetCounter,
+	OpWithTransaction,
+	OpListPush,
+	OpListRange,
+	OpListPop,
+	OpListLen,
+	OpSetAdd,
+	OpSetMembers,
+	OpSetIsMember,
+	OpSetRemove,
+	OpHashSet,
+	OpHashGet,
+	OpHashGetAll,
+	OpHashDelete,
+	OpZAdd,
+	OpZRange,
+	OpZRank,
+	OpZIncrBy,
+	OpGeoAdd,
+	OpGeoRadius,
+	OpCreateFieldIndex,
+	OpFindByIndex,
+	OpSetIdleExpiration,
+	OpGetIdleExpiration,
+	OpSubscribeKeyspaceEvents,
+	OpWatch,
+}
+
+// RestrictedRepository wraps a DataRepository and returns ErrNotSupported from
+// every operation that is not allowed. Ping, Close and the plugin methods are
+// always passed through to the wrapped repository. The optional interfaces of the wrapped
+// repository, e.g. ListStore, are only reachable through ListStoreOf and the like, which check
+// their operations as well; RedisClientOf returns false, as the raw client can't be restricted.
+type RestrictedRepository struct {
+	inner  DataRepository
+	denied map[Operation]bool
+}
+
+var _ DataRepository = (*RestrictedRepository)(nil)
+
+// NewReadOnlyRepository wraps inner so that all MutatingOperations return ErrNotSupported
+// while reads, lists, searches and pub/sub keep working
+func NewReadOnlyRepository(inner DataRepository) DataRepository {
+	return NewDenylistRepository(inner, MutatingOperations...)
+}
+
+// NewDenylistRepository wraps inner so that the given operations return ErrNotSupported
+func NewDenylistRepository(inner DataRepository, denied ...Operation) *RestrictedRepository {
+	r := &RestrictedRepository{
+		inner:  inner,
+		denied: make(map[Operation]bool, len(denied)),
+	}
+	for _, op := range denied {
+		r.denied[op] = true
+	}
+	return r
+}
+
+// NewAllowlistRepository wraps inner so that every operation except the given ones returns ErrNotSupported
+func NewAllowlistRepository(inner DataRepository, allowed ...Operation) *RestrictedRepository {
+	isAllowed := make(map[Operation]bool, len(allowed))
+	for _, op := range allowed {
+		isAllowed[op] = true
+	}
+	denied := make([]Operation, 0, len(AllOperations))
+	for _, op := range AllOperations {
+		if !isAllowed[op] {
+			denied = append(denied, op)
+		}
+	}
+	return NewDenylistRepository(inner, denied...)
+}
+
+// Unwrap returns the wrapped repository
+func (r *RestrictedRepository) Unwrap() DataRepository {
+	return r.inner
+}
+
+// IsAllowed reports whether the given operation is allowed on this repository
+func (r *RestrictedRepository) IsAllowed(op Operation) bool {
+	return !r.denied[op]
+}
+
+func (r *RestrictedRepository) check(op Operation) error {
+	if r.denied[op] {
+		return fmt.Errorf("%w: %s is not allowed on this repository", ErrNotSupported, op)
+	}
+	return nil
+}
+
+func (r *RestrictedRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.check(OpCreate); err != nil {
+		return err
+	}
+	return r.inner.Create(ctx, identifier, value)
+}
+
+func (r *RestrictedRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	if err := r.check(OpCreateWithGeneratedID); err != nil {
+		return nil, err
+	}
+	return r.inner.CreateWithGeneratedID(ctx, entityPrefix, value)
+}
+
+func (r *RestrictedRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if err := r.check(OpCreateIfAbsent); err != nil {
+		return false, err
+	}
+	return r.inner.CreateIfAbsent(ctx, identifier, value, ttl)
+}
+
+func (r *RestrictedRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if err := r.check(OpCreateWithTTL); err != nil {
+		return err
+	}
+	return r.inner.CreateWithTTL(ctx, identifier, value, ttl)
+}
+
+func (r *RestrictedRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.check(OpRead); err != nil {
+		return err
+	}
+	return r.inner.Read(ctx, identifier, value)
+}
+
+func (r *RestrictedRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	if err := r.check(OpReadWithTTL); err != nil {
+		return 0, err
+	}
+	return r.inner.ReadWithTTL(ctx, identifier, value)
+}
+
+func (r *RestrictedRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	if err := r.check(OpExists); err != nil {
+		return false, err
+	}
+	return r.inner.Exists(ctx, identifier)
+}
+
+func (r *RestrictedRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	if err := r.check(OpExistsMany); err != nil {
+		return nil, err
+	}
+	return r.inner.ExistsMany(ctx, identifiers)
+}
+
+func (r *RestrictedRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.check(OpUpsert); err != nil {
+		return err
+	}
+	return r.inner.Upsert(ctx, identifier, value)
+}
+
+func (r *RestrictedRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if err := r.check(OpUpsertWithTTL); err != nil {
+		return err
+	}
+	return r.inner.UpsertWithTTL(ctx, identifier, value, ttl)
+}
+
+func (r *RestrictedRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	if err := r.check(OpUpsertManyWithTTL); err != nil {
+		return err
+	}
+	return r.inner.UpsertManyWithTTL(ctx, items, ttl)
+}
+
+func (r *RestrictedRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.check(OpUpdate); err != nil {
+		return err
+	}
+	return r.inner.Update(ctx, identifier, value)
+}
+
+func (r *RestrictedRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if err := r.check(OpUpdateField); err != nil {
+		return err
+	}
+	return r.inner.UpdateField(ctx, identifier, path, value)
+}
+
+func (r *RestrictedRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	if err := r.check(OpCompareAndSwap); err != nil {
+		return false, err
+	}
+	return r.inner.CompareAndSwap(ctx, identifier, expected, newValue)
+}
+
+func (r *RestrictedRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	if err := r.check(OpUpdateWithVersion); err != nil {
+		return 0, err
+	}
+	return r.inner.UpdateWithVersion(ctx, identifier, value, expectedVersion)
+}
+
+func (r *RestrictedRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.check(OpGetVersion); err != nil {
+		return 0, err
+	}
+	return r.inner.GetVersion(ctx, identifier)
+}
+
+func (r *RestrictedRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	if err := r.check(OpReadField); err != nil {
+		return err
+	}
+	return r.inner.ReadField(ctx, identifier, path, value)
+}
+
+func (r *RestrictedRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.check(OpDelete); err != nil {
+		return err
+	}
+	return r.inner.Delete(ctx, identifier)
+}
+
+func (r *RestrictedRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := r.check(OpGetAndDelete); err != nil {
+		return err
+	}
+	return r.inner.GetAndDelete(ctx, identifier, value)
+}
+
+func (r *RestrictedRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	if err := r.check(OpGetAndSet); err != nil {
+		return err
+	}
+	return r.inner.GetAndSet(ctx, identifier, newValue, oldValue)
+}
+
+func (r *RestrictedRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	if err := r.check(OpCreateMany); err != nil {
+		return err
+	}
+	return r.inner.CreateMany(ctx, items)
+}
+
+func (r *RestrictedRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if err := r.check(OpReadMany); err != nil {
+		return err
+	}
+	return r.inner.ReadMany(ctx, identifiers, fn)
+}
+
+func (r *RestrictedRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	if err := r.check(OpReadManyOrdered); err != nil {
+		return err
+	}
+	return r.inner.ReadManyOrdered(ctx, identifiers, dest)
+}
+
+func (r *RestrictedRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	if err := r.check(OpDeleteMany); err != nil {
+		return err
+	}
+	return r.inner.DeleteMany(ctx, identifiers)
+}
+
+func (r *RestrictedRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := r.check(OpDeletePattern); err != nil {
+		return 0, err
+	}
+	return r.inner.DeletePattern(ctx, pattern)
+}
+
+func (r *RestrictedRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	if err := r.check(OpList); err != nil {
+		return nil, nil, err
+	}
+	return r.inner.List(ctx, pattern)
+}
+
+func (r *RestrictedRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	if err := r.check(OpListDetailed); err != nil {
+		return ListResult{}, err
+	}
+	return r.inner.ListDetailed(ctx, pattern)
+}
+
+func (r *RestrictedRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	if err := r.check(OpListPaged); err != nil {
+		return nil, nil, 0, err
+	}
+	return r.inner.ListPaged(ctx, pattern, cursor, pageSize)
+}
+
+func (r *RestrictedRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	if err := r.check(OpListPage); err != nil {
+		return nil, "", err
+	}
+	return r.inner.ListPage(ctx, pattern, cursor, pageSize)
+}
+
+func (r *RestrictedRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	if err := r.check(OpCount); err != nil {
+		return 0, err
+	}
+	return r.inner.Count(ctx, pattern)
+}
+
+func (r *RestrictedRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	if err := r.check(OpIterate); err != nil {
+		return err
+	}
+	return r.inner.Iterate(ctx, pattern, fn)
+}
+
+func (r *RestrictedRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	if err := r.check(OpEntityPrefixes); err != nil {
+		return nil, err
+	}
+	return r.inner.EntityPrefixes(ctx)
+}
+
+func (r *RestrictedRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *RestrictedRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	if err := r.check(OpSearch); err != nil {
+		return nil, err
+	}
+	return r.inner.Search(ctx, query, offset, limit, sortBy, sortDir)
+}
+
+func (r *RestrictedRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	if err := r.check(OpSearchDetailed); err != nil {
+		return SearchResult{}, err
+	}
+	return r.inner.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+}
+
+func (r *RestrictedRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	if err := r.check(OpSearchResults); err != nil {
+		return SearchResponse{}, err
+	}
+	return r.inner.SearchResults(ctx, query, opts)
+}
+
+func (r *RestrictedRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	if err := r.check(OpSearchQuery); err != nil {
+		return SearchResponse{}, err
+	}
+	return r.inner.SearchQuery(ctx, query, opts)
+}
+
+func (r *RestrictedRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	if err := r.check(OpAcquireLock); err != nil {
+		return false, err
+	}
+	return r.inner.AcquireLock(ctx, identifier, ttl)
+}
+
+func (r *RestrictedRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	if err := r.check(OpAcquireLockWithToken); err != nil {
+		return "", false, err
+	}
+	return r.inner.AcquireLockWithToken(ctx, identifier, ttl)
+}
+
+func (r *RestrictedRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.check(OpReleaseLock); err != nil {
+		return err
+	}
+	return r.inner.ReleaseLock(ctx, identifier)
+}
+
+func (r *RestrictedRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	if err := r.check(OpReleaseLockWithToken); err != nil {
+		return err
+	}
+	return r.inner.ReleaseLockWithToken(ctx, identifier, token)
+}
+
+func (r *RestrictedRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	if err := r.check(OpRenewLock); err != nil {
+		return false, err
+	}
+	return r.inner.RenewLock(ctx, identifier, token, ttl)
+}
+
+func (r *RestrictedRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	if err := r.check(OpPublish); err != nil {
+		return err
+	}
+	return r.inner.Publish(ctx, channel, message)
+}
+
+func (r *RestrictedRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	if err := r.check(OpSubscribe); err != nil {
+		return nil, err
+	}
+	return r.inner.Subscribe(ctx, channel)
+}
+
+func (r *RestrictedRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	if err := r.check(OpSubscribeMessages); err != nil {
+		return nil, err
+	}
+	return r.inner.SubscribeMessages(ctx, channel)
+}
+
+func (r *RestrictedRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	if err := r.check(OpPSubscribe); err != nil {
+		return nil, err
+	}
+	return r.inner.PSubscribe(ctx, pattern)
+}
+
+func (r *RestrictedRepository) Ping(ctx context.Context) error {
+	return r.inner.Ping(ctx)
+}
+
+func (r *RestrictedRepository) Close() error {
+	return r.inner.Close()
+}
+
+func (r *RestrictedRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	if err := r.check(OpSetExpiration); err != nil {
+		return err
+	}
+	return r.inner.SetExpiration(ctx, identifier, expiration)
+}
+
+func (r *RestrictedRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	if err := r.check(OpSetExpirationCond); err != nil {
+		return false, err
+	}
+	return r.inner.SetExpirationCond(ctx, identifier, expiration, cond)
+}
+
+func (r *RestrictedRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	if err := r.check(OpSetExpirationMany); err != nil {
+		return err
+	}
+	return r.inner.SetExpirationMany(ctx, identifiers, expiration)
+}
+
+func (r *RestrictedRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if err := r.check(OpGetExpiration); err != nil {
+		return 0, err
+	}
+	return r.inner.GetExpiration(ctx, identifier)
+}
+
+func (r *RestrictedRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.check(OpPersist); err != nil {
+		return err
+	}
+	return r.inner.Persist(ctx, identifier)
+}
+
+func (r *RestrictedRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	if err := r.check(OpTouch); err != nil {
+		return err
+	}
+	return r.inner.Touch(ctx, identifier)
+}
+
+func (r *RestrictedRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.check(OpAtomicIncrement); err != nil {
+		return 0, err
+	}
+	return r.inner.AtomicIncrement(ctx, identifier)
+}
+
+func (r *RestrictedRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	if err := r.check(OpIncrementBy); err != nil {
+		return 0, err
+	}
+	return r.inner.IncrementBy(ctx, identifier, delta)
+}
+
+func (r *RestrictedRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	if err := r.check(OpDecrementBy); err != nil {
+		return 0, err
+	}
+	return r.inner.DecrementBy(ctx, identifier, delta)
+}
+
+func (r *RestrictedRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	if err := r.check(OpIncrementWithLimit); err != nil {
+		return 0, false, err
+	}
+	return r.inner.IncrementWithLimit(ctx, identifier, delta, max)
+}
+
+func (r *RestrictedRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if err := r.check(OpIncrementWithExpiry); err != nil {
+		return 0, err
+	}
+	return r.inner.IncrementWithExpiry(ctx, identifier, delta, ttl)
+}
+
+func (r *RestrictedRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	if err := r.check(OpIncrementFloat); err != nil {
+		return 0, err
+	}
+	return r.inner.IncrementFloat(ctx, identifier, delta)
+}
+
+func (r *RestrictedRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := r.check(OpGetCounter); err != nil {
+		return 0, err
+	}
+	return r.inner.GetCounter(ctx, identifier)
+}
+
+func (r *RestrictedRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	if err := r.check(OpSetCounter); err != nil {
+		return err
+	}
+	return r.inner.SetCounter(ctx, identifier, value)
+}
+
+// WithTransaction passes fn a transaction restricted to the same operations as r
+func (r *RestrictedRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	if err := r.check(OpWithTransaction); err != nil {
+		return err
+	}
+	return r.inner.WithTransaction(ctx, func(tx DataRepository) error {
+		return fn(&RestrictedRepository{inner: tx, denied: r.denied})
+	})
+}
+
+func (r *RestrictedRepository) RegisterPlugin(plugin RepositoryPlugin) error {
+	return r.inner.RegisterPlugin(plugin)
+}
+
+func (r *RestrictedRepository) GetPlugin(name string) (RepositoryPlugin, bool) {
+	return r.inner.GetPlugin(name)
+}
+
+// restrictedListStore checks the operations of the ListStore of a RestrictedRepository
+type restrictedListStore struct {
+	r     *RestrictedRepository
+	inner ListStore
+}
+
+func (s *restrictedListStore) ListPush(ctx context.Context, identifier EntityIdentifier, values ...interface{}) (int64, error) {
+	if err := s.r.check(OpListPush); err != nil {
+		return 0, err
+	}
+	return s.inner.ListPush(ctx, identifier, values...)
+}
+
+func (s *restrictedListStore) ListRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, out interface{}) error {
+	if err := s.r.check(OpListRange); err != nil {
+		return err
+	}
+	return s.inner.ListRange(ctx, identifier, start, stop, out)
+}
+
+func (s *restrictedListStore) ListPop(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	if err := s.r.check(OpListPop); err != nil {
+		return err
+	}
+	return s.inner.ListPop(ctx, identifier, out)
+}
+
+func (s *restrictedListStore) ListLen(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	if err := s.r.check(OpListLen); err != nil {
+		return 0, err
+	}
+	return s.inner.ListLen(ctx, identifier)
+}
+
+// restrictedSetStore checks the operations of the SetStore of a RestrictedRepository
+type restrictedSetStore struct {
+	r     *RestrictedRepository
+	inner SetStore
+}
+
+func (s *restrictedSetStore) SetAdd(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	if err := s.r.check(OpSetAdd); err != nil {
+		return 0, err
+	}
+	return s.inner.SetAdd(ctx, identifier, members...)
+}
+
+func (s *restrictedSetStore) SetMembers(ctx context.Context, identifier EntityIdentifier, out interface{}) error {
+	if err := s.r.check(OpSetMembers); err != nil {
+		return err
+	}
+	return s.inner.SetMembers(ctx, identifier, out)
+}
+
+func (s *restrictedSetStore) SetIsMember(ctx context.Context, identifier EntityIdentifier, member interface{}) (bool, error) {
+	if err := s.r.check(OpSetIsMember); err != nil {
+		return false, err
+	}
+	return s.inner.SetIsMember(ctx, identifier, member)
+}
+
+func (s *restrictedSetStore) SetRemove(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error) {
+	if err := s.r.check(OpSetRemove); err != nil {
+		return 0, err
+	}
+	return s.inner.SetRemove(ctx, identifier, members...)
+}
+
+// restrictedHashStore checks the operations of the HashStore of a RestrictedRepository
+type restrictedHashStore struct {
+	r     *RestrictedRepository
+	inner HashStore
+}
+
+func (s *restrictedHashStore) HashSet(ctx context.Context, identifier EntityIdentifier, field string, value interface{}) error {
+	if err := s.r.check(OpHashSet); err != nil {
+		return err
+	}
+	return s.inner.HashSet(ctx, identifier, field, value)
+}
+
+func (s *restrictedHashStore) HashGet(ctx context.Context, identifier EntityIdentifier, field string, out interface{}) error {
+	if err := s.r.check(OpHashGet); err != nil {
+		return err
+	}
+	return s.inner.HashGet(ctx, identifier, field, out)
+}
+
+func (s *restrictedHashStore) HashGetAll(ctx context.Context, identifier EntityIdentifier) (map[string]interface{}, error) {
+	if err := s.r.check(OpHashGetAll); err != nil {
+		return nil, err
+	}
+	return s.inner.HashGetAll(ctx, identifier)
+}
+
+func (s *restrictedHashStore) HashDelete(ctx context.Context, identifier EntityIdentifier, field string) error {
+	if err := s.r.check(OpHashDelete); err != nil {
+		return err
+	}
+	return s.inner.HashDelete(ctx, identifier, field)
+}
+
+// restrictedSortedSetStore checks the operations of the SortedSetStore of a RestrictedRepository
+type restrictedSortedSetStore struct {
+	r     *RestrictedRepository
+	inner SortedSetStore
+}
+
+func (s *restrictedSortedSetStore) ZAdd(ctx context.Context, identifier EntityIdentifier, member string, score float64) error {
+	if err := s.r.check(OpZAdd); err != nil {
+		return err
+	}
+	return s.inner.ZAdd(ctx, identifier, member, score)
+}
+
+func (s *restrictedSortedSetStore) ZRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, withScores bool) ([]ScoredMember, error) {
+	if err := s.r.check(OpZRange); err != nil {
+		return nil, err
+	}
+	return s.inner.ZRange(ctx, identifier, start, stop, withScores)
+}
+
+func (s *restrictedSortedSetStore) ZRank(ctx context.Context, identifier EntityIdentifier, member string) (int64, error) {
+	if err := s.r.check(OpZRank); err != nil {
+		return 0, err
+	}
+	return s.inner.ZRank(ctx, identifier, member)
+}
+
+func (s *restrictedSortedSetStore) ZIncrBy(ctx context.Context, identifier EntityIdentifier, member string, delta float64) (float64, error) {
+	if err := s.r.check(OpZIncrBy); err != nil {
+		return 0, err
+	}
+	return s.inner.ZIncrBy(ctx, identifier, member, delta)
+}
+
+// restrictedGeoStore checks the operations of the GeoStore of a RestrictedRepository
+type restrictedGeoStore struct {
+	r     *RestrictedRepository
+	inner GeoStore
+}
+
+func (s *restrictedGeoStore) GeoAdd(ctx context.Context, identifier EntityIdentifier, member string, lon, lat float64) error {
+	if err := s.r.check(OpGeoAdd); err != nil {
+		return err
+	}
+	return s.inner.GeoAdd(ctx, identifier, member, lon, lat)
+}
+
+func (s *restrictedGeoStore) GeoRadius(ctx context.Context, identifier EntityIdentifier, lon, lat float64, radius float64, unit string) ([]GeoHit, error) {
+	if err := s.r.check(OpGeoRadius); err != nil {
+		return nil, err
+	}
+	return s.inner.GeoRadius(ctx, identifier, lon, lat, radius, unit)
+}
+
+// restrictedFieldIndexer checks the operations of the FieldIndexer of a RestrictedRepository
+type restrictedFieldIndexer struct {
+	r     *RestrictedRepository
+	inner FieldIndexer
+}
+
+func (s *restrictedFieldIndexer) CreateFieldIndex(field string, extractor FieldExtractor) error {
+	if err := s.r.check(OpCreateFieldIndex); err != nil {
+		return err
+	}
+	return s.inner.CreateFieldIndex(field, extractor)
+}
+
+func (s *restrictedFieldIndexer) FindByIndex(ctx context.Context, field, value string) ([]EntityIdentifier, error) {
+	if err := s.r.check(OpFindByIndex); err != nil {
+		return nil, err
+	}
+	return s.inner.FindByIndex(ctx, field, value)
+}
+
+// restrictedIdleExpirer checks the operations of the IdleExpirer of a RestrictedRepository
+type restrictedIdleExpirer struct {
+	r     *RestrictedRepository
+	inner IdleExpirer
+}
+
+func (s *restrictedIdleExpirer) SetIdleExpiration(ctx context.Context, identifier EntityIdentifier, idle time.Duration) error {
+	if err := s.r.check(OpSetIdleExpiration); err != nil {
+		return err
+	}
+	return s.inner.SetIdleExpiration(ctx, identifier, idle)
+}
+
+func (s *restrictedIdleExpirer) GetIdleExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	if err := s.r.check(OpGetIdleExpiration); err != nil {
+		return 0, err
+	}
+	return s.inner.GetIdleExpiration(ctx, identifier)
+}
+
+// restrictedKeyspaceNotifier checks the operation of the KeyspaceNotifier of a RestrictedRepository
+type restrictedKeyspaceNotifier struct {
+	r     *RestrictedRepository
+	inner KeyspaceNotifier
+}
+
+func (s *restrictedKeyspaceNotifier) SubscribeKeyspaceEvents(ctx context.Context, pattern EntityIdentifier, events ...EventType) (chan KeyEvent, error) {
+	if err := s.r.check(OpSubscribeKeyspaceEvents); err != nil {
+		return nil, err
+	}
+	return s.inner.SubscribeKeyspaceEvents(ctx, pattern, events...)
+}
+
+// restrictedKeyWatcher checks the operation of the KeyWatcher of a RestrictedRepository
+type restrictedKeyWatcher struct {
+	r     *RestrictedRepository
+	inner KeyWatcher
+}
+
+func (s *restrictedKeyWatcher) Watch(ctx context.Context, identifier EntityIdentifier) (chan []byte, error) {
+	if err := s.r.check(OpWatch); err != nil {
+		return nil, err
+	}
+	return s.inner.Watch(ctx, identifier)
+}
@@ -0,0 +1,102 @@
+// datarepository.restricted_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+)
+
+func TestReadOnlyRepositoryRestrictsOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	inner := newTestMemoryRepository(t, MemoryConfig{})
+	ro := NewReadOnlyRepository(inner)
+	id := MemoryIdentifier("user:1")
+
+	if err := ro.Create(ctx, id, map[string]string{"name": "alice"}); !errors.Is(err, ErrNotSupported) {
+		t.Fatalf("Create: got %v, want ErrNotSupported", err)
+	}
+
+	lists, ok := ListStoreOf(ro)
+	if !ok {
+		t.Fatal("ListStoreOf: got false")
+	}
+	if _, err := lists.ListPush(ctx, MemoryIdentifier("log:1"), "a"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ListPush: got %v, want ErrNotSupported", err)
+	}
+	if err := lists.ListPop(ctx, MemoryIdentifier("log:1"), new(string)); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ListPop: got %v, want ErrNotSupported", err)
+	}
+	if n, err := lists.ListLen(ctx, MemoryIdentifier("log:1")); err != nil || n != 0 {
+		t.Errorf("ListLen: got %d, %v, want 0, nil", n, err)
+	}
+
+	sets, _ := SetStoreOf(ro)
+	if _, err := sets.SetAdd(ctx, MemoryIdentifier("tags:1"), "a"); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetAdd: got %v, want ErrNotSupported", err)
+	}
+	hashes, _ := HashStoreOf(ro)
+	if err := hashes.HashSet(ctx, MemoryIdentifier("h:1"), "f", 1); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("HashSet: got %v, want ErrNotSupported", err)
+	}
+	zsets, _ := SortedSetStoreOf(ro)
+	if err := zsets.ZAdd(ctx, MemoryIdentifier("board:1"), "alice", 1); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ZAdd: got %v, want ErrNotSupported", err)
+	}
+	geos, _ := GeoStoreOf(ro)
+	if err := geos.GeoAdd(ctx, MemoryIdentifier("places:1"), "home", 13.4, 52.5); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("GeoAdd: got %v, want ErrNotSupported", err)
+	}
+	indexer, _ := FieldIndexerOf(ro)
+	if err := indexer.CreateFieldIndex("name", func(interface{}) string { return "" }); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("CreateFieldIndex: got %v, want ErrNotSupported", err)
+	}
+	idle, _ := IdleExpirerOf(ro)
+	if err := idle.SetIdleExpiration(ctx, id, time.Minute); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("SetIdleExpiration: got %v, want ErrNotSupported", err)
+	}
+
+	if n, _ := inner.ListLen(ctx, MemoryIdentifier("log:1")); n != 0 {
+		t.Errorf("inner list has %d values, want 0", n)
+	}
+}
+
+func TestAllowlistRepositoryRestrictsOptionalInterfaces(t *testing.T) {
+	ctx := context.Background()
+	repo := NewAllowlistRepository(newTestMemoryRepository(t, MemoryConfig{}), OpListPush, OpListLen)
+
+	lists, ok := ListStoreOf(repo)
+	if !ok {
+		t.Fatal("ListStoreOf: got false")
+	}
+	if n, err := lists.ListPush(ctx, MemoryIdentifier("log:1"), "a", "b"); err != nil || n != 2 {
+		t.Fatalf("ListPush: got %d, %v, want 2, nil", n, err)
+	}
+	var values []string
+	if err := lists.ListRange(ctx, MemoryIdentifier("log:1"), 0, -1, &values); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("ListRange: got %v, want ErrNotSupported", err)
+	}
+	watcher, ok := KeyWatcherOf(repo)
+	if !ok {
+		t.Fatal("KeyWatcherOf: got false")
+	}
+	if _, err := watcher.Watch(ctx, MemoryIdentifier("log:1")); !errors.Is(err, ErrNotSupported) {
+		t.Errorf("Watch: got %v, want ErrNotSupported", err)
+	}
+}
+
+func TestRestrictedRepositoryHidesMissingInterfaces(t *testing.T) {
+	null, err := NewNullRepository(nil)
+	if err != nil {
+		t.Fatalf("NewNullRepository: %v", err)
+	}
+	ro := NewReadOnlyRepository(null)
+	if _, ok := ListStoreOf(ro); ok {
+		t.Error("ListStoreOf: got true for a repository without lists")
+	}
+	if _, ok := RedisClientOf(ro); ok {
+		t.Error("RedisClientOf: got true for a restricted repository")
+	}
+}
@@ -0,0 +1,670 @@
+// datarepository.retry.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math/rand/v2"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/redis/go-redis/v9"
+)
+
+const (
+	DefaultRetryMaxAttempts = 3
+	DefaultRetryBaseDelay   = 50 * time.Millisecond
+	DefaultRetryMaxDelay    = time.Second
+)
+
+// IdempotentOperations lists the operations that can be repeated without changing their
+// outcome. They are the operations a RetryRepository retries by default. ReadMany and Iterate
+// are not included as their callback may already have been called for some entities.
+var IdempotentOperations = []Operation{
+	OpRead,
+	OpReadWithTTL,
+	OpExists,
+	OpExistsMany,
+	OpGetVersion,
+	OpReadField,
+	OpReadManyOrdered,
+	OpList,
+	OpListPaged,
+	OpListPage,
+	OpListDetailed,
+	OpCount,
+	OpEntityPrefixes,
+	OpSearch,
+	OpSearchDetailed,
+	OpSearchResults,
+	OpSearchQuery,
+	OpGetExpiration,
+	OpPersist,
+	OpTouch,
+	OpGetCounter,
+}
+
+// RetryConfig configures a RetryRepository
+type RetryConfig struct {
+	// MaxAttempts is the maximum number of attempts per operation, including the first one.
+	// Defaults to DefaultRetryMaxAttempts.
+	MaxAttempts int
+	// BaseDelay is the delay before the first retry, doubled for every further retry.
+	// Defaults to DefaultRetryBaseDelay.
+	BaseDelay time.Duration
+	// MaxDelay caps the delay between two attempts. Defaults to DefaultRetryMaxDelay.
+	MaxDelay time.Duration
+	// RetryableErrors reports whether an operation that failed with the given error may be
+	// retried. Defaults to IsTransientError.
+	RetryableErrors func(error) bool
+	// Operations are the operations that are retried. Defaults to IdempotentOperations.
+	// Only add operations that are safe to repeat, e.g. OpUpsert; repeating OpCreate may
+	// return ErrAlreadyExists for an entity created by an attempt that appeared to fail.
+	Operations []Operation
+}
+
+// RetryRepository wraps a DataRepository and retries failed operations with exponential
+// backoff and jitter. Only the configured operations are retried, and only for errors that
+// RetryableErrors accepts. Operations within WithTransaction are not retried.
+type RetryRepository struct {
+	inner      DataRepository
+	config     RetryConfig
+	operations map[Operation]bool
+}
+
+var _ DataRepository = (*RetryRepository)(nil)
+
+// NewRetryRepository wraps inner so that failed operations are retried as configured
+func NewRetryRepository(inner DataRepository, config RetryConfig) *RetryRepository {
+	if config.MaxAttempts <= 0 {
+		config.MaxAttempts = DefaultRetryMaxAttempts
+	}
+	if config.BaseDelay <= 0 {
+		config.BaseDelay = DefaultRetryBaseDelay
+	}
+	if config.MaxDelay <= 0 {
+		config.MaxDelay = DefaultRetryMaxDelay
+	}
+	if config.RetryableErrors == nil {
+		config.RetryableErrors = IsTransientError
+	}
+	if config.Operations == nil {
+		config.Operations = IdempotentOperations
+	}
+	r := &RetryRepository{
+		inner:      inner,
+		config:     config,
+		operations: make(map[Operation]bool, len(config.Operations)),
+	}
+	for _, op := range config.Operations {
+		r.operations[op] = true
+	}
+	return r
+}
+
+// transientRedisErrorPrefixes are the prefixes of Redis errors that report a temporary state of
+// the server or cluster, e.g. a slot being migrated, rather than a problem of the request
+var transientRedisErrorPrefixes = []string{"MOVED ", "ASK ", "TRYAGAIN ", "CLUSTERDOWN ", "LOADING "}
+
+// IsTransientError reports whether err is a failure of the underlying store, such as a lost
+// connection, rather than an outcome like ErrNotFound or an invalid request. Besides errors
+// wrapping ErrOperationFailed, this includes network errors, io.EOF and Redis redirection and
+// cluster errors returned by custom repositories or clients. Canceled or expired contexts and
+// closed repositories are not transient.
+func IsTransientError(err error) bool {
+	if err == nil || errors.Is(err, errRepositoryClosed) ||
+		errors.Is(err, context.Canceled) || errors.Is(err, context.DeadlineExceeded) {
+		return false
+	}
+	if errors.Is(err, ErrOperationFailed) || errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return true
+	}
+	var netErr net.Error
+	if errors.As(err, &netErr) {
+		return true
+	}
+	var redisErr redis.Error
+	if errors.As(err, &redisErr) {
+		for _, prefix := range transientRedisErrorPrefixes {
+			if strings.HasPrefix(redisErr.Error(), prefix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Unwrap returns the wrapped repository
+func (r *RetryRepository) Unwrap() DataRepository {
+	return r.inner
+}
+
+// do runs fn, and if op is retried, repeats it while it fails with a retryable error, the
+// attempts are not used up and the context allows for another attempt
+func (r *RetryRepository) do(ctx context.Context, op Operation, fn func() error) error {
+	if !r.operations[op] {
+		return fn()
+	}
+	var err error
+	for attempt := 1; ; attempt++ {
+		err = fn()
+		if err == nil || attempt >= r.config.MaxAttempts || !r.config.RetryableErrors(err) {
+			return err
+		}
+		delay := r.backoff(attempt)
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < delay {
+			return err
+		}
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return err
+		case <-timer.C:
+		}
+	}
+}
+
+// backoff returns the delay after the given failed attempt: BaseDelay doubled per previous
+// attempt, capped at MaxDelay, of which a random part of up to one half is dropped
+func (r *RetryRepository) backoff(attempt int) time.Duration {
+	delay := r.config.MaxDelay
+	if shift := attempt - 1; shift < 32 && r.config.BaseDelay<<shift < r.config.MaxDelay {
+		delay = r.config.BaseDelay << shift
+	}
+	return delay - rand.N(delay/2+1)
+}
+
+func (r *RetryRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return r.do(ctx, OpCreate, func() error {
+		return r.inner.Create(ctx, identifier, value)
+	})
+}
+
+func (r *RetryRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (EntityIdentifier, error) {
+	var identifier EntityIdentifier
+	err := r.do(ctx, OpCreateWithGeneratedID, func() (err error) {
+		identifier, err = r.inner.CreateWithGeneratedID(ctx, entityPrefix, value)
+		return err
+	})
+	return identifier, err
+}
+
+func (r *RetryRepository) CreateIfAbsent(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	var created bool
+	err := r.do(ctx, OpCreateIfAbsent, func() (err error) {
+		created, err = r.inner.CreateIfAbsent(ctx, identifier, value, ttl)
+		return err
+	})
+	return created, err
+}
+
+func (r *RetryRepository) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return r.do(ctx, OpCreateWithTTL, func() error {
+		return r.inner.CreateWithTTL(ctx, identifier, value, ttl)
+	})
+}
+
+func (r *RetryRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return r.do(ctx, OpRead, func() error {
+		return r.inner.Read(ctx, identifier, value)
+	})
+}
+
+func (r *RetryRepository) ReadWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}) (time.Duration, error) {
+	var ttl time.Duration
+	err := r.do(ctx, OpReadWithTTL, func() (err error) {
+		ttl, err = r.inner.ReadWithTTL(ctx, identifier, value)
+		return err
+	})
+	return ttl, err
+}
+
+func (r *RetryRepository) Exists(ctx context.Context, identifier EntityIdentifier) (bool, error) {
+	var ok bool
+	err := r.do(ctx, OpExists, func() (err error) {
+		ok, err = r.inner.Exists(ctx, identifier)
+		return err
+	})
+	return ok, err
+}
+
+func (r *RetryRepository) ExistsMany(ctx context.Context, identifiers []EntityIdentifier) (map[EntityIdentifier]bool, error) {
+	var result map[EntityIdentifier]bool
+	err := r.do(ctx, OpExistsMany, func() (err error) {
+		result, err = r.inner.ExistsMany(ctx, identifiers)
+		return err
+	})
+	return result, err
+}
+
+func (r *RetryRepository) Upsert(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return r.do(ctx, OpUpsert, func() error {
+		return r.inner.Upsert(ctx, identifier, value)
+	})
+}
+
+func (r *RetryRepository) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return r.do(ctx, OpUpsertWithTTL, func() error {
+		return r.inner.UpsertWithTTL(ctx, identifier, value, ttl)
+	})
+}
+
+func (r *RetryRepository) UpsertManyWithTTL(ctx context.Context, items map[EntityIdentifier]interface{}, ttl time.Duration) error {
+	return r.do(ctx, OpUpsertManyWithTTL, func() error {
+		return r.inner.UpsertManyWithTTL(ctx, items, ttl)
+	})
+}
+
+func (r *RetryRepository) Update(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return r.do(ctx, OpUpdate, func() error {
+		return r.inner.Update(ctx, identifier, value)
+	})
+}
+
+func (r *RetryRepository) UpdateField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return r.do(ctx, OpUpdateField, func() error {
+		return r.inner.UpdateField(ctx, identifier, path, value)
+	})
+}
+
+func (r *RetryRepository) CompareAndSwap(ctx context.Context, identifier EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	var ok bool
+	err := r.do(ctx, OpCompareAndSwap, func() (err error) {
+		ok, err = r.inner.CompareAndSwap(ctx, identifier, expected, newValue)
+		return err
+	})
+	return ok, err
+}
+
+func (r *RetryRepository) UpdateWithVersion(ctx context.Context, identifier EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	var newVersion int64
+	err := r.do(ctx, OpUpdateWithVersion, func() (err error) {
+		newVersion, err = r.inner.UpdateWithVersion(ctx, identifier, value, expectedVersion)
+		return err
+	})
+	return newVersion, err
+}
+
+func (r *RetryRepository) GetVersion(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	var version int64
+	err := r.do(ctx, OpGetVersion, func() (err error) {
+		version, err = r.inner.GetVersion(ctx, identifier)
+		return err
+	})
+	return version, err
+}
+
+func (r *RetryRepository) ReadField(ctx context.Context, identifier EntityIdentifier, path string, value interface{}) error {
+	return r.do(ctx, OpReadField, func() error {
+		return r.inner.ReadField(ctx, identifier, path, value)
+	})
+}
+
+func (r *RetryRepository) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	return r.do(ctx, OpDelete, func() error {
+		return r.inner.Delete(ctx, identifier)
+	})
+}
+
+func (r *RetryRepository) GetAndDelete(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return r.do(ctx, OpGetAndDelete, func() error {
+		return r.inner.GetAndDelete(ctx, identifier, value)
+	})
+}
+
+func (r *RetryRepository) GetAndSet(ctx context.Context, identifier EntityIdentifier, newValue, oldValue interface{}) error {
+	return r.do(ctx, OpGetAndSet, func() error {
+		return r.inner.GetAndSet(ctx, identifier, newValue, oldValue)
+	})
+}
+
+func (r *RetryRepository) CreateMany(ctx context.Context, items map[EntityIdentifier]interface{}) error {
+	return r.do(ctx, OpCreateMany, func() error {
+		return r.inner.CreateMany(ctx, items)
+	})
+}
+
+func (r *RetryRepository) ReadMany(ctx context.Context, identifiers []EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return r.do(ctx, OpReadMany, func() error {
+		return r.inner.ReadMany(ctx, identifiers, fn)
+	})
+}
+
+func (r *RetryRepository) ReadManyOrdered(ctx context.Context, identifiers []EntityIdentifier, dest interface{}) error {
+	return r.do(ctx, OpReadManyOrdered, func() error {
+		return r.inner.ReadManyOrdered(ctx, identifiers, dest)
+	})
+}
+
+func (r *RetryRepository) DeleteMany(ctx context.Context, identifiers []EntityIdentifier) error {
+	return r.do(ctx, OpDeleteMany, func() error {
+		return r.inner.DeleteMany(ctx, identifiers)
+	})
+}
+
+func (r *RetryRepository) DeletePattern(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	var deleted int64
+	err := r.do(ctx, OpDeletePattern, func() (err error) {
+		deleted, err = r.inner.DeletePattern(ctx, pattern)
+		return err
+	})
+	return deleted, err
+}
+
+func (r *RetryRepository) List(ctx context.Context, pattern string) ([]EntityIdentifier, []interface{}, error) {
+	var identifiers []EntityIdentifier
+	var entities []interface{}
+	err := r.do(ctx, OpList, func() (err error) {
+		identifiers, entities, err = r.inner.List(ctx, pattern)
+		return err
+	})
+	return identifiers, entities, err
+}
+
+func (r *RetryRepository) ListDetailed(ctx context.Context, pattern string) (ListResult, error) {
+	var result ListResult
+	err := r.do(ctx, OpListDetailed, func() (err error) {
+		result, err = r.inner.ListDetailed(ctx, pattern)
+		return err
+	})
+	return result, err
+}
+
+func (r *RetryRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]EntityIdentifier, []interface{}, uint64, error) {
+	var identifiers []EntityIdentifier
+	var entities []interface{}
+	var nextCursor uint64
+	err := r.do(ctx, OpListPaged, func() (err error) {
+		identifiers, entities, nextCursor, err = r.inner.ListPaged(ctx, pattern, cursor, pageSize)
+		return err
+	})
+	return identifiers, entities, nextCursor, err
+}
+
+func (r *RetryRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]EntityIdentifier, string, error) {
+	var identifiers []EntityIdentifier
+	var nextCursor string
+	err := r.do(ctx, OpListPage, func() (err error) {
+		identifiers, nextCursor, err = r.inner.ListPage(ctx, pattern, cursor, pageSize)
+		return err
+	})
+	return identifiers, nextCursor, err
+}
+
+func (r *RetryRepository) Count(ctx context.Context, pattern EntityIdentifier) (int64, error) {
+	var count int64
+	err := r.do(ctx, OpCount, func() (err error) {
+		count, err = r.inner.Count(ctx, pattern)
+		return err
+	})
+	return count, err
+}
+
+func (r *RetryRepository) Iterate(ctx context.Context, pattern EntityIdentifier, fn func(identifier EntityIdentifier, raw []byte) error) error {
+	return r.do(ctx, OpIterate, func() error {
+		return r.inner.Iterate(ctx, pattern, fn)
+	})
+}
+
+func (r *RetryRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	var prefixes []string
+	err := r.do(ctx, OpEntityPrefixes, func() (err error) {
+		prefixes, err = r.inner.EntityPrefixes(ctx)
+		return err
+	})
+	return prefixes, err
+}
+
+func (r *RetryRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *RetryRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]EntityIdentifier, error) {
+	var identifiers []EntityIdentifier
+	err := r.do(ctx, OpSearch, func() (err error) {
+		identifiers, err = r.inner.Search(ctx, query, offset, limit, sortBy, sortDir)
+		return err
+	})
+	return identifiers, err
+}
+
+func (r *RetryRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (SearchResult, error) {
+	var result SearchResult
+	err := r.do(ctx, OpSearchDetailed, func() (err error) {
+		result, err = r.inner.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+		return err
+	})
+	return result, err
+}
+
+func (r *RetryRepository) SearchResults(ctx context.Context, query string, opts SearchOptions) (SearchResponse, error) {
+	var response SearchResponse
+	err := r.do(ctx, OpSearchResults, func() (err error) {
+		response, err = r.inner.SearchResults(ctx, query, opts)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryRepository) SearchQuery(ctx context.Context, query *Query, opts SearchOptions) (SearchResponse, error) {
+	var response SearchResponse
+	err := r.do(ctx, OpSearchQuery, func() (err error) {
+		response, err = r.inner.SearchQuery(ctx, query, opts)
+		return err
+	})
+	return response, err
+}
+
+func (r *RetryRepository) AcquireLock(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (bool, error) {
+	var ok bool
+	err := r.do(ctx, OpAcquireLock, func() (err error) {
+		ok, err = r.inner.AcquireLock(ctx, identifier, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (r *RetryRepository) AcquireLockWithToken(ctx context.Context, identifier EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	var token string
+	var ok bool
+	err := r.do(ctx, OpAcquireLockWithToken, func() (err error) {
+		token, ok, err = r.inner.AcquireLockWithToken(ctx, identifier, ttl)
+		return err
+	})
+	return token, ok, err
+}
+
+func (r *RetryRepository) ReleaseLock(ctx context.Context, identifier EntityIdentifier) error {
+	return r.do(ctx, OpReleaseLock, func() error {
+		return r.inner.ReleaseLock(ctx, identifier)
+	})
+}
+
+func (r *RetryRepository) ReleaseLockWithToken(ctx context.Context, identifier EntityIdentifier, token string) error {
+	return r.do(ctx, OpReleaseLockWithToken, func() error {
+		return r.inner.ReleaseLockWithToken(ctx, identifier, token)
+	})
+}
+
+func (r *RetryRepository) RenewLock(ctx context.Context, identifier EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	var ok bool
+	err := r.do(ctx, OpRenewLock, func() (err error) {
+		ok, err = r.inner.RenewLock(ctx, identifier, token, ttl)
+		return err
+	})
+	return ok, err
+}
+
+func (r *RetryRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	return r.do(ctx, OpPublish, func() error {
+		return r.inner.Publish(ctx, channel, message)
+	})
+}
+
+func (r *RetryRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	var ch chan interface{}
+	err := r.do(ctx, OpSubscribe, func() (err error) {
+		ch, err = r.inner.Subscribe(ctx, channel)
+		return err
+	})
+	return ch, err
+}
+
+func (r *RetryRepository) SubscribeMessages(ctx context.Context, channel string) (Subscription, error) {
+	var sub Subscription
+	err := r.do(ctx, OpSubscribeMessages, func() (err error) {
+		sub, err = r.inner.SubscribeMessages(ctx, channel)
+		return err
+	})
+	return sub, err
+}
+
+func (r *RetryRepository) PSubscribe(ctx context.Context, pattern string) (Subscription, error) {
+	var sub Subscription
+	err := r.do(ctx, OpPSubscribe, func() (err error) {
+		sub, err = r.inner.PSubscribe(ctx, pattern)
+		return err
+	})
+	return sub, err
+}
+
+func (r *RetryRepository) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	return r.do(ctx, OpSetExpiration, func() error {
+		return r.inner.SetExpiration(ctx, identifier, expiration)
+	})
+}
+
+func (r *RetryRepository) SetExpirationMany(ctx context.Context, identifiers []EntityIdentifier, expiration time.Duration) error {
+	return r.do(ctx, OpSetExpirationMany, func() error {
+		return r.inner.SetExpirationMany(ctx, identifiers, expiration)
+	})
+}
+
+func (r *RetryRepository) SetExpirationCond(ctx context.Context, identifier EntityIdentifier, expiration time.Duration, cond ExpirationCondition) (bool, error) {
+	var ok bool
+	err := r.do(ctx, OpSetExpirationCond, func() (err error) {
+		ok, err = r.inner.SetExpirationCond(ctx, identifier, expiration, cond)
+		return err
+	})
+	return ok, err
+}
+
+func (r *RetryRepository) GetExpiration(ctx context.Context, identifier EntityIdentifier) (time.Duration, error) {
+	var ttl time.Duration
+	err := r.do(ctx, OpGetExpiration, func() (err error) {
+		ttl, err = r.inner.GetExpiration(ctx, identifier)
+		return err
+	})
+	return ttl, err
+}
+
+func (r *RetryRepository) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	return r.do(ctx, OpPersist, func() error {
+		return r.inner.Persist(ctx, identifier)
+	})
+}
+
+func (r *RetryRepository) Touch(ctx context.Context, identifier EntityIdentifier) error {
+	return r.do(ctx, OpTouch, func() error {
+		return r.inner.Touch(ctx, identifier)
+	})
+}
+
+func (r *RetryRepository) AtomicIncrement(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	var value int64
+	err := r.do(ctx, OpAtomicIncrement, func() (err error) {
+		value, err = r.inner.AtomicIncrement(ctx, identifier)
+		return err
+	})
+	return value, err
+}
+
+func (r *RetryRepository) IncrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	var value int64
+	err := r.do(ctx, OpIncrementBy, func() (err error) {
+		value, err = r.inner.IncrementBy(ctx, identifier, delta)
+		return err
+	})
+	return value, err
+}
+
+func (r *RetryRepository) DecrementBy(ctx context.Context, identifier EntityIdentifier, delta int64) (int64, error) {
+	var value int64
+	err := r.do(ctx, OpDecrementBy, func() (err error) {
+		value, err = r.inner.DecrementBy(ctx, identifier, delta)
+		return err
+	})
+	return value, err
+}
+
+func (r *RetryRepository) IncrementWithLimit(ctx context.Context, identifier EntityIdentifier, delta, max int64) (int64, bool, error) {
+	var value int64
+	var ok bool
+	err := r.do(ctx, OpIncrementWithLimit, func() (err error) {
+		value, ok, err = r.inner.IncrementWithLimit(ctx, identifier, delta, max)
+		return err
+	})
+	return value, ok, err
+}
+
+func (r *RetryRepository) IncrementWithExpiry(ctx context.Context, identifier EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	var value int64
+	err := r.do(ctx, OpIncrementWithExpiry, func() (err error) {
+		value, err = r.inner.IncrementWithExpiry(ctx, identifier, delta, ttl)
+		return err
+	})
+	return value, err
+}
+
+func (r *RetryRepository) IncrementFloat(ctx context.Context, identifier EntityIdentifier, delta float64) (float64, error) {
+	var value float64
+	err := r.do(ctx, OpIncrementFloat, func() (err error) {
+		value, err = r.inner.IncrementFloat(ctx, identifier, delta)
+		return err
+	})
+	return value, err
+}
+
+func (r *RetryRepository) GetCounter(ctx context.Context, identifier EntityIdentifier) (int64, error) {
+	var value int64
+	err := r.do(ctx, OpGetCounter, func() (err error) {
+		value, err = r.inner.GetCounter(ctx, identifier)
+		return err
+	})
+	return value, err
+}
+
+func (r *RetryRepository) SetCounter(ctx context.Context, identifier EntityIdentifier, value int64) error {
+	return r.do(ctx, OpSetCounter, func() error {
+		return r.inner.SetCounter(ctx, identifier, value)
+	})
+}
+
+func (r *RetryRepository) Ping(ctx context.Context) error {
+	return r.inner.Ping(ctx)
+}
+
+func (r *RetryRepository) Close() error {
+	return r.inner.Close()
+}
+
+// WithTransaction passes fn the wrapped repository's transaction, whose operations are not
+// retried, as a retry cannot undo the effects of an attempt on the transaction. The transaction
+// itself is retried only if OpWithTransaction is configured.
+func (r *RetryRepository) WithTransaction(ctx context.Context, fn func(tx DataRepository) error) error {
+	return r.do(ctx, OpWithTransaction, func() error {
+		return r.inner.WithTransaction(ctx, fn)
+	})
+}
+
+func (r *RetryRepository) RegisterPlugin(plugin RepositoryPlugin) error {
+	return r.inner.RegisterPlugin(plugin)
+}
+
+func (r *RetryRepository) GetPlugin(name string) (RepositoryPlugin, bool) {
+	return r.inner.GetPlugin(name)
+}
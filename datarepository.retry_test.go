@@ -0,0 +1,160 @@
+// datarepository.retry_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"testing"
+	"time"
+)
+
+// flakyRepository is a DataRepository whose Read and Create fail with ErrOperationFailed until
+// they have been called failures times, and then pass through to the embedded repository
+type flakyRepository struct {
+	DataRepository
+	failures int
+	calls    map[Operation]int
+}
+
+func newFlakyRepository(t *testing.T, failures int) *flakyRepository {
+	return &flakyRepository{
+		DataRepository: newTestMemoryRepository(t, MemoryConfig{}),
+		failures:       failures,
+		calls:          make(map[Operation]int),
+	}
+}
+
+// fail counts a call of op and returns an error for the first failures calls
+func (f *flakyRepository) fail(op Operation) error {
+	f.calls[op]++
+	if f.calls[op] <= f.failures {
+		return fmt.Errorf("%w: connection reset", ErrOperationFailed)
+	}
+	return nil
+}
+
+func (f *flakyRepository) Read(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := f.fail(OpRead); err != nil {
+		return err
+	}
+	return f.DataRepository.Read(ctx, identifier, value)
+}
+
+func (f *flakyRepository) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	if err := f.fail(OpCreate); err != nil {
+		return err
+	}
+	return f.DataRepository.Create(ctx, identifier, value)
+}
+
+func TestRetryRepositoryRetriesIdempotentOperations(t *testing.T) {
+	ctx := context.Background()
+	flaky := newFlakyRepository(t, 2)
+	repo := NewRetryRepository(flaky, RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	id := SimpleIdentifier("user:1")
+	if err := flaky.DataRepository.Create(ctx, id, "ann"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+
+	var name string
+	if err := repo.Read(ctx, id, &name); err != nil || name != "ann" {
+		t.Errorf("Read: got %q, %v, want ann after two retries", name, err)
+	}
+	if flaky.calls[OpRead] != 3 {
+		t.Errorf("Read: got %d attempts, want 3", flaky.calls[OpRead])
+	}
+
+	// Create is not idempotent, so its first failure is returned
+	if err := repo.Create(ctx, SimpleIdentifier("user:2"), "bob"); !errors.Is(err, ErrOperationFailed) {
+		t.Errorf("Create: got %v, want ErrOperationFailed", err)
+	}
+	if flaky.calls[OpCreate] != 1 {
+		t.Errorf("Create: got %d attempts, want 1", flaky.calls[OpCreate])
+	}
+}
+
+func TestRetryRepositoryGivesUp(t *testing.T) {
+	ctx := context.Background()
+	var name string
+
+	// More failures than attempts
+	flaky := newFlakyRepository(t, 5)
+	repo := NewRetryRepository(flaky, RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	if err := repo.Read(ctx, SimpleIdentifier("user:1"), &name); !errors.Is(err, ErrOperationFailed) || flaky.calls[OpRead] != 3 {
+		t.Errorf("Read: got %v after %d attempts, want ErrOperationFailed after 3", err, flaky.calls[OpRead])
+	}
+
+	// ErrNotFound is an outcome, not a transient failure
+	flaky = newFlakyRepository(t, 0)
+	repo = NewRetryRepository(flaky, RetryConfig{MaxAttempts: 3, BaseDelay: time.Millisecond})
+	if err := repo.Read(ctx, SimpleIdentifier("user:1"), &name); !errors.Is(err, ErrNotFound) || flaky.calls[OpRead] != 1 {
+		t.Errorf("Read of a missing entity: got %v after %d attempts, want ErrNotFound after 1", err, flaky.calls[OpRead])
+	}
+
+	// The next delay would pass the deadline of the context
+	flaky = newFlakyRepository(t, 5)
+	repo = NewRetryRepository(flaky, RetryConfig{MaxAttempts: 3, BaseDelay: time.Hour, MaxDelay: time.Hour})
+	deadlineCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	if err := repo.Read(deadlineCtx, SimpleIdentifier("user:1"), &name); !errors.Is(err, ErrOperationFailed) || flaky.calls[OpRead] != 1 {
+		t.Errorf("Read with a close deadline: got %v after %d attempts, want ErrOperationFailed after 1", err, flaky.calls[OpRead])
+	}
+}
+
+// redisError mimics the errors replied by a Redis server, which go-redis marks with RedisError
+type redisError string
+
+func (e redisError) Error() string { return string(e) }
+func (e redisError) RedisError()   {}
+
+func TestIsTransientError(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{"operation failed", fmt.Errorf("%w: connection reset", ErrOperationFailed), true},
+		{"network error", &net.OpError{Op: "dial", Net: "tcp", Err: errors.New("connection refused")}, true},
+		{"EOF", io.EOF, true},
+		{"moved", redisError("MOVED 3999 127.0.0.1:6381"), true},
+		{"try again", fmt.Errorf("reading: %w", redisError("TRYAGAIN multiple keys request during rehashing of slot")), true},
+		{"wrong type", redisError("WRONGTYPE Operation against a key holding the wrong kind of value"), false},
+		{"not found", ErrNotFound, false},
+		{"canceled", fmt.Errorf("%w: %w", ErrOperationFailed, context.Canceled), false},
+		{"repository closed", errRepositoryClosed, false},
+		{"nil", nil, false},
+	}
+	for _, tt := range tests {
+		if got := IsTransientError(tt.err); got != tt.want {
+			t.Errorf("%s: IsTransientError(%v) = %v, want %v", tt.name, tt.err, got, tt.want)
+		}
+	}
+}
+
+func TestRetryRepositoryRetriesUnreachableRedis(t *testing.T) {
+	ctx := context.Background()
+	inner, server := newTestRedisRepository(t, RedisConfig{})
+	repo := NewRetryRepository(inner, RetryConfig{MaxAttempts: 2, BaseDelay: time.Millisecond})
+	id := SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, "ann"); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	server.Close()
+
+	var name string
+	if err := repo.Read(ctx, id, &name); !IsTransientError(err) {
+		t.Errorf("Read with the server down: got %v, want a transient error", err)
+	}
+	if _, err := repo.GetExpiration(ctx, id); !IsTransientError(err) {
+		t.Errorf("GetExpiration with the server down: got %v, want a transient error", err)
+	}
+
+	inner.Close()
+	if err := repo.Read(ctx, id, &name); !errors.Is(err, ErrOperationFailed) || IsTransientError(err) {
+		t.Errorf("Read of a closed repository: got %v, want a permanent ErrOperationFailed", err)
+	}
+}
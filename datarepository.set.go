@@ -0,0 +1,55 @@
+// datarepository.set.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+// SetStore is implemented by repositories that store sets of distinct members under an
+// identifier, e.g. tags or followers, in addition to single values. Members are encoded with the
+// repository's codec, and members with the same encoding are the same member. A set is an entity
+// like any other: Exists, Delete and SetExpiration apply to it, and removing its last member
+// deletes it. Check for it with a type assertion, or use SetStoreOf, which also looks through
+// wrapping repositories.
+type SetStore interface {
+	// SetAdd adds the members to the set, which is created if it doesn't exist, and returns the
+	// number of members that weren't in it yet. Returns ErrInvalidInput if a member is nil or
+	// the entity holds something other than a set.
+	SetAdd(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error)
+	// SetMembers decodes the members of the set into out, which must be a pointer to a slice.
+	// The order of the members is unspecified. A missing set is empty.
+	SetMembers(ctx context.Context, identifier EntityIdentifier, out interface{}) error
+	// SetIsMember reports whether member is in the set
+	SetIsMember(ctx context.Context, identifier EntityIdentifier, member interface{}) (bool, error)
+	// SetRemove removes the members from the set and returns the number of members that were in it
+	SetRemove(ctx context.Context, identifier EntityIdentifier, members ...interface{}) (int64, error)
+}
+
+// SetStoreOf returns the SetStore of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo doesn't store sets.
+func SetStoreOf(repo DataRepository) (SetStore, bool) {
+	for {
+		switch r := repo.(type) {
+		case SetStore:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := SetStoreOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedSetStore{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// errNotASet is returned by set operations on an entity that holds something else
+var errNotASet = fmt.Errorf("%w: value is not a set", ErrInvalidInput)
+
+// errNoMembers is returned by SetAdd and SetRemove without members, which Redis rejects as well
+var errNoMembers = fmt.Errorf("%w: at least one member is required", ErrInvalidInput)
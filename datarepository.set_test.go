@@ -0,0 +1,70 @@
+// datarepository.set_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func TestSetStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		sets, ok := SetStoreOf(repo)
+		if !ok {
+			t.Fatal("SetStoreOf: the repository stores no sets")
+		}
+		id := SimpleIdentifier("tags:1")
+		if n, err := sets.SetAdd(ctx, id, "go", "redis"); err != nil || n != 2 {
+			t.Fatalf("SetAdd: got %d, %v, want 2", n, err)
+		}
+		// Only members that weren't in the set yet are counted
+		if n, err := sets.SetAdd(ctx, id, "go", "go", "cache"); err != nil || n != 1 {
+			t.Errorf("SetAdd with duplicates: got %d, %v, want 1", n, err)
+		}
+		var members []string
+		if err := sets.SetMembers(ctx, id, &members); err != nil {
+			t.Fatalf("SetMembers: %v", err)
+		}
+		sort.Strings(members)
+		if want := []string{"cache", "go", "redis"}; !reflect.DeepEqual(members, want) {
+			t.Errorf("SetMembers: got %v, want %v", members, want)
+		}
+
+		for member, want := range map[string]bool{"go": true, "cache": true, "rust": false} {
+			if got, err := sets.SetIsMember(ctx, id, member); err != nil || got != want {
+				t.Errorf("SetIsMember(%q): got %v, %v, want %v", member, got, err, want)
+			}
+		}
+		if got, err := sets.SetIsMember(ctx, SimpleIdentifier("tags:missing"), "go"); err != nil || got {
+			t.Errorf("SetIsMember of a missing set: got %v, %v, want false", got, err)
+		}
+
+		if n, err := sets.SetRemove(ctx, id, "go", "rust"); err != nil || n != 1 {
+			t.Errorf("SetRemove: got %d, %v, want 1", n, err)
+		}
+		if got, err := sets.SetIsMember(ctx, id, "go"); err != nil || got {
+			t.Errorf("SetIsMember after SetRemove: got %v, %v, want false", got, err)
+		}
+		// Removing the last member deletes the set
+		if _, err := sets.SetRemove(ctx, id, "redis", "cache"); err != nil {
+			t.Fatalf("SetRemove: %v", err)
+		}
+		if exists, err := repo.Exists(ctx, id); err != nil || exists {
+			t.Errorf("Exists of the emptied set: got %v, %v, want false", exists, err)
+		}
+
+		if _, err := sets.SetAdd(ctx, id); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("SetAdd without members: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := sets.SetAdd(ctx, SimpleIdentifier("user:1"), "go"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("SetAdd to a document: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
@@ -0,0 +1,63 @@
+// datarepository.sortedset.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+// ScoredMember is a member of a sorted set with its score
+type ScoredMember struct {
+	Member string  `json:"member"`
+	Score  float64 `json:"score"`
+}
+
+// SortedSetStore is implemented by repositories that store sorted sets under an identifier, e.g.
+// leaderboards, in addition to single values. Members are strings ordered by their score, and
+// members with the same score by their bytes, like in Redis. A sorted set is an entity like any
+// other: Exists, Delete and SetExpiration apply to it. Check for it with a type assertion, or use
+// SortedSetStoreOf, which also looks through wrapping repositories.
+type SortedSetStore interface {
+	// ZAdd adds member with score to the sorted set, which is created if it doesn't exist, or
+	// sets the score of member if it is already in it. Returns ErrInvalidInput if score is NaN
+	// or the entity holds something other than a sorted set.
+	ZAdd(ctx context.Context, identifier EntityIdentifier, member string, score float64) error
+	// ZRange returns the members from rank start to stop, both included, in ascending order of
+	// their scores. Negative ranks count from the end, -1 being the highest score, like in
+	// Redis ZRANGE. Scores are only set if withScores is true. A missing sorted set is empty.
+	ZRange(ctx context.Context, identifier EntityIdentifier, start, stop int64, withScores bool) ([]ScoredMember, error)
+	// ZRank returns the rank of member, 0 being the lowest score.
+	// Returns ErrNotFound if the sorted set or the member doesn't exist.
+	ZRank(ctx context.Context, identifier EntityIdentifier, member string) (int64, error)
+	// ZIncrBy adds delta to the score of member, which is added with score delta if it isn't in
+	// the sorted set, and returns the new score
+	ZIncrBy(ctx context.Context, identifier EntityIdentifier, member string, delta float64) (float64, error)
+}
+
+// SortedSetStoreOf returns the SortedSetStore of repo, unwrapping repositories that wrap others
+// like HookedRepository or RetryRepository. Returns false if repo doesn't store sorted sets.
+func SortedSetStoreOf(repo DataRepository) (SortedSetStore, bool) {
+	for {
+		switch r := repo.(type) {
+		case SortedSetStore:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := SortedSetStoreOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedSortedSetStore{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// errNotASortedSet is returned by sorted set operations on an entity that holds something else
+var errNotASortedSet = fmt.Errorf("%w: value is not a sorted set", ErrInvalidInput)
+
+// errNaNScore is returned for scores that are not a number, which Redis rejects as well
+var errNaNScore = fmt.Errorf("%w: score is not a number", ErrInvalidInput)
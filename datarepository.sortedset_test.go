@@ -0,0 +1,83 @@
+// datarepository.sortedset_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"math"
+	"reflect"
+	"testing"
+)
+
+func TestSortedSetStore(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		zsets, ok := SortedSetStoreOf(repo)
+		if !ok {
+			t.Fatal("SortedSetStoreOf: the repository stores no sorted sets")
+		}
+		board := SimpleIdentifier("board:1")
+		for member, score := range map[string]float64{"alice": 30, "bob": 10, "carol": 20, "dave": 20} {
+			if err := zsets.ZAdd(ctx, board, member, score); err != nil {
+				t.Fatalf("ZAdd(%s): %v", member, err)
+			}
+		}
+
+		// Members with the same score are ordered by their bytes
+		members, err := zsets.ZRange(ctx, board, 0, -1, true)
+		if err != nil {
+			t.Fatalf("ZRange: %v", err)
+		}
+		want := []ScoredMember{{"bob", 10}, {"carol", 20}, {"dave", 20}, {"alice", 30}}
+		if !reflect.DeepEqual(members, want) {
+			t.Errorf("ZRange: got %v, want %v", members, want)
+		}
+		top, err := zsets.ZRange(ctx, board, -2, -1, false)
+		if err != nil {
+			t.Fatalf("ZRange: %v", err)
+		}
+		if want := []ScoredMember{{Member: "dave"}, {Member: "alice"}}; !reflect.DeepEqual(top, want) {
+			t.Errorf("ZRange of the top two without scores: got %v, want %v", top, want)
+		}
+
+		for member, want := range map[string]int64{"bob": 0, "carol": 1, "dave": 2, "alice": 3} {
+			if rank, err := zsets.ZRank(ctx, board, member); err != nil || rank != want {
+				t.Errorf("ZRank(%s): got %d, %v, want %d", member, rank, err, want)
+			}
+		}
+		if _, err := zsets.ZRank(ctx, board, "erin"); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ZRank of a missing member: got %v, want ErrNotFound", err)
+		}
+
+		// Raising bob's score moves him to the top, and ZAdd of an existing member resets it
+		if score, err := zsets.ZIncrBy(ctx, board, "bob", 25); err != nil || score != 35 {
+			t.Errorf("ZIncrBy: got %v, %v, want 35", score, err)
+		}
+		if rank, err := zsets.ZRank(ctx, board, "bob"); err != nil || rank != 3 {
+			t.Errorf("ZRank after ZIncrBy: got %d, %v, want 3", rank, err)
+		}
+		if err := zsets.ZAdd(ctx, board, "alice", 5); err != nil {
+			t.Fatalf("ZAdd: %v", err)
+		}
+		if rank, err := zsets.ZRank(ctx, board, "alice"); err != nil || rank != 0 {
+			t.Errorf("ZRank after ZAdd of an existing member: got %d, %v, want 0", rank, err)
+		}
+		if score, err := zsets.ZIncrBy(ctx, board, "erin", 1.5); err != nil || score != 1.5 {
+			t.Errorf("ZIncrBy of a new member: got %v, %v, want 1.5", score, err)
+		}
+
+		if members, err := zsets.ZRange(ctx, SimpleIdentifier("board:missing"), 0, -1, true); err != nil || len(members) != 0 {
+			t.Errorf("ZRange of a missing sorted set: got %v, %v, want none", members, err)
+		}
+		if err := zsets.ZAdd(ctx, board, "frank", math.NaN()); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ZAdd of NaN: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := zsets.ZAdd(ctx, SimpleIdentifier("user:1"), "alice", 1); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ZAdd to a document: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
@@ -0,0 +1,101 @@
+// datarepository.typed.go
+
+package datarepository
+
+import (
+	"context"
+	"fmt"
+)
+
+// TypedRepository wraps a DataRepository and exposes its entities as values of type T,
+// so callers don't have to deal with interface{} values. It works with any backend.
+type TypedRepository[T any] struct {
+	repo  DataRepository
+	codec Codec
+}
+
+// NewTypedRepository creates a TypedRepository for entities of type T stored in repo
+func NewTypedRepository[T any](repo DataRepository) *TypedRepository[T] {
+	return &TypedRepository[T]{
+		repo:  repo,
+		codec: JSONCodec{},
+	}
+}
+
+// Repository returns the underlying DataRepository
+func (tr *TypedRepository[T]) Repository() DataRepository {
+	return tr.repo
+}
+
+// Get reads the entity with the given identifier
+func (tr *TypedRepository[T]) Get(ctx context.Context, identifier EntityIdentifier) (T, error) {
+	var value T
+	err := tr.repo.Read(ctx, identifier, &value)
+	return value, err
+}
+
+// GetMany reads the given entities in order. Missing entities are nil.
+func (tr *TypedRepository[T]) GetMany(ctx context.Context, identifiers []EntityIdentifier) ([]*T, error) {
+	var values []*T
+	if err := tr.repo.ReadManyOrdered(ctx, identifiers, &values); err != nil {
+		return nil, err
+	}
+	return values, nil
+}
+
+// Create adds a new entity
+func (tr *TypedRepository[T]) Create(ctx context.Context, identifier EntityIdentifier, value T) error {
+	return tr.repo.Create(ctx, identifier, value)
+}
+
+// Put adds a new entity or replaces an existing one
+func (tr *TypedRepository[T]) Put(ctx context.Context, identifier EntityIdentifier, value T) error {
+	return tr.repo.Upsert(ctx, identifier, value)
+}
+
+// Update replaces an existing entity
+func (tr *TypedRepository[T]) Update(ctx context.Context, identifier EntityIdentifier, value T) error {
+	return tr.repo.Update(ctx, identifier, value)
+}
+
+// Delete removes an entity
+func (tr *TypedRepository[T]) Delete(ctx context.Context, identifier EntityIdentifier) error {
+	return tr.repo.Delete(ctx, identifier)
+}
+
+// List returns the values of all entities matching the given pattern
+func (tr *TypedRepository[T]) List(ctx context.Context, pattern string) ([]T, error) {
+	_, values, err := tr.ListWithIdentifiers(ctx, pattern)
+	return values, err
+}
+
+// ListWithIdentifiers returns the identifiers and values of all entities matching the given pattern
+func (tr *TypedRepository[T]) ListWithIdentifiers(ctx context.Context, pattern string) ([]EntityIdentifier, []T, error) {
+	identifiers, raw, err := tr.repo.List(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	values := make([]T, 0, len(raw))
+	for i, item := range raw {
+		value, err := tr.convert(item)
+		if err != nil {
+			return nil, nil, fmt.Errorf("%w: failed to convert %v: %v", ErrOperationFailed, identifiers[i], err)
+		}
+		values = append(values, value)
+	}
+	return identifiers, values, nil
+}
+
+// convert turns a value returned by the underlying repository into a T
+func (tr *TypedRepository[T]) convert(item interface{}) (T, error) {
+	if value, ok := item.(T); ok {
+		return value, nil
+	}
+	var value T
+	data, err := tr.codec.Marshal(item)
+	if err != nil {
+		return value, err
+	}
+	err = tr.codec.Unmarshal(data, &value)
+	return value, err
+}
@@ -0,0 +1,62 @@
+// datarepository.typed_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+type typedTestUser struct {
+	Name  string   `json:"name"`
+	Age   int      `json:"age"`
+	Roles []string `json:"roles"`
+}
+
+func TestTypedRepository(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		users := NewTypedRepository[typedTestUser](repo)
+		ann := typedTestUser{Name: "ann", Age: 30, Roles: []string{"admin"}}
+
+		if err := users.Create(ctx, SimpleIdentifier("user:1"), ann); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := users.Put(ctx, SimpleIdentifier("user:2"), typedTestUser{Name: "bob", Age: 40}); err != nil {
+			t.Fatalf("Put: %v", err)
+		}
+		got, err := users.Get(ctx, SimpleIdentifier("user:1"))
+		if err != nil || got.Name != ann.Name || got.Age != ann.Age || len(got.Roles) != 1 || got.Roles[0] != "admin" {
+			t.Fatalf("Get: got %+v, %v, want %+v", got, err, ann)
+		}
+
+		ann.Age = 31
+		if err := users.Update(ctx, SimpleIdentifier("user:1"), ann); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+		ids, values, err := users.ListWithIdentifiers(ctx, testListPattern(repo, "user:*"))
+		if err != nil || len(values) != 2 {
+			t.Fatalf("ListWithIdentifiers: got %v, %v, want 2 values", values, err)
+		}
+		byID := make(map[string]typedTestUser)
+		for i, id := range ids {
+			byID[id.String()] = values[i]
+		}
+		if byID["user:1"].Age != 31 || byID["user:2"].Name != "bob" {
+			t.Errorf("ListWithIdentifiers: got %+v", byID)
+		}
+
+		many, err := users.GetMany(ctx, []EntityIdentifier{SimpleIdentifier("user:2"), SimpleIdentifier("user:3")})
+		if err != nil || len(many) != 2 || many[0] == nil || many[0].Name != "bob" || many[1] != nil {
+			t.Errorf("GetMany: got %v, %v, want bob and nil", many, err)
+		}
+
+		if err := users.Delete(ctx, SimpleIdentifier("user:1")); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+		if _, err := users.Get(ctx, SimpleIdentifier("user:1")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Get after Delete: got %v, want ErrNotFound", err)
+		}
+	})
+}
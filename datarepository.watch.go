@@ -0,0 +1,53 @@
+// datarepository.watch.go
+
+package datarepository
+
+import "context"
+
+// KeyWatcher is implemented by repositories that stream the values of single entities, e.g. to
+// push changes to clients in real time. Check for it with a type assertion, or use
+// KeyWatcherOf, which also looks through wrapping repositories.
+type KeyWatcher interface {
+	// Watch returns a channel that receives the encoded value of the entity each time it is
+	// created or changed, and nil each time it is deleted, expires or is evicted. While the
+	// channel is full the oldest value is dropped, so the latest value is always delivered.
+	// The channel is closed when ctx is done or the repository is closed.
+	Watch(ctx context.Context, identifier EntityIdentifier) (chan []byte, error)
+}
+
+// KeyWatcherOf returns the KeyWatcher of repo, unwrapping repositories that wrap others like
+// HookedRepository or RetryRepository. Returns false if repo can't watch entities.
+func KeyWatcherOf(repo DataRepository) (KeyWatcher, bool) {
+	for {
+		switch r := repo.(type) {
+		case KeyWatcher:
+			return r, true
+		case *RestrictedRepository:
+			inner, ok := KeyWatcherOf(r.inner)
+			if !ok {
+				return nil, false
+			}
+			return &restrictedKeyWatcher{r: r, inner: inner}, true
+		case interface{ Unwrap() DataRepository }:
+			repo = r.Unwrap()
+		default:
+			return nil, false
+		}
+	}
+}
+
+// sendLatest sends value to ch, dropping the oldest value while ch is full. ch must have a
+// single sender.
+func sendLatest(ch chan []byte, value []byte) {
+	for {
+		select {
+		case ch <- value:
+			return
+		default:
+		}
+		select {
+		case <-ch:
+		default:
+		}
+	}
+}
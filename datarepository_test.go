@@ -0,0 +1,1649 @@
+// datarepository_test.go
+
+package datarepository
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/alicebob/miniredis/v2"
+)
+
+// newTestMemoryRepository returns a MemoryRepository that is closed when the test ends
+func newTestMemoryRepository(t *testing.T, config MemoryConfig) *MemoryRepository {
+	t.Helper()
+	repo, err := NewMemoryRepository(config)
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo.(*MemoryRepository)
+}
+
+// newTestRedisRepository returns a RedisRepository on a miniredis server that is closed when the
+// test ends. KeyPrefix and KeySeparator default to "app" and ":", and as miniredis lacks the
+// RedisJSON module, StorageMode defaults to RedisStorageString.
+func newTestRedisRepository(t *testing.T, config RedisConfig) (*RedisRepository, *miniredis.Miniredis) {
+	t.Helper()
+	server := miniredis.RunT(t)
+	return newTestRedisRepositoryOn(t, server, config), server
+}
+
+// newTestRedisRepositoryOn works like newTestRedisRepository but uses an existing server, e.g. to
+// run several repositories on the same keyspace
+func newTestRedisRepositoryOn(t *testing.T, server *miniredis.Miniredis, config RedisConfig) *RedisRepository {
+	t.Helper()
+	config.Addrs = []string{server.Addr()}
+	if config.KeyPrefix == "" {
+		config.KeyPrefix = "app"
+	}
+	if config.KeySeparator == "" {
+		config.KeySeparator = ":"
+	}
+	if config.StorageMode == "" {
+		config.StorageMode = RedisStorageString
+	}
+	repo, err := NewRedisRepository(config)
+	if err != nil {
+		t.Fatalf("NewRedisRepository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo.(*RedisRepository)
+}
+
+// forEachBackend runs test as a subtest against a MemoryRepository and a RedisRepository on
+// miniredis. SimpleIdentifiers like "user:1" address the same entity on both.
+func forEachBackend(t *testing.T, test func(t *testing.T, repo DataRepository)) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestMemoryRepository(t, MemoryConfig{}))
+	})
+	t.Run("redis", func(t *testing.T) {
+		repo, _ := newTestRedisRepository(t, RedisConfig{})
+		test(t, repo)
+	})
+}
+
+// forEachBackendWithClock works like forEachBackend but also passes advance, which lets d pass
+// for the TTLs of repo: the memory subtest sleeps, the Redis one fast-forwards miniredis
+func forEachBackendWithClock(t *testing.T, test func(t *testing.T, repo DataRepository, advance func(d time.Duration))) {
+	t.Run("memory", func(t *testing.T) {
+		test(t, newTestMemoryRepository(t, MemoryConfig{}), time.Sleep)
+	})
+	t.Run("redis", func(t *testing.T) {
+		repo, server := newTestRedisRepository(t, RedisConfig{})
+		test(t, repo, server.FastForward)
+	})
+}
+
+// testListPattern returns the pattern List, ListPaged and ListPage of repo take for pattern,
+// which for Redis includes the key prefix of newTestRedisRepository
+func testListPattern(repo DataRepository, pattern string) string {
+	if _, ok := repo.(*RedisRepository); ok {
+		return "app:" + pattern
+	}
+	return pattern
+}
+
+// receiveMessage returns the next message of sub, failing the test if none arrives in time
+func receiveMessage(t *testing.T, sub Subscription) Message {
+	t.Helper()
+	select {
+	case message, ok := <-sub.Messages():
+		if !ok {
+			t.Fatal("subscription closed before a message arrived")
+		}
+		return message
+	case <-time.After(2 * time.Second):
+		t.Fatal("timed out waiting for a message")
+		return Message{}
+	}
+}
+
+// waitForSubscribers waits until channel, a full channel name, has n subscribers on the
+// server of repo
+func waitForSubscribers(t *testing.T, repo *RedisRepository, channel string, n int64) {
+	t.Helper()
+	for deadline := time.Now().Add(2 * time.Second); ; time.Sleep(time.Millisecond) {
+		counts, err := repo.client.PubSubNumSub(context.Background(), channel).Result()
+		if err != nil {
+			t.Fatalf("PUBSUB NUMSUB: %v", err)
+		}
+		if counts[channel] >= n {
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("subscribers of %s: got %d, want %d", channel, counts[channel], n)
+		}
+	}
+}
+
+// identifierStrings returns the String of each identifier
+func identifierStrings(identifiers []EntityIdentifier) []string {
+	result := make([]string, len(identifiers))
+	for i, identifier := range identifiers {
+		result[i] = identifier.String()
+	}
+	return result
+}
+
+func TestUpdateWithVersionRejectsStaleWriter(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("user:1")
+		if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		// Both writers read version 0, then write one after the other
+		first, err := repo.GetVersion(ctx, id)
+		if err != nil {
+			t.Fatalf("GetVersion: %v", err)
+		}
+		second := first
+		version, err := repo.UpdateWithVersion(ctx, id, map[string]int{"a": 2}, first)
+		if err != nil || version != first+1 {
+			t.Fatalf("UpdateWithVersion of the first writer: got %d, %v, want %d, nil", version, err, first+1)
+		}
+		if _, err := repo.UpdateWithVersion(ctx, id, map[string]int{"a": 3}, second); !errors.Is(err, ErrVersionConflict) {
+			t.Fatalf("UpdateWithVersion of the stale writer: got %v, want ErrVersionConflict", err)
+		}
+
+		var value map[string]int
+		if err := repo.Read(ctx, id, &value); err != nil || value["a"] != 2 {
+			t.Errorf("Read: got %v, %v, want the first writer's value", value, err)
+		}
+		if got, _ := repo.GetVersion(ctx, id); got != first+1 {
+			t.Errorf("GetVersion: got %d, want %d", got, first+1)
+		}
+		if _, err := repo.UpdateWithVersion(ctx, SimpleIdentifier("user:2"), 1, 0); !errors.Is(err, ErrNotFound) {
+			t.Errorf("UpdateWithVersion of a missing entity: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestVersionFollowsExpiration(t *testing.T) {
+	forEachBackendWithClock(t, func(t *testing.T, repo DataRepository, advance func(d time.Duration)) {
+		testVersionFollowsExpiration(t, repo, repo, advance)
+	})
+	t.Run("redis transaction", func(t *testing.T) {
+		repo, server := newTestRedisRepository(t, RedisConfig{})
+		testVersionFollowsExpiration(t, repo, transactionalWriter{repo}, server.FastForward)
+	})
+}
+
+// transactionalWriter runs the expiration changes of testVersionFollowsExpiration in transactions
+type transactionalWriter struct {
+	*RedisRepository
+}
+
+func (w transactionalWriter) Create(ctx context.Context, identifier EntityIdentifier, value interface{}) error {
+	return w.WithTransaction(ctx, func(tx DataRepository) error { return tx.Create(ctx, identifier, value) })
+}
+
+func (w transactionalWriter) CreateWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return w.WithTransaction(ctx, func(tx DataRepository) error { return tx.CreateWithTTL(ctx, identifier, value, ttl) })
+}
+
+func (w transactionalWriter) UpsertWithTTL(ctx context.Context, identifier EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return w.WithTransaction(ctx, func(tx DataRepository) error { return tx.UpsertWithTTL(ctx, identifier, value, ttl) })
+}
+
+func (w transactionalWriter) SetExpiration(ctx context.Context, identifier EntityIdentifier, expiration time.Duration) error {
+	return w.WithTransaction(ctx, func(tx DataRepository) error { return tx.SetExpiration(ctx, identifier, expiration) })
+}
+
+func (w transactionalWriter) Persist(ctx context.Context, identifier EntityIdentifier) error {
+	return w.WithTransaction(ctx, func(tx DataRepository) error { return tx.Persist(ctx, identifier) })
+}
+
+// testVersionFollowsExpiration changes the expiration of versioned entities through writer and
+// checks with repo that each version lives exactly as long as its entity
+func testVersionFollowsExpiration(t *testing.T, repo, writer DataRepository, advance func(d time.Duration)) {
+	ctx := context.Background()
+	value := map[string]int{"a": 1}
+
+	// A version must not expire before an entity that was made persistent
+	kept := SimpleIdentifier("user:kept")
+	if err := writer.CreateWithTTL(ctx, kept, value, 100*time.Millisecond); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if version, err := repo.UpdateWithVersion(ctx, kept, value, 0); err != nil || version != 1 {
+		t.Fatalf("UpdateWithVersion: got %d, %v, want 1", version, err)
+	}
+	if err := writer.Persist(ctx, kept); err != nil {
+		t.Fatalf("Persist: %v", err)
+	}
+
+	// Nor must it outlive an entity whose expiration was set or shortened afterwards
+	for name, expire := range map[string]func(id EntityIdentifier) error{
+		"SetExpiration": func(id EntityIdentifier) error { return writer.SetExpiration(ctx, id, 100*time.Millisecond) },
+		"UpsertWithTTL": func(id EntityIdentifier) error { return writer.UpsertWithTTL(ctx, id, value, 100*time.Millisecond) },
+	} {
+		id := SimpleIdentifier("user:" + name)
+		if err := writer.Create(ctx, id, value); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := repo.UpdateWithVersion(ctx, id, value, 0); err != nil {
+			t.Fatalf("UpdateWithVersion: %v", err)
+		}
+		if err := expire(id); err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+	}
+
+	advance(200 * time.Millisecond)
+	if version, err := repo.GetVersion(ctx, kept); err != nil || version != 1 {
+		t.Errorf("GetVersion after Persist: got %d, %v, want 1", version, err)
+	}
+	if _, err := repo.UpdateWithVersion(ctx, kept, value, 0); !errors.Is(err, ErrVersionConflict) {
+		t.Errorf("UpdateWithVersion of a stale writer after Persist: got %v, want ErrVersionConflict", err)
+	}
+	for _, name := range []string{"SetExpiration", "UpsertWithTTL"} {
+		id := SimpleIdentifier("user:" + name)
+		if exists, err := repo.Exists(ctx, id); err != nil || exists {
+			t.Fatalf("Exists after %s: got %v, %v, want the entity expired", name, exists, err)
+		}
+		if err := writer.Create(ctx, id, value); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if version, err := repo.GetVersion(ctx, id); err != nil || version != 0 {
+			t.Errorf("GetVersion of an entity recreated after %s: got %d, %v, want 0", name, version, err)
+		}
+	}
+}
+
+func TestListSkipsVersionAndLockKeys(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("user:1")
+		if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := repo.UpdateWithVersion(ctx, id, map[string]int{"a": 2}, 0); err != nil {
+			t.Fatalf("UpdateWithVersion: %v", err)
+		}
+		if ok, err := repo.AcquireLock(ctx, id, time.Minute); err != nil || !ok {
+			t.Fatalf("AcquireLock: got %v, %v", ok, err)
+		}
+
+		identifiers, values, err := repo.List(ctx, testListPattern(repo, "user:*"))
+		if err != nil {
+			t.Fatalf("List: %v", err)
+		}
+		if got := identifierStrings(identifiers); len(got) != 1 || got[0] != "user:1" {
+			t.Errorf("List identifiers: got %v, want [user:1]", got)
+		}
+		if len(values) != 1 {
+			t.Errorf("List values: got %v, want one value", values)
+		}
+
+		var iterated []string
+		err = repo.Iterate(ctx, SimpleIdentifier("user:*"), func(identifier EntityIdentifier, raw []byte) error {
+			iterated = append(iterated, identifier.String())
+			return nil
+		})
+		if err != nil {
+			t.Fatalf("Iterate: %v", err)
+		}
+		if len(iterated) != 1 || iterated[0] != "user:1" {
+			t.Errorf("Iterate: got %v, want [user:1]", iterated)
+		}
+
+		page, _, err := repo.ListPage(ctx, testListPattern(repo, "user:*"), "", 100)
+		if err != nil {
+			t.Fatalf("ListPage: %v", err)
+		}
+		if got := identifierStrings(page); len(got) != 1 || got[0] != "user:1" {
+			t.Errorf("ListPage: got %v, want [user:1]", got)
+		}
+	})
+}
+
+func TestCountMatchesPatterns(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		for i := 0; i < 300; i++ {
+			if err := repo.Create(ctx, SimpleIdentifier(fmt.Sprintf("user:%d", i)), i); err != nil {
+				t.Fatalf("Create user %d: %v", i, err)
+			}
+		}
+		for i := 0; i < 50; i++ {
+			if err := repo.Create(ctx, SimpleIdentifier(fmt.Sprintf("order:%d", i)), i); err != nil {
+				t.Fatalf("Create order %d: %v", i, err)
+			}
+		}
+		// Neither the lock nor the version of an entity is an entity
+		if ok, err := repo.AcquireLock(ctx, SimpleIdentifier("user:1"), time.Minute); err != nil || !ok {
+			t.Fatalf("AcquireLock: got %v, %v", ok, err)
+		}
+		if _, err := repo.UpdateWithVersion(ctx, SimpleIdentifier("user:1"), 1, 0); err != nil {
+			t.Fatalf("UpdateWithVersion: %v", err)
+		}
+
+		for pattern, want := range map[string]int64{
+			"user:*":  300,
+			"order:*": 50,
+			"user:1?": 10,
+			"user:2*": 111,
+			"*:4?":    20,
+			"team:*":  0,
+		} {
+			got, err := repo.Count(ctx, SimpleIdentifier(pattern))
+			if err != nil {
+				t.Errorf("Count(%q): %v", pattern, err)
+			} else if got != want {
+				t.Errorf("Count(%q): got %d, want %d", pattern, got, want)
+			}
+		}
+	})
+}
+
+func TestReadWithTTL(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		if err := repo.CreateWithTTL(ctx, SimpleIdentifier("session:1"), map[string]string{"user": "alice"}, time.Minute); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "alice"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		var session map[string]string
+		ttl, err := repo.ReadWithTTL(ctx, SimpleIdentifier("session:1"), &session)
+		if err != nil {
+			t.Fatalf("ReadWithTTL with a TTL: %v", err)
+		}
+		if ttl <= 0 || ttl > time.Minute {
+			t.Errorf("ReadWithTTL with a TTL: got TTL %v, want within (0, 1m]", ttl)
+		}
+		if session["user"] != "alice" {
+			t.Errorf("ReadWithTTL with a TTL: got value %v", session)
+		}
+
+		var user map[string]string
+		ttl, err = repo.ReadWithTTL(ctx, SimpleIdentifier("user:1"), &user)
+		if err != nil {
+			t.Fatalf("ReadWithTTL without a TTL: %v", err)
+		}
+		if ttl != NoExpiration {
+			t.Errorf("ReadWithTTL without a TTL: got TTL %v, want NoExpiration", ttl)
+		}
+		if user["name"] != "alice" {
+			t.Errorf("ReadWithTTL without a TTL: got value %v", user)
+		}
+
+		if _, err := repo.ReadWithTTL(ctx, SimpleIdentifier("user:2"), &user); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ReadWithTTL of a missing entity: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestEntityPrefixes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		if prefixes, err := repo.EntityPrefixes(ctx); err != nil || len(prefixes) != 0 {
+			t.Fatalf("EntityPrefixes of an empty repository: got %v, %v, want none", prefixes, err)
+		}
+		for _, id := range []string{"user:1", "user:2", "order:1", "team:1"} {
+			if err := repo.Create(ctx, SimpleIdentifier(id), map[string]int{"a": 1}); err != nil {
+				t.Fatalf("Create %s: %v", id, err)
+			}
+		}
+		// Locks, versions and channels must not show up as entity prefixes
+		if _, err := repo.UpdateWithVersion(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 2}, 0); err != nil {
+			t.Fatalf("UpdateWithVersion: %v", err)
+		}
+		if _, err := repo.AcquireLock(ctx, SimpleIdentifier("job:1"), time.Minute); err != nil {
+			t.Fatalf("AcquireLock: %v", err)
+		}
+		if err := repo.Publish(ctx, "events", "x"); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		if err := repo.Delete(ctx, SimpleIdentifier("team:1")); err != nil {
+			t.Fatalf("Delete: %v", err)
+		}
+
+		prefixes, err := repo.EntityPrefixes(ctx)
+		if err != nil {
+			t.Fatalf("EntityPrefixes: %v", err)
+		}
+		if fmt.Sprint(prefixes) != "[order user]" {
+			t.Errorf("EntityPrefixes: got %v, want [order user]", prefixes)
+		}
+	})
+}
+
+func TestListPrefixes(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		for _, id := range []string{"user:1", "order:1", "order:2", "team:1"} {
+			if err := repo.Create(ctx, SimpleIdentifier(id), map[string]int{"a": 1}); err != nil {
+				t.Fatalf("Create %s: %v", id, err)
+			}
+		}
+		prefixes, err := repo.ListPrefixes(ctx)
+		if err != nil {
+			t.Fatalf("ListPrefixes: %v", err)
+		}
+		if fmt.Sprint(prefixes) != "[order team user]" {
+			t.Errorf("ListPrefixes: got %v, want [order team user]", prefixes)
+		}
+	})
+}
+
+func TestLockOwnerToken(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("job:1")
+		token, acquired, err := repo.AcquireLockWithToken(ctx, id, time.Minute)
+		if err != nil || !acquired || token == "" {
+			t.Fatalf("AcquireLockWithToken: got %q, %v, %v, want a token", token, acquired, err)
+		}
+		if other, acquired, err := repo.AcquireLockWithToken(ctx, id, time.Minute); err != nil || acquired || other != "" {
+			t.Fatalf("AcquireLockWithToken of a held lock: got %q, %v, %v, want no token", other, acquired, err)
+		}
+
+		if err := repo.ReleaseLockWithToken(ctx, id, token+"x"); !errors.Is(err, ErrLockNotOwned) {
+			t.Errorf("ReleaseLockWithToken with another token: got %v, want ErrLockNotOwned", err)
+		}
+		if err := repo.ReleaseLockWithToken(ctx, id, token); err != nil {
+			t.Fatalf("ReleaseLockWithToken: %v", err)
+		}
+		if err := repo.ReleaseLockWithToken(ctx, id, token); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ReleaseLockWithToken of a released lock: got %v, want ErrNotFound", err)
+		}
+
+		next, acquired, err := repo.AcquireLockWithToken(ctx, id, time.Minute)
+		if err != nil || !acquired || next == token {
+			t.Fatalf("AcquireLockWithToken after release: got %q, %v, %v, want a new token", next, acquired, err)
+		}
+		if err := repo.ReleaseLock(ctx, id); err != nil {
+			t.Errorf("ReleaseLock: %v", err)
+		}
+		if err := repo.ReleaseLock(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("ReleaseLock of a released lock: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestRenewLock(t *testing.T) {
+	forEachBackendWithClock(t, func(t *testing.T, repo DataRepository, advance func(time.Duration)) {
+		ctx := context.Background()
+		id := SimpleIdentifier("job:1")
+		const ttl = 150 * time.Millisecond
+		token, acquired, err := repo.AcquireLockWithToken(ctx, id, ttl)
+		if err != nil || !acquired {
+			t.Fatalf("AcquireLockWithToken: got %v, %v", acquired, err)
+		}
+		if renewed, err := repo.RenewLock(ctx, id, token+"x", ttl); err != nil || renewed {
+			t.Errorf("RenewLock with another token: got %v, %v, want false", renewed, err)
+		}
+
+		// Each renewal keeps the lock beyond its previous expiration
+		for i := 0; i < 2; i++ {
+			advance(ttl * 2 / 3)
+			if renewed, err := repo.RenewLock(ctx, id, token, ttl); err != nil || !renewed {
+				t.Fatalf("renewal %d: got %v, %v, want true", i+1, renewed, err)
+			}
+		}
+		advance(ttl * 2 / 3)
+		if _, acquired, _ := repo.AcquireLockWithToken(ctx, id, ttl); acquired {
+			t.Fatal("acquired the lock while it was renewed")
+		}
+
+		advance(ttl)
+		if renewed, err := repo.RenewLock(ctx, id, token, ttl); err != nil || renewed {
+			t.Errorf("RenewLock of an expired lock: got %v, %v, want false", renewed, err)
+		}
+		if _, acquired, err := repo.AcquireLockWithToken(ctx, id, ttl); err != nil || !acquired {
+			t.Errorf("AcquireLockWithToken of an expired lock: got %v, %v, want true", acquired, err)
+		}
+	})
+}
+
+func TestNotFoundOnEmpty(t *testing.T) {
+	ctx := context.Background()
+	memory := newTestMemoryRepository(t, MemoryConfig{NotFoundOnEmpty: true})
+	redisRepo, _ := newTestRedisRepository(t, RedisConfig{NotFoundOnEmpty: true})
+	for name, repo := range map[string]DataRepository{"memory": memory, "redis": redisRepo} {
+		t.Run(name, func(t *testing.T) {
+			if _, _, err := repo.List(ctx, testListPattern(repo, "user:*")); !errors.Is(err, ErrNotFound) {
+				t.Errorf("List matching nothing: got %v, want ErrNotFound", err)
+			}
+			if _, err := repo.ListDetailed(ctx, testListPattern(repo, "user:*")); !errors.Is(err, ErrNotFound) {
+				t.Errorf("ListDetailed matching nothing: got %v, want ErrNotFound", err)
+			}
+			if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if ids, _, err := repo.List(ctx, testListPattern(repo, "user:*")); err != nil || len(ids) != 1 {
+				t.Errorf("List: got %v, %v, want user:1", ids, err)
+			}
+		})
+	}
+
+	// Search only runs on memory, as miniredis lacks RediSearch
+	if _, err := memory.Search(ctx, "nothing matches this", 0, 10, "", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Search matching nothing: got %v, want ErrNotFound", err)
+	}
+	if _, err := memory.SearchDetailed(ctx, "nothing matches this", 0, 10, "", ""); !errors.Is(err, ErrNotFound) {
+		t.Errorf("SearchDetailed matching nothing: got %v, want ErrNotFound", err)
+	}
+
+	// Empty slices remain the default
+	t.Run("default", func(t *testing.T) {
+		forEachBackend(t, func(t *testing.T, repo DataRepository) {
+			ids, values, err := repo.List(ctx, testListPattern(repo, "user:*"))
+			if err != nil || len(ids) != 0 || len(values) != 0 {
+				t.Errorf("List matching nothing: got %v, %v, %v, want no entities and no error", ids, values, err)
+			}
+			if _, ok := repo.(*MemoryRepository); ok {
+				if ids, err := repo.Search(ctx, "x", 0, 10, "", ""); err != nil || len(ids) != 0 {
+					t.Errorf("Search matching nothing: got %v, %v, want no entities and no error", ids, err)
+				}
+			}
+		})
+	})
+}
+
+func TestSetExpirationCond(t *testing.T) {
+	for _, tc := range []struct {
+		name    string
+		initial time.Duration // 0 for none
+		cond    ExpirationCondition
+		ttl     time.Duration
+		applied bool
+	}{
+		{"NX without TTL", 0, ExpireNX, time.Hour, true},
+		{"NX with TTL", time.Hour, ExpireNX, 2 * time.Hour, false},
+		{"XX without TTL", 0, ExpireXX, time.Hour, false},
+		{"XX with TTL", time.Hour, ExpireXX, 2 * time.Hour, true},
+		{"GT without TTL", 0, ExpireGT, time.Hour, false},
+		{"GT greater", time.Hour, ExpireGT, 2 * time.Hour, true},
+		{"GT smaller", 2 * time.Hour, ExpireGT, time.Hour, false},
+		{"LT without TTL", 0, ExpireLT, time.Hour, true},
+		{"LT smaller", 2 * time.Hour, ExpireLT, time.Hour, true},
+		{"LT greater", time.Hour, ExpireLT, 2 * time.Hour, false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			forEachBackend(t, func(t *testing.T, repo DataRepository) {
+				ctx := context.Background()
+				id := SimpleIdentifier("user:1")
+				if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+					t.Fatalf("Create: %v", err)
+				}
+				if tc.initial > 0 {
+					if err := repo.SetExpiration(ctx, id, tc.initial); err != nil {
+						t.Fatalf("SetExpiration: %v", err)
+					}
+				}
+
+				applied, err := repo.SetExpirationCond(ctx, id, tc.ttl, tc.cond)
+				if err != nil || applied != tc.applied {
+					t.Fatalf("SetExpirationCond: got %v, %v, want %v", applied, err, tc.applied)
+				}
+				want := tc.initial
+				if tc.applied {
+					want = tc.ttl
+				}
+				got, err := repo.GetExpiration(ctx, id)
+				if want == 0 {
+					if !errors.Is(err, ErrNotFound) {
+						t.Errorf("GetExpiration: got %v, %v, want no expiration", got, err)
+					}
+				} else if err != nil || got <= want-time.Minute || got > want {
+					t.Errorf("GetExpiration: got %v, %v, want about %v", got, err, want)
+				}
+			})
+		})
+	}
+
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		if _, err := repo.SetExpirationCond(ctx, SimpleIdentifier("user:1"), time.Hour, "ZZ"); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("SetExpirationCond with an unknown condition: got %v, want ErrInvalidInput", err)
+		}
+		if applied, err := repo.SetExpirationCond(ctx, SimpleIdentifier("user:404"), time.Hour, ExpireNX); err != nil && !errors.Is(err, ErrNotFound) || applied {
+			t.Errorf("SetExpirationCond of a missing entity: got %v, %v, want false", applied, err)
+		}
+	})
+}
+
+func TestWritesToExpiredEntities(t *testing.T) {
+	forEachBackendWithClock(t, func(t *testing.T, repo DataRepository, advance func(d time.Duration)) {
+		ctx := context.Background()
+		value := map[string]int{"a": 1}
+		writes := map[string]struct {
+			write func(id EntityIdentifier) error
+			// wantErr is the error of the write, and exists whether the entity exists afterwards
+			wantErr error
+			exists  bool
+		}{
+			"Create": {func(id EntityIdentifier) error { return repo.Create(ctx, id, value) }, nil, true},
+			"CreateMany": {func(id EntityIdentifier) error {
+				return repo.CreateMany(ctx, map[EntityIdentifier]interface{}{id: value})
+			}, nil, true},
+			"Upsert":        {func(id EntityIdentifier) error { return repo.Upsert(ctx, id, value) }, nil, true},
+			"UpsertWithTTL": {func(id EntityIdentifier) error { return repo.UpsertWithTTL(ctx, id, value, time.Hour) }, nil, true},
+			"Update":        {func(id EntityIdentifier) error { return repo.Update(ctx, id, value) }, ErrNotFound, false},
+			"Delete":        {func(id EntityIdentifier) error { return repo.Delete(ctx, id) }, ErrNotFound, false},
+		}
+		for name := range writes {
+			id := SimpleIdentifier("user:" + name)
+			if err := repo.CreateWithTTL(ctx, id, value, 100*time.Millisecond); err != nil {
+				t.Fatalf("CreateWithTTL: %v", err)
+			}
+			if _, err := repo.UpdateWithVersion(ctx, id, value, 0); err != nil {
+				t.Fatalf("UpdateWithVersion: %v", err)
+			}
+		}
+
+		// The memory repository hasn't swept the expired entities yet, which must not show
+		advance(200 * time.Millisecond)
+		for name, tc := range writes {
+			id := SimpleIdentifier("user:" + name)
+			if err := tc.write(id); !errors.Is(err, tc.wantErr) {
+				t.Errorf("%s of an expired entity: got %v, want %v", name, err, tc.wantErr)
+			}
+		}
+		// A write that recreated the entity must not have kept the old expiration or version
+		advance(200 * time.Millisecond)
+		for name, tc := range writes {
+			id := SimpleIdentifier("user:" + name)
+			var got map[string]int
+			if err := repo.Read(ctx, id, &got); tc.exists && err != nil {
+				t.Errorf("Read after %s: %v", name, err)
+			} else if !tc.exists && !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read after %s: got %v, want ErrNotFound", name, err)
+			}
+			if !tc.exists {
+				continue
+			}
+			if version, err := repo.GetVersion(ctx, id); err != nil || version != 0 {
+				t.Errorf("GetVersion after %s: got %d, %v, want 0", name, version, err)
+			}
+		}
+	})
+}
+
+func TestPersistAndTouch(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("session:1")
+		if err := repo.CreateWithTTL(ctx, id, map[string]string{"user": "ann"}, time.Minute); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+		if err := repo.Touch(ctx, id); err != nil {
+			t.Errorf("Touch: %v", err)
+		}
+		if remaining, err := repo.GetExpiration(ctx, id); err != nil || remaining <= 0 {
+			t.Errorf("GetExpiration after Touch: got %v, %v, want the expiration unchanged", remaining, err)
+		}
+
+		if err := repo.Persist(ctx, id); err != nil {
+			t.Fatalf("Persist: %v", err)
+		}
+		if _, err := repo.GetExpiration(ctx, id); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetExpiration after Persist: got %v, want ErrNotFound for no expiration", err)
+		}
+		var value map[string]string
+		if ttl, err := repo.ReadWithTTL(ctx, id, &value); err != nil || ttl != NoExpiration || value["user"] != "ann" {
+			t.Errorf("ReadWithTTL after Persist: got %v, %v, %v, want the value without expiration", value, ttl, err)
+		}
+		if err := repo.Persist(ctx, id); err != nil {
+			t.Errorf("Persist of an entity without expiration: %v", err)
+		}
+
+		missing := SimpleIdentifier("session:404")
+		if err := repo.Persist(ctx, missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Persist of a missing entity: got %v, want ErrNotFound", err)
+		}
+		if err := repo.Touch(ctx, missing); !errors.Is(err, ErrNotFound) {
+			t.Errorf("Touch of a missing entity: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestExists(t *testing.T) {
+	forEachBackendWithClock(t, func(t *testing.T, repo DataRepository, advance func(time.Duration)) {
+		ctx := context.Background()
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.CreateWithTTL(ctx, SimpleIdentifier("user:2"), map[string]int{"a": 2}, 50*time.Millisecond); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+		for id, want := range map[string]bool{"user:1": true, "user:2": true, "user:3": false} {
+			if exists, err := repo.Exists(ctx, SimpleIdentifier(id)); err != nil || exists != want {
+				t.Errorf("Exists(%s): got %v, %v, want %v", id, exists, err, want)
+			}
+		}
+
+		advance(100 * time.Millisecond)
+		memory, _ := repo.(*MemoryRepository)
+		stored := func() bool {
+			memory.mu.RLock()
+			defer memory.mu.RUnlock()
+			_, ok := memory.data["user:2"]
+			return ok
+		}
+		if memory != nil && !stored() {
+			t.Fatal("the expired entity was reaped before Exists")
+		}
+		if exists, err := repo.Exists(ctx, SimpleIdentifier("user:2")); err != nil || exists {
+			t.Errorf("Exists of an expired entity: got %v, %v, want false", exists, err)
+		}
+		if memory != nil && stored() {
+			t.Error("Exists left the expired entity in place")
+		}
+		if exists, err := repo.Exists(ctx, SimpleIdentifier("user:1")); err != nil || !exists {
+			t.Errorf("Exists(user:1): got %v, %v, want true", exists, err)
+		}
+	})
+}
+
+func TestExistsMany(t *testing.T) {
+	forEachBackendWithClock(t, func(t *testing.T, repo DataRepository, advance func(time.Duration)) {
+		ctx := context.Background()
+		present, expired, absent := SimpleIdentifier("user:1"), SimpleIdentifier("user:2"), SimpleIdentifier("user:3")
+		if err := repo.Create(ctx, present, map[string]int{"a": 1}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if err := repo.CreateWithTTL(ctx, expired, map[string]int{"a": 2}, 50*time.Millisecond); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+		advance(100 * time.Millisecond)
+
+		got, err := repo.ExistsMany(ctx, []EntityIdentifier{present, expired, absent, present})
+		want := map[EntityIdentifier]bool{present: true, expired: false, absent: false}
+		if err != nil || !reflect.DeepEqual(got, want) {
+			t.Errorf("ExistsMany: got %v, %v, want %v", got, err, want)
+		}
+		if got, err := repo.ExistsMany(ctx, nil); err != nil || len(got) != 0 {
+			t.Errorf("ExistsMany without identifiers: got %v, %v, want an empty result", got, err)
+		}
+	})
+}
+
+func TestDeletePattern(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		for _, id := range []string{"tenant:a:1", "tenant:a:2", "tenant:a:3", "tenant:b:1", "user:1"} {
+			if err := repo.Create(ctx, SimpleIdentifier(id), map[string]string{"id": id}); err != nil {
+				t.Fatalf("Create %s: %v", id, err)
+			}
+		}
+		// The version of a deleted entity goes with it
+		if _, err := repo.UpdateWithVersion(ctx, SimpleIdentifier("tenant:a:1"), map[string]string{"id": "tenant:a:1"}, 0); err != nil {
+			t.Fatalf("UpdateWithVersion: %v", err)
+		}
+
+		if n, err := repo.DeletePattern(ctx, SimpleIdentifier("tenant:a:*")); err != nil || n != 3 {
+			t.Errorf("DeletePattern: got %d, %v, want 3", n, err)
+		}
+		for id, want := range map[string]bool{"tenant:a:1": false, "tenant:a:3": false, "tenant:b:1": true, "user:1": true} {
+			if exists, err := repo.Exists(ctx, SimpleIdentifier(id)); err != nil || exists != want {
+				t.Errorf("Exists(%s): got %v, %v, want %v", id, exists, err, want)
+			}
+		}
+		if version, err := repo.GetVersion(ctx, SimpleIdentifier("tenant:a:1")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetVersion of a deleted entity: got %d, %v, want ErrNotFound", version, err)
+		}
+		if n, err := repo.DeletePattern(ctx, SimpleIdentifier("tenant:a:*")); err != nil || n != 0 {
+			t.Errorf("DeletePattern without matches: got %d, %v, want 0", n, err)
+		}
+
+		// Patterns that could match beyond one entity prefix are rejected
+		for _, pattern := range []string{"*", "*:1", "ten*:a:1", ""} {
+			if _, err := repo.DeletePattern(ctx, SimpleIdentifier(pattern)); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("DeletePattern(%q): got %v, want ErrInvalidInput", pattern, err)
+			}
+		}
+		if n, _ := repo.Count(ctx, SimpleIdentifier("*")); n != 2 {
+			t.Errorf("Count after the rejected patterns: got %d, want 2", n)
+		}
+	})
+}
+
+func TestPSubscribe(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		sub, err := repo.PSubscribe(ctx, "events:user:*")
+		if err != nil {
+			t.Fatalf("PSubscribe: %v", err)
+		}
+		for _, channel := range []string{"events:user:1", "events:order:1", "events:user:2"} {
+			if err := repo.Publish(ctx, channel, "to "+channel); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+		}
+
+		for _, want := range []string{"events:user:1", "events:user:2"} {
+			message := receiveMessage(t, sub)
+			if message.Channel != want || string(message.Payload) != "to "+want {
+				t.Errorf("message: got %q on %q, want %q on %q", message.Payload, message.Channel, "to "+want, want)
+			}
+		}
+		select {
+		case message := <-sub.Messages():
+			t.Errorf("unexpected message %q on %q", message.Payload, message.Channel)
+		case <-time.After(50 * time.Millisecond):
+		}
+
+		// Cancelling the context ends the subscription
+		cancel()
+		select {
+		case _, ok := <-sub.Messages():
+			if ok {
+				t.Error("got a message after the context was cancelled")
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("the subscription did not end with its context")
+		}
+	})
+}
+
+func TestSubscribeMessagesIsIdenticalAcrossBackends(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		sub, err := repo.SubscribeMessages(ctx, "events")
+		if err != nil {
+			t.Fatalf("SubscribeMessages: %v", err)
+		}
+		defer sub.Close()
+		plain, err := repo.Subscribe(ctx, "events")
+		if err != nil {
+			t.Fatalf("Subscribe: %v", err)
+		}
+		// Redis confirms Subscribe asynchronously
+		if rr, ok := repo.(*RedisRepository); ok {
+			waitForSubscribers(t, rr, "app:channel:events", 2)
+		}
+
+		for _, message := range []interface{}{"text", []byte{0x00, 0x01}, map[string]int{"a": 1}} {
+			if err := repo.Publish(ctx, "events", message); err != nil {
+				t.Fatalf("Publish: %v", err)
+			}
+		}
+		for _, want := range []string{"text", "\x00\x01", `{"a":1}`} {
+			if message := receiveMessage(t, sub); message.Channel != "events" || string(message.Payload) != want {
+				t.Errorf("SubscribeMessages: got %q on %q, want %q on %q", message.Payload, message.Channel, want, "events")
+			}
+			select {
+			case payload := <-plain:
+				if payload != want {
+					t.Errorf("Subscribe: got %#v, want %q", payload, want)
+				}
+			case <-time.After(2 * time.Second):
+				t.Fatal("Subscribe: timed out waiting for a message")
+			}
+		}
+	})
+}
+
+func TestPublishStructRoundTrip(t *testing.T) {
+	type event struct {
+		Kind string            `json:"kind"`
+		ID   int               `json:"id"`
+		Tags map[string]string `json:"tags"`
+	}
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		sub, err := repo.SubscribeMessages(ctx, "events")
+		if err != nil {
+			t.Fatalf("SubscribeMessages: %v", err)
+		}
+		defer sub.Close()
+
+		sent := event{Kind: "created", ID: 7, Tags: map[string]string{"by": "ann"}}
+		if err := repo.Publish(ctx, "events", sent); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		var received event
+		if err := (JSONCodec{}).Unmarshal(receiveMessage(t, sub).Payload, &received); err != nil {
+			t.Fatalf("Unmarshal: %v", err)
+		}
+		if received.Kind != sent.Kind || received.ID != sent.ID || received.Tags["by"] != "ann" {
+			t.Errorf("received %+v, want %+v", received, sent)
+		}
+
+		if err := repo.Publish(ctx, "events", make(chan int)); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("Publish of an unserializable value: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestCloseWhilePublishing(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		sub, err := repo.SubscribeMessages(ctx, "events")
+		if err != nil {
+			t.Fatalf("SubscribeMessages: %v", err)
+		}
+		go func() {
+			for range sub.Messages() {
+			}
+		}()
+
+		var wg sync.WaitGroup
+		for i := 0; i < 4; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 100; j++ {
+					if err := repo.Publish(ctx, "events", j); err != nil {
+						if !errors.Is(err, ErrOperationFailed) {
+							t.Errorf("Publish during Close: got %v, want nil or ErrOperationFailed", err)
+						}
+						return
+					}
+				}
+			}()
+		}
+		time.Sleep(time.Millisecond)
+		if err := repo.Close(); err != nil {
+			t.Errorf("Close: %v", err)
+		}
+		wg.Wait()
+
+		if err := repo.Publish(ctx, "events", "late"); !errors.Is(err, ErrOperationFailed) {
+			t.Errorf("Publish after Close: got %v, want ErrOperationFailed", err)
+		}
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]int{"a": 1}); !errors.Is(err, ErrOperationFailed) {
+			t.Errorf("Create after Close: got %v, want ErrOperationFailed", err)
+		}
+	})
+}
+
+func TestCloseOneOfTwoSubscriptions(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		first, err := repo.SubscribeMessages(ctx, "events")
+		if err != nil {
+			t.Fatalf("SubscribeMessages: %v", err)
+		}
+		second, err := repo.SubscribeMessages(ctx, "events")
+		if err != nil {
+			t.Fatalf("SubscribeMessages: %v", err)
+		}
+		defer second.Close()
+
+		if err := first.Close(); err != nil {
+			t.Fatalf("Close: %v", err)
+		}
+		if err := first.Close(); err != nil {
+			t.Errorf("second Close: %v", err)
+		}
+		if err := repo.Publish(ctx, "events", "after close"); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+
+		if message := receiveMessage(t, second); string(message.Payload) != "after close" {
+			t.Errorf("open subscription: got %q, want %q", message.Payload, "after close")
+		}
+		select {
+		case _, ok := <-first.Messages():
+			if ok {
+				t.Error("the closed subscription received a message")
+			}
+		case <-time.After(2 * time.Second):
+			t.Error("the closed subscription's channel was not closed")
+		}
+	})
+}
+
+func TestWithTransaction(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		entity, counter := SimpleIdentifier("order:1"), SimpleIdentifier("orders:count")
+		errAbort := errors.New("abort")
+
+		err := repo.WithTransaction(ctx, func(tx DataRepository) error {
+			if err := tx.Create(ctx, entity, map[string]string{"item": "book"}); err != nil {
+				return err
+			}
+			if _, err := tx.AtomicIncrement(ctx, counter); err != nil {
+				return err
+			}
+			return errAbort
+		})
+		if !errors.Is(err, errAbort) {
+			t.Fatalf("WithTransaction of a failing function: got %v, want its error", err)
+		}
+		for _, id := range []EntityIdentifier{entity, counter} {
+			if exists, err := repo.Exists(ctx, id); err != nil || exists {
+				t.Errorf("Exists %s after the failed transaction: got %v, %v, want false", id, exists, err)
+			}
+		}
+
+		err = repo.WithTransaction(ctx, func(tx DataRepository) error {
+			if err := tx.Create(ctx, entity, map[string]string{"item": "book"}); err != nil {
+				return err
+			}
+			_, err := tx.AtomicIncrement(ctx, counter)
+			return err
+		})
+		if err != nil {
+			t.Fatalf("WithTransaction: %v", err)
+		}
+		var value map[string]string
+		if err := repo.Read(ctx, entity, &value); err != nil || value["item"] != "book" {
+			t.Errorf("Read after the transaction: got %v, %v", value, err)
+		}
+		if count, err := repo.AtomicIncrement(ctx, counter); err != nil || count != 2 {
+			t.Errorf("AtomicIncrement after the transaction: got %d, %v, want 2", count, err)
+		}
+	})
+}
+
+func TestCompareAndSwap(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("user:1")
+		if err := repo.Create(ctx, id, map[string]int{"a": 1}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		if swapped, err := repo.CompareAndSwap(ctx, id, map[string]int{"a": 1}, map[string]int{"a": 2}); err != nil || !swapped {
+			t.Errorf("CompareAndSwap with the current value: got %v, %v, want true", swapped, err)
+		}
+		if swapped, err := repo.CompareAndSwap(ctx, id, map[string]int{"a": 1}, map[string]int{"a": 3}); err != nil || swapped {
+			t.Errorf("CompareAndSwap with a stale value: got %v, %v, want false", swapped, err)
+		}
+		var value map[string]int
+		if err := repo.Read(ctx, id, &value); err != nil || value["a"] != 2 {
+			t.Errorf("Read: got %v, %v, want the swapped value", value, err)
+		}
+		if _, err := repo.CompareAndSwap(ctx, SimpleIdentifier("user:2"), 1, 2); !errors.Is(err, ErrNotFound) {
+			t.Errorf("CompareAndSwap of a missing entity: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestCounterAfterCreate(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		counter, entity := SimpleIdentifier("visits:1"), SimpleIdentifier("user:1")
+		if err := repo.Create(ctx, counter, 5); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if got, err := repo.IncrementBy(ctx, counter, 2); err != nil || got != 7 {
+			t.Errorf("IncrementBy of a created number: got %d, %v, want 7", got, err)
+		}
+		if got, err := repo.AtomicIncrement(ctx, counter); err != nil || got != 8 {
+			t.Errorf("AtomicIncrement: got %d, %v, want 8", got, err)
+		}
+		if got, err := repo.GetCounter(ctx, counter); err != nil || got != 8 {
+			t.Errorf("GetCounter: got %d, %v, want 8", got, err)
+		}
+
+		if err := repo.Create(ctx, entity, map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := repo.AtomicIncrement(ctx, entity); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("AtomicIncrement of an entity: got %v, want ErrInvalidInput", err)
+		}
+		if _, err := repo.GetCounter(ctx, entity); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("GetCounter of an entity: got %v, want ErrInvalidInput", err)
+		}
+		if err := repo.SetCounter(ctx, entity, 10); err != nil {
+			t.Fatalf("SetCounter over an entity: %v", err)
+		}
+		if got, err := repo.IncrementBy(ctx, entity, -3); err != nil || got != 7 {
+			t.Errorf("IncrementBy after SetCounter: got %d, %v, want 7", got, err)
+		}
+		if _, err := repo.GetCounter(ctx, SimpleIdentifier("visits:2")); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetCounter of a missing counter: got %v, want ErrNotFound", err)
+		}
+	})
+}
+
+func TestIncrementWithLimit(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("tokens:1")
+		if got, ok, err := repo.IncrementWithLimit(ctx, id, 3, 5); err != nil || !ok || got != 3 {
+			t.Errorf("IncrementWithLimit below the limit: got %d, %v, %v, want 3, true", got, ok, err)
+		}
+		if got, ok, err := repo.IncrementWithLimit(ctx, id, 2, 5); err != nil || !ok || got != 5 {
+			t.Errorf("IncrementWithLimit up to the limit: got %d, %v, %v, want 5, true", got, ok, err)
+		}
+		if got, ok, err := repo.IncrementWithLimit(ctx, id, 1, 5); err != nil || ok || got != 5 {
+			t.Errorf("IncrementWithLimit over the limit: got %d, %v, %v, want 5, false", got, ok, err)
+		}
+		if got, err := repo.DecrementBy(ctx, id, 4); err != nil || got != 1 {
+			t.Errorf("DecrementBy: got %d, %v, want 1", got, err)
+		}
+		if got, ok, err := repo.IncrementWithLimit(ctx, id, 4, 5); err != nil || !ok || got != 5 {
+			t.Errorf("IncrementWithLimit after DecrementBy: got %d, %v, %v, want 5, true", got, ok, err)
+		}
+	})
+}
+
+func TestIncrementFloat(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("balance:1")
+		var got float64
+		var err error
+		for _, delta := range []float64{1.5, 2.25, -0.75} {
+			if got, err = repo.IncrementFloat(ctx, id, delta); err != nil {
+				t.Fatalf("IncrementFloat(%v): %v", delta, err)
+			}
+		}
+		if got != 3 {
+			t.Errorf("IncrementFloat: got a total of %v, want 3", got)
+		}
+
+		// An integer counter becomes a floating-point counter
+		counter := SimpleIdentifier("visits:1")
+		if _, err := repo.IncrementBy(ctx, counter, 2); err != nil {
+			t.Fatalf("IncrementBy: %v", err)
+		}
+		if got, err := repo.IncrementFloat(ctx, counter, 0.5); err != nil || got != 2.5 {
+			t.Errorf("IncrementFloat of an integer counter: got %v, %v, want 2.5", got, err)
+		}
+
+		if err := repo.Create(ctx, SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		if _, err := repo.IncrementFloat(ctx, SimpleIdentifier("user:1"), 1); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("IncrementFloat of an entity: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestNamespacesAreIsolated(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		namespacer, ok := repo.(interface {
+			WithNamespace(ns string) DataRepository
+		})
+		if !ok {
+			t.Fatalf("%T has no WithNamespace", repo)
+		}
+		tenantA, tenantB := namespacer.WithNamespace("tenantA"), namespacer.WithNamespace("tenantB")
+		id := SimpleIdentifier("user:1")
+		if err := tenantA.Create(ctx, id, map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create in tenantA: %v", err)
+		}
+		// The same identifier is a different entity in another namespace
+		if err := tenantB.Create(ctx, id, map[string]string{"name": "bob"}); err != nil {
+			t.Fatalf("Create in tenantB: %v", err)
+		}
+		if err := tenantB.Create(ctx, SimpleIdentifier("user:2"), map[string]string{"name": "cy"}); err != nil {
+			t.Fatalf("Create in tenantB: %v", err)
+		}
+
+		idsA, valuesA, err := tenantA.List(ctx, "user:*")
+		if err != nil || fmt.Sprint(identifierStrings(idsA)) != "[user:1]" {
+			t.Errorf("List in tenantA: got %v, %v, want [user:1]", idsA, err)
+		} else if valuesA[0].(map[string]interface{})["name"] != "ann" {
+			t.Errorf("List in tenantA: got %v, want tenantA's user:1", valuesA[0])
+		}
+		if idsB, _, err := tenantB.List(ctx, "user:*"); err != nil || len(idsB) != 2 {
+			t.Errorf("List in tenantB: got %v, %v, want user:1 and user:2", idsB, err)
+		}
+		if exists, err := tenantA.Exists(ctx, SimpleIdentifier("user:2")); err != nil || exists {
+			t.Errorf("Exists in tenantA of tenantB's user:2: got %v, %v, want false", exists, err)
+		}
+		if acquired, err := tenantA.AcquireLock(ctx, id, time.Minute); err != nil || !acquired {
+			t.Errorf("AcquireLock in tenantA: got %v, %v", acquired, err)
+		}
+		if acquired, err := tenantB.AcquireLock(ctx, id, time.Minute); err != nil || !acquired {
+			t.Errorf("AcquireLock of the same identifier in tenantB: got %v, %v, want the lock", acquired, err)
+		}
+	})
+}
+
+func TestGetAndDeleteAndGetAndSet(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id, missing := SimpleIdentifier("session:1"), SimpleIdentifier("session:2")
+		if err := repo.Create(ctx, id, map[string]string{"user": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		var old map[string]string
+		if err := repo.GetAndSet(ctx, id, map[string]string{"user": "bob"}, &old); err != nil || old["user"] != "ann" {
+			t.Errorf("GetAndSet: got %v, %v, want the previous value", old, err)
+		}
+		var value map[string]string
+		if err := repo.GetAndDelete(ctx, id, &value); err != nil || value["user"] != "bob" {
+			t.Errorf("GetAndDelete: got %v, %v, want the value set by GetAndSet", value, err)
+		}
+		if exists, err := repo.Exists(ctx, id); err != nil || exists {
+			t.Errorf("Exists after GetAndDelete: got %v, %v, want false", exists, err)
+		}
+		if err := repo.GetAndDelete(ctx, id, &value); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAndDelete of a deleted entity: got %v, want ErrNotFound", err)
+		}
+		if err := repo.GetAndSet(ctx, missing, map[string]string{"user": "cy"}, &old); !errors.Is(err, ErrNotFound) {
+			t.Errorf("GetAndSet of a missing entity: got %v, want ErrNotFound", err)
+		}
+		if exists, err := repo.Exists(ctx, missing); err != nil || exists {
+			t.Errorf("Exists after GetAndSet of a missing entity: got %v, %v, want false", exists, err)
+		}
+	})
+}
+
+func TestCreateIfAbsent(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		id := SimpleIdentifier("job:1")
+		if created, err := repo.CreateIfAbsent(ctx, id, map[string]string{"owner": "ann"}, time.Hour); err != nil || !created {
+			t.Fatalf("CreateIfAbsent of a new entity: got %v, %v, want true", created, err)
+		}
+		if ttl, err := repo.GetExpiration(ctx, id); err != nil || ttl <= 0 || ttl > time.Hour {
+			t.Errorf("GetExpiration: got %v, %v, want up to an hour", ttl, err)
+		}
+		if created, err := repo.CreateIfAbsent(ctx, id, map[string]string{"owner": "bob"}, time.Minute); err != nil || created {
+			t.Errorf("CreateIfAbsent of an existing entity: got %v, %v, want false", created, err)
+		}
+		var value map[string]string
+		if err := repo.Read(ctx, id, &value); err != nil || value["owner"] != "ann" {
+			t.Errorf("Read: got %v, %v, want the first value", value, err)
+		}
+		if ttl, err := repo.GetExpiration(ctx, id); err != nil || ttl <= time.Minute {
+			t.Errorf("GetExpiration after the second CreateIfAbsent: got %v, %v, want the first TTL", ttl, err)
+		}
+
+		// A ttl of 0 creates the entity without expiration
+		if created, err := repo.CreateIfAbsent(ctx, SimpleIdentifier("job:2"), 1, 0); err != nil || !created {
+			t.Errorf("CreateIfAbsent without TTL: got %v, %v, want true", created, err)
+		}
+		var counter int
+		if ttl, err := repo.ReadWithTTL(ctx, SimpleIdentifier("job:2"), &counter); err != nil || ttl != NoExpiration {
+			t.Errorf("ReadWithTTL without TTL: got %v, %v, want NoExpiration", ttl, err)
+		}
+		if _, err := repo.CreateIfAbsent(ctx, SimpleIdentifier("job:3"), 1, -time.Second); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("CreateIfAbsent with a negative TTL: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestWriteWithTTL(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		created, upserted := SimpleIdentifier("session:1"), SimpleIdentifier("session:2")
+		if err := repo.CreateWithTTL(ctx, created, map[string]string{"user": "ann"}, time.Minute); err != nil {
+			t.Fatalf("CreateWithTTL: %v", err)
+		}
+		if ttl, err := repo.GetExpiration(ctx, created); err != nil || ttl <= 0 || ttl > time.Minute {
+			t.Errorf("GetExpiration after CreateWithTTL: got %v, %v, want up to a minute", ttl, err)
+		}
+		if err := repo.CreateWithTTL(ctx, created, map[string]string{"user": "bob"}, time.Minute); !errors.Is(err, ErrAlreadyExists) {
+			t.Errorf("CreateWithTTL of an existing entity: got %v, want ErrAlreadyExists", err)
+		}
+
+		if err := repo.UpsertWithTTL(ctx, upserted, map[string]string{"user": "cy"}, time.Minute); err != nil {
+			t.Fatalf("UpsertWithTTL of a new entity: %v", err)
+		}
+		if ttl, err := repo.GetExpiration(ctx, upserted); err != nil || ttl <= 0 || ttl > time.Minute {
+			t.Errorf("GetExpiration after UpsertWithTTL: got %v, %v, want up to a minute", ttl, err)
+		}
+		// Upserting again replaces the previous expiration
+		if err := repo.UpsertWithTTL(ctx, upserted, map[string]string{"user": "dee"}, time.Hour); err != nil {
+			t.Fatalf("UpsertWithTTL of an existing entity: %v", err)
+		}
+		if ttl, err := repo.GetExpiration(ctx, upserted); err != nil || ttl <= time.Minute || ttl > time.Hour {
+			t.Errorf("GetExpiration after the second UpsertWithTTL: got %v, %v, want up to an hour", ttl, err)
+		}
+
+		for _, ttl := range []time.Duration{0, -time.Second} {
+			if err := repo.CreateWithTTL(ctx, SimpleIdentifier("session:3"), 1, ttl); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("CreateWithTTL with TTL %v: got %v, want ErrInvalidInput", ttl, err)
+			}
+			if err := repo.UpsertWithTTL(ctx, SimpleIdentifier("session:3"), 1, ttl); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("UpsertWithTTL with TTL %v: got %v, want ErrInvalidInput", ttl, err)
+			}
+		}
+	})
+}
+
+func TestIterateVisitsEveryEntity(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		const n = 250
+		for i := 0; i < n; i++ {
+			if err := repo.Create(ctx, SimpleIdentifier(fmt.Sprintf("item:%d", i)), map[string]int{"i": i}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+		if err := repo.Create(ctx, SimpleIdentifier("other:1"), 1); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+
+		calls := 0
+		seen := make(map[string]bool)
+		err := repo.Iterate(ctx, SimpleIdentifier("item:*"), func(identifier EntityIdentifier, raw []byte) error {
+			calls++
+			seen[identifier.String()] = true
+			if len(raw) == 0 {
+				t.Errorf("Iterate: no value for %s", identifier)
+			}
+			// fn runs without the repository's lock, so it may write
+			return repo.Upsert(ctx, SimpleIdentifier("other:last"), identifier.String())
+		})
+		if err != nil {
+			t.Fatalf("Iterate: %v", err)
+		}
+		if calls != n || len(seen) != n {
+			t.Errorf("Iterate: got %d calls for %d entities, want %d", calls, len(seen), n)
+		}
+
+		errStop := errors.New("stop")
+		calls = 0
+		err = repo.Iterate(ctx, SimpleIdentifier("item:*"), func(EntityIdentifier, []byte) error {
+			calls++
+			if calls == 3 {
+				return errStop
+			}
+			return nil
+		})
+		if !errors.Is(err, errStop) || calls != 3 {
+			t.Errorf("Iterate stopped by fn: got %v after %d calls, want its error after 3", err, calls)
+		}
+	})
+}
+
+func TestListPageSeesEveryKey(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		const n = 300
+		for i := 0; i < n; i++ {
+			if err := repo.Create(ctx, SimpleIdentifier(fmt.Sprintf("item:%d", i)), i); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+		}
+
+		seen := make(map[string]int)
+		cursor, pages := "", 0
+		for {
+			ids, next, err := repo.ListPage(ctx, testListPattern(repo, "item:*"), cursor, 25)
+			if err != nil {
+				t.Fatalf("ListPage after %d pages: %v", pages, err)
+			}
+			for _, id := range ids {
+				seen[id.String()]++
+			}
+			pages++
+			if next == "" {
+				break
+			}
+			if pages > n {
+				t.Fatal("ListPage doesn't end")
+			}
+			cursor = next
+		}
+
+		for i := 0; i < n; i++ {
+			count := seen[fmt.Sprintf("item:%d", i)]
+			// Redis SCAN may return a key more than once
+			if _, isMemory := repo.(*MemoryRepository); count == 0 || (isMemory && count != 1) {
+				t.Errorf("item:%d seen %d times", i, count)
+			}
+		}
+		if len(seen) != n {
+			t.Errorf("ListPage: got %d distinct identifiers, want %d", len(seen), n)
+		}
+
+		if _, _, err := repo.ListPage(ctx, testListPattern(repo, "item:*"), "", 0); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ListPage with page size 0: got %v, want ErrInvalidInput", err)
+		}
+		if _, _, err := repo.ListPage(ctx, testListPattern(repo, "item:*"), "not a cursor", 10); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("ListPage with an invalid cursor: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestIncrementWithExpiry(t *testing.T) {
+	forEachBackendWithClock(t, func(t *testing.T, repo DataRepository, advance func(d time.Duration)) {
+		ctx := context.Background()
+		id := SimpleIdentifier("requests:1")
+		const ttl = 300 * time.Millisecond
+		if got, err := repo.IncrementWithExpiry(ctx, id, 1, ttl); err != nil || got != 1 {
+			t.Fatalf("IncrementWithExpiry of a new counter: got %d, %v, want 1", got, err)
+		}
+		advance(150 * time.Millisecond)
+
+		// Later increments keep the expiration set by the first one
+		if got, err := repo.IncrementWithExpiry(ctx, id, 2, ttl); err != nil || got != 3 {
+			t.Errorf("IncrementWithExpiry of an existing counter: got %d, %v, want 3", got, err)
+		}
+		if remaining, err := repo.GetExpiration(ctx, id); err != nil || remaining <= 0 || remaining > 150*time.Millisecond {
+			t.Errorf("GetExpiration after the second increment: got %v, %v, want at most 150ms", remaining, err)
+		}
+
+		// Once expired, the counter starts over with a new expiration
+		advance(200 * time.Millisecond)
+		if got, err := repo.IncrementWithExpiry(ctx, id, 5, ttl); err != nil || got != 5 {
+			t.Errorf("IncrementWithExpiry after expiration: got %d, %v, want 5", got, err)
+		}
+		if remaining, err := repo.GetExpiration(ctx, id); err != nil || remaining <= 150*time.Millisecond || remaining > ttl {
+			t.Errorf("GetExpiration of the restarted counter: got %v, %v, want about %v", remaining, err, ttl)
+		}
+
+		if _, err := repo.IncrementWithExpiry(ctx, id, 1, 0); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("IncrementWithExpiry without TTL: got %v, want ErrInvalidInput", err)
+		}
+	})
+}
+
+func TestSetExpirationMany(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		ids := []EntityIdentifier{SimpleIdentifier("session:1"), SimpleIdentifier("session:2"), SimpleIdentifier("session:3")}
+		for _, id := range ids {
+			if err := repo.Create(ctx, id, map[string]interface{}{"user": id.String()}); err != nil {
+				t.Fatalf("Create %v: %v", id, err)
+			}
+		}
+		const ttl = time.Minute
+		if err := repo.SetExpirationMany(ctx, ids, ttl); err != nil {
+			t.Fatalf("SetExpirationMany: %v", err)
+		}
+		for _, id := range ids {
+			if remaining, err := repo.GetExpiration(ctx, id); err != nil || remaining <= ttl-time.Second || remaining > ttl {
+				t.Errorf("GetExpiration of %v: got %v, %v, want about %v", id, remaining, err, ttl)
+			}
+		}
+
+		// Missing entities are reported, the others still get their expiration
+		missing := SimpleIdentifier("session:missing")
+		err := repo.SetExpirationMany(ctx, []EntityIdentifier{ids[0], missing}, 2*ttl)
+		var batchErr *BatchError
+		if !errors.As(err, &batchErr) || !errors.Is(err, ErrNotFound) {
+			t.Fatalf("SetExpirationMany with a missing entity: got %v, want a *BatchError wrapping ErrNotFound", err)
+		}
+		if failed := batchErr.Failed(); len(failed) != 1 || failed[0] != missing {
+			t.Errorf("failed items: got %v, want [%v]", failed, missing)
+		}
+		if remaining, err := repo.GetExpiration(ctx, ids[0]); err != nil || remaining <= ttl {
+			t.Errorf("GetExpiration of %v: got %v, %v, want more than %v", ids[0], remaining, err, ttl)
+		}
+	})
+}
+
+func TestCreateDataRepositoryRejectsInvalidConfigs(t *testing.T) {
+	redisAddrs := []string{"localhost:6379"}
+	for _, tc := range []struct {
+		backend string
+		config  Config
+		want    string
+	}{
+		{"memory", MemoryConfig{MaxEntries: -1}, "MemoryConfig: MaxEntries -1 is negative"},
+		{"redis", RedisConfig{Mode: RedisModeSingle}, "RedisConfig: Addrs is empty in single mode"},
+		{"redis", RedisConfig{Mode: "ring", Addrs: redisAddrs}, `RedisConfig: unknown Mode "ring"`},
+		{"redis", RedisConfig{Addrs: []string{" "}}, "RedisConfig: Addrs[0] is empty"},
+		{"redis", RedisConfig{Mode: RedisModeSentinel, Addrs: redisAddrs}, "RedisConfig: MasterName is empty in sentinel mode"},
+		{"redis", RedisConfig{Addrs: redisAddrs, DB: -1}, "RedisConfig: DB -1 is negative"},
+		{"redis", RedisConfig{Mode: RedisModeCluster, Addrs: redisAddrs, DB: 2}, "only 0 is available in cluster mode"},
+		{"redis", RedisConfig{Addrs: redisAddrs, ReadPassword: "pw"}, "RedisConfig: ReadPassword is set without ReadUsername"},
+		{"redis", RedisConfig{Addrs: redisAddrs, TLSKeyFile: "key.pem"}, "RedisConfig: TLSCertFile and TLSKeyFile must be set together"},
+		{"redis", RedisConfig{Addrs: redisAddrs, StorageMode: RedisStorageJSON, DisableJSONModule: true}, "RedisConfig: DisableJSONModule contradicts StorageMode"},
+		{"redis", RedisConfig{Addrs: redisAddrs, StorageMode: "hash"}, `RedisConfig: unknown StorageMode "hash"`},
+		{"redis", RedisConfig{Addrs: redisAddrs, MinKeyLength: 10, MaxKeyLength: 5}, "RedisConfig: MinKeyLength 10 exceeds MaxKeyLength 5"},
+	} {
+		_, err := CreateDataRepository(tc.backend, tc.config)
+		if !errors.Is(err, ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%s %+v: got %v, want ErrInvalidInput containing %q", tc.backend, tc.config, err, tc.want)
+		}
+	}
+
+	if _, err := NewMemoryRepository(RedisConfig{}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("NewMemoryRepository with a RedisConfig: got %v, want ErrInvalidInput", err)
+	}
+	if _, err := CreateDataRepository("nosuchbackend", MemoryConfig{}); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("CreateDataRepository of an unknown backend: got %v, want ErrInvalidInput", err)
+	}
+}
+
+func TestIDsWithGlobCharacters(t *testing.T) {
+	// DefaultKeyCharset doesn't allow "*" and "?" in Redis keys
+	redisRepo, _ := newTestRedisRepository(t, RedisConfig{KeyCharset: regexp.MustCompile(`^[a-zA-Z0-9_:.*?-]+$`)})
+	for name, repo := range map[string]DataRepository{"memory": newTestMemoryRepository(t, MemoryConfig{}), "redis": redisRepo} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			ids := []string{"file:*", "file:a?c", "file:abc", "file:a.c", "file:axc"}
+			for _, id := range ids {
+				if err := repo.Create(ctx, SimpleIdentifier(id), map[string]interface{}{"id": id}); err != nil {
+					t.Fatalf("Create %q: %v", id, err)
+				}
+			}
+
+			for _, id := range ids {
+				if exists, err := repo.Exists(ctx, SimpleIdentifier(id)); err != nil || !exists {
+					t.Errorf("Exists %q: got %v, %v, want true", id, exists, err)
+				}
+				var value map[string]interface{}
+				if err := repo.Read(ctx, SimpleIdentifier(id), &value); err != nil || value["id"] != id {
+					t.Errorf("Read %q: got %v, %v", id, value, err)
+				}
+
+				// Escaped, the id matches only itself
+				found, _, err := repo.List(ctx, testListPattern(repo, EscapeGlob(id)))
+				if err != nil || len(found) != 1 || found[0].String() != id {
+					t.Errorf("List of the escaped id %q: got %v, %v, want exactly that entity", id, found, err)
+				}
+			}
+
+			// Unescaped, the glob characters are wildcards and "." is a literal
+			for pattern, want := range map[string]int{"file:*": 5, "file:a?c": 4, "file:a.c": 1} {
+				if found, _, err := repo.List(ctx, testListPattern(repo, pattern)); err != nil || len(found) != want {
+					t.Errorf("List %q: got %v, %v, want %d entities", pattern, found, err, want)
+				}
+			}
+		})
+	}
+}
+
+func TestIdleExpiration(t *testing.T) {
+	redisRepo, server := newTestRedisRepository(t, RedisConfig{IdleExpiration: true})
+	for name, backend := range map[string]struct {
+		repo    DataRepository
+		advance func(time.Duration)
+	}{
+		"memory": {newTestMemoryRepository(t, MemoryConfig{}), time.Sleep},
+		"redis":  {redisRepo, server.FastForward},
+	} {
+		t.Run(name, func(t *testing.T) {
+			ctx := context.Background()
+			repo, advance := backend.repo, backend.advance
+			session, fixed := SimpleIdentifier("session:1"), SimpleIdentifier("session:2")
+			if err := repo.Create(ctx, session, map[string]string{"user": "ann"}); err != nil {
+				t.Fatalf("Create: %v", err)
+			}
+			if err := repo.CreateWithTTL(ctx, fixed, map[string]string{"user": "bob"}, 250*time.Millisecond); err != nil {
+				t.Fatalf("CreateWithTTL: %v", err)
+			}
+			expirer, ok := IdleExpirerOf(repo)
+			if !ok {
+				t.Fatal("IdleExpirerOf: the repository has no sliding expiration")
+			}
+			const idle = 200 * time.Millisecond
+			if err := expirer.SetIdleExpiration(ctx, session, idle); err != nil {
+				t.Fatalf("SetIdleExpiration: %v", err)
+			}
+			if got, err := expirer.GetIdleExpiration(ctx, session); err != nil || got != idle {
+				t.Errorf("GetIdleExpiration: got %v, %v, want %v", got, err, idle)
+			}
+
+			// Reads keep the session alive well past its idle timeout, but not the other entity
+			var value map[string]string
+			for i := 0; i < 4; i++ {
+				advance(100 * time.Millisecond)
+				if err := repo.Read(ctx, session, &value); err != nil {
+					t.Fatalf("Read after %d00ms: %v", i+1, err)
+				}
+				_ = repo.Read(ctx, fixed, &value)
+			}
+			if exists, err := repo.Exists(ctx, fixed); err != nil || exists {
+				t.Errorf("Exists of the entity with a fixed expiration: got %v, %v, want false", exists, err)
+			}
+
+			advance(300 * time.Millisecond)
+			if err := repo.Read(ctx, session, &value); !errors.Is(err, ErrNotFound) {
+				t.Errorf("Read after the idle timeout: got %v, want ErrNotFound", err)
+			}
+
+			if err := expirer.SetIdleExpiration(ctx, SimpleIdentifier("session:404"), idle); !errors.Is(err, ErrNotFound) {
+				t.Errorf("SetIdleExpiration of a missing entity: got %v, want ErrNotFound", err)
+			}
+			if err := expirer.SetIdleExpiration(ctx, fixed, 0); !errors.Is(err, ErrInvalidInput) {
+				t.Errorf("SetIdleExpiration without a timeout: got %v, want ErrInvalidInput", err)
+			}
+		})
+	}
+}
+
+func TestWritesRejectNilValues(t *testing.T) {
+	forEachBackend(t, func(t *testing.T, repo DataRepository) {
+		ctx := context.Background()
+		existing := SimpleIdentifier("user:1")
+		if err := repo.Create(ctx, existing, map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Create: %v", err)
+		}
+		var nilMap map[string]string
+		var nilPointer *codecTestUser
+		for name, value := range map[string]interface{}{"nil": nil, "nil map": nilMap, "nil pointer": nilPointer} {
+			fresh := SimpleIdentifier("user:2")
+			for op, err := range map[string]error{
+				"Create":        repo.Create(ctx, fresh, value),
+				"CreateWithTTL": repo.CreateWithTTL(ctx, fresh, value, time.Minute),
+				"Update":        repo.Update(ctx, existing, value),
+				"Upsert":        repo.Upsert(ctx, existing, value),
+				"UpsertWithTTL": repo.UpsertWithTTL(ctx, existing, value, time.Minute),
+				"CreateMany":    repo.CreateMany(ctx, map[EntityIdentifier]interface{}{fresh: value}),
+			} {
+				if !errors.Is(err, ErrInvalidInput) {
+					t.Errorf("%s with a %s value: got %v, want ErrInvalidInput", op, name, err)
+				}
+			}
+			if exists, _ := repo.Exists(ctx, fresh); exists {
+				t.Errorf("a %s value was stored", name)
+			}
+		}
+		var value map[string]string
+		if err := repo.Read(ctx, existing, &value); err != nil || value["name"] != "ann" {
+			t.Errorf("Read after the rejected writes: got %v, %v, want the value unchanged", value, err)
+		}
+
+		// Null stores null deliberately
+		if err := repo.Update(ctx, existing, Null); err != nil {
+			t.Fatalf("Update with Null: %v", err)
+		}
+		var generic interface{} = "unchanged"
+		if err := repo.Read(ctx, existing, &generic); err != nil || generic != nil {
+			t.Errorf("Read of Null: got %v, %v, want nil", generic, err)
+		}
+	})
+}
@@ -0,0 +1,108 @@
+// datarepositorytest/datarepositorytest.go
+
+// Package datarepositorytest checks that a datarepository.DataRepository behaves like the
+// backends of this module. The backend packages run it against their repositories, and custom
+// implementations can do the same in their tests.
+package datarepositorytest
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+)
+
+// Conformance exercises the core operations every backend implements alike. It expects an
+// empty repository and leaves the entities it creates behind, below the entity prefix "ct".
+func Conformance(t *testing.T, repo datarepository.DataRepository) {
+	t.Helper()
+	ctx := context.Background()
+	one, two, missing := datarepository.SimpleIdentifier("ct:1"), datarepository.SimpleIdentifier("ct:2"), datarepository.SimpleIdentifier("ct:404")
+
+	if err := repo.Ping(ctx); err != nil {
+		t.Fatalf("Ping: %v", err)
+	}
+	if err := repo.Create(ctx, one, map[string]interface{}{"name": "ann", "age": 30}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Create(ctx, one, map[string]int{"a": 1}); !errors.Is(err, datarepository.ErrAlreadyExists) {
+		t.Errorf("Create of an existing entity: got %v, want ErrAlreadyExists", err)
+	}
+	var value map[string]interface{}
+	if err := repo.Read(ctx, one, &value); err != nil || value["name"] != "ann" {
+		t.Errorf("Read: got %v, %v", value, err)
+	}
+	if err := repo.Read(ctx, missing, &value); !errors.Is(err, datarepository.ErrNotFound) {
+		t.Errorf("Read of a missing entity: got %v, want ErrNotFound", err)
+	}
+	if err := repo.Update(ctx, one, map[string]interface{}{"name": "ann", "age": 31}); err != nil {
+		t.Errorf("Update: %v", err)
+	}
+	if err := repo.Update(ctx, missing, map[string]int{"a": 1}); !errors.Is(err, datarepository.ErrNotFound) {
+		t.Errorf("Update of a missing entity: got %v, want ErrNotFound", err)
+	}
+	if err := repo.Upsert(ctx, two, map[string]interface{}{"name": "bob"}); err != nil {
+		t.Errorf("Upsert: %v", err)
+	}
+	if exists, err := repo.Exists(ctx, two); err != nil || !exists {
+		t.Errorf("Exists: got %v, %v, want true", exists, err)
+	}
+
+	ids, values, err := repo.List(ctx, listPattern(repo, "ct:*"))
+	if err != nil || len(ids) != 2 || len(values) != 2 {
+		t.Errorf("List: got %v, %v, want ct:1 and ct:2", ids, err)
+	}
+	if count, err := repo.Count(ctx, datarepository.SimpleIdentifier("ct:*")); err != nil || count != 2 {
+		t.Errorf("Count: got %d, %v, want 2", count, err)
+	}
+
+	if err := repo.SetExpiration(ctx, two, time.Hour); err != nil {
+		t.Errorf("SetExpiration: %v", err)
+	}
+	if ttl, err := repo.GetExpiration(ctx, two); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetExpiration: got %v, %v, want about an hour", ttl, err)
+	}
+
+	counter := datarepository.SimpleIdentifier("ct:counter")
+	for want := int64(1); want <= 3; want++ {
+		if got, err := repo.AtomicIncrement(ctx, counter); err != nil || got != want {
+			t.Errorf("AtomicIncrement: got %d, %v, want %d", got, err, want)
+		}
+	}
+
+	token, acquired, err := repo.AcquireLockWithToken(ctx, one, time.Minute)
+	if err != nil || !acquired {
+		t.Errorf("AcquireLockWithToken: got %v, %v, want the lock", acquired, err)
+	}
+	if acquired, err := repo.AcquireLock(ctx, one, time.Minute); err != nil || acquired {
+		t.Errorf("AcquireLock of a held lock: got %v, %v, want false", acquired, err)
+	}
+	if err := repo.ReleaseLockWithToken(ctx, one, token); err != nil {
+		t.Errorf("ReleaseLockWithToken: %v", err)
+	}
+
+	if err := repo.Delete(ctx, one); err != nil {
+		t.Errorf("Delete: %v", err)
+	}
+	if err := repo.Delete(ctx, one); !errors.Is(err, datarepository.ErrNotFound) {
+		t.Errorf("Delete of a deleted entity: got %v, want ErrNotFound", err)
+	}
+}
+
+// listPattern returns the List pattern of the entities matching pattern. The patterns of a
+// RedisRepository include its key prefix, which is derived from the key of an entity.
+func listPattern(repo datarepository.DataRepository, pattern string) string {
+	redisRepo, ok := repo.(*datarepository.RedisRepository)
+	if !ok {
+		return pattern
+	}
+	const sample = "ct:1"
+	key, err := redisRepo.KeyFor(datarepository.SimpleIdentifier(sample))
+	if err != nil {
+		return pattern
+	}
+	return strings.TrimSuffix(key, sample) + pattern
+}
@@ -0,0 +1,28 @@
+// dynamo/dynamo.config_test.go
+
+package dynamo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	datarepository "github.com/itsatony/go-datarepository"
+)
+
+func TestCreateDataRepositoryRejectsInvalidDynamoConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		config DynamoConfig
+		want   string
+	}{
+		{DynamoConfig{}, "DynamoConfig: Table is empty"},
+		{DynamoConfig{Table: "a b"}, `DynamoConfig: Table "a b"`},
+		{DynamoConfig{Table: "items", Endpoint: "localhost:8000"}, "DynamoConfig: Endpoint must start with http://"},
+		{DynamoConfig{Table: "items", AccessKeyID: "key"}, "DynamoConfig: AccessKeyID and SecretAccessKey must be set together"},
+	} {
+		_, err := datarepository.CreateDataRepository("dynamodb", tc.config)
+		if !errors.Is(err, datarepository.ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: got %v, want ErrInvalidInput containing %q", tc.config, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,1660 @@
+// dynamo/dynamo.go
+
+// Package dynamo implements a datarepository.DataRepository on an Amazon DynamoDB table. Importing
+// it registers the "dynamodb" repository type with datarepository.CreateDataRepository.
+package dynamo
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb/types"
+	datarepository "github.com/itsatony/go-datarepository"
+)
+
+const (
+	// DefaultDynamoTTLAttribute is the attribute DynamoDB's time to live feature reads expirations from
+	DefaultDynamoTTLAttribute = "ttl"
+	// DefaultDynamoSetupTimeout bounds loading the AWS configuration and creating the table
+	DefaultDynamoSetupTimeout = 2 * time.Minute
+	// DynamoMaxRetries is the number of times a conditional write is retried when the item was
+	// modified concurrently
+	DynamoMaxRetries = 10
+
+	dynamoAttrEntityPrefix = "entity_prefix"
+	dynamoAttrID           = "id"
+	dynamoAttrValue        = "value"
+	dynamoAttrCounter      = "counter"
+	dynamoAttrVersion      = "version"
+	dynamoAttrExpiresAt    = "expires_at"
+	dynamoAttrToken        = "token"
+
+	// Locks are items of this partition, which can't collide with the entity prefixes, as those
+	// must start with a letter
+	dynamoLockPartition = "_lock"
+
+	// Conditions on the liveness of an item; :now is the current time in epoch milliseconds
+	dynamoLive          = "(attribute_not_exists(#e) OR #e > :now)"
+	dynamoExistsAndLive = "attribute_exists(#i) AND " + dynamoLive
+	dynamoAbsent        = "attribute_not_exists(#i) OR #e <= :now"
+)
+
+var dynamoTableNameRegex = regexp.MustCompile(`^[a-zA-Z0-9_.-]{3,255}$`)
+
+// dynamoPlaceholderRegex matches the attribute name and value placeholders of an expression
+var dynamoPlaceholderRegex = regexp.MustCompile(`[#:][a-zA-Z]+`)
+
+type DynamoConfig struct {
+	// Table is the name of the table, which is created with on-demand capacity if it doesn't exist
+	Table string
+	// Region is the AWS region. Defaults to the region of the environment or shared config.
+	Region string
+	// Endpoint overrides the DynamoDB endpoint, e.g. "http://localhost:8000" for DynamoDB Local
+	Endpoint string
+	// AccessKeyID and SecretAccessKey are static credentials. Defaults to the credentials of the
+	// environment, shared config or instance role.
+	AccessKeyID     string
+	SecretAccessKey string
+	// Client is used instead of a client built from Region, Endpoint and the credentials
+	Client *dynamodb.Client
+	// TTLAttribute is the attribute DynamoDB's time to live feature is enabled on.
+	// Defaults to DefaultDynamoTTLAttribute.
+	TTLAttribute string
+	// Codec serializes entity values. Defaults to JSONCodec.
+	Codec datarepository.Codec
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator datarepository.IDGenerator
+	// NotFoundOnEmpty makes List return ErrNotFound instead of an empty result when nothing matches
+	NotFoundOnEmpty bool
+	// Logger receives diagnostic messages, e.g. about entries skipped by List.
+	// Defaults to a no-op logger.
+	Logger datarepository.Logger
+}
+
+func (c DynamoConfig) GetConnectionString() string {
+	if c.Endpoint != "" {
+		return strings.TrimSuffix(c.Endpoint, "/") + "/" + c.Table
+	}
+	return "dynamodb://" + c.Region + "/" + c.Table
+}
+
+// Validate checks the config without connecting.
+// Returns ErrInvalidInput naming the offending field.
+func (c DynamoConfig) Validate() error {
+	if c.Table == "" {
+		return datarepository.InvalidConfig("DynamoConfig", "Table is empty")
+	}
+	if !dynamoTableNameRegex.MatchString(c.Table) {
+		return datarepository.InvalidConfig("DynamoConfig", "Table %q must be 3 to 255 letters, digits, \"_\", \"-\" or \".\"", c.Table)
+	}
+	if c.Endpoint != "" && !strings.HasPrefix(c.Endpoint, "http://") && !strings.HasPrefix(c.Endpoint, "https://") {
+		return datarepository.InvalidConfig("DynamoConfig", "Endpoint must start with http:// or https://")
+	}
+	if (c.AccessKeyID == "") != (c.SecretAccessKey == "") {
+		return datarepository.InvalidConfig("DynamoConfig", "AccessKeyID and SecretAccessKey must be set together")
+	}
+	return nil
+}
+
+// DynamoIdentifier identifies the entity stored in the item (EntityPrefix, ID)
+type DynamoIdentifier struct {
+	EntityPrefix string
+	ID           string
+}
+
+func (di DynamoIdentifier) String() string {
+	return di.EntityPrefix + datarepository.DefaultKeySeparator + di.ID
+}
+
+// Parts returns the entity prefix and the id
+func (di DynamoIdentifier) Parts() (string, string) {
+	return di.EntityPrefix, di.ID
+}
+
+// DynamoRepository stores entities as items of a single table, partitioned by entity prefix
+// and sorted by id. The codec-serialized value is a binary attribute; counters are a number
+// attribute updated with UpdateItem's ADD, so increments need no read. Expirations are kept in
+// epoch milliseconds and checked on every read, as DynamoDB's time to live feature, which is
+// enabled on the TTL attribute, deletes expired items only eventually.
+type DynamoRepository struct {
+	datarepository.BaseRepository
+	client          *dynamodb.Client
+	table           string
+	attributeNames  map[string]string
+	codec           datarepository.Codec
+	idGen           datarepository.IDGenerator
+	notFoundOnEmpty bool
+	logger          datarepository.Logger
+}
+
+var _ datarepository.DataRepository = (*DynamoRepository)(nil)
+
+func init() {
+	datarepository.RegisterDataRepository("dynamodb", NewDynamoRepository)
+}
+
+func NewDynamoRepository(config datarepository.Config) (datarepository.DataRepository, error) {
+	cfg, ok := config.(DynamoConfig)
+	if !ok {
+		return nil, fmt.Errorf("%w: DynamoDB repository needs a DynamoConfig, got %T", datarepository.ErrInvalidInput, config)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.TTLAttribute == "" {
+		cfg.TTLAttribute = DefaultDynamoTTLAttribute
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = datarepository.UUIDv4Generator{}
+	}
+	if cfg.Codec == nil {
+		cfg.Codec = datarepository.JSONCodec{}
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), DefaultDynamoSetupTimeout)
+	defer cancel()
+	client := cfg.Client
+	if client == nil {
+		var opts []func(*awsconfig.LoadOptions) error
+		if cfg.Region != "" {
+			opts = append(opts, awsconfig.WithRegion(cfg.Region))
+		}
+		if cfg.AccessKeyID != "" {
+			opts = append(opts, awsconfig.WithCredentialsProvider(
+				credentials.NewStaticCredentialsProvider(cfg.AccessKeyID, cfg.SecretAccessKey, "")))
+		}
+		awsCfg, err := awsconfig.LoadDefaultConfig(ctx, opts...)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+		}
+		client = dynamodb.NewFromConfig(awsCfg, func(o *dynamodb.Options) {
+			if cfg.Endpoint != "" {
+				o.BaseEndpoint = aws.String(cfg.Endpoint)
+			}
+		})
+	}
+
+	repo := &DynamoRepository{
+		client: client,
+		table:  cfg.Table,
+		attributeNames: map[string]string{
+			"#p":   dynamoAttrEntityPrefix,
+			"#i":   dynamoAttrID,
+			"#v":   dynamoAttrValue,
+			"#c":   dynamoAttrCounter,
+			"#ver": dynamoAttrVersion,
+			"#e":   dynamoAttrExpiresAt,
+			"#t":   cfg.TTLAttribute,
+			"#tok": dynamoAttrToken,
+		},
+		codec:           cfg.Codec,
+		idGen:           cfg.IDGenerator,
+		notFoundOnEmpty: cfg.NotFoundOnEmpty,
+		logger:          datarepository.ResolveLogger(cfg.Logger, nil),
+	}
+	if err := repo.ensureTable(ctx); err != nil {
+		return nil, err
+	}
+	return repo, nil
+}
+
+// ensureTable creates the table if it doesn't exist and enables time to live on the TTL
+// attribute. Failing to enable time to live is only logged, as expired items are hidden anyway.
+func (r *DynamoRepository) ensureTable(ctx context.Context) error {
+	_, err := r.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &r.table})
+	var notFound *types.ResourceNotFoundException
+	if err == nil {
+		return nil
+	}
+	if !errors.As(err, &notFound) {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	_, err = r.client.CreateTable(ctx, &dynamodb.CreateTableInput{
+		TableName: &r.table,
+		AttributeDefinitions: []types.AttributeDefinition{
+			{AttributeName: aws.String(dynamoAttrEntityPrefix), AttributeType: types.ScalarAttributeTypeS},
+			{AttributeName: aws.String(dynamoAttrID), AttributeType: types.ScalarAttributeTypeS},
+		},
+		KeySchema: []types.KeySchemaElement{
+			{AttributeName: aws.String(dynamoAttrEntityPrefix), KeyType: types.KeyTypeHash},
+			{AttributeName: aws.String(dynamoAttrID), KeyType: types.KeyTypeRange},
+		},
+		BillingMode: types.BillingModePayPerRequest,
+	})
+	// Another process may have created the table in the meantime
+	var inUse *types.ResourceInUseException
+	if err != nil && !errors.As(err, &inUse) {
+		return fmt.Errorf("%w: failed to create table: %v", datarepository.ErrOperationFailed, err)
+	}
+	waiter := dynamodb.NewTableExistsWaiter(r.client)
+	if err := waiter.Wait(ctx, &dynamodb.DescribeTableInput{TableName: &r.table}, DefaultDynamoSetupTimeout); err != nil {
+		return fmt.Errorf("%w: failed to create table: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	_, err = r.client.UpdateTimeToLive(ctx, &dynamodb.UpdateTimeToLiveInput{
+		TableName: &r.table,
+		TimeToLiveSpecification: &types.TimeToLiveSpecification{
+			AttributeName: aws.String(r.attributeNames["#t"]),
+			Enabled:       aws.Bool(true),
+		},
+	})
+	if err != nil {
+		r.logger.Warnf("failed to enable time to live on table %s, expired items are hidden but not deleted: %v", r.table, err)
+	}
+	return nil
+}
+
+// dynamoItem is an item of the table
+type dynamoItem struct {
+	entityPrefix string
+	id           string
+	value        []byte
+	hasValue     bool
+	// counter is the number attribute of counters, in DynamoDB's decimal string representation
+	counter   string
+	version   int64
+	expiresAt int64
+	token     string
+}
+
+func parseDynamoItem(attributes map[string]types.AttributeValue) dynamoItem {
+	var item dynamoItem
+	for name, attribute := range attributes {
+		switch av := attribute.(type) {
+		case *types.AttributeValueMemberS:
+			switch name {
+			case dynamoAttrEntityPrefix:
+				item.entityPrefix = av.Value
+			case dynamoAttrID:
+				item.id = av.Value
+			case dynamoAttrToken:
+				item.token = av.Value
+			}
+		case *types.AttributeValueMemberB:
+			if name == dynamoAttrValue {
+				item.value, item.hasValue = av.Value, true
+			}
+		case *types.AttributeValueMemberN:
+			switch name {
+			case dynamoAttrCounter:
+				item.counter = av.Value
+			case dynamoAttrVersion:
+				item.version, _ = strconv.ParseInt(av.Value, 10, 64)
+			case dynamoAttrExpiresAt:
+				item.expiresAt, _ = strconv.ParseInt(av.Value, 10, 64)
+			}
+		}
+	}
+	return item
+}
+
+// live reports whether the item has no expiration or expires after now (in epoch milliseconds)
+func (i dynamoItem) live(now int64) bool {
+	return i.expiresAt == 0 || i.expiresAt > now
+}
+
+// ttl returns the remaining time to live of the item, or NoExpiration if it has none
+func (i dynamoItem) ttl() time.Duration {
+	if i.expiresAt == 0 {
+		return datarepository.NoExpiration
+	}
+	return time.Until(time.UnixMilli(i.expiresAt))
+}
+
+func (i dynamoItem) identifier() DynamoIdentifier {
+	return DynamoIdentifier{EntityPrefix: i.entityPrefix, ID: i.id}
+}
+
+func dynamoS(s string) types.AttributeValue {
+	return &types.AttributeValueMemberS{Value: s}
+}
+
+func dynamoN(n int64) types.AttributeValue {
+	return &types.AttributeValueMemberN{Value: strconv.FormatInt(n, 10)}
+}
+
+func dynamoB(b []byte) types.AttributeValue {
+	return &types.AttributeValueMemberB{Value: b}
+}
+
+// dynamoKey returns the primary key of the item (entityPrefix, id)
+func dynamoKey(entityPrefix, id string) map[string]types.AttributeValue {
+	return map[string]types.AttributeValue{
+		dynamoAttrEntityPrefix: dynamoS(entityPrefix),
+		dynamoAttrID:           dynamoS(id),
+	}
+}
+
+// dynamoLockKey returns the primary key of the lock for the entity (entityPrefix, id)
+func dynamoLockKey(entityPrefix, id string) map[string]types.AttributeValue {
+	return dynamoKey(dynamoLockPartition, entityPrefix+datarepository.DefaultKeySeparator+id)
+}
+
+// nowMillis returns the current time as stored in expires_at
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// expiresAt returns the expires_at value for an expiration starting now
+func expiresAt(expiration time.Duration) int64 {
+	return time.Now().Add(expiration).UnixMilli()
+}
+
+// expiryValues returns the :e and :t values of an expiration starting now: the time in epoch
+// milliseconds that reads compare against, and the time in epoch seconds, rounded up, that
+// DynamoDB's time to live feature deletes the item after
+func expiryValues(expiration time.Duration) map[string]types.AttributeValue {
+	millis := expiresAt(expiration)
+	return map[string]types.AttributeValue{
+		":e": dynamoN(millis),
+		":t": dynamoN((millis + 999) / 1000),
+	}
+}
+
+// dynamoValues merges the values of placeholders and adds :now, the current time in epoch milliseconds
+func dynamoValues(sets ...map[string]types.AttributeValue) map[string]types.AttributeValue {
+	values := make(map[string]types.AttributeValue)
+	for _, set := range sets {
+		for placeholder, value := range set {
+			values[placeholder] = value
+		}
+	}
+	values[":now"] = dynamoN(nowMillis())
+	return values
+}
+
+// placeholders returns the attribute names and values the expressions refer to. DynamoDB
+// rejects requests with unused names or values, so only these are sent.
+func (r *DynamoRepository) placeholders(values map[string]types.AttributeValue, expressions ...string) (map[string]string, map[string]types.AttributeValue) {
+	var names map[string]string
+	var used map[string]types.AttributeValue
+	for _, expression := range expressions {
+		for _, placeholder := range dynamoPlaceholderRegex.FindAllString(expression, -1) {
+			if placeholder[0] == '#' {
+				if names == nil {
+					names = make(map[string]string)
+				}
+				names[placeholder] = r.attributeNames[placeholder]
+			} else if value, ok := values[placeholder]; ok {
+				if used == nil {
+					used = make(map[string]types.AttributeValue)
+				}
+				used[placeholder] = value
+			}
+		}
+	}
+	return names, used
+}
+
+// optional returns nil for an empty expression, which DynamoDB doesn't accept
+func optional(expression string) *string {
+	if expression == "" {
+		return nil
+	}
+	return aws.String(expression)
+}
+
+// dynamoConditionFailed is returned by the write helpers if the condition of a write didn't
+// hold. It carries the item as it was, if it existed.
+type dynamoConditionFailed struct {
+	item map[string]types.AttributeValue
+}
+
+func (e *dynamoConditionFailed) Error() string {
+	return "condition not met"
+}
+
+// conditionFailed returns the error of a write whose condition didn't hold, or nil
+func conditionFailed(err error) *dynamoConditionFailed {
+	var failed *dynamoConditionFailed
+	if errors.As(err, &failed) {
+		return failed
+	}
+	return nil
+}
+
+// writeError converts an error of a write
+func writeError(err error) error {
+	var failed *types.ConditionalCheckFailedException
+	if errors.As(err, &failed) {
+		return &dynamoConditionFailed{item: failed.Item}
+	}
+	return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+}
+
+// put writes the item if cond holds
+func (r *DynamoRepository) put(ctx context.Context, item map[string]types.AttributeValue, cond string, values map[string]types.AttributeValue) error {
+	names, used := r.placeholders(values, cond)
+	_, err := r.client.PutItem(ctx, &dynamodb.PutItemInput{
+		TableName:                           &r.table,
+		Item:                                item,
+		ConditionExpression:                 optional(cond),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           used,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return writeError(err)
+	}
+	return nil
+}
+
+// update applies the update expression to the item if cond holds. Returns the attributes
+// selected by returnValues.
+func (r *DynamoRepository) update(ctx context.Context, key map[string]types.AttributeValue, update, cond string, values map[string]types.AttributeValue, returnValues types.ReturnValue) (map[string]types.AttributeValue, error) {
+	names, used := r.placeholders(values, update, cond)
+	out, err := r.client.UpdateItem(ctx, &dynamodb.UpdateItemInput{
+		TableName:                           &r.table,
+		Key:                                 key,
+		UpdateExpression:                    aws.String(update),
+		ConditionExpression:                 optional(cond),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           used,
+		ReturnValues:                        returnValues,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return nil, writeError(err)
+	}
+	return out.Attributes, nil
+}
+
+// delete deletes the item if cond holds. Returns the deleted attributes if returnValues is ALL_OLD.
+func (r *DynamoRepository) delete(ctx context.Context, key map[string]types.AttributeValue, cond string, values map[string]types.AttributeValue, returnValues types.ReturnValue) (map[string]types.AttributeValue, error) {
+	names, used := r.placeholders(values, cond)
+	out, err := r.client.DeleteItem(ctx, &dynamodb.DeleteItemInput{
+		TableName:                           &r.table,
+		Key:                                 key,
+		ConditionExpression:                 optional(cond),
+		ExpressionAttributeNames:            names,
+		ExpressionAttributeValues:           used,
+		ReturnValues:                        returnValues,
+		ReturnValuesOnConditionCheckFailure: types.ReturnValuesOnConditionCheckFailureAllOld,
+	})
+	if err != nil {
+		return nil, writeError(err)
+	}
+	return out.Attributes, nil
+}
+
+// getAttributes returns the attributes of the item with the given key, expired or not, or nil
+// if it doesn't exist
+func (r *DynamoRepository) getAttributes(ctx context.Context, key map[string]types.AttributeValue) (map[string]types.AttributeValue, error) {
+	out, err := r.client.GetItem(ctx, &dynamodb.GetItemInput{
+		TableName:      &r.table,
+		Key:            key,
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return out.Item, nil
+}
+
+// get returns the item with the given key, or ErrNotFound if it doesn't exist or is expired.
+// Expired items are deleted on the way, ahead of DynamoDB's time to live.
+func (r *DynamoRepository) get(ctx context.Context, key map[string]types.AttributeValue) (dynamoItem, error) {
+	attributes, err := r.getAttributes(ctx, key)
+	if err != nil {
+		return dynamoItem{}, err
+	}
+	if attributes == nil {
+		return dynamoItem{}, datarepository.ErrNotFound
+	}
+	item := parseDynamoItem(attributes)
+	if !item.live(nowMillis()) {
+		r.deleteExpired(ctx, key)
+		return dynamoItem{}, datarepository.ErrNotFound
+	}
+	return item, nil
+}
+
+// previous returns the item a failed conditional write found, or nil if there was none. Older
+// versions of DynamoDB Local don't return the item with the error, so it is read instead.
+func (r *DynamoRepository) previous(ctx context.Context, key map[string]types.AttributeValue, failed *dynamoConditionFailed) (map[string]types.AttributeValue, error) {
+	if failed.item != nil {
+		return failed.item, nil
+	}
+	return r.getAttributes(ctx, key)
+}
+
+// deleteExpired deletes the item if it is expired. Failures are ignored because time to live
+// deletes it eventually.
+func (r *DynamoRepository) deleteExpired(ctx context.Context, key map[string]types.AttributeValue) {
+	_, _ = r.delete(ctx, key, "#e <= :now", dynamoValues(), types.ReturnValueNone)
+}
+
+// encode serializes an entity value with the configured codec.
+// Returns ErrInvalidInput if value is nil.
+func (r *DynamoRepository) encode(value interface{}) ([]byte, error) {
+	if err := datarepository.CheckValue(value); err != nil {
+		return nil, err
+	}
+	return r.encodeField(value)
+}
+
+// encodeField serializes value with the configured codec. Unlike encode, it accepts nil, which
+// UpdateField stores as null.
+func (r *DynamoRepository) encodeField(value interface{}) ([]byte, error) {
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+	}
+	return data, nil
+}
+
+// data returns the serialized value of an item; the number of a counter is serialized with the codec
+func (r *DynamoRepository) data(item dynamoItem) ([]byte, error) {
+	if item.hasValue {
+		return item.value, nil
+	}
+	var number interface{}
+	if n, err := strconv.ParseInt(item.counter, 10, 64); err == nil {
+		number = n
+	} else if f, err := strconv.ParseFloat(item.counter, 64); err == nil {
+		number = f
+	} else {
+		return nil, fmt.Errorf("%w: item %s has neither a value nor a counter", datarepository.ErrOperationFailed, item.identifier())
+	}
+	data, err := r.codec.Marshal(number)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return data, nil
+}
+
+// read returns the live item of the entity with the given identifier, or ErrNotFound
+func (r *DynamoRepository) read(ctx context.Context, identifier datarepository.EntityIdentifier) (dynamoItem, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return dynamoItem{}, err
+	}
+	return r.get(ctx, dynamoKey(prefix, id))
+}
+
+// unchanged returns a condition that holds while the value or counter of the item is the one read
+func unchanged(item dynamoItem) (string, map[string]types.AttributeValue) {
+	if item.hasValue {
+		return "#v = :old AND " + dynamoLive, map[string]types.AttributeValue{":old": dynamoB(item.value)}
+	}
+	return "#c = :old AND " + dynamoLive, map[string]types.AttributeValue{":old": &types.AttributeValueMemberN{Value: item.counter}}
+}
+
+// modify applies fn to the current value of an existing entity and stores the result if the
+// value wasn't modified in the meantime, retrying otherwise. The entity keeps its expiration
+// and version. Returns the value fn was applied to.
+func (r *DynamoRepository) modify(ctx context.Context, identifier datarepository.EntityIdentifier, fn func(current []byte) ([]byte, error)) ([]byte, error) {
+	for attempt := 0; attempt < DynamoMaxRetries; attempt++ {
+		item, err := r.read(ctx, identifier)
+		if err != nil {
+			return nil, err
+		}
+		current, err := r.data(item)
+		if err != nil {
+			return nil, err
+		}
+		updated, err := fn(current)
+		if err != nil {
+			return nil, err
+		}
+		cond, values := unchanged(item)
+		values[":v"] = dynamoB(updated)
+		_, err = r.update(ctx, dynamoKey(item.entityPrefix, item.id), "SET #v = :v REMOVE #c", cond, dynamoValues(values), types.ReturnValueNone)
+		if conditionFailed(err) == nil {
+			return current, err
+		}
+	}
+	return nil, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+// create writes a new entity with an optional expiration if none exists or the existing one is
+// expired. Returns false if a live entity exists.
+func (r *DynamoRepository) create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return false, err
+	}
+	item := dynamoKey(prefix, id)
+	item[dynamoAttrValue] = dynamoB(data)
+	if ttl > 0 {
+		expiry := expiryValues(ttl)
+		item[dynamoAttrExpiresAt] = expiry[":e"]
+		item[r.attributeNames["#t"]] = expiry[":t"]
+	}
+	err = r.put(ctx, item, dynamoAbsent, dynamoValues())
+	if conditionFailed(err) != nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *DynamoRepository) Create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	created, err := r.create(ctx, identifier, value, 0)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return datarepository.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *DynamoRepository) CreateIfAbsent(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", datarepository.ErrInvalidInput)
+	}
+	return r.create(ctx, identifier, value, ttl)
+}
+
+func (r *DynamoRepository) CreateWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return datarepository.CreateWithTTL(ctx, r, identifier, value, ttl)
+}
+
+func (r *DynamoRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (datarepository.EntityIdentifier, error) {
+	if !datarepository.IsValidEntityPrefix(entityPrefix) {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidIdentifier, datarepository.ErrInvalidEntityPrefix)
+	}
+	return datarepository.CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) datarepository.EntityIdentifier {
+		return DynamoIdentifier{EntityPrefix: entityPrefix, ID: id}
+	})
+}
+
+func (r *DynamoRepository) Read(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	item, err := r.read(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.data(item)
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *DynamoRepository) Exists(ctx context.Context, identifier datarepository.EntityIdentifier) (bool, error) {
+	_, err := r.read(ctx, identifier)
+	if datarepository.IsNotFoundError(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *DynamoRepository) ExistsMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) (map[datarepository.EntityIdentifier]bool, error) {
+	return datarepository.ExistsMany(ctx, r, identifiers)
+}
+
+func (r *DynamoRepository) ReadWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) (time.Duration, error) {
+	item, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, err := r.data(item)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.codec.Unmarshal(data, value); err != nil {
+		return 0, err
+	}
+	return item.ttl(), nil
+}
+
+// upsert sets the value or the counter attribute of an entity, creating it if it doesn't exist,
+// and removes the other one. A live entity keeps its version and, unless a ttl is given, its
+// expiration; an expired one is replaced.
+func (r *DynamoRepository) upsert(ctx context.Context, prefix, id, attribute string, value types.AttributeValue, ttl time.Duration) error {
+	set, remove := "#v", "#c"
+	if attribute == dynamoAttrCounter {
+		set, remove = "#c", "#v"
+	}
+	update := "SET " + set + " = :v"
+	values := map[string]types.AttributeValue{":v": value}
+	if ttl > 0 {
+		update += ", #e = :e, #t = :t"
+		values = dynamoValues(values, expiryValues(ttl))
+	}
+	update += " REMOVE " + remove
+	_, err := r.update(ctx, dynamoKey(prefix, id), update, dynamoLive, dynamoValues(values), types.ReturnValueNone)
+	if conditionFailed(err) == nil {
+		return err
+	}
+
+	item := dynamoKey(prefix, id)
+	item[attribute] = value
+	if ttl > 0 {
+		item[dynamoAttrExpiresAt] = values[":e"]
+		item[r.attributeNames["#t"]] = values[":t"]
+	}
+	return r.put(ctx, item, "", nil)
+}
+
+func (r *DynamoRepository) Upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.upsert(ctx, prefix, id, dynamoAttrValue, dynamoB(data), 0)
+}
+
+func (r *DynamoRepository) UpsertWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.upsert(ctx, prefix, id, dynamoAttrValue, dynamoB(data), ttl)
+}
+
+func (r *DynamoRepository) UpsertManyWithTTL(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		if err := r.UpsertWithTTL(ctx, identifier, value, ttl); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *DynamoRepository) Update(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	values := dynamoValues(map[string]types.AttributeValue{":v": dynamoB(data)})
+	_, err = r.update(ctx, dynamoKey(prefix, id), "SET #v = :v REMOVE #c", dynamoExistsAndLive, values, types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	return err
+}
+
+// errValueMismatch aborts the modification made by CompareAndSwap
+var errValueMismatch = errors.New("value does not match")
+
+func (r *DynamoRepository) CompareAndSwap(ctx context.Context, identifier datarepository.EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	data, err := r.encode(newValue)
+	if err != nil {
+		return false, err
+	}
+	_, err = r.modify(ctx, identifier, func(current []byte) ([]byte, error) {
+		equal, err := datarepository.EqualEncoded(r.codec, current, expected)
+		if err != nil {
+			return nil, err
+		}
+		if !equal {
+			return nil, errValueMismatch
+		}
+		return data, nil
+	})
+	if errors.Is(err, errValueMismatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// UpdateWithVersion increments the version attribute in the same conditional update that
+// writes the value. A missing version attribute counts as version 0.
+func (r *DynamoRepository) UpdateWithVersion(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return 0, err
+	}
+
+	cond := dynamoExistsAndLive + " AND #ver = :ver"
+	if expectedVersion == 0 {
+		cond = dynamoExistsAndLive + " AND (attribute_not_exists(#ver) OR #ver = :ver)"
+	}
+	values := dynamoValues(map[string]types.AttributeValue{
+		":v":   dynamoB(data),
+		":ver": dynamoN(expectedVersion),
+		":one": dynamoN(1),
+	})
+	key := dynamoKey(prefix, id)
+	_, err = r.update(ctx, key, "SET #v = :v REMOVE #c ADD #ver :one", cond, values, types.ReturnValueNone)
+	if failed := conditionFailed(err); failed != nil {
+		previous, err := r.previous(ctx, key, failed)
+		if err != nil {
+			return 0, err
+		}
+		if previous == nil || !parseDynamoItem(previous).live(nowMillis()) {
+			return 0, datarepository.ErrNotFound
+		}
+		return 0, datarepository.ErrVersionConflict
+	}
+	if err != nil {
+		return 0, err
+	}
+	return expectedVersion + 1, nil
+}
+
+func (r *DynamoRepository) GetVersion(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	item, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	return item.version, nil
+}
+
+// toGeneric decodes a stored value into its generic representation (maps, slices and scalars)
+func (r *DynamoRepository) toGeneric(data []byte) (interface{}, error) {
+	var generic interface{}
+	if err := r.codec.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return generic, nil
+}
+
+func (r *DynamoRepository) UpdateField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	encoded, err := r.encodeField(value)
+	if err != nil {
+		return err
+	}
+	fieldValue, err := r.toGeneric(encoded)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.modify(ctx, identifier, func(current []byte) ([]byte, error) {
+		doc, err := r.toGeneric(current)
+		if err != nil {
+			return nil, err
+		}
+		if err := datarepository.SetFieldPath(doc, parts, fieldValue); err != nil {
+			return nil, err
+		}
+		return r.encode(doc)
+	})
+	return err
+}
+
+func (r *DynamoRepository) ReadField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	item, err := r.read(ctx, identifier)
+	if err != nil {
+		return err
+	}
+	current, err := r.data(item)
+	if err != nil {
+		return err
+	}
+
+	doc, err := r.toGeneric(current)
+	if err != nil {
+		return err
+	}
+	field, err := datarepository.GetFieldPath(doc, parts)
+	if err != nil {
+		return err
+	}
+	data, err := r.codec.Marshal(field)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *DynamoRepository) Delete(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	_, err = r.delete(ctx, dynamoKey(prefix, id), dynamoExistsAndLive, dynamoValues(), types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	return err
+}
+
+func (r *DynamoRepository) GetAndDelete(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	deleted, err := r.delete(ctx, dynamoKey(prefix, id), dynamoExistsAndLive, dynamoValues(), types.ReturnValueAllOld)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	data, err := r.data(parseDynamoItem(deleted))
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *DynamoRepository) GetAndSet(ctx context.Context, identifier datarepository.EntityIdentifier, newValue, oldValue interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return err
+	}
+	values := dynamoValues(map[string]types.AttributeValue{":v": dynamoB(data)})
+	previous, err := r.update(ctx, dynamoKey(prefix, id), "SET #v = :v REMOVE #c", dynamoExistsAndLive, values, types.ReturnValueAllOld)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	if err != nil {
+		return err
+	}
+	old, err := r.data(parseDynamoItem(previous))
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(old, oldValue)
+}
+
+func (r *DynamoRepository) CreateMany(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}) error {
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		if err := r.Create(ctx, identifier, value); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *DynamoRepository) ReadMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		item, err := r.read(ctx, identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		data, err := r.data(item)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		if err := fn(identifier, data); err != nil {
+			return err
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *DynamoRepository) ReadManyOrdered(ctx context.Context, identifiers []datarepository.EntityIdentifier, dest interface{}) error {
+	return datarepository.ReadManyOrdered(ctx, r, r.codec, identifiers, dest)
+}
+
+func (r *DynamoRepository) DeleteMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.Delete(ctx, identifier); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern collects the matching entities with Iterate and removes them with DeleteMany
+func (r *DynamoRepository) DeletePattern(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	return datarepository.DeletePattern(ctx, r, pattern)
+}
+
+// eachPage calls fn with the live entities matching the glob pattern, one page of results at a
+// time. A pattern whose literal start includes the entity prefix is a Query of that partition,
+// narrowed with begins_with to the literal start of the id; any other pattern needs a Scan of
+// the whole table. The pattern itself is applied to the results, as DynamoDB has no glob
+// matching. Queries return items sorted by id, scans in no particular order.
+func (r *DynamoRepository) eachPage(ctx context.Context, pattern string, keysOnly bool, fn func(items []dynamoItem) error) error {
+	regex, err := regexp.Compile(datarepository.GlobToRegex(pattern))
+	if err != nil {
+		return fmt.Errorf("%w: invalid pattern", datarepository.ErrInvalidInput)
+	}
+	var projection string
+	if keysOnly {
+		projection = "#p, #i, #e"
+	}
+
+	var keyCondition, filter string
+	values := map[string]types.AttributeValue{}
+	literal := datarepository.GlobLiteralPrefix(pattern)
+	if entityPrefix, id, found := strings.Cut(literal, datarepository.DefaultKeySeparator); found {
+		keyCondition = "#p = :p"
+		values[":p"] = dynamoS(entityPrefix)
+		if id != "" {
+			keyCondition += " AND begins_with(#i, :i)"
+			values[":i"] = dynamoS(id)
+		}
+	} else if literal != "" {
+		filter = "begins_with(#p, :p)"
+		values[":p"] = dynamoS(literal)
+	}
+
+	var startKey map[string]types.AttributeValue
+	for {
+		var page []map[string]types.AttributeValue
+		if keyCondition != "" {
+			names, used := r.placeholders(values, keyCondition, projection)
+			out, err := r.client.Query(ctx, &dynamodb.QueryInput{
+				TableName:                 &r.table,
+				KeyConditionExpression:    aws.String(keyCondition),
+				ProjectionExpression:      optional(projection),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: used,
+				ExclusiveStartKey:         startKey,
+				ConsistentRead:            aws.Bool(true),
+			})
+			if err != nil {
+				return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+			}
+			page, startKey = out.Items, out.LastEvaluatedKey
+		} else {
+			names, used := r.placeholders(values, filter, projection)
+			out, err := r.client.Scan(ctx, &dynamodb.ScanInput{
+				TableName:                 &r.table,
+				FilterExpression:          optional(filter),
+				ProjectionExpression:      optional(projection),
+				ExpressionAttributeNames:  names,
+				ExpressionAttributeValues: used,
+				ExclusiveStartKey:         startKey,
+				ConsistentRead:            aws.Bool(true),
+			})
+			if err != nil {
+				return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+			}
+			page, startKey = out.Items, out.LastEvaluatedKey
+		}
+
+		now := nowMillis()
+		items := make([]dynamoItem, 0, len(page))
+		for _, attributes := range page {
+			item := parseDynamoItem(attributes)
+			if !datarepository.IsValidEntityPrefix(item.entityPrefix) || !item.live(now) {
+				continue
+			}
+			if regex.MatchString(item.identifier().String()) {
+				items = append(items, item)
+			}
+		}
+		if err := fn(items); err != nil {
+			return err
+		}
+		if len(startKey) == 0 {
+			return nil
+		}
+	}
+}
+
+// matchingItems returns the live entities matching the glob pattern, sorted by identifier
+func (r *DynamoRepository) matchingItems(ctx context.Context, pattern string, keysOnly bool) ([]dynamoItem, error) {
+	var items []dynamoItem
+	err := r.eachPage(ctx, pattern, keysOnly, func(page []dynamoItem) error {
+		items = append(items, page...)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].entityPrefix != items[j].entityPrefix {
+			return items[i].entityPrefix < items[j].entityPrefix
+		}
+		return items[i].id < items[j].id
+	})
+	return items, nil
+}
+
+// decodeItems decodes the values of the given items. Items that can't be decoded are reported
+// as skipped.
+func (r *DynamoRepository) decodeItems(items []dynamoItem) datarepository.ListResult {
+	result := datarepository.ListResult{
+		Identifiers: make([]datarepository.EntityIdentifier, 0, len(items)),
+		Entities:    make([]interface{}, 0, len(items)),
+	}
+	for _, item := range items {
+		identifier := item.identifier()
+		data, err := r.data(item)
+		var entity interface{}
+		if err == nil {
+			err = r.codec.Unmarshal(data, &entity)
+		}
+		if err != nil {
+			r.logger.Warnf("skipping item %q that could not be decoded: %v", identifier.String(), err)
+			result.Skipped = append(result.Skipped, datarepository.SkippedKey{Key: identifier.String(), Err: err})
+			continue
+		}
+		result.Identifiers = append(result.Identifiers, identifier)
+		result.Entities = append(result.Entities, entity)
+	}
+	return result
+}
+
+func (r *DynamoRepository) List(ctx context.Context, pattern string) ([]datarepository.EntityIdentifier, []interface{}, error) {
+	result, err := r.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(r.notFoundOnEmpty)
+}
+
+func (r *DynamoRepository) ListDetailed(ctx context.Context, pattern string) (datarepository.ListResult, error) {
+	items, err := r.matchingItems(ctx, pattern, false)
+	if err != nil {
+		return datarepository.ListResult{}, err
+	}
+	result := r.decodeItems(items)
+	if len(result.Identifiers) == 0 && len(result.Skipped) == 0 && r.notFoundOnEmpty {
+		return datarepository.ListResult{}, datarepository.ErrNotFound
+	}
+	return result, nil
+}
+
+func (r *DynamoRepository) Count(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	var count int64
+	err := r.eachPage(ctx, pattern.String(), true, func(items []dynamoItem) error {
+		count += int64(len(items))
+		return nil
+	})
+	return count, err
+}
+
+// Iterate passes the matching entities to fn one page of DynamoDB results at a time. Entities
+// of a single entity prefix come in order of their ids, others in no particular order.
+func (r *DynamoRepository) Iterate(ctx context.Context, pattern datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	return r.eachPage(ctx, pattern.String(), false, func(items []dynamoItem) error {
+		for _, item := range items {
+			data, err := r.data(item)
+			if err != nil {
+				return err
+			}
+			if err := fn(item.identifier(), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+func (r *DynamoRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]datarepository.EntityIdentifier, []interface{}, uint64, error) {
+	if pageSize <= 0 {
+		return nil, nil, 0, fmt.Errorf("%w: page size must be positive", datarepository.ErrInvalidInput)
+	}
+	items, err := r.matchingItems(ctx, pattern, false)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// The cursor is an offset into the sorted list of matching entities
+	if cursor >= uint64(len(items)) {
+		return []datarepository.EntityIdentifier{}, []interface{}{}, 0, nil
+	}
+	end := cursor + uint64(pageSize)
+	nextCursor := end
+	if end >= uint64(len(items)) {
+		end = uint64(len(items))
+		nextCursor = 0
+	}
+	result := r.decodeItems(items[cursor:end])
+	return result.Identifiers, result.Entities, nextCursor, nil
+}
+
+func (r *DynamoRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]datarepository.EntityIdentifier, string, error) {
+	return datarepository.ListPage(ctx, r, pattern, cursor, pageSize)
+}
+
+func (r *DynamoRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	seen := make(map[string]struct{})
+	err := r.eachPage(ctx, "*", true, func(items []dynamoItem) error {
+		for _, item := range items {
+			seen[item.entityPrefix] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (r *DynamoRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *DynamoRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]datarepository.EntityIdentifier, error) {
+	return nil, fmt.Errorf("%w: the DynamoDB repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (datarepository.SearchResult, error) {
+	return datarepository.SearchResult{}, fmt.Errorf("%w: the DynamoDB repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) SearchResults(ctx context.Context, query string, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return datarepository.SearchResponse{}, fmt.Errorf("%w: the DynamoDB repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) SearchQuery(ctx context.Context, query *datarepository.Query, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return datarepository.SearchResponse{}, fmt.Errorf("%w: the DynamoDB repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) AcquireLock(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (bool, error) {
+	_, acquired, err := r.AcquireLockWithToken(ctx, identifier, ttl)
+	return acquired, err
+}
+
+// AcquireLockWithToken writes the lock item unless a live one exists. Its expiration is set on
+// the TTL attribute too, so DynamoDB eventually deletes locks that were never released.
+func (r *DynamoRepository) AcquireLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return "", false, err
+	}
+	token := datarepository.NewLockToken()
+	expiry := expiryValues(ttl)
+	item := dynamoLockKey(prefix, id)
+	item[dynamoAttrToken] = dynamoS(token)
+	item[dynamoAttrExpiresAt] = expiry[":e"]
+	item[r.attributeNames["#t"]] = expiry[":t"]
+
+	err = r.put(ctx, item, dynamoAbsent, dynamoValues())
+	if conditionFailed(err) != nil {
+		return "", false, nil
+	}
+	if err != nil {
+		return "", false, err
+	}
+	return token, true, nil
+}
+
+func (r *DynamoRepository) ReleaseLock(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	_, err = r.delete(ctx, dynamoLockKey(prefix, id), dynamoExistsAndLive, dynamoValues(), types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	return err
+}
+
+func (r *DynamoRepository) ReleaseLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	values := dynamoValues(map[string]types.AttributeValue{":tok": dynamoS(token)})
+	key := dynamoLockKey(prefix, id)
+	_, err = r.delete(ctx, key, "#tok = :tok AND #e > :now", values, types.ReturnValueNone)
+	if failed := conditionFailed(err); failed != nil {
+		previous, err := r.previous(ctx, key, failed)
+		if err != nil {
+			return err
+		}
+		if previous == nil || !parseDynamoItem(previous).live(nowMillis()) {
+			return datarepository.ErrNotFound
+		}
+		return datarepository.ErrLockNotOwned
+	}
+	return err
+}
+
+func (r *DynamoRepository) RenewLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	values := dynamoValues(map[string]types.AttributeValue{":tok": dynamoS(token)}, expiryValues(ttl))
+	_, err = r.update(ctx, dynamoLockKey(prefix, id), "SET #e = :e, #t = :t", "#tok = :tok AND #e > :now", values, types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *DynamoRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	return fmt.Errorf("%w: the DynamoDB repository does not support pub/sub", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	return nil, fmt.Errorf("%w: the DynamoDB repository does not support pub/sub", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) SubscribeMessages(ctx context.Context, channel string) (datarepository.Subscription, error) {
+	return nil, fmt.Errorf("%w: the DynamoDB repository does not support pub/sub", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) PSubscribe(ctx context.Context, pattern string) (datarepository.Subscription, error) {
+	return nil, fmt.Errorf("%w: the DynamoDB repository does not support pub/sub", datarepository.ErrNotSupported)
+}
+
+func (r *DynamoRepository) Ping(ctx context.Context) error {
+	if _, err := r.client.DescribeTable(ctx, &dynamodb.DescribeTableInput{TableName: &r.table}); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+// Close does nothing, as the DynamoDB client holds no connections that need closing
+func (r *DynamoRepository) Close() error {
+	return nil
+}
+
+func (r *DynamoRepository) SetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	_, err = r.update(ctx, dynamoKey(prefix, id), "SET #e = :e, #t = :t", dynamoExistsAndLive,
+		dynamoValues(expiryValues(expiration)), types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	return err
+}
+
+func (r *DynamoRepository) SetExpirationMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, expiration time.Duration) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.SetExpiration(ctx, identifier, expiration); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *DynamoRepository) SetExpirationCond(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration, cond datarepository.ExpirationCondition) (bool, error) {
+	// The condition is part of the update, so checking and setting happen atomically
+	var condition string
+	switch cond {
+	case datarepository.ExpireNX:
+		condition = "attribute_not_exists(#e)"
+	case datarepository.ExpireXX:
+		condition = "attribute_exists(#e)"
+	case datarepository.ExpireGT:
+		// No expiration counts as infinite, which can't be exceeded
+		condition = "attribute_exists(#e) AND #e < :e"
+	case datarepository.ExpireLT:
+		condition = "(attribute_not_exists(#e) OR #e > :e)"
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", datarepository.ErrInvalidInput, cond)
+	}
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = r.update(ctx, dynamoKey(prefix, id), "SET #e = :e, #t = :t", dynamoExistsAndLive+" AND "+condition,
+		dynamoValues(expiryValues(expiration)), types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *DynamoRepository) GetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier) (time.Duration, error) {
+	item, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	if item.expiresAt == 0 {
+		return 0, datarepository.ErrNotFound
+	}
+	return item.ttl(), nil
+}
+
+func (r *DynamoRepository) Persist(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	_, err = r.update(ctx, dynamoKey(prefix, id), "REMOVE #e, #t", dynamoExistsAndLive,
+		dynamoValues(), types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		return datarepository.ErrNotFound
+	}
+	return err
+}
+
+// Touch only checks that the entity exists
+func (r *DynamoRepository) Touch(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return datarepository.TouchExisting(ctx, r, identifier)
+}
+
+// add adds delta to the counter attribute of an entity with UpdateItem's ADD, which starts a
+// missing counter at 0. limit, if given, is a condition on the current counter (:limit is
+// bound to limitValue). An entity whose value is a number stored by Upsert is converted into a
+// counter first; an expired one is deleted. Returns the counter after the update, or the
+// current counter and false if the limit wasn't met.
+func (r *DynamoRepository) add(ctx context.Context, identifier datarepository.EntityIdentifier, delta types.AttributeValue, limit string, limitValue types.AttributeValue, ttl time.Duration, float bool) (string, bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return "", false, err
+	}
+	key := dynamoKey(prefix, id)
+
+	update := "ADD #c :d"
+	values := map[string]types.AttributeValue{":d": delta}
+	if ttl > 0 {
+		update += " SET #e = if_not_exists(#e, :e), #t = if_not_exists(#t, :t)"
+		values = dynamoValues(values, expiryValues(ttl))
+	}
+	cond := "attribute_not_exists(#v) AND " + dynamoLive
+	if limit != "" {
+		cond += " AND " + limit
+		values[":limit"] = limitValue
+	}
+
+	for attempt := 0; attempt < DynamoMaxRetries; attempt++ {
+		updated, err := r.update(ctx, key, update, cond, dynamoValues(values), types.ReturnValueUpdatedNew)
+		failed := conditionFailed(err)
+		if failed == nil {
+			if err != nil {
+				return "", false, err
+			}
+			return parseDynamoItem(updated).counter, true, nil
+		}
+
+		previous, err := r.previous(ctx, key, failed)
+		if err != nil {
+			return "", false, err
+		}
+		current := parseDynamoItem(previous)
+		switch {
+		case previous == nil:
+			// Only the limit can fail for a missing counter
+			if limit != "" {
+				return "", false, nil
+			}
+		case !current.live(nowMillis()):
+			r.deleteExpired(ctx, key)
+		case current.hasValue:
+			if err := r.toCounter(ctx, key, current, float); err != nil {
+				return "", false, err
+			}
+		default:
+			return current.counter, false, nil
+		}
+	}
+	return "", false, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+// toCounter replaces the value of an entity, which must be a number, with the counter attribute
+func (r *DynamoRepository) toCounter(ctx context.Context, key map[string]types.AttributeValue, item dynamoItem, float bool) error {
+	var number string
+	if float {
+		var value float64
+		if err := r.codec.Unmarshal(item.value, &value); err != nil {
+			return fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+		}
+		number = strconv.FormatFloat(value, 'f', -1, 64)
+	} else {
+		var value int64
+		if err := r.codec.Unmarshal(item.value, &value); err != nil {
+			return fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+		}
+		number = strconv.FormatInt(value, 10)
+	}
+	cond, values := unchanged(item)
+	values[":n"] = &types.AttributeValueMemberN{Value: number}
+	_, err := r.update(ctx, key, "SET #c = :n REMOVE #v", cond, dynamoValues(values), types.ReturnValueNone)
+	if conditionFailed(err) != nil {
+		// Modified in the meantime, the caller retries
+		return nil
+	}
+	return err
+}
+
+// parseCounter parses the counter attribute of an entity
+func parseCounter(counter string) (int64, error) {
+	value, err := strconv.ParseInt(counter, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (r *DynamoRepository) AtomicIncrement(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return r.IncrementBy(ctx, identifier, 1)
+}
+
+func (r *DynamoRepository) IncrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	counter, _, err := r.add(ctx, identifier, dynamoN(delta), "", nil, 0, false)
+	if err != nil {
+		return 0, err
+	}
+	return parseCounter(counter)
+}
+
+func (r *DynamoRepository) DecrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	return r.IncrementBy(ctx, identifier, -delta)
+}
+
+// IncrementWithLimit makes the limit part of the update's condition: the counter must be at
+// most max-delta before the update
+func (r *DynamoRepository) IncrementWithLimit(ctx context.Context, identifier datarepository.EntityIdentifier, delta, max int64) (int64, bool, error) {
+	var limit string
+	switch {
+	case delta < 0 && max > math.MaxInt64+delta:
+		// max-delta overflows, so every counter is within the limit
+	case delta > max:
+		// A missing counter starts at 0, which exceeds the limit too
+		limit = "#c <= :limit"
+	default:
+		limit = "(attribute_not_exists(#c) OR #c <= :limit)"
+	}
+	counter, applied, err := r.add(ctx, identifier, dynamoN(delta), limit, dynamoN(max-delta), 0, false)
+	if err != nil {
+		return 0, false, err
+	}
+	if counter == "" {
+		// The counter doesn't exist and starting it at delta would exceed the limit
+		return 0, false, nil
+	}
+	value, err := parseCounter(counter)
+	if err != nil {
+		return 0, false, err
+	}
+	return value, applied, nil
+}
+
+// IncrementWithExpiry sets the expiration in the same update as the counter, unless the
+// counter already has one
+func (r *DynamoRepository) IncrementWithExpiry(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	counter, _, err := r.add(ctx, identifier, dynamoN(delta), "", nil, ttl, false)
+	if err != nil {
+		return 0, err
+	}
+	return parseCounter(counter)
+}
+
+func (r *DynamoRepository) IncrementFloat(ctx context.Context, identifier datarepository.EntityIdentifier, delta float64) (float64, error) {
+	if math.IsNaN(delta) || math.IsInf(delta, 0) {
+		return 0, fmt.Errorf("%w: delta must be a finite number", datarepository.ErrInvalidInput)
+	}
+	counter, _, err := r.add(ctx, identifier, &types.AttributeValueMemberN{Value: strconv.FormatFloat(delta, 'f', -1, 64)}, "", nil, 0, true)
+	if err != nil {
+		return 0, err
+	}
+	value, err := strconv.ParseFloat(counter, 64)
+	if err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (r *DynamoRepository) GetCounter(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	item, err := r.read(ctx, identifier)
+	if err != nil {
+		return 0, err
+	}
+	if !item.hasValue {
+		return parseCounter(item.counter)
+	}
+	var value int64
+	if err := r.codec.Unmarshal(item.value, &value); err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (r *DynamoRepository) SetCounter(ctx context.Context, identifier datarepository.EntityIdentifier, value int64) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	return r.upsert(ctx, prefix, id, dynamoAttrCounter, dynamoN(value), 0)
+}
+
+// WithTransaction is not supported: DynamoDB transactions are single requests of up to 100
+// conditional writes, which can't run arbitrary operations like those of fn
+func (r *DynamoRepository) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	return fmt.Errorf("%w: the DynamoDB repository does not support transactions", datarepository.ErrNotSupported)
+}
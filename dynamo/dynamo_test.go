@@ -0,0 +1,130 @@
+//go:build integration
+
+// dynamo/dynamo_test.go
+
+package dynamo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/dynamodb"
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/itsatony/go-datarepository/datarepositorytest"
+)
+
+// newTestDynamoRepository returns a DynamoRepository on the DynamoDB Local container at
+// DYNAMODB_ENDPOINT, e.g. "http://localhost:8000", using a table of its own that is deleted when
+// the test ends. Skips the test if DYNAMODB_ENDPOINT is not set.
+func newTestDynamoRepository(t *testing.T) *DynamoRepository {
+	t.Helper()
+	endpoint := os.Getenv("DYNAMODB_ENDPOINT")
+	if endpoint == "" {
+		t.Skip("DYNAMODB_ENDPOINT not set")
+	}
+	repo, err := NewDynamoRepository(DynamoConfig{
+		Table:    fmt.Sprintf("datarepository_test_%d", time.Now().UnixNano()),
+		Region:   "us-east-1",
+		Endpoint: endpoint,
+		// DynamoDB Local accepts any credentials
+		AccessKeyID:     "test",
+		SecretAccessKey: "test",
+	})
+	if err != nil {
+		t.Fatalf("NewDynamoRepository: %v", err)
+	}
+	dynamo := repo.(*DynamoRepository)
+	t.Cleanup(func() {
+		if _, err := dynamo.client.DeleteTable(context.Background(), &dynamodb.DeleteTableInput{TableName: aws.String(dynamo.table)}); err != nil {
+			t.Errorf("deleting the test table: %v", err)
+		}
+		dynamo.Close()
+	})
+	return dynamo
+}
+
+func TestDynamoConformance(t *testing.T) {
+	datarepositorytest.Conformance(t, newTestDynamoRepository(t))
+}
+
+func TestDynamoListQueriesByPrefix(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestDynamoRepository(t)
+	for _, id := range []string{"user:1", "user:12", "user:2", "user:a.b", "order:1"} {
+		if err := repo.Create(ctx, datarepository.SimpleIdentifier(id), map[string]string{"id": id}); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+	for pattern, want := range map[string]int{"user:*": 4, "user:1*": 2, "user:?": 2, "user:a.b": 1, "order:*": 1, "*": 5} {
+		if ids, _, err := repo.List(ctx, pattern); err != nil || len(ids) != want {
+			t.Errorf("List(%q): got %v, %v, want %d entities", pattern, ids, err, want)
+		}
+	}
+}
+
+func TestDynamoExpiration(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestDynamoRepository(t)
+	id := datarepository.SimpleIdentifier("session:1")
+	if err := repo.Create(ctx, id, map[string]string{"user": "ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.SetExpiration(ctx, id, time.Second); err != nil {
+		t.Fatalf("SetExpiration: %v", err)
+	}
+	if remaining, err := repo.GetExpiration(ctx, id); err != nil || remaining <= 0 || remaining > time.Second {
+		t.Errorf("GetExpiration: got %v, %v, want at most 1s", remaining, err)
+	}
+	// DynamoDB deletes expired items only eventually, so reads check the expiration themselves
+	time.Sleep(1500 * time.Millisecond)
+	if exists, err := repo.Exists(ctx, id); err != nil || exists {
+		t.Errorf("Exists after expiration: got %v, %v, want false", exists, err)
+	}
+}
+
+func TestDynamoLockExpires(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestDynamoRepository(t)
+	id := datarepository.SimpleIdentifier("job:1")
+	if acquired, err := repo.AcquireLock(ctx, id, time.Second); err != nil || !acquired {
+		t.Fatalf("AcquireLock: got %v, %v, want the lock", acquired, err)
+	}
+	if acquired, err := repo.AcquireLock(ctx, id, time.Second); err != nil || acquired {
+		t.Errorf("AcquireLock of a held lock: got %v, %v, want false", acquired, err)
+	}
+	time.Sleep(1500 * time.Millisecond)
+	if acquired, err := repo.AcquireLock(ctx, id, time.Second); err != nil || !acquired {
+		t.Errorf("AcquireLock after the lock expired: got %v, %v, want the lock", acquired, err)
+	}
+}
+
+func TestDynamoConcurrentIncrements(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestDynamoRepository(t)
+	id := datarepository.SimpleIdentifier("hits:1")
+	const workers, increments = 4, 10
+	errs := make(chan error, workers)
+	for w := 0; w < workers; w++ {
+		go func() {
+			for i := 0; i < increments; i++ {
+				if _, err := repo.AtomicIncrement(ctx, id); err != nil {
+					errs <- err
+					return
+				}
+			}
+			errs <- nil
+		}()
+	}
+	for w := 0; w < workers; w++ {
+		if err := <-errs; err != nil {
+			t.Fatalf("AtomicIncrement: %v", err)
+		}
+	}
+	if got, err := repo.GetCounter(ctx, id); err != nil || got != workers*increments {
+		t.Errorf("GetCounter: got %d, %v, want %d", got, err, workers*increments)
+	}
+}
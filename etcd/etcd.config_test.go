@@ -0,0 +1,27 @@
+// etcd/etcd.config_test.go
+
+package etcd
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	datarepository "github.com/itsatony/go-datarepository"
+)
+
+func TestCreateDataRepositoryRejectsInvalidEtcdConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		config EtcdConfig
+		want   string
+	}{
+		{EtcdConfig{}, "EtcdConfig: Endpoints is empty"},
+		{EtcdConfig{Endpoints: []string{"localhost:2379", ""}}, "EtcdConfig: Endpoints[1] is empty"},
+		{EtcdConfig{Endpoints: []string{"localhost:2379"}, Password: "pw"}, "EtcdConfig: Password is set without Username"},
+	} {
+		_, err := datarepository.CreateDataRepository("etcd", tc.config)
+		if !errors.Is(err, datarepository.ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: got %v, want ErrInvalidInput containing %q", tc.config, err, tc.want)
+		}
+	}
+}
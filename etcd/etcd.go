@@ -0,0 +1,1520 @@
+// etcd/etcd.go
+
+// Package etcd implements a datarepository.DataRepository on etcd, with pub/sub built on watches.
+// Importing it registers the "etcd" repository type with datarepository.CreateDataRepository.
+package etcd
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"go.etcd.io/etcd/api/v3/mvccpb"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+const (
+	EtcdKeySeparator       = "/"
+	DefaultEtcdDialTimeout = 5 * time.Second
+	// EtcdMaxTxnRetries is the number of times a compare-and-swap transaction is retried
+	// when the key was modified concurrently
+	EtcdMaxTxnRetries = 10
+	// EtcdIterateBatchSize is the number of keys Iterate fetches per request
+	EtcdIterateBatchSize = 100
+
+	// Lock, version and channel keys live next to the entity prefixes, which must start with a letter
+	etcdLockSegment    = "_lock"
+	etcdVersionSegment = "_version"
+	etcdChannelSegment = "_channel"
+)
+
+type EtcdConfig struct {
+	// Endpoints are the URLs of the etcd cluster members, e.g. "http://localhost:2379"
+	Endpoints []string
+	Username  string
+	Password  string
+	// DialTimeout is the timeout for establishing the connection. Defaults to DefaultEtcdDialTimeout.
+	DialTimeout time.Duration
+	// TLSConfig enables TLS with the given configuration
+	TLSConfig *tls.Config
+	// KeyPrefix is the first segment of all keys. Defaults to DefaultKeyPrefix.
+	KeyPrefix string
+	// Codec serializes entity values. Defaults to JSONCodec.
+	Codec datarepository.Codec
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator datarepository.IDGenerator
+	// NotFoundOnEmpty makes List return ErrNotFound instead of an empty result when nothing matches
+	NotFoundOnEmpty bool
+	// Logger receives diagnostic messages, e.g. about entries skipped by List or Search.
+	// Defaults to a no-op logger.
+	Logger datarepository.Logger
+}
+
+func (c EtcdConfig) GetConnectionString() string {
+	return strings.Join(c.Endpoints, ",")
+}
+
+// Validate checks the config without connecting.
+// Returns ErrInvalidInput naming the offending field.
+func (c EtcdConfig) Validate() error {
+	if len(c.Endpoints) == 0 {
+		return datarepository.InvalidConfig("EtcdConfig", "Endpoints is empty")
+	}
+	for i, endpoint := range c.Endpoints {
+		if strings.TrimSpace(endpoint) == "" {
+			return datarepository.InvalidConfig("EtcdConfig", "Endpoints[%d] is empty", i)
+		}
+	}
+	if c.Password != "" && c.Username == "" {
+		return datarepository.InvalidConfig("EtcdConfig", "Password is set without Username")
+	}
+	return nil
+}
+
+// EtcdIdentifier identifies the entity stored at prefix/EntityPrefix/ID
+type EtcdIdentifier struct {
+	EntityPrefix string
+	ID           string
+}
+
+func (ei EtcdIdentifier) String() string {
+	return ei.EntityPrefix + datarepository.DefaultKeySeparator + ei.ID
+}
+
+// Parts returns the entity prefix and the id
+func (ei EtcdIdentifier) Parts() (string, string) {
+	return ei.EntityPrefix, ei.ID
+}
+
+// EtcdRepository stores entities as codec-serialized values under prefix/entityPrefix/id.
+// Expirations are implemented with leases, whose TTL has a granularity of one second.
+type EtcdRepository struct {
+	datarepository.BaseRepository
+	client          *clientv3.Client
+	prefix          string
+	codec           datarepository.Codec
+	idGen           datarepository.IDGenerator
+	notFoundOnEmpty bool
+	logger          datarepository.Logger
+}
+
+var _ datarepository.DataRepository = (*EtcdRepository)(nil)
+
+func init() {
+	datarepository.RegisterDataRepository("etcd", NewEtcdRepository)
+}
+
+func NewEtcdRepository(config datarepository.Config) (datarepository.DataRepository, error) {
+	cfg, ok := config.(EtcdConfig)
+	if !ok {
+		return nil, fmt.Errorf("%w: etcd repository needs an EtcdConfig, got %T", datarepository.ErrInvalidInput, config)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.DialTimeout <= 0 {
+		cfg.DialTimeout = DefaultEtcdDialTimeout
+	}
+	if cfg.KeyPrefix == "" {
+		cfg.KeyPrefix = datarepository.DefaultKeyPrefix
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = datarepository.UUIDv4Generator{}
+	}
+	if cfg.Codec == nil {
+		cfg.Codec = datarepository.JSONCodec{}
+	}
+
+	client, err := clientv3.New(clientv3.Config{
+		Endpoints:   cfg.Endpoints,
+		Username:    cfg.Username,
+		Password:    cfg.Password,
+		DialTimeout: cfg.DialTimeout,
+		TLS:         cfg.TLSConfig,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	return &EtcdRepository{
+		client:          client,
+		prefix:          cfg.KeyPrefix,
+		codec:           cfg.Codec,
+		idGen:           cfg.IDGenerator,
+		notFoundOnEmpty: cfg.NotFoundOnEmpty,
+		logger:          datarepository.ResolveLogger(cfg.Logger, nil),
+	}, nil
+}
+
+// entityKey returns the key of the entity with the given identifier
+func (r *EtcdRepository) entityKey(identifier datarepository.EntityIdentifier) (string, error) {
+	entityPrefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return "", err
+	}
+	return r.prefix + EtcdKeySeparator + entityPrefix + EtcdKeySeparator + id, nil
+}
+
+// keyToIdentifier converts an entity key back into its identifier
+func (r *EtcdRepository) keyToIdentifier(key string) (EtcdIdentifier, bool) {
+	rest, found := strings.CutPrefix(key, r.prefix+EtcdKeySeparator)
+	if !found {
+		return EtcdIdentifier{}, false
+	}
+	entityPrefix, id, found := strings.Cut(rest, EtcdKeySeparator)
+	if !found || id == "" || !datarepository.IsValidEntityPrefix(entityPrefix) {
+		return EtcdIdentifier{}, false
+	}
+	return EtcdIdentifier{EntityPrefix: entityPrefix, ID: id}, true
+}
+
+// lockKey returns the key of the lock for the given identifier
+func (r *EtcdRepository) lockKey(identifier datarepository.EntityIdentifier) (string, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return "", err
+	}
+	return r.prefix + EtcdKeySeparator + etcdLockSegment + strings.TrimPrefix(key, r.prefix), nil
+}
+
+// versionKey returns the key holding the version of the entity with the given identifier
+func (r *EtcdRepository) versionKey(identifier datarepository.EntityIdentifier) (string, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return "", err
+	}
+	return r.prefix + EtcdKeySeparator + etcdVersionSegment + strings.TrimPrefix(key, r.prefix), nil
+}
+
+// channelKey returns the key that messages of the given channel are written to
+func (r *EtcdRepository) channelKey(channel string) string {
+	return r.prefix + EtcdKeySeparator + etcdChannelSegment + EtcdKeySeparator + channel
+}
+
+// encode serializes an entity value with the configured codec.
+// Returns ErrInvalidInput if value is nil.
+func (r *EtcdRepository) encode(value interface{}) (string, error) {
+	if err := datarepository.CheckValue(value); err != nil {
+		return "", err
+	}
+	return r.encodeField(value)
+}
+
+// encodeField serializes value with the configured codec. Unlike encode, it accepts nil, which
+// UpdateField stores as null.
+func (r *EtcdRepository) encodeField(value interface{}) (string, error) {
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return "", fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+	}
+	return string(data), nil
+}
+
+// leaseSeconds converts a duration into a lease TTL, rounded up to whole seconds
+func leaseSeconds(d time.Duration) int64 {
+	seconds := int64((d + time.Second - 1) / time.Second)
+	if seconds < 1 {
+		return 1
+	}
+	return seconds
+}
+
+// get returns the current key-value of the key, or ErrNotFound
+func (r *EtcdRepository) get(ctx context.Context, key string) (*clientv3.GetResponse, error) {
+	resp, err := r.client.Get(ctx, key)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if len(resp.Kvs) == 0 {
+		return nil, datarepository.ErrNotFound
+	}
+	return resp, nil
+}
+
+// leaseTTL returns the remaining TTL of a lease, or NoExpiration if the key has no lease
+func (r *EtcdRepository) leaseTTL(ctx context.Context, lease int64) (time.Duration, error) {
+	if lease == 0 {
+		return datarepository.NoExpiration, nil
+	}
+	resp, err := r.client.TimeToLive(ctx, clientv3.LeaseID(lease))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if resp.TTL < 0 {
+		// The lease expired after the key was read
+		return 0, datarepository.ErrNotFound
+	}
+	return time.Duration(resp.TTL) * time.Second, nil
+}
+
+// modify applies fn to the current value of an existing key and stores the result if the key
+// wasn't modified in the meantime, retrying otherwise. The key keeps its lease.
+func (r *EtcdRepository) modify(ctx context.Context, key string, fn func(current []byte) (string, error)) error {
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		resp, err := r.get(ctx, key)
+		if err != nil {
+			return err
+		}
+		kv := resp.Kvs[0]
+		updated, err := fn(kv.Value)
+		if err != nil {
+			return err
+		}
+		txn, err := r.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(key, updated, clientv3.WithIgnoreLease())).
+			Commit()
+		if err != nil {
+			return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if txn.Succeeded {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+func (r *EtcdRepository) Create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	txn, err := r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, data)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if !txn.Succeeded {
+		return datarepository.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *EtcdRepository) CreateIfAbsent(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", datarepository.ErrInvalidInput)
+	}
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return false, err
+	}
+
+	var opts []clientv3.OpOption
+	var lease clientv3.LeaseID
+	if ttl > 0 {
+		granted, err := r.client.Grant(ctx, leaseSeconds(ttl))
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		lease = granted.ID
+		opts = append(opts, clientv3.WithLease(lease))
+	}
+	txn, err := r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), "=", 0)).
+		Then(clientv3.OpPut(key, data, opts...)).
+		Commit()
+	if lease != 0 && (err != nil || !txn.Succeeded) {
+		// The unused lease would expire anyway, revoking it just frees it early
+		_, _ = r.client.Revoke(ctx, lease)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return txn.Succeeded, nil
+}
+
+func (r *EtcdRepository) CreateWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return datarepository.CreateWithTTL(ctx, r, identifier, value, ttl)
+}
+
+func (r *EtcdRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (datarepository.EntityIdentifier, error) {
+	if !datarepository.IsValidEntityPrefix(entityPrefix) {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidIdentifier, datarepository.ErrInvalidEntityPrefix)
+	}
+	return datarepository.CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) datarepository.EntityIdentifier {
+		return EtcdIdentifier{EntityPrefix: entityPrefix, ID: id}
+	})
+}
+
+func (r *EtcdRepository) Read(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	resp, err := r.get(ctx, key)
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(resp.Kvs[0].Value, value)
+}
+
+func (r *EtcdRepository) Exists(ctx context.Context, identifier datarepository.EntityIdentifier) (bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	resp, err := r.client.Get(ctx, key, clientv3.WithCountOnly())
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return resp.Count == 1, nil
+}
+
+func (r *EtcdRepository) ExistsMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) (map[datarepository.EntityIdentifier]bool, error) {
+	return datarepository.ExistsMany(ctx, r, identifiers)
+}
+
+func (r *EtcdRepository) ReadWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) (time.Duration, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := r.get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := r.leaseTTL(ctx, resp.Kvs[0].Lease)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.codec.Unmarshal(resp.Kvs[0].Value, value); err != nil {
+		return 0, err
+	}
+	return ttl, nil
+}
+
+func (r *EtcdRepository) Upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	// An existing key keeps its lease and thereby its expiration
+	_, err = r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, data, clientv3.WithIgnoreLease())).
+		Else(clientv3.OpPut(key, data)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *EtcdRepository) UpsertWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	// The value is written together with its new lease
+	lease, err := r.client.Grant(ctx, leaseSeconds(ttl))
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if _, err := r.client.Put(ctx, key, data, clientv3.WithLease(lease.ID)); err != nil {
+		_, _ = r.client.Revoke(ctx, lease.ID)
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *EtcdRepository) UpsertManyWithTTL(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+
+	// All entities share one lease; each value is written together with it
+	lease, err := r.client.Grant(ctx, leaseSeconds(ttl))
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		key, err := r.entityKey(identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		data, err := r.encode(value)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		if _, err := r.client.Put(ctx, key, data, clientv3.WithLease(lease.ID)); err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err))
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *EtcdRepository) Update(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+
+	txn, err := r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(key), ">", 0)).
+		Then(clientv3.OpPut(key, data, clientv3.WithIgnoreLease())).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if !txn.Succeeded {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+// errValueMismatch aborts the modification made by CompareAndSwap
+var errValueMismatch = errors.New("value does not match")
+
+func (r *EtcdRepository) CompareAndSwap(ctx context.Context, identifier datarepository.EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return false, err
+	}
+	err = r.modify(ctx, key, func(current []byte) (string, error) {
+		equal, err := datarepository.EqualEncoded(r.codec, current, expected)
+		if err != nil {
+			return "", err
+		}
+		if !equal {
+			return "", errValueMismatch
+		}
+		return data, nil
+	})
+	if errors.Is(err, errValueMismatch) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// readVersion reads the entity and its version key in one revision. The version key holds
+// "createRevision:version", so a version left behind by an expired entity doesn't apply to a
+// new entity with the same key.
+func (r *EtcdRepository) readVersion(ctx context.Context, key, versionKey string) (*mvccpb.KeyValue, *mvccpb.KeyValue, int64, error) {
+	txn, err := r.client.Txn(ctx).Then(clientv3.OpGet(key), clientv3.OpGet(versionKey)).Commit()
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	entities := txn.Responses[0].GetResponseRange().Kvs
+	if len(entities) == 0 {
+		return nil, nil, 0, datarepository.ErrNotFound
+	}
+	entity := entities[0]
+	versions := txn.Responses[1].GetResponseRange().Kvs
+	if len(versions) == 0 {
+		return entity, nil, 0, nil
+	}
+	createRevision, version, _ := strings.Cut(string(versions[0].Value), ":")
+	if createRevision != strconv.FormatInt(entity.CreateRevision, 10) {
+		return entity, versions[0], 0, nil
+	}
+	parsed, err := strconv.ParseInt(version, 10, 64)
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("%w: invalid version %q", datarepository.ErrOperationFailed, versions[0].Value)
+	}
+	return entity, versions[0], parsed, nil
+}
+
+func (r *EtcdRepository) UpdateWithVersion(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	versionKey, _ := r.versionKey(identifier)
+	data, err := r.encode(value)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		entity, versionKV, version, err := r.readVersion(ctx, key, versionKey)
+		if err != nil {
+			return 0, err
+		}
+		if version != expectedVersion {
+			return 0, datarepository.ErrVersionConflict
+		}
+		var versionModRevision int64
+		if versionKV != nil {
+			versionModRevision = versionKV.ModRevision
+		}
+		newVersion := fmt.Sprintf("%d:%d", entity.CreateRevision, expectedVersion+1)
+		txn, err := r.client.Txn(ctx).
+			If(
+				clientv3.Compare(clientv3.ModRevision(key), "=", entity.ModRevision),
+				clientv3.Compare(clientv3.ModRevision(versionKey), "=", versionModRevision),
+			).
+			Then(clientv3.OpPut(key, data, clientv3.WithIgnoreLease()), clientv3.OpPut(versionKey, newVersion)).
+			Commit()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if txn.Succeeded {
+			return expectedVersion + 1, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+func (r *EtcdRepository) GetVersion(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	versionKey, _ := r.versionKey(identifier)
+	_, _, version, err := r.readVersion(ctx, key, versionKey)
+	return version, err
+}
+
+// toGeneric decodes a stored value into its generic representation (maps, slices and scalars)
+func (r *EtcdRepository) toGeneric(data []byte) (interface{}, error) {
+	var generic interface{}
+	if err := r.codec.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return generic, nil
+}
+
+func (r *EtcdRepository) UpdateField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	encoded, err := r.encodeField(value)
+	if err != nil {
+		return err
+	}
+	fieldValue, err := r.toGeneric([]byte(encoded))
+	if err != nil {
+		return err
+	}
+
+	return r.modify(ctx, key, func(current []byte) (string, error) {
+		doc, err := r.toGeneric(current)
+		if err != nil {
+			return "", err
+		}
+		if err := datarepository.SetFieldPath(doc, parts, fieldValue); err != nil {
+			return "", err
+		}
+		return r.encode(doc)
+	})
+}
+
+func (r *EtcdRepository) ReadField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	resp, err := r.get(ctx, key)
+	if err != nil {
+		return err
+	}
+
+	doc, err := r.toGeneric(resp.Kvs[0].Value)
+	if err != nil {
+		return err
+	}
+	field, err := datarepository.GetFieldPath(doc, parts)
+	if err != nil {
+		return err
+	}
+	data, err := r.codec.Marshal(field)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *EtcdRepository) Delete(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	versionKey, _ := r.versionKey(identifier)
+	txn, err := r.client.Txn(ctx).
+		Then(clientv3.OpDelete(key), clientv3.OpDelete(versionKey)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if txn.Responses[0].GetResponseDeleteRange().Deleted == 0 {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *EtcdRepository) GetAndDelete(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	versionKey, _ := r.versionKey(identifier)
+	txn, err := r.client.Txn(ctx).
+		Then(clientv3.OpDelete(key, clientv3.WithPrevKV()), clientv3.OpDelete(versionKey)).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	deleted := txn.Responses[0].GetResponseDeleteRange().PrevKvs
+	if len(deleted) == 0 {
+		return datarepository.ErrNotFound
+	}
+	return r.codec.Unmarshal(deleted[0].Value, value)
+}
+
+func (r *EtcdRepository) GetAndSet(ctx context.Context, identifier datarepository.EntityIdentifier, newValue, oldValue interface{}) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return err
+	}
+	var previous []byte
+	err = r.modify(ctx, key, func(current []byte) (string, error) {
+		previous = current
+		return data, nil
+	})
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(previous, oldValue)
+}
+
+func (r *EtcdRepository) CreateMany(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}) error {
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		if err := r.Create(ctx, identifier, value); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *EtcdRepository) ReadMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		key, err := r.entityKey(identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		resp, err := r.get(ctx, key)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		if err := fn(identifier, resp.Kvs[0].Value); err != nil {
+			return err
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *EtcdRepository) ReadManyOrdered(ctx context.Context, identifiers []datarepository.EntityIdentifier, dest interface{}) error {
+	return datarepository.ReadManyOrdered(ctx, r, r.codec, identifiers, dest)
+}
+
+func (r *EtcdRepository) DeleteMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.Delete(ctx, identifier); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern collects the matching entities with Iterate and removes them with DeleteMany
+func (r *EtcdRepository) DeletePattern(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	return datarepository.DeletePattern(ctx, r, pattern)
+}
+
+// patternRange returns the key prefix covering all entities whose identifier (entityPrefix:id)
+// may match the glob pattern, together with the regular expression the identifiers must match
+func (r *EtcdRepository) patternRange(pattern string) (string, *regexp.Regexp, error) {
+	regex, err := regexp.Compile(datarepository.GlobToRegex(pattern))
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: invalid pattern", datarepository.ErrInvalidInput)
+	}
+	literal := datarepository.GlobLiteralPrefix(pattern)
+	keyPrefix := r.prefix + EtcdKeySeparator
+	if entityPrefix, id, found := strings.Cut(literal, datarepository.DefaultKeySeparator); found {
+		keyPrefix += entityPrefix + EtcdKeySeparator + id
+	} else {
+		keyPrefix += literal
+	}
+	return keyPrefix, regex, nil
+}
+
+// matchingKeys returns the sorted keys of all entities matching the glob pattern
+func (r *EtcdRepository) matchingKeys(ctx context.Context, pattern string) ([]string, error) {
+	keyPrefix, regex, err := r.patternRange(pattern)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := r.client.Get(ctx, keyPrefix, clientv3.WithPrefix(), clientv3.WithKeysOnly())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	// etcd returns keys in ascending order
+	keys := make([]string, 0, len(resp.Kvs))
+	for _, kv := range resp.Kvs {
+		identifier, ok := r.keyToIdentifier(string(kv.Key))
+		if ok && regex.MatchString(identifier.String()) {
+			keys = append(keys, string(kv.Key))
+		}
+	}
+	return keys, nil
+}
+
+// fetchEntities retrieves and decodes the values of the given keys.
+// Keys that were removed in the meantime are left out; keys that can't be decoded are reported
+// as skipped.
+func (r *EtcdRepository) fetchEntities(ctx context.Context, keys []string) (datarepository.ListResult, error) {
+	result := datarepository.ListResult{
+		Identifiers: make([]datarepository.EntityIdentifier, 0, len(keys)),
+		Entities:    make([]interface{}, 0, len(keys)),
+	}
+	for _, key := range keys {
+		resp, err := r.client.Get(ctx, key)
+		if err != nil {
+			return datarepository.ListResult{}, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if len(resp.Kvs) == 0 {
+			continue
+		}
+		var entity interface{}
+		if err := r.codec.Unmarshal(resp.Kvs[0].Value, &entity); err != nil {
+			r.logger.Warnf("skipping key %q that could not be decoded: %v", key, err)
+			result.Skipped = append(result.Skipped, datarepository.SkippedKey{Key: key, Err: err})
+			continue
+		}
+		identifier, _ := r.keyToIdentifier(key)
+		result.Identifiers = append(result.Identifiers, identifier)
+		result.Entities = append(result.Entities, entity)
+	}
+	return result, nil
+}
+
+func (r *EtcdRepository) List(ctx context.Context, pattern string) ([]datarepository.EntityIdentifier, []interface{}, error) {
+	result, err := r.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(r.notFoundOnEmpty)
+}
+
+func (r *EtcdRepository) ListDetailed(ctx context.Context, pattern string) (datarepository.ListResult, error) {
+	keys, err := r.matchingKeys(ctx, pattern)
+	if err != nil {
+		return datarepository.ListResult{}, err
+	}
+	result, err := r.fetchEntities(ctx, keys)
+	if err != nil {
+		return datarepository.ListResult{}, err
+	}
+	if len(result.Identifiers) == 0 && len(result.Skipped) == 0 && r.notFoundOnEmpty {
+		return datarepository.ListResult{}, datarepository.ErrNotFound
+	}
+	return result, nil
+}
+
+func (r *EtcdRepository) Count(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	keys, err := r.matchingKeys(ctx, pattern.String())
+	if err != nil {
+		return 0, err
+	}
+	return int64(len(keys)), nil
+}
+
+// Iterate reads the matching range in batches of EtcdIterateBatchSize keys, each one starting
+// after the last key of the previous batch
+func (r *EtcdRepository) Iterate(ctx context.Context, pattern datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	keyPrefix, regex, err := r.patternRange(pattern.String())
+	if err != nil {
+		return err
+	}
+
+	start, end := keyPrefix, clientv3.GetPrefixRangeEnd(keyPrefix)
+	for {
+		resp, err := r.client.Get(ctx, start, clientv3.WithRange(end), clientv3.WithLimit(EtcdIterateBatchSize))
+		if err != nil {
+			return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		for _, kv := range resp.Kvs {
+			identifier, ok := r.keyToIdentifier(string(kv.Key))
+			if !ok || !regex.MatchString(identifier.String()) {
+				continue
+			}
+			if err := fn(identifier, kv.Value); err != nil {
+				return err
+			}
+		}
+		if !resp.More || len(resp.Kvs) == 0 {
+			return nil
+		}
+		start = string(resp.Kvs[len(resp.Kvs)-1].Key) + "\x00"
+	}
+}
+
+func (r *EtcdRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]datarepository.EntityIdentifier, []interface{}, uint64, error) {
+	if pageSize <= 0 {
+		return nil, nil, 0, fmt.Errorf("%w: page size must be positive", datarepository.ErrInvalidInput)
+	}
+	keys, err := r.matchingKeys(ctx, pattern)
+	if err != nil {
+		return nil, nil, 0, err
+	}
+
+	// The cursor is an offset into the sorted list of matching keys
+	if cursor >= uint64(len(keys)) {
+		return []datarepository.EntityIdentifier{}, []interface{}{}, 0, nil
+	}
+	end := cursor + uint64(pageSize)
+	nextCursor := end
+	if end >= uint64(len(keys)) {
+		end = uint64(len(keys))
+		nextCursor = 0
+	}
+	result, err := r.fetchEntities(ctx, keys[cursor:end])
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	return result.Identifiers, result.Entities, nextCursor, nil
+}
+
+func (r *EtcdRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]datarepository.EntityIdentifier, string, error) {
+	return datarepository.ListPage(ctx, r, pattern, cursor, pageSize)
+}
+
+func (r *EtcdRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	keys, err := r.matchingKeys(ctx, "*")
+	if err != nil {
+		return nil, err
+	}
+
+	seen := make(map[string]struct{})
+	for _, key := range keys {
+		identifier, _ := r.keyToIdentifier(key)
+		seen[identifier.EntityPrefix] = struct{}{}
+	}
+	prefixes := make([]string, 0, len(seen))
+	for prefix := range seen {
+		prefixes = append(prefixes, prefix)
+	}
+	sort.Strings(prefixes)
+	return prefixes, nil
+}
+
+func (r *EtcdRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *EtcdRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]datarepository.EntityIdentifier, error) {
+	return nil, fmt.Errorf("%w: the etcd repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *EtcdRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (datarepository.SearchResult, error) {
+	return datarepository.SearchResult{}, fmt.Errorf("%w: the etcd repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *EtcdRepository) SearchResults(ctx context.Context, query string, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return datarepository.SearchResponse{}, fmt.Errorf("%w: the etcd repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *EtcdRepository) SearchQuery(ctx context.Context, query *datarepository.Query, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return datarepository.SearchResponse{}, fmt.Errorf("%w: the etcd repository does not support search", datarepository.ErrNotSupported)
+}
+
+func (r *EtcdRepository) AcquireLock(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (bool, error) {
+	_, acquired, err := r.AcquireLockWithToken(ctx, identifier, ttl)
+	return acquired, err
+}
+
+// AcquireLockWithToken stores the token under the lock key, attached to a lease with the given TTL.
+// The session-based concurrency.Mutex is not used because it keeps its lease alive for as long
+// as the process runs, which would ignore ttl and make RenewLock meaningless.
+func (r *EtcdRepository) AcquireLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	lockKey, err := r.lockKey(identifier)
+	if err != nil {
+		return "", false, err
+	}
+	lease, err := r.client.Grant(ctx, leaseSeconds(ttl))
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	token := datarepository.NewLockToken()
+	txn, err := r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.CreateRevision(lockKey), "=", 0)).
+		Then(clientv3.OpPut(lockKey, token, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !txn.Succeeded {
+		// The unused lease would expire anyway, revoking it just frees it early
+		_, _ = r.client.Revoke(ctx, lease.ID)
+	}
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if !txn.Succeeded {
+		return "", false, nil
+	}
+	return token, true, nil
+}
+
+func (r *EtcdRepository) ReleaseLock(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	lockKey, err := r.lockKey(identifier)
+	if err != nil {
+		return err
+	}
+	resp, err := r.client.Delete(ctx, lockKey, clientv3.WithPrevKV())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if resp.Deleted == 0 {
+		return datarepository.ErrNotFound
+	}
+	r.revokeLeases(ctx, resp.PrevKvs)
+	return nil
+}
+
+func (r *EtcdRepository) ReleaseLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	lockKey, err := r.lockKey(identifier)
+	if err != nil {
+		return err
+	}
+	txn, err := r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(lockKey), "=", token)).
+		Then(clientv3.OpDelete(lockKey, clientv3.WithPrevKV())).
+		Else(clientv3.OpGet(lockKey, clientv3.WithCountOnly())).
+		Commit()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if !txn.Succeeded {
+		if txn.Responses[0].GetResponseRange().Count == 0 {
+			return datarepository.ErrNotFound
+		}
+		return datarepository.ErrLockNotOwned
+	}
+	r.revokeLeases(ctx, txn.Responses[0].GetResponseDeleteRange().PrevKvs)
+	return nil
+}
+
+// RenewLock moves the lock to a new lease with the given TTL, as the TTL of a lease can't be changed
+func (r *EtcdRepository) RenewLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	lockKey, err := r.lockKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	lease, err := r.client.Grant(ctx, leaseSeconds(ttl))
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	txn, err := r.client.Txn(ctx).
+		If(clientv3.Compare(clientv3.Value(lockKey), "=", token)).
+		Then(clientv3.OpGet(lockKey), clientv3.OpPut(lockKey, token, clientv3.WithLease(lease.ID))).
+		Commit()
+	if err != nil || !txn.Succeeded {
+		_, _ = r.client.Revoke(ctx, lease.ID)
+	}
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if !txn.Succeeded {
+		return false, nil
+	}
+	r.revokeLeases(ctx, txn.Responses[0].GetResponseRange().Kvs)
+	return true, nil
+}
+
+// revokeLeases revokes the leases of released locks. Failures are ignored because the leases
+// expire on their own.
+func (r *EtcdRepository) revokeLeases(ctx context.Context, kvs []*mvccpb.KeyValue) {
+	for _, kv := range kvs {
+		if kv.Lease != 0 {
+			_, _ = r.client.Revoke(ctx, clientv3.LeaseID(kv.Lease))
+		}
+	}
+}
+
+// Publish writes the message to the channel key, which subscribers watch
+func (r *EtcdRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	payload, err := datarepository.EncodePayload(r.codec, message)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+	}
+	if _, err := r.client.Put(ctx, r.channelKey(channel), string(payload)); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *EtcdRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	sub, err := r.SubscribeMessages(ctx, channel)
+	if err != nil {
+		return nil, err
+	}
+	ch := make(chan interface{})
+
+	go func() {
+		defer close(ch)
+		for msg := range sub.Messages() {
+			ch <- string(msg.Payload)
+		}
+	}()
+
+	return ch, nil
+}
+
+func (r *EtcdRepository) SubscribeMessages(ctx context.Context, channel string) (datarepository.Subscription, error) {
+	return r.watchChannels(ctx, r.channelKey(channel), false, nil), nil
+}
+
+func (r *EtcdRepository) PSubscribe(ctx context.Context, pattern string) (datarepository.Subscription, error) {
+	regex, err := regexp.Compile(datarepository.GlobToRegex(pattern))
+	if err != nil {
+		return nil, fmt.Errorf("%w: invalid pattern", datarepository.ErrInvalidInput)
+	}
+	literal := datarepository.GlobLiteralPrefix(pattern)
+	return r.watchChannels(ctx, r.channelKey(literal), true, regex), nil
+}
+
+// etcdSubscription is a SubscribeMessages or PSubscribe subscription of an EtcdRepository
+type etcdSubscription struct {
+	cancel context.CancelFunc
+	ch     chan datarepository.Message
+	once   sync.Once
+}
+
+func (s *etcdSubscription) Messages() <-chan datarepository.Message {
+	return s.ch
+}
+
+// Close cancels the underlying watch, which ends message delivery
+func (s *etcdSubscription) Close() error {
+	s.once.Do(s.cancel)
+	return nil
+}
+
+// watchChannels watches the channel key (or all keys starting with it if prefix is set) and
+// delivers every write to a channel whose name matches regex, if given, as a Message
+func (r *EtcdRepository) watchChannels(ctx context.Context, key string, prefix bool, regex *regexp.Regexp) datarepository.Subscription {
+	watchCtx, cancel := context.WithCancel(ctx)
+	sub := &etcdSubscription{cancel: cancel, ch: make(chan datarepository.Message)}
+	opts := []clientv3.OpOption{clientv3.WithFilterDelete()}
+	if prefix {
+		opts = append(opts, clientv3.WithPrefix())
+	}
+	watchChan := r.client.Watch(watchCtx, key, opts...)
+	channelPrefix := r.channelKey("")
+
+	go func() {
+		defer close(sub.ch)
+		for resp := range watchChan {
+			for _, event := range resp.Events {
+				channel := strings.TrimPrefix(string(event.Kv.Key), channelPrefix)
+				if regex != nil && !regex.MatchString(channel) {
+					continue
+				}
+				select {
+				case sub.ch <- datarepository.Message{Channel: channel, Payload: event.Kv.Value}:
+				case <-watchCtx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	return sub
+}
+
+func (r *EtcdRepository) Ping(ctx context.Context) error {
+	if _, err := r.client.Get(ctx, r.prefix, clientv3.WithCountOnly()); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *EtcdRepository) Close() error {
+	return r.client.Close()
+}
+
+// setLease attaches the key to a new lease with the given TTL if cond, called with the current
+// TTL (NoExpiration if none), allows it. Returns false if the condition was not met.
+func (r *EtcdRepository) setLease(ctx context.Context, key string, expiration time.Duration, cond func(current time.Duration) bool) (bool, error) {
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		resp, err := r.get(ctx, key)
+		if err != nil {
+			return false, err
+		}
+		kv := resp.Kvs[0]
+		current, err := r.leaseTTL(ctx, kv.Lease)
+		if err != nil {
+			return false, err
+		}
+		if !cond(current) {
+			return false, nil
+		}
+
+		lease, err := r.client.Grant(ctx, leaseSeconds(expiration))
+		if err != nil {
+			return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		txn, err := r.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(key, string(kv.Value), clientv3.WithLease(lease.ID))).
+			Commit()
+		if err != nil {
+			_, _ = r.client.Revoke(ctx, lease.ID)
+			return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if txn.Succeeded {
+			return true, nil
+		}
+		_, _ = r.client.Revoke(ctx, lease.ID)
+	}
+	return false, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+func (r *EtcdRepository) SetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	_, err = r.setLease(ctx, key, expiration, func(time.Duration) bool { return true })
+	return err
+}
+
+func (r *EtcdRepository) SetExpirationMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, expiration time.Duration) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.SetExpiration(ctx, identifier, expiration); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *EtcdRepository) SetExpirationCond(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration, cond datarepository.ExpirationCondition) (bool, error) {
+	switch cond {
+	case datarepository.ExpireNX, datarepository.ExpireXX, datarepository.ExpireGT, datarepository.ExpireLT:
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", datarepository.ErrInvalidInput, cond)
+	}
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return false, err
+	}
+
+	applied, err := r.setLease(ctx, key, expiration, func(current time.Duration) bool {
+		hasExpiry := current != datarepository.NoExpiration
+		switch cond {
+		case datarepository.ExpireNX:
+			return !hasExpiry
+		case datarepository.ExpireXX:
+			return hasExpiry
+		case datarepository.ExpireGT:
+			// No expiration counts as infinite, which can't be exceeded
+			return hasExpiry && expiration > current
+		default:
+			return !hasExpiry || expiration < current
+		}
+	})
+	if datarepository.IsNotFoundError(err) {
+		return false, nil
+	}
+	return applied, err
+}
+
+func (r *EtcdRepository) GetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier) (time.Duration, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := r.get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	ttl, err := r.leaseTTL(ctx, resp.Kvs[0].Lease)
+	if err != nil {
+		return 0, err
+	}
+	if ttl == datarepository.NoExpiration {
+		return 0, datarepository.ErrNotFound
+	}
+	return ttl, nil
+}
+
+// Persist writes the entity's value again without a lease, unless it was changed in the meantime
+func (r *EtcdRepository) Persist(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return err
+	}
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		resp, err := r.get(ctx, key)
+		if err != nil {
+			return err
+		}
+		kv := resp.Kvs[0]
+		if kv.Lease == 0 {
+			return nil
+		}
+		txn, err := r.client.Txn(ctx).
+			If(clientv3.Compare(clientv3.ModRevision(key), "=", kv.ModRevision)).
+			Then(clientv3.OpPut(key, string(kv.Value))).
+			Commit()
+		if err != nil {
+			return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if txn.Succeeded {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+// Touch only checks that the entity exists
+func (r *EtcdRepository) Touch(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return datarepository.TouchExisting(ctx, r, identifier)
+}
+
+func (r *EtcdRepository) AtomicIncrement(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return r.IncrementBy(ctx, identifier, 1)
+}
+
+func (r *EtcdRepository) IncrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	value, _, err := r.IncrementWithLimit(ctx, identifier, delta, math.MaxInt64)
+	return value, err
+}
+
+func (r *EtcdRepository) DecrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	return r.IncrementBy(ctx, identifier, -delta)
+}
+
+// IncrementWithLimit updates the counter with a compare-and-swap transaction, retrying on conflicts
+func (r *EtcdRepository) IncrementWithLimit(ctx context.Context, identifier datarepository.EntityIdentifier, delta, max int64) (int64, bool, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, false, err
+	}
+
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		resp, err := r.client.Get(ctx, key)
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+
+		var value int64
+		compare := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		if len(resp.Kvs) == 1 {
+			if err := r.codec.Unmarshal(resp.Kvs[0].Value, &value); err != nil {
+				return 0, false, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+			}
+			compare = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+		}
+		if value+delta > max {
+			return value, false, nil
+		}
+		value += delta
+		data, err := r.encode(value)
+		if err != nil {
+			return 0, false, err
+		}
+
+		put := clientv3.OpPut(key, data)
+		if len(resp.Kvs) == 1 && resp.Kvs[0].Lease != 0 {
+			put = clientv3.OpPut(key, data, clientv3.WithIgnoreLease())
+		}
+		txn, err := r.client.Txn(ctx).If(compare).Then(put).Commit()
+		if err != nil {
+			return 0, false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if txn.Succeeded {
+			return value, true, nil
+		}
+	}
+	return 0, false, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+// IncrementWithExpiry updates the counter with a compare-and-swap transaction, retrying on
+// conflicts. A counter without a lease is written together with a new lease for ttl.
+func (r *EtcdRepository) IncrementWithExpiry(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		resp, err := r.client.Get(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+
+		var value int64
+		compare := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		hasLease := false
+		if len(resp.Kvs) == 1 {
+			if err := r.codec.Unmarshal(resp.Kvs[0].Value, &value); err != nil {
+				return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+			}
+			compare = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+			hasLease = resp.Kvs[0].Lease != 0
+		}
+		value += delta
+		data, err := r.encode(value)
+		if err != nil {
+			return 0, err
+		}
+
+		put := clientv3.OpPut(key, data, clientv3.WithIgnoreLease())
+		var lease clientv3.LeaseID
+		if !hasLease {
+			granted, err := r.client.Grant(ctx, leaseSeconds(ttl))
+			if err != nil {
+				return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+			}
+			lease = granted.ID
+			put = clientv3.OpPut(key, data, clientv3.WithLease(lease))
+		}
+		txn, err := r.client.Txn(ctx).If(compare).Then(put).Commit()
+		if err == nil && txn.Succeeded {
+			return value, nil
+		}
+		if lease != 0 {
+			_, _ = r.client.Revoke(ctx, lease)
+		}
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+	}
+	return 0, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+// IncrementFloat updates the counter with a compare-and-swap transaction, retrying on conflicts
+func (r *EtcdRepository) IncrementFloat(ctx context.Context, identifier datarepository.EntityIdentifier, delta float64) (float64, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	for attempt := 0; attempt < EtcdMaxTxnRetries; attempt++ {
+		resp, err := r.client.Get(ctx, key)
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+
+		var value float64
+		compare := clientv3.Compare(clientv3.CreateRevision(key), "=", 0)
+		if len(resp.Kvs) == 1 {
+			if err := r.codec.Unmarshal(resp.Kvs[0].Value, &value); err != nil {
+				return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+			}
+			compare = clientv3.Compare(clientv3.ModRevision(key), "=", resp.Kvs[0].ModRevision)
+		}
+		value += delta
+		data, err := r.encode(value)
+		if err != nil {
+			return 0, err
+		}
+
+		put := clientv3.OpPut(key, data)
+		if len(resp.Kvs) == 1 && resp.Kvs[0].Lease != 0 {
+			put = clientv3.OpPut(key, data, clientv3.WithIgnoreLease())
+		}
+		txn, err := r.client.Txn(ctx).If(compare).Then(put).Commit()
+		if err != nil {
+			return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		if txn.Succeeded {
+			return value, nil
+		}
+	}
+	return 0, fmt.Errorf("%w: too many concurrent modifications", datarepository.ErrOperationFailed)
+}
+
+func (r *EtcdRepository) GetCounter(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	key, err := r.entityKey(identifier)
+	if err != nil {
+		return 0, err
+	}
+	resp, err := r.get(ctx, key)
+	if err != nil {
+		return 0, err
+	}
+	var value int64
+	if err := r.codec.Unmarshal(resp.Kvs[0].Value, &value); err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (r *EtcdRepository) SetCounter(ctx context.Context, identifier datarepository.EntityIdentifier, value int64) error {
+	return r.Upsert(ctx, identifier, value)
+}
+
+// WithTransaction is not supported: etcd transactions are single requests of comparisons and
+// writes, which can't run arbitrary operations like those of fn
+func (r *EtcdRepository) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	return fmt.Errorf("%w: the etcd repository does not support transactions", datarepository.ErrNotSupported)
+}
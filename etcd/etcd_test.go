@@ -0,0 +1,93 @@
+//go:build integration
+
+// etcd/etcd_test.go
+
+package etcd
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/itsatony/go-datarepository/datarepositorytest"
+	clientv3 "go.etcd.io/etcd/client/v3"
+)
+
+// newTestEtcdRepository returns an EtcdRepository on the cluster at the comma-separated
+// ETCD_ENDPOINTS, using a key prefix of its own whose keys are deleted when the test ends.
+// Skips the test if ETCD_ENDPOINTS is not set.
+func newTestEtcdRepository(t *testing.T) *EtcdRepository {
+	t.Helper()
+	endpoints := os.Getenv("ETCD_ENDPOINTS")
+	if endpoints == "" {
+		t.Skip("ETCD_ENDPOINTS not set")
+	}
+	repo, err := NewEtcdRepository(EtcdConfig{
+		Endpoints: strings.Split(endpoints, ","),
+		KeyPrefix: fmt.Sprintf("datarepository_test_%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatalf("NewEtcdRepository: %v", err)
+	}
+	etcd := repo.(*EtcdRepository)
+	t.Cleanup(func() {
+		if _, err := etcd.client.Delete(context.Background(), etcd.prefix+EtcdKeySeparator, clientv3.WithPrefix()); err != nil {
+			t.Errorf("deleting the test keys: %v", err)
+		}
+		etcd.Close()
+	})
+	return etcd
+}
+
+func TestEtcdConformance(t *testing.T) {
+	datarepositorytest.Conformance(t, newTestEtcdRepository(t))
+}
+
+func TestEtcdPublishReachesWatchers(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestEtcdRepository(t)
+	sub, err := repo.SubscribeMessages(ctx, "events")
+	if err != nil {
+		t.Fatalf("SubscribeMessages: %v", err)
+	}
+	defer sub.Close()
+
+	// The watch is set up asynchronously, so publish until the first message gets through
+	deadline := time.After(5 * time.Second)
+	for {
+		if err := repo.Publish(ctx, "events", "hello"); err != nil {
+			t.Fatalf("Publish: %v", err)
+		}
+		select {
+		case message := <-sub.Messages():
+			if message.Channel != "events" || string(message.Payload) != "hello" {
+				t.Errorf("got message %q on %q, want \"hello\" on \"events\"", message.Payload, message.Channel)
+			}
+			return
+		case <-time.After(100 * time.Millisecond):
+		case <-deadline:
+			t.Fatal("timed out waiting for a message")
+		}
+	}
+}
+
+func TestEtcdLockExpiresWithLease(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestEtcdRepository(t)
+	id := datarepository.SimpleIdentifier("job:1")
+	if acquired, err := repo.AcquireLock(ctx, id, time.Second); err != nil || !acquired {
+		t.Fatalf("AcquireLock: got %v, %v, want the lock", acquired, err)
+	}
+	if acquired, err := repo.AcquireLock(ctx, id, time.Second); err != nil || acquired {
+		t.Errorf("AcquireLock of a held lock: got %v, %v, want false", acquired, err)
+	}
+	// Lease TTLs have a granularity of one second and etcd may keep a lease slightly longer
+	time.Sleep(3 * time.Second)
+	if acquired, err := repo.AcquireLock(ctx, id, time.Second); err != nil || !acquired {
+		t.Errorf("AcquireLock after the lease expired: got %v, %v, want the lock", acquired, err)
+	}
+}
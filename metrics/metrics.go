@@ -0,0 +1,113 @@
+// metrics/metrics.go
+
+// Package metrics records Prometheus metrics for the operations of a datarepository.DataRepository.
+// It sits in the hook layer of datarepository.HookedRepository, so it works the same for every backend.
+package metrics
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	LabelOperation = "operation"
+	LabelOutcome   = "outcome"
+
+	OutcomeSuccess         = "success"
+	OutcomeNotFound        = "not_found"
+	OutcomeAlreadyExists   = "already_exists"
+	OutcomeVersionConflict = "version_conflict"
+	OutcomeInvalid         = "invalid"
+	OutcomeNotSupported    = "not_supported"
+	OutcomeCanceled        = "canceled"
+	OutcomeError           = "error"
+)
+
+// Collector is a prometheus.Collector with the metrics of repository operations:
+//
+//   - <namespace>_operations_total, a counter labeled by operation and outcome
+//   - <namespace>_operation_duration_seconds, a histogram labeled by operation
+//
+// Labels only take the operation names and the fixed outcomes above, never identifiers or keys,
+// so the number of series is bounded.
+type Collector struct {
+	operations *prometheus.CounterVec
+	durations  *prometheus.HistogramVec
+}
+
+var _ prometheus.Collector = (*Collector)(nil)
+
+// NewCollector creates a Collector whose metric names start with namespace.
+// Register it with a prometheus.Registerer and pass its Hook to datarepository.NewHookedRepository.
+func NewCollector(namespace string) *Collector {
+	return &Collector{
+		operations: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Namespace: namespace,
+			Name:      "operations_total",
+			Help:      "Number of repository operations by operation and outcome.",
+		}, []string{LabelOperation, LabelOutcome}),
+		durations: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Namespace: namespace,
+			Name:      "operation_duration_seconds",
+			Help:      "Duration of repository operations in seconds.",
+			Buckets:   prometheus.DefBuckets,
+		}, []string{LabelOperation}),
+	}
+}
+
+// WithMetrics wraps repo so that its operations are recorded by a new Collector, which is
+// registered with registerer (prometheus.DefaultRegisterer if nil)
+func WithMetrics(repo datarepository.DataRepository, namespace string, registerer prometheus.Registerer) (*datarepository.HookedRepository, *Collector, error) {
+	if registerer == nil {
+		registerer = prometheus.DefaultRegisterer
+	}
+	collector := NewCollector(namespace)
+	if err := registerer.Register(collector); err != nil {
+		return nil, nil, err
+	}
+	return datarepository.NewHookedRepository(repo, collector.Hook), collector, nil
+}
+
+// Hook records an operation. It is a datarepository.OperationHook.
+func (c *Collector) Hook(op datarepository.Operation, identifier datarepository.EntityIdentifier, duration time.Duration, err error) {
+	c.operations.WithLabelValues(string(op), Outcome(err)).Inc()
+	c.durations.WithLabelValues(string(op)).Observe(duration.Seconds())
+}
+
+// Outcome classifies the error of an operation into one of the Outcome constants
+func Outcome(err error) string {
+	switch {
+	case err == nil:
+		return OutcomeSuccess
+	case errors.Is(err, datarepository.ErrNotFound):
+		return OutcomeNotFound
+	case errors.Is(err, datarepository.ErrAlreadyExists):
+		return OutcomeAlreadyExists
+	case errors.Is(err, datarepository.ErrVersionConflict):
+		return OutcomeVersionConflict
+	case errors.Is(err, datarepository.ErrInvalidInput), errors.Is(err, datarepository.ErrInvalidIdentifier):
+		return OutcomeInvalid
+	case errors.Is(err, datarepository.ErrNotSupported):
+		return OutcomeNotSupported
+	case errors.Is(err, context.Canceled), errors.Is(err, context.DeadlineExceeded):
+		return OutcomeCanceled
+	default:
+		return OutcomeError
+	}
+}
+
+// Describe implements prometheus.Collector
+func (c *Collector) Describe(ch chan<- *prometheus.Desc) {
+	c.operations.Describe(ch)
+	c.durations.Describe(ch)
+}
+
+// Collect implements prometheus.Collector
+func (c *Collector) Collect(ch chan<- prometheus.Metric) {
+	c.operations.Collect(ch)
+	c.durations.Collect(ch)
+}
@@ -0,0 +1,94 @@
+// metrics/metrics_test.go
+
+package metrics
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+func TestWithMetricsRecordsOperations(t *testing.T) {
+	ctx := context.Background()
+	inner, err := datarepository.NewMemoryRepository(datarepository.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+	defer inner.Close()
+	registry := prometheus.NewRegistry()
+	repo, _, err := WithMetrics(inner, "test", registry)
+	if err != nil {
+		t.Fatalf("WithMetrics: %v", err)
+	}
+
+	id := datarepository.SimpleIdentifier("user:1")
+	for i := 0; i < 2; i++ {
+		if err := repo.Upsert(ctx, id, map[string]string{"name": "ann"}); err != nil {
+			t.Fatalf("Upsert: %v", err)
+		}
+	}
+	if err := repo.Create(ctx, id, map[string]string{"name": "bob"}); !errors.Is(err, datarepository.ErrAlreadyExists) {
+		t.Fatalf("Create of an existing entity: got %v, want ErrAlreadyExists", err)
+	}
+	var value map[string]string
+	if err := repo.Read(ctx, datarepository.SimpleIdentifier("user:2"), &value); !errors.Is(err, datarepository.ErrNotFound) {
+		t.Fatalf("Read of a missing entity: got %v, want ErrNotFound", err)
+	}
+
+	families, err := registry.Gather()
+	if err != nil {
+		t.Fatalf("Gather: %v", err)
+	}
+	counts := make(map[string]float64)
+	observations := make(map[string]uint64)
+	for _, family := range families {
+		for _, metric := range family.GetMetric() {
+			labels := make(map[string]string)
+			for _, label := range metric.GetLabel() {
+				labels[label.GetName()] = label.GetValue()
+			}
+			switch family.GetName() {
+			case "test_operations_total":
+				counts[labels[LabelOperation]+"/"+labels[LabelOutcome]] = metric.GetCounter().GetValue()
+			case "test_operation_duration_seconds":
+				observations[labels[LabelOperation]] = metric.GetHistogram().GetSampleCount()
+			default:
+				t.Errorf("unexpected metric family %s", family.GetName())
+			}
+		}
+	}
+
+	wantCounts := map[string]float64{"Upsert/success": 2, "Create/already_exists": 1, "Read/not_found": 1}
+	if len(counts) != len(wantCounts) {
+		t.Errorf("operations_total: got %v, want %v", counts, wantCounts)
+	}
+	for series, want := range wantCounts {
+		if counts[series] != want {
+			t.Errorf("operations_total{%s}: got %v, want %v", series, counts[series], want)
+		}
+	}
+	wantObservations := map[string]uint64{"Upsert": 2, "Create": 1, "Read": 1}
+	for op, want := range wantObservations {
+		if observations[op] != want {
+			t.Errorf("operation_duration_seconds{%s}: got %d observations, want %d", op, observations[op], want)
+		}
+	}
+}
+
+func TestOutcome(t *testing.T) {
+	for err, want := range map[error]string{
+		nil:                                 OutcomeSuccess,
+		datarepository.ErrNotFound:          OutcomeNotFound,
+		datarepository.ErrVersionConflict:   OutcomeVersionConflict,
+		datarepository.ErrInvalidIdentifier: OutcomeInvalid,
+		context.DeadlineExceeded:            OutcomeCanceled,
+		errors.New("connection reset"):      OutcomeError,
+	} {
+		if got := Outcome(err); got != want {
+			t.Errorf("Outcome(%v): got %s, want %s", err, got, want)
+		}
+	}
+}
@@ -0,0 +1,28 @@
+// mongo/mongo.config_test.go
+
+package mongo
+
+import (
+	"errors"
+	"strings"
+	"testing"
+
+	datarepository "github.com/itsatony/go-datarepository"
+)
+
+func TestCreateDataRepositoryRejectsInvalidMongoConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		config MongoConfig
+		want   string
+	}{
+		{MongoConfig{}, "MongoConfig: URI is empty"},
+		{MongoConfig{URI: "localhost:27017"}, "MongoConfig: URI must start with mongodb://"},
+		{MongoConfig{URI: "mongodb://localhost", Database: "my.db"}, `MongoConfig: Database "my.db"`},
+		{MongoConfig{URI: "mongodb://localhost", CollectionPrefix: "$app"}, `MongoConfig: CollectionPrefix "$app"`},
+	} {
+		_, err := datarepository.CreateDataRepository("mongo", tc.config)
+		if !errors.Is(err, datarepository.ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: got %v, want ErrInvalidInput containing %q", tc.config, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,302 @@
+// mongo/mongo.transaction.go
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"go.mongodb.org/mongo-driver/v2/mongo"
+)
+
+// WithTransaction runs fn within a multi-document transaction, which requires a replica set or
+// sharded cluster. The driver retries fn on transient transaction errors.
+func (r *MongoRepository) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	session, err := r.client.StartSession()
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(ctx context.Context) (interface{}, error) {
+		return nil, fn(&mongoTransaction{repo: r, session: session})
+	})
+	return err
+}
+
+// mongoTransaction is the repository passed to a WithTransaction function. It runs every
+// operation of the MongoRepository within the transaction's session.
+type mongoTransaction struct {
+	repo    *MongoRepository
+	session *mongo.Session
+}
+
+var _ datarepository.DataRepository = (*mongoTransaction)(nil)
+
+// ctx binds ctx to the transaction's session
+func (t *mongoTransaction) ctx(ctx context.Context) context.Context {
+	return mongo.NewSessionContext(ctx, t.session)
+}
+
+func (t *mongoTransaction) Create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	return t.repo.Create(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) CreateIfAbsent(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	return t.repo.CreateIfAbsent(t.ctx(ctx), identifier, value, ttl)
+}
+
+func (t *mongoTransaction) CreateWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return t.repo.CreateWithTTL(t.ctx(ctx), identifier, value, ttl)
+}
+
+func (t *mongoTransaction) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (datarepository.EntityIdentifier, error) {
+	return t.repo.CreateWithGeneratedID(t.ctx(ctx), entityPrefix, value)
+}
+
+func (t *mongoTransaction) Read(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	return t.repo.Read(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) ReadWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) (time.Duration, error) {
+	return t.repo.ReadWithTTL(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) Exists(ctx context.Context, identifier datarepository.EntityIdentifier) (bool, error) {
+	return t.repo.Exists(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) ExistsMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) (map[datarepository.EntityIdentifier]bool, error) {
+	return t.repo.ExistsMany(t.ctx(ctx), identifiers)
+}
+
+func (t *mongoTransaction) Upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	return t.repo.Upsert(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) UpsertWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return t.repo.UpsertWithTTL(t.ctx(ctx), identifier, value, ttl)
+}
+
+func (t *mongoTransaction) UpsertManyWithTTL(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}, ttl time.Duration) error {
+	return t.repo.UpsertManyWithTTL(t.ctx(ctx), items, ttl)
+}
+
+func (t *mongoTransaction) Update(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	return t.repo.Update(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) UpdateField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	return t.repo.UpdateField(t.ctx(ctx), identifier, path, value)
+}
+
+func (t *mongoTransaction) CompareAndSwap(ctx context.Context, identifier datarepository.EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	return t.repo.CompareAndSwap(t.ctx(ctx), identifier, expected, newValue)
+}
+
+func (t *mongoTransaction) UpdateWithVersion(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	return t.repo.UpdateWithVersion(t.ctx(ctx), identifier, value, expectedVersion)
+}
+
+func (t *mongoTransaction) GetVersion(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return t.repo.GetVersion(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) ReadField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	return t.repo.ReadField(t.ctx(ctx), identifier, path, value)
+}
+
+func (t *mongoTransaction) Delete(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return t.repo.Delete(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) GetAndDelete(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	return t.repo.GetAndDelete(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) GetAndSet(ctx context.Context, identifier datarepository.EntityIdentifier, newValue, oldValue interface{}) error {
+	return t.repo.GetAndSet(t.ctx(ctx), identifier, newValue, oldValue)
+}
+
+func (t *mongoTransaction) CreateMany(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}) error {
+	return t.repo.CreateMany(t.ctx(ctx), items)
+}
+
+func (t *mongoTransaction) ReadMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	return t.repo.ReadMany(t.ctx(ctx), identifiers, fn)
+}
+
+func (t *mongoTransaction) ReadManyOrdered(ctx context.Context, identifiers []datarepository.EntityIdentifier, dest interface{}) error {
+	return t.repo.ReadManyOrdered(t.ctx(ctx), identifiers, dest)
+}
+
+func (t *mongoTransaction) DeleteMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) error {
+	return t.repo.DeleteMany(t.ctx(ctx), identifiers)
+}
+
+func (t *mongoTransaction) DeletePattern(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	return t.repo.DeletePattern(t.ctx(ctx), pattern)
+}
+
+func (t *mongoTransaction) List(ctx context.Context, pattern string) ([]datarepository.EntityIdentifier, []interface{}, error) {
+	return t.repo.List(t.ctx(ctx), pattern)
+}
+
+func (t *mongoTransaction) ListDetailed(ctx context.Context, pattern string) (datarepository.ListResult, error) {
+	return t.repo.ListDetailed(t.ctx(ctx), pattern)
+}
+
+func (t *mongoTransaction) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]datarepository.EntityIdentifier, []interface{}, uint64, error) {
+	return t.repo.ListPaged(t.ctx(ctx), pattern, cursor, pageSize)
+}
+
+func (t *mongoTransaction) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]datarepository.EntityIdentifier, string, error) {
+	return t.repo.ListPage(t.ctx(ctx), pattern, cursor, pageSize)
+}
+
+func (t *mongoTransaction) Count(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	return t.repo.Count(t.ctx(ctx), pattern)
+}
+
+func (t *mongoTransaction) Iterate(ctx context.Context, pattern datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	return t.repo.Iterate(t.ctx(ctx), pattern, fn)
+}
+
+func (t *mongoTransaction) EntityPrefixes(ctx context.Context) ([]string, error) {
+	return t.repo.EntityPrefixes(t.ctx(ctx))
+}
+
+func (t *mongoTransaction) ListPrefixes(ctx context.Context) ([]string, error) {
+	return t.EntityPrefixes(ctx)
+}
+
+func (t *mongoTransaction) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]datarepository.EntityIdentifier, error) {
+	return t.repo.Search(t.ctx(ctx), query, offset, limit, sortBy, sortDir)
+}
+
+func (t *mongoTransaction) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (datarepository.SearchResult, error) {
+	return t.repo.SearchDetailed(t.ctx(ctx), query, offset, limit, sortBy, sortDir)
+}
+
+func (t *mongoTransaction) SearchResults(ctx context.Context, query string, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return t.repo.SearchResults(t.ctx(ctx), query, opts)
+}
+
+func (t *mongoTransaction) SearchQuery(ctx context.Context, query *datarepository.Query, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return t.repo.SearchQuery(t.ctx(ctx), query, opts)
+}
+
+func (t *mongoTransaction) AcquireLock(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (bool, error) {
+	return t.repo.AcquireLock(t.ctx(ctx), identifier, ttl)
+}
+
+func (t *mongoTransaction) AcquireLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	return t.repo.AcquireLockWithToken(t.ctx(ctx), identifier, ttl)
+}
+
+func (t *mongoTransaction) ReleaseLock(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return t.repo.ReleaseLock(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) ReleaseLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	return t.repo.ReleaseLockWithToken(t.ctx(ctx), identifier, token)
+}
+
+func (t *mongoTransaction) RenewLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	return t.repo.RenewLock(t.ctx(ctx), identifier, token, ttl)
+}
+
+func (t *mongoTransaction) Publish(ctx context.Context, channel string, message interface{}) error {
+	return t.repo.Publish(t.ctx(ctx), channel, message)
+}
+
+func (t *mongoTransaction) SetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration) error {
+	return t.repo.SetExpiration(t.ctx(ctx), identifier, expiration)
+}
+
+func (t *mongoTransaction) SetExpirationMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, expiration time.Duration) error {
+	return t.repo.SetExpirationMany(t.ctx(ctx), identifiers, expiration)
+}
+
+func (t *mongoTransaction) SetExpirationCond(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration, cond datarepository.ExpirationCondition) (bool, error) {
+	return t.repo.SetExpirationCond(t.ctx(ctx), identifier, expiration, cond)
+}
+
+func (t *mongoTransaction) GetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier) (time.Duration, error) {
+	return t.repo.GetExpiration(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) Persist(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return t.repo.Persist(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) Touch(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return t.repo.Touch(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) AtomicIncrement(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return t.repo.AtomicIncrement(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) IncrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	return t.repo.IncrementBy(t.ctx(ctx), identifier, delta)
+}
+
+func (t *mongoTransaction) DecrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	return t.repo.DecrementBy(t.ctx(ctx), identifier, delta)
+}
+
+func (t *mongoTransaction) IncrementWithLimit(ctx context.Context, identifier datarepository.EntityIdentifier, delta, max int64) (int64, bool, error) {
+	return t.repo.IncrementWithLimit(t.ctx(ctx), identifier, delta, max)
+}
+
+func (t *mongoTransaction) IncrementWithExpiry(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	return t.repo.IncrementWithExpiry(t.ctx(ctx), identifier, delta, ttl)
+}
+
+func (t *mongoTransaction) IncrementFloat(ctx context.Context, identifier datarepository.EntityIdentifier, delta float64) (float64, error) {
+	return t.repo.IncrementFloat(t.ctx(ctx), identifier, delta)
+}
+
+func (t *mongoTransaction) GetCounter(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return t.repo.GetCounter(t.ctx(ctx), identifier)
+}
+
+func (t *mongoTransaction) SetCounter(ctx context.Context, identifier datarepository.EntityIdentifier, value int64) error {
+	return t.repo.SetCounter(t.ctx(ctx), identifier, value)
+}
+
+func (t *mongoTransaction) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	return nil, datarepository.ErrInTransaction
+}
+
+func (t *mongoTransaction) SubscribeMessages(ctx context.Context, channel string) (datarepository.Subscription, error) {
+	return nil, datarepository.ErrInTransaction
+}
+
+func (t *mongoTransaction) PSubscribe(ctx context.Context, pattern string) (datarepository.Subscription, error) {
+	return nil, datarepository.ErrInTransaction
+}
+
+func (t *mongoTransaction) Ping(ctx context.Context) error {
+	return t.repo.Ping(ctx)
+}
+
+func (t *mongoTransaction) Close() error {
+	return datarepository.ErrInTransaction
+}
+
+// WithTransaction runs fn within the enclosing transaction, as MongoDB doesn't nest transactions
+func (t *mongoTransaction) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	return fn(t)
+}
+
+func (t *mongoTransaction) RegisterPlugin(plugin datarepository.RepositoryPlugin) error {
+	return t.repo.RegisterPlugin(plugin)
+}
+
+func (t *mongoTransaction) GetPlugin(name string) (datarepository.RepositoryPlugin, bool) {
+	return t.repo.GetPlugin(name)
+}
@@ -0,0 +1,60 @@
+//go:build integration
+
+// mongo/mongo_test.go
+
+package mongo
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"testing"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/itsatony/go-datarepository/datarepositorytest"
+)
+
+// newTestMongoRepository returns a MongoRepository on the server at MONGO_URI, using a database
+// of its own that is dropped when the test ends. Skips the test if MONGO_URI is not set.
+func newTestMongoRepository(t *testing.T) *MongoRepository {
+	t.Helper()
+	uri := os.Getenv("MONGO_URI")
+	if uri == "" {
+		t.Skip("MONGO_URI not set")
+	}
+	repo, err := NewMongoRepository(MongoConfig{
+		URI:      uri,
+		Database: fmt.Sprintf("datarepository_test_%d", time.Now().UnixNano()),
+	})
+	if err != nil {
+		t.Fatalf("NewMongoRepository: %v", err)
+	}
+	mongo := repo.(*MongoRepository)
+	t.Cleanup(func() {
+		if err := mongo.db.Drop(context.Background()); err != nil {
+			t.Errorf("dropping the test database: %v", err)
+		}
+		mongo.Close()
+	})
+	return mongo
+}
+
+func TestMongoConformance(t *testing.T) {
+	datarepositorytest.Conformance(t, newTestMongoRepository(t))
+}
+
+func TestMongoListMatchesGlobs(t *testing.T) {
+	ctx := context.Background()
+	repo := newTestMongoRepository(t)
+	for _, id := range []string{"user:1", "user:12", "user:2", "user:a.b", "order:1"} {
+		if err := repo.Create(ctx, datarepository.SimpleIdentifier(id), map[string]string{"id": id}); err != nil {
+			t.Fatalf("Create %s: %v", id, err)
+		}
+	}
+	for pattern, want := range map[string]int{"user:*": 4, "user:1*": 2, "user:?": 2, "user:a.b": 1, "order:*": 1} {
+		if ids, _, err := repo.List(ctx, pattern); err != nil || len(ids) != want {
+			t.Errorf("List(%q): got %v, %v, want %d entities", pattern, ids, err, want)
+		}
+	}
+}
@@ -0,0 +1,1642 @@
+// sqlite/sqlite.go
+
+// Package sqlite implements a datarepository.DataRepository on an SQLite database file, for
+// single-node deployments. Importing it registers the "sqlite" repository type with
+// datarepository.CreateDataRepository.
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	nuts "github.com/vaudience/go-nuts"
+	_ "modernc.org/sqlite" // registers the pure Go "sqlite" driver
+)
+
+const (
+	DefaultSQLiteSweepInterval = 1 * time.Minute
+	// SQLiteIterateBatchSize is the number of entities Iterate reads per query
+	SQLiteIterateBatchSize = 100
+
+	// sqliteLive restricts a query to entities that have not expired; its parameter is the current time in ms
+	sqliteLive = "(expires_at IS NULL OR expires_at > ?)"
+)
+
+var sqliteSchema = []string{
+	`CREATE TABLE IF NOT EXISTS entities (
+		prefix     TEXT NOT NULL,
+		id         TEXT NOT NULL,
+		value      BLOB NOT NULL,
+		expires_at INTEGER,
+		version    INTEGER NOT NULL DEFAULT 0,
+		PRIMARY KEY (prefix, id)
+	)`,
+	`CREATE INDEX IF NOT EXISTS entities_expires_at ON entities (expires_at) WHERE expires_at IS NOT NULL`,
+	`CREATE TABLE IF NOT EXISTS locks (
+		key        TEXT PRIMARY KEY,
+		token      TEXT NOT NULL,
+		expires_at INTEGER NOT NULL
+	)`,
+}
+
+type SQLiteConfig struct {
+	// Path is the database file, which is created if it doesn't exist
+	Path string
+	// SweepInterval is the interval at which expired entities and locks are deleted.
+	// Defaults to DefaultSQLiteSweepInterval.
+	SweepInterval time.Duration
+	// Codec serializes entity values. Defaults to JSONCodec.
+	Codec datarepository.Codec
+	// IDGenerator is used by CreateWithGeneratedID. Defaults to UUIDv4Generator.
+	IDGenerator datarepository.IDGenerator
+	// NotFoundOnEmpty makes List, Search and SearchDetailed return ErrNotFound instead of an
+	// empty result when nothing matches
+	NotFoundOnEmpty bool
+	// Logger receives diagnostic messages, e.g. about entries skipped by List or Search.
+	// Defaults to a no-op logger.
+	Logger datarepository.Logger
+}
+
+func (c SQLiteConfig) GetConnectionString() string {
+	return c.Path
+}
+
+// Validate checks the config without opening the database.
+// Returns ErrInvalidInput naming the offending field.
+func (c SQLiteConfig) Validate() error {
+	if c.Path == "" {
+		return datarepository.InvalidConfig("SQLiteConfig", "Path is empty")
+	}
+	return nil
+}
+
+// SQLiteIdentifier identifies the entity stored in the row (EntityPrefix, ID)
+type SQLiteIdentifier struct {
+	EntityPrefix string
+	ID           string
+}
+
+func (si SQLiteIdentifier) String() string {
+	return si.EntityPrefix + datarepository.DefaultKeySeparator + si.ID
+}
+
+// Parts returns the entity prefix and the id
+func (si SQLiteIdentifier) Parts() (string, string) {
+	return si.EntityPrefix, si.ID
+}
+
+// SQLiteRepository stores entities in a single SQLite database file. All statements run on one
+// connection, which serializes them and makes read-modify-write operations atomic.
+// Pub/sub is delivered in-process, as the repository is meant for single-node deployments.
+type SQLiteRepository struct {
+	datarepository.BaseRepository
+	db              *sql.DB
+	conn            sqliteConn
+	pubsub          *datarepository.MemoryRepository
+	sweeper         *nuts.GoInterval
+	codec           datarepository.Codec
+	idGen           datarepository.IDGenerator
+	notFoundOnEmpty bool
+	logger          datarepository.Logger
+
+	// Set on the repository passed to a WithTransaction function: the enclosing transaction
+	// and the messages to publish once it commits
+	tx      *sql.Tx
+	pending []pendingMessage
+}
+
+// pendingMessage is a message published within a transaction, sent once the transaction commits
+type pendingMessage struct {
+	channel string
+	message interface{}
+}
+
+var _ datarepository.DataRepository = (*SQLiteRepository)(nil)
+
+func init() {
+	datarepository.RegisterDataRepository("sqlite", NewSQLiteRepository)
+}
+
+func NewSQLiteRepository(config datarepository.Config) (datarepository.DataRepository, error) {
+	cfg, ok := config.(SQLiteConfig)
+	if !ok {
+		return nil, fmt.Errorf("%w: SQLite repository needs an SQLiteConfig, got %T", datarepository.ErrInvalidInput, config)
+	}
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+	if cfg.SweepInterval <= 0 {
+		cfg.SweepInterval = DefaultSQLiteSweepInterval
+	}
+	if cfg.IDGenerator == nil {
+		cfg.IDGenerator = datarepository.UUIDv4Generator{}
+	}
+	if cfg.Codec == nil {
+		cfg.Codec = datarepository.JSONCodec{}
+	}
+
+	db, err := sql.Open("sqlite", "file:"+cfg.Path+"?_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)")
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+	}
+	db.SetMaxOpenConns(1)
+	for _, statement := range sqliteSchema {
+		if _, err := db.Exec(statement); err != nil {
+			db.Close()
+			return nil, fmt.Errorf("%w: failed to create schema: %v", datarepository.ErrOperationFailed, err)
+		}
+	}
+	if err := migrateSQLiteSchema(db); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("%w: failed to migrate schema: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	pubsub, err := datarepository.NewMemoryRepository(datarepository.MemoryConfig{Codec: cfg.Codec})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	repo := &SQLiteRepository{
+		db:              db,
+		conn:            db,
+		pubsub:          pubsub.(*datarepository.MemoryRepository),
+		codec:           cfg.Codec,
+		idGen:           cfg.IDGenerator,
+		notFoundOnEmpty: cfg.NotFoundOnEmpty,
+		logger:          datarepository.ResolveLogger(cfg.Logger, nil),
+	}
+
+	repo.sweeper = nuts.Interval(func() bool {
+		repo.cleanupExpired()
+		return true
+	}, cfg.SweepInterval, false)
+
+	return repo, nil
+}
+
+// migrateSQLiteSchema adds the columns introduced after the initial schema to existing databases
+func migrateSQLiteSchema(db *sql.DB) error {
+	rows, err := db.Query(`SELECT name FROM pragma_table_info('entities')`)
+	if err != nil {
+		return err
+	}
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			return err
+		}
+		columns[name] = true
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	if !columns["version"] {
+		if _, err := db.Exec(`ALTER TABLE entities ADD COLUMN version INTEGER NOT NULL DEFAULT 0`); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// nowMillis returns the current time as stored in expires_at
+func nowMillis() int64 {
+	return time.Now().UnixMilli()
+}
+
+// sqliteGlob converts a glob pattern into the pattern of SQLite's GLOB operator that matches
+// the same strings as the pattern does in Redis. GLOB has no escapes, so escaped metacharacters
+// become classes, and its classes differ in how "]", "^" and "-" are listed.
+func sqliteGlob(pattern string) string {
+	if !strings.ContainsAny(pattern, `\[`) {
+		return pattern
+	}
+	var b strings.Builder
+	for _, token := range datarepository.ParseGlob(pattern) {
+		switch token.Kind {
+		case datarepository.GlobAny:
+			b.WriteString("*")
+		case datarepository.GlobOne:
+			b.WriteString("?")
+		case datarepository.GlobClass:
+			writeSQLiteClass(&b, token)
+		default:
+			if token.Char == '*' || token.Char == '?' || token.Char == '[' {
+				b.WriteString("[" + string(token.Char) + "]")
+			} else {
+				b.WriteRune(token.Char)
+			}
+		}
+	}
+	return b.String()
+}
+
+// writeSQLiteClass writes a class token as a GLOB class. GLOB only reads "]" as a member if it
+// comes first and "-" if it comes first or last, and "^" in first place negates the class, so
+// these are taken out of the ranges and listed where GLOB reads them as members.
+func writeSQLiteClass(b *strings.Builder, token datarepository.GlobToken) {
+	var members strings.Builder
+	var closing, caret, dash bool
+	for _, r := range token.Ranges {
+		lo, hi := r.Lo, r.Hi
+		for lo <= hi && (lo == ']' || lo == '^' || lo == '-') {
+			closing, caret, dash = closing || lo == ']', caret || lo == '^', dash || lo == '-'
+			lo++
+		}
+		for lo <= hi && (hi == ']' || hi == '^' || hi == '-') {
+			closing, caret, dash = closing || hi == ']', caret || hi == '^', dash || hi == '-'
+			hi--
+		}
+		if lo < hi {
+			members.WriteString(string(lo) + "-" + string(hi))
+		} else if lo == hi {
+			members.WriteRune(lo)
+		}
+	}
+	if !closing && !caret && !dash && members.Len() == 0 {
+		if token.Negated {
+			b.WriteString("?")
+		} else {
+			// Matches only NUL, which keys don't contain, as GLOB has no class matching nothing
+			b.WriteString("[^\u0001-\U0010FFFF]")
+		}
+		return
+	}
+	if !token.Negated && caret && !closing && members.Len() == 0 {
+		// "^" must not come first, where GLOB reads it as a negation
+		if dash {
+			b.WriteString("[-^]")
+		} else {
+			b.WriteString("^")
+		}
+		return
+	}
+	b.WriteString("[")
+	if token.Negated {
+		b.WriteString("^")
+	}
+	if closing {
+		b.WriteString("]")
+	}
+	b.WriteString(members.String())
+	if caret {
+		b.WriteString("^")
+	}
+	if dash {
+		b.WriteString("-")
+	}
+	b.WriteString("]")
+}
+
+// expiresAt returns the expires_at value for an expiration starting now
+func expiresAt(expiration time.Duration) int64 {
+	return time.Now().Add(expiration).UnixMilli()
+}
+
+// ttlFromMillis returns the remaining time to live of an expires_at value, or NoExpiration if it is NULL
+func ttlFromMillis(expires sql.NullInt64) time.Duration {
+	if !expires.Valid {
+		return datarepository.NoExpiration
+	}
+	return time.Until(time.UnixMilli(expires.Int64))
+}
+
+// encode serializes an entity value with the configured codec.
+// Returns ErrInvalidInput if value is nil.
+func (r *SQLiteRepository) encode(value interface{}) ([]byte, error) {
+	if err := datarepository.CheckValue(value); err != nil {
+		return nil, err
+	}
+	return r.encodeField(value)
+}
+
+// encodeField serializes value with the configured codec. Unlike encode, it accepts nil, which
+// UpdateField stores as null.
+func (r *SQLiteRepository) encodeField(value interface{}) ([]byte, error) {
+	data, err := r.codec.Marshal(value)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidInput, err)
+	}
+	return data, nil
+}
+
+// readRow returns the value and expiration of a live entity. An expired entity is deleted
+// right away instead of waiting for the sweeper.
+func (r *SQLiteRepository) readRow(ctx context.Context, prefix, id string) ([]byte, sql.NullInt64, error) {
+	var value []byte
+	var expires sql.NullInt64
+	err := r.conn.QueryRowContext(ctx, `SELECT value, expires_at FROM entities WHERE prefix = ? AND id = ?`, prefix, id).Scan(&value, &expires)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, expires, datarepository.ErrNotFound
+	} else if err != nil {
+		return nil, expires, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if expires.Valid && expires.Int64 <= nowMillis() {
+		_, _ = r.conn.ExecContext(ctx, `DELETE FROM entities WHERE prefix = ? AND id = ? AND expires_at <= ?`, prefix, id, nowMillis())
+		return nil, expires, datarepository.ErrNotFound
+	}
+	return value, expires, nil
+}
+
+// sqliteConn is implemented by *sql.DB and *sql.Tx
+type sqliteConn interface {
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row
+}
+
+// sqliteTx is a database transaction, or a savepoint if the repository is already within one
+type sqliteTx struct {
+	*sql.Tx
+	savepoint string
+	done      bool
+}
+
+// sqliteSavepoints numbers savepoints so that each has a unique name
+var sqliteSavepoints uint64
+
+// begin starts a transaction, which becomes a savepoint within the enclosing transaction of a
+// WithTransaction repository
+func (r *SQLiteRepository) begin(ctx context.Context) (*sqliteTx, error) {
+	if r.tx == nil {
+		tx, err := r.db.BeginTx(ctx, nil)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		return &sqliteTx{Tx: tx}, nil
+	}
+	savepoint := fmt.Sprintf("sp%d", atomic.AddUint64(&sqliteSavepoints, 1))
+	if _, err := r.tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return &sqliteTx{Tx: r.tx, savepoint: savepoint}, nil
+}
+
+func (t *sqliteTx) Commit() error {
+	t.done = true
+	if t.savepoint == "" {
+		return t.Tx.Commit()
+	}
+	_, err := t.Exec("RELEASE " + t.savepoint)
+	return err
+}
+
+// Rollback discards the transaction unless it was committed
+func (t *sqliteTx) Rollback() error {
+	if t.done {
+		return nil
+	}
+	t.done = true
+	if t.savepoint == "" {
+		return t.Tx.Rollback()
+	}
+	if _, err := t.Exec("ROLLBACK TO " + t.savepoint); err != nil {
+		return err
+	}
+	_, err := t.Exec("RELEASE " + t.savepoint)
+	return err
+}
+
+// insert creates the entity with the given expiration (NULL for none) unless a live one exists,
+// replacing an expired one that wasn't swept yet
+func (r *SQLiteRepository) insert(ctx context.Context, exec sqliteConn, prefix, id string, data []byte, expires sql.NullInt64) error {
+	result, err := exec.ExecContext(ctx, `INSERT INTO entities (prefix, id, value, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (prefix, id) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at, version = 0
+		WHERE entities.expires_at IS NOT NULL AND entities.expires_at <= ?`, prefix, id, data, expires, nowMillis())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return datarepository.ErrAlreadyExists
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.insert(ctx, r.conn, prefix, id, data, sql.NullInt64{})
+}
+
+func (r *SQLiteRepository) CreateIfAbsent(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	if ttl < 0 {
+		return false, fmt.Errorf("%w: ttl must not be negative", datarepository.ErrInvalidInput)
+	}
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return false, err
+	}
+	var expires sql.NullInt64
+	if ttl > 0 {
+		expires = sql.NullInt64{Int64: expiresAt(ttl), Valid: true}
+	}
+	err = r.insert(ctx, r.conn, prefix, id, data, expires)
+	if errors.Is(err, datarepository.ErrAlreadyExists) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+func (r *SQLiteRepository) CreateWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	return datarepository.CreateWithTTL(ctx, r, identifier, value, ttl)
+}
+
+func (r *SQLiteRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (datarepository.EntityIdentifier, error) {
+	if !datarepository.IsValidEntityPrefix(entityPrefix) {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrInvalidIdentifier, datarepository.ErrInvalidEntityPrefix)
+	}
+	return datarepository.CreateWithGeneratedID(ctx, r, r.idGen, entityPrefix, value, func(entityPrefix, id string) datarepository.EntityIdentifier {
+		return SQLiteIdentifier{EntityPrefix: entityPrefix, ID: id}
+	})
+}
+
+func (r *SQLiteRepository) Read(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, _, err := r.readRow(ctx, prefix, id)
+	if err != nil {
+		return err
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *SQLiteRepository) Exists(ctx context.Context, identifier datarepository.EntityIdentifier) (bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	var count int
+	err = r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&count)
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return count == 1, nil
+}
+
+func (r *SQLiteRepository) ExistsMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) (map[datarepository.EntityIdentifier]bool, error) {
+	return datarepository.ExistsMany(ctx, r, identifiers)
+}
+
+func (r *SQLiteRepository) ReadWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) (time.Duration, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, expires, err := r.readRow(ctx, prefix, id)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.codec.Unmarshal(data, value); err != nil {
+		return 0, err
+	}
+	return ttlFromMillis(expires), nil
+}
+
+// upsert writes the entity; a live entity keeps its expiration and version, an expired one loses both
+func (r *SQLiteRepository) upsert(ctx context.Context, exec sqliteConn, prefix, id string, data []byte) error {
+	now := nowMillis()
+	_, err := exec.ExecContext(ctx, `INSERT INTO entities (prefix, id, value) VALUES (?, ?, ?)
+		ON CONFLICT (prefix, id) DO UPDATE SET value = excluded.value,
+		expires_at = CASE WHEN entities.expires_at <= ? THEN NULL ELSE entities.expires_at END,
+		version = CASE WHEN entities.expires_at <= ? THEN 0 ELSE entities.version END`, prefix, id, data, now, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	return r.upsert(ctx, r.conn, prefix, id, data)
+}
+
+func (r *SQLiteRepository) UpsertWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	_, err = r.conn.ExecContext(ctx, `INSERT INTO entities (prefix, id, value, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (prefix, id) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at,
+		version = CASE WHEN entities.expires_at <= ? THEN 0 ELSE entities.version END`, prefix, id, data, expiresAt(ttl), nowMillis())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) UpsertManyWithTTL(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}, ttl time.Duration) error {
+	if ttl <= 0 {
+		return fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	batchErr := &datarepository.BatchError{}
+	expires := expiresAt(ttl)
+	for identifier, value := range items {
+		prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		data, err := r.encode(value)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		_, err = tx.ExecContext(ctx, `INSERT INTO entities (prefix, id, value, expires_at) VALUES (?, ?, ?, ?)
+			ON CONFLICT (prefix, id) DO UPDATE SET value = excluded.value, expires_at = excluded.expires_at,
+			version = CASE WHEN entities.expires_at <= ? THEN 0 ELSE entities.version END`, prefix, id, data, expires, nowMillis())
+		if err != nil {
+			batchErr.Add(identifier, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err))
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *SQLiteRepository) Update(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return err
+	}
+	result, err := r.conn.ExecContext(ctx, `UPDATE entities SET value = ? WHERE prefix = ? AND id = ? AND `+sqliteLive, data, prefix, id, nowMillis())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+// toGeneric decodes a stored value into its generic representation (maps, slices and scalars)
+func (r *SQLiteRepository) toGeneric(data []byte) (interface{}, error) {
+	var generic interface{}
+	if err := r.codec.Unmarshal(data, &generic); err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return generic, nil
+}
+
+func (r *SQLiteRepository) UpdateField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	encoded, err := r.encodeField(value)
+	if err != nil {
+		return err
+	}
+	fieldValue, err := r.toGeneric(encoded)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var data []byte
+	err = tx.QueryRowContext(ctx, `SELECT value FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return datarepository.ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	doc, err := r.toGeneric(data)
+	if err != nil {
+		return err
+	}
+	if err := datarepository.SetFieldPath(doc, parts, fieldValue); err != nil {
+		return err
+	}
+	updated, err := r.encode(doc)
+	if err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE entities SET value = ? WHERE prefix = ? AND id = ?`, updated, prefix, id); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) CompareAndSwap(ctx context.Context, identifier datarepository.EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	var current []byte
+	err = tx.QueryRowContext(ctx, `SELECT value FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&current)
+	if errors.Is(err, sql.ErrNoRows) {
+		return false, datarepository.ErrNotFound
+	} else if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	equal, err := datarepository.EqualEncoded(r.codec, current, expected)
+	if err != nil || !equal {
+		return false, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE entities SET value = ? WHERE prefix = ? AND id = ?`, data, prefix, id); err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return true, nil
+}
+
+func (r *SQLiteRepository) UpdateWithVersion(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, err := r.encode(value)
+	if err != nil {
+		return 0, err
+	}
+	result, err := r.conn.ExecContext(ctx, `UPDATE entities SET value = ?, version = version + 1
+		WHERE prefix = ? AND id = ? AND version = ? AND `+sqliteLive, data, prefix, id, expectedVersion, nowMillis())
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		// Either the entity doesn't exist or its version differs
+		if _, err := r.GetVersion(ctx, identifier); err != nil {
+			return 0, err
+		}
+		return 0, datarepository.ErrVersionConflict
+	}
+	return expectedVersion + 1, nil
+}
+
+func (r *SQLiteRepository) GetVersion(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	var version int64
+	err = r.conn.QueryRowContext(ctx, `SELECT version FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&version)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, datarepository.ErrNotFound
+	} else if err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return version, nil
+}
+
+func (r *SQLiteRepository) ReadField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	parts, err := datarepository.SplitFieldPath(path)
+	if err != nil {
+		return err
+	}
+	data, _, err := r.readRow(ctx, prefix, id)
+	if err != nil {
+		return err
+	}
+
+	doc, err := r.toGeneric(data)
+	if err != nil {
+		return err
+	}
+	field, err := datarepository.GetFieldPath(doc, parts)
+	if err != nil {
+		return err
+	}
+	encoded, err := r.codec.Marshal(field)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return r.codec.Unmarshal(encoded, value)
+}
+
+func (r *SQLiteRepository) Delete(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	result, err := r.conn.ExecContext(ctx, `DELETE FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) GetAndDelete(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	var data []byte
+	err = r.conn.QueryRowContext(ctx, `DELETE FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive+` RETURNING value`, prefix, id, nowMillis()).Scan(&data)
+	if errors.Is(err, sql.ErrNoRows) {
+		return datarepository.ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return r.codec.Unmarshal(data, value)
+}
+
+func (r *SQLiteRepository) GetAndSet(ctx context.Context, identifier datarepository.EntityIdentifier, newValue, oldValue interface{}) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	data, err := r.encode(newValue)
+	if err != nil {
+		return err
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var previous []byte
+	err = tx.QueryRowContext(ctx, `SELECT value FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&previous)
+	if errors.Is(err, sql.ErrNoRows) {
+		return datarepository.ErrNotFound
+	} else if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE entities SET value = ? WHERE prefix = ? AND id = ?`, data, prefix, id); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return r.codec.Unmarshal(previous, oldValue)
+}
+
+func (r *SQLiteRepository) CreateMany(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}) error {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	batchErr := &datarepository.BatchError{}
+	for identifier, value := range items {
+		prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		data, err := r.encode(value)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		if err := r.insert(ctx, tx, prefix, id, data, sql.NullInt64{}); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *SQLiteRepository) ReadMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	batchErr := &datarepository.BatchError{}
+	found := make([]datarepository.EntityIdentifier, 0, len(identifiers))
+	raws := make([][]byte, 0, len(identifiers))
+	for _, identifier := range identifiers {
+		prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		data, _, err := r.readRow(ctx, prefix, id)
+		if err != nil {
+			batchErr.Add(identifier, err)
+			continue
+		}
+		found = append(found, identifier)
+		raws = append(raws, data)
+	}
+
+	// Callbacks run after all reads so fn may use the repository
+	for i, identifier := range found {
+		if err := fn(identifier, raws[i]); err != nil {
+			return err
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *SQLiteRepository) ReadManyOrdered(ctx context.Context, identifiers []datarepository.EntityIdentifier, dest interface{}) error {
+	return datarepository.ReadManyOrdered(ctx, r, r.codec, identifiers, dest)
+}
+
+func (r *SQLiteRepository) DeleteMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.Delete(ctx, identifier); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+// DeletePattern collects the matching entities with Iterate and removes them with DeleteMany
+func (r *SQLiteRepository) DeletePattern(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	return datarepository.DeletePattern(ctx, r, pattern)
+}
+
+// queryEntities runs a query selecting prefix, id and value and returns the identifiers and
+// decoded values. Rows that can't be decoded are reported as skipped.
+func (r *SQLiteRepository) queryEntities(ctx context.Context, query string, args ...interface{}) (datarepository.ListResult, error) {
+	rows, err := r.conn.QueryContext(ctx, query, args...)
+	if err != nil {
+		return datarepository.ListResult{}, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	defer rows.Close()
+
+	result := datarepository.ListResult{
+		Identifiers: []datarepository.EntityIdentifier{},
+		Entities:    []interface{}{},
+	}
+	for rows.Next() {
+		var prefix, id string
+		var data []byte
+		if err := rows.Scan(&prefix, &id, &data); err != nil {
+			return datarepository.ListResult{}, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		identifier := SQLiteIdentifier{EntityPrefix: prefix, ID: id}
+		var entity interface{}
+		if err := r.codec.Unmarshal(data, &entity); err != nil {
+			r.logger.Warnf("skipping entity %q that could not be decoded: %v", identifier.String(), err)
+			result.Skipped = append(result.Skipped, datarepository.SkippedKey{Key: identifier.String(), Err: err})
+			continue
+		}
+		result.Identifiers = append(result.Identifiers, identifier)
+		result.Entities = append(result.Entities, entity)
+	}
+	if err := rows.Err(); err != nil {
+		return datarepository.ListResult{}, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return result, nil
+}
+
+// List matches the glob pattern against "entityPrefix:id" using SQLite's GLOB operator
+func (r *SQLiteRepository) List(ctx context.Context, pattern string) ([]datarepository.EntityIdentifier, []interface{}, error) {
+	result, err := r.ListDetailed(ctx, pattern)
+	if err != nil {
+		return nil, nil, err
+	}
+	return result.List(r.notFoundOnEmpty)
+}
+
+func (r *SQLiteRepository) ListDetailed(ctx context.Context, pattern string) (datarepository.ListResult, error) {
+	result, err := r.queryEntities(ctx, `SELECT prefix, id, value FROM entities
+		WHERE (prefix || ? || id) GLOB ? AND `+sqliteLive+` ORDER BY prefix, id`, datarepository.DefaultKeySeparator, sqliteGlob(pattern), nowMillis())
+	if err != nil {
+		return datarepository.ListResult{}, err
+	}
+	if len(result.Identifiers) == 0 && len(result.Skipped) == 0 && r.notFoundOnEmpty {
+		return datarepository.ListResult{}, datarepository.ErrNotFound
+	}
+	return result, nil
+}
+
+func (r *SQLiteRepository) Count(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	var count int64
+	err := r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM entities WHERE (prefix || ? || id) GLOB ? AND `+sqliteLive,
+		datarepository.DefaultKeySeparator, sqliteGlob(pattern.String()), nowMillis()).Scan(&count)
+	if err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return count, nil
+}
+
+// Iterate reads the matching entities in batches of SQLiteIterateBatchSize ordered by prefix and
+// id, each one starting after the last entity of the previous batch. fn is called between the
+// queries, as the single connection can't serve fn while a query is open.
+func (r *SQLiteRepository) Iterate(ctx context.Context, pattern datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	type row struct {
+		identifier SQLiteIdentifier
+		data       []byte
+	}
+	var last SQLiteIdentifier
+	for {
+		rows, err := r.conn.QueryContext(ctx, `SELECT prefix, id, value FROM entities
+			WHERE (prefix || ? || id) GLOB ? AND `+sqliteLive+` AND (prefix, id) > (?, ?)
+			ORDER BY prefix, id LIMIT ?`,
+			datarepository.DefaultKeySeparator, sqliteGlob(pattern.String()), nowMillis(), last.EntityPrefix, last.ID, SQLiteIterateBatchSize)
+		if err != nil {
+			return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		batch := make([]row, 0, SQLiteIterateBatchSize)
+		for rows.Next() {
+			var item row
+			if err := rows.Scan(&item.identifier.EntityPrefix, &item.identifier.ID, &item.data); err != nil {
+				rows.Close()
+				return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+			}
+			batch = append(batch, item)
+		}
+		err = rows.Err()
+		rows.Close()
+		if err != nil {
+			return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+
+		for _, item := range batch {
+			if err := fn(item.identifier, item.data); err != nil {
+				return err
+			}
+		}
+		if len(batch) < SQLiteIterateBatchSize {
+			return nil
+		}
+		last = batch[len(batch)-1].identifier
+	}
+}
+
+func (r *SQLiteRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]datarepository.EntityIdentifier, []interface{}, uint64, error) {
+	if pageSize <= 0 {
+		return nil, nil, 0, fmt.Errorf("%w: page size must be positive", datarepository.ErrInvalidInput)
+	}
+	// The cursor is an offset into the sorted list of matching entities. One more row than
+	// requested is fetched to find out whether there is a next page.
+	result, err := r.queryEntities(ctx, `SELECT prefix, id, value FROM entities
+		WHERE (prefix || ? || id) GLOB ? AND `+sqliteLive+` ORDER BY prefix, id LIMIT ? OFFSET ?`,
+		datarepository.DefaultKeySeparator, sqliteGlob(pattern), nowMillis(), pageSize+1, int64(cursor))
+	if err != nil {
+		return nil, nil, 0, err
+	}
+	identifiers, entities := result.Identifiers, result.Entities
+	if int64(len(identifiers)) <= pageSize {
+		return identifiers, entities, 0, nil
+	}
+	return identifiers[:pageSize], entities[:pageSize], cursor + uint64(pageSize), nil
+}
+
+func (r *SQLiteRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]datarepository.EntityIdentifier, string, error) {
+	return datarepository.ListPage(ctx, r, pattern, cursor, pageSize)
+}
+
+func (r *SQLiteRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	rows, err := r.conn.QueryContext(ctx, `SELECT DISTINCT prefix FROM entities WHERE `+sqliteLive+` ORDER BY prefix`, nowMillis())
+	if err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	defer rows.Close()
+
+	prefixes := []string{}
+	for rows.Next() {
+		var prefix string
+		if err := rows.Scan(&prefix); err != nil {
+			return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+		}
+		prefixes = append(prefixes, prefix)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return prefixes, nil
+}
+
+func (r *SQLiteRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *SQLiteRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]datarepository.EntityIdentifier, error) {
+	result, err := r.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+	if err != nil {
+		return nil, err
+	}
+	return result.Identifiers, nil
+}
+
+func (r *SQLiteRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (datarepository.SearchResult, error) {
+	response, err := r.SearchResults(ctx, query, datarepository.SearchOptions{Offset: offset, Limit: limit, SortBy: sortBy, SortDir: sortDir})
+	if err != nil {
+		return datarepository.SearchResult{}, err
+	}
+	return response.SearchResult(), nil
+}
+
+// SearchResults finds entities whose serialized value contains query, like the memory
+// repository does. Results are sorted by identifier; SortBy is ignored.
+func (r *SQLiteRepository) SearchResults(ctx context.Context, query string, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	return r.search(ctx, `instr(CAST(value AS TEXT), ?) > 0`, []interface{}{query}, opts)
+}
+
+// SearchQuery compiles the query to conditions on the JSON values, so it requires a codec
+// that produces JSON. Results are sorted by identifier; SortBy is ignored.
+func (r *SQLiteRepository) SearchQuery(ctx context.Context, query *datarepository.Query, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	if err := query.Validate(); err != nil {
+		return datarepository.SearchResponse{}, err
+	}
+	where, args := sqliteQueryCondition(query)
+	return r.search(ctx, where, args, opts)
+}
+
+// search returns the page of live entities matching the where condition
+func (r *SQLiteRepository) search(ctx context.Context, where string, args []interface{}, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	if opts.Offset < 0 || opts.Limit < 0 {
+		return datarepository.SearchResponse{}, fmt.Errorf("%w: invalid offset or limit", datarepository.ErrInvalidInput)
+	}
+	order := "ASC"
+	if opts.SortDir == "DESC" {
+		order = "DESC"
+	}
+	args = append(args, nowMillis())
+
+	var total int64
+	err := r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM entities WHERE (`+where+`) AND `+sqliteLive, args...).Scan(&total)
+	if err != nil {
+		return datarepository.SearchResponse{}, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if total == 0 && r.notFoundOnEmpty {
+		return datarepository.SearchResponse{}, datarepository.ErrNotFound
+	}
+
+	found, err := r.queryEntities(ctx, `SELECT prefix, id, value FROM entities
+		WHERE (`+where+`) AND `+sqliteLive+`
+		ORDER BY prefix `+order+`, id `+order+` LIMIT ? OFFSET ?`, append(args, opts.Limit, opts.Offset)...)
+	if err != nil {
+		return datarepository.SearchResponse{}, err
+	}
+	response := datarepository.SearchResponse{Total: total, Hits: make([]datarepository.Hit, 0, len(found.Identifiers))}
+	for i, identifier := range found.Identifiers {
+		response.Hits = append(response.Hits, datarepository.Hit{Identifier: identifier, Value: found.Entities[i]})
+	}
+	for _, skipped := range found.Skipped {
+		response.Skipped = append(response.Skipped, skipped.Key)
+	}
+	return response, nil
+}
+
+// sqliteQueryCondition compiles a query to a condition on the JSON values. json_each yields
+// the elements of arrays and the value itself otherwise, so conditions on arrays match any element.
+func sqliteQueryCondition(query *datarepository.Query) (string, []interface{}) {
+	var groups []string
+	var args []interface{}
+	for _, group := range query.Groups() {
+		if len(group) == 0 {
+			continue
+		}
+		conditions := make([]string, 0, len(group))
+		for _, c := range group {
+			var match string
+			args = append(args, sqliteJSONPath(c.Field))
+			switch c.Operator {
+			case datarepository.QueryEquals:
+				// JSON booleans are read as integers, so they are compared by type
+				if b, isBool := c.Value.(bool); isBool {
+					match = fmt.Sprintf("json_each.type = '%t'", b)
+				} else {
+					match = "json_each.type NOT IN ('object', 'array', 'true', 'false') AND json_each.value = ?"
+					args = append(args, c.Value)
+				}
+			case datarepository.QueryRange:
+				match = "json_each.type IN ('integer', 'real')"
+				if !math.IsInf(c.Min, -1) {
+					match += " AND json_each.value >= ?"
+					args = append(args, c.Min)
+				}
+				if !math.IsInf(c.Max, 1) {
+					match += " AND json_each.value <= ?"
+					args = append(args, c.Max)
+				}
+			case datarepository.QueryTag:
+				match = "json_each.type = 'text' AND json_each.value IN (?" + strings.Repeat(", ?", len(c.Tags)-1) + ")"
+				for _, tag := range c.Tags {
+					args = append(args, tag)
+				}
+			}
+			conditions = append(conditions, "EXISTS (SELECT 1 FROM json_each(CAST(entities.value AS TEXT), ?) WHERE "+match+")")
+		}
+		groups = append(groups, "("+strings.Join(conditions, " AND ")+")")
+	}
+	if len(groups) == 0 {
+		return "1", nil
+	}
+	return strings.Join(groups, " OR "), args
+}
+
+// sqliteJSONPath converts field path parts to a JSON path, quoting object keys
+func sqliteJSONPath(parts []string) string {
+	var sb strings.Builder
+	sb.WriteString("$")
+	for _, part := range parts {
+		if index, err := strconv.Atoi(part); err == nil && index >= 0 {
+			sb.WriteString("[" + strconv.Itoa(index) + "]")
+		} else {
+			sb.WriteString(`."` + part + `"`)
+		}
+	}
+	return sb.String()
+}
+
+func (r *SQLiteRepository) AcquireLock(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (bool, error) {
+	_, acquired, err := r.AcquireLockWithToken(ctx, identifier, ttl)
+	return acquired, err
+}
+
+func (r *SQLiteRepository) AcquireLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	key, err := r.lockKey(identifier)
+	if err != nil {
+		return "", false, err
+	}
+	token := datarepository.NewLockToken()
+	// An expired lock that wasn't swept yet is taken over
+	result, err := r.conn.ExecContext(ctx, `INSERT INTO locks (key, token, expires_at) VALUES (?, ?, ?)
+		ON CONFLICT (key) DO UPDATE SET token = excluded.token, expires_at = excluded.expires_at
+		WHERE locks.expires_at <= ?`, key, token, expiresAt(ttl), nowMillis())
+	if err != nil {
+		return "", false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return "", false, nil
+	}
+	return token, true, nil
+}
+
+func (r *SQLiteRepository) ReleaseLock(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	key, err := r.lockKey(identifier)
+	if err != nil {
+		return err
+	}
+	result, err := r.conn.ExecContext(ctx, `DELETE FROM locks WHERE key = ?`, key)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) ReleaseLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	key, err := r.lockKey(identifier)
+	if err != nil {
+		return err
+	}
+	now := nowMillis()
+	result, err := r.conn.ExecContext(ctx, `DELETE FROM locks WHERE key = ? AND token = ? AND expires_at > ?`, key, token, now)
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 1 {
+		return nil
+	}
+
+	var held int
+	if err := r.conn.QueryRowContext(ctx, `SELECT COUNT(*) FROM locks WHERE key = ? AND expires_at > ?`, key, now).Scan(&held); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if held == 0 {
+		return datarepository.ErrNotFound
+	}
+	return datarepository.ErrLockNotOwned
+}
+
+func (r *SQLiteRepository) RenewLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	key, err := r.lockKey(identifier)
+	if err != nil {
+		return false, err
+	}
+	result, err := r.conn.ExecContext(ctx, `UPDATE locks SET expires_at = ? WHERE key = ? AND token = ? AND expires_at > ?`,
+		expiresAt(ttl), key, token, nowMillis())
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1, nil
+}
+
+// lockKey returns the key of the lock for the given identifier
+func (r *SQLiteRepository) lockKey(identifier datarepository.EntityIdentifier) (string, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return "", err
+	}
+	return prefix + datarepository.DefaultKeySeparator + id, nil
+}
+
+func (r *SQLiteRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	if r.tx != nil {
+		r.pending = append(r.pending, pendingMessage{channel: channel, message: message})
+		return nil
+	}
+	return r.pubsub.Publish(ctx, channel, message)
+}
+
+func (r *SQLiteRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	if r.tx != nil {
+		return nil, datarepository.ErrInTransaction
+	}
+	return r.pubsub.Subscribe(ctx, channel)
+}
+
+func (r *SQLiteRepository) SubscribeMessages(ctx context.Context, channel string) (datarepository.Subscription, error) {
+	if r.tx != nil {
+		return nil, datarepository.ErrInTransaction
+	}
+	return r.pubsub.SubscribeMessages(ctx, channel)
+}
+
+func (r *SQLiteRepository) PSubscribe(ctx context.Context, pattern string) (datarepository.Subscription, error) {
+	if r.tx != nil {
+		return nil, datarepository.ErrInTransaction
+	}
+	return r.pubsub.PSubscribe(ctx, pattern)
+}
+
+func (r *SQLiteRepository) Ping(ctx context.Context) error {
+	if r.tx != nil {
+		// The transaction holds the only connection
+		return ctx.Err()
+	}
+	if err := r.db.PingContext(ctx); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) Close() error {
+	if r.tx != nil {
+		return datarepository.ErrInTransaction
+	}
+	r.sweeper.Stop()
+	r.pubsub.Close()
+	return r.db.Close()
+}
+
+func (r *SQLiteRepository) SetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	result, err := r.conn.ExecContext(ctx, `UPDATE entities SET expires_at = ? WHERE prefix = ? AND id = ? AND `+sqliteLive,
+		expiresAt(expiration), prefix, id, nowMillis())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+func (r *SQLiteRepository) SetExpirationMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, expiration time.Duration) error {
+	batchErr := &datarepository.BatchError{}
+	for _, identifier := range identifiers {
+		if err := r.SetExpiration(ctx, identifier, expiration); err != nil {
+			batchErr.Add(identifier, err)
+		}
+	}
+	return batchErr.ErrOrNil()
+}
+
+func (r *SQLiteRepository) SetExpirationCond(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration, cond datarepository.ExpirationCondition) (bool, error) {
+	// The condition is part of the statement, so checking and setting happen atomically
+	var condition string
+	switch cond {
+	case datarepository.ExpireNX:
+		condition = "expires_at IS NULL"
+	case datarepository.ExpireXX:
+		condition = "expires_at IS NOT NULL"
+	case datarepository.ExpireGT:
+		// No expiration counts as infinite, which can't be exceeded
+		condition = "expires_at IS NOT NULL AND expires_at < ?1"
+	case datarepository.ExpireLT:
+		condition = "(expires_at IS NULL OR expires_at > ?1)"
+	default:
+		return false, fmt.Errorf("%w: unknown expiration condition %q", datarepository.ErrInvalidInput, cond)
+	}
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return false, err
+	}
+
+	result, err := r.conn.ExecContext(ctx, `UPDATE entities SET expires_at = ?1
+		WHERE prefix = ?2 AND id = ?3 AND (expires_at IS NULL OR expires_at > ?4) AND `+condition,
+		expiresAt(expiration), prefix, id, nowMillis())
+	if err != nil {
+		return false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	affected, _ := result.RowsAffected()
+	return affected == 1, nil
+}
+
+func (r *SQLiteRepository) GetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier) (time.Duration, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	_, expires, err := r.readRow(ctx, prefix, id)
+	if err != nil {
+		return 0, err
+	}
+	if !expires.Valid {
+		return 0, datarepository.ErrNotFound
+	}
+	return ttlFromMillis(expires), nil
+}
+
+func (r *SQLiteRepository) Persist(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return err
+	}
+	result, err := r.conn.ExecContext(ctx, `UPDATE entities SET expires_at = NULL WHERE prefix = ? AND id = ? AND `+sqliteLive,
+		prefix, id, nowMillis())
+	if err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if affected, _ := result.RowsAffected(); affected == 0 {
+		return datarepository.ErrNotFound
+	}
+	return nil
+}
+
+// Touch only checks that the entity exists
+func (r *SQLiteRepository) Touch(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	return datarepository.TouchExisting(ctx, r, identifier)
+}
+
+func (r *SQLiteRepository) AtomicIncrement(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	return r.IncrementBy(ctx, identifier, 1)
+}
+
+func (r *SQLiteRepository) IncrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	value, _, err := r.IncrementWithLimit(ctx, identifier, delta, math.MaxInt64)
+	return value, err
+}
+
+func (r *SQLiteRepository) DecrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	return r.IncrementBy(ctx, identifier, -delta)
+}
+
+func (r *SQLiteRepository) IncrementWithLimit(ctx context.Context, identifier datarepository.EntityIdentifier, delta, max int64) (int64, bool, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, false, err
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, false, err
+	}
+	defer tx.Rollback()
+
+	var value int64
+	var data []byte
+	err = tx.QueryRowContext(ctx, `SELECT value FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&data)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err == nil {
+		if err := r.codec.Unmarshal(data, &value); err != nil {
+			return 0, false, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+		}
+	}
+	if value+delta > max {
+		return value, false, nil
+	}
+	value += delta
+	encoded, err := r.encode(value)
+	if err != nil {
+		return 0, false, err
+	}
+	if err := r.upsert(ctx, tx, prefix, id, encoded); err != nil {
+		return 0, false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, false, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return value, true, nil
+}
+
+func (r *SQLiteRepository) IncrementWithExpiry(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	if ttl <= 0 {
+		return 0, fmt.Errorf("%w: ttl must be positive", datarepository.ErrInvalidInput)
+	}
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var value int64
+	var data []byte
+	err = tx.QueryRowContext(ctx, `SELECT value FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&data)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err == nil {
+		if err := r.codec.Unmarshal(data, &value); err != nil {
+			return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+		}
+	}
+	value += delta
+	encoded, err := r.encode(value)
+	if err != nil {
+		return 0, err
+	}
+	// upsert clears the expiration of an expired counter, so it gets a new one as well
+	if err := r.upsert(ctx, tx, prefix, id, encoded); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, `UPDATE entities SET expires_at = ? WHERE prefix = ? AND id = ? AND expires_at IS NULL`,
+		expiresAt(ttl), prefix, id); err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return value, nil
+}
+
+func (r *SQLiteRepository) IncrementFloat(ctx context.Context, identifier datarepository.EntityIdentifier, delta float64) (float64, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var value float64
+	var data []byte
+	err = tx.QueryRowContext(ctx, `SELECT value FROM entities WHERE prefix = ? AND id = ? AND `+sqliteLive, prefix, id, nowMillis()).Scan(&data)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	if err == nil {
+		if err := r.codec.Unmarshal(data, &value); err != nil {
+			return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+		}
+	}
+	value += delta
+	encoded, err := r.encode(value)
+	if err != nil {
+		return 0, err
+	}
+	if err := r.upsert(ctx, tx, prefix, id, encoded); err != nil {
+		return 0, err
+	}
+	if err := tx.Commit(); err != nil {
+		return 0, fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+	return value, nil
+}
+
+func (r *SQLiteRepository) GetCounter(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	prefix, id, err := datarepository.SplitEntityIdentifier(identifier)
+	if err != nil {
+		return 0, err
+	}
+	data, _, err := r.readRow(ctx, prefix, id)
+	if err != nil {
+		return 0, err
+	}
+	var value int64
+	if err := r.codec.Unmarshal(data, &value); err != nil {
+		return 0, fmt.Errorf("%w: value is not a counter", datarepository.ErrInvalidInput)
+	}
+	return value, nil
+}
+
+func (r *SQLiteRepository) SetCounter(ctx context.Context, identifier datarepository.EntityIdentifier, value int64) error {
+	return r.Upsert(ctx, identifier, value)
+}
+
+// WithTransaction runs fn within a database transaction, or a savepoint if r is already within one.
+// While it runs, other operations on the repository wait for the single connection.
+func (r *SQLiteRepository) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	tx, err := r.begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	txRepo := &SQLiteRepository{
+		BaseRepository:  r.BaseRepository,
+		db:              r.db,
+		conn:            tx.Tx,
+		pubsub:          r.pubsub,
+		codec:           r.codec,
+		idGen:           r.idGen,
+		notFoundOnEmpty: r.notFoundOnEmpty,
+		logger:          r.logger,
+		tx:              tx.Tx,
+	}
+	if err := fn(txRepo); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("%w: %v", datarepository.ErrOperationFailed, err)
+	}
+
+	for _, pending := range txRepo.pending {
+		if err := r.Publish(ctx, pending.channel, pending.message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// cleanupExpired deletes expired entities and locks and returns how many entities were reclaimed
+func (r *SQLiteRepository) cleanupExpired() int {
+	now := nowMillis()
+	result, err := r.db.Exec(`DELETE FROM entities WHERE expires_at <= ?`, now)
+	if err != nil {
+		r.logger.Errorf("failed to delete expired entities: %v", err)
+		return 0
+	}
+	if _, err := r.db.Exec(`DELETE FROM locks WHERE expires_at <= ?`, now); err != nil {
+		r.logger.Errorf("failed to delete expired locks: %v", err)
+	}
+	reclaimed, _ := result.RowsAffected()
+	return int(reclaimed)
+}
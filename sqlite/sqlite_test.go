@@ -0,0 +1,72 @@
+// sqlite/sqlite_test.go
+
+package sqlite
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"github.com/itsatony/go-datarepository/datarepositorytest"
+)
+
+// newTestSQLiteRepository returns an SQLiteRepository on a database file in a temporary directory
+// that is closed when the test ends
+func newTestSQLiteRepository(t *testing.T, config SQLiteConfig) *SQLiteRepository {
+	t.Helper()
+	if config.Path == "" {
+		config.Path = filepath.Join(t.TempDir(), "test.db")
+	}
+	repo, err := NewSQLiteRepository(config)
+	if err != nil {
+		t.Fatalf("NewSQLiteRepository: %v", err)
+	}
+	t.Cleanup(func() { repo.Close() })
+	return repo.(*SQLiteRepository)
+}
+
+func TestSQLiteConformance(t *testing.T) {
+	datarepositorytest.Conformance(t, newTestSQLiteRepository(t, SQLiteConfig{}))
+}
+
+func TestSQLitePersistsAcrossReopen(t *testing.T) {
+	ctx := context.Background()
+	path := filepath.Join(t.TempDir(), "test.db")
+	first := newTestSQLiteRepository(t, SQLiteConfig{Path: path})
+	if err := first.Create(ctx, datarepository.SimpleIdentifier("user:1"), map[string]string{"name": "ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := first.CreateWithTTL(ctx, datarepository.SimpleIdentifier("user:2"), map[string]string{"name": "bob"}, time.Hour); err != nil {
+		t.Fatalf("CreateWithTTL: %v", err)
+	}
+	if err := first.Close(); err != nil {
+		t.Fatalf("Close: %v", err)
+	}
+
+	second := newTestSQLiteRepository(t, SQLiteConfig{Path: path})
+	var value map[string]string
+	if err := second.Read(ctx, datarepository.SimpleIdentifier("user:1"), &value); err != nil || value["name"] != "ann" {
+		t.Errorf("Read after reopening: got %v, %v", value, err)
+	}
+	if ttl, err := second.GetExpiration(ctx, datarepository.SimpleIdentifier("user:2")); err != nil || ttl <= 0 || ttl > time.Hour {
+		t.Errorf("GetExpiration after reopening: got %v, %v, want up to an hour", ttl, err)
+	}
+}
+
+func TestCreateDataRepositoryRejectsInvalidSQLiteConfigs(t *testing.T) {
+	for _, tc := range []struct {
+		config SQLiteConfig
+		want   string
+	}{
+		{SQLiteConfig{}, "SQLiteConfig: Path is empty"},
+	} {
+		_, err := datarepository.CreateDataRepository("sqlite", tc.config)
+		if !errors.Is(err, datarepository.ErrInvalidInput) || !strings.Contains(err.Error(), tc.want) {
+			t.Errorf("%+v: got %v, want ErrInvalidInput containing %q", tc.config, err, tc.want)
+		}
+	}
+}
@@ -0,0 +1,518 @@
+// tracing/tracing.go
+
+// Package tracing records an OpenTelemetry span for each operation of a datarepository.DataRepository.
+// It wraps any repository, so it works the same for every backend.
+package tracing
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	SpanNamePrefix = "datarepository."
+
+	AttributeOperation    = "db.operation.name"
+	AttributeEntityPrefix = "datarepository.entity_prefix"
+	AttributeNotFound     = "datarepository.not_found"
+)
+
+// TracedRepository wraps a DataRepository and starts a span for every operation. The span is named
+// after the operation and carries the entity prefix of the identifier, never the full identifier,
+// to keep the number of distinct attribute values bounded. Its status is set to Error if the
+// operation fails; ErrNotFound is an expected outcome and only sets the not_found attribute.
+// Ping, Close and the plugin methods are passed through without a span.
+type TracedRepository struct {
+	inner  datarepository.DataRepository
+	tracer trace.Tracer
+	// txSpan is the span of the transaction, set on the repository passed to a WithTransaction
+	// function so that the operations within it become its children
+	txSpan trace.Span
+}
+
+var _ datarepository.DataRepository = (*TracedRepository)(nil)
+
+// WithTracing wraps repo so that each operation is recorded as a span started with tracer
+func WithTracing(repo datarepository.DataRepository, tracer trace.Tracer) *TracedRepository {
+	return &TracedRepository{inner: repo, tracer: tracer}
+}
+
+// Unwrap returns the wrapped repository
+func (r *TracedRepository) Unwrap() datarepository.DataRepository {
+	return r.inner
+}
+
+// start starts the span of an operation on entities with the given prefix, which may be empty
+func (r *TracedRepository) start(ctx context.Context, op datarepository.Operation, entityPrefix string) (context.Context, trace.Span) {
+	if r.txSpan != nil {
+		ctx = trace.ContextWithSpan(ctx, r.txSpan)
+	}
+	attributes := []attribute.KeyValue{attribute.String(AttributeOperation, string(op))}
+	if entityPrefix != "" {
+		attributes = append(attributes, attribute.String(AttributeEntityPrefix, entityPrefix))
+	}
+	return r.tracer.Start(ctx, SpanNamePrefix+string(op), trace.WithAttributes(attributes...))
+}
+
+// end sets the status of a span from the error of its operation and ends it
+func (r *TracedRepository) end(span trace.Span, err error) {
+	switch {
+	case err == nil:
+	case errors.Is(err, datarepository.ErrNotFound):
+		span.SetAttributes(attribute.Bool(AttributeNotFound, true))
+	default:
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+func (r *TracedRepository) Create(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpCreate, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Create(ctx, identifier, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) CreateWithGeneratedID(ctx context.Context, entityPrefix string, value interface{}) (datarepository.EntityIdentifier, error) {
+	ctx, span := r.start(ctx, datarepository.OpCreateWithGeneratedID, entityPrefix)
+	identifier, err := r.inner.CreateWithGeneratedID(ctx, entityPrefix, value)
+	r.end(span, err)
+	return identifier, err
+}
+
+func (r *TracedRepository) CreateIfAbsent(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) (bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpCreateIfAbsent, datarepository.EntityPrefixOf(identifier))
+	created, err := r.inner.CreateIfAbsent(ctx, identifier, value, ttl)
+	r.end(span, err)
+	return created, err
+}
+
+func (r *TracedRepository) CreateWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	ctx, span := r.start(ctx, datarepository.OpCreateWithTTL, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.CreateWithTTL(ctx, identifier, value, ttl)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Read(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpRead, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Read(ctx, identifier, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) ReadWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) (time.Duration, error) {
+	ctx, span := r.start(ctx, datarepository.OpReadWithTTL, datarepository.EntityPrefixOf(identifier))
+	ttl, err := r.inner.ReadWithTTL(ctx, identifier, value)
+	r.end(span, err)
+	return ttl, err
+}
+
+func (r *TracedRepository) Exists(ctx context.Context, identifier datarepository.EntityIdentifier) (bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpExists, datarepository.EntityPrefixOf(identifier))
+	ok, err := r.inner.Exists(ctx, identifier)
+	r.end(span, err)
+	return ok, err
+}
+
+func (r *TracedRepository) ExistsMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) (map[datarepository.EntityIdentifier]bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpExistsMany, "")
+	result, err := r.inner.ExistsMany(ctx, identifiers)
+	r.end(span, err)
+	return result, err
+}
+
+func (r *TracedRepository) Upsert(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpUpsert, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Upsert(ctx, identifier, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) UpsertWithTTL(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, ttl time.Duration) error {
+	ctx, span := r.start(ctx, datarepository.OpUpsertWithTTL, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.UpsertWithTTL(ctx, identifier, value, ttl)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) UpsertManyWithTTL(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}, ttl time.Duration) error {
+	ctx, span := r.start(ctx, datarepository.OpUpsertManyWithTTL, "")
+	err := r.inner.UpsertManyWithTTL(ctx, items, ttl)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Update(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpUpdate, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Update(ctx, identifier, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) UpdateField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpUpdateField, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.UpdateField(ctx, identifier, path, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) CompareAndSwap(ctx context.Context, identifier datarepository.EntityIdentifier, expected, newValue interface{}) (bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpCompareAndSwap, datarepository.EntityPrefixOf(identifier))
+	ok, err := r.inner.CompareAndSwap(ctx, identifier, expected, newValue)
+	r.end(span, err)
+	return ok, err
+}
+
+func (r *TracedRepository) UpdateWithVersion(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}, expectedVersion int64) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpUpdateWithVersion, datarepository.EntityPrefixOf(identifier))
+	newVersion, err := r.inner.UpdateWithVersion(ctx, identifier, value, expectedVersion)
+	r.end(span, err)
+	return newVersion, err
+}
+
+func (r *TracedRepository) GetVersion(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpGetVersion, datarepository.EntityPrefixOf(identifier))
+	version, err := r.inner.GetVersion(ctx, identifier)
+	r.end(span, err)
+	return version, err
+}
+
+func (r *TracedRepository) ReadField(ctx context.Context, identifier datarepository.EntityIdentifier, path string, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpReadField, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.ReadField(ctx, identifier, path, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Delete(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	ctx, span := r.start(ctx, datarepository.OpDelete, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Delete(ctx, identifier)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) GetAndDelete(ctx context.Context, identifier datarepository.EntityIdentifier, value interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpGetAndDelete, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.GetAndDelete(ctx, identifier, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) GetAndSet(ctx context.Context, identifier datarepository.EntityIdentifier, newValue, oldValue interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpGetAndSet, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.GetAndSet(ctx, identifier, newValue, oldValue)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) CreateMany(ctx context.Context, items map[datarepository.EntityIdentifier]interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpCreateMany, "")
+	err := r.inner.CreateMany(ctx, items)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) ReadMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	ctx, span := r.start(ctx, datarepository.OpReadMany, "")
+	err := r.inner.ReadMany(ctx, identifiers, fn)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) ReadManyOrdered(ctx context.Context, identifiers []datarepository.EntityIdentifier, dest interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpReadManyOrdered, "")
+	err := r.inner.ReadManyOrdered(ctx, identifiers, dest)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) DeleteMany(ctx context.Context, identifiers []datarepository.EntityIdentifier) error {
+	ctx, span := r.start(ctx, datarepository.OpDeleteMany, "")
+	err := r.inner.DeleteMany(ctx, identifiers)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) DeletePattern(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpDeletePattern, datarepository.EntityPrefixOf(pattern))
+	deleted, err := r.inner.DeletePattern(ctx, pattern)
+	r.end(span, err)
+	return deleted, err
+}
+
+func (r *TracedRepository) List(ctx context.Context, pattern string) ([]datarepository.EntityIdentifier, []interface{}, error) {
+	ctx, span := r.start(ctx, datarepository.OpList, "")
+	identifiers, entities, err := r.inner.List(ctx, pattern)
+	r.end(span, err)
+	return identifiers, entities, err
+}
+
+func (r *TracedRepository) ListDetailed(ctx context.Context, pattern string) (datarepository.ListResult, error) {
+	ctx, span := r.start(ctx, datarepository.OpListDetailed, "")
+	result, err := r.inner.ListDetailed(ctx, pattern)
+	r.end(span, err)
+	return result, err
+}
+
+func (r *TracedRepository) ListPaged(ctx context.Context, pattern string, cursor uint64, pageSize int64) ([]datarepository.EntityIdentifier, []interface{}, uint64, error) {
+	ctx, span := r.start(ctx, datarepository.OpListPaged, "")
+	identifiers, entities, nextCursor, err := r.inner.ListPaged(ctx, pattern, cursor, pageSize)
+	r.end(span, err)
+	return identifiers, entities, nextCursor, err
+}
+
+func (r *TracedRepository) ListPage(ctx context.Context, pattern string, cursor string, pageSize int) ([]datarepository.EntityIdentifier, string, error) {
+	ctx, span := r.start(ctx, datarepository.OpListPage, "")
+	identifiers, nextCursor, err := r.inner.ListPage(ctx, pattern, cursor, pageSize)
+	r.end(span, err)
+	return identifiers, nextCursor, err
+}
+
+func (r *TracedRepository) Count(ctx context.Context, pattern datarepository.EntityIdentifier) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpCount, datarepository.EntityPrefixOf(pattern))
+	count, err := r.inner.Count(ctx, pattern)
+	r.end(span, err)
+	return count, err
+}
+
+func (r *TracedRepository) Iterate(ctx context.Context, pattern datarepository.EntityIdentifier, fn func(identifier datarepository.EntityIdentifier, raw []byte) error) error {
+	ctx, span := r.start(ctx, datarepository.OpIterate, datarepository.EntityPrefixOf(pattern))
+	err := r.inner.Iterate(ctx, pattern, fn)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) EntityPrefixes(ctx context.Context) ([]string, error) {
+	ctx, span := r.start(ctx, datarepository.OpEntityPrefixes, "")
+	prefixes, err := r.inner.EntityPrefixes(ctx)
+	r.end(span, err)
+	return prefixes, err
+}
+
+func (r *TracedRepository) ListPrefixes(ctx context.Context) ([]string, error) {
+	return r.EntityPrefixes(ctx)
+}
+
+func (r *TracedRepository) Search(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) ([]datarepository.EntityIdentifier, error) {
+	ctx, span := r.start(ctx, datarepository.OpSearch, "")
+	identifiers, err := r.inner.Search(ctx, query, offset, limit, sortBy, sortDir)
+	r.end(span, err)
+	return identifiers, err
+}
+
+func (r *TracedRepository) SearchDetailed(ctx context.Context, query string, offset, limit int, sortBy, sortDir string) (datarepository.SearchResult, error) {
+	ctx, span := r.start(ctx, datarepository.OpSearchDetailed, "")
+	result, err := r.inner.SearchDetailed(ctx, query, offset, limit, sortBy, sortDir)
+	r.end(span, err)
+	return result, err
+}
+
+func (r *TracedRepository) SearchResults(ctx context.Context, query string, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	ctx, span := r.start(ctx, datarepository.OpSearchResults, "")
+	response, err := r.inner.SearchResults(ctx, query, opts)
+	r.end(span, err)
+	return response, err
+}
+
+func (r *TracedRepository) SearchQuery(ctx context.Context, query *datarepository.Query, opts datarepository.SearchOptions) (datarepository.SearchResponse, error) {
+	ctx, span := r.start(ctx, datarepository.OpSearchQuery, "")
+	response, err := r.inner.SearchQuery(ctx, query, opts)
+	r.end(span, err)
+	return response, err
+}
+
+func (r *TracedRepository) AcquireLock(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpAcquireLock, datarepository.EntityPrefixOf(identifier))
+	ok, err := r.inner.AcquireLock(ctx, identifier, ttl)
+	r.end(span, err)
+	return ok, err
+}
+
+func (r *TracedRepository) AcquireLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, ttl time.Duration) (string, bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpAcquireLockWithToken, datarepository.EntityPrefixOf(identifier))
+	token, ok, err := r.inner.AcquireLockWithToken(ctx, identifier, ttl)
+	r.end(span, err)
+	return token, ok, err
+}
+
+func (r *TracedRepository) ReleaseLock(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	ctx, span := r.start(ctx, datarepository.OpReleaseLock, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.ReleaseLock(ctx, identifier)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) ReleaseLockWithToken(ctx context.Context, identifier datarepository.EntityIdentifier, token string) error {
+	ctx, span := r.start(ctx, datarepository.OpReleaseLockWithToken, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.ReleaseLockWithToken(ctx, identifier, token)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) RenewLock(ctx context.Context, identifier datarepository.EntityIdentifier, token string, ttl time.Duration) (bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpRenewLock, datarepository.EntityPrefixOf(identifier))
+	ok, err := r.inner.RenewLock(ctx, identifier, token, ttl)
+	r.end(span, err)
+	return ok, err
+}
+
+func (r *TracedRepository) Publish(ctx context.Context, channel string, message interface{}) error {
+	ctx, span := r.start(ctx, datarepository.OpPublish, "")
+	err := r.inner.Publish(ctx, channel, message)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Subscribe(ctx context.Context, channel string) (chan interface{}, error) {
+	ctx, span := r.start(ctx, datarepository.OpSubscribe, "")
+	ch, err := r.inner.Subscribe(ctx, channel)
+	r.end(span, err)
+	return ch, err
+}
+
+func (r *TracedRepository) SubscribeMessages(ctx context.Context, channel string) (datarepository.Subscription, error) {
+	ctx, span := r.start(ctx, datarepository.OpSubscribeMessages, "")
+	sub, err := r.inner.SubscribeMessages(ctx, channel)
+	r.end(span, err)
+	return sub, err
+}
+
+func (r *TracedRepository) PSubscribe(ctx context.Context, pattern string) (datarepository.Subscription, error) {
+	ctx, span := r.start(ctx, datarepository.OpPSubscribe, "")
+	sub, err := r.inner.PSubscribe(ctx, pattern)
+	r.end(span, err)
+	return sub, err
+}
+
+func (r *TracedRepository) SetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration) error {
+	ctx, span := r.start(ctx, datarepository.OpSetExpiration, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.SetExpiration(ctx, identifier, expiration)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) SetExpirationMany(ctx context.Context, identifiers []datarepository.EntityIdentifier, expiration time.Duration) error {
+	ctx, span := r.start(ctx, datarepository.OpSetExpirationMany, "")
+	err := r.inner.SetExpirationMany(ctx, identifiers, expiration)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) SetExpirationCond(ctx context.Context, identifier datarepository.EntityIdentifier, expiration time.Duration, cond datarepository.ExpirationCondition) (bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpSetExpirationCond, datarepository.EntityPrefixOf(identifier))
+	ok, err := r.inner.SetExpirationCond(ctx, identifier, expiration, cond)
+	r.end(span, err)
+	return ok, err
+}
+
+func (r *TracedRepository) GetExpiration(ctx context.Context, identifier datarepository.EntityIdentifier) (time.Duration, error) {
+	ctx, span := r.start(ctx, datarepository.OpGetExpiration, datarepository.EntityPrefixOf(identifier))
+	ttl, err := r.inner.GetExpiration(ctx, identifier)
+	r.end(span, err)
+	return ttl, err
+}
+
+func (r *TracedRepository) Persist(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	ctx, span := r.start(ctx, datarepository.OpPersist, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Persist(ctx, identifier)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Touch(ctx context.Context, identifier datarepository.EntityIdentifier) error {
+	ctx, span := r.start(ctx, datarepository.OpTouch, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.Touch(ctx, identifier)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) AtomicIncrement(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpAtomicIncrement, datarepository.EntityPrefixOf(identifier))
+	value, err := r.inner.AtomicIncrement(ctx, identifier)
+	r.end(span, err)
+	return value, err
+}
+
+func (r *TracedRepository) IncrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpIncrementBy, datarepository.EntityPrefixOf(identifier))
+	value, err := r.inner.IncrementBy(ctx, identifier, delta)
+	r.end(span, err)
+	return value, err
+}
+
+func (r *TracedRepository) DecrementBy(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpDecrementBy, datarepository.EntityPrefixOf(identifier))
+	value, err := r.inner.DecrementBy(ctx, identifier, delta)
+	r.end(span, err)
+	return value, err
+}
+
+func (r *TracedRepository) IncrementWithLimit(ctx context.Context, identifier datarepository.EntityIdentifier, delta, max int64) (int64, bool, error) {
+	ctx, span := r.start(ctx, datarepository.OpIncrementWithLimit, datarepository.EntityPrefixOf(identifier))
+	value, ok, err := r.inner.IncrementWithLimit(ctx, identifier, delta, max)
+	r.end(span, err)
+	return value, ok, err
+}
+
+func (r *TracedRepository) IncrementWithExpiry(ctx context.Context, identifier datarepository.EntityIdentifier, delta int64, ttl time.Duration) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpIncrementWithExpiry, datarepository.EntityPrefixOf(identifier))
+	value, err := r.inner.IncrementWithExpiry(ctx, identifier, delta, ttl)
+	r.end(span, err)
+	return value, err
+}
+
+func (r *TracedRepository) IncrementFloat(ctx context.Context, identifier datarepository.EntityIdentifier, delta float64) (float64, error) {
+	ctx, span := r.start(ctx, datarepository.OpIncrementFloat, datarepository.EntityPrefixOf(identifier))
+	value, err := r.inner.IncrementFloat(ctx, identifier, delta)
+	r.end(span, err)
+	return value, err
+}
+
+func (r *TracedRepository) GetCounter(ctx context.Context, identifier datarepository.EntityIdentifier) (int64, error) {
+	ctx, span := r.start(ctx, datarepository.OpGetCounter, datarepository.EntityPrefixOf(identifier))
+	value, err := r.inner.GetCounter(ctx, identifier)
+	r.end(span, err)
+	return value, err
+}
+
+func (r *TracedRepository) SetCounter(ctx context.Context, identifier datarepository.EntityIdentifier, value int64) error {
+	ctx, span := r.start(ctx, datarepository.OpSetCounter, datarepository.EntityPrefixOf(identifier))
+	err := r.inner.SetCounter(ctx, identifier, value)
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) Ping(ctx context.Context) error {
+	return r.inner.Ping(ctx)
+}
+
+func (r *TracedRepository) Close() error {
+	return r.inner.Close()
+}
+
+// WithTransaction records the transaction as a span and passes fn a transaction whose operations
+// are recorded as children of that span
+func (r *TracedRepository) WithTransaction(ctx context.Context, fn func(tx datarepository.DataRepository) error) error {
+	ctx, span := r.start(ctx, datarepository.OpWithTransaction, "")
+	err := r.inner.WithTransaction(ctx, func(tx datarepository.DataRepository) error {
+		return fn(&TracedRepository{inner: tx, tracer: r.tracer, txSpan: span})
+	})
+	r.end(span, err)
+	return err
+}
+
+func (r *TracedRepository) RegisterPlugin(plugin datarepository.RepositoryPlugin) error {
+	return r.inner.RegisterPlugin(plugin)
+}
+
+func (r *TracedRepository) GetPlugin(name string) (datarepository.RepositoryPlugin, bool) {
+	return r.inner.GetPlugin(name)
+}
@@ -0,0 +1,140 @@
+// tracing/tracing_test.go
+
+package tracing
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+
+	datarepository "github.com/itsatony/go-datarepository"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/trace"
+	"go.opentelemetry.io/otel/trace/noop"
+)
+
+// recordingTracer is a trace.Tracer that keeps the spans it starts in memory
+type recordingTracer struct {
+	noop.Tracer
+	mu    sync.Mutex
+	spans []*recordedSpan
+}
+
+// recordedSpan is a span of a recordingTracer
+type recordedSpan struct {
+	noop.Span
+	name       string
+	parent     string
+	attributes map[attribute.Key]attribute.Value
+	status     codes.Code
+	ended      bool
+}
+
+func (t *recordingTracer) Start(ctx context.Context, name string, opts ...trace.SpanStartOption) (context.Context, trace.Span) {
+	span := &recordedSpan{name: name, attributes: make(map[attribute.Key]attribute.Value)}
+	if parent, ok := trace.SpanFromContext(ctx).(*recordedSpan); ok {
+		span.parent = parent.name
+	}
+	config := trace.NewSpanStartConfig(opts...)
+	span.SetAttributes(config.Attributes()...)
+	t.mu.Lock()
+	t.spans = append(t.spans, span)
+	t.mu.Unlock()
+	return trace.ContextWithSpan(ctx, span), span
+}
+
+func (s *recordedSpan) SetAttributes(attributes ...attribute.KeyValue) {
+	for _, kv := range attributes {
+		s.attributes[kv.Key] = kv.Value
+	}
+}
+
+func (s *recordedSpan) SetStatus(code codes.Code, description string) {
+	s.status = code
+}
+
+func (s *recordedSpan) End(options ...trace.SpanEndOption) {
+	s.ended = true
+}
+
+func TestWithTracingRecordsSpans(t *testing.T) {
+	ctx := context.Background()
+	inner, err := datarepository.NewMemoryRepository(datarepository.MemoryConfig{})
+	if err != nil {
+		t.Fatalf("NewMemoryRepository: %v", err)
+	}
+	defer inner.Close()
+	tracer := &recordingTracer{}
+	repo := WithTracing(inner, tracer)
+
+	id := datarepository.SimpleIdentifier("user:1")
+	if err := repo.Create(ctx, id, map[string]string{"name": "ann"}); err != nil {
+		t.Fatalf("Create: %v", err)
+	}
+	if err := repo.Create(ctx, id, map[string]string{"name": "bob"}); !errors.Is(err, datarepository.ErrAlreadyExists) {
+		t.Fatalf("Create of an existing entity: got %v, want ErrAlreadyExists", err)
+	}
+	var value map[string]string
+	if err := repo.Read(ctx, datarepository.SimpleIdentifier("user:2"), &value); !errors.Is(err, datarepository.ErrNotFound) {
+		t.Fatalf("Read of a missing entity: got %v, want ErrNotFound", err)
+	}
+	err = repo.WithTransaction(ctx, func(tx datarepository.DataRepository) error {
+		return tx.Upsert(ctx, datarepository.SimpleIdentifier("order:1"), map[string]string{"item": "book"})
+	})
+	if err != nil {
+		t.Fatalf("WithTransaction: %v", err)
+	}
+
+	want := []struct {
+		name, parent, entityPrefix string
+		status                     codes.Code
+		notFound                   bool
+	}{
+		{"datarepository.Create", "", "user", codes.Unset, false},
+		{"datarepository.Create", "", "user", codes.Error, false},
+		{"datarepository.Read", "", "user", codes.Unset, true},
+		{"datarepository.WithTransaction", "", "", codes.Unset, false},
+		{"datarepository.Upsert", "datarepository.WithTransaction", "order", codes.Unset, false},
+	}
+	if len(tracer.spans) != len(want) {
+		t.Fatalf("got %d spans, want %d", len(tracer.spans), len(want))
+	}
+	for i, w := range want {
+		span := tracer.spans[i]
+		got := fmt.Sprintf("%s parent=%q prefix=%q status=%v not_found=%v ended=%v", span.name, span.parent,
+			span.attributes[AttributeEntityPrefix].AsString(), span.status, span.attributes[AttributeNotFound].AsBool(), span.ended)
+		expected := fmt.Sprintf("%s parent=%q prefix=%q status=%v not_found=%v ended=true", w.name, w.parent,
+			w.entityPrefix, w.status, w.notFound)
+		if got != expected {
+			t.Errorf("span %d: got %s, want %s", i, got, expected)
+		}
+		if op := span.attributes[AttributeOperation].AsString(); SpanNamePrefix+op != span.name {
+			t.Errorf("span %d: got operation attribute %q for span %s", i, op, span.name)
+		}
+		for key, value := range span.attributes {
+			if value.AsString() == "user:1" || value.AsString() == "user:2" {
+				t.Errorf("span %d records the full identifier as %s", i, key)
+			}
+		}
+	}
+}
+
+func ExampleWithTracing() {
+	repo, err := datarepository.NewMemoryRepository(datarepository.MemoryConfig{})
+	if err != nil {
+		panic(err)
+	}
+	defer repo.Close()
+	// In production, use the tracer of your configured provider, e.g. otel.Tracer("myapp")
+	repo = WithTracing(repo, noop.NewTracerProvider().Tracer("myapp"))
+
+	id := datarepository.SimpleIdentifier("user:1")
+	if err := repo.Create(context.Background(), id, map[string]string{"name": "ann"}); err != nil {
+		panic(err)
+	}
+	fmt.Println("created", id)
+	// Output: created user:1
+}